@@ -0,0 +1,7 @@
+// Package cosign contains the public key used to verify chezmoi's releases.
+package cosign
+
+import _ "embed"
+
+//go:embed cosign.pub
+var PublicKey []byte
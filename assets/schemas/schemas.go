@@ -0,0 +1,11 @@
+// Package schemas contains the JSON schemas of chezmoi's machine-readable
+// output.
+package schemas
+
+import _ "embed"
+
+//go:embed dump.v1.schema.json
+var DumpV1SchemaJSON string
+
+//go:embed dump-config.v1.schema.json
+var DumpConfigV1SchemaJSON string
@@ -0,0 +1,7 @@
+// Package scripts contains chezmoi's install scripts.
+package scripts
+
+import _ "embed"
+
+//go:embed install.sh
+var InstallSH []byte
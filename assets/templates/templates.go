@@ -3,8 +3,23 @@ package templates
 
 import _ "embed"
 
+//go:embed BUNDLE.sh.tmpl
+var BundleSHTmpl string
+
 //go:embed COMMIT_MESSAGE.tmpl
 var CommitMessageTmpl string
 
-//go:embed install.sh
-var InstallSH []byte
+//go:embed CONVENTIONAL_COMMIT_MESSAGE.tmpl
+var ConventionalCommitMessageTmpl string
+
+//go:embed devcontainer-feature-install.sh.tmpl
+var DevcontainerFeatureInstallSHTmpl string
+
+//go:embed devcontainer-feature.json.tmpl
+var DevcontainerFeatureJSONTmpl string
+
+//go:embed github-workflow.yaml.tmpl
+var GitHubWorkflowYAMLTmpl string
+
+//go:embed install.sh.tmpl
+var InstallSHTmpl string
@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"path"
 	"strings"
+	"time"
 )
 
 // A ArchiveReaderSystem a system constructed from reading an archive.
@@ -21,6 +22,7 @@ type ArchiveReaderSystem struct {
 type ArchiveReaderSystemOptions struct {
 	RootAbsPath     AbsPath
 	StripComponents int
+	PathMap         map[string]string // Maps paths in the archive to paths relative to RootAbsPath.
 }
 
 // NewArchiveReaderSystem returns a new ArchiveReaderSystem reading from data
@@ -49,6 +51,18 @@ func NewArchiveReaderSystem(
 			}
 			name = path.Join(components[options.StripComponents:]...)
 		}
+		if len(options.PathMap) != 0 {
+			var ok bool
+			if name, ok = mapArchivePath(options.PathMap, name); ok && name != "" {
+				s.addImplicitDirs(options.RootAbsPath, name, fileInfo.ModTime())
+				// The target name of an added entry is taken from its
+				// fs.FileInfo, so rename it to match its mapped path.
+				fileInfo = renamedFileInfo{
+					FileInfo: fileInfo,
+					name:     path.Base(name),
+				}
+			}
+		}
 		if name == "" {
 			return nil
 		}
@@ -77,6 +91,18 @@ func NewArchiveReaderSystem(
 	return s, nil
 }
 
+// addImplicitDirs adds the parent directories of name, relative to
+// rootAbsPath, that are not already in s.
+func (s *ArchiveReaderSystem) addImplicitDirs(rootAbsPath AbsPath, name string, modTime time.Time) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		dirAbsPath := rootAbsPath.JoinString(dir)
+		if _, ok := s.fileInfos[dirAbsPath]; ok {
+			return
+		}
+		s.fileInfos[dirAbsPath] = implicitDirHeader(dir+"/", modTime).FileInfo()
+	}
+}
+
 // FileInfos returns s's fs.FileInfos.
 func (s *ArchiveReaderSystem) FileInfos() map[AbsPath]fs.FileInfo {
 	return s.fileInfos
@@ -112,3 +138,35 @@ func (s *ArchiveReaderSystem) Readlink(name AbsPath) (string, error) {
 	}
 	return "", fs.ErrNotExist
 }
+
+// A renamedFileInfo is an fs.FileInfo with a different name.
+type renamedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+// Name implements fs.FileInfo.Name.
+func (fi renamedFileInfo) Name() string {
+	return fi.name
+}
+
+// mapArchivePath returns name mapped by the longest matching path in pathMap,
+// and true if name was mapped.
+func mapArchivePath(pathMap map[string]string, name string) (string, bool) {
+	longestFrom := ""
+	for from := range pathMap {
+		if len(from) > len(longestFrom) && (name == from || strings.HasPrefix(name, from+"/")) {
+			longestFrom = from
+		}
+	}
+	if longestFrom == "" {
+		return name, false
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(name, longestFrom), "/")
+	switch mappedName := path.Join(pathMap[longestFrom], rest); mappedName {
+	case ".":
+		return "", true
+	default:
+		return mappedName, true
+	}
+}
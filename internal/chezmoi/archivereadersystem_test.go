@@ -3,6 +3,7 @@ package chezmoi
 import (
 	"errors"
 	"io/fs"
+	"path"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
@@ -77,3 +78,67 @@ func TestArchiveReaderSystemTar(t *testing.T) {
 		}
 	}
 }
+
+func TestArchiveReaderSystemPathMap(t *testing.T) {
+	data, err := archivetest.NewTar(map[string]any{
+		"archive": map[string]any{
+			"README.md": "# contents of README.md\n",
+			"config": map[string]any{
+				"file": "# contents of config/file\n",
+				"nested": map[string]any{
+					"file": "# contents of config/nested/file\n",
+				},
+			},
+			"vimrc": "# contents of vimrc\n",
+		},
+	})
+	assert.NoError(t, err)
+
+	options := ArchiveReaderSystemOptions{
+		RootAbsPath:     NewAbsPath("/home/user"),
+		StripComponents: 1,
+		PathMap: map[string]string{
+			"config":        ".config/tool",
+			"config/nested": ".local/share/tool",
+			"vimrc":         ".vimrc",
+		},
+	}
+	archiveReaderSystem, err := NewArchiveReaderSystem("archive.tar", data, ArchiveFormatTar, options)
+	assert.NoError(t, err)
+
+	for absPath, expected := range map[string]string{
+		"/home/user/.config/tool/file":      "# contents of config/file\n",
+		"/home/user/.local/share/tool/file": "# contents of config/nested/file\n",
+		"/home/user/.vimrc":                 "# contents of vimrc\n",
+		"/home/user/README.md":              "# contents of README.md\n",
+	} {
+		actual, err := archiveReaderSystem.ReadFile(NewAbsPath(absPath))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+	}
+
+	for _, absPath := range []string{
+		"/home/user/.config",
+		"/home/user/.config/tool",
+		"/home/user/.local",
+		"/home/user/.local/share",
+		"/home/user/.local/share/tool",
+	} {
+		fileInfo, err := archiveReaderSystem.Lstat(NewAbsPath(absPath))
+		assert.NoError(t, err)
+		assert.True(t, fileInfo.IsDir())
+		assert.Equal(t, path.Base(absPath), fileInfo.Name())
+	}
+
+	fileInfo, err := archiveReaderSystem.Lstat(NewAbsPath("/home/user/.vimrc"))
+	assert.NoError(t, err)
+	assert.Equal(t, ".vimrc", fileInfo.Name())
+
+	for _, absPath := range []string{
+		"/home/user/config",
+		"/home/user/vimrc",
+	} {
+		_, err := archiveReaderSystem.Lstat(NewAbsPath(absPath))
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	}
+}
@@ -1,8 +1,11 @@
 package chezmoi
 
 import (
+	"fmt"
 	"io/fs"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -31,6 +34,11 @@ var sourceFileTypeStrs = map[SourceFileTargetType]string{
 	SourceFileTypeSymlink: "symlink",
 }
 
+// String returns t's string representation.
+func (t SourceFileTargetType) String() string {
+	return sourceFileTypeStrs[t]
+}
+
 // A ScriptOrder defines when a script should be executed.
 type ScriptOrder int
 
@@ -50,8 +58,19 @@ const (
 	ScriptConditionAlways   ScriptCondition = "always"
 	ScriptConditionOnce     ScriptCondition = "once"
 	ScriptConditionOnChange ScriptCondition = "onchange"
+	ScriptConditionEvery    ScriptCondition = "every"
 )
 
+// DefaultModes are the default permissions of target directories, executable
+// files, and other files. A zero mode means that the permissions are
+// determined by the umask. Attributes like private and readonly further
+// restrict the default modes.
+type DefaultModes struct {
+	Dir        fs.FileMode `json:"dir"        mapstructure:"dir"        yaml:"dir"`
+	Executable fs.FileMode `json:"executable" mapstructure:"executable" yaml:"executable"`
+	File       fs.FileMode `json:"file"       mapstructure:"file"       yaml:"file"`
+}
+
 // DirAttr holds attributes parsed from a source directory name.
 type DirAttr struct {
 	TargetName string
@@ -67,6 +86,7 @@ type FileAttr struct {
 	TargetName string
 	Type       SourceFileTargetType
 	Condition  ScriptCondition
+	Interval   time.Duration
 	Empty      bool
 	Encrypted  bool
 	Executable bool
@@ -157,6 +177,7 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		sourceFileType = SourceFileTypeFile
 		name           = sourceName
 		condition      = ScriptConditionNone
+		interval       time.Duration
 		empty          = false
 		encrypted      = false
 		executable     = false
@@ -187,6 +208,15 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		case strings.HasPrefix(name, onChangePrefix):
 			name = name[len(onChangePrefix):]
 			condition = ScriptConditionOnChange
+		case strings.HasPrefix(name, everyPrefix):
+			condition = ScriptConditionAlways
+			if intervalStr, rest, ok := strings.Cut(name[len(everyPrefix):], "_"); ok {
+				if d, err := parseScriptInterval(intervalStr); err == nil {
+					name = rest
+					condition = ScriptConditionEvery
+					interval = d
+				}
+			}
 		default:
 			condition = ScriptConditionAlways
 		}
@@ -236,6 +266,7 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		TargetName: name,
 		Type:       sourceFileType,
 		Condition:  condition,
+		Interval:   interval,
 		Empty:      empty,
 		Encrypted:  encrypted,
 		Executable: executable,
@@ -252,6 +283,9 @@ func (fa FileAttr) MarshalZerologObject(e *zerolog.Event) {
 	e.Str("TargetName", fa.TargetName)
 	e.Str("Type", sourceFileTypeStrs[fa.Type])
 	e.Str("Condition", string(fa.Condition))
+	if fa.Condition == ScriptConditionEvery {
+		e.Stringer("Interval", fa.Interval)
+	}
 	e.Bool("Empty", fa.Empty)
 	e.Bool("Encrypted", fa.Encrypted)
 	e.Bool("Executable", fa.Executable)
@@ -321,6 +355,8 @@ func (fa FileAttr) SourceName(encryptedSuffix string) string {
 			sourceName += oncePrefix
 		case ScriptConditionOnChange:
 			sourceName += onChangePrefix
+		case ScriptConditionEvery:
+			sourceName += everyPrefix + formatScriptInterval(fa.Interval) + "_"
 		}
 		switch fa.Order {
 		case ScriptOrderBefore:
@@ -336,6 +372,9 @@ func (fa FileAttr) SourceName(encryptedSuffix string) string {
 		sourceName += dotPrefix + fa.TargetName[len("."):]
 	case filePrefixRx.MatchString(fa.TargetName):
 		sourceName += literalPrefix + fa.TargetName
+	case fa.Type == SourceFileTypeScript && strings.HasPrefix(fa.TargetName, everyPrefix):
+		// every_ is only parsed in the names of scripts.
+		sourceName += literalPrefix + fa.TargetName
 	default:
 		sourceName += fa.TargetName
 	}
@@ -365,3 +404,51 @@ func (fa FileAttr) perm() fs.FileMode {
 	}
 	return perm
 }
+
+// parseScriptInterval parses the interval of a run every script. In addition
+// to the units accepted by time.ParseDuration, s can be a whole number of days
+// or weeks, e.g. 1d or 2w. The interval must be positive.
+func parseScriptInterval(s string) (time.Duration, error) {
+	var interval time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"), strings.HasSuffix(s, "w"):
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return 0, err
+		}
+		interval = time.Duration(n) * 24 * time.Hour
+		if strings.HasSuffix(s, "w") {
+			interval *= 7
+		}
+	default:
+		var err error
+		interval, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("%s: interval must be positive", s)
+	}
+	return interval, nil
+}
+
+// formatScriptInterval returns interval formatted so that it can be parsed by
+// parseScriptInterval.
+func formatScriptInterval(interval time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case interval%(7*day) == 0:
+		return strconv.Itoa(int(interval/(7*day))) + "w"
+	case interval%day == 0:
+		return strconv.Itoa(int(interval/day)) + "d"
+	}
+	s := interval.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
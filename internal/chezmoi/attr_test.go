@@ -3,6 +3,7 @@ package chezmoi
 import (
 	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/muesli/combinator"
@@ -254,6 +255,50 @@ func TestFileAttrLiteral(t *testing.T) {
 				Type:       SourceFileTypeScript,
 			},
 		},
+		{
+			sourceName: "run_every_1d_script",
+			fileAttr: FileAttr{
+				TargetName: "script",
+				Condition:  ScriptConditionEvery,
+				Interval:   24 * time.Hour,
+				Type:       SourceFileTypeScript,
+			},
+		},
+		{
+			sourceName: "run_every_90m_after_script",
+			fileAttr: FileAttr{
+				TargetName: "script",
+				Condition:  ScriptConditionEvery,
+				Interval:   90 * time.Minute,
+				Order:      ScriptOrderAfter,
+				Type:       SourceFileTypeScript,
+			},
+			nonCanonical: true,
+		},
+		{
+			sourceName: "run_every_soon_script",
+			fileAttr: FileAttr{
+				TargetName: "every_soon_script",
+				Condition:  ScriptConditionAlways,
+				Type:       SourceFileTypeScript,
+			},
+			nonCanonical: true,
+		},
+		{
+			sourceName: "run_literal_every_1d_script",
+			fileAttr: FileAttr{
+				TargetName: "every_1d_script",
+				Condition:  ScriptConditionAlways,
+				Type:       SourceFileTypeScript,
+			},
+		},
+		{
+			sourceName: "every_1d_file",
+			fileAttr: FileAttr{
+				TargetName: "every_1d_file",
+				Type:       SourceFileTypeFile,
+			},
+		},
 		{
 			sourceName: "file.literal",
 			fileAttr: FileAttr{
@@ -302,6 +347,35 @@ func TestFileAttrLiteral(t *testing.T) {
 	}
 }
 
+func TestScriptInterval(t *testing.T) {
+	for _, tc := range []struct {
+		s           string
+		expected    time.Duration
+		expectedErr bool
+	}{
+		{s: "30s", expected: 30 * time.Second},
+		{s: "1h30m", expected: 90 * time.Minute},
+		{s: "12h", expected: 12 * time.Hour},
+		{s: "1d", expected: 24 * time.Hour},
+		{s: "2w", expected: 14 * 24 * time.Hour},
+		{s: "0s", expectedErr: true},
+		{s: "-1h", expectedErr: true},
+		{s: "d", expectedErr: true},
+		{s: "soon", expectedErr: true},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			actual, err := parseScriptInterval(tc.s)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.s, formatScriptInterval(actual))
+		})
+	}
+}
+
 func TestFileAttrPerm(t *testing.T) {
 	for _, tc := range []struct {
 		fileAttr FileAttr
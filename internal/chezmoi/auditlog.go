@@ -0,0 +1,224 @@
+package chezmoi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v4"
+)
+
+// Audit log operations.
+const (
+	AuditOpChmod        = "chmod"
+	AuditOpChtimes      = "chtimes"
+	AuditOpLink         = "link"
+	AuditOpMkdir        = "mkdir"
+	AuditOpRemove       = "remove"
+	AuditOpRemoveAll    = "removeAll"
+	AuditOpRename       = "rename"
+	AuditOpRunCmd       = "runCmd"
+	AuditOpRunScript    = "runScript"
+	AuditOpWriteFile    = "writeFile"
+	AuditOpWriteSymlink = "writeSymlink"
+)
+
+// An AuditLogEntry is a single entry in the audit log. Each entry contains the
+// hash of the previous entry, and its own hash is computed over all of its
+// other fields, so modifying, inserting, or removing any entry breaks the
+// chain.
+type AuditLogEntry struct {
+	Seq      int64       `json:"seq"`
+	Time     time.Time   `json:"time"`
+	Command  string      `json:"command,omitempty"`
+	Op       string      `json:"op"`
+	Path     string      `json:"path,omitempty"`
+	Target   string      `json:"target,omitempty"`
+	Mode     fs.FileMode `json:"mode,omitempty"`
+	SHA256   HexBytes    `json:"sha256,omitempty"`
+	Args     []string    `json:"args,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	PrevHash HexBytes    `json:"prevHash"`
+	Hash     HexBytes    `json:"hash,omitempty"`
+}
+
+// An AuditLog is an append-only, hash-chained log of mutating operations.
+type AuditLog struct {
+	mutex      sync.Mutex
+	fileSystem vfs.FS
+	absPath    AbsPath
+	command    string
+	loaded     bool
+	seq        int64
+	lastHash   []byte
+}
+
+// An AuditLogVerifyError is an error found when verifying an audit log.
+type AuditLogVerifyError struct {
+	Line int
+	Err  error
+}
+
+func (e *AuditLogVerifyError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *AuditLogVerifyError) Unwrap() error {
+	return e.Err
+}
+
+// auditLogGenesisHash is the previous hash of the first entry in an audit log.
+var auditLogGenesisHash = make([]byte, sha256.Size)
+
+// NewAuditLog returns a new AuditLog that appends entries for command to the
+// file at absPath in fileSystem.
+func NewAuditLog(fileSystem vfs.FS, absPath AbsPath, command string) *AuditLog {
+	return &AuditLog{
+		fileSystem: fileSystem,
+		absPath:    absPath,
+		command:    command,
+	}
+}
+
+// Record appends entry to l, setting its sequence number, time, command, and
+// hashes.
+func (l *AuditLog) Record(entry *AuditLogEntry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.loaded {
+		if err := l.load(); err != nil {
+			return err
+		}
+	}
+
+	l.seq++
+	entry.Seq = l.seq
+	entry.Time = time.Now().UTC()
+	entry.Command = l.command
+	entry.PrevHash = l.lastHash
+	hash, err := entry.hash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	file, err := l.fileSystem.OpenFile(l.absPath.String(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	l.lastHash = hash
+	return nil
+}
+
+// load reads the sequence number and hash of the last entry in l's file, if
+// any.
+func (l *AuditLog) load() error {
+	l.seq = 0
+	l.lastHash = auditLogGenesisHash
+	data, err := l.fileSystem.ReadFile(l.absPath.String())
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		data = bytes.TrimRight(data, "\n")
+		if index := bytes.LastIndexByte(data, '\n'); index != -1 {
+			data = data[index+1:]
+		}
+		if len(data) != 0 {
+			var lastEntry AuditLogEntry
+			if err := json.Unmarshal(data, &lastEntry); err != nil {
+				return fmt.Errorf("%s: %w", l.absPath, err)
+			}
+			l.seq = lastEntry.Seq
+			l.lastHash = lastEntry.Hash
+		}
+	}
+	if err := vfs.MkdirAll(l.fileSystem, l.absPath.Dir().String(), fs.ModePerm); err != nil {
+		return err
+	}
+	l.loaded = true
+	return nil
+}
+
+// hash returns the hash of e, which is computed over all of e's fields except
+// its hash.
+func (e *AuditLogEntry) hash() ([]byte, error) {
+	entry := *e
+	entry.Hash = nil
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// VerifyAuditLog verifies the hash chain of the audit log data. It returns
+// the number of entries and the hash of the last entry.
+func VerifyAuditLog(data []byte) (int, []byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	count := 0
+	prevHash := auditLogGenesisHash
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry AuditLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return count, prevHash, &AuditLogVerifyError{Line: line, Err: err}
+		}
+		if entry.Seq != int64(count+1) {
+			return count, prevHash, &AuditLogVerifyError{
+				Line: line,
+				Err:  fmt.Errorf("expected sequence number %d, got %d", count+1, entry.Seq),
+			}
+		}
+		if !bytes.Equal(entry.PrevHash, prevHash) {
+			return count, prevHash, &AuditLogVerifyError{
+				Line: line,
+				Err:  errors.New("previous hash does not match hash of previous entry"),
+			}
+		}
+		hash, err := entry.hash()
+		if err != nil {
+			return count, prevHash, &AuditLogVerifyError{Line: line, Err: err}
+		}
+		if !bytes.Equal(entry.Hash, hash) {
+			return count, prevHash, &AuditLogVerifyError{
+				Line: line,
+				Err:  errors.New("hash does not match contents"),
+			}
+		}
+		count++
+		prevHash = entry.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return count, prevHash, err
+	}
+	return count, prevHash, nil
+}
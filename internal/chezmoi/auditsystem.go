@@ -0,0 +1,189 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"os/exec"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
+)
+
+// An AuditSystem is a System that records all mutating operations and script
+// runs in an AuditLog. Only hashes of written contents are recorded, never the
+// contents themselves.
+type AuditSystem struct {
+	system   System
+	auditLog *AuditLog
+}
+
+// NewAuditSystem returns a new AuditSystem that wraps system and records
+// mutating operations in auditLog.
+func NewAuditSystem(system System, auditLog *AuditLog) *AuditSystem {
+	return &AuditSystem{
+		system:   system,
+		auditLog: auditLog,
+	}
+}
+
+// Chmod implements System.Chmod.
+func (s *AuditSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	err := s.system.Chmod(name, mode)
+	return s.record(err, &AuditLogEntry{
+		Op:   AuditOpChmod,
+		Path: name.String(),
+		Mode: mode,
+	})
+}
+
+// Chtimes implements System.Chtimes.
+func (s *AuditSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	err := s.system.Chtimes(name, atime, mtime)
+	return s.record(err, &AuditLogEntry{
+		Op:   AuditOpChtimes,
+		Path: name.String(),
+	})
+}
+
+// Glob implements System.Glob.
+func (s *AuditSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *AuditSystem) Link(oldname, newname AbsPath) error {
+	err := s.system.Link(oldname, newname)
+	return s.record(err, &AuditLogEntry{
+		Op:     AuditOpLink,
+		Path:   newname.String(),
+		Target: oldname.String(),
+	})
+}
+
+// Lstat implements System.Lstat.
+func (s *AuditSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *AuditSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	err := s.system.Mkdir(name, perm)
+	return s.record(err, &AuditLogEntry{
+		Op:   AuditOpMkdir,
+		Path: name.String(),
+		Mode: perm,
+	})
+}
+
+// RawPath implements System.RawPath.
+func (s *AuditSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *AuditSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *AuditSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *AuditSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *AuditSystem) Remove(name AbsPath) error {
+	err := s.system.Remove(name)
+	return s.record(err, &AuditLogEntry{
+		Op:   AuditOpRemove,
+		Path: name.String(),
+	})
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *AuditSystem) RemoveAll(name AbsPath) error {
+	err := s.system.RemoveAll(name)
+	return s.record(err, &AuditLogEntry{
+		Op:   AuditOpRemoveAll,
+		Path: name.String(),
+	})
+}
+
+// Rename implements System.Rename.
+func (s *AuditSystem) Rename(oldpath, newpath AbsPath) error {
+	err := s.system.Rename(oldpath, newpath)
+	return s.record(err, &AuditLogEntry{
+		Op:     AuditOpRename,
+		Path:   oldpath.String(),
+		Target: newpath.String(),
+	})
+}
+
+// RunCmd implements System.RunCmd.
+func (s *AuditSystem) RunCmd(cmd *exec.Cmd) error {
+	err := s.system.RunCmd(cmd)
+	return s.record(err, &AuditLogEntry{
+		Op:   AuditOpRunCmd,
+		Path: cmd.Path,
+		Args: cmd.Args,
+	})
+}
+
+// RunScript implements System.RunScript.
+func (s *AuditSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	err := s.system.RunScript(scriptname, dir, data, options)
+	contentsSHA256 := sha256.Sum256(data)
+	return s.record(err, &AuditLogEntry{
+		Op:     AuditOpRunScript,
+		Path:   scriptname.String(),
+		Target: dir.String(),
+		SHA256: contentsSHA256[:],
+	})
+}
+
+// Stat implements System.Stat.
+func (s *AuditSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *AuditSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *AuditSystem) WriteFile(filename AbsPath, data []byte, perm fs.FileMode) error {
+	err := s.system.WriteFile(filename, data, perm)
+	contentsSHA256 := sha256.Sum256(data)
+	return s.record(err, &AuditLogEntry{
+		Op:     AuditOpWriteFile,
+		Path:   filename.String(),
+		Mode:   perm,
+		SHA256: contentsSHA256[:],
+	})
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *AuditSystem) WriteSymlink(oldname string, newname AbsPath) error {
+	err := s.system.WriteSymlink(oldname, newname)
+	return s.record(err, &AuditLogEntry{
+		Op:     AuditOpWriteSymlink,
+		Path:   newname.String(),
+		Target: oldname,
+	})
+}
+
+// record records entry with the result err of the operation in s's audit log
+// and returns err combined with any error from recording the entry.
+func (s *AuditSystem) record(err error, entry *AuditLogEntry) error {
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return chezmoierrors.Combine(err, s.auditLog.Record(entry))
+}
@@ -0,0 +1,48 @@
+package chezmoi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+	"github.com/twpayne/go-vfs/v4/vfst"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ System = &AuditSystem{}
+
+func TestAuditSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": &vfst.Dir{Perm: 0o777},
+	}, func(fileSystem vfs.FS) {
+		auditLogAbsPath := NewAbsPath("/home/user/.local/state/chezmoi/audit.log")
+		system := NewAuditSystem(NewRealSystem(fileSystem), NewAuditLog(fileSystem, auditLogAbsPath, "apply"))
+		assert.NoError(t, system.Mkdir(NewAbsPath("/home/user/.dir"), 0o777))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.dir/file"), []byte("secret"), 0o666))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+
+		// Entries are appended to an existing audit log.
+		system = NewAuditSystem(NewRealSystem(fileSystem), NewAuditLog(fileSystem, auditLogAbsPath, "apply"))
+		assert.NoError(t, system.WriteSymlink(".target", NewAbsPath("/home/user/.symlink")))
+
+		data, err := fileSystem.ReadFile(auditLogAbsPath.String())
+		assert.NoError(t, err)
+		assert.False(t, bytes.Contains(data, []byte("secret")))
+		count, _, err := VerifyAuditLog(data)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, count)
+
+		tamperedData := bytes.Replace(data, []byte(`"op":"mkdir"`), []byte(`"op":"chmod"`), 1)
+		count, _, err = VerifyAuditLog(tamperedData)
+		assert.Error(t, err)
+		assert.Equal(t, 0, count)
+
+		lines := bytes.SplitAfter(data, []byte("\n"))
+		removedData := bytes.Join(append(lines[:1:1], lines[2:]...), nil)
+		count, _, err = VerifyAuditLog(removedData)
+		assert.Error(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
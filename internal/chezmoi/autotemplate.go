@@ -8,19 +8,86 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-// A templateVariable is a template variable. It is used instead of a
-// map[string]string so that we can control order.
-type templateVariable struct {
-	components []string
-	value      string
+// An AutoTemplateSubstitution replaces a value with a template when
+// automatically creating templates.
+type AutoTemplateSubstitution struct {
+	Value      string   // The value to replace.
+	Template   string   // The template to replace Value with.
+	components []string // The components of the template variable, if any.
+}
+
+// An AutoTemplateRule returns the substitutions to make when automatically
+// creating templates with the given template data.
+type AutoTemplateRule func(data map[string]any) []AutoTemplateSubstitution
+
+// AutoTemplateRules are the builtin auto template rules, indexed by name.
+var AutoTemplateRules = map[string]AutoTemplateRule{
+	"data":     autoTemplateDataRule,
+	"email":    autoTemplateVariablesRule([]string{"email"}),
+	"homeDir":  autoTemplateVariablesRule([]string{"chezmoi", "homeDir"}),
+	"hostname": autoTemplateVariablesRule([]string{"chezmoi", "fqdnHostname"}, []string{"chezmoi", "hostname"}),
+	"username": autoTemplateVariablesRule([]string{"chezmoi", "username"}),
 }
 
 var templateMarkerRx = regexp.MustCompile(`\{{2,}|\}{2,}`)
 
+// NewAutoTemplateStringsRule returns a new AutoTemplateRule that replaces each
+// key in templates with its value.
+func NewAutoTemplateStringsRule(templates map[string]string) AutoTemplateRule {
+	return func(map[string]any) []AutoTemplateSubstitution {
+		substitutions := make([]AutoTemplateSubstitution, 0, len(templates))
+		for value, template := range templates {
+			substitutions = append(substitutions, AutoTemplateSubstitution{
+				Value:    value,
+				Template: template,
+			})
+		}
+		return substitutions
+	}
+}
+
+// autoTemplateDataRule replaces the values of all variables in data.
+func autoTemplateDataRule(data map[string]any) []AutoTemplateSubstitution {
+	return extractVariables(data)
+}
+
+// autoTemplateVariablesRule returns an AutoTemplateRule that replaces the
+// values of the variables with the given components.
+func autoTemplateVariablesRule(variablesComponents ...[]string) AutoTemplateRule {
+	return func(data map[string]any) []AutoTemplateSubstitution {
+		var substitutions []AutoTemplateSubstitution
+	COMPONENTS:
+		for _, components := range variablesComponents {
+			var value any = data
+			for _, component := range components {
+				m, ok := value.(map[string]any)
+				if !ok {
+					continue COMPONENTS
+				}
+				value = m[component]
+			}
+			if value, ok := value.(string); ok {
+				substitutions = append(substitutions, newAutoTemplateVariableSubstitution(components, value))
+			}
+		}
+		return substitutions
+	}
+}
+
+// newAutoTemplateVariableSubstitution returns a new AutoTemplateSubstitution
+// that replaces value with the template variable with components.
+func newAutoTemplateVariableSubstitution(components []string, value string) AutoTemplateSubstitution {
+	return AutoTemplateSubstitution{
+		Value:      value,
+		Template:   "{{ ." + strings.Join(components, ".") + " }}",
+		components: components,
+	}
+}
+
 // autoTemplate converts contents into a template by escaping template markers
-// and replacing values in data with their keys. It returns the template and if
-// any replacements were made.
-func autoTemplate(contents []byte, data map[string]any) ([]byte, bool) {
+// and making substitutions. It returns the template and if any replacements
+// were made.
+func autoTemplate(contents []byte, substitutions []AutoTemplateSubstitution) ([]byte, bool) {
 	contentsStr := string(contents)
 	replacements := false
 
@@ -37,12 +104,13 @@ func autoTemplate(contents []byte, data map[string]any) ([]byte, bool) {
 	// length of value, then choose the shallowest first so that .variable is
 	// preferred over .chezmoi.config.data.variable. If there are multiple
 	// matches at the same depth, chose the variable that comes first
-	// alphabetically.
-	variables := extractVariables(data)
+	// alphabetically. Substitutions that are not variables are considered
+	// shallowest, and are ordered by their templates.
+	variables := slices.Clone(substitutions)
 	sort.Slice(variables, func(i, j int) bool {
 		// First sort by value length, longest first.
-		valueI := variables[i].value
-		valueJ := variables[j].value
+		valueI := variables[i].Value
+		valueJ := variables[j].Value
 		switch {
 		case len(valueI) > len(valueJ):
 			return true
@@ -55,7 +123,11 @@ func autoTemplate(contents []byte, data map[string]any) ([]byte, bool) {
 				return true
 			case len(componentsI) == len(componentsJ):
 				// Thirdly, sort by component names in alphabetical order.
-				return slices.Compare(componentsI, componentsJ) < 0
+				if c := slices.Compare(componentsI, componentsJ); c != 0 {
+					return c < 0
+				}
+				// Finally, sort by template.
+				return variables[i].Template < variables[j].Template
 			default:
 				return false
 			}
@@ -70,17 +142,17 @@ func autoTemplate(contents []byte, data map[string]any) ([]byte, bool) {
 	// names match variable values. The algorithm here is probably O(N^2), we
 	// can do better.
 	for _, variable := range variables {
-		if variable.value == "" {
+		if variable.Value == "" {
 			continue
 		}
 
-		index := strings.Index(contentsStr, variable.value)
+		index := strings.Index(contentsStr, variable.Value)
 		for index != -1 && index != len(contentsStr) {
-			if !inWord(contentsStr, index) && !inWord(contentsStr, index+len(variable.value)) {
-				// Replace variable.value which is on word boundaries at both
+			if !inWord(contentsStr, index) && !inWord(contentsStr, index+len(variable.Value)) {
+				// Replace variable.Value which is on word boundaries at both
 				// ends.
-				replacement := "{{ ." + strings.Join(variable.components, ".") + " }}"
-				contentsStr = contentsStr[:index] + replacement + contentsStr[index+len(variable.value):]
+				replacement := variable.Template
+				contentsStr = contentsStr[:index] + replacement + contentsStr[index+len(variable.Value):]
 				index += len(replacement)
 				replacements = true
 			} else {
@@ -89,8 +161,8 @@ func autoTemplate(contents []byte, data map[string]any) ([]byte, bool) {
 				index++
 			}
 
-			// Look for the next occurrence of variable.value.
-			j := strings.Index(contentsStr[index:], variable.value)
+			// Look for the next occurrence of variable.Value.
+			j := strings.Index(contentsStr[index:], variable.Value)
 			if j == -1 {
 				// No more occurrences found, so terminate the loop.
 				break
@@ -103,16 +175,13 @@ func autoTemplate(contents []byte, data map[string]any) ([]byte, bool) {
 	return []byte(contentsStr), replacements
 }
 
-// appendVariables appends all template variables in data to variables
-// and returns variables. data is assumed to be rooted at parent.
-func appendVariables(variables []templateVariable, parent []string, data map[string]any) []templateVariable {
+// appendVariables appends substitutions for all template variables in data to
+// variables and returns variables. data is assumed to be rooted at parent.
+func appendVariables(variables []AutoTemplateSubstitution, parent []string, data map[string]any) []AutoTemplateSubstitution {
 	for name, value := range data {
 		switch value := value.(type) {
 		case string:
-			variable := templateVariable{
-				components: append(slices.Clone(parent), name),
-				value:      value,
-			}
+			variable := newAutoTemplateVariableSubstitution(append(slices.Clone(parent), name), value)
 			variables = append(variables, variable)
 		case map[string]any:
 			variables = appendVariables(variables, append(parent, name), value)
@@ -121,8 +190,9 @@ func appendVariables(variables []templateVariable, parent []string, data map[str
 	return variables
 }
 
-// extractVariables extracts all template variables from data.
-func extractVariables(data map[string]any) []templateVariable {
+// extractVariables extracts substitutions for all template variables from
+// data.
+func extractVariables(data map[string]any) []AutoTemplateSubstitution {
 	return appendVariables(nil, nil, data)
 }
 
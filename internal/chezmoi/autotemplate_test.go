@@ -168,13 +168,88 @@ func TestAutoTemplate(t *testing.T) {
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			actualTemplate, actualReplacements := autoTemplate([]byte(tc.contentsStr), tc.data)
+			actualTemplate, actualReplacements := autoTemplate([]byte(tc.contentsStr), extractVariables(tc.data))
 			assert.Equal(t, tc.expected, string(actualTemplate))
 			assert.Equal(t, tc.expectedReplacements, actualReplacements)
 		})
 	}
 }
 
+func TestAutoTemplateRules(t *testing.T) {
+	data := map[string]any{
+		"chezmoi": map[string]any{
+			"fqdnHostname": "myhost.example.com",
+			"homeDir":      "/home/user",
+			"hostname":     "myhost",
+			"username":     "user",
+		},
+		"email": "user@example.com",
+	}
+	contentsStr := "" +
+		"home = /home/user\n" +
+		"fqdn = myhost.example.com\n" +
+		"host = myhost\n" +
+		"email = user@example.com\n" +
+		"domain = corp.example.com\n"
+	for _, tc := range []struct {
+		name     string
+		rules    []AutoTemplateRule
+		expected string
+	}{
+		{
+			name:     "empty",
+			expected: contentsStr,
+		},
+		{
+			name:  "hostname",
+			rules: []AutoTemplateRule{AutoTemplateRules["hostname"]},
+			expected: "" +
+				"home = /home/user\n" +
+				"fqdn = {{ .chezmoi.fqdnHostname }}\n" +
+				"host = {{ .chezmoi.hostname }}\n" +
+				"email = user@example.com\n" +
+				"domain = corp.example.com\n",
+		},
+		{
+			name: "homedir_and_username",
+			rules: []AutoTemplateRule{
+				AutoTemplateRules["homeDir"],
+				AutoTemplateRules["username"],
+			},
+			expected: "" +
+				"home = {{ .chezmoi.homeDir }}\n" +
+				"fqdn = myhost.example.com\n" +
+				"host = myhost\n" +
+				"email = {{ .chezmoi.username }}@example.com\n" +
+				"domain = corp.example.com\n",
+		},
+		{
+			name: "email_and_strings",
+			rules: []AutoTemplateRule{
+				AutoTemplateRules["email"],
+				NewAutoTemplateStringsRule(map[string]string{
+					"corp.example.com": "{{ .work.domain }}",
+				}),
+			},
+			expected: "" +
+				"home = /home/user\n" +
+				"fqdn = myhost.example.com\n" +
+				"host = myhost\n" +
+				"email = {{ .email }}\n" +
+				"domain = {{ .work.domain }}\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var substitutions []AutoTemplateSubstitution
+			for _, rule := range tc.rules {
+				substitutions = append(substitutions, rule(data)...)
+			}
+			actualTemplate, _ := autoTemplate([]byte(contentsStr), substitutions)
+			assert.Equal(t, tc.expected, string(actualTemplate))
+		})
+	}
+}
+
 func TestInWord(t *testing.T) {
 	for _, tc := range []struct {
 		s        string
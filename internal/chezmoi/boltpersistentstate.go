@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -19,19 +21,58 @@ type BoltPersistentStateMode int
 const (
 	BoltPersistentStateReadOnly BoltPersistentStateMode = iota
 	BoltPersistentStateReadWrite
+
+	// BoltPersistentStateSnapshot opens the database read-only without waiting
+	// for other processes. If another process holds the write lock then a
+	// snapshot of the database is read instead, which does not include any
+	// transaction that is in progress.
+	BoltPersistentStateSnapshot
+)
+
+// Lock retry delays.
+const (
+	boltPersistentStateMinRetryDelay = 10 * time.Millisecond
+	boltPersistentStateMaxRetryDelay = time.Second
 )
 
 // A BoltPersistentState is a state persisted with bolt.
 type BoltPersistentState struct {
-	system  System
-	empty   bool
-	path    AbsPath
-	options bbolt.Options
-	db      *bbolt.DB
+	system       System
+	empty        bool
+	path         AbsPath
+	mode         BoltPersistentStateMode
+	lockTimeout  time.Duration
+	waitFunc     func(pid int)
+	options      bbolt.Options
+	db           *bbolt.DB
+	pidRawPath   string
+	snapshotPath string
+}
+
+// A BoltPersistentStateOption sets an option on a BoltPersistentState.
+type BoltPersistentStateOption func(*BoltPersistentState)
+
+// WithBoltLockTimeout sets how long to wait for another process to release the
+// lock on the database.
+func WithBoltLockTimeout(lockTimeout time.Duration) BoltPersistentStateOption {
+	return func(b *BoltPersistentState) {
+		b.lockTimeout = lockTimeout
+	}
+}
+
+// WithBoltWaitFunc sets a function that is called once if the database is
+// locked by another process, with the PID of that process, or zero if it is
+// not known.
+func WithBoltWaitFunc(waitFunc func(pid int)) BoltPersistentStateOption {
+	return func(b *BoltPersistentState) {
+		b.waitFunc = waitFunc
+	}
 }
 
 // NewBoltPersistentState returns a new BoltPersistentState.
-func NewBoltPersistentState(system System, path AbsPath, mode BoltPersistentStateMode) (*BoltPersistentState, error) {
+func NewBoltPersistentState(
+	system System, path AbsPath, mode BoltPersistentStateMode, options ...BoltPersistentStateOption,
+) (*BoltPersistentState, error) {
 	empty := false
 	switch _, err := system.Stat(path); {
 	case errors.Is(err, fs.ErrNotExist):
@@ -46,34 +87,49 @@ func NewBoltPersistentState(system System, path AbsPath, mode BoltPersistentStat
 		return nil, err
 	}
 
-	options := bbolt.Options{
-		OpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
-			rawPath, err := system.RawPath(NewAbsPath(name))
-			if err != nil {
-				return nil, err
-			}
-			return os.OpenFile(rawPath.String(), flag, perm)
+	b := &BoltPersistentState{
+		system:      system,
+		empty:       empty,
+		path:        path,
+		mode:        mode,
+		lockTimeout: time.Second,
+		options: bbolt.Options{
+			OpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
+				rawPath, err := system.RawPath(NewAbsPath(name))
+				if err != nil {
+					return nil, err
+				}
+				return os.OpenFile(rawPath.String(), flag, perm)
+			},
+			ReadOnly: mode != BoltPersistentStateReadWrite,
+			// Try to take the lock exactly once. open retries with backoff.
+			Timeout: time.Nanosecond,
 		},
-		ReadOnly: mode == BoltPersistentStateReadOnly,
-		Timeout:  time.Second,
 	}
-
-	return &BoltPersistentState{
-		system:  system,
-		empty:   empty,
-		path:    path,
-		options: options,
-	}, nil
+	for _, option := range options {
+		option(b)
+	}
+	return b, nil
 }
 
 // Close closes b.
 func (b *BoltPersistentState) Close() error {
 	if b.db != nil {
+		if b.pidRawPath != "" {
+			_ = os.Remove(b.pidRawPath)
+			b.pidRawPath = ""
+		}
 		if err := b.db.Close(); err != nil {
 			return err
 		}
 		b.db = nil
 	}
+	if b.snapshotPath != "" {
+		if err := os.Remove(b.snapshotPath); err != nil {
+			return err
+		}
+		b.snapshotPath = ""
+	}
 	return nil
 }
 
@@ -114,7 +170,8 @@ func (b *BoltPersistentState) Delete(bucket, key []byte) error {
 	})
 }
 
-// DeleteBucket deletes the bucket.
+// DeleteBucket deletes the bucket. It is not an error if the bucket does not
+// exist.
 func (b *BoltPersistentState) DeleteBucket(bucket []byte) error {
 	if b.empty {
 		return nil
@@ -124,7 +181,10 @@ func (b *BoltPersistentState) DeleteBucket(bucket []byte) error {
 	}
 
 	return b.db.Update(func(tx *bbolt.Tx) error {
-		return tx.DeleteBucket(bucket)
+		if err := tx.DeleteBucket(bucket); err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+			return err
+		}
+		return nil
 	})
 }
 
@@ -217,6 +277,46 @@ func (b *BoltPersistentState) Set(bucket, key, value []byte) error {
 	})
 }
 
+// CompactBoltPersistentState rewrites the bolt database at path without its
+// free pages, which reclaims the space used by deleted entries. The database
+// must not be open.
+func CompactBoltPersistentState(system System, path AbsPath) error {
+	rawPath, err := system.RawPath(path)
+	if err != nil {
+		return err
+	}
+	compactRawPath := rawPath.String() + ".compact"
+
+	src, err := bbolt.Open(rawPath.String(), 0o600, &bbolt.Options{
+		ReadOnly: true,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer src.Close()
+
+	dst, err := bbolt.Open(compactRawPath, 0o600, &bbolt.Options{
+		Timeout: time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("open %s: %w", compactRawPath, err)
+	}
+	if err := bbolt.Compact(dst, src, 0); err != nil {
+		dst.Close()
+		os.Remove(compactRawPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(compactRawPath)
+		return err
+	}
+	if err := src.Close(); err != nil {
+		return err
+	}
+	return os.Rename(compactRawPath, rawPath.String())
+}
+
 // open opens b's database if it is not already open, creating it if needed.
 func (b *BoltPersistentState) open() error {
 	if b.db != nil {
@@ -225,15 +325,142 @@ func (b *BoltPersistentState) open() error {
 	if err := MkdirAll(b.system, b.path.Dir(), fs.ModePerm); err != nil {
 		return err
 	}
+	if b.mode == BoltPersistentStateSnapshot {
+		return b.openSnapshot()
+	}
+
+	delay := boltPersistentStateMinRetryDelay
+	deadline := time.Now().Add(b.lockTimeout)
+	for waited := false; ; waited = true {
+		switch db, err := bbolt.Open(b.path.String(), 0o600, &b.options); {
+		case errors.Is(err, bbolt.ErrTimeout):
+			pid := b.lockHolderPID()
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return &boltPersistentStateLockedError{
+					path: b.path,
+					pid:  pid,
+				}
+			}
+			if !waited && b.waitFunc != nil {
+				b.waitFunc(pid)
+			}
+			if delay > remaining {
+				delay = remaining
+			}
+			time.Sleep(delay)
+			if delay *= 2; delay > boltPersistentStateMaxRetryDelay {
+				delay = boltPersistentStateMaxRetryDelay
+			}
+		case errors.Is(err, syscall.EINVAL):
+			// Assume that any EINVAL error is because flock(2) failed.
+			return fmt.Errorf("open %s: failed to acquire lock: %w", b.path, err)
+		case err != nil:
+			return fmt.Errorf("open %s: %w", b.path, err)
+		default:
+			b.empty = false
+			b.db = db
+			if b.mode == BoltPersistentStateReadWrite {
+				b.writePID()
+			}
+			return nil
+		}
+	}
+}
+
+// openSnapshot opens b's database read-only if no other process holds the
+// write lock, otherwise it opens a copy of b's database.
+func (b *BoltPersistentState) openSnapshot() error {
 	switch db, err := bbolt.Open(b.path.String(), 0o600, &b.options); {
-	case errors.Is(err, syscall.EINVAL):
-		// Assume that any EINVAL error is because flock(2) failed.
-		return fmt.Errorf("open %s: failed to acquire lock: %w", b.path, err)
-	case err != nil:
-		return fmt.Errorf("open %s: %w", b.path, err)
-	default:
-		b.empty = false
+	case err == nil:
 		b.db = db
 		return nil
+	case !errors.Is(err, bbolt.ErrTimeout):
+		return fmt.Errorf("open %s: %w", b.path, err)
+	}
+
+	data, err := b.system.ReadFile(b.path)
+	if err != nil {
+		return err
+	}
+	snapshotFile, err := os.CreateTemp("", "chezmoi-persistent-state-*.boltdb")
+	if err != nil {
+		return err
+	}
+	snapshotPath := snapshotFile.Name()
+	if _, err := snapshotFile.Write(data); err != nil {
+		snapshotFile.Close()
+		os.Remove(snapshotPath)
+		return err
+	}
+	if err := snapshotFile.Close(); err != nil {
+		os.Remove(snapshotPath)
+		return err
+	}
+
+	options := b.options
+	options.OpenFile = nil
+	db, err := bbolt.Open(snapshotPath, 0o600, &options)
+	if err != nil {
+		os.Remove(snapshotPath)
+		return fmt.Errorf("open %s: snapshot: %w", b.path, err)
+	}
+	b.db = db
+	b.snapshotPath = snapshotPath
+	return nil
+}
+
+// pidRawPathFor returns the raw path of the file that records the PID of the
+// process that holds the write lock on b's database.
+func (b *BoltPersistentState) pidRawPathFor() (string, error) {
+	rawPath, err := b.system.RawPath(b.path.Append(".pid"))
+	if err != nil {
+		return "", err
+	}
+	return rawPath.String(), nil
+}
+
+// lockHolderPID returns the PID of the process that holds the write lock on b's
+// database, or zero if it is not known.
+func (b *BoltPersistentState) lockHolderPID() int {
+	pidRawPath, err := b.pidRawPathFor()
+	if err != nil {
+		return 0
+	}
+	data, err := os.ReadFile(pidRawPath)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// writePID records the PID of the current process as the holder of the write
+// lock on b's database. Errors are ignored as the PID is only informational.
+func (b *BoltPersistentState) writePID() {
+	pidRawPath, err := b.pidRawPathFor()
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(pidRawPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600); err != nil {
+		return
+	}
+	b.pidRawPath = pidRawPath
+}
+
+// A boltPersistentStateLockedError is returned when the database is locked by
+// another process.
+type boltPersistentStateLockedError struct {
+	path AbsPath
+	pid  int
+}
+
+func (e *boltPersistentStateLockedError) Error() string {
+	if e.pid == 0 {
+		return fmt.Sprintf("open %s: locked by another process", e.path)
 	}
+	return fmt.Sprintf("open %s: locked by another chezmoi process (PID %d)", e.path, e.pid)
 }
@@ -2,7 +2,9 @@ package chezmoi
 
 import (
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/twpayne/go-vfs/v4"
@@ -129,6 +131,45 @@ func TestBoltPersistentStateMock(t *testing.T) {
 	})
 }
 
+func TestCompactBoltPersistentState(t *testing.T) {
+	chezmoitest.WithTestFS(t, nil, func(fileSystem vfs.FS) {
+		var (
+			system = NewRealSystem(fileSystem)
+			path   = NewAbsPath("/home/user/.config/chezmoi/chezmoistate.boltdb")
+			bucket = []byte("bucket")
+			value  = make([]byte, 1024)
+		)
+
+		b1, err := NewBoltPersistentState(system, path, BoltPersistentStateReadWrite)
+		assert.NoError(t, err)
+		for i := 0; i < 256; i++ {
+			assert.NoError(t, b1.Set(bucket, []byte(strconv.Itoa(i)), value))
+		}
+		for i := 1; i < 256; i++ {
+			assert.NoError(t, b1.Delete(bucket, []byte(strconv.Itoa(i))))
+		}
+		assert.NoError(t, b1.Close())
+		fileInfo, err := system.Stat(path)
+		assert.NoError(t, err)
+		sizeBefore := fileInfo.Size()
+
+		assert.NoError(t, CompactBoltPersistentState(system, path))
+		fileInfo, err = system.Stat(path)
+		assert.NoError(t, err)
+		assert.True(t, fileInfo.Size() < sizeBefore)
+
+		b2, err := NewBoltPersistentState(system, path, BoltPersistentStateReadOnly)
+		assert.NoError(t, err)
+		actualValue, err := b2.Get(bucket, []byte("0"))
+		assert.NoError(t, err)
+		assert.Equal(t, value, actualValue)
+		buckets, err := PersistentStateBuckets(b2)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{string(bucket)}, buckets)
+		assert.NoError(t, b2.Close())
+	})
+}
+
 func TestBoltPersistentStateGeneric(t *testing.T) {
 	system := NewRealSystem(vfs.OSFS)
 	var tempDirs []string
@@ -189,3 +230,57 @@ func TestBoltPersistentStateReadOnly(t *testing.T) {
 		assert.NoError(t, b3.Close())
 	})
 }
+
+func TestBoltPersistentStateLock(t *testing.T) {
+	chezmoitest.WithTestFS(t, nil, func(fileSystem vfs.FS) {
+		var (
+			system = NewRealSystem(fileSystem)
+			path   = NewAbsPath("/home/user/.config/chezmoi/chezmoistate.boltdb")
+			bucket = []byte("bucket")
+			key    = []byte("key")
+			value  = []byte("value")
+		)
+
+		b1, err := NewBoltPersistentState(system, path, BoltPersistentStateReadWrite)
+		assert.NoError(t, err)
+		assert.NoError(t, b1.Set(bucket, key, value))
+
+		var waitPIDs []int
+		b2, err := NewBoltPersistentState(system, path, BoltPersistentStateReadWrite,
+			WithBoltLockTimeout(100*time.Millisecond),
+			WithBoltWaitFunc(func(pid int) {
+				waitPIDs = append(waitPIDs, pid)
+			}),
+		)
+		assert.NoError(t, err)
+		err = b2.Set(bucket, key, value)
+		assert.EqualError(t, err, "open "+path.String()+": locked by another chezmoi process (PID "+strconv.Itoa(os.Getpid())+")")
+		assert.Equal(t, []int{os.Getpid()}, waitPIDs)
+
+		// Test that a snapshot can be read while the lock is held.
+		b3, err := NewBoltPersistentState(system, path, BoltPersistentStateSnapshot)
+		assert.NoError(t, err)
+		actualValue, err := b3.Get(bucket, key)
+		assert.NoError(t, err)
+		assert.Equal(t, value, actualValue)
+		assert.Error(t, b3.Set(bucket, key, value))
+		assert.NoError(t, b3.Close())
+
+		// Test that the lock is acquired once it is released.
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			assert.NoError(t, b1.Close())
+		}()
+		b4, err := NewBoltPersistentState(system, path, BoltPersistentStateReadWrite,
+			WithBoltLockTimeout(10*time.Second),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, b4.Set(bucket, key, value))
+		assert.NoError(t, b4.Close())
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath(path.Append(".pid").String(),
+				vfst.TestDoesNotExist,
+			),
+		)
+	})
+}
@@ -39,6 +39,7 @@ const (
 	dotPrefix        = "dot_"
 	emptyPrefix      = "empty_"
 	encryptedPrefix  = "encrypted_"
+	everyPrefix      = "every_"
 	exactPrefix      = "exact_"
 	executablePrefix = "executable_"
 	externalPrefix   = "external_"
@@ -59,15 +60,27 @@ const (
 const (
 	Prefix = ".chezmoi"
 
+	CIName           = Prefix + "ci.yaml"
+	ExternalLockName = Prefix + "external.lock"
+	MachinesName     = Prefix + "machines.yaml"
+	ModuleName       = Prefix + "module.yaml"
 	RootName         = Prefix + "root"
 	TemplatesDirName = Prefix + "templates"
+	TestsDirName     = Prefix + "tests"
 	VersionName      = Prefix + "version"
+	conditionsName   = Prefix + "conditions"
 	dataName         = Prefix + "data"
+	dataDirName      = Prefix + "data.d"
+	dataSchemaName   = Prefix + "data.schema.json"
+	dataSourcesName  = Prefix + "datasources"
+	dirDataName      = Prefix + "dirdata"
 	externalName     = Prefix + "external"
 	externalsDirName = Prefix + "externals"
 	ignoreName       = Prefix + "ignore"
+	linksName        = Prefix + "links"
 	removeName       = Prefix + "remove"
 	scriptsDirName   = Prefix + "scripts"
+	tagsName         = Prefix + "tags"
 )
 
 var (
@@ -84,11 +97,33 @@ var knownPrefixedFiles = newSet(
 	Prefix+".json"+TemplateSuffix,
 	Prefix+".toml"+TemplateSuffix,
 	Prefix+".yaml"+TemplateSuffix,
+	CIName,
+	ExternalLockName,
+	MachinesName,
+	ModuleName,
 	RootName,
 	VersionName,
+	conditionsName,
 	dataName+".json",
+	dataName+".json"+DefaultAgeSuffix,
+	dataName+".json"+DefaultGPGSuffix,
 	dataName+".toml",
+	dataName+".toml"+DefaultAgeSuffix,
+	dataName+".toml"+DefaultGPGSuffix,
 	dataName+".yaml",
+	dataName+".yaml"+DefaultAgeSuffix,
+	dataName+".yaml"+DefaultGPGSuffix,
+	dataName+ejsonExtension,
+	dataSchemaName,
+	dataSourcesName+".json"+TemplateSuffix,
+	dataSourcesName+".json",
+	dataSourcesName+".toml"+TemplateSuffix,
+	dataSourcesName+".toml",
+	dataSourcesName+".yaml"+TemplateSuffix,
+	dataSourcesName+".yaml",
+	dirDataName+".json",
+	dirDataName+".toml",
+	dirDataName+".yaml",
 	externalName+".json"+TemplateSuffix,
 	externalName+".json",
 	externalName+".toml"+TemplateSuffix,
@@ -97,13 +132,19 @@ var knownPrefixedFiles = newSet(
 	externalName+".yaml",
 	ignoreName+TemplateSuffix,
 	ignoreName,
+	linksName+TemplateSuffix,
+	linksName,
 	removeName+TemplateSuffix,
 	removeName,
+	tagsName+TemplateSuffix,
+	tagsName,
 )
 
 // knownPrefixedDirs is a set of known dirnames with the .chezmoi prefix.
 var knownPrefixedDirs = newSet(
 	TemplatesDirName,
+	TestsDirName,
+	dataDirName,
 	dataName,
 	externalsDirName,
 	scriptsDirName,
@@ -190,6 +231,27 @@ func SHA256Sum(data []byte) []byte {
 	return sha256SumArr[:]
 }
 
+// isTemplateDataName returns true if name is the name of a source state entry
+// that is read while the template data is collected.
+func isTemplateDataName(name string) bool {
+	switch {
+	case name == VersionName || name == TemplatesDirName:
+		return true
+	case name == dataName || name == dataDirName || name == dataSchemaName:
+		return true
+	case isPrefixDotFormat(name, dataName) || isPrefixDotFormat(name, dirDataName):
+		return true
+	case strings.HasPrefix(name, dataName+"."):
+		return true
+	case isPrefixDotFormat(name, dataSourcesName) || isPrefixDotFormatDotTmpl(name, dataSourcesName):
+		return true
+	case strings.HasPrefix(name, Prefix+"."):
+		return true
+	default:
+		return false
+	}
+}
+
 // SuspiciousSourceDirEntry returns true if base is a suspicious dir entry.
 func SuspiciousSourceDirEntry(base string, fileInfo fs.FileInfo, encryptedSuffixes []string) bool {
 	switch fileInfo.Mode().Type() {
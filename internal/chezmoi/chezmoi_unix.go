@@ -3,6 +3,7 @@
 package chezmoi
 
 import (
+	"errors"
 	"io/fs"
 
 	"golang.org/x/sys/unix"
@@ -21,6 +22,12 @@ func findExecutableExtensions(path string) []string {
 	return []string{path}
 }
 
+// isCrossDeviceError returns if err is the error returned when renaming across
+// filesystems.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, unix.EXDEV)
+}
+
 // IsExecutable returns if fileInfo is executable.
 func IsExecutable(fileInfo fs.FileInfo) bool {
 	return fileInfo.Mode().Perm()&0o111 != 0
@@ -1,12 +1,14 @@
 package chezmoi
 
 import (
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"golang.org/x/exp/slices"
+	"golang.org/x/sys/windows"
 )
 
 const nativeLineEnding = "\r\n"
@@ -29,6 +31,12 @@ func findExecutableExtensions(path string) []string {
 	return result
 }
 
+// isCrossDeviceError returns if err is the error returned when renaming across
+// volumes.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
+
 // IsExecutable checks if the file is a regular file and has an extension listed
 // in the PATHEXT environment variable as per
 // https://www.nextofwindows.com/what-is-pathext-environment-variable-in-windows.
@@ -3,6 +3,7 @@ package chezmoi
 import (
 	"io/fs"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -167,6 +168,7 @@ func (s *DebugSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, op
 		Bytes("data", chezmoilog.Output(data, err)).
 		Object("interpreter", options.Interpreter).
 		Str("condition", string(options.Condition)).
+		Strs("env", envKeys(options.Env)).
 		EmbedObject(chezmoilog.OSExecExitErrorLogObject{Err: err}).
 		Msg("RunScript")
 	return err
@@ -207,3 +209,17 @@ func (s *DebugSystem) WriteSymlink(oldname string, newname AbsPath) error {
 		Msg("WriteSymlink")
 	return err
 }
+
+// envKeys returns the keys of env, so that values, which may contain secrets,
+// are not logged.
+func envKeys(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(env))
+	for _, keyValue := range env {
+		key, _, _ := strings.Cut(keyValue, "=")
+		keys = append(keys, key)
+	}
+	return keys
+}
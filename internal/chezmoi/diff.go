@@ -1,6 +1,8 @@
 package chezmoi
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io/fs"
 	"net/http"
 	"strings"
@@ -40,12 +42,33 @@ func (f *gitDiffFile) Hash() plumbing.Hash     { return f.hash }
 func (f *gitDiffFile) Mode() filemode.FileMode { return f.fileMode }
 func (f *gitDiffFile) Path() string            { return f.relPath.String() }
 
+// A BinaryDiff describes the difference between two binary files.
+type BinaryDiff struct {
+	From   *BinaryDiffFile
+	To     *BinaryDiffFile
+	Output []byte
+}
+
+// A BinaryDiffFile describes one side of a BinaryDiff. MediaType is detected
+// from the file's contents.
+type BinaryDiffFile struct {
+	Size      int      `json:"size"`
+	SHA256    HexBytes `json:"sha256"`
+	MediaType string   `json:"mediaType"`
+}
+
+// A BinaryDiffFunc returns a human-readable description of the differences
+// between fromData and toData, the contents of the binary file at path, or
+// nil if there is no such description.
+type BinaryDiffFunc func(path RelPath, binaryDiff *BinaryDiff, fromData, toData []byte) ([]byte, error)
+
 // A gitDiffFilePatch implements the
 // github.com/go-git/go-git/v5/plumbing/format/diff.FilePatch interface.
 type gitDiffFilePatch struct {
-	isBinary bool
-	from, to diff.File
-	chunks   []diff.Chunk
+	isBinary   bool
+	from, to   diff.File
+	chunks     []diff.Chunk
+	binaryDiff *BinaryDiff
 }
 
 func (fp *gitDiffFilePatch) IsBinary() bool                { return fp.isBinary }
@@ -94,22 +117,95 @@ func DiffPatch(path RelPath, fromData []byte, fromMode fs.FileMode, toData []byt
 	}
 
 	var chunks []diff.Chunk
-	if !isBinary {
+	var binaryDiff *BinaryDiff
+	if isBinary {
+		binaryDiff = &BinaryDiff{}
+		if from != nil {
+			binaryDiff.From = newBinaryDiffFile(fromData)
+		}
+		if to != nil {
+			binaryDiff.To = newBinaryDiffFile(toData)
+		}
+	} else {
 		chunks = diffChunks(string(fromData), string(toData))
 	}
 
 	return &gitDiffPatch{
 		filePatches: []diff.FilePatch{
 			&gitDiffFilePatch{
-				isBinary: isBinary,
-				from:     from,
-				to:       to,
-				chunks:   chunks,
+				isBinary:   isBinary,
+				from:       from,
+				to:         to,
+				chunks:     chunks,
+				binaryDiff: binaryDiff,
 			},
 		},
 	}, nil
 }
 
+// AddBinaryDiffOutput sets the output of the binary file patches in patch to
+// the output of binaryDiffFunc, where fromData and toData are the contents
+// that patch was created from.
+func AddBinaryDiffOutput(patch diff.Patch, fromData, toData []byte, binaryDiffFunc BinaryDiffFunc) error {
+	if binaryDiffFunc == nil {
+		return nil
+	}
+	for _, filePatch := range patch.FilePatches() {
+		binaryDiff := filePatchBinaryDiff(filePatch)
+		if binaryDiff == nil {
+			continue
+		}
+		output, err := binaryDiffFunc(NewRelPath(diffFilePatchPath(filePatch)), binaryDiff, fromData, toData)
+		if err != nil {
+			return err
+		}
+		binaryDiff.Output = output
+	}
+	return nil
+}
+
+// MediaType returns the media type of the file described by b. If b has both
+// sides then the media type of the new side is returned.
+func (b *BinaryDiff) MediaType() string {
+	switch {
+	case b.To != nil:
+		return b.To.MediaType
+	case b.From != nil:
+		return b.From.MediaType
+	default:
+		return ""
+	}
+}
+
+// summary returns a human-readable summary of the changes described by b, one
+// line per element.
+func (b *BinaryDiff) summary() []string {
+	describe := func(format func(*BinaryDiffFile) string) string {
+		from, to := "(none)", "(none)"
+		if b.From != nil {
+			from = format(b.From)
+		}
+		if b.To != nil {
+			to = format(b.To)
+		}
+		if from == to {
+			return from
+		}
+		return from + " -> " + to
+	}
+	return []string{
+		"size: " + describe(func(f *BinaryDiffFile) string {
+			return fmt.Sprintf("%d bytes", f.Size)
+		}),
+		"sha256: " + describe(func(f *BinaryDiffFile) string {
+			return f.SHA256.String()[:12]
+		}),
+		"type: " + describe(func(f *BinaryDiffFile) string {
+			return f.MediaType
+		}),
+	}
+}
+
 // diffChunks returns the
 // github.com/go-git/go-git/v5/plumbing/format/diff.Chunks required to transform
 // from into to.
@@ -139,6 +235,25 @@ func diffFileMode(mode fs.FileMode) (filemode.FileMode, error) {
 	return (fileMode &^ filemode.FileMode(fs.ModePerm)) | filemode.FileMode(mode.Perm()), nil
 }
 
+// filePatchBinaryDiff returns the BinaryDiff of filePatch, or nil if
+// filePatch does not have one.
+func filePatchBinaryDiff(filePatch diff.FilePatch) *BinaryDiff {
+	if gitDiffFilePatch, ok := filePatch.(*gitDiffFilePatch); ok {
+		return gitDiffFilePatch.binaryDiff
+	}
+	return nil
+}
+
+// newBinaryDiffFile returns a new BinaryDiffFile describing data.
+func newBinaryDiffFile(data []byte) *BinaryDiffFile {
+	sha256Sum := sha256.Sum256(data)
+	return &BinaryDiffFile{
+		Size:      len(data),
+		SHA256:    sha256Sum[:],
+		MediaType: http.DetectContentType(data),
+	}
+}
+
 // isBinary returns true if data contains binary (non-human-readable) data.
 func isBinary(data []byte) bool {
 	return len(data) != 0 && !strings.HasPrefix(http.DetectContentType(data), "text/")
@@ -0,0 +1,875 @@
+package chezmoi
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// defaultDiffWidth is the width of side-by-side diffs when the width is not
+// known.
+const defaultDiffWidth = 160
+
+// A DiffEncoder encodes a
+// github.com/go-git/go-git/v5/plumbing/format/diff.Patch.
+type DiffEncoder interface {
+	Encode(patch diff.Patch) error
+}
+
+// DiffEncoderOptions are options for NewDiffEncoder.
+type DiffEncoderOptions struct {
+	Color bool
+	Theme *DiffTheme
+	Width int
+}
+
+// NewDiffEncoder returns a new DiffEncoder that writes patches to w in format.
+// Color and Theme control the colors of the unified, side-by-side, and word
+// formats. Theme also controls the colors of the HTML format. Width is the
+// total width of side-by-side diffs.
+func NewDiffEncoder(w io.Writer, format DiffFormat, options *DiffEncoderOptions) DiffEncoder {
+	theme := options.Theme
+	if theme == nil {
+		theme = DiffThemes[DefaultDiffThemeName]
+	}
+	var ansiTheme DiffTheme
+	if options.Color {
+		ansiTheme = *theme
+	}
+	switch format {
+	case DiffFormatSideBySide:
+		width := options.Width
+		if width <= 0 {
+			width = defaultDiffWidth
+		}
+		return &sideBySideDiffEncoder{
+			w:     w,
+			theme: ansiTheme,
+			width: width,
+		}
+	case DiffFormatWord:
+		return &wordDiffEncoder{
+			w:     w,
+			theme: ansiTheme,
+		}
+	case DiffFormatHTML:
+		return &htmlDiffEncoder{
+			w:     w,
+			theme: theme.HTML,
+		}
+	case DiffFormatJSON:
+		return &jsonDiffEncoder{
+			encoder: json.NewEncoder(w),
+		}
+	default:
+		unifiedEncoder := diff.NewUnifiedEncoder(w, diff.DefaultContextLines)
+		if options.Color {
+			unifiedEncoder.SetColor(theme.colorConfig())
+		}
+		return &unifiedDiffEncoder{
+			w:              w,
+			unifiedEncoder: unifiedEncoder,
+		}
+	}
+}
+
+// A DiffJSONFilePatch is the JSON representation of a single file patch. Its
+// fields are stable and may be relied upon by other tools.
+type DiffJSONFilePatch struct {
+	Path         string             `json:"path"`
+	From         *DiffJSONFile      `json:"from"`
+	To           *DiffJSONFile      `json:"to"`
+	Binary       bool               `json:"binary"`
+	BinaryOutput string             `json:"binaryOutput,omitempty"`
+	Metadata     []DiffJSONMetadata `json:"metadata,omitempty"`
+	Hunks        []DiffJSONHunk     `json:"hunks"`
+}
+
+// A DiffJSONMetadata is the JSON representation of a change to a file's
+// metadata, for example its permissions, which may be independent of any
+// change to its contents.
+type DiffJSONMetadata struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// A DiffJSONFile is the JSON representation of one side of a file patch. Size,
+// SHA256, and MediaType are only set for binary files.
+type DiffJSONFile struct {
+	Mode      string   `json:"mode"`
+	Hash      string   `json:"hash"`
+	Size      *int     `json:"size,omitempty"`
+	SHA256    HexBytes `json:"sha256,omitempty"`
+	MediaType string   `json:"mediaType,omitempty"`
+}
+
+// A DiffJSONHunk is the JSON representation of a hunk. Line numbers are
+// counted from one, as in unified diffs.
+type DiffJSONHunk struct {
+	FromLine  int            `json:"fromLine"`
+	FromLines int            `json:"fromLines"`
+	ToLine    int            `json:"toLine"`
+	ToLines   int            `json:"toLines"`
+	Lines     []DiffJSONLine `json:"lines"`
+}
+
+// A DiffJSONLine is the JSON representation of a single line in a hunk. Op is
+// one of equal, delete, or add.
+type DiffJSONLine struct {
+	Op        string `json:"op"`
+	Text      string `json:"text"`
+	NoNewline bool   `json:"noNewline,omitempty"`
+}
+
+// A diffLine is a single line of a diff.
+type diffLine struct {
+	op        diff.Operation
+	text      string
+	fromLine  int
+	toLine    int
+	noNewline bool
+}
+
+// A diffHunk is a group of changed lines and their surrounding context. start
+// and end are the indexes of the hunk's lines in all lines.
+type diffHunk struct {
+	fromLine  int
+	fromLines int
+	toLine    int
+	toLines   int
+	start     int
+	end       int
+	lines     []diffLine
+}
+
+// A diffSegment is part of a line, marked with whether it changed.
+type diffSegment struct {
+	text    string
+	changed bool
+}
+
+// A jsonDiffEncoder writes each file patch as a single line of JSON.
+type jsonDiffEncoder struct {
+	encoder *json.Encoder
+}
+
+// Encode implements DiffEncoder.Encode.
+func (e *jsonDiffEncoder) Encode(patch diff.Patch) error {
+	for _, filePatch := range patch.FilePatches() {
+		from, to := filePatch.Files()
+		jsonFilePatch := DiffJSONFilePatch{
+			Path:     diffFilePatchPath(filePatch),
+			From:     newDiffJSONFile(from),
+			To:       newDiffJSONFile(to),
+			Binary:   filePatch.IsBinary(),
+			Metadata: diffMetadata(from, to),
+			Hunks:    []DiffJSONHunk{},
+		}
+		if binaryDiff := filePatchBinaryDiff(filePatch); binaryDiff != nil {
+			jsonFilePatch.From.setBinaryDiffFile(binaryDiff.From)
+			jsonFilePatch.To.setBinaryDiffFile(binaryDiff.To)
+			jsonFilePatch.BinaryOutput = string(binaryDiff.Output)
+		}
+		for _, hunk := range newDiffHunks(newDiffLines(filePatch.Chunks()), diff.DefaultContextLines) {
+			jsonHunk := DiffJSONHunk{
+				FromLine:  hunk.fromLine,
+				FromLines: hunk.fromLines,
+				ToLine:    hunk.toLine,
+				ToLines:   hunk.toLines,
+				Lines:     make([]DiffJSONLine, 0, len(hunk.lines)),
+			}
+			for _, line := range hunk.lines {
+				jsonHunk.Lines = append(jsonHunk.Lines, DiffJSONLine{
+					Op:        diffOperationName(line.op),
+					Text:      line.text,
+					NoNewline: line.noNewline,
+				})
+			}
+			jsonFilePatch.Hunks = append(jsonFilePatch.Hunks, jsonHunk)
+		}
+		if err := e.encoder.Encode(&jsonFilePatch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A unifiedDiffEncoder writes unified diffs, followed by a summary of the
+// changes to each binary file.
+type unifiedDiffEncoder struct {
+	w              io.Writer
+	unifiedEncoder *diff.UnifiedEncoder
+}
+
+// Encode implements DiffEncoder.Encode.
+func (e *unifiedDiffEncoder) Encode(patch diff.Patch) error {
+	for i, filePatch := range patch.FilePatches() {
+		var message string
+		if i == 0 {
+			message = patch.Message()
+		}
+		if err := e.unifiedEncoder.Encode(&gitDiffPatch{
+			filePatches: []diff.FilePatch{filePatch},
+			message:     message,
+		}); err != nil {
+			return err
+		}
+		if binaryDiff := filePatchBinaryDiff(filePatch); binaryDiff != nil {
+			var builder strings.Builder
+			writeBinaryDiff(&builder, binaryDiff)
+			if _, err := io.WriteString(e.w, builder.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A sideBySideDiffEncoder writes diffs with the old and new lines in
+// adjacent columns.
+type sideBySideDiffEncoder struct {
+	w     io.Writer
+	theme DiffTheme
+	width int
+}
+
+// Encode implements DiffEncoder.Encode.
+func (e *sideBySideDiffEncoder) Encode(patch diff.Patch) error {
+	const lineNumberWidth = 4
+	columnWidth := (e.width - 2*lineNumberWidth - 5) / 2
+	if columnWidth < 8 {
+		columnWidth = 8
+	}
+
+	var builder strings.Builder
+	for _, filePatch := range patch.FilePatches() {
+		hunks := newDiffHunks(newDiffLines(filePatch.Chunks()), diff.DefaultContextLines)
+		writeDiffHeader(&builder, &e.theme, filePatch, len(hunks) != 0)
+		for _, hunk := range hunks {
+			builder.WriteString(paint(e.theme.Frag, hunk.header()))
+			builder.WriteByte('\n')
+			writeRow := func(from, to *diffLine, gutter byte) {
+				var fromLineNumber, toLineNumber int
+				if from != nil {
+					fromLineNumber = from.fromLine
+				}
+				if to != nil {
+					toLineNumber = to.toLine
+				}
+				builder.WriteString(e.cell(from, fromLineNumber, lineNumberWidth, columnWidth, e.theme.Old))
+				builder.WriteByte(' ')
+				builder.WriteByte(gutter)
+				builder.WriteByte(' ')
+				builder.WriteString(strings.TrimRight(e.cell(to, toLineNumber, lineNumberWidth, columnWidth, e.theme.New), " "))
+				builder.WriteByte('\n')
+			}
+			forEachDiffRun(hunk.lines, func(line *diffLine) {
+				writeRow(line, line, ' ')
+			}, func(fromLines, toLines []diffLine) {
+				for i := 0; i < len(fromLines) || i < len(toLines); i++ {
+					switch {
+					case i < len(fromLines) && i < len(toLines):
+						writeRow(&fromLines[i], &toLines[i], '|')
+					case i < len(fromLines):
+						writeRow(&fromLines[i], nil, '<')
+					default:
+						writeRow(nil, &toLines[i], '>')
+					}
+				}
+			})
+		}
+	}
+	_, err := io.WriteString(e.w, builder.String())
+	return err
+}
+
+// cell returns a cell containing lineNumber and line's text, padded or
+// truncated to width, with changed lines painted with ansiColor.
+func (e *sideBySideDiffEncoder) cell(line *diffLine, lineNumber, lineNumberWidth, width int, ansiColor string) string {
+	if line == nil {
+		return strings.Repeat(" ", lineNumberWidth+1+width)
+	}
+	text := expandTabs(line.text)
+	if n := utf8.RuneCountInString(text); n > width {
+		text = string([]rune(text)[:width])
+	} else {
+		text += strings.Repeat(" ", width-n)
+	}
+	if line.op != diff.Equal {
+		text = paint(ansiColor, text)
+	}
+	return fmt.Sprintf("%*d %s", lineNumberWidth, lineNumber, text)
+}
+
+// A wordDiffEncoder writes diffs with changed words marked inline, like git
+// diff --word-diff.
+type wordDiffEncoder struct {
+	w     io.Writer
+	theme DiffTheme
+}
+
+// Encode implements DiffEncoder.Encode.
+func (e *wordDiffEncoder) Encode(patch diff.Patch) error {
+	var builder strings.Builder
+	writeChanged := func(text, prefix, suffix, ansiColor string) {
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				builder.WriteByte('\n')
+			}
+			switch {
+			case part == "":
+			case ansiColor != "":
+				builder.WriteString(paint(ansiColor, part))
+			default:
+				builder.WriteString(prefix + part + suffix)
+			}
+		}
+	}
+	for _, filePatch := range patch.FilePatches() {
+		hunks := newDiffHunks(newDiffLines(filePatch.Chunks()), diff.DefaultContextLines)
+		writeDiffHeader(&builder, &e.theme, filePatch, len(hunks) != 0)
+		for _, hunk := range hunks {
+			builder.WriteString(paint(e.theme.Frag, hunk.header()))
+			builder.WriteByte('\n')
+			forEachDiffRun(hunk.lines, func(line *diffLine) {
+				builder.WriteString(line.text)
+				builder.WriteByte('\n')
+			}, func(fromLines, toLines []diffLine) {
+				for _, d := range diffWords(joinDiffLines(fromLines), joinDiffLines(toLines)) {
+					switch d.Type {
+					case diffmatchpatch.DiffEqual:
+						builder.WriteString(d.Text)
+					case diffmatchpatch.DiffDelete:
+						writeChanged(d.Text, "[-", "-]", e.theme.Old)
+					case diffmatchpatch.DiffInsert:
+						writeChanged(d.Text, "{+", "+}", e.theme.New)
+					}
+				}
+				builder.WriteByte('\n')
+			})
+		}
+	}
+	_, err := io.WriteString(e.w, builder.String())
+	return err
+}
+
+// An htmlDiffEncoder writes diffs as HTML fragments with changed words
+// highlighted.
+type htmlDiffEncoder struct {
+	w          io.Writer
+	theme      DiffHTMLTheme
+	wroteStyle bool
+}
+
+// Encode implements DiffEncoder.Encode.
+func (e *htmlDiffEncoder) Encode(patch diff.Patch) error {
+	var builder strings.Builder
+	if !e.wroteStyle {
+		e.writeStyle(&builder)
+		e.wroteStyle = true
+	}
+	for _, filePatch := range patch.FilePatches() {
+		hunks := newDiffHunks(newDiffLines(filePatch.Chunks()), diff.DefaultContextLines)
+		builder.WriteString("<div class=\"chezmoi-diff\">\n")
+		var header strings.Builder
+		writeDiffHeader(&header, &DiffTheme{}, filePatch, len(hunks) != 0)
+		for _, line := range strings.Split(strings.TrimSuffix(header.String(), "\n"), "\n") {
+			builder.WriteString("<div class=\"meta\">" + html.EscapeString(line) + "</div>\n")
+		}
+		if len(hunks) != 0 {
+			builder.WriteString("<table>\n")
+			for _, hunk := range hunks {
+				builder.WriteString("<tr class=\"frag\"><td colspan=\"3\">" + html.EscapeString(hunk.header()) + "</td></tr>\n")
+				forEachDiffRun(hunk.lines, func(line *diffLine) {
+					e.writeRow(&builder, line, []diffSegment{{text: line.text}})
+				}, func(fromLines, toLines []diffLine) {
+					fromSegments, toSegments := diffWordSegments(fromLines, toLines)
+					for i := range fromLines {
+						e.writeRow(&builder, &fromLines[i], fromSegments[i])
+					}
+					for i := range toLines {
+						e.writeRow(&builder, &toLines[i], toSegments[i])
+					}
+				})
+			}
+			builder.WriteString("</table>\n")
+		}
+		builder.WriteString("</div>\n")
+	}
+	_, err := io.WriteString(e.w, builder.String())
+	return err
+}
+
+// writeRow writes line, consisting of segments, as a table row to builder.
+func (e *htmlDiffEncoder) writeRow(builder *strings.Builder, line *diffLine, segments []diffSegment) {
+	class, sign, tag := "equal", " ", ""
+	switch line.op {
+	case diff.Delete:
+		class, sign, tag = "delete", "-", "del"
+	case diff.Add:
+		class, sign, tag = "add", "+", "ins"
+	}
+	lineNumber := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	builder.WriteString("<tr class=\"" + class + "\">")
+	builder.WriteString("<td class=\"line-number\">" + lineNumber(line.fromLine) + "</td>")
+	builder.WriteString("<td class=\"line-number\">" + lineNumber(line.toLine) + "</td>")
+	builder.WriteString("<td class=\"text\">" + sign)
+	for _, segment := range segments {
+		if segment.changed {
+			builder.WriteString("<" + tag + ">" + html.EscapeString(segment.text) + "</" + tag + ">")
+		} else {
+			builder.WriteString(html.EscapeString(segment.text))
+		}
+	}
+	builder.WriteString("</td></tr>\n")
+}
+
+// writeStyle writes the style sheet for e's theme to builder.
+func (e *htmlDiffEncoder) writeStyle(builder *strings.Builder) {
+	fmt.Fprintf(builder, "<style>\n"+
+		".chezmoi-diff { background: %s; color: %s; font-family: monospace; margin-bottom: 1em; }\n"+
+		".chezmoi-diff .meta { font-weight: bold; }\n"+
+		".chezmoi-diff table { border-collapse: collapse; width: 100%%; }\n"+
+		".chezmoi-diff td { padding: 0 0.5em; vertical-align: top; white-space: pre; }\n"+
+		".chezmoi-diff .frag td, .chezmoi-diff .line-number { color: %s; }\n"+
+		".chezmoi-diff .line-number { text-align: right; user-select: none; }\n"+
+		".chezmoi-diff .delete { background: %s; }\n"+
+		".chezmoi-diff .add { background: %s; }\n"+
+		".chezmoi-diff del { background: %s; text-decoration: none; }\n"+
+		".chezmoi-diff ins { background: %s; text-decoration: none; }\n"+
+		"</style>\n",
+		e.theme.Background, e.theme.Foreground, e.theme.Frag,
+		e.theme.OldBackground, e.theme.NewBackground,
+		e.theme.OldHighlight, e.theme.NewHighlight,
+	)
+}
+
+// header returns h's unified diff header.
+func (h *diffHunk) header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", diffHunkRange(h.fromLine, h.fromLines), diffHunkRange(h.toLine, h.toLines))
+}
+
+// diffFilePatchPath returns the path of filePatch.
+func diffFilePatchPath(filePatch diff.FilePatch) string {
+	from, to := filePatch.Files()
+	if to != nil {
+		return to.Path()
+	}
+	if from != nil {
+		return from.Path()
+	}
+	return ""
+}
+
+// diffHunkRange returns the range of lines starting at line with lines lines
+// in unified diff format.
+func diffHunkRange(line, lines int) string {
+	if lines == 1 {
+		return strconv.Itoa(line)
+	}
+	return strconv.Itoa(line) + "," + strconv.Itoa(lines)
+}
+
+// diffMetadata returns the changes to the metadata from from to to.
+func diffMetadata(from, to diff.File) []DiffJSONMetadata {
+	if from == nil || to == nil || from.Mode() == to.Mode() {
+		return nil
+	}
+	fromType, toType := from.Mode()&^0o7777, to.Mode()&^0o7777
+	if fromType != toType {
+		return []DiffJSONMetadata{
+			{
+				Name: "type",
+				From: diffFileTypeName(fromType),
+				To:   diffFileTypeName(toType),
+			},
+		}
+	}
+	return []DiffJSONMetadata{
+		{
+			Name: "mode",
+			From: fmt.Sprintf("%04o", uint32(from.Mode()&0o7777)),
+			To:   fmt.Sprintf("%04o", uint32(to.Mode()&0o7777)),
+		},
+	}
+}
+
+// diffFileTypeName returns the name of the type of fileMode.
+func diffFileTypeName(fileMode filemode.FileMode) string {
+	switch fileMode {
+	case filemode.Dir:
+		return "dir"
+	case filemode.Symlink:
+		return "symlink"
+	case filemode.Submodule:
+		return "submodule"
+	default:
+		return "file"
+	}
+}
+
+// diffOperationName returns the name of op in the JSON representation.
+func diffOperationName(op diff.Operation) string {
+	switch op {
+	case diff.Delete:
+		return "delete"
+	case diff.Add:
+		return "add"
+	default:
+		return "equal"
+	}
+}
+
+// diffWordSegments returns the segments of fromLines and toLines with the
+// changed words marked. If either fromLines or toLines is empty then the
+// lines are returned as single unchanged segments.
+func diffWordSegments(fromLines, toLines []diffLine) ([][]diffSegment, [][]diffSegment) {
+	if len(fromLines) == 0 || len(toLines) == 0 {
+		return wholeLineSegments(fromLines), wholeLineSegments(toLines)
+	}
+	fromSegments := make([][]diffSegment, 1, len(fromLines))
+	toSegments := make([][]diffSegment, 1, len(toLines))
+	appendSegments := func(segments [][]diffSegment, text string, changed bool) [][]diffSegment {
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				segments = append(segments, nil)
+			}
+			if part != "" {
+				segments[len(segments)-1] = append(segments[len(segments)-1], diffSegment{
+					text:    part,
+					changed: changed,
+				})
+			}
+		}
+		return segments
+	}
+	for _, d := range diffWords(joinDiffLines(fromLines), joinDiffLines(toLines)) {
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			fromSegments = appendSegments(fromSegments, d.Text, false)
+			toSegments = appendSegments(toSegments, d.Text, false)
+		case diffmatchpatch.DiffDelete:
+			fromSegments = appendSegments(fromSegments, d.Text, true)
+		case diffmatchpatch.DiffInsert:
+			toSegments = appendSegments(toSegments, d.Text, true)
+		}
+	}
+	return fromSegments, toSegments
+}
+
+// diffWords returns the word-by-word diff of from and to.
+func diffWords(from, to string) []diffmatchpatch.Diff {
+	runesToWords := make(map[rune]string)
+	wordsToRunes := make(map[string]rune)
+	wordsToRunesFunc := func(s string) []rune {
+		var runes []rune
+		for _, word := range splitWords(s) {
+			r, ok := wordsToRunes[word]
+			if !ok {
+				// Skip the surrogate range, which cannot be represented in
+				// strings.
+				r = rune(len(wordsToRunes))
+				if r >= 0xd800 {
+					r += 0x800
+				}
+				wordsToRunes[word] = r
+				runesToWords[r] = word
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+	fromRunes := wordsToRunesFunc(from)
+	toRunes := wordsToRunesFunc(to)
+
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Second
+	diffs := dmp.DiffMainRunes(fromRunes, toRunes, false)
+	for i := range diffs {
+		var builder strings.Builder
+		for _, r := range diffs[i].Text {
+			builder.WriteString(runesToWords[r])
+		}
+		diffs[i].Text = builder.String()
+	}
+	return diffs
+}
+
+// expandTabs returns s with tabs expanded to spaces with tab stops every eight
+// columns.
+func expandTabs(s string) string {
+	if !strings.ContainsRune(s, '\t') {
+		return s
+	}
+	var builder strings.Builder
+	column := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := 8 - column%8
+			builder.WriteString(strings.Repeat(" ", n))
+			column += n
+			continue
+		}
+		builder.WriteRune(r)
+		column++
+	}
+	return builder.String()
+}
+
+// forEachDiffRun calls equalFunc for each unchanged line in lines and
+// changedFunc for each run of consecutive changed lines, with the deleted and
+// added lines of the run.
+func forEachDiffRun(lines []diffLine, equalFunc func(*diffLine), changedFunc func([]diffLine, []diffLine)) {
+	for i := 0; i < len(lines); {
+		if lines[i].op == diff.Equal {
+			equalFunc(&lines[i])
+			i++
+			continue
+		}
+		var fromLines, toLines []diffLine
+		for ; i < len(lines) && lines[i].op != diff.Equal; i++ {
+			if lines[i].op == diff.Delete {
+				fromLines = append(fromLines, lines[i])
+			} else {
+				toLines = append(toLines, lines[i])
+			}
+		}
+		changedFunc(fromLines, toLines)
+	}
+}
+
+// joinDiffLines returns the text of lines joined by newlines.
+func joinDiffLines(lines []diffLine) string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// newDiffHunks groups lines into hunks with contextLines lines of context.
+func newDiffHunks(lines []diffLine, contextLines int) []diffHunk {
+	var hunks []diffHunk
+	fromLinesBefore, toLinesBefore, counted := 0, 0, 0
+	for i := 0; i < len(lines); {
+		if lines[i].op == diff.Equal {
+			i++
+			continue
+		}
+
+		// Extend the hunk while the next change is close enough that the
+		// context lines would overlap.
+		lastChange := i
+		for j := i + 1; j < len(lines) && j <= lastChange+2*contextLines+1; j++ {
+			if lines[j].op != diff.Equal {
+				lastChange = j
+			}
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := lastChange + contextLines + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		for ; counted < start; counted++ {
+			if lines[counted].op != diff.Add {
+				fromLinesBefore++
+			}
+			if lines[counted].op != diff.Delete {
+				toLinesBefore++
+			}
+		}
+		hunk := diffHunk{
+			start: start,
+			end:   end,
+			lines: lines[start:end],
+		}
+		for _, line := range hunk.lines {
+			if line.op != diff.Add {
+				hunk.fromLines++
+			}
+			if line.op != diff.Delete {
+				hunk.toLines++
+			}
+		}
+		hunk.fromLine = fromLinesBefore
+		if hunk.fromLines != 0 {
+			hunk.fromLine++
+		}
+		hunk.toLine = toLinesBefore
+		if hunk.toLines != 0 {
+			hunk.toLine++
+		}
+		hunks = append(hunks, hunk)
+
+		i = end
+	}
+	return hunks
+}
+
+// newDiffLines returns the lines of chunks, numbered from one.
+func newDiffLines(chunks []diff.Chunk) []diffLine {
+	var lines []diffLine
+	fromLine, toLine := 0, 0
+	for _, chunk := range chunks {
+		content := chunk.Content()
+		for content != "" {
+			line := diffLine{
+				op: chunk.Type(),
+			}
+			if index := strings.IndexByte(content, '\n'); index == -1 {
+				line.text, content, line.noNewline = content, "", true
+			} else {
+				line.text, content = content[:index], content[index+1:]
+			}
+			switch line.op {
+			case diff.Equal:
+				fromLine++
+				toLine++
+				line.fromLine, line.toLine = fromLine, toLine
+			case diff.Delete:
+				fromLine++
+				line.fromLine = fromLine
+			case diff.Add:
+				toLine++
+				line.toLine = toLine
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// newDiffJSONFile returns the JSON representation of file, or nil if file is
+// nil.
+func newDiffJSONFile(file diff.File) *DiffJSONFile {
+	if file == nil {
+		return nil
+	}
+	return &DiffJSONFile{
+		Mode: diffFileModeString(file.Mode()),
+		Hash: file.Hash().String(),
+	}
+}
+
+// diffFileModeString returns mode formatted as in git diff headers.
+func diffFileModeString(mode filemode.FileMode) string {
+	return fmt.Sprintf("%06o", uint32(mode))
+}
+
+// setBinaryDiffFile sets the binary file fields of f from binaryDiffFile.
+func (f *DiffJSONFile) setBinaryDiffFile(binaryDiffFile *BinaryDiffFile) {
+	if f == nil || binaryDiffFile == nil {
+		return
+	}
+	size := binaryDiffFile.Size
+	f.Size = &size
+	f.SHA256 = binaryDiffFile.SHA256
+	f.MediaType = binaryDiffFile.MediaType
+}
+
+// splitWords splits s into words, runs of whitespace, and newlines.
+func splitWords(s string) []string {
+	var words []string
+	for s != "" {
+		r, size := utf8.DecodeRuneInString(s)
+		var n int
+		switch {
+		case r == '\n':
+			n = size
+		case unicode.IsSpace(r):
+			n = strings.IndexFunc(s, func(r rune) bool {
+				return r == '\n' || !unicode.IsSpace(r)
+			})
+		default:
+			n = strings.IndexFunc(s, unicode.IsSpace)
+		}
+		if n == -1 {
+			n = len(s)
+		}
+		words = append(words, s[:n])
+		s = s[n:]
+	}
+	return words
+}
+
+// wholeLineSegments returns each of lines as a single unchanged segment.
+func wholeLineSegments(lines []diffLine) [][]diffSegment {
+	segments := make([][]diffSegment, 0, len(lines))
+	for _, line := range lines {
+		segments = append(segments, []diffSegment{{text: line.text}})
+	}
+	return segments
+}
+
+// writeDiffHeader writes the git diff header of filePatch to builder. The old
+// and new file names are only written if hasHunks is true.
+func writeDiffHeader(builder *strings.Builder, theme *DiffTheme, filePatch diff.FilePatch, hasHunks bool) {
+	from, to := filePatch.Files()
+	path := diffFilePatchPath(filePatch)
+	lines := []string{"diff --git a/" + path + " b/" + path}
+	switch {
+	case from == nil && to != nil:
+		lines = append(lines, "new file mode "+diffFileModeString(to.Mode()))
+	case from != nil && to == nil:
+		lines = append(lines, "deleted file mode "+diffFileModeString(from.Mode()))
+	case from != nil && to != nil && from.Mode() != to.Mode():
+		lines = append(lines,
+			"old mode "+diffFileModeString(from.Mode()),
+			"new mode "+diffFileModeString(to.Mode()),
+		)
+	}
+	fromName, toName := "/dev/null", "/dev/null"
+	if from != nil {
+		fromName = "a/" + path
+	}
+	if to != nil {
+		toName = "b/" + path
+	}
+	switch {
+	case filePatch.IsBinary():
+		lines = append(lines, "Binary files "+fromName+" and "+toName+" differ")
+	case hasHunks:
+		lines = append(lines, "--- "+fromName, "+++ "+toName)
+	}
+	for _, line := range lines {
+		builder.WriteString(paint(theme.Meta, line))
+		builder.WriteByte('\n')
+	}
+	if binaryDiff := filePatchBinaryDiff(filePatch); binaryDiff != nil {
+		writeBinaryDiff(builder, binaryDiff)
+	}
+}
+
+// writeBinaryDiff writes the summary and output of binaryDiff to builder.
+func writeBinaryDiff(builder *strings.Builder, binaryDiff *BinaryDiff) {
+	for _, line := range binaryDiff.summary() {
+		builder.WriteString(line)
+		builder.WriteByte('\n')
+	}
+	if len(binaryDiff.Output) != 0 {
+		builder.Write(binaryDiff.Output)
+		if binaryDiff.Output[len(binaryDiff.Output)-1] != '\n' {
+			builder.WriteByte('\n')
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package chezmoi
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestDiffEncoder(t *testing.T) {
+	for _, tc := range []struct {
+		format   DiffFormat
+		expected string
+	}{
+		{
+			format: DiffFormatSideBySide,
+			expected: chezmoitest.JoinLines(
+				"diff --git a/file b/file",
+				"--- a/file",
+				"+++ b/file",
+				"@@ -1,4 +1,5 @@",
+				"   1 a                  1 a",
+				"   2 b old         |    2 b new",
+				"   3 c                  3 c",
+				"   4 d                  4 d",
+				"                   >    5 e",
+			),
+		},
+		{
+			format: DiffFormatWord,
+			expected: chezmoitest.JoinLines(
+				"diff --git a/file b/file",
+				"--- a/file",
+				"+++ b/file",
+				"@@ -1,4 +1,5 @@",
+				"a",
+				"b [-old-]{+new+}",
+				"c",
+				"d",
+				"{+e+}",
+			),
+		},
+		{
+			format: DiffFormatJSON,
+			expected: chezmoitest.JoinLines(
+				`{"path":"file",` +
+					`"from":{"mode":"100644","hash":"7f8e24b1be296aa3993e58750aec2e9e1107f750"},` +
+					`"to":{"mode":"100644","hash":"915b7a851a62b9758290c351b2c8b2e9f2f926d3"},` +
+					`"binary":false,` +
+					`"hunks":[{"fromLine":1,"fromLines":4,"toLine":1,"toLines":5,"lines":[` +
+					`{"op":"equal","text":"a"},` +
+					`{"op":"delete","text":"b old"},` +
+					`{"op":"add","text":"b new"},` +
+					`{"op":"equal","text":"c"},` +
+					`{"op":"equal","text":"d"},` +
+					`{"op":"add","text":"e"}` +
+					`]}]}`,
+			),
+		},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			patch, err := DiffPatch(
+				NewRelPath("file"),
+				[]byte(chezmoitest.JoinLines("a", "b old", "c", "d")), 0o644,
+				[]byte(chezmoitest.JoinLines("a", "b new", "c", "d", "e")), 0o644,
+			)
+			assert.NoError(t, err)
+			var builder strings.Builder
+			encoder := NewDiffEncoder(&builder, tc.format, &DiffEncoderOptions{
+				Width: 40,
+			})
+			assert.NoError(t, encoder.Encode(patch))
+			assert.Equal(t, tc.expected, builder.String())
+		})
+	}
+}
+
+func TestDiffEncoderHTML(t *testing.T) {
+	patch, err := DiffPatch(
+		NewRelPath("file"),
+		[]byte(chezmoitest.JoinLines("<b> old")), 0o644,
+		[]byte(chezmoitest.JoinLines("<b> new")), 0o644,
+	)
+	assert.NoError(t, err)
+	var builder strings.Builder
+	encoder := NewDiffEncoder(&builder, DiffFormatHTML, &DiffEncoderOptions{
+		Theme: DiffThemes["dark"],
+	})
+	assert.NoError(t, encoder.Encode(patch))
+	assert.Contains(t, builder.String(), "background: #0d1117;")
+	assert.Contains(t, builder.String(), `<td class="text">-&lt;b&gt; <del>old</del></td>`)
+	assert.Contains(t, builder.String(), `<td class="text">+&lt;b&gt; <ins>new</ins></td>`)
+}
+
+func TestNewDiffHunks(t *testing.T) {
+	var from, to []string
+	for i := 0; i < 20; i++ {
+		from = append(from, "line "+strconv.Itoa(i))
+		to = append(to, "line "+strconv.Itoa(i))
+	}
+	to[1] = "changed"
+	to[5] = "changed"
+	to[18] = "changed"
+	lines := newDiffLines(diffChunks(chezmoitest.JoinLines(from...), chezmoitest.JoinLines(to...)))
+	var actual []string
+	for _, hunk := range newDiffHunks(lines, 3) {
+		actual = append(actual, hunk.header())
+	}
+	assert.Equal(t, []string{
+		"@@ -1,9 +1,9 @@",
+		"@@ -16,5 +16,5 @@",
+	}, actual)
+}
+
+func TestDiffEncoderBinary(t *testing.T) {
+	fromData := []byte("GIF89a old\n")
+	toData := []byte("GIF89a new\n")
+	patch, err := DiffPatch(NewRelPath("image.gif"), fromData, 0o644, toData, 0o644)
+	assert.NoError(t, err)
+	assert.NoError(t, AddBinaryDiffOutput(patch, fromData, toData, func(path RelPath, binaryDiff *BinaryDiff, fromData, toData []byte) ([]byte, error) {
+		return []byte(path.String() + " " + binaryDiff.MediaType()), nil
+	}))
+	var builder strings.Builder
+	assert.NoError(t, NewDiffEncoder(&builder, DiffFormatUnified, &DiffEncoderOptions{}).Encode(patch))
+	assert.Equal(t, chezmoitest.JoinLines(
+		"diff --git a/image.gif b/image.gif",
+		"index c76de080a2ce1b819007cfc785e38a42787e9c5f..68f2044cd9ce9ac32748a453477e01ddb0a280f4 100644",
+		"Binary files a/image.gif and b/image.gif differ",
+		"size: 11 bytes",
+		"sha256: 5b309180de95 -> acf25d963652",
+		"type: image/gif",
+		"image.gif image/gif",
+	), builder.String())
+}
+
+func TestDiffEncoderJSONMetadata(t *testing.T) {
+	data := []byte("# contents\n")
+	patch, err := DiffPatch(NewRelPath("file"), data, 0o644, data, 0o600)
+	assert.NoError(t, err)
+	var builder strings.Builder
+	assert.NoError(t, NewDiffEncoder(&builder, DiffFormatJSON, &DiffEncoderOptions{}).Encode(patch))
+	assert.Contains(t, builder.String(), `"metadata":[{"name":"mode","from":"0644","to":"0600"}],"hunks":[]`)
+}
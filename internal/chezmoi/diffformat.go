@@ -0,0 +1,166 @@
+package chezmoi
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/color"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// A DiffFormat is a format for diff output. It implements the
+// github.com/spf13/pflag.Value interface.
+type DiffFormat string
+
+// Diff formats.
+const (
+	DiffFormatUnified    DiffFormat = "unified"
+	DiffFormatSideBySide DiffFormat = "side-by-side"
+	DiffFormatWord       DiffFormat = "word"
+	DiffFormatHTML       DiffFormat = "html"
+	DiffFormatJSON       DiffFormat = "json"
+)
+
+var (
+	DiffFormatStrings = []string{
+		DiffFormatUnified.String(),
+		DiffFormatSideBySide.String(),
+		DiffFormatWord.String(),
+		DiffFormatHTML.String(),
+		DiffFormatJSON.String(),
+	}
+
+	DiffFormatFlagCompletionFunc = FlagCompletionFunc(DiffFormatStrings)
+)
+
+// Set implements github.com/spf13/pflag.Value.Set.
+func (f *DiffFormat) Set(s string) error {
+	if s == "" {
+		*f = DiffFormatUnified
+		return nil
+	}
+	uniqueAbbreviations := UniqueAbbreviations(DiffFormatStrings)
+	diffFormatStr, ok := uniqueAbbreviations[s]
+	if !ok {
+		return fmt.Errorf("%s: unknown diff format", s)
+	}
+	*f = DiffFormat(diffFormatStr)
+	return nil
+}
+
+// String implements github.com/spf13/pflag.Value.String.
+func (f DiffFormat) String() string {
+	return string(f)
+}
+
+// Type implements github.com/spf13/pflag.Value.Type.
+func (f DiffFormat) Type() string {
+	return "unified|side-by-side|word|html|json"
+}
+
+// A DiffTheme is a set of colors for diff output. The ANSI escape sequences
+// are used for terminal output and the CSS colors are used for HTML output.
+type DiffTheme struct {
+	Meta         string
+	Frag         string
+	Old          string
+	New          string
+	OldHighlight string
+	NewHighlight string
+	HTML         DiffHTMLTheme
+}
+
+// A DiffHTMLTheme is a set of CSS colors for HTML diff output.
+type DiffHTMLTheme struct {
+	Background    string
+	Foreground    string
+	Frag          string
+	OldBackground string
+	NewBackground string
+	OldHighlight  string
+	NewHighlight  string
+}
+
+// DefaultDiffThemeName is the name of the default diff theme.
+const DefaultDiffThemeName = "default"
+
+var (
+	diffHTMLThemeLight = DiffHTMLTheme{
+		Background:    "#ffffff",
+		Foreground:    "#24292f",
+		Frag:          "#0550ae",
+		OldBackground: "#ffebe9",
+		NewBackground: "#e6ffec",
+		OldHighlight:  "#ffc1c0",
+		NewHighlight:  "#abf2bc",
+	}
+
+	diffHTMLThemeDark = DiffHTMLTheme{
+		Background:    "#0d1117",
+		Foreground:    "#e6edf3",
+		Frag:          "#79c0ff",
+		OldBackground: "#3c1618",
+		NewBackground: "#12261e",
+		OldHighlight:  "#8e1519",
+		NewHighlight:  "#196c2e",
+	}
+
+	// DiffThemes contains the builtin diff themes, keyed by name.
+	DiffThemes = map[string]*DiffTheme{
+		DefaultDiffThemeName: {
+			Meta:         color.Bold,
+			Frag:         color.Cyan,
+			Old:          color.Red,
+			New:          color.Green,
+			OldHighlight: color.BoldRed,
+			NewHighlight: color.BoldGreen,
+			HTML:         diffHTMLThemeLight,
+		},
+		"dark": {
+			Meta:         color.BoldYellow,
+			Frag:         color.BoldCyan,
+			Old:          "\033[91m",
+			New:          "\033[92m",
+			OldHighlight: "\033[7;91m",
+			NewHighlight: "\033[7;92m",
+			HTML:         diffHTMLThemeDark,
+		},
+		"light": {
+			Meta:         color.Bold,
+			Frag:         "\033[38;5;25m",
+			Old:          "\033[38;5;124m",
+			New:          "\033[38;5;28m",
+			OldHighlight: "\033[38;5;124;48;5;224m",
+			NewHighlight: "\033[38;5;28;48;5;194m",
+			HTML:         diffHTMLThemeLight,
+		},
+	}
+)
+
+// DiffThemeNames returns the sorted names of the builtin diff themes.
+func DiffThemeNames() []string {
+	names := maps.Keys(DiffThemes)
+	slices.Sort(names)
+	return names
+}
+
+// colorConfig returns the
+// github.com/go-git/go-git/v5/plumbing/format/diff.ColorConfig for t.
+func (t *DiffTheme) colorConfig() diff.ColorConfig {
+	return diff.NewColorConfig(
+		diff.WithColor(diff.Meta, t.Meta),
+		diff.WithColor(diff.Frag, t.Frag),
+		diff.WithColor(diff.Old, t.Old),
+		diff.WithColor(diff.New, t.New),
+	)
+}
+
+// paint returns s wrapped in the ANSI escape sequence ansiColor, or s if
+// ansiColor is empty.
+func paint(ansiColor, s string) string {
+	if ansiColor == "" || s == "" {
+		return s
+	}
+	return ansiColor + s + color.Reset
+}
@@ -2,9 +2,15 @@ package chezmoi
 
 import "time"
 
-// A Duration is a time.Duration that implements encoding.TextUnmarshaler.
+// A Duration is a time.Duration that implements encoding.TextMarshaler and
+// encoding.TextUnmarshaler.
 type Duration time.Duration
 
+// MarshalText implements encoding.TextMarshaler.MarshalText.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
 func (d *Duration) UnmarshalText(data []byte) error {
 	timeDuration, err := time.ParseDuration(string(data))
 	if err != nil {
@@ -0,0 +1,30 @@
+package chezmoi
+
+import (
+	"bytes"
+
+	"github.com/Shopify/ejson"
+)
+
+const (
+	// ejsonExtension is the extension of ejson files.
+	ejsonExtension = ".ejson"
+
+	// ejsonPublicKeyKey is the key of the public key in ejson files.
+	ejsonPublicKeyKey = "_public_key"
+)
+
+// decryptEJSON decrypts the ejson data ciphertext using the private key in
+// keyDir or key and returns the decrypted data without the public key.
+func decryptEJSON(ciphertext []byte, keyDir, key string) (map[string]any, error) {
+	plaintext := &bytes.Buffer{}
+	if err := ejson.Decrypt(bytes.NewReader(ciphertext), plaintext, keyDir, key); err != nil {
+		return nil, err
+	}
+	var data map[string]any
+	if err := FormatJSON.Unmarshal(plaintext.Bytes(), &data); err != nil {
+		return nil, err
+	}
+	delete(data, ejsonPublicKeyKey)
+	return data, nil
+}
@@ -0,0 +1,235 @@
+package chezmoi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// PersistentStateKeyBucket is the bucket for recording the encrypted data key
+// of an EncryptedPersistentState.
+var PersistentStateKeyBucket = []byte("persistentStateKey")
+
+var (
+	persistentStateDataKeyKey = []byte("dataKey")
+
+	// encryptedPersistentStateValuePrefix marks values encrypted by an
+	// EncryptedPersistentState. Values without the prefix were written before
+	// encryption was enabled and are returned unchanged.
+	encryptedPersistentStateValuePrefix = []byte("chezmoi:aes256gcm:")
+)
+
+// An EncryptedPersistentState is a PersistentState that encrypts values at
+// rest. Values are encrypted with AES-256-GCM using a random data key, which is
+// itself encrypted with an Encryption and stored in PersistentStateKeyBucket.
+// Keys are not encrypted.
+type EncryptedPersistentState struct {
+	persistentState PersistentState
+	encryption      Encryption
+	aead            cipher.AEAD
+}
+
+// NewEncryptedPersistentState returns a new EncryptedPersistentState that
+// encrypts the values in persistentState with a data key encrypted with
+// encryption.
+func NewEncryptedPersistentState(persistentState PersistentState, encryption Encryption) *EncryptedPersistentState {
+	return &EncryptedPersistentState{
+		persistentState: persistentState,
+		encryption:      encryption,
+	}
+}
+
+// Close implements PersistentState.Close.
+func (s *EncryptedPersistentState) Close() error {
+	return s.persistentState.Close()
+}
+
+// CopyTo implements PersistentState.CopyTo. Values are decrypted before they
+// are copied and the data key is not copied.
+func (s *EncryptedPersistentState) CopyTo(p PersistentState) error {
+	mockPersistentState := NewMockPersistentState()
+	if err := s.persistentState.CopyTo(mockPersistentState); err != nil {
+		return err
+	}
+	for bucket, bucketMap := range mockPersistentState.buckets {
+		if bucket == string(PersistentStateKeyBucket) {
+			continue
+		}
+		for key, value := range bucketMap {
+			plaintext, err := s.decrypt([]byte(bucket), []byte(key), value)
+			if err != nil {
+				return err
+			}
+			if err := p.Set([]byte(bucket), []byte(key), plaintext); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Data implements PersistentState.Data. It returns the same structure as the
+// underlying PersistentState, with the values decrypted and without the data
+// key.
+func (s *EncryptedPersistentState) Data() (any, error) {
+	data, err := s.persistentState.Data()
+	if err != nil {
+		return nil, err
+	}
+	switch data := data.(type) {
+	case nil:
+		return nil, nil
+	case map[string]map[string]string:
+		return decryptPersistentStateData(s, data)
+	case map[string]map[string][]byte:
+		return decryptPersistentStateData(s, data)
+	default:
+		return nil, fmt.Errorf("%T: unsupported persistent state data", data)
+	}
+}
+
+// Delete implements PersistentState.Delete.
+func (s *EncryptedPersistentState) Delete(bucket, key []byte) error {
+	return s.persistentState.Delete(bucket, key)
+}
+
+// DeleteBucket implements PersistentState.DeleteBucket.
+func (s *EncryptedPersistentState) DeleteBucket(bucket []byte) error {
+	return s.persistentState.DeleteBucket(bucket)
+}
+
+// ForEach implements PersistentState.ForEach.
+func (s *EncryptedPersistentState) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	return s.persistentState.ForEach(bucket, func(k, v []byte) error {
+		plaintext, err := s.decrypt(bucket, k, v)
+		if err != nil {
+			return err
+		}
+		return fn(k, plaintext)
+	})
+}
+
+// Get implements PersistentState.Get.
+func (s *EncryptedPersistentState) Get(bucket, key []byte) ([]byte, error) {
+	value, err := s.persistentState.Get(bucket, key)
+	if err != nil || value == nil {
+		return value, err
+	}
+	return s.decrypt(bucket, key, value)
+}
+
+// Set implements PersistentState.Set.
+func (s *EncryptedPersistentState) Set(bucket, key, value []byte) error {
+	if err := s.init(true); err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ciphertext := make([]byte, 0, len(encryptedPersistentStateValuePrefix)+len(nonce)+len(value)+s.aead.Overhead())
+	ciphertext = append(ciphertext, encryptedPersistentStateValuePrefix...)
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = s.aead.Seal(ciphertext, nonce, value, encryptedPersistentStateAdditionalData(bucket, key))
+	return s.persistentState.Set(bucket, key, ciphertext)
+}
+
+// decrypt returns the plaintext of value, which is associated with key in
+// bucket.
+func (s *EncryptedPersistentState) decrypt(bucket, key, value []byte) ([]byte, error) {
+	if bytes.Equal(bucket, PersistentStateKeyBucket) || !bytes.HasPrefix(value, encryptedPersistentStateValuePrefix) {
+		return value, nil
+	}
+	if err := s.init(false); err != nil {
+		return nil, err
+	}
+	value = value[len(encryptedPersistentStateValuePrefix):]
+	nonceSize := s.aead.NonceSize()
+	if len(value) < nonceSize {
+		return nil, fmt.Errorf("%s: %s: encrypted value too short", bucket, key)
+	}
+	additionalData := encryptedPersistentStateAdditionalData(bucket, key)
+	plaintext, err := s.aead.Open(nil, value[:nonceSize], value[nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", bucket, key, err)
+	}
+	return plaintext, nil
+}
+
+// init initializes s's cipher by decrypting the data key. If there is no data
+// key and create is true then a new data key is created.
+func (s *EncryptedPersistentState) init(create bool) error {
+	if s.aead != nil {
+		return nil
+	}
+
+	var dataKey []byte
+	switch encryptedDataKey, err := s.persistentState.Get(PersistentStateKeyBucket, persistentStateDataKeyKey); {
+	case err != nil:
+		return err
+	case encryptedDataKey != nil:
+		if dataKey, err = s.encryption.Decrypt(encryptedDataKey); err != nil {
+			return fmt.Errorf("decrypt persistent state key: %w", err)
+		}
+	case create:
+		dataKey = make([]byte, 32)
+		if _, err := rand.Read(dataKey); err != nil {
+			return err
+		}
+		encryptedDataKey, err := s.encryption.Encrypt(dataKey)
+		if err != nil {
+			return fmt.Errorf("encrypt persistent state key: %w", err)
+		}
+		if err := s.persistentState.Set(PersistentStateKeyBucket, persistentStateDataKeyKey, encryptedDataKey); err != nil {
+			return err
+		}
+	default:
+		return errors.New("persistent state key not found")
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return fmt.Errorf("persistent state key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	s.aead = aead
+	return nil
+}
+
+// decryptPersistentStateData returns a copy of data, as returned by
+// PersistentState.Data, with the values decrypted by s and without the data key.
+func decryptPersistentStateData[T string | []byte](s *EncryptedPersistentState, data map[string]map[string]T) (map[string]map[string]T, error) {
+	result := make(map[string]map[string]T, len(data))
+	for bucket, bucketData := range data {
+		if bucket == string(PersistentStateKeyBucket) {
+			continue
+		}
+		resultBucketData := make(map[string]T, len(bucketData))
+		for key, value := range bucketData {
+			plaintext, err := s.decrypt([]byte(bucket), []byte(key), []byte(value))
+			if err != nil {
+				return nil, err
+			}
+			resultBucketData[key] = T(plaintext)
+		}
+		result[bucket] = resultBucketData
+	}
+	return result, nil
+}
+
+// encryptedPersistentStateAdditionalData returns the additional data for the
+// value associated with key in bucket, so that encrypted values cannot be moved
+// to other keys.
+func encryptedPersistentStateAdditionalData(bucket, key []byte) []byte {
+	data := make([]byte, 0, len(bucket)+1+len(key))
+	data = append(data, bucket...)
+	data = append(data, 0)
+	data = append(data, key...)
+	return data
+}
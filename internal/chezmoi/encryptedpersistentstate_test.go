@@ -0,0 +1,117 @@
+package chezmoi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ PersistentState = &EncryptedPersistentState{}
+
+func TestEncryptedPersistentState(t *testing.T) {
+	testPersistentState(t, func() PersistentState {
+		return NewEncryptedPersistentState(NewMockPersistentState(), &xorEncryption{
+			key: 0x55,
+		})
+	})
+}
+
+func TestEncryptedPersistentStateAtRest(t *testing.T) {
+	var (
+		bucket = []byte("bucket")
+		key    = []byte("key")
+		value  = []byte("secret")
+	)
+
+	mockPersistentState := NewMockPersistentState()
+	assert.NoError(t, mockPersistentState.Set(bucket, []byte("plaintext"), value))
+	s := NewEncryptedPersistentState(mockPersistentState, &xorEncryption{
+		key: 0x55,
+	})
+
+	// Test that values written before encryption was enabled can be read.
+	actualValue, err := s.Get(bucket, []byte("plaintext"))
+	assert.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+
+	// Test that values are not stored in plaintext.
+	assert.NoError(t, s.Set(bucket, key, value))
+	rawValue, err := mockPersistentState.Get(bucket, key)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(rawValue, value))
+
+	// Test that a new EncryptedPersistentState on the same state can decrypt
+	// the values.
+	s2 := NewEncryptedPersistentState(mockPersistentState, &xorEncryption{
+		key: 0x55,
+	})
+	actualValue, err = s2.Get(bucket, key)
+	assert.NoError(t, err)
+	assert.Equal(t, value, actualValue)
+
+	// Test that encrypted values cannot be moved to other keys.
+	assert.NoError(t, mockPersistentState.Set(bucket, []byte("moved"), rawValue))
+	_, err = s2.Get(bucket, []byte("moved"))
+	assert.Error(t, err)
+
+	// Test that the data key is not copied.
+	copyPersistentState := NewMockPersistentState()
+	assert.NoError(t, s2.Delete(bucket, []byte("moved")))
+	assert.NoError(t, s2.CopyTo(copyPersistentState))
+	buckets, err := PersistentStateBuckets(copyPersistentState)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(bucket)}, buckets)
+}
+
+func TestEncryptedPersistentStateData(t *testing.T) {
+	var (
+		bucket = []byte("bucket")
+		key    = []byte("key")
+		value  = []byte("value")
+	)
+
+	chezmoitest.WithTestFS(t, nil, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		newBoltPersistentState := func(path string) *BoltPersistentState {
+			boltPersistentState, err := NewBoltPersistentState(system, NewAbsPath(path), BoltPersistentStateReadWrite)
+			assert.NoError(t, err)
+			t.Cleanup(func() {
+				assert.NoError(t, boltPersistentState.Close())
+			})
+			return boltPersistentState
+		}
+
+		// Test that the data of an encrypted state has the same structure as
+		// the data of an unencrypted state.
+		plainPersistentState := newBoltPersistentState("/home/user/plain.boltdb")
+		assert.NoError(t, plainPersistentState.Set(bucket, key, value))
+		expectedData, err := plainPersistentState.Data()
+		assert.NoError(t, err)
+
+		s := NewEncryptedPersistentState(newBoltPersistentState("/home/user/encrypted.boltdb"), &xorEncryption{
+			key: 0x55,
+		})
+		assert.NoError(t, s.Set(bucket, key, value))
+		actualData, err := s.Data()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedData, actualData)
+	})
+
+	// Test that the structure of the underlying state's data is preserved.
+	mockPersistentState := NewMockPersistentState()
+	s := NewEncryptedPersistentState(mockPersistentState, &xorEncryption{
+		key: 0x55,
+	})
+	assert.NoError(t, s.Set(bucket, key, value))
+	actualData, err := s.Data()
+	assert.NoError(t, err)
+	assert.Equal(t, any(map[string]map[string][]byte{
+		string(bucket): {
+			string(key): value,
+		},
+	}), actualData)
+}
@@ -1,5 +1,11 @@
 package chezmoi
 
+// Default suffixes for encrypted files.
+const (
+	DefaultAgeSuffix = ".age"
+	DefaultGPGSuffix = ".asc"
+)
+
 // An Encryption encrypts and decrypts files and data.
 type Encryption interface {
 	Decrypt(ciphertext []byte) ([]byte, error)
@@ -16,6 +16,20 @@ func (e ExitCodeError) Error() string {
 	return fmt.Sprintf("exit status %d", int(e))
 }
 
+// An AbortError indicates that applying changes should stop, even if chezmoi
+// was asked to keep going after errors.
+type AbortError struct {
+	Err error
+}
+
+func (e *AbortError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
 // A TooOldError is returned when the source state requires a newer version of
 // chezmoi.
 type TooOldError struct {
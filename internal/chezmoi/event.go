@@ -0,0 +1,130 @@
+package chezmoi
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// An EventType is the type of an Event.
+type EventType string
+
+// Event types.
+const (
+	EventTypeEntryApplied     EventType = "entryApplied"
+	EventTypeEntryFailed      EventType = "entryFailed"
+	EventTypeScriptStarted    EventType = "scriptStarted"
+	EventTypeScriptFinished   EventType = "scriptFinished"
+	EventTypeDownloadStarted  EventType = "downloadStarted"
+	EventTypeDownloadProgress EventType = "downloadProgress"
+	EventTypeDownloadFinished EventType = "downloadFinished"
+	EventTypeSecretFetched    EventType = "secretFetched"
+)
+
+// eventDownloadProgressInterval is the minimum interval between download
+// progress events for a single download.
+const eventDownloadProgressInterval = 100 * time.Millisecond
+
+// An Event is something that happened while chezmoi was running that might be
+// of interest to the user. Events never contain secret values.
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Target     string    `json:"target,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Bytes      int64     `json:"bytes,omitempty"`
+	TotalBytes int64     `json:"totalBytes,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	ExitCode   int       `json:"exitCode,omitempty"`
+	Duration   Duration  `json:"duration,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// An EventHandler handles events.
+type EventHandler interface {
+	HandleEvent(event *Event)
+}
+
+// An EventHandlerFunc is a function that implements EventHandler.
+type EventHandlerFunc func(event *Event)
+
+// HandleEvent implements EventHandler.HandleEvent.
+func (f EventHandlerFunc) HandleEvent(event *Event) {
+	f(event)
+}
+
+// An EventBus delivers events to subscribed handlers. A nil *EventBus is valid
+// and discards all events.
+type EventBus struct {
+	mutex    sync.Mutex
+	handlers []EventHandler
+}
+
+// NewEventBus returns a new EventBus with no handlers.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Emit delivers event to all of b's handlers in the order in which they
+// subscribed. If event's time is not set then it is set to the current time.
+func (b *EventBus) Emit(event *Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, handler := range b.handlers {
+		handler.HandleEvent(event)
+	}
+}
+
+// Enabled returns whether b has any handlers.
+func (b *EventBus) Enabled() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.handlers) != 0
+}
+
+// Subscribe adds handler to b's handlers.
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// A downloadProgressReader is an io.Reader that emits download progress
+// events.
+type downloadProgressReader struct {
+	r          io.Reader
+	eventBus   *EventBus
+	target     string
+	url        string
+	bytes      int64
+	totalBytes int64
+	lastEmit   time.Time
+}
+
+// Read implements io.Reader.Read.
+func (r *downloadProgressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.bytes += int64(n)
+	if now := time.Now(); err != nil || now.Sub(r.lastEmit) >= eventDownloadProgressInterval {
+		r.lastEmit = now
+		r.eventBus.Emit(&Event{
+			Type:       EventTypeDownloadProgress,
+			Time:       now,
+			Target:     r.target,
+			URL:        r.url,
+			Bytes:      r.bytes,
+			TotalBytes: r.totalBytes,
+		})
+	}
+	return n, err
+}
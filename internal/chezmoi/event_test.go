@@ -0,0 +1,35 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestEventBus(t *testing.T) {
+	var nilEventBus *EventBus
+	assert.False(t, nilEventBus.Enabled())
+	nilEventBus.Emit(&Event{
+		Type: EventTypeEntryApplied,
+	})
+
+	eventBus := NewEventBus()
+	assert.False(t, eventBus.Enabled())
+
+	var actualTypes []EventType
+	eventBus.Subscribe(EventHandlerFunc(func(event *Event) {
+		assert.False(t, event.Time.IsZero())
+		actualTypes = append(actualTypes, event.Type)
+	}))
+	assert.True(t, eventBus.Enabled())
+
+	eventBus.Emit(&Event{
+		Type:   EventTypeEntryApplied,
+		Target: ".file",
+	})
+	eventBus.Emit(&Event{
+		Type: EventTypeSecretFetched,
+		Name: "pass",
+	})
+	assert.Equal(t, []EventType{EventTypeEntryApplied, EventTypeSecretFetched}, actualTypes)
+}
@@ -26,6 +26,7 @@ type ExternalDiffSystem struct {
 	filter         *EntryTypeFilter
 	reverse        bool
 	scriptContents bool
+	preRunFunc     func() error
 }
 
 // ExternalDiffSystemOptions are options for NewExternalDiffSystem.
@@ -33,6 +34,7 @@ type ExternalDiffSystemOptions struct {
 	Filter         *EntryTypeFilter
 	Reverse        bool
 	ScriptContents bool
+	PreRunFunc     func() error
 }
 
 // NewExternalDiffSystem creates a new ExternalDiffSystem.
@@ -51,6 +53,7 @@ func NewExternalDiffSystem(
 		filter:         options.Filter,
 		reverse:        options.Reverse,
 		scriptContents: options.ScriptContents,
+		preRunFunc:     options.PreRunFunc,
 	}
 }
 
@@ -324,6 +327,12 @@ func (s *ExternalDiffSystem) runDiffCommand(destAbsPath, targetAbsPath AbsPath)
 		args = append(args, templateData.Destination, templateData.Target)
 	}
 
+	if s.preRunFunc != nil {
+		if err := s.preRunFunc(); err != nil {
+			return err
+		}
+	}
+
 	cmd := exec.Command(s.command, args...) //nolint:gosec
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -0,0 +1,263 @@
+package chezmoi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+// maxExternalRetryDelay is the maximum delay between attempts to download an
+// external.
+const maxExternalRetryDelay = time.Minute
+
+// ExternalDownloadOptions are options for downloading externals.
+type ExternalDownloadOptions struct {
+	Retries        int
+	RetryDelay     time.Duration
+	BandwidthLimit int
+}
+
+// An externalStatusError is an error for an unexpected HTTP status.
+type externalStatusError struct {
+	externalRelPath RelPath
+	url             string
+	status          string
+	statusCode      int
+}
+
+func (e *externalStatusError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.externalRelPath, e.url, e.status)
+}
+
+// retryable returns whether the request might succeed if retried.
+func (e *externalStatusError) retryable() bool {
+	switch {
+	case e.statusCode == http.StatusRequestTimeout:
+		return true
+	case e.statusCode == http.StatusTooManyRequests:
+		return true
+	case e.statusCode >= http.StatusInternalServerError:
+		return true
+	default:
+		return false
+	}
+}
+
+// A rateLimitedReader is an io.Reader that reads at most limit bytes per
+// second from r.
+type rateLimitedReader struct {
+	r     io.Reader
+	limit int
+	start time.Time
+	n     int
+}
+
+func newRateLimitedReader(r io.Reader, limit int) *rateLimitedReader {
+	return &rateLimitedReader{
+		r:     r,
+		limit: limit,
+		start: time.Now(),
+	}
+}
+
+// Read implements io.Reader.Read.
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.limit {
+		p = p[:r.limit]
+	}
+	n, err := r.r.Read(p)
+	r.n += n
+	expected := time.Duration(float64(r.n) / float64(r.limit) * float64(time.Second))
+	if delay := expected - time.Since(r.start); delay > 0 {
+		time.Sleep(delay)
+	}
+	return n, err
+}
+
+// A recordingReadCloser is an io.ReadCloser that records all the data read
+// from it, so that interrupted downloads can be resumed.
+type recordingReadCloser struct {
+	io.Reader
+	io.Closer
+	buffer *bytes.Buffer
+}
+
+// Read implements io.Reader.Read.
+func (r *recordingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.buffer.Write(p[:n])
+	return n, err
+}
+
+// downloadExternal downloads the data for external at externalRelPath,
+// retrying with exponential backoff on transient errors and resuming
+// interrupted downloads if the server supports range requests.
+func (s *SourceState) downloadExternal(
+	ctx context.Context,
+	externalRelPath RelPath,
+	external *External,
+	options *ReadOptions,
+) ([]byte, error) {
+	var data []byte
+	var validator string
+	retryDelay := s.externalDownloadOptions.RetryDelay
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		var err error
+		data, validator, retryable, err = s.downloadExternalAttempt(ctx, externalRelPath, external, options, data, validator)
+		switch {
+		case err == nil:
+			return data, nil
+		case !retryable || attempt >= s.externalDownloadOptions.Retries:
+			return nil, err
+		}
+
+		s.logger.Warn().
+			Err(err).
+			Int("attempt", attempt+1).
+			Int("received", len(data)).
+			Stringer("retryDelay", retryDelay).
+			Stringer("externalRelPath", externalRelPath).
+			Msg("retrying external download")
+		timer := time.NewTimer(retryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		retryDelay *= 2
+		if retryDelay > maxExternalRetryDelay {
+			retryDelay = maxExternalRetryDelay
+		}
+	}
+}
+
+// downloadExternalAttempt makes a single attempt to download the data for
+// external. If data is not empty then it requests only the remaining data
+// with a range request conditional on validator. It returns the data received
+// so far, the validator of the response, and whether any error is retryable.
+func (s *SourceState) downloadExternalAttempt(
+	ctx context.Context,
+	externalRelPath RelPath,
+	external *External,
+	options *ReadOptions,
+	data []byte,
+	validator string,
+) ([]byte, string, bool, error) {
+	req, err := newExternalRequest(ctx, external)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(data) != 0 && validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(data)))
+		req.Header.Set("If-Range", validator)
+	} else {
+		data = nil
+	}
+
+	resp, err := chezmoilog.LogHTTPRequest(s.logger, s.httpClient, req)
+	if err != nil {
+		return data, validator, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && len(data) != 0:
+		// Append the remaining data to the data already received.
+	case http.StatusOK <= resp.StatusCode && resp.StatusCode < http.StatusMultipleChoices:
+		// The server sent the complete data, so discard any data already
+		// received.
+		data = nil
+		validator = resp.Header.Get("ETag")
+		if validator == "" {
+			validator = resp.Header.Get("Last-Modified")
+		}
+	default:
+		statusErr := &externalStatusError{
+			externalRelPath: externalRelPath,
+			url:             chezmoilog.RedactURL(req.URL),
+			status:          resp.Status,
+			statusCode:      resp.StatusCode,
+		}
+		return data, validator, statusErr.retryable(), statusErr
+	}
+
+	var body io.Reader = resp.Body
+	if s.externalDownloadOptions.BandwidthLimit > 0 {
+		body = newRateLimitedReader(body, s.externalDownloadOptions.BandwidthLimit)
+	}
+	if s.eventBus.Enabled() {
+		redactedURL := chezmoilog.RedactURL(req.URL)
+		var totalBytes int64
+		if resp.ContentLength >= 0 {
+			totalBytes = int64(len(data)) + resp.ContentLength
+		}
+		s.eventBus.Emit(&Event{
+			Type:       EventTypeDownloadStarted,
+			Target:     externalRelPath.String(),
+			URL:        redactedURL,
+			Bytes:      int64(len(data)),
+			TotalBytes: totalBytes,
+		})
+		body = &downloadProgressReader{
+			r:          body,
+			eventBus:   s.eventBus,
+			target:     externalRelPath.String(),
+			url:        redactedURL,
+			bytes:      int64(len(data)),
+			totalBytes: totalBytes,
+			lastEmit:   time.Now(),
+		}
+	}
+	received := &bytes.Buffer{}
+	resp.Body = &recordingReadCloser{
+		Reader: body,
+		Closer: resp.Body,
+		buffer: received,
+	}
+	if options == nil || options.ReadHTTPResponse == nil {
+		_, err = io.ReadAll(resp.Body)
+	} else {
+		_, err = options.ReadHTTPResponse(resp)
+	}
+	data = append(data, received.Bytes()...)
+	if err != nil {
+		return data, validator, ctx.Err() == nil, fmt.Errorf("%s: %s: %w", externalRelPath, chezmoilog.RedactURL(req.URL), err)
+	}
+	if resp.ContentLength >= 0 && int64(received.Len()) != resp.ContentLength {
+		return data, validator, true, fmt.Errorf("%s: %s: %w", externalRelPath, chezmoilog.RedactURL(req.URL), io.ErrUnexpectedEOF)
+	}
+
+	s.eventBus.Emit(&Event{
+		Type:   EventTypeDownloadFinished,
+		Target: externalRelPath.String(),
+		URL:    chezmoilog.RedactURL(req.URL),
+		Bytes:  int64(len(data)),
+	})
+
+	return data, validator, false, nil
+}
+
+// newExternalRequest returns a new GET request for external's URL with
+// external's headers and credentials, if any. net/http does not forward the
+// Authorization header on redirects to other domains, so credentials are not
+// leaked to, for example, the storage backend of a release asset.
+func newExternalRequest(ctx context.Context, external *External) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, external.URL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range external.Headers {
+		req.Header.Set(key, value)
+	}
+	if external.BasicAuth.Username != "" || external.BasicAuth.Password != "" {
+		req.SetBasicAuth(external.BasicAuth.Username, external.BasicAuth.Password)
+	}
+	return req, nil
+}
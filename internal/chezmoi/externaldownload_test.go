@@ -0,0 +1,139 @@
+package chezmoi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDownloadExternal(t *testing.T) {
+	contents := strings.Repeat("0123456789", 100)
+	for _, tc := range []struct {
+		name             string
+		retries          int
+		handlerFunc      func(int32) http.HandlerFunc
+		expectedErr      bool
+		expectedRequests int32
+	}{
+		{
+			name:    "ok",
+			retries: 2,
+			handlerFunc: func(int32) http.HandlerFunc {
+				return serveContents(contents)
+			},
+			expectedRequests: 1,
+		},
+		{
+			name:    "retry",
+			retries: 2,
+			handlerFunc: func(request int32) http.HandlerFunc {
+				if request < 3 {
+					return func(w http.ResponseWriter, r *http.Request) {
+						http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+					}
+				}
+				return serveContents(contents)
+			},
+			expectedRequests: 3,
+		},
+		{
+			name:    "too_many_retries",
+			retries: 1,
+			handlerFunc: func(int32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				}
+			},
+			expectedErr:      true,
+			expectedRequests: 2,
+		},
+		{
+			name:    "not_found",
+			retries: 2,
+			handlerFunc: func(int32) http.HandlerFunc {
+				return http.NotFound
+			},
+			expectedErr:      true,
+			expectedRequests: 1,
+		},
+		{
+			name:    "resume",
+			retries: 2,
+			handlerFunc: func(request int32) http.HandlerFunc {
+				if request == 1 {
+					return func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Length", "1000")
+						w.Header().Set("ETag", `"etag"`)
+						_, _ = w.Write([]byte(contents[:400]))
+						w.(http.Flusher).Flush() //nolint:forcetypeassert
+						panic(http.ErrAbortHandler)
+					}
+				}
+				return func(w http.ResponseWriter, r *http.Request) {
+					if r.Header.Get("Range") != "bytes=400-" {
+						http.Error(w, "expected range request", http.StatusBadRequest)
+						return
+					}
+					serveContents(contents)(w, r)
+				}
+			},
+			expectedRequests: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.handlerFunc(requests.Add(1))(w, r)
+			}))
+			defer server.Close()
+
+			s := NewSourceState(
+				WithExternalDownloadOptions(ExternalDownloadOptions{
+					Retries:    tc.retries,
+					RetryDelay: time.Millisecond,
+				}),
+				WithHTTPClient(server.Client()),
+			)
+			external := &External{
+				URL: server.URL + "/file",
+			}
+			actual, err := s.downloadExternal(context.Background(), NewRelPath("file"), external, nil)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, contents, string(actual))
+			}
+			assert.Equal(t, tc.expectedRequests, requests.Load())
+		})
+	}
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	start := time.Now()
+	r := newRateLimitedReader(strings.NewReader(strings.Repeat("x", 300)), 1000)
+	data := make([]byte, 0, 300)
+	buffer := make([]byte, 100)
+	for {
+		n, err := r.Read(buffer)
+		data = append(data, buffer[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	assert.Equal(t, 300, len(data))
+	assert.True(t, time.Since(start) >= 300*time.Millisecond)
+}
+
+func serveContents(contents string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(contents))
+	}
+}
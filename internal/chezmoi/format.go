@@ -189,6 +189,15 @@ func isPrefixDotFormat(name, prefix string) bool {
 	return false
 }
 
+// isPrefixDotFormatEncrypted returns true if name is prefix followed by a
+// format extension and the non-empty encryptedSuffix.
+func isPrefixDotFormatEncrypted(name, prefix, encryptedSuffix string) bool {
+	if encryptedSuffix == "" || !strings.HasSuffix(name, encryptedSuffix) {
+		return false
+	}
+	return isPrefixDotFormat(strings.TrimSuffix(name, encryptedSuffix), prefix)
+}
+
 func isPrefixDotFormatDotTmpl(name, prefix string) bool {
 	for extension := range FormatsByExtension {
 		if name == prefix+"."+extension+TemplateSuffix {
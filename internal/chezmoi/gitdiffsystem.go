@@ -21,39 +21,47 @@ type TextConvFunc func(string, []byte) ([]byte, error)
 // diff.
 type GitDiffSystem struct {
 	system         System
+	binaryDiffFunc BinaryDiffFunc
 	dirAbsPath     AbsPath
 	filter         *EntryTypeFilter
 	reverse        bool
 	scriptContents bool
 	textConvFunc   TextConvFunc
-	unifiedEncoder *diff.UnifiedEncoder
+	encoder        DiffEncoder
 }
 
 // GitDiffSystemOptions are options for NewGitDiffSystem.
 type GitDiffSystemOptions struct {
+	BinaryDiffFunc BinaryDiffFunc
 	Color          bool
 	Filter         *EntryTypeFilter
+	Format         DiffFormat
 	Reverse        bool
 	ScriptContents bool
 	TextConvFunc   TextConvFunc
+	Theme          *DiffTheme
+	Width          int
 }
 
 // NewGitDiffSystem returns a new GitDiffSystem. Output is written to w, the
-// dirAbsPath is stripped from paths, and color controls whether the output
-// contains ANSI color escape sequences.
+// dirAbsPath is stripped from paths, color controls whether the output
+// contains ANSI color escape sequences, and format, theme, and width control
+// how the diff is formatted.
 func NewGitDiffSystem(system System, w io.Writer, dirAbsPath AbsPath, options *GitDiffSystemOptions) *GitDiffSystem {
-	unifiedEncoder := diff.NewUnifiedEncoder(w, diff.DefaultContextLines)
-	if options.Color {
-		unifiedEncoder.SetColor(diff.NewColorConfig())
-	}
+	encoder := NewDiffEncoder(w, options.Format, &DiffEncoderOptions{
+		Color: options.Color,
+		Theme: options.Theme,
+		Width: options.Width,
+	})
 	return &GitDiffSystem{
 		system:         system,
+		binaryDiffFunc: options.BinaryDiffFunc,
 		dirAbsPath:     dirAbsPath,
 		filter:         options.Filter,
 		reverse:        options.Reverse,
 		scriptContents: options.ScriptContents,
 		textConvFunc:   options.TextConvFunc,
-		unifiedEncoder: unifiedEncoder,
+		encoder:        encoder,
 	}
 }
 
@@ -138,10 +146,20 @@ func (s *GitDiffSystem) Remove(name AbsPath) error {
 	return s.system.Remove(name)
 }
 
-// RemoveAll implements System.RemoveAll.
+// RemoveAll implements System.RemoveAll. If name is a directory then the
+// removal of everything in it is included in the diff.
 func (s *GitDiffSystem) RemoveAll(name AbsPath) error {
 	if s.filter.IncludeEntryTypeBits(EntryTypeRemove) {
-		if err := s.encodeDiff(name, nil, 0); err != nil {
+		walkFunc := func(absPath AbsPath, fileInfo fs.FileInfo, err error) error {
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				return nil
+			case err != nil:
+				return err
+			}
+			return s.encodeDiff(absPath, nil, 0)
+		}
+		if err := Walk(s.system, name, walkFunc); err != nil {
 			return err
 		}
 	}
@@ -173,7 +191,7 @@ func (s *GitDiffSystem) Rename(oldpath, newpath AbsPath) error {
 		if s.reverse {
 			fromPath, toPath = toPath, fromPath
 		}
-		if err := s.unifiedEncoder.Encode(&gitDiffPatch{
+		if err := s.encoder.Encode(&gitDiffPatch{
 			filePatches: []diff.FilePatch{
 				&gitDiffFilePatch{
 					from: &gitDiffFile{
@@ -220,7 +238,7 @@ func (s *GitDiffSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte,
 		if err != nil {
 			return err
 		}
-		if err := s.unifiedEncoder.Encode(diffPatch); err != nil {
+		if err := s.encoder.Encode(diffPatch); err != nil {
 			return err
 		}
 	}
@@ -312,8 +330,11 @@ func (s *GitDiffSystem) encodeDiff(absPath AbsPath, toData []byte, toMode fs.Fil
 	if err != nil {
 		return err
 	}
+	if err := AddBinaryDiffOutput(diffPatch, fromData, toData, s.binaryDiffFunc); err != nil {
+		return err
+	}
 
-	return s.unifiedEncoder.Encode(diffPatch)
+	return s.encoder.Encode(diffPatch)
 }
 
 // trimPrefix removes s's directory prefix from absPath.
@@ -0,0 +1,292 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+// httpPersistentStateLocksBucket is the pseudo-bucket that contains locks.
+const httpPersistentStateLocksBucket = ".locks"
+
+// An HTTPPersistentState is a SharedPersistentState stored on an HTTP server.
+//
+// The server must implement the following requests, where bucket, key, and
+// name are path-escaped:
+//
+//	GET    /                   returns a JSON array of bucket names
+//	GET    /bucket/            returns a JSON object mapping keys to values
+//	DELETE /bucket/            deletes bucket
+//	GET    /bucket/key         returns the value of key, or 404 Not Found
+//	PUT    /bucket/key         sets the value of key to the request body
+//	DELETE /bucket/key         deletes key
+//	GET    /.locks/name        returns when the lock name was taken and its ETag
+//	PUT    /.locks/name        takes the lock name, honoring If-None-Match: *
+//	                           and If-Match and returning its ETag
+//	DELETE /.locks/name        releases the lock name, honoring If-Match
+//
+// Any server that stores objects and supports conditional writes, for example
+// a WebDAV server with a small amount of glue, can be used.
+type HTTPPersistentState struct {
+	client    *http.Client
+	baseURL   *url.URL
+	header    http.Header
+	lockTTL   time.Duration
+	lockETags map[string]string
+}
+
+// NewHTTPPersistentState returns a new HTTPPersistentState that uses client to
+// access the state at baseURL, adding header to every request. Locks that were
+// taken more than lockTTL ago are considered stale and are taken over, so that
+// a machine that crashed while holding a lock does not hold it forever. If
+// lockTTL is zero then locks are never taken over.
+func NewHTTPPersistentState(
+	client *http.Client, baseURL *url.URL, header http.Header, lockTTL time.Duration,
+) *HTTPPersistentState {
+	baseURL = baseURL.JoinPath("/")
+	return &HTTPPersistentState{
+		client:    client,
+		baseURL:   baseURL,
+		header:    header,
+		lockTTL:   lockTTL,
+		lockETags: make(map[string]string),
+	}
+}
+
+// Close implements PersistentState.Close.
+func (s *HTTPPersistentState) Close() error {
+	return nil
+}
+
+// CopyTo implements PersistentState.CopyTo.
+func (s *HTTPPersistentState) CopyTo(p PersistentState) error {
+	buckets, err := s.buckets()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		if err := s.ForEach([]byte(bucket), func(k, v []byte) error {
+			return p.Set([]byte(bucket), k, v)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Data implements PersistentState.Data.
+func (s *HTTPPersistentState) Data() (any, error) {
+	mockPersistentState := NewMockPersistentState()
+	if err := s.CopyTo(mockPersistentState); err != nil {
+		return nil, err
+	}
+	return mockPersistentState.Data()
+}
+
+// Delete implements PersistentState.Delete.
+func (s *HTTPPersistentState) Delete(bucket, key []byte) error {
+	_, err := s.do(http.MethodDelete, s.keyURL(string(bucket), string(key)), nil, nil, http.StatusNotFound)
+	return err
+}
+
+// DeleteBucket implements PersistentState.DeleteBucket.
+func (s *HTTPPersistentState) DeleteBucket(bucket []byte) error {
+	_, err := s.do(http.MethodDelete, s.bucketURL(string(bucket)), nil, nil, http.StatusNotFound)
+	return err
+}
+
+// ForEach implements PersistentState.ForEach.
+func (s *HTTPPersistentState) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	resp, err := s.do(http.MethodGet, s.bucketURL(string(bucket)), nil, nil, http.StatusNotFound)
+	if err != nil || resp == nil {
+		return err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(resp, &values); err != nil {
+		return fmt.Errorf("%s: %w", s.bucketURL(string(bucket)), err)
+	}
+	for key, value := range values {
+		if err := fn([]byte(key), []byte(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get implements PersistentState.Get.
+func (s *HTTPPersistentState) Get(bucket, key []byte) ([]byte, error) {
+	return s.do(http.MethodGet, s.keyURL(string(bucket), string(key)), nil, nil, http.StatusNotFound)
+}
+
+// Set implements PersistentState.Set.
+func (s *HTTPPersistentState) Set(bucket, key, value []byte) error {
+	_, err := s.do(http.MethodPut, s.keyURL(string(bucket), string(key)), nil, value)
+	return err
+}
+
+// TryLock implements SharedPersistentState.TryLock. If the lock is held but
+// stale then TryLock takes it over.
+func (s *HTTPPersistentState) TryLock(name string) (bool, error) {
+	lockURL := s.keyURL(httpPersistentStateLocksBucket, name)
+	ok, err := s.putLock(name, http.Header{
+		"If-None-Match": []string{"*"},
+	})
+	if ok || err != nil || s.lockTTL == 0 {
+		return ok, err
+	}
+
+	body, header, err := s.doHeader(http.MethodGet, lockURL, nil, nil, http.StatusNotFound)
+	switch {
+	case err != nil:
+		return false, err
+	case body == nil:
+		// The lock was released in the meantime.
+		return s.putLock(name, http.Header{
+			"If-None-Match": []string{"*"},
+		})
+	}
+	if lockedAt, err := time.Parse(time.RFC3339Nano, string(body)); err == nil && time.Since(lockedAt) < s.lockTTL {
+		return false, nil
+	}
+	etag := header.Get("ETag")
+	if etag == "" {
+		return false, nil
+	}
+	// Only replace the stale lock if nobody else replaced it first.
+	return s.putLock(name, http.Header{
+		"If-Match": []string{etag},
+	})
+}
+
+// Unlock implements SharedPersistentState.Unlock. If the lock was taken over
+// by another machine then Unlock leaves it in place.
+func (s *HTTPPersistentState) Unlock(name string) error {
+	var header http.Header
+	if etag := s.lockETags[name]; etag != "" {
+		header = http.Header{
+			"If-Match": []string{etag},
+		}
+	}
+	delete(s.lockETags, name)
+	lockURL := s.keyURL(httpPersistentStateLocksBucket, name)
+	_, err := s.do(http.MethodDelete, lockURL, header, nil, http.StatusNotFound, http.StatusPreconditionFailed)
+	return err
+}
+
+// buckets returns the names of the buckets in s.
+func (s *HTTPPersistentState) buckets() ([]string, error) {
+	resp, err := s.do(http.MethodGet, s.baseURL.String(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []string
+	if err := json.Unmarshal(resp, &buckets); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.baseURL, err)
+	}
+	return buckets, nil
+}
+
+// bucketURL returns the URL of bucket.
+func (s *HTTPPersistentState) bucketURL(bucket string) string {
+	return s.baseURL.String() + url.PathEscape(bucket) + "/"
+}
+
+// keyURL returns the URL of key in bucket.
+func (s *HTTPPersistentState) keyURL(bucket, key string) string {
+	return s.bucketURL(bucket) + url.PathEscape(key)
+}
+
+// putLock tries to take the lock name with the conditions in header. It
+// returns false if the conditions are not met.
+func (s *HTTPPersistentState) putLock(name string, header http.Header) (bool, error) {
+	lockURL := s.keyURL(httpPersistentStateLocksBucket, name)
+	lockedAt := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	switch _, respHeader, err := s.doHeader(http.MethodPut, lockURL, header, lockedAt); {
+	case err == nil:
+		s.lockETags[name] = respHeader.Get("ETag")
+		return true, nil
+	case isHTTPStatusError(err, http.StatusPreconditionFailed):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// do performs an HTTP request with method to urlStr with header and body and
+// returns the response body. If the response status is one of
+// ignoreStatusCodes then it returns nil.
+func (s *HTTPPersistentState) do(
+	method, urlStr string, header http.Header, body []byte, ignoreStatusCodes ...int,
+) ([]byte, error) {
+	respBody, _, err := s.doHeader(method, urlStr, header, body, ignoreStatusCodes...)
+	return respBody, err
+}
+
+// doHeader is like do but also returns the response header.
+func (s *HTTPPersistentState) doHeader(
+	method, urlStr string, header http.Header, body []byte, ignoreStatusCodes ...int,
+) ([]byte, http.Header, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, urlStr, bodyReader) //nolint:noctx
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, statusCode := range ignoreStatusCodes {
+		if resp.StatusCode == statusCode {
+			return nil, resp.Header, nil
+		}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, nil, &httpPersistentStateStatusError{
+			method:     method,
+			url:        chezmoilog.RedactURL(req.URL),
+			status:     resp.Status,
+			statusCode: resp.StatusCode,
+		}
+	}
+	return respBody, resp.Header, nil
+}
+
+// An httpPersistentStateStatusError is an error for an unexpected HTTP status.
+type httpPersistentStateStatusError struct {
+	method     string
+	url        string
+	status     string
+	statusCode int
+}
+
+func (e *httpPersistentStateStatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.method, e.url, e.status)
+}
+
+// isHTTPStatusError returns true if err is an unexpected HTTP status
+// statusCode.
+func isHTTPStatusError(err error, statusCode int) bool {
+	var statusErr *httpPersistentStateStatusError
+	return errors.As(err, &statusErr) && statusErr.statusCode == statusCode
+}
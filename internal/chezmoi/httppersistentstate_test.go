@@ -0,0 +1,180 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+var _ SharedPersistentState = &HTTPPersistentState{}
+
+// A testHTTPPersistentStateServer is an in-memory implementation of the
+// HTTPPersistentState protocol.
+type testHTTPPersistentStateServer struct {
+	sync.Mutex
+	buckets map[string]map[string]string
+}
+
+func (s *testHTTPPersistentStateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	components := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, component := range components {
+		unescapedComponent, err := url.PathUnescape(component)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		components[i] = unescapedComponent
+	}
+
+	switch {
+	case len(components) == 1 && components[0] == "" && r.Method == http.MethodGet:
+		buckets := maps.Keys(s.buckets)
+		slices.Sort(buckets)
+		_ = json.NewEncoder(w).Encode(buckets)
+	case len(components) == 2 && components[1] == "":
+		bucket, ok := s.buckets[components[0]]
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(bucket)
+		case r.Method == http.MethodDelete:
+			delete(s.buckets, components[0])
+		}
+	case len(components) == 2:
+		bucketName, key := components[0], components[1]
+		bucket := s.buckets[bucketName]
+		value, ok := bucket[key]
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!ok || ifMatch != testETag(value)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", testETag(value))
+			_, _ = w.Write([]byte(value))
+		case http.MethodPut:
+			if ok && r.Header.Get("If-None-Match") == "*" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if bucket == nil {
+				bucket = make(map[string]string)
+				s.buckets[bucketName] = bucket
+			}
+			bucket[key] = string(data)
+			w.Header().Set("ETag", testETag(string(data)))
+		case http.MethodDelete:
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			delete(bucket, key)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// testETag returns the ETag of value.
+func testETag(value string) string {
+	valueSHA256 := sha256.Sum256([]byte(value))
+	return `"` + hex.EncodeToString(valueSHA256[:8]) + `"`
+}
+
+// newTestHTTPPersistentState returns a function that returns new
+// HTTPPersistentStates that share the same in-memory server.
+func newTestHTTPPersistentState(t *testing.T) func(time.Duration) *HTTPPersistentState {
+	t.Helper()
+	server := httptest.NewServer(http.StripPrefix("/state", &testHTTPPersistentStateServer{
+		buckets: make(map[string]map[string]string),
+	}))
+	t.Cleanup(server.Close)
+	baseURL, err := url.Parse(server.URL + "/state")
+	assert.NoError(t, err)
+	return func(lockTTL time.Duration) *HTTPPersistentState {
+		return NewHTTPPersistentState(server.Client(), baseURL, http.Header{
+			"Authorization": []string{"Bearer token"},
+		}, lockTTL)
+	}
+}
+
+func TestHTTPPersistentState(t *testing.T) {
+	newHTTPPersistentState := newTestHTTPPersistentState(t)
+	testPersistentState(t, func() PersistentState {
+		return newHTTPPersistentState(time.Hour)
+	})
+}
+
+func TestHTTPPersistentStateLock(t *testing.T) {
+	newHTTPPersistentState := newTestHTTPPersistentState(t)
+	s1 := newHTTPPersistentState(time.Hour)
+	s2 := newHTTPPersistentState(time.Hour)
+
+	ok, err := s1.TryLock("lock")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s2.TryLock("lock")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, s1.Unlock("lock"))
+	ok, err = s2.TryLock("lock")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestHTTPPersistentStateStaleLock(t *testing.T) {
+	newHTTPPersistentState := newTestHTTPPersistentState(t)
+	s1 := newHTTPPersistentState(time.Hour)
+	s2 := newHTTPPersistentState(time.Hour)
+	s3 := newHTTPPersistentState(time.Nanosecond)
+
+	ok, err := s1.TryLock("lock")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// The lock is not stale for s2, but is for s3, which takes it over.
+	ok, err = s2.TryLock("lock")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = s3.TryLock("lock")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// s1 no longer holds the lock, so it does not release s3's lock.
+	assert.NoError(t, s1.Unlock("lock"))
+	ok, err = s2.TryLock("lock")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, s3.Unlock("lock"))
+	ok, err = s2.TryLock("lock")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,362 @@
+package chezmoi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoimaps"
+)
+
+// A jsonSchema is a JSON Schema. Only a subset of JSON Schema is supported:
+// the keywords type, enum, const, properties, required, additionalProperties,
+// items, minItems, maxItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, allOf, anyOf, oneOf, and not. All other
+// keywords are ignored.
+type jsonSchema struct {
+	schema any
+}
+
+// newJSONSchema returns a new jsonSchema from data.
+func newJSONSchema(data []byte) (*jsonSchema, error) {
+	var schema any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	if err := checkJSONSchema(schema); err != nil {
+		return nil, err
+	}
+	return &jsonSchema{
+		schema: schema,
+	}, nil
+}
+
+// Validate validates value against s and returns all errors found.
+func (s *jsonSchema) Validate(value any) error {
+	return errors.Join(validateJSONSchema(s.schema, "", value)...)
+}
+
+// checkJSONSchema checks that schema is a valid schema.
+func checkJSONSchema(schema any) error {
+	switch schema := schema.(type) {
+	case bool:
+		return nil
+	case map[string]any:
+		if pattern, ok := schema["pattern"].(string); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return err
+			}
+		}
+		for _, keyword := range []string{"additionalProperties", "items", "not"} {
+			if subschema, ok := schema[keyword]; ok {
+				if err := checkJSONSchema(subschema); err != nil {
+					return err
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]any); ok {
+			for _, subschema := range properties {
+				if err := checkJSONSchema(subschema); err != nil {
+					return err
+				}
+			}
+		}
+		for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+			if subschemas, ok := schema[keyword].([]any); ok {
+				for _, subschema := range subschemas {
+					if err := checkJSONSchema(subschema); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%v: invalid schema", schema)
+	}
+}
+
+// validateJSONSchema validates value at pointer against schema.
+func validateJSONSchema(schema any, pointer string, value any) []error {
+	var errs []error
+	errorf := func(format string, args ...any) {
+		location := pointer
+		if location == "" {
+			location = "/"
+		}
+		errs = append(errs, fmt.Errorf("%s: %s", location, fmt.Sprintf(format, args...)))
+	}
+
+	var schemaMap map[string]any
+	switch schema := schema.(type) {
+	case bool:
+		if !schema {
+			errorf("not allowed")
+		}
+		return errs
+	case map[string]any:
+		schemaMap = schema
+	default:
+		return nil
+	}
+
+	value = normalizeJSONSchemaValue(value)
+	valueType := jsonSchemaType(value)
+
+	if schemaType, ok := schemaMap["type"]; ok {
+		var types []string
+		switch schemaType := schemaType.(type) {
+		case string:
+			types = []string{schemaType}
+		case []any:
+			for _, t := range schemaType {
+				if t, ok := t.(string); ok {
+					types = append(types, t)
+				}
+			}
+		}
+		matched := false
+		for _, t := range types {
+			if t == valueType || t == "number" && valueType == "integer" {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errorf("expected %s, got %s", strings.Join(types, " or "), valueType)
+			return errs
+		}
+	}
+
+	if enum, ok := schemaMap["enum"].([]any); ok {
+		matched := false
+		for _, enumValue := range enum {
+			if jsonSchemaEqual(enumValue, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errorf("value %s not in enum", jsonSchemaString(value))
+		}
+	}
+
+	if constValue, ok := schemaMap["const"]; ok && !jsonSchemaEqual(constValue, value) {
+		errorf("expected %s, got %s", jsonSchemaString(constValue), jsonSchemaString(value))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		properties, _ := schemaMap["properties"].(map[string]any)
+		if required, ok := schemaMap["required"].([]any); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, ok := value[name]; !ok {
+						errorf("missing required property %s", name)
+					}
+				}
+			}
+		}
+		for _, name := range chezmoimaps.SortedKeys(value) {
+			propertyPointer := pointer + "/" + escapeJSONPointer(name)
+			if propertySchema, ok := properties[name]; ok {
+				errs = append(errs, validateJSONSchema(propertySchema, propertyPointer, value[name])...)
+			} else if additionalProperties, ok := schemaMap["additionalProperties"]; ok {
+				if additionalProperties == false {
+					errorf("additional property %s not allowed", name)
+				} else {
+					errs = append(errs, validateJSONSchema(additionalProperties, propertyPointer, value[name])...)
+				}
+			}
+		}
+	case []any:
+		if minItems, ok := jsonSchemaNumber(schemaMap["minItems"]); ok && float64(len(value)) < minItems {
+			errorf("expected at least %s items, got %d", jsonSchemaString(minItems), len(value))
+		}
+		if maxItems, ok := jsonSchemaNumber(schemaMap["maxItems"]); ok && float64(len(value)) > maxItems {
+			errorf("expected at most %s items, got %d", jsonSchemaString(maxItems), len(value))
+		}
+		if items, ok := schemaMap["items"]; ok {
+			for i, item := range value {
+				errs = append(errs, validateJSONSchema(items, pointer+"/"+strconv.Itoa(i), item)...)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if minLength, ok := jsonSchemaNumber(schemaMap["minLength"]); ok && length < minLength {
+			errorf("expected length at least %s, got %s", jsonSchemaString(minLength), jsonSchemaString(length))
+		}
+		if maxLength, ok := jsonSchemaNumber(schemaMap["maxLength"]); ok && length > maxLength {
+			errorf("expected length at most %s, got %s", jsonSchemaString(maxLength), jsonSchemaString(length))
+		}
+		if pattern, ok := schemaMap["pattern"].(string); ok {
+			if !regexp.MustCompile(pattern).MatchString(value) {
+				errorf("%s does not match pattern %s", jsonSchemaString(value), jsonSchemaString(pattern))
+			}
+		}
+	case float64:
+		if minimum, ok := jsonSchemaNumber(schemaMap["minimum"]); ok && value < minimum {
+			errorf("expected at least %s, got %s", jsonSchemaString(minimum), jsonSchemaString(value))
+		}
+		if maximum, ok := jsonSchemaNumber(schemaMap["maximum"]); ok && value > maximum {
+			errorf("expected at most %s, got %s", jsonSchemaString(maximum), jsonSchemaString(value))
+		}
+		if exclusiveMinimum, ok := jsonSchemaNumber(schemaMap["exclusiveMinimum"]); ok && value <= exclusiveMinimum {
+			errorf("expected more than %s, got %s", jsonSchemaString(exclusiveMinimum), jsonSchemaString(value))
+		}
+		if exclusiveMaximum, ok := jsonSchemaNumber(schemaMap["exclusiveMaximum"]); ok && value >= exclusiveMaximum {
+			errorf("expected less than %s, got %s", jsonSchemaString(exclusiveMaximum), jsonSchemaString(value))
+		}
+	}
+
+	if allOf, ok := schemaMap["allOf"].([]any); ok {
+		for _, subschema := range allOf {
+			errs = append(errs, validateJSONSchema(subschema, pointer, value)...)
+		}
+	}
+	if anyOf, ok := schemaMap["anyOf"].([]any); ok {
+		matched := false
+		for _, subschema := range anyOf {
+			if len(validateJSONSchema(subschema, pointer, value)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errorf("does not match any schema in anyOf")
+		}
+	}
+	if oneOf, ok := schemaMap["oneOf"].([]any); ok {
+		matches := 0
+		for _, subschema := range oneOf {
+			if len(validateJSONSchema(subschema, pointer, value)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			errorf("matches %d schemas in oneOf, expected exactly one", matches)
+		}
+	}
+	if not, ok := schemaMap["not"]; ok {
+		if len(validateJSONSchema(not, pointer, value)) == 0 {
+			errorf("matches schema in not")
+		}
+	}
+
+	return errs
+}
+
+// normalizeJSONSchemaValue returns value with numbers converted to float64s,
+// maps converted to map[string]anys, and slices converted to []anys.
+func normalizeJSONSchemaValue(value any) any {
+	switch value := value.(type) {
+	case nil, bool, string, float64, map[string]any, []any:
+		return value
+	case json.Number:
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value.String()
+	}
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflectValue.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(reflectValue.Uint())
+	case reflect.Float32, reflect.Float64:
+		return reflectValue.Float()
+	case reflect.Map:
+		m := make(map[string]any, reflectValue.Len())
+		iter := reflectValue.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		s := make([]any, 0, reflectValue.Len())
+		for i := 0; i < reflectValue.Len(); i++ {
+			s = append(s, reflectValue.Index(i).Interface())
+		}
+		return s
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// jsonSchemaType returns the JSON Schema type of the normalized value.
+func jsonSchemaType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return "unknown"
+	}
+}
+
+// jsonSchemaEqual returns if a and b are equal JSON values.
+func jsonSchemaEqual(a, b any) bool {
+	return reflect.DeepEqual(normalizeJSONSchemaValueDeep(a), normalizeJSONSchemaValueDeep(b))
+}
+
+// normalizeJSONSchemaValueDeep returns value normalized recursively.
+func normalizeJSONSchemaValueDeep(value any) any {
+	switch value := normalizeJSONSchemaValue(value).(type) {
+	case map[string]any:
+		m := make(map[string]any, len(value))
+		for k, v := range value {
+			m[k] = normalizeJSONSchemaValueDeep(v)
+		}
+		return m
+	case []any:
+		s := make([]any, 0, len(value))
+		for _, v := range value {
+			s = append(s, normalizeJSONSchemaValueDeep(v))
+		}
+		return s
+	default:
+		return value
+	}
+}
+
+// jsonSchemaNumber returns value as a float64, if it is a number.
+func jsonSchemaNumber(value any) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	f, ok := normalizeJSONSchemaValue(value).(float64)
+	return f, ok
+}
+
+// jsonSchemaString returns value formatted as JSON.
+func jsonSchemaString(value any) string {
+	data, err := json.Marshal(normalizeJSONSchemaValueDeep(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// escapeJSONPointer escapes s for use as a JSON Pointer reference token.
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,140 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		schema      string
+		value       any
+		expectedErr string
+	}{
+		{
+			name:   "true",
+			schema: `true`,
+			value:  map[string]any{"a": 1},
+		},
+		{
+			name:        "false",
+			schema:      `false`,
+			value:       map[string]any{},
+			expectedErr: "/: not allowed",
+		},
+		{
+			name:   "type_integer",
+			schema: `{"properties":{"a":{"type":"integer"}}}`,
+			value:  map[string]any{"a": int64(1)},
+		},
+		{
+			name:   "type_number_integer",
+			schema: `{"properties":{"a":{"type":"number"}}}`,
+			value:  map[string]any{"a": 1},
+		},
+		{
+			name:        "type_mismatch",
+			schema:      `{"properties":{"a":{"properties":{"b":{"type":"string"}}}}}`,
+			value:       map[string]any{"a": map[string]any{"b": 1.5}},
+			expectedErr: "/a/b: expected string, got number",
+		},
+		{
+			name:   "type_multiple",
+			schema: `{"type":["string","null"]}`,
+			value:  nil,
+		},
+		{
+			name:        "required",
+			schema:      `{"required":["email","name"]}`,
+			value:       map[string]any{"name": "user"},
+			expectedErr: "/: missing required property email",
+		},
+		{
+			name:        "additional_properties_false",
+			schema:      `{"properties":{"a":true},"additionalProperties":false}`,
+			value:       map[string]any{"a": 1, "b": 2},
+			expectedErr: "/: additional property b not allowed",
+		},
+		{
+			name:        "additional_properties_schema",
+			schema:      `{"additionalProperties":{"type":"boolean"}}`,
+			value:       map[string]any{"a": true, "b": "c"},
+			expectedErr: "/b: expected boolean, got string",
+		},
+		{
+			name:        "enum",
+			schema:      `{"enum":["vim","emacs"]}`,
+			value:       "nano",
+			expectedErr: `/: value "nano" not in enum`,
+		},
+		{
+			name:        "items",
+			schema:      `{"items":{"type":"string"},"maxItems":2}`,
+			value:       []string{"a", "b", "c"},
+			expectedErr: "/: expected at most 2 items, got 3",
+		},
+		{
+			name:        "items_type",
+			schema:      `{"items":{"type":"string"}}`,
+			value:       []any{"a", 1},
+			expectedErr: "/1: expected string, got integer",
+		},
+		{
+			name:        "pattern",
+			schema:      `{"pattern":"@"}`,
+			value:       "user",
+			expectedErr: `/: "user" does not match pattern "@"`,
+		},
+		{
+			name:        "minimum",
+			schema:      `{"minimum":8}`,
+			value:       uint8(7),
+			expectedErr: "/: expected at least 8, got 7",
+		},
+		{
+			name:        "any_of",
+			schema:      `{"anyOf":[{"type":"string"},{"type":"boolean"}]}`,
+			value:       1,
+			expectedErr: "/: does not match any schema in anyOf",
+		},
+		{
+			name:        "escape",
+			schema:      `{"properties":{"a/b":{"type":"string"}}}`,
+			value:       map[string]any{"a/b": 1},
+			expectedErr: "/a~1b: expected string, got integer",
+		},
+		{
+			name:   "multiple_errors",
+			schema: `{"required":["a"],"properties":{"b":{"type":"string"}}}`,
+			value:  map[string]any{"b": false},
+			expectedErr: "/: missing required property a\n" +
+				"/b: expected string, got boolean",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := newJSONSchema([]byte(tc.schema))
+			assert.NoError(t, err)
+			err = schema.Validate(tc.value)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewJSONSchemaInvalid(t *testing.T) {
+	for _, schema := range []string{
+		`1`,
+		`{"pattern":"("}`,
+		`{"properties":{"a":"string"}}`,
+	} {
+		t.Run(schema, func(t *testing.T) {
+			_, err := newJSONSchema([]byte(schema))
+			assert.Error(t, err)
+		})
+	}
+}
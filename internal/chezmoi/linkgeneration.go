@@ -0,0 +1,42 @@
+package chezmoi
+
+import (
+	"io/fs"
+)
+
+// Names in the link directory when generations are used.
+const (
+	LinkCurrentName        = "current"
+	LinkGenerationsDirName = "generations"
+)
+
+// WriteLinkGeneration writes the contents of all linked targets in s to
+// generationAbsPath, which must not exist, as a new generation of the link
+// directory. destSystem is used to compute the target state of each entry.
+func (s *SourceState) WriteLinkGeneration(system, destSystem System, generationAbsPath AbsPath) error {
+	if err := MkdirAll(system, generationAbsPath, fs.ModePerm); err != nil {
+		return err
+	}
+	return s.ForEach(func(targetRelPath RelPath, sourceStateEntry SourceStateEntry) error {
+		if !s.Linked(targetRelPath) {
+			return nil
+		}
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(destSystem, s.destDirAbsPath.Join(targetRelPath))
+		if err != nil {
+			return err
+		}
+		targetStateSymlink, ok := targetStateEntry.(*TargetStateSymlink)
+		if !ok || targetStateSymlink.linkFile == nil {
+			return nil
+		}
+		contents, err := targetStateSymlink.linkFile.Contents()
+		if err != nil {
+			return err
+		}
+		linkFileAbsPath := generationAbsPath.Join(targetRelPath)
+		if err := MkdirAll(system, linkFileAbsPath.Dir(), fs.ModePerm); err != nil {
+			return err
+		}
+		return system.WriteFile(linkFileAbsPath, contents, targetStateSymlink.linkFile.perm)
+	})
+}
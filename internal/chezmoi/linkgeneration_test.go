@@ -0,0 +1,60 @@
+package chezmoi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+	"github.com/twpayne/go-vfs/v4/vfst"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestSourceStateWriteLinkGeneration(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			".chezmoilinks": ".dir\n",
+			"dot_dir": map[string]any{
+				"file.tmpl": `{{ "# contents of .dir/file" }}` + "\n",
+			},
+			"dot_file": "# contents of .file\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithDestDir(NewAbsPath("/home/user")),
+			WithLinkDir(NewAbsPath("/home/user/.local/share/chezmoi-links")),
+			WithLinkGenerations(true),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(context.Background(), nil))
+
+		generationAbsPath := NewAbsPath("/home/user/.local/share/chezmoi-links/generations/1")
+		assert.NoError(t, s.WriteLinkGeneration(system, system, generationAbsPath))
+
+		targetStateEntry, err := s.MustEntry(NewRelPath(".dir/file")).TargetStateEntry(
+			system, NewAbsPath("/home/user/.dir/file"),
+		)
+		assert.NoError(t, err)
+		linkname, err := targetStateEntry.(*TargetStateSymlink).Linkname() //nolint:forcetypeassert
+		assert.NoError(t, err)
+		assert.Equal(t, "/home/user/.local/share/chezmoi-links/current/.dir/file", linkname)
+
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.local/share/chezmoi-links/generations/1/.dir/file",
+				vfst.TestModeIsRegular,
+				vfst.TestModePerm(0o444&^chezmoitest.Umask),
+				vfst.TestContentsString("# contents of .dir/file\n"),
+			),
+			vfst.TestPath("/home/user/.local/share/chezmoi-links/generations/1/.file",
+				vfst.TestDoesNotExist,
+			),
+			vfst.TestPath("/home/user/.local/share/chezmoi-links/current",
+				vfst.TestDoesNotExist,
+			),
+		)
+	})
+}
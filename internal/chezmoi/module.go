@@ -0,0 +1,86 @@
+package chezmoi
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// A ModuleManifest is the contents of a .chezmoimodule.yaml file.
+type ModuleManifest struct {
+	Name        string         `json:"name"                  yaml:"name"`
+	Version     string         `json:"version,omitempty"     yaml:"version,omitempty"`
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	URL         string         `json:"url,omitempty"         yaml:"url,omitempty"`
+	SHA256      HexBytes       `json:"sha256,omitempty"      yaml:"sha256,omitempty"`
+	Data        map[string]any `json:"data,omitempty"        yaml:"data,omitempty"`
+}
+
+// A Module is a directory in the source state with a module manifest.
+type Module struct {
+	ModuleManifest
+	SourceRelPath SourceRelPath
+	Enabled       bool
+}
+
+// Modules returns all modules in s, including disabled modules, sorted by
+// name.
+func (s *SourceState) Modules() []*Module {
+	s.Lock()
+	defer s.Unlock()
+	modules := make([]*Module, 0, len(s.modules))
+	for _, module := range s.modules {
+		modules = append(modules, module)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+	return modules
+}
+
+// readModule reads the module manifest in the source directory sourceAbsPath,
+// if any, and adds the module to s. It returns nil if sourceAbsPath is not a
+// module.
+func (s *SourceState) readModule(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) (*Module, error) {
+	manifestAbsPath := sourceAbsPath.JoinString(ModuleName)
+	data, err := s.system.ReadFile(manifestAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var manifest ModuleManifest
+	if err := FormatYAML.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestAbsPath, err)
+	}
+	if manifest.Name == "" {
+		manifest.Name = sourceRelPath.RelPath().Base()
+	}
+	_, disabled := s.disabledModules[manifest.Name]
+	module := &Module{
+		ModuleManifest: manifest,
+		SourceRelPath:  sourceRelPath,
+		Enabled:        !disabled,
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if otherModule, ok := s.modules[manifest.Name]; ok && otherModule.SourceRelPath != sourceRelPath {
+		return nil, fmt.Errorf("%s: duplicate module %s, also in %s", manifestAbsPath, manifest.Name, otherModule.SourceRelPath)
+	}
+	s.modules[manifest.Name] = module
+	if module.Enabled && len(manifest.Data) != 0 {
+		key := path.Clean(sourceRelPath.String())
+		dirTemplateData, ok := s.dirTemplateData[key]
+		if !ok {
+			dirTemplateData = make(map[string]any)
+			s.dirTemplateData[key] = dirTemplateData
+		}
+		RecursiveMerge(dirTemplateData, manifest.Data)
+	}
+	return module, nil
+}
@@ -0,0 +1,64 @@
+package chezmoi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestSourceStateModules(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			"dot_config": map[string]any{
+				"nvim": map[string]any{
+					".chezmoimodule.yaml": chezmoitest.JoinLines(
+						`version: 1.0.0`,
+						`data:`,
+						`  colorscheme: gruvbox`,
+					),
+					"init.lua.tmpl": `{{ .colorscheme }}`,
+				},
+				"tmux": map[string]any{
+					".chezmoimodule.yaml": chezmoitest.JoinLines(
+						`name: terminal-multiplexer`,
+					),
+					"tmux.conf": "# contents of .config/tmux/tmux.conf\n",
+				},
+			},
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithDestDir(NewAbsPath("/home/user")),
+			WithDisabledModules([]string{"terminal-multiplexer"}),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(context.Background(), nil))
+
+		modules := s.Modules()
+		assert.Equal(t, 2, len(modules))
+		assert.Equal(t, "nvim", modules[0].Name)
+		assert.Equal(t, "1.0.0", modules[0].Version)
+		assert.True(t, modules[0].Enabled)
+		assert.Equal(t, "terminal-multiplexer", modules[1].Name)
+		assert.False(t, modules[1].Enabled)
+
+		assert.NotZero(t, s.Get(NewRelPath(".config/nvim/init.lua")))
+		assert.Zero(t, s.Get(NewRelPath(".config/tmux")))
+		assert.Zero(t, s.Get(NewRelPath(".config/tmux/tmux.conf")))
+
+		targetStateEntry, err := s.Get(NewRelPath(".config/nvim/init.lua")).TargetStateEntry(
+			system, NewAbsPath("/home/user/.config/nvim/init.lua"),
+		)
+		assert.NoError(t, err)
+		contents, err := targetStateEntry.(*TargetStateFile).Contents() //nolint:forcetypeassert
+		assert.NoError(t, err)
+		assert.Equal(t, "gruvbox", string(contents))
+	})
+}
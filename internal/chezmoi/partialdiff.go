@@ -0,0 +1,110 @@
+package chezmoi
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// A PartialDiff is the diff between two versions of a text file, which can be
+// applied hunk by hunk.
+type PartialDiff struct {
+	lines []diffLine
+	hunks []diffHunk
+}
+
+// NewPartialDiff returns a new PartialDiff that transforms from into to, or
+// nil if either from or to is binary.
+func NewPartialDiff(from, to []byte) *PartialDiff {
+	if isBinary(from) || isBinary(to) {
+		return nil
+	}
+	lines := newDiffLines(diffChunks(string(from), string(to)))
+	return &PartialDiff{
+		lines: lines,
+		hunks: newDiffHunks(lines, diff.DefaultContextLines),
+	}
+}
+
+// Apply returns the result of applying the hunks of d for which selected is
+// true. Unselected hunks are left unchanged.
+func (d *PartialDiff) Apply(selected []bool) []byte {
+	var builder strings.Builder
+	writeLine := func(line *diffLine) {
+		builder.WriteString(line.text)
+		if !line.noNewline {
+			builder.WriteByte('\n')
+		}
+	}
+	hunkIndex := 0
+	for i := range d.lines {
+		line := &d.lines[i]
+		for hunkIndex < len(d.hunks) && d.hunks[hunkIndex].end <= i {
+			hunkIndex++
+		}
+		switch {
+		case line.op == diff.Equal:
+			writeLine(line)
+		case hunkIndex < len(selected) && selected[hunkIndex]:
+			if line.op == diff.Add {
+				writeLine(line)
+			}
+		default:
+			if line.op == diff.Delete {
+				writeLine(line)
+			}
+		}
+	}
+	return []byte(builder.String())
+}
+
+// FormatHunk returns the ith hunk of d in unified diff format, painted with
+// theme's colors.
+func (d *PartialDiff) FormatHunk(i int, theme *DiffTheme) string {
+	if theme == nil {
+		theme = &DiffTheme{}
+	}
+	hunk := &d.hunks[i]
+	var builder strings.Builder
+	builder.WriteString(paint(theme.Frag, hunk.header()))
+	builder.WriteByte('\n')
+	for i := range hunk.lines {
+		writeDiffLine(&builder, &hunk.lines[i], theme)
+	}
+	return builder.String()
+}
+
+// Format returns all lines of d, including unchanged lines, each prefixed as in
+// unified diff format and painted with theme's colors.
+func (d *PartialDiff) Format(theme *DiffTheme) string {
+	if theme == nil {
+		theme = &DiffTheme{}
+	}
+	var builder strings.Builder
+	for i := range d.lines {
+		writeDiffLine(&builder, &d.lines[i], theme)
+	}
+	return builder.String()
+}
+
+// Len returns the number of hunks in d.
+func (d *PartialDiff) Len() int {
+	return len(d.hunks)
+}
+
+// writeDiffLine writes line to builder in unified diff format, painted with
+// theme's colors.
+func writeDiffLine(builder *strings.Builder, line *diffLine, theme *DiffTheme) {
+	switch line.op {
+	case diff.Delete:
+		builder.WriteString(paint(theme.Old, "-"+line.text))
+	case diff.Add:
+		builder.WriteString(paint(theme.New, "+"+line.text))
+	default:
+		builder.WriteString(" " + line.text)
+	}
+	builder.WriteByte('\n')
+	if line.noNewline {
+		builder.WriteString("\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,72 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestPartialDiff(t *testing.T) {
+	from := chezmoitest.JoinLines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12")
+	to := chezmoitest.JoinLines("1", "two", "3", "4", "5", "6", "7", "8", "9", "10", "11", "twelve", "13")
+	partialDiff := NewPartialDiff([]byte(from), []byte(to))
+	assert.Equal(t, 2, partialDiff.Len())
+	assert.Equal(t, chezmoitest.JoinLines(
+		"@@ -1,5 +1,5 @@",
+		" 1",
+		"-2",
+		"+two",
+		" 3",
+		" 4",
+		" 5",
+	), partialDiff.FormatHunk(0, nil))
+
+	for _, tc := range []struct {
+		name     string
+		selected []bool
+		expected string
+	}{
+		{
+			name:     "none",
+			selected: []bool{false, false},
+			expected: from,
+		},
+		{
+			name:     "first",
+			selected: []bool{true, false},
+			expected: chezmoitest.JoinLines("1", "two", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"),
+		},
+		{
+			name:     "second",
+			selected: []bool{false, true},
+			expected: chezmoitest.JoinLines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "twelve", "13"),
+		},
+		{
+			name:     "all",
+			selected: []bool{true, true},
+			expected: to,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(partialDiff.Apply(tc.selected)))
+		})
+	}
+}
+
+func TestPartialDiffFormat(t *testing.T) {
+	from := chezmoitest.JoinLines("1", "2", "3")
+	to := chezmoitest.JoinLines("1", "two", "3", "4")
+	assert.Equal(t, chezmoitest.JoinLines(
+		" 1",
+		"-2",
+		"+two",
+		" 3",
+		"+4",
+	), NewPartialDiff([]byte(from), []byte(to)).Format(nil))
+}
+
+func TestPartialDiffBinary(t *testing.T) {
+	assert.Zero(t, NewPartialDiff([]byte("GIF89a"), []byte("text\n")))
+}
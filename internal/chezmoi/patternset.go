@@ -95,30 +95,49 @@ func (ps *patternSet) glob(fileSystem vfs.FS, prefix string) ([]string, error) {
 
 // match returns if name matches ps.
 func (ps *patternSet) match(name string) patternSetMatchType {
+	matchType, _ := ps.matchPattern(name)
+	return matchType
+}
+
+// matchPattern returns if name matches ps and the pattern that determined the
+// match. If several patterns match then the lexically smallest is returned. The
+// pattern is empty if name did not match any pattern.
+func (ps *patternSet) matchPattern(name string) (patternSetMatchType, string) {
 	// If name is explicitly excluded, then return exclude.
-	for pattern := range ps.excludePatterns {
-		if ok, _ := doublestar.Match(pattern, name); ok {
-			return patternSetMatchExclude
-		}
+	if pattern := firstMatchingPattern(ps.excludePatterns, name); pattern != "" {
+		return patternSetMatchExclude, pattern
 	}
 
 	// If name is explicitly included, then return include.
-	for pattern := range ps.includePatterns {
-		if ok, _ := doublestar.Match(pattern, name); ok {
-			return patternSetMatchInclude
-		}
+	if pattern := firstMatchingPattern(ps.includePatterns, name); pattern != "" {
+		return patternSetMatchInclude, pattern
 	}
 
 	// If name did not match any include or exclude patterns...
 	switch {
 	case len(ps.includePatterns) > 0 && len(ps.excludePatterns) == 0:
 		// ...only include patterns were specified, so exclude by default.
-		return patternSetMatchExclude
+		return patternSetMatchExclude, ""
 	case len(ps.includePatterns) == 0 && len(ps.excludePatterns) > 0:
 		// ...only exclude patterns were specified, so include by default.
-		return patternSetMatchInclude
+		return patternSetMatchInclude, ""
 	default:
 		// ...both include and exclude were specified, so return unknown.
-		return patternSetMatchUnknown
+		return patternSetMatchUnknown, ""
+	}
+}
+
+// firstMatchingPattern returns the lexically smallest pattern in patterns that
+// matches name, or the empty string if no pattern matches.
+func firstMatchingPattern(patterns set[string], name string) string {
+	var firstPattern string
+	for pattern := range patterns {
+		if firstPattern != "" && pattern >= firstPattern {
+			continue
+		}
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			firstPattern = pattern
+		}
 	}
+	return firstPattern
 }
@@ -66,6 +66,17 @@ func TestPatternSet(t *testing.T) {
 				"baz/bar/foo": patternSetMatchInclude,
 			},
 		},
+		{
+			name: "braces",
+			ps: mustNewPatternSet(t, map[string]patternSetIncludeType{
+				"{foo,bar}": patternSetInclude,
+			}),
+			expectMatches: map[string]patternSetMatchType{
+				"foo": patternSetMatchInclude,
+				"bar": patternSetMatchInclude,
+				"baz": patternSetMatchExclude,
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			for s, expectMatch := range tc.expectMatches {
@@ -75,6 +86,47 @@ func TestPatternSet(t *testing.T) {
 	}
 }
 
+func TestPatternSetMatchPattern(t *testing.T) {
+	ps := mustNewPatternSet(t, map[string]patternSetIncludeType{
+		"b*":    patternSetInclude,
+		"ba?":   patternSetInclude,
+		"baz":   patternSetExclude,
+		"qu{x}": patternSetInclude,
+	})
+	for _, tc := range []struct {
+		name              string
+		expectedMatchType patternSetMatchType
+		expectedPattern   string
+	}{
+		{
+			name:              "bar",
+			expectedMatchType: patternSetMatchInclude,
+			expectedPattern:   "b*",
+		},
+		{
+			name:              "baz",
+			expectedMatchType: patternSetMatchExclude,
+			expectedPattern:   "baz",
+		},
+		{
+			name:              "qux",
+			expectedMatchType: patternSetMatchInclude,
+			expectedPattern:   "qu{x}",
+		},
+		{
+			name:              "foo",
+			expectedMatchType: patternSetMatchUnknown,
+			expectedPattern:   "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualMatchType, actualPattern := ps.matchPattern(tc.name)
+			assert.Equal(t, tc.expectedMatchType, actualMatchType)
+			assert.Equal(t, tc.expectedPattern, actualPattern)
+		})
+	}
+}
+
 func TestPatternSetGlob(t *testing.T) {
 	for _, tc := range []struct {
 		name            string
@@ -1,5 +1,10 @@
 package chezmoi
 
+import (
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
 var (
 	// ConfigStateBucket is the bucket for recording the config state.
 	ConfigStateBucket = []byte("configState")
@@ -11,10 +16,21 @@ var (
 	// that modify directories.
 	GitRepoExternalStateBucket = []byte("gitRepoExternalState")
 
+	// ScriptLogBucket is the bucket for recording the outcome and output of
+	// scripts.
+	ScriptLogBucket = []byte("scriptLog")
+
+	// ScriptScheduleBucket is the bucket for recording when run every scripts
+	// were last run.
+	ScriptScheduleBucket = []byte("scriptSchedule")
+
 	// ScriptStateBucket is the bucket for recording the state of run once
 	// scripts.
 	ScriptStateBucket = []byte("scriptState")
 
+	// TrashStateBucket is the bucket for recording entries moved to the trash.
+	TrashStateBucket = []byte("trashState")
+
 	stateFormat = formatJSON{}
 )
 
@@ -46,6 +62,31 @@ func PersistentStateBucketData(s PersistentState, bucket []byte) (map[string]any
 	return result, nil
 }
 
+// A SharedPersistentState is a PersistentState that is shared between
+// machines. It supports locks so that an action is only performed by one
+// machine at a time.
+type SharedPersistentState interface {
+	PersistentState
+
+	// TryLock tries to take the lock name. It returns false if the lock is
+	// already held.
+	TryLock(name string) (bool, error)
+
+	// Unlock releases the lock name.
+	Unlock(name string) error
+}
+
+// PersistentStateBuckets returns the sorted names of the buckets in s.
+func PersistentStateBuckets(s PersistentState) ([]string, error) {
+	mockPersistentState := NewMockPersistentState()
+	if err := s.CopyTo(mockPersistentState); err != nil {
+		return nil, err
+	}
+	buckets := maps.Keys(mockPersistentState.buckets)
+	slices.Sort(buckets)
+	return buckets, nil
+}
+
 // PersistentStateData returns the structured data in s.
 func PersistentStateData(s PersistentState, buckets map[string][]byte) (map[string]any, error) {
 	result := make(map[string]any)
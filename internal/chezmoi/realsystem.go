@@ -2,6 +2,7 @@ package chezmoi
 
 import (
 	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
@@ -18,6 +19,10 @@ import (
 // A RealSystemOption sets an option on a RealSystem.
 type RealSystemOption func(*RealSystem)
 
+// An OpenPTYFunc opens a pseudo-terminal with the same size as terminal. It
+// returns nil files if terminal is not a terminal.
+type OpenPTYFunc func(terminal *os.File) (pty, tty *os.File, err error)
+
 // Chtimes implements System.Chtimes.
 func (s *RealSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
 	return s.fileSystem.Chtimes(name.String(), atime, mtime)
@@ -84,6 +89,12 @@ func (s *RealSystem) RunCmd(cmd *exec.Cmd) error {
 
 // RunScript implements System.RunScript.
 func (s *RealSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, options RunScriptOptions) (err error) {
+	if options.PreRunFunc != nil {
+		if err = options.PreRunFunc(); err != nil {
+			return
+		}
+	}
+
 	// Create the script temporary directory, if needed.
 	s.createScriptTempDirOnce.Do(func() {
 		if !s.scriptTempDir.Empty() {
@@ -123,11 +134,56 @@ func (s *RealSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, opt
 	if err != nil {
 		return err
 	}
+	if len(options.Env) != 0 {
+		cmd.Env = append(os.Environ(), options.Env...)
+	}
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	var closeStdout, closeStderr func() error
+	if cmd.Stdout, closeStdout, err = s.scriptOutput(os.Stdout, options.Stdout); err != nil {
+		return err
+	}
+	if cmd.Stderr, closeStderr, err = s.scriptOutput(os.Stderr, options.Stderr); err != nil {
+		return chezmoierrors.Combine(err, closeStdout())
+	}
+
+	err = s.RunCmd(cmd)
+	return chezmoierrors.Combine(err, closeStdout(), closeStderr())
+}
 
-	return s.RunCmd(cmd)
+// scriptOutput returns the writer for a script's output stream that writes to
+// terminal and, if capture is not nil, also to capture. If terminal is a
+// terminal and s can open pseudo-terminals then the script writes to a
+// pseudo-terminal so that programs that check for a terminal, for example to
+// print colors or progress bars, behave as if their output was not captured.
+// The returned function must be called after the script exits.
+func (s *RealSystem) scriptOutput(terminal *os.File, capture io.Writer) (io.Writer, func() error, error) {
+	noop := func() error { return nil }
+	if capture == nil {
+		return terminal, noop, nil
+	}
+	if s.openPTYFunc == nil {
+		return io.MultiWriter(terminal, capture), noop, nil
+	}
+	pty, tty, err := s.openPTYFunc(terminal)
+	switch {
+	case err != nil:
+		return nil, nil, err
+	case pty == nil:
+		return io.MultiWriter(terminal, capture), noop, nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Reading from the pseudo-terminal returns an error once the script
+		// and all its children have closed it, which marks the end of the
+		// output.
+		_, _ = io.Copy(io.MultiWriter(terminal, capture), pty)
+	}()
+	return tty, func() error {
+		err := tty.Close()
+		<-done
+		return chezmoierrors.Combine(err, pty.Close())
+	}, nil
 }
 
 // Stat implements System.Stat.
@@ -1,8 +1,10 @@
 package chezmoi
 
 import (
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
@@ -69,3 +71,45 @@ func pathsToSlashes(paths []string) []string {
 	}
 	return result
 }
+
+func TestRealSystemScriptOutput(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		openPTYFunc OpenPTYFunc
+	}{
+		{
+			name: "no_pty",
+		},
+		{
+			name: "not_a_terminal",
+			openPTYFunc: func(terminal *os.File) (*os.File, *os.File, error) {
+				return nil, nil, nil
+			},
+		},
+		{
+			name: "pty",
+			openPTYFunc: func(terminal *os.File) (*os.File, *os.File, error) {
+				return os.Pipe()
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			terminal, err := os.Create(filepath.Join(t.TempDir(), "terminal"))
+			assert.NoError(t, err)
+			defer terminal.Close()
+
+			system := NewRealSystem(vfs.OSFS, RealSystemWithOpenPTYFunc(tc.openPTYFunc))
+			capture := &strings.Builder{}
+			w, closeFunc, err := system.scriptOutput(terminal, capture)
+			assert.NoError(t, err)
+			_, err = w.Write([]byte("output\n"))
+			assert.NoError(t, err)
+			assert.NoError(t, closeFunc())
+
+			assert.Equal(t, "output\n", capture.String())
+			data, err := os.ReadFile(terminal.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, "output\n", string(data))
+		})
+	}
+}
@@ -19,12 +19,21 @@ import (
 type RealSystem struct {
 	fileSystem              vfs.FS
 	safe                    bool
+	openPTYFunc             OpenPTYFunc
 	createScriptTempDirOnce sync.Once
 	scriptTempDir           AbsPath
 	devCache                map[AbsPath]uint // devCache maps directories to device numbers.
 	tempDirCache            map[uint]string  // tempDirCache maps device numbers to renameio temporary directories.
 }
 
+// RealSystemWithOpenPTYFunc sets the function that the RealSystem uses to open
+// pseudo-terminals for the captured output of scripts.
+func RealSystemWithOpenPTYFunc(openPTYFunc OpenPTYFunc) RealSystemOption {
+	return func(s *RealSystem) {
+		s.openPTYFunc = openPTYFunc
+	}
+}
+
 // RealSystemWithSafe sets the safe flag of the RealSystem.
 func RealSystemWithSafe(safe bool) RealSystemOption {
 	return func(s *RealSystem) {
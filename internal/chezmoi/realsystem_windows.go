@@ -12,11 +12,20 @@ import (
 // An RealSystem is a System that writes to a filesystem and executes scripts.
 type RealSystem struct {
 	fileSystem              vfs.FS
+	openPTYFunc             OpenPTYFunc
 	createScriptTempDirOnce sync.Once
 	scriptEnv               []string
 	scriptTempDir           AbsPath
 }
 
+// RealSystemWithOpenPTYFunc sets the function that the RealSystem uses to open
+// pseudo-terminals for the captured output of scripts.
+func RealSystemWithOpenPTYFunc(openPTYFunc OpenPTYFunc) RealSystemOption {
+	return func(s *RealSystem) {
+		s.openPTYFunc = openPTYFunc
+	}
+}
+
 // RealSystemWithSafe sets the safe flag of the RealSystem. On Windows it does
 // nothing as Windows does not support atomic file or symlink updates. See
 // https://github.com/google/renameio/issues/1 and
@@ -94,6 +94,11 @@ func (p RelPath) MarshalJSON() ([]byte, error) {
 	return FormatJSON.Marshal(p.relPath)
 }
 
+// MarshalText implements encoding.TextMarshaler.MarshalText.
+func (p RelPath) MarshalText() ([]byte, error) {
+	return []byte(p.relPath), nil
+}
+
 // Slice returns a part of p.
 func (p RelPath) Slice(begin, end int) RelPath {
 	return NewRelPath(p.relPath[begin:end])
@@ -139,3 +144,9 @@ func (p RelPath) TrimDirPrefix(dirPrefix RelPath) (RelPath, error) {
 	}
 	return p.Slice(dirPrefix.Len()+1, p.Len()), nil
 }
+
+// UnmarshalText implements encoding.TextUnmarshaler.UnmarshalText.
+func (p *RelPath) UnmarshalText(text []byte) error {
+	*p = NewRelPath(string(text))
+	return nil
+}
@@ -0,0 +1,352 @@
+package chezmoi
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Markers that delimit the output of a template's text nodes when rendering
+// templates. The output of each text node is preceded by
+// renderedTemplateMarker, the index of the text node, and
+// renderedTemplateStartMarker, and followed by renderedTemplateMarker and
+// renderedTemplateEndMarker.
+const (
+	renderedTemplateMarker      = '\x00'
+	renderedTemplateStartMarker = '\x01'
+	renderedTemplateEndMarker   = '\x02'
+)
+
+var errRenderedTemplateMarkers = errors.New("cannot determine the origin of template output")
+
+// A RenderedTemplate is the output of a template, annotated with the parts of
+// the output that were copied verbatim from the template.
+type RenderedTemplate struct {
+	data              []byte
+	directiveMatches  [][]int
+	contents          []byte
+	spans             []renderedTemplateSpan
+	textNodeOffsets   []int
+	textNodeTexts     [][]byte
+	textNodeEmissions []int
+}
+
+// A renderedTemplateSpan is a part of a template's output that was copied
+// verbatim from a text node in the template.
+type renderedTemplateSpan struct {
+	start, end int // Offsets in the output.
+	offset     int // Offset of the text node in the template without directives.
+}
+
+// A TemplateConflict is a change to a template's output that cannot be
+// back-propagated to the template because it changes output generated by a
+// template action.
+type TemplateConflict struct {
+	Line int    // The line in the edited output.
+	Old  string // The output that was removed.
+	New  string // The output that was inserted.
+}
+
+// A templateEdit is a change to a template's output.
+type templateEdit struct {
+	start, end int    // Offsets of the changed output.
+	line       int    // Line of the change in the edited output.
+	text       string // Replacement text.
+}
+
+// RenderTemplateData executes the template data like ExecuteTemplateData and
+// returns the output annotated with the parts that were copied verbatim from
+// data.
+func (s *SourceState) RenderTemplateData(options ExecuteTemplateDataOptions) (*RenderedTemplate, error) {
+	if bytes.IndexByte(options.Data, renderedTemplateMarker) != -1 {
+		return nil, errRenderedTemplateMarkers
+	}
+
+	r := &RenderedTemplate{
+		data:             options.Data,
+		directiveMatches: templateDirectiveRx.FindAllIndex(options.Data, -1),
+	}
+
+	// Mark the output of all text nodes in the template, but not in any
+	// templates in .chezmoitemplates.
+	output, err := s.executeTemplateData(options, func(tmpl *Template) error {
+		contents := options.Data
+		if len(r.directiveMatches) > 0 {
+			contents = removeMatches(options.Data, r.directiveMatches)
+		}
+		for _, t := range tmpl.template.Templates() {
+			if t.Tree != nil {
+				r.markTextNodes(contents, t.Tree.Root)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.parseOutput(output); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Contents returns the output of the template.
+func (r *RenderedTemplate) Contents() []byte {
+	return r.contents
+}
+
+// BackPropagate returns the template modified so that its output includes the
+// changes in edited. Changes to output that was not copied verbatim from a
+// single place in the template are not back-propagated and are returned as
+// conflicts.
+func (r *RenderedTemplate) BackPropagate(edited []byte) ([]byte, []TemplateConflict) {
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Second
+
+	// Find the changed lines, and then the changes within each line, so that
+	// changes on different lines are back-propagated independently.
+	var edits []templateEdit
+	offset := 0
+	line := 1
+	var oldLines, newLines []string
+	flush := func() {
+		if len(oldLines) == len(newLines) {
+			for i := range oldLines {
+				edits = append(edits, diffTemplateEdits(dmp, offset, line, oldLines[i], newLines[i])...)
+				offset += len(oldLines[i])
+				line++
+			}
+		} else {
+			oldText, newText := strings.Join(oldLines, ""), strings.Join(newLines, "")
+			edits = append(edits, diffTemplateEdits(dmp, offset, line, oldText, newText)...)
+			offset += len(oldText)
+			line += len(newLines)
+		}
+		oldLines, newLines = nil, nil
+	}
+	fromRunes, toRunes, runesToLines := dmp.DiffLinesToRunes(string(r.contents), string(edited))
+	for _, diff := range dmp.DiffCharsToLines(dmp.DiffMainRunes(fromRunes, toRunes, false), runesToLines) {
+		lines := strings.SplitAfter(diff.Text, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			oldLines = append(oldLines, lines...)
+		case diffmatchpatch.DiffInsert:
+			newLines = append(newLines, lines...)
+		case diffmatchpatch.DiffEqual:
+			flush()
+			offset += len(diff.Text)
+			line += len(lines)
+		}
+	}
+	flush()
+
+	// Apply the edits that are within a single span to the template, last
+	// first so that earlier offsets remain valid.
+	data := append([]byte(nil), r.data...)
+	var conflicts []TemplateConflict
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		start, end, ok := r.dataOffsets(edit.start, edit.end)
+		if !ok {
+			conflicts = append(conflicts, TemplateConflict{
+				Line: edit.line,
+				Old:  string(r.contents[edit.start:edit.end]),
+				New:  edit.text,
+			})
+			continue
+		}
+		data = append(data[:start], append([]byte(edit.text), data[end:]...)...)
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Line < conflicts[j].Line
+	})
+	return data, conflicts
+}
+
+// diffTemplateEdits returns the edits that change oldText, which starts at
+// offset in the output and line in the edited output, into newText.
+func diffTemplateEdits(dmp *diffmatchpatch.DiffMatchPatch, offset, line int, oldText, newText string) []templateEdit {
+	var edits []templateEdit
+	var edit *templateEdit
+	for _, diff := range dmp.DiffCleanupSemantic(dmp.DiffMain(oldText, newText, false)) {
+		if diff.Type == diffmatchpatch.DiffEqual {
+			if edit != nil {
+				edits = append(edits, *edit)
+				edit = nil
+			}
+			offset += len(diff.Text)
+			line += strings.Count(diff.Text, "\n")
+			continue
+		}
+		if edit == nil {
+			edit = &templateEdit{
+				start: offset,
+				end:   offset,
+				line:  line,
+			}
+		}
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			offset += len(diff.Text)
+			edit.end = offset
+		case diffmatchpatch.DiffInsert:
+			edit.text += diff.Text
+			line += strings.Count(diff.Text, "\n")
+		}
+	}
+	if edit != nil {
+		edits = append(edits, *edit)
+	}
+	return edits
+}
+
+// dataOffsets returns the offsets in the template data corresponding to the
+// output between start and end, and whether they could be determined.
+func (r *RenderedTemplate) dataOffsets(start, end int) (int, int, bool) {
+	for _, span := range r.spans {
+		if start < span.start || span.end < end {
+			continue
+		}
+		dataStart := r.dataOffset(span.offset + start - span.start)
+		dataEnd := r.dataOffset(span.offset + end - span.start)
+		if start != end && dataEnd-dataStart != end-start {
+			// The change spans a removed directive.
+			return 0, 0, false
+		}
+		if start == end {
+			dataEnd = dataStart
+		}
+		return dataStart, dataEnd, true
+	}
+	return 0, 0, false
+}
+
+// dataOffset returns the offset in the template data corresponding to offset in
+// the template data with directives removed.
+func (r *RenderedTemplate) dataOffset(offset int) int {
+	removed := 0
+	for _, match := range r.directiveMatches {
+		if offset < match[0]-removed {
+			break
+		}
+		removed += match[1] - match[0]
+	}
+	return offset + removed
+}
+
+// markTextNodes marks the output of all text nodes in node. contents is the
+// text of the template that was parsed.
+func (r *RenderedTemplate) markTextNodes(contents []byte, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			r.markTextNodes(contents, n)
+		}
+	case *parse.IfNode:
+		r.markTextNodes(contents, node.List)
+		r.markTextNodes(contents, node.ElseList)
+	case *parse.RangeNode:
+		r.markTextNodes(contents, node.List)
+		r.markTextNodes(contents, node.ElseList)
+	case *parse.WithNode:
+		r.markTextNodes(contents, node.List)
+		r.markTextNodes(contents, node.ElseList)
+	case *parse.TextNode:
+		// Only mark text nodes whose text can be found in the template.
+		offset := int(node.Pos)
+		if offset+len(node.Text) > len(contents) || !bytes.Equal(contents[offset:offset+len(node.Text)], node.Text) {
+			return
+		}
+		index := len(r.textNodeOffsets)
+		r.textNodeOffsets = append(r.textNodeOffsets, offset)
+		r.textNodeTexts = append(r.textNodeTexts, node.Text)
+		r.textNodeEmissions = append(r.textNodeEmissions, 0)
+		text := make([]byte, 0, len(node.Text)+16)
+		text = append(text, renderedTemplateMarker)
+		text = strconv.AppendInt(text, int64(index), 10)
+		text = append(text, renderedTemplateStartMarker)
+		text = append(text, node.Text...)
+		text = append(text, renderedTemplateMarker, renderedTemplateEndMarker)
+		node.Text = text
+	}
+}
+
+// parseOutput sets r's contents and spans from output, which contains
+// markers.
+func (r *RenderedTemplate) parseOutput(output []byte) error {
+	type markedSpan struct {
+		renderedTemplateSpan
+		index int
+	}
+	var markedSpans []markedSpan
+	contents := make([]byte, 0, len(output))
+	index := -1
+	start := 0
+	for {
+		i := bytes.IndexByte(output, renderedTemplateMarker)
+		if i == -1 {
+			if index != -1 {
+				return errRenderedTemplateMarkers
+			}
+			contents = append(contents, output...)
+			break
+		}
+		contents = append(contents, output[:i]...)
+		output = output[i+1:]
+		switch {
+		case index == -1:
+			j := bytes.IndexByte(output, renderedTemplateStartMarker)
+			if j == -1 {
+				return errRenderedTemplateMarkers
+			}
+			var err error
+			index, err = strconv.Atoi(string(output[:j]))
+			if err != nil || index < 0 || index >= len(r.textNodeOffsets) {
+				return errRenderedTemplateMarkers
+			}
+			output = output[j+1:]
+			start = len(contents)
+		case len(output) > 0 && output[0] == renderedTemplateEndMarker:
+			output = output[1:]
+			markedSpans = append(markedSpans, markedSpan{
+				renderedTemplateSpan: renderedTemplateSpan{
+					start:  start,
+					end:    len(contents),
+					offset: r.textNodeOffsets[index],
+				},
+				index: index,
+			})
+			r.textNodeEmissions[index]++
+			index = -1
+		default:
+			return errRenderedTemplateMarkers
+		}
+	}
+
+	// Only keep spans whose text nodes were output exactly once and whose
+	// output was not modified.
+	for _, markedSpan := range markedSpans {
+		if r.textNodeEmissions[markedSpan.index] != 1 {
+			continue
+		}
+		if !bytes.Equal(contents[markedSpan.start:markedSpan.end], r.textNodeTexts[markedSpan.index]) {
+			continue
+		}
+		r.spans = append(r.spans, markedSpan.renderedTemplateSpan)
+	}
+	r.contents = contents
+	return nil
+}
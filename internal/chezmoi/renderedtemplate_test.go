@@ -0,0 +1,167 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestRenderedTemplateBackPropagate(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		dataStr           string
+		editedStr         string
+		expectedRendered  string
+		expectedDataStr   string
+		expectedConflicts []TemplateConflict
+	}{
+		{
+			name: "literal",
+			dataStr: chezmoitest.JoinLines(
+				"hello {{ .name }}",
+				"foo",
+			),
+			editedStr: chezmoitest.JoinLines(
+				"hello world",
+				"bar",
+			),
+			expectedRendered: chezmoitest.JoinLines(
+				"hello world",
+				"foo",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"hello {{ .name }}",
+				"bar",
+			),
+		},
+		{
+			name: "insert",
+			dataStr: chezmoitest.JoinLines(
+				"hello {{ .name }}",
+			),
+			editedStr: chezmoitest.JoinLines(
+				"hello world",
+				"goodbye",
+			),
+			expectedRendered: chezmoitest.JoinLines(
+				"hello world",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"hello {{ .name }}",
+				"goodbye",
+			),
+		},
+		{
+			name: "action_conflict",
+			dataStr: chezmoitest.JoinLines(
+				"hello {{ .name }}",
+				"foo",
+			),
+			editedStr: chezmoitest.JoinLines(
+				"hello there",
+				"bar",
+			),
+			expectedRendered: chezmoitest.JoinLines(
+				"hello world",
+				"foo",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"hello {{ .name }}",
+				"bar",
+			),
+			expectedConflicts: []TemplateConflict{
+				{Line: 1, Old: "world", New: "there"},
+			},
+		},
+		{
+			name: "if",
+			dataStr: chezmoitest.JoinLines(
+				`{{ if eq .name "world" }}`,
+				"foo",
+				"{{ end }}",
+			),
+			editedStr: chezmoitest.JoinLines(
+				"",
+				"bar",
+				"",
+			),
+			expectedRendered: chezmoitest.JoinLines(
+				"",
+				"foo",
+				"",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				`{{ if eq .name "world" }}`,
+				"bar",
+				"{{ end }}",
+			),
+		},
+		{
+			name: "range_conflict",
+			dataStr: chezmoitest.JoinLines(
+				"{{ range .items }}",
+				"item",
+				"{{- end }}",
+			),
+			editedStr: chezmoitest.JoinLines(
+				"",
+				"item",
+				"thing",
+			),
+			expectedRendered: chezmoitest.JoinLines(
+				"",
+				"item",
+				"item",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"{{ range .items }}",
+				"item",
+				"{{- end }}",
+			),
+			expectedConflicts: []TemplateConflict{
+				{Line: 3, Old: "item", New: "thing"},
+			},
+		},
+		{
+			name: "directive",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:template:left-delimiter=[[ right-delimiter=]]",
+				"hello [[ .name ]]",
+				"foo",
+			),
+			editedStr: chezmoitest.JoinLines(
+				"hello world",
+				"bar",
+			),
+			expectedRendered: chezmoitest.JoinLines(
+				"hello world",
+				"foo",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# chezmoi:template:left-delimiter=[[ right-delimiter=]]",
+				"hello [[ .name ]]",
+				"bar",
+			),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewSourceState(
+				WithPriorityTemplateData(map[string]any{
+					"items": []any{"a", "b"},
+					"name":  "world",
+				}),
+			)
+			renderedTemplate, err := s.RenderTemplateData(ExecuteTemplateDataOptions{
+				Name: tc.name,
+				Data: []byte(tc.dataStr),
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRendered, string(renderedTemplate.Contents()))
+			actualData, actualConflicts := renderedTemplate.BackPropagate([]byte(tc.editedStr))
+			assert.Equal(t, tc.expectedDataStr, string(actualData))
+			assert.Equal(t, tc.expectedConflicts, actualConflicts)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package chezmoi
+
+import (
+	"errors"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// scriptLogKeyTimeFormat is the format of the time in script log keys. It has
+// a fixed width so that keys sort chronologically.
+const scriptLogKeyTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// A ScriptLogEntry records a single run of a script.
+type ScriptLogEntry struct {
+	Name      RelPath   `json:"name"             yaml:"name"`
+	StartedAt time.Time `json:"startedAt"        yaml:"startedAt"`
+	Duration  Duration  `json:"duration"         yaml:"duration"`
+	ExitCode  int       `json:"exitCode"         yaml:"exitCode"`
+	Attempts  int       `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	Error     string    `json:"error,omitempty"  yaml:"error,omitempty"`
+	Stdout    string    `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+	Stderr    string    `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+}
+
+// ScriptLogOptions are options for recording script runs.
+type ScriptLogOptions struct {
+	CaptureOutput bool
+	MaxEntries    int
+	MaxOutputSize int
+}
+
+// A tailWriter is an io.Writer that keeps only the last max bytes written to
+// it.
+type tailWriter struct {
+	max  int
+	data []byte
+}
+
+// newScriptLogEntry returns a new ScriptLogEntry for a run of the script name
+// started at startedAt that returned err.
+func newScriptLogEntry(name RelPath, startedAt time.Time, err error) *ScriptLogEntry {
+	scriptLogEntry := &ScriptLogEntry{
+		Name:      name,
+		StartedAt: startedAt,
+		Duration:  Duration(time.Since(startedAt).Round(time.Millisecond)),
+	}
+	if err != nil {
+		scriptLogEntry.Error = err.Error()
+		scriptLogEntry.ExitCode = -1
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			scriptLogEntry.ExitCode = exitError.ExitCode()
+		}
+	}
+	return scriptLogEntry
+}
+
+// Failed returns true if e records a failed run.
+func (e *ScriptLogEntry) Failed() bool {
+	return e.Error != ""
+}
+
+// key returns e's key in ScriptLogBucket.
+func (e *ScriptLogEntry) key() []byte {
+	return []byte(e.StartedAt.UTC().Format(scriptLogKeyTimeFormat) + " " + e.Name.String())
+}
+
+// ScriptLogEntries returns all the entries in the script log in
+// persistentState, oldest first.
+func ScriptLogEntries(persistentState PersistentState) ([]*ScriptLogEntry, error) {
+	var scriptLogEntries []*ScriptLogEntry
+	if err := persistentState.ForEach(ScriptLogBucket, func(k, v []byte) error {
+		var scriptLogEntry ScriptLogEntry
+		if err := stateFormat.Unmarshal(v, &scriptLogEntry); err != nil {
+			return err
+		}
+		scriptLogEntries = append(scriptLogEntries, &scriptLogEntry)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(scriptLogEntries, func(i, j int) bool {
+		return scriptLogEntries[i].StartedAt.Before(scriptLogEntries[j].StartedAt)
+	})
+	return scriptLogEntries, nil
+}
+
+// addScriptLogEntry adds scriptLogEntry to the script log in persistentState
+// and then removes the oldest entries so that at most maxEntries remain. If
+// maxEntries is zero or negative then the script log is not pruned.
+func addScriptLogEntry(persistentState PersistentState, scriptLogEntry *ScriptLogEntry, maxEntries int) error {
+	if err := PersistentStateSet(persistentState, ScriptLogBucket, scriptLogEntry.key(), scriptLogEntry); err != nil {
+		return err
+	}
+	if maxEntries <= 0 {
+		return nil
+	}
+	scriptLogEntries, err := ScriptLogEntries(persistentState)
+	if err != nil {
+		return err
+	}
+	if len(scriptLogEntries) <= maxEntries {
+		return nil
+	}
+	for _, scriptLogEntry := range scriptLogEntries[:len(scriptLogEntries)-maxEntries] {
+		if err := persistentState.Delete(ScriptLogBucket, scriptLogEntry.key()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTailWriter returns a new tailWriter that keeps the last max bytes written
+// to it. If max is zero or negative then all bytes are kept.
+func newTailWriter(max int) *tailWriter {
+	return &tailWriter{
+		max: max,
+	}
+}
+
+// String returns the bytes kept by w.
+func (w *tailWriter) String() string {
+	return string(w.data)
+}
+
+// Write implements io.Writer.Write.
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.data = append(w.data, p...)
+	if w.max > 0 && len(w.data) > w.max {
+		w.data = append(w.data[:0], w.data[len(w.data)-w.max:]...)
+	}
+	return len(p), nil
+}
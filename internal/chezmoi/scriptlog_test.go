@@ -0,0 +1,114 @@
+package chezmoi
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestScriptLog(t *testing.T) {
+	persistentState := NewMockPersistentState()
+
+	startedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, name := range []string{"a.sh", "b.sh", "c.sh", "d.sh"} {
+		var err error
+		if name == "b.sh" {
+			err = errors.New("failed")
+		}
+		scriptLogEntry := newScriptLogEntry(NewRelPath(name), startedAt.Add(time.Duration(i)*time.Second), err)
+		scriptLogEntry.Stdout = name + " stdout\n"
+		scriptLogEntry.Stderr = name + " stderr\n"
+		assert.NoError(t, addScriptLogEntry(persistentState, scriptLogEntry, 0))
+	}
+
+	scriptLogEntries, err := ScriptLogEntries(persistentState)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(scriptLogEntries))
+	assert.Equal(t, NewRelPath("a.sh"), scriptLogEntries[0].Name)
+	assert.False(t, scriptLogEntries[0].Failed())
+	assert.Equal(t, "a.sh stdout\n", scriptLogEntries[0].Stdout)
+	assert.Equal(t, "a.sh stderr\n", scriptLogEntries[0].Stderr)
+	assert.Equal(t, NewRelPath("b.sh"), scriptLogEntries[1].Name)
+	assert.True(t, scriptLogEntries[1].Failed())
+	assert.Equal(t, -1, scriptLogEntries[1].ExitCode)
+	assert.Equal(t, "failed", scriptLogEntries[1].Error)
+
+	scriptLogEntry := newScriptLogEntry(NewRelPath("e.sh"), startedAt.Add(4*time.Second), nil)
+	assert.NoError(t, addScriptLogEntry(persistentState, scriptLogEntry, 2))
+	scriptLogEntries, err = ScriptLogEntries(persistentState)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(scriptLogEntries))
+	assert.Equal(t, NewRelPath("d.sh"), scriptLogEntries[0].Name)
+	assert.Equal(t, NewRelPath("e.sh"), scriptLogEntries[1].Name)
+}
+
+func TestScriptLogEntryExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("UNIX only")
+	}
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	assert.Error(t, err)
+	scriptLogEntry := newScriptLogEntry(NewRelPath("script.sh"), time.Now(), err)
+	assert.True(t, scriptLogEntry.Failed())
+	assert.Equal(t, 3, scriptLogEntry.ExitCode)
+}
+
+func TestScriptLogEntryMarshal(t *testing.T) {
+	scriptLogEntry := &ScriptLogEntry{
+		Name:     NewRelPath("script.sh"),
+		Duration: Duration(1500 * time.Millisecond),
+	}
+	data, err := stateFormat.Marshal(scriptLogEntry)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"duration": "1.5s"`)
+	var actualScriptLogEntry ScriptLogEntry
+	assert.NoError(t, stateFormat.Unmarshal(data, &actualScriptLogEntry))
+	assert.Equal(t, scriptLogEntry.Duration, actualScriptLogEntry.Duration)
+}
+
+func TestTailWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		max      int
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "unlimited",
+			writes:   []string{"abc", "def"},
+			expected: "abcdef",
+		},
+		{
+			name:     "under_limit",
+			max:      8,
+			writes:   []string{"abc", "def"},
+			expected: "abcdef",
+		},
+		{
+			name:     "over_limit",
+			max:      4,
+			writes:   []string{"abc", "def"},
+			expected: "cdef",
+		},
+		{
+			name:     "single_write_over_limit",
+			max:      2,
+			writes:   []string{"abcdef"},
+			expected: "ef",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newTailWriter(tc.max)
+			for _, write := range tc.writes {
+				n, err := w.Write([]byte(write))
+				assert.NoError(t, err)
+				assert.Equal(t, len(write), n)
+			}
+			assert.Equal(t, tc.expected, w.String())
+		})
+	}
+}
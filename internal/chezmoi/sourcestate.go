@@ -20,12 +20,14 @@ import (
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"text/template"
 	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/coreos/go-semver/semver"
 	"github.com/mitchellh/copystructure"
 	"github.com/rs/zerolog"
@@ -35,6 +37,7 @@ import (
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoimaps"
 )
 
 // An ExternalType is a type of external source.
@@ -46,11 +49,14 @@ const (
 	ExternalTypeArchiveFile ExternalType = "archive-file"
 	ExternalTypeFile        ExternalType = "file"
 	ExternalTypeGitRepo     ExternalType = "git-repo"
+	ExternalTypeTemplate    ExternalType = "template"
 )
 
 var (
+	externalVersionRx               = regexp.MustCompile(`v?\d+\.\d+\.\d+`)
 	lineEndingRx                    = regexp.MustCompile(`(?m)(?:\r\n|\r|\n)`)
 	modifyTemplateRx                = regexp.MustCompile(`(?m)^.*chezmoi:modify-template.*$(?:\r?\n)?`)
+	patternsSectionConditionRx      = regexp.MustCompile(`^(\w+)(!?=)(.*)$`)
 	templateDirectiveRx             = regexp.MustCompile(`(?m)^.*?chezmoi:template:(.*)$(?:\r?\n)?`)
 	templateDirectiveKeyValuePairRx = regexp.MustCompile(`\s*(\S+)=("(?:[^"]|\\")*"|\S+)`)
 
@@ -63,6 +69,11 @@ type externalArchive struct {
 	ExtractAppleDoubleFiles bool `json:"extractAppleDoubleFiles" toml:"extractAppleDoubleFiles" yaml:"extractAppleDoubleFiles"`
 }
 
+type externalBasicAuth struct {
+	Username string `json:"username" toml:"username" yaml:"username"`
+	Password string `json:"password" toml:"password" yaml:"password"`
+}
+
 type externalChecksum struct {
 	MD5       HexBytes `json:"md5"       toml:"md5"       yaml:"md5"`
 	RIPEMD160 HexBytes `json:"ripemd160" toml:"ripemd160" yaml:"ripemd160"`
@@ -82,31 +93,58 @@ type externalFilter struct {
 	Args    []string `json:"args"    toml:"args"    yaml:"args"`
 }
 
+type externalPostExtract struct {
+	Args   []string `json:"args"   toml:"args"   yaml:"args"`
+	Output string   `json:"output" toml:"output" yaml:"output"`
+}
+
 type externalPull struct {
 	Args []string `json:"args" toml:"args" yaml:"args"`
 }
 
 // An External is an external source.
 type External struct {
-	Type            ExternalType     `json:"type"            toml:"type"            yaml:"type"`
-	Encrypted       bool             `json:"encrypted"       toml:"encrypted"       yaml:"encrypted"`
-	Exact           bool             `json:"exact"           toml:"exact"           yaml:"exact"`
-	Executable      bool             `json:"executable"      toml:"executable"      yaml:"executable"`
-	Checksum        externalChecksum `json:"checksum"        toml:"checksum"        yaml:"checksum"`
-	Clone           externalClone    `json:"clone"           toml:"clone"           yaml:"clone"`
-	Exclude         []string         `json:"exclude"         toml:"exclude"         yaml:"exclude"`
-	Filter          externalFilter   `json:"filter"          toml:"filter"          yaml:"filter"`
-	Format          ArchiveFormat    `json:"format"          toml:"format"          yaml:"format"`
-	Archive         externalArchive  `json:"archive"         toml:"archive"         yaml:"archive"`
-	Include         []string         `json:"include"         toml:"include"         yaml:"include"`
-	ArchivePath     string           `json:"path"            toml:"path"            yaml:"path"`
-	Pull            externalPull     `json:"pull"            toml:"pull"            yaml:"pull"`
-	RefreshPeriod   Duration         `json:"refreshPeriod"   toml:"refreshPeriod"   yaml:"refreshPeriod"`
-	StripComponents int              `json:"stripComponents" toml:"stripComponents" yaml:"stripComponents"`
-	URL             string           `json:"url"             toml:"url"             yaml:"url"`
+	Type            ExternalType        `json:"type"            toml:"type"            yaml:"type"`
+	Encrypted       bool                `json:"encrypted"       toml:"encrypted"       yaml:"encrypted"`
+	Exact           bool                `json:"exact"           toml:"exact"           yaml:"exact"`
+	Executable      bool                `json:"executable"      toml:"executable"      yaml:"executable"`
+	BasicAuth       externalBasicAuth   `json:"basicAuth"       toml:"basicAuth"       yaml:"basicAuth"`
+	Checksum        externalChecksum    `json:"checksum"        toml:"checksum"        yaml:"checksum"`
+	Clone           externalClone       `json:"clone"           toml:"clone"           yaml:"clone"`
+	Exclude         []string            `json:"exclude"         toml:"exclude"         yaml:"exclude"`
+	Filter          externalFilter      `json:"filter"          toml:"filter"          yaml:"filter"`
+	Format          ArchiveFormat       `json:"format"          toml:"format"          yaml:"format"`
+	Headers         map[string]string   `json:"headers"         toml:"headers"         yaml:"headers"`
+	Archive         externalArchive     `json:"archive"         toml:"archive"         yaml:"archive"`
+	Include         []string            `json:"include"         toml:"include"         yaml:"include"`
+	ArchivePath     string              `json:"path"            toml:"path"            yaml:"path"`
+	PostExtract     externalPostExtract `json:"postExtract"     toml:"postExtract"     yaml:"postExtract"`
+	Pull            externalPull        `json:"pull"            toml:"pull"            yaml:"pull"`
+	RefreshPeriod   Duration            `json:"refreshPeriod"   toml:"refreshPeriod"   yaml:"refreshPeriod"`
+	StripComponents int                 `json:"stripComponents" toml:"stripComponents" yaml:"stripComponents"`
+	Tags            []string            `json:"tags"            toml:"tags"            yaml:"tags"`
+	URL             string              `json:"url"             toml:"url"             yaml:"url"`
 	sourceAbsPath   AbsPath
 }
 
+// An ExternalLockEntry records the resolved URL, version, and SHA256 sum of
+// the data of an external in the external lock file.
+type ExternalLockEntry struct {
+	URL     string   `json:"url"`
+	Version string   `json:"version,omitempty"`
+	SHA256  HexBytes `json:"sha256"`
+}
+
+// A dataSource is a source of template data outside the source state.
+type dataSource struct {
+	Args          []string         `json:"args"          toml:"args"          yaml:"args"`
+	Checksum      externalChecksum `json:"checksum"      toml:"checksum"      yaml:"checksum"`
+	Command       string           `json:"command"       toml:"command"       yaml:"command"`
+	Format        string           `json:"format"        toml:"format"        yaml:"format"`
+	RefreshPeriod Duration         `json:"refreshPeriod" toml:"refreshPeriod" yaml:"refreshPeriod"`
+	URL           string           `json:"url"           toml:"url"           yaml:"url"`
+}
+
 // A SourceState is a source state.
 type SourceState struct {
 	sync.Mutex
@@ -115,11 +153,23 @@ type SourceState struct {
 	baseSystem              System
 	system                  System
 	sourceDirAbsPath        AbsPath
+	layerSourceDirAbsPaths  []AbsPath
 	destDirAbsPath          AbsPath
 	cacheDirAbsPath         AbsPath
+	linkDirAbsPath          AbsPath
+	linkGenerations         bool
+	scriptLogOptions        ScriptLogOptions
+	scriptPreRunFunc        func() error
+	sharedState             SharedPersistentState
 	umask                   fs.FileMode
+	defaultModes            DefaultModes
 	encryption              Encryption
+	ejsonKeyDir             string
+	ejsonKeyFunc            func() (string, error)
+	eventBus                *EventBus
 	ignore                  *patternSet
+	links                   *patternSet
+	tags                    map[string]*patternSet
 	remove                  *patternSet
 	interpreters            map[string]*Interpreter
 	httpClient              *http.Client
@@ -131,13 +181,26 @@ type SourceState struct {
 	readTemplateData        bool
 	readTemplates           bool
 	defaultTemplateData     map[string]any
+	dataSourceTemplateData  map[string]any
+	dirTemplateData         map[string]map[string]any
+	disabledModules         map[string]struct{}
+	modules                 map[string]*Module
+	templateDataSchema      *jsonSchema
 	userTemplateData        map[string]any
 	priorityTemplateData    map[string]any
 	templateData            map[string]any
 	templateFuncs           template.FuncMap
 	templateOptions         []string
 	templates               map[string]*Template
+	warnFunc                func(string, ...any)
+	readExternals           bool
 	externals               map[RelPath][]*External
+	dataSourceURLs          map[string]struct{}
+	externalDownloadOptions ExternalDownloadOptions
+	externalLock            map[RelPath]*ExternalLockEntry
+	externalSHA256s         map[*External][]byte
+	externalRefreshReasons  map[RelPath]string
+	ignoreExternalLock      bool
 	ignoredRelPaths         map[RelPath]struct{}
 }
 
@@ -158,6 +221,13 @@ func WithCacheDir(cacheDirAbsPath AbsPath) SourceStateOption {
 	}
 }
 
+// WithDefaultModes sets the default modes.
+func WithDefaultModes(defaultModes DefaultModes) SourceStateOption {
+	return func(s *SourceState) {
+		s.defaultModes = defaultModes
+	}
+}
+
 // WithDefaultTemplateDataFunc sets the default template data function.
 func WithDefaultTemplateDataFunc(defaultTemplateDataFunc func() map[string]any) SourceStateOption {
 	return func(s *SourceState) {
@@ -172,6 +242,13 @@ func WithDestDir(destDirAbsPath AbsPath) SourceStateOption {
 	}
 }
 
+// WithDisabledModules sets the names of the modules that are disabled.
+func WithDisabledModules(disabledModules []string) SourceStateOption {
+	return func(s *SourceState) {
+		s.disabledModules = newSet(disabledModules...)
+	}
+}
+
 // WithEncryption sets the encryption.
 func WithEncryption(encryption Encryption) SourceStateOption {
 	return func(s *SourceState) {
@@ -179,6 +256,30 @@ func WithEncryption(encryption Encryption) SourceStateOption {
 	}
 }
 
+// WithEJSONKey sets the key directory and the function that returns the key
+// used to decrypt ejson template data files. keyFunc is only called if there
+// are ejson template data files.
+func WithEJSONKey(keyDir string, keyFunc func() (string, error)) SourceStateOption {
+	return func(s *SourceState) {
+		s.ejsonKeyDir = keyDir
+		s.ejsonKeyFunc = keyFunc
+	}
+}
+
+// WithEventBus sets the event bus.
+func WithEventBus(eventBus *EventBus) SourceStateOption {
+	return func(s *SourceState) {
+		s.eventBus = eventBus
+	}
+}
+
+// WithExternalDownloadOptions sets the options for downloading externals.
+func WithExternalDownloadOptions(externalDownloadOptions ExternalDownloadOptions) SourceStateOption {
+	return func(s *SourceState) {
+		s.externalDownloadOptions = externalDownloadOptions
+	}
+}
+
 // WithHTTPClient sets the HTTP client.
 func WithHTTPClient(httpClient *http.Client) SourceStateOption {
 	return func(s *SourceState) {
@@ -186,6 +287,13 @@ func WithHTTPClient(httpClient *http.Client) SourceStateOption {
 	}
 }
 
+// WithIgnoreExternalLock sets whether to ignore the external lock file.
+func WithIgnoreExternalLock(ignoreExternalLock bool) SourceStateOption {
+	return func(s *SourceState) {
+		s.ignoreExternalLock = ignoreExternalLock
+	}
+}
+
 // WithInterpreters sets the interpreters.
 func WithInterpreters(interpreters map[string]*Interpreter) SourceStateOption {
 	return func(s *SourceState) {
@@ -193,6 +301,22 @@ func WithInterpreters(interpreters map[string]*Interpreter) SourceStateOption {
 	}
 }
 
+// WithLinkDir sets the link directory, into which targets matched by
+// .chezmoilinks are written and then symlinked.
+func WithLinkDir(linkDirAbsPath AbsPath) SourceStateOption {
+	return func(s *SourceState) {
+		s.linkDirAbsPath = linkDirAbsPath
+	}
+}
+
+// WithLinkGenerations sets whether linked targets are symlinked to the current
+// generation of the link directory.
+func WithLinkGenerations(linkGenerations bool) SourceStateOption {
+	return func(s *SourceState) {
+		s.linkGenerations = linkGenerations
+	}
+}
+
 // WithLogger sets the logger.
 func WithLogger(logger *zerolog.Logger) SourceStateOption {
 	return func(s *SourceState) {
@@ -214,6 +338,14 @@ func WithPriorityTemplateData(priorityTemplateData map[string]any) SourceStateOp
 	}
 }
 
+// WithReadExternals sets whether to read the data of externals. If false,
+// externals are declared but not downloaded.
+func WithReadExternals(readExternals bool) SourceStateOption {
+	return func(s *SourceState) {
+		s.readExternals = readExternals
+	}
+}
+
 // WithReadTemplateData sets whether to read .chezmoidata.<format> files.
 func WithReadTemplateData(readTemplateData bool) SourceStateOption {
 	return func(s *SourceState) {
@@ -228,6 +360,29 @@ func WithReadTemplates(readTemplates bool) SourceStateOption {
 	}
 }
 
+// WithScriptLogOptions sets the options for recording script runs.
+func WithScriptLogOptions(scriptLogOptions ScriptLogOptions) SourceStateOption {
+	return func(s *SourceState) {
+		s.scriptLogOptions = scriptLogOptions
+	}
+}
+
+// WithScriptPreRunFunc sets the function that is called immediately before a
+// script is run.
+func WithScriptPreRunFunc(scriptPreRunFunc func() error) SourceStateOption {
+	return func(s *SourceState) {
+		s.scriptPreRunFunc = scriptPreRunFunc
+	}
+}
+
+// WithSharedPersistentState sets the persistent state that is shared between
+// machines, used to record the run_once_ scripts that run once per user.
+func WithSharedPersistentState(sharedState SharedPersistentState) SourceStateOption {
+	return func(s *SourceState) {
+		s.sharedState = sharedState
+	}
+}
+
 // WithSourceDir sets the source directory.
 func WithSourceDir(sourceDirAbsPath AbsPath) SourceStateOption {
 	return func(s *SourceState) {
@@ -235,6 +390,15 @@ func WithSourceDir(sourceDirAbsPath AbsPath) SourceStateOption {
 	}
 }
 
+// WithLayerSourceDirs sets the layer source directories. Layers are read
+// before the source directory, in order, and entries in later layers replace
+// entries for the same target in earlier layers.
+func WithLayerSourceDirs(layerSourceDirAbsPaths []AbsPath) SourceStateOption {
+	return func(s *SourceState) {
+		s.layerSourceDirAbsPaths = layerSourceDirAbsPaths
+	}
+}
+
 // WithSystem sets the system.
 func WithSystem(system System) SourceStateOption {
 	return func(s *SourceState) {
@@ -277,6 +441,13 @@ func WithVersion(version semver.Version) SourceStateOption {
 	}
 }
 
+// WithWarnFunc sets the function used to print warnings.
+func WithWarnFunc(warnFunc func(string, ...any)) SourceStateOption {
+	return func(s *SourceState) {
+		s.warnFunc = warnFunc
+	}
+}
+
 // A targetStateEntryFunc returns a TargetStateEntry based on reading an AbsPath
 // on a System.
 type targetStateEntryFunc func(System, AbsPath) (TargetStateEntry, error)
@@ -284,21 +455,29 @@ type targetStateEntryFunc func(System, AbsPath) (TargetStateEntry, error)
 // NewSourceState creates a new source state with the given options.
 func NewSourceState(options ...SourceStateOption) *SourceState {
 	s := &SourceState{
-		removeDirs:           make(map[RelPath]struct{}),
-		umask:                Umask,
-		encryption:           NoEncryption{},
-		ignore:               newPatternSet(),
-		remove:               newPatternSet(),
-		httpClient:           http.DefaultClient,
-		logger:               &log.Logger,
-		readTemplateData:     true,
-		readTemplates:        true,
-		priorityTemplateData: make(map[string]any),
-		userTemplateData:     make(map[string]any),
-		templateOptions:      DefaultTemplateOptions,
-		templates:            make(map[string]*Template),
-		externals:            make(map[RelPath][]*External),
-		ignoredRelPaths:      make(map[RelPath]struct{}),
+		removeDirs:             make(map[RelPath]struct{}),
+		umask:                  Umask,
+		encryption:             NoEncryption{},
+		ignore:                 newPatternSet(),
+		links:                  newPatternSet(),
+		remove:                 newPatternSet(),
+		tags:                   make(map[string]*patternSet),
+		httpClient:             http.DefaultClient,
+		logger:                 &log.Logger,
+		readTemplateData:       true,
+		readTemplates:          true,
+		readExternals:          true,
+		priorityTemplateData:   make(map[string]any),
+		dataSourceTemplateData: make(map[string]any),
+		dirTemplateData:        make(map[string]map[string]any),
+		modules:                make(map[string]*Module),
+		userTemplateData:       make(map[string]any),
+		templateOptions:        DefaultTemplateOptions,
+		templates:              make(map[string]*Template),
+		externals:              make(map[RelPath][]*External),
+		externalRefreshReasons: make(map[RelPath]string),
+		dataSourceURLs:         make(map[string]struct{}),
+		ignoredRelPaths:        make(map[RelPath]struct{}),
 	}
 	for _, option := range options {
 		option(s)
@@ -309,24 +488,32 @@ func NewSourceState(options ...SourceStateOption) *SourceState {
 // A PreAddFunc is called before a new source state entry is added.
 type PreAddFunc func(targetRelPath RelPath, fileInfo fs.FileInfo) error
 
+// An AutoTemplateFunc is called before an automatically created template is
+// added. It returns whether the template should be used.
+type AutoTemplateFunc func(targetRelPath RelPath, contents, templateContents []byte) (bool, error)
+
 // A ReplaceFunc is called before a source state entry is replaced.
 type ReplaceFunc func(targetRelPath RelPath, newSourceStateEntry, oldSourceStateEntry SourceStateEntry) error
 
 // AddOptions are options to SourceState.Add.
 type AddOptions struct {
-	AutoTemplate      bool             // Automatically create templates, if possible.
-	Create            bool             // Add create_ entries instead of normal entries.
-	Encrypt           bool             // Encrypt files.
-	EncryptedSuffix   string           // Suffix for encrypted files.
-	Exact             bool             // Add the exact_ attribute to added directories.
-	Filter            *EntryTypeFilter // Entry type filter.
-	OnIgnoreFunc      func(RelPath)    // Function to call when a target is ignored.
-	PreAddFunc        PreAddFunc       // Function to be called before a source entry is added.
-	ProtectedAbsPaths []AbsPath        // Paths that must not be added.
-	RemoveDir         RelPath          // Directory to remove before adding.
-	ReplaceFunc       ReplaceFunc      // Function to be called before a source entry is replaced.
-	Template          bool             // Add the .tmpl attribute to added files.
-	TemplateSymlinks  bool             // Add symlinks with targets in the source or home directories as templates.
+	AutoTemplate      bool               // Automatically create templates, if possible.
+	AutoTemplateFunc  AutoTemplateFunc   // Function to be called before an automatically created template is added.
+	AutoTemplateRules []AutoTemplateRule // Rules for automatically creating templates, by default all template data.
+	Create            bool               // Add create_ entries instead of normal entries.
+	Encrypt           bool               // Encrypt files.
+	EncryptedSuffix   string             // Suffix for encrypted files.
+	Exact             bool               // Add the exact_ attribute to added directories.
+	Filter            *EntryTypeFilter   // Entry type filter.
+	OnIgnoreFunc      func(RelPath)      // Function to call when a target is ignored.
+	PreAddFunc        PreAddFunc         // Function to be called before a source entry is added.
+	Private           bool               // Add the private_ attribute to added entries.
+	ProtectedAbsPaths []AbsPath          // Paths that must not be added.
+	ReadOnly          bool               // Add the readonly_ attribute to added entries.
+	RemoveDir         RelPath            // Directory to remove before adding.
+	ReplaceFunc       ReplaceFunc        // Function to be called before a source entry is replaced.
+	Template          bool               // Add the .tmpl attribute to added files.
+	TemplateSymlinks  bool               // Add symlinks with targets in the source or home directories as templates.
 }
 
 // Add adds destAbsPathInfos to s.
@@ -406,13 +593,6 @@ DEST_ABS_PATH:
 		if err != nil {
 			return err
 		}
-		newSourceStateEntry, err := s.sourceStateEntry(actualStateEntry, destAbsPath, destAbsPathInfo, parentSourceRelPath, options)
-		if err != nil {
-			return err
-		}
-		if newSourceStateEntry == nil {
-			continue
-		}
 
 		if options.PreAddFunc != nil {
 			switch err := options.PreAddFunc(targetRelPath, destAbsPathInfo); {
@@ -423,6 +603,14 @@ DEST_ABS_PATH:
 			}
 		}
 
+		newSourceStateEntry, err := s.sourceStateEntry(actualStateEntry, destAbsPath, destAbsPathInfo, parentSourceRelPath, options)
+		if err != nil {
+			return err
+		}
+		if newSourceStateEntry == nil {
+			continue
+		}
+
 		sourceEntryRelPath := newSourceStateEntry.SourceRelPath()
 
 		entryState, err := actualStateEntry.EntryState()
@@ -712,11 +900,21 @@ func (s *SourceState) Apply(
 	}
 
 	if changed, err := targetStateEntry.Apply(targetSystem, persistentState, actualStateEntry); err != nil {
+		s.eventBus.Emit(&Event{
+			Type:   EventTypeEntryFailed,
+			Target: targetRelPath.String(),
+			Error:  err.Error(),
+		})
 		return err
 	} else if !changed {
 		return nil
 	}
 
+	s.eventBus.Emit(&Event{
+		Type:   EventTypeEntryApplied,
+		Target: targetRelPath.String(),
+	})
+
 	return PersistentStateSet(persistentState, EntryStateBucket, targetAbsPath.Bytes(), targetEntryState)
 }
 
@@ -730,11 +928,22 @@ type ExecuteTemplateDataOptions struct {
 	Name            string
 	Destination     string
 	Data            []byte
+	SourceRelPath   SourceRelPath
 	TemplateOptions TemplateOptions
 }
 
 // ExecuteTemplateData returns the result of executing template data.
 func (s *SourceState) ExecuteTemplateData(options ExecuteTemplateDataOptions) ([]byte, error) {
+	return s.executeTemplateData(options, nil)
+}
+
+// executeTemplateData returns the result of executing template data. If
+// modifyFunc is not nil then it is called with the parsed template before the
+// templates in .chezmoitemplates are added.
+func (s *SourceState) executeTemplateData(
+	options ExecuteTemplateDataOptions,
+	modifyFunc func(*Template) error,
+) ([]byte, error) {
 	templateOptions := options.TemplateOptions
 	templateOptions.Options = slices.Clone(s.templateOptions)
 
@@ -743,8 +952,18 @@ func (s *SourceState) ExecuteTemplateData(options ExecuteTemplateDataOptions) ([
 		return nil, err
 	}
 
-	for _, t := range s.templates {
-		tmpl, err = tmpl.AddParseTree(t)
+	if modifyFunc != nil {
+		if err := modifyFunc(tmpl); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add templates in a stable order so that, if several templates define a
+	// block with the same name, the same definition is always used.
+	templateNames := maps.Keys(s.templates)
+	sort.Strings(templateNames)
+	for _, name := range templateNames {
+		tmpl, err = tmpl.AddParseTree(s.templates[name])
 		if err != nil {
 			return nil, err
 		}
@@ -752,6 +971,9 @@ func (s *SourceState) ExecuteTemplateData(options ExecuteTemplateDataOptions) ([
 
 	// Set .chezmoi.sourceFile to the name of the template.
 	templateData := s.TemplateData()
+	if !options.SourceRelPath.Empty() {
+		s.mergeDirTemplateData(templateData, options.SourceRelPath)
+	}
 	if chezmoiTemplateData, ok := templateData["chezmoi"].(map[string]any); ok {
 		chezmoiTemplateData["sourceFile"] = options.Name
 		chezmoiTemplateData["targetFile"] = options.Destination
@@ -783,6 +1005,17 @@ func (s *SourceState) Ignore(targetRelPath RelPath) bool {
 	return ignore
 }
 
+// IgnorePattern returns the pattern that causes targetRelPath to be ignored,
+// or the empty string if targetRelPath is not ignored by a specific pattern.
+func (s *SourceState) IgnorePattern(targetRelPath RelPath) string {
+	s.Lock()
+	defer s.Unlock()
+	if matchType, pattern := s.ignore.matchPattern(targetRelPath.String()); matchType == patternSetMatchInclude {
+		return pattern
+	}
+	return ""
+}
+
 // Ignored returns all ignored RelPaths.
 func (s *SourceState) Ignored() RelPaths {
 	relPaths := make(RelPaths, 0, len(s.ignoredRelPaths))
@@ -793,6 +1026,57 @@ func (s *SourceState) Ignored() RelPaths {
 	return relPaths
 }
 
+// Tags returns the tags of targetRelPath, in order. A target has a tag if it or
+// any of its parent directories matches a pattern for the tag in
+// .chezmoitags.
+func (s *SourceState) Tags(targetRelPath RelPath) []string {
+	s.Lock()
+	defer s.Unlock()
+	var tags []string
+	for tag, patternSet := range s.tags {
+		for relPath := targetRelPath; !relPath.Empty() && relPath.String() != "."; relPath = relPath.Dir() {
+			if firstMatchingPattern(patternSet.includePatterns, relPath.String()) != "" {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Linked returns if targetRelPath is written to the link directory and
+// symlinked. A target is linked if it or any of its parent directories
+// matches a pattern in .chezmoilinks.
+func (s *SourceState) Linked(targetRelPath RelPath) bool {
+	if s.linkDirAbsPath.Empty() {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	for relPath := targetRelPath; !relPath.Empty() && relPath.String() != "."; relPath = relPath.Dir() {
+		switch {
+		case firstMatchingPattern(s.links.excludePatterns, relPath.String()) != "":
+			return false
+		case firstMatchingPattern(s.links.includePatterns, relPath.String()) != "":
+			return true
+		}
+	}
+	return false
+}
+
+// RemovePattern returns the pattern in .chezmoiremove that causes
+// targetRelPath to be removed, or the empty string if there is no such
+// pattern.
+func (s *SourceState) RemovePattern(targetRelPath RelPath) string {
+	s.Lock()
+	defer s.Unlock()
+	if matchType, pattern := s.remove.matchPattern(targetRelPath.String()); matchType == patternSetMatchInclude {
+		return pattern
+	}
+	return ""
+}
+
 // MustEntry returns the source state entry associated with targetRelPath, and
 // panics if it does not exist.
 func (s *SourceState) MustEntry(targetRelPath RelPath) SourceStateEntry {
@@ -863,31 +1147,80 @@ type ReadOptions struct {
 
 // Read reads the source state from the source directory.
 func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
-	switch fileInfo, err := s.system.Stat(s.sourceDirAbsPath); {
-	case errors.Is(err, fs.ErrNotExist):
+	// Determine which source directories to read. Layers are read first so
+	// that the source directory has the highest precedence.
+	sourceDirAbsPaths := make([]AbsPath, 0, len(s.layerSourceDirAbsPaths)+1)
+	for _, sourceDirAbsPath := range append(slices.Clone(s.layerSourceDirAbsPaths), s.sourceDirAbsPath) {
+		switch fileInfo, err := s.system.Stat(sourceDirAbsPath); {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return err
+		case !fileInfo.IsDir():
+			return fmt.Errorf("%s: not a directory", sourceDirAbsPath)
+		}
+		sourceDirAbsPaths = append(sourceDirAbsPaths, sourceDirAbsPath)
+	}
+	if len(sourceDirAbsPaths) == 0 {
 		return nil
+	}
+
+	// Read the template data schema, if any.
+	templateDataSchemaAbsPath := s.sourceDirAbsPath.JoinString(dataSchemaName)
+	switch data, err := s.system.ReadFile(templateDataSchemaAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
 	case err != nil:
 		return err
-	case !fileInfo.IsDir():
-		return fmt.Errorf("%s: not a directory", s.sourceDirAbsPath)
+	default:
+		templateDataSchema, err := newJSONSchema(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", templateDataSchemaAbsPath, err)
+		}
+		s.templateDataSchema = templateDataSchema
 	}
 
-	// Read all source entries.
+	// Read the external lock file, if any.
+	if !s.ignoreExternalLock {
+		externalLockAbsPath := s.sourceDirAbsPath.JoinString(ExternalLockName)
+		switch data, err := s.system.ReadFile(externalLockAbsPath); {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			if err := FormatJSON.Unmarshal(data, &s.externalLock); err != nil {
+				return fmt.Errorf("%s: %w", externalLockAbsPath, err)
+			}
+		}
+	}
+
+	// Read all source entries. sourceDirAbsPath and layerSourceStateEntries
+	// are updated for each source directory walked.
 	var allSourceStateEntriesMu sync.Mutex
-	allSourceStateEntries := make(map[RelPath][]SourceStateEntry)
+	var sourceDirAbsPath AbsPath
+	layerSourceStateEntries := make(map[RelPath][]SourceStateEntry)
 	addSourceStateEntries := func(relPath RelPath, sourceStateEntries ...SourceStateEntry) {
 		allSourceStateEntriesMu.Lock()
 		defer allSourceStateEntriesMu.Unlock()
-		allSourceStateEntries[relPath] = append(allSourceStateEntries[relPath], sourceStateEntries...)
+		layerSourceStateEntries[relPath] = append(layerSourceStateEntries[relPath], sourceStateEntries...)
 	}
+	templateDataValidated := false
 	walkFunc := func(sourceAbsPath AbsPath, fileInfo fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if sourceAbsPath == s.sourceDirAbsPath {
+		if sourceAbsPath == sourceDirAbsPath {
 			return nil
 		}
 
+		// Validate the template data before the first entry that might
+		// execute a template.
+		if !templateDataValidated && !isTemplateDataName(fileInfo.Name()) {
+			templateDataValidated = true
+			if err := s.validateTemplateData(); err != nil {
+				return err
+			}
+		}
+
 		// Follow symlinks in the source directory.
 		if fileInfo.Mode().Type() == fs.ModeSymlink {
 			// Some programs (notably emacs) use invalid symlinks as lockfiles.
@@ -903,13 +1236,24 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 		}
 
 		sourceRelPath := SourceRelPath{
-			relPath: sourceAbsPath.MustTrimDirPrefix(s.sourceDirAbsPath),
+			relPath: sourceAbsPath.MustTrimDirPrefix(sourceDirAbsPath),
 			isDir:   fileInfo.IsDir(),
 		}
 		parentSourceRelPath, sourceName := sourceRelPath.Split()
 
+		// Skip disabled modules entirely, including their data, templates,
+		// and externals.
+		if fileInfo.IsDir() && !strings.HasPrefix(fileInfo.Name(), ignorePrefix) {
+			switch module, err := s.readModule(sourceAbsPath, sourceRelPath); {
+			case err != nil:
+				return err
+			case module != nil && !module.Enabled:
+				return fs.SkipDir
+			}
+		}
+
 		switch {
-		case fileInfo.Name() == dataName:
+		case fileInfo.Name() == dataName || fileInfo.Name() == dataDirName:
 			if !s.readTemplateData {
 				return nil
 			}
@@ -917,11 +1261,24 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 				return err
 			}
 			return fs.SkipDir
-		case isPrefixDotFormat(fileInfo.Name(), dataName):
+		case isPrefixDotFormat(fileInfo.Name(), dataName) ||
+			isPrefixDotFormatEncrypted(fileInfo.Name(), dataName, s.encryption.EncryptedSuffix()) ||
+			fileInfo.Name() == dataName+ejsonExtension:
 			if !s.readTemplateData {
 				return nil
 			}
 			return s.addTemplateData(sourceAbsPath)
+		case isPrefixDotFormat(fileInfo.Name(), dirDataName):
+			if !s.readTemplateData {
+				return nil
+			}
+			return s.addDirTemplateData(sourceAbsPath, parentSourceRelPath)
+		case isPrefixDotFormat(fileInfo.Name(), dataSourcesName) ||
+			isPrefixDotFormatDotTmpl(fileInfo.Name(), dataSourcesName):
+			if !s.readTemplateData {
+				return nil
+			}
+			return s.addDataSources(ctx, sourceAbsPath, options)
 		case fileInfo.Name() == TemplatesDirName:
 			if s.readTemplates {
 				if err := s.addTemplatesDir(ctx, sourceAbsPath); err != nil {
@@ -933,18 +1290,24 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			return nil
 		case isPrefixDotFormat(fileInfo.Name(), externalName) || isPrefixDotFormatDotTmpl(fileInfo.Name(), externalName):
 			parentAbsPath, _ := sourceAbsPath.Split()
-			return s.addExternal(sourceAbsPath, parentAbsPath)
+			return s.addExternal(sourceDirAbsPath, sourceAbsPath, parentAbsPath)
 		case fileInfo.Name() == externalsDirName:
-			if err := s.addExternalDir(ctx, sourceAbsPath); err != nil {
+			if err := s.addExternalDir(ctx, sourceDirAbsPath, sourceAbsPath); err != nil {
 				return err
 			}
 			return fs.SkipDir
+		case fileInfo.Name() == conditionsName:
+			return s.addConditions(sourceAbsPath, sourceRelPath)
 		case fileInfo.Name() == ignoreName || fileInfo.Name() == ignoreName+TemplateSuffix:
 			return s.addPatterns(s.ignore, sourceAbsPath, parentSourceRelPath)
+		case fileInfo.Name() == linksName || fileInfo.Name() == linksName+TemplateSuffix:
+			return s.addPatterns(s.links, sourceAbsPath, parentSourceRelPath)
 		case fileInfo.Name() == removeName || fileInfo.Name() == removeName+TemplateSuffix:
 			return s.addPatterns(s.remove, sourceAbsPath, parentSourceRelPath)
+		case fileInfo.Name() == tagsName || fileInfo.Name() == tagsName+TemplateSuffix:
+			return s.addTags(sourceAbsPath, parentSourceRelPath)
 		case fileInfo.Name() == scriptsDirName:
-			scriptsDirSourceStateEntries, err := s.readScriptsDir(ctx, sourceAbsPath)
+			scriptsDirSourceStateEntries, err := s.readScriptsDir(ctx, sourceDirAbsPath, sourceAbsPath)
 			if err != nil {
 				return err
 			}
@@ -976,7 +1339,7 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 				}
 				allSourceStateEntriesMu.Lock()
 				for relPath, entries := range sourceStateEntries {
-					allSourceStateEntries[relPath] = append(allSourceStateEntries[relPath], entries...)
+					layerSourceStateEntries[relPath] = append(layerSourceStateEntries[relPath], entries...)
 				}
 				allSourceStateEntriesMu.Unlock()
 				return fs.SkipDir
@@ -1004,7 +1367,22 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			}
 		}
 	}
-	if err := WalkSourceDir(s.system, s.sourceDirAbsPath, walkFunc); err != nil {
+	allSourceStateEntries := make(map[RelPath][]SourceStateEntry)
+	for _, sourceDirAbsPath = range sourceDirAbsPaths {
+		layerSourceStateEntries = make(map[RelPath][]SourceStateEntry)
+		if err := WalkSourceDir(s.system, sourceDirAbsPath, walkFunc); err != nil {
+			return err
+		}
+		// Entries in later source directories replace entries for the same
+		// target in earlier source directories.
+		for targetRelPath, sourceStateEntries := range layerSourceStateEntries {
+			allSourceStateEntries[targetRelPath] = sourceStateEntries
+		}
+	}
+
+	// Validate the template data again, as template data might have been
+	// added in subdirectories.
+	if err := s.validateTemplateData(); err != nil {
 		return err
 	}
 
@@ -1019,7 +1397,7 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 	}
 	sort.Sort(externalRelPaths)
 	for _, externalRelPath := range externalRelPaths {
-		if s.Ignore(externalRelPath) {
+		if !s.readExternals || s.Ignore(externalRelPath) {
 			continue
 		}
 		for _, external := range s.externals[externalRelPath] {
@@ -1062,8 +1440,8 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			continue
 		}
 		sourceStateEntry := &SourceStateRemove{
-			origin:        SourceStateOriginRemove{},
-			sourceRelPath: NewSourceRelPath(".chezmoiremove"),
+			origin:        SourceStateOriginRemovePatterns{},
+			sourceRelPath: NewSourceRelPath(removeName),
 			targetRelPath: targetRelPath,
 		}
 		allSourceStateEntries[targetRelPath] = append(allSourceStateEntries[targetRelPath], sourceStateEntry)
@@ -1116,7 +1494,7 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 	// Generate SourceStateCommands for git-repo externals.
 	var gitRepoExternalRelPaths RelPaths
 	for externalRelPath, externals := range s.externals {
-		if s.Ignore(externalRelPath) {
+		if !s.readExternals || s.Ignore(externalRelPath) {
 			continue
 		}
 		for _, external := range externals {
@@ -1249,6 +1627,7 @@ func (s *SourceState) TemplateData() map[string]any {
 			s.defaultTemplateDataFunc = nil
 		}
 		RecursiveMerge(s.templateData, s.defaultTemplateData)
+		RecursiveMerge(s.templateData, s.dataSourceTemplateData)
 		RecursiveMerge(s.templateData, s.userTemplateData)
 		RecursiveMerge(s.templateData, s.priorityTemplateData)
 	}
@@ -1260,8 +1639,30 @@ func (s *SourceState) TemplateData() map[string]any {
 }
 
 // addExternal adds external source entries to s.
-func (s *SourceState) addExternal(sourceAbsPath, parentAbsPath AbsPath) error {
-	parentRelPath, err := parentAbsPath.TrimDirPrefix(s.sourceDirAbsPath)
+// dirAttrPerm returns the permissions of a target directory with dirAttr. If a
+// default directory mode is set then it is used instead of the umask.
+func (s *SourceState) dirAttrPerm(dirAttr DirAttr) fs.FileMode {
+	if s.defaultModes.Dir != 0 {
+		return dirAttr.perm() & s.defaultModes.Dir
+	}
+	return dirAttr.perm() &^ s.umask
+}
+
+// fileAttrPerm returns the permissions of a target file with fileAttr. If a
+// default file or executable mode is set then it is used instead of the umask.
+func (s *SourceState) fileAttrPerm(fileAttr FileAttr) fs.FileMode {
+	switch {
+	case fileAttr.Executable && s.defaultModes.Executable != 0:
+		return fileAttr.perm() & s.defaultModes.Executable
+	case !fileAttr.Executable && s.defaultModes.File != 0:
+		return fileAttr.perm() & s.defaultModes.File
+	default:
+		return fileAttr.perm() &^ s.umask
+	}
+}
+
+func (s *SourceState) addExternal(sourceDirAbsPath, sourceAbsPath, parentAbsPath AbsPath) error {
+	parentRelPath, err := parentAbsPath.TrimDirPrefix(sourceDirAbsPath)
 	if err != nil {
 		return err
 	}
@@ -1289,12 +1690,17 @@ func (s *SourceState) addExternal(sourceAbsPath, parentAbsPath AbsPath) error {
 		targetRelPath := parentTargetSourceRelPath.JoinString(path)
 		external.sourceAbsPath = sourceAbsPath
 		s.externals[targetRelPath] = append(s.externals[targetRelPath], external)
+		for _, tag := range external.Tags {
+			if err := s.addTagPattern(tag, targetRelPath.String()); err != nil {
+				return fmt.Errorf("%s: %s: %w", sourceAbsPath, path, err)
+			}
+		}
 	}
 	return nil
 }
 
 // addExternalDir adds all externals in externalsDirAbsPath to s.
-func (s *SourceState) addExternalDir(ctx context.Context, externalsDirAbsPath AbsPath) error {
+func (s *SourceState) addExternalDir(ctx context.Context, sourceDirAbsPath, externalsDirAbsPath AbsPath) error {
 	walkFunc := func(ctx context.Context, externalAbsPath AbsPath, fileInfo fs.FileInfo, err error) error {
 		if externalAbsPath == externalsDirAbsPath {
 			return nil
@@ -1314,7 +1720,7 @@ func (s *SourceState) addExternalDir(ctx context.Context, externalsDirAbsPath Ab
 			return nil
 		case fileInfo.Mode().IsRegular():
 			parentAbsPath, _ := externalAbsPath.Split()
-			return s.addExternal(externalAbsPath, parentAbsPath.TrimSuffix("/").Dir())
+			return s.addExternal(sourceDirAbsPath, externalAbsPath, parentAbsPath.TrimSuffix("/").Dir())
 		case fileInfo.IsDir():
 			return nil
 		default:
@@ -1327,6 +1733,58 @@ func (s *SourceState) addExternalDir(ctx context.Context, externalsDirAbsPath Ab
 	return concurrentWalkSourceDir(ctx, s.system, externalsDirAbsPath, walkFunc)
 }
 
+// addConditions adds all conditions in the .chezmoiconditions file at
+// sourceAbsPath to s. Each line contains a pattern followed by a template
+// expression. The expression is evaluated immediately and, if it is false,
+// the pattern is ignored.
+func (s *SourceState) addConditions(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
+	data, err := s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+
+	dir := sourceRelPath.Dir().TargetRelPath("")
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pattern := strings.Fields(text)[0]
+		expression := strings.TrimSpace(strings.TrimPrefix(text, pattern))
+		if expression == "" {
+			return fmt.Errorf("%s:%d: %s: missing condition", sourceAbsPath, lineNumber, pattern)
+		}
+		result, err := s.ExecuteTemplateData(ExecuteTemplateDataOptions{
+			Name:          fmt.Sprintf("%s:%d", sourceAbsPath, lineNumber),
+			Data:          []byte("{{ " + expression + " }}"),
+			SourceRelPath: sourceRelPath,
+		})
+		if err != nil {
+			return err
+		}
+		condition, err := strconv.ParseBool(strings.TrimSpace(string(result)))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: condition is not a boolean", sourceAbsPath, lineNumber, result)
+		}
+		if condition {
+			continue
+		}
+		s.Lock()
+		err = s.ignore.add(dir.JoinString(pattern).String(), patternSetInclude)
+		s.Unlock()
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	return nil
+}
+
 // addPatterns executes the template at sourceAbsPath, interprets the result as
 // a list of patterns, and adds all patterns found to patternSet.
 func (s *SourceState) addPatterns(patternSet *patternSet, sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
@@ -1334,6 +1792,7 @@ func (s *SourceState) addPatterns(patternSet *patternSet, sourceAbsPath AbsPath,
 	if err != nil {
 		return err
 	}
+	chezmoiTemplateData, _ := s.TemplateData()["chezmoi"].(map[string]any)
 
 	s.Lock()
 	defer s.Unlock()
@@ -1341,6 +1800,7 @@ func (s *SourceState) addPatterns(patternSet *patternSet, sourceAbsPath AbsPath,
 	dir := sourceRelPath.Dir().TargetRelPath("")
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	lineNumber := 0
+	sectionActive := true
 	for scanner.Scan() {
 		lineNumber++
 		text := scanner.Text()
@@ -1349,6 +1809,16 @@ func (s *SourceState) addPatterns(patternSet *patternSet, sourceAbsPath AbsPath,
 		if text == "" {
 			continue
 		}
+		if conditions, ok := parsePatternsSectionHeader(text); ok {
+			sectionActive, err = evaluatePatternsSectionConditions(conditions, chezmoiTemplateData)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+			}
+			continue
+		}
+		if !sectionActive {
+			continue
+		}
 		include := patternSetInclude
 		text, ok := strings.CutPrefix(text, "!")
 		if ok {
@@ -1359,37 +1829,354 @@ func (s *SourceState) addPatterns(patternSet *patternSet, sourceAbsPath AbsPath,
 			return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	return nil
+}
+
+// A patternsSectionCondition is a condition in a section header.
+type patternsSectionCondition struct {
+	key    string
+	negate bool
+	value  string
+}
+
+// parsePatternsSectionHeader parses text as a section header, like
+// [os=darwin] or [os!=windows arch=amd64], returning its conditions. The
+// section header [*] has no conditions. It returns false if text is not a
+// section header.
+func parsePatternsSectionHeader(text string) ([]patternsSectionCondition, bool) {
+	inner, ok := strings.CutPrefix(text, "[")
+	if !ok {
+		return nil, false
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return nil, false
+	}
+	if strings.TrimSpace(inner) == "*" {
+		return nil, true
+	}
+	fields := strings.Fields(inner)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	conditions := make([]patternsSectionCondition, 0, len(fields))
+	for _, field := range fields {
+		match := patternsSectionConditionRx.FindStringSubmatch(field)
+		if match == nil {
+			return nil, false
+		}
+		conditions = append(conditions, patternsSectionCondition{
+			key:    match[1],
+			negate: match[2] == "!=",
+			value:  match[3],
+		})
+	}
+	return conditions, true
+}
+
+// evaluatePatternsSectionConditions returns whether all conditions hold for the
+// .chezmoi template variables in chezmoiTemplateData.
+func evaluatePatternsSectionConditions(conditions []patternsSectionCondition, chezmoiTemplateData map[string]any) (bool, error) {
+	for _, condition := range conditions {
+		actualValue, ok := chezmoiTemplateData[condition.key]
+		if !ok {
+			return false, fmt.Errorf("%s: unknown variable", condition.key)
+		}
+		if (fmt.Sprint(actualValue) == condition.value) == condition.negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// addTags adds all tags in the .chezmoitags file at sourceAbsPath to s. Each
+// line contains a pattern followed by one or more tags.
+func (s *SourceState) addTags(sourceAbsPath AbsPath, sourceRelPath SourceRelPath) error {
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	dir := sourceRelPath.Dir().TargetRelPath("")
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		text, _, _ = strings.Cut(text, "#")
+		fields := strings.Fields(text)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			return fmt.Errorf("%s:%d: %s: missing tags", sourceAbsPath, lineNumber, fields[0])
+		}
+		pattern := dir.JoinString(fields[0]).String()
+		for _, tag := range fields[1:] {
+			if err := s.addTagPattern(tag, pattern); err != nil {
+				return fmt.Errorf("%s:%d: %w", sourceAbsPath, lineNumber, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	return nil
+}
+
+// addTagPattern adds pattern to the patterns for tag. The caller must hold the
+// lock on s.
+func (s *SourceState) addTagPattern(tag, pattern string) error {
+	patternSet, ok := s.tags[tag]
+	if !ok {
+		patternSet = newPatternSet()
+		s.tags[tag] = patternSet
+	}
+	return patternSet.add(pattern, patternSetInclude)
+}
+
+// addTemplateData adds all template data in sourceAbsPath to s. If
+// sourceAbsPath has the encrypted suffix or is an ejson file then it is
+// decrypted first, and its format is given by its name without the encrypted
+// suffix.
+func (s *SourceState) addTemplateData(sourceAbsPath AbsPath) error {
+	name := sourceAbsPath.Base()
+	encryptedSuffix := s.encryption.EncryptedSuffix()
+	switch {
+	case encryptedSuffix != "" && strings.HasSuffix(name, encryptedSuffix):
+		ciphertext, err := s.system.ReadFile(sourceAbsPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+		format, err := formatFromExtension(path.Ext(strings.TrimSuffix(name, encryptedSuffix)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+		data, err := s.encryption.Decrypt(ciphertext)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+		return s.addTemplateDataBytes(sourceAbsPath, format, data)
+	case path.Ext(name) == ejsonExtension:
+		ciphertext, err := s.system.ReadFile(sourceAbsPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+		var key string
+		if s.ejsonKeyFunc != nil {
+			if key, err = s.ejsonKeyFunc(); err != nil {
+				return fmt.Errorf("%s: %w", sourceAbsPath, err)
+			}
+		}
+		templateData, err := decryptEJSON(ciphertext, s.ejsonKeyDir, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+		s.mergeUserTemplateData(templateData)
+		return nil
+	default:
+		format, err := FormatFromAbsPath(sourceAbsPath)
+		if err != nil {
+			return err
+		}
+		return s.addTemplateDataWithFormat(sourceAbsPath, format)
+	}
+}
+
+// addDirTemplateData adds the template data in sourceAbsPath to s as template
+// data that is only visible to templates in the source directory
+// dirSourceRelPath and its subdirectories.
+func (s *SourceState) addDirTemplateData(sourceAbsPath AbsPath, dirSourceRelPath SourceRelPath) error {
+	format, err := FormatFromAbsPath(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+	data, err := s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	var templateData map[string]any
+	if err := format.Unmarshal(data, &templateData); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	key := path.Clean(dirSourceRelPath.String())
+	s.Lock()
+	defer s.Unlock()
+	dirTemplateData, ok := s.dirTemplateData[key]
+	if !ok {
+		dirTemplateData = make(map[string]any)
+		s.dirTemplateData[key] = dirTemplateData
+	}
+	RecursiveMerge(dirTemplateData, templateData)
+	return nil
+}
+
+// addTemplateDataWithFormat adds all template data in sourceAbsPath, in
+// format, to s.
+func (s *SourceState) addTemplateDataWithFormat(sourceAbsPath AbsPath, format Format) error {
+	data, err := s.system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	return s.addTemplateDataBytes(sourceAbsPath, format, data)
+}
+
+// addTemplateDataBytes adds the template data data, in format, read from
+// sourceAbsPath to s.
+func (s *SourceState) addTemplateDataBytes(sourceAbsPath AbsPath, format Format, data []byte) error {
+	var templateData map[string]any
+	if err := format.Unmarshal(data, &templateData); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	s.mergeUserTemplateData(templateData)
+	return nil
+}
+
+// mergeUserTemplateData merges templateData into s's user template data.
+func (s *SourceState) mergeUserTemplateData(templateData map[string]any) {
+	s.Lock()
+	RecursiveMerge(s.userTemplateData, templateData)
+	// Clear the cached template data, as the change to the user template data
+	// means that the cached value is now invalid.
+	s.templateData = nil
+	s.Unlock()
+}
+
+// mergeDirTemplateData merges the template data of the source directories
+// containing sourceRelPath into templateData, outermost directory first, so
+// that data in subdirectories overrides data in their parents.
+func (s *SourceState) mergeDirTemplateData(templateData map[string]any, sourceRelPath SourceRelPath) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.dirTemplateData) == 0 {
+		return
+	}
+	if dirTemplateData, ok := s.dirTemplateData["."]; ok {
+		RecursiveMerge(templateData, dirTemplateData)
+	}
+	dir := sourceRelPath.Dir().String()
+	if dir == "." {
+		return
+	}
+	components := strings.Split(dir, "/")
+	for i := range components {
+		if dirTemplateData, ok := s.dirTemplateData[strings.Join(components[:i+1], "/")]; ok {
+			RecursiveMerge(templateData, dirTemplateData)
+		}
+	}
+}
+
+// addDataSources adds the template data from all data sources in
+// sourceAbsPath to s. The template data from each data source is added under
+// the data source's name, with a lower priority than template data in the
+// source state.
+func (s *SourceState) addDataSources(ctx context.Context, sourceAbsPath AbsPath, options *ReadOptions) error {
+	format, err := FormatFromAbsPath(sourceAbsPath.TrimSuffix(TemplateSuffix))
+	if err != nil {
+		return err
+	}
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	dataSources := make(map[string]*dataSource)
+	if err := format.Unmarshal(data, &dataSources); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	for _, name := range chezmoimaps.SortedKeys(dataSources) {
+		value, err := s.readDataSource(ctx, name, dataSources[name], options)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", sourceAbsPath, name, err)
+		}
+		s.Lock()
+		RecursiveMerge(s.dataSourceTemplateData, map[string]any{
+			name: value,
+		})
+		s.templateData = nil
+		s.Unlock()
+	}
+	return nil
+}
+
+// readDataSource returns the template data from dataSource.
+func (s *SourceState) readDataSource(
+	ctx context.Context,
+	name string,
+	dataSource *dataSource,
+	options *ReadOptions,
+) (any, error) {
+	var data []byte
+	var extension string
+	switch {
+	case dataSource.Command != "" && dataSource.URL != "":
+		return nil, errors.New("command and url cannot both be set")
+	case dataSource.Command != "":
+		cmd := exec.CommandContext(ctx, dataSource.Command, dataSource.Args...) //nolint:gosec
+		cmd.Dir = s.sourceDirAbsPath.String()
+		cmd.Stderr = os.Stderr
+		output, err := chezmoilog.LogCmdOutput(cmd)
+		if err != nil {
+			return nil, err
+		}
+		data = output
+	case dataSource.URL != "":
+		s.Lock()
+		s.dataSourceURLs[dataSource.URL] = struct{}{}
+		s.Unlock()
+		external := &External{
+			Checksum:      dataSource.Checksum,
+			RefreshPeriod: dataSource.RefreshPeriod,
+			URL:           dataSource.URL,
+		}
+		externalData, err := s.getExternalData(ctx, NewRelPath(name), external, options)
+		if err != nil {
+			return nil, err
+		}
+		data = externalData
+		if u, err := url.Parse(dataSource.URL); err == nil {
+			extension = path.Ext(u.Path)
+		}
+	default:
+		return nil, errors.New("command or url must be set")
+	}
+	if dataSource.Format != "" {
+		extension = dataSource.Format
 	}
-	return nil
-}
-
-// addTemplateData adds all template data in sourceAbsPath to s.
-func (s *SourceState) addTemplateData(sourceAbsPath AbsPath) error {
-	format, err := FormatFromAbsPath(sourceAbsPath)
+	format, err := formatFromExtension(extension)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	data, err := s.system.ReadFile(sourceAbsPath)
-	if err != nil {
-		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	var value any
+	if err := format.Unmarshal(data, &value); err != nil {
+		return nil, err
 	}
-	var templateData map[string]any
-	if err := format.Unmarshal(data, &templateData); err != nil {
-		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	return value, nil
+}
+
+// validateTemplateData validates s's template data against s's template data
+// schema, if any.
+func (s *SourceState) validateTemplateData() error {
+	if s.templateDataSchema == nil {
+		return nil
+	}
+	if err := s.templateDataSchema.Validate(s.TemplateData()); err != nil {
+		return fmt.Errorf("%s: %w", s.sourceDirAbsPath.JoinString(dataSchemaName), err)
 	}
-	s.Lock()
-	RecursiveMerge(s.userTemplateData, templateData)
-	// Clear the cached template data, as the change to the user template data
-	// means that the cached value is now invalid.
-	s.templateData = nil
-	s.Unlock()
 	return nil
 }
 
-// addTemplateData adds all template data in the directory sourceAbsPath to s.
+// addTemplateDataDir adds all template data in the directory sourceAbsPath to
+// s. If the directory is a .chezmoidata.d directory then the names of the files
+// in it are templates. Files whose executed names have no extension are
+// skipped, otherwise the format of the file is given by its executed name.
 func (s *SourceState) addTemplateDataDir(sourceAbsPath AbsPath, fileInfo fs.FileInfo) error {
+	dirName := fileInfo.Name()
 	walkFunc := func(dataAbsPath AbsPath, fileInfo fs.FileInfo, err error) error {
 		if dataAbsPath == sourceAbsPath {
 			return nil
@@ -1401,12 +2188,29 @@ func (s *SourceState) addTemplateDataDir(sourceAbsPath AbsPath, fileInfo fs.File
 		case err != nil:
 			return err
 		case strings.HasPrefix(fileInfo.Name(), Prefix):
-			return fmt.Errorf("%s: not allowed in %s directory", dataAbsPath, dataName)
+			return fmt.Errorf("%s: not allowed in %s directory", dataAbsPath, dirName)
 		case strings.HasPrefix(fileInfo.Name(), ignorePrefix):
 			if fileInfo.IsDir() {
 				return fs.SkipDir
 			}
 			return nil
+		case fileInfo.Mode().IsRegular() && dirName == dataDirName:
+			name, err := s.ExecuteTemplateData(ExecuteTemplateDataOptions{
+				Name: dataAbsPath.String(),
+				Data: []byte(fileInfo.Name()),
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", dataAbsPath, err)
+			}
+			extension := path.Ext(string(name))
+			if extension == "" {
+				return nil
+			}
+			format, err := formatFromExtension(extension)
+			if err != nil {
+				return fmt.Errorf("%s: %w", dataAbsPath, err)
+			}
+			return s.addTemplateDataWithFormat(dataAbsPath, format)
 		case fileInfo.Mode().IsRegular():
 			return s.addTemplateData(dataAbsPath)
 		case fileInfo.IsDir():
@@ -1482,6 +2286,164 @@ func (s *SourceState) executeTemplate(templateAbsPath AbsPath) ([]byte, error) {
 	})
 }
 
+// Externals returns all the externals in s that are not ignored, sorted by
+// target path.
+func (s *SourceState) Externals() ([]RelPath, map[RelPath][]*External) {
+	externalRelPaths := make(RelPaths, 0, len(s.externals))
+	externals := make(map[RelPath][]*External, len(s.externals))
+	for externalRelPath := range s.externals {
+		if s.Ignore(externalRelPath) {
+			continue
+		}
+		externalRelPaths = append(externalRelPaths, externalRelPath)
+		externals[externalRelPath] = s.externals[externalRelPath]
+	}
+	sort.Sort(externalRelPaths)
+	return externalRelPaths, externals
+}
+
+// ExternalCacheAbsPath returns the path where the data downloaded for external
+// is cached.
+func (s *SourceState) ExternalCacheAbsPath(external *External) AbsPath {
+	cacheKey := hex.EncodeToString(SHA256Sum([]byte(external.cacheKey())))
+	return s.ExternalCacheDirAbsPath().JoinString(cacheKey)
+}
+
+// ExternalCacheDirAbsPath returns the directory containing the cached data of
+// externals.
+func (s *SourceState) ExternalCacheDirAbsPath() AbsPath {
+	return s.cacheDirAbsPath.JoinString("external")
+}
+
+// ExternalCacheAbsPaths returns the set of the paths of the cached data of all
+// externals and data sources in s.
+func (s *SourceState) ExternalCacheAbsPaths() map[AbsPath]struct{} {
+	externalCacheAbsPaths := make(map[AbsPath]struct{})
+	for _, externals := range s.externals {
+		for _, external := range externals {
+			if external.Type == ExternalTypeGitRepo {
+				continue
+			}
+			externalCacheAbsPaths[s.ExternalCacheAbsPath(external)] = struct{}{}
+		}
+	}
+	for url := range s.dataSourceURLs {
+		externalCacheAbsPaths[s.ExternalCacheAbsPath(&External{URL: url})] = struct{}{}
+	}
+	return externalCacheAbsPaths
+}
+
+// ExternalLock returns the external lock entries for all externals in s,
+// except git-repo externals, downloading the data of any externals that were
+// not already read.
+func (s *SourceState) ExternalLock(ctx context.Context, options *ReadOptions) (map[RelPath]*ExternalLockEntry, error) {
+	externalLock := make(map[RelPath]*ExternalLockEntry)
+	for externalRelPath, externals := range s.externals {
+		if s.Ignore(externalRelPath) {
+			continue
+		}
+		for _, external := range externals {
+			if external.Type == ExternalTypeGitRepo {
+				continue
+			}
+			s.Lock()
+			sha256Sum, ok := s.externalSHA256s[external]
+			s.Unlock()
+			if !ok {
+				data, err := s.getExternalDataRaw(ctx, externalRelPath, external, options)
+				if err != nil {
+					return nil, err
+				}
+				sha256Sum = SHA256Sum(data)
+			}
+			externalLock[externalRelPath] = &ExternalLockEntry{
+				URL:     external.URL,
+				Version: externalVersion(external.URL),
+				SHA256:  HexBytes(sha256Sum),
+			}
+		}
+	}
+	return externalLock, nil
+}
+
+// externalVersion returns the first version-like string in the path of
+// rawURL, if any.
+func externalVersion(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return externalVersionRx.FindString(u.Path)
+}
+
+// verifyExternalLock records the SHA256 sum of data, the raw data of external,
+// and verifies it and external's URL against the external lock file, if
+// external has an entry in it.
+func (s *SourceState) verifyExternalLock(externalRelPath RelPath, external *External, data []byte) error {
+	if !slices.Contains(s.externals[externalRelPath], external) {
+		// external is not a declared external, for example it is a data
+		// source.
+		return nil
+	}
+
+	sha256Sum := SHA256Sum(data)
+	s.Lock()
+	if s.externalSHA256s == nil {
+		s.externalSHA256s = make(map[*External][]byte)
+	}
+	s.externalSHA256s[external] = sha256Sum
+	s.Unlock()
+
+	externalLockEntry, ok := s.externalLock[externalRelPath]
+	switch {
+	case !ok:
+		return nil
+	case external.URL != externalLockEntry.URL:
+		format := "%s: URL mismatch: locked %s, got %s (run chezmoi externals update to update %s)"
+		return fmt.Errorf(format, externalRelPath, externalLockEntry.URL, external.URL, ExternalLockName)
+	case !bytes.Equal(sha256Sum, externalLockEntry.SHA256):
+		format := "%s: SHA256 mismatch: locked %s, got %s (run chezmoi externals update to update %s)"
+		return fmt.Errorf(format, externalRelPath, externalLockEntry.SHA256, hex.EncodeToString(sha256Sum), ExternalLockName)
+	default:
+		return nil
+	}
+}
+
+// ExternalRefreshReason returns why the data for external will be downloaded
+// rather than read from the cache at time now, or the empty string if the cache
+// will be used.
+func (s *SourceState) ExternalRefreshReason(external *External, refreshExternals RefreshExternals, now time.Time) string {
+	fileInfo, err := s.baseSystem.Stat(s.ExternalCacheAbsPath(external))
+	switch {
+	case refreshExternals == RefreshExternalsAlways:
+		return "refresh requested"
+	case err != nil:
+		return "not cached"
+	case refreshExternals == RefreshExternalsNever:
+		// Always use the cache, if available, irrespective of the refresh
+		// period.
+		return ""
+	case external.RefreshPeriod == 0:
+		return ""
+	case fileInfo.ModTime().Add(time.Duration(external.RefreshPeriod)).After(now):
+		return ""
+	default:
+		return fmt.Sprintf("refresh period of %s elapsed", time.Duration(external.RefreshPeriod))
+	}
+}
+
+// ExternalRefreshReasons returns the target paths of the externals that were
+// downloaded while reading s, and why.
+func (s *SourceState) ExternalRefreshReasons() map[RelPath]string {
+	s.Lock()
+	defer s.Unlock()
+	externalRefreshReasons := make(map[RelPath]string, len(s.externalRefreshReasons))
+	for externalRelPath, refreshReason := range s.externalRefreshReasons {
+		externalRefreshReasons[externalRelPath] = refreshReason
+	}
+	return externalRefreshReasons
+}
+
 // getExternalDataRaw returns the raw data for external at externalRelPath,
 // possibly from the external cache.
 func (s *SourceState) getExternalDataRaw(
@@ -1502,49 +2464,23 @@ func (s *SourceState) getExternalDataRaw(
 	if options != nil {
 		refreshExternals = options.RefreshExternals
 	}
-	cacheKey := hex.EncodeToString(SHA256Sum([]byte(external.URL)))
-	cachedDataAbsPath := s.cacheDirAbsPath.JoinString("external", cacheKey)
-	switch refreshExternals {
-	case RefreshExternalsAlways:
-		// Never use the cache.
-	case RefreshExternalsAuto:
-		// Use the cache, if available and within the refresh period.
-		if fileInfo, err := s.baseSystem.Stat(cachedDataAbsPath); err == nil {
-			if external.RefreshPeriod == 0 || fileInfo.ModTime().Add(time.Duration(external.RefreshPeriod)).After(now) {
-				if data, err := s.baseSystem.ReadFile(cachedDataAbsPath); err == nil {
-					return data, nil
-				}
-			}
-		}
-	case RefreshExternalsNever:
-		// Always use the cache, if available, irrespective of the refresh
-		// period.
+	cachedDataAbsPath := s.ExternalCacheAbsPath(external)
+	refreshReason := s.ExternalRefreshReason(external, refreshExternals, now)
+	if refreshReason == "" {
 		if data, err := s.baseSystem.ReadFile(cachedDataAbsPath); err == nil {
 			return data, nil
 		}
+		refreshReason = "cache is not readable"
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, external.URL, http.NoBody)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := chezmoilog.LogHTTPRequest(s.logger, s.httpClient, req)
-	if err != nil {
-		return nil, err
-	}
-	var data []byte
-	if options == nil || options.ReadHTTPResponse == nil {
-		data, err = io.ReadAll(resp.Body)
-	} else {
-		data, err = options.ReadHTTPResponse(resp)
-	}
-	resp.Body.Close()
+	s.Lock()
+	s.externalRefreshReasons[externalRelPath] = refreshReason
+	s.Unlock()
+
+	data, err := s.downloadExternal(ctx, externalRelPath, external, options)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < http.StatusOK || http.StatusMultipleChoices <= resp.StatusCode {
-		return nil, fmt.Errorf("%s: %s: %s", externalRelPath, external.URL, resp.Status)
-	}
 
 	if err := MkdirAll(s.baseSystem, cachedDataAbsPath.Dir(), 0o700); err != nil {
 		return nil, err
@@ -1559,7 +2495,7 @@ func (s *SourceState) getExternalDataRaw(
 	return data, nil
 }
 
-// getExternalDataRaw reads the external data for externalRelPath from
+// getExternalData reads the external data for externalRelPath from
 // external.URL.
 func (s *SourceState) getExternalData(
 	ctx context.Context,
@@ -1572,6 +2508,10 @@ func (s *SourceState) getExternalData(
 		return nil, err
 	}
 
+	if err := s.verifyExternalLock(externalRelPath, external, data); err != nil {
+		return nil, err
+	}
+
 	var errs []error
 
 	if external.Checksum.Size != 0 {
@@ -1652,7 +2592,7 @@ func (s *SourceState) getExternalData(
 // newSourceStateDir returns a new SourceStateDir.
 func (s *SourceState) newSourceStateDir(absPath AbsPath, sourceRelPath SourceRelPath, dirAttr DirAttr) *SourceStateDir {
 	targetStateDir := &TargetStateDir{
-		perm: dirAttr.perm() &^ s.umask,
+		perm: s.dirAttrPerm(dirAttr),
 	}
 	return &SourceStateDir{
 		origin:           SourceStateOriginAbsPath(absPath),
@@ -1683,9 +2623,10 @@ func (s *SourceState) newCreateTargetStateEntryFunc(
 				}
 				if fileAttr.Template {
 					contents, err = s.ExecuteTemplateData(ExecuteTemplateDataOptions{
-						Name:        sourceRelPath.String(),
-						Data:        contents,
-						Destination: destAbsPath.String(),
+						Name:          sourceRelPath.String(),
+						Data:          contents,
+						Destination:   destAbsPath.String(),
+						SourceRelPath: sourceRelPath,
 					})
 					if err != nil {
 						return nil, err
@@ -1699,7 +2640,7 @@ func (s *SourceState) newCreateTargetStateEntryFunc(
 		return &TargetStateFile{
 			lazyContents: lazyContents,
 			empty:        fileAttr.Empty,
-			perm:         fileAttr.perm() &^ s.umask,
+			perm:         s.fileAttrPerm(fileAttr),
 			sourceAttr: SourceAttr{
 				Encrypted: fileAttr.Encrypted,
 				Template:  fileAttr.Template,
@@ -1709,10 +2650,13 @@ func (s *SourceState) newCreateTargetStateEntryFunc(
 }
 
 // newFileTargetStateEntryFunc returns a targetStateEntryFunc that returns a
-// file with sourceLazyContents.
+// file with sourceLazyContents, or a symlink to the file in the link directory
+// if targetRelPath is linked.
 func (s *SourceState) newFileTargetStateEntryFunc(
+	sourceAbsPath AbsPath,
 	sourceRelPath SourceRelPath,
 	fileAttr FileAttr,
+	targetRelPath RelPath,
 	sourceLazyContents *lazyContents,
 ) targetStateEntryFunc {
 	return func(destSystem System, destAbsPath AbsPath) (TargetStateEntry, error) {
@@ -1723,7 +2667,7 @@ func (s *SourceState) newFileTargetStateEntryFunc(
 			case isEmpty(contents) && !fileAttr.Empty:
 				return &TargetStateRemove{}, nil
 			default:
-				linkname := normalizeLinkname(s.sourceDirAbsPath.Join(sourceRelPath.RelPath()).String())
+				linkname := normalizeLinkname(sourceAbsPath.String())
 				return &TargetStateSymlink{
 					lazyLinkname: newLazyLinkname(linkname),
 					sourceAttr: SourceAttr{
@@ -1739,9 +2683,10 @@ func (s *SourceState) newFileTargetStateEntryFunc(
 			}
 			if fileAttr.Template {
 				contents, err = s.ExecuteTemplateData(ExecuteTemplateDataOptions{
-					Name:        sourceRelPath.String(),
-					Data:        contents,
-					Destination: destAbsPath.String(),
+					Name:          sourceRelPath.String(),
+					Data:          contents,
+					Destination:   destAbsPath.String(),
+					SourceRelPath: sourceRelPath,
 				})
 				if err != nil {
 					return nil, err
@@ -1749,10 +2694,40 @@ func (s *SourceState) newFileTargetStateEntryFunc(
 			}
 			return contents, nil
 		}
+		if s.Linked(targetRelPath) {
+			switch contents, err := contentsFunc(); {
+			case err != nil:
+				return nil, err
+			case isEmpty(contents) && !fileAttr.Empty:
+				return &TargetStateRemove{}, nil
+			default:
+				// When generations are used, linked targets are symlinked to
+				// the current generation, which is only written by
+				// WriteLinkGeneration.
+				linkAbsPath := s.linkDirAbsPath.Join(targetRelPath)
+				linkFileAbsPath := linkAbsPath
+				if s.linkGenerations {
+					linkAbsPath = s.linkDirAbsPath.JoinString(LinkCurrentName).Join(targetRelPath)
+					linkFileAbsPath = EmptyAbsPath
+				}
+				return &TargetStateSymlink{
+					lazyLinkname: newLazyLinkname(normalizeLinkname(linkAbsPath.String())),
+					linkFile: &linkFile{
+						lazyContents: newLazyContents(contents),
+						absPath:      linkFileAbsPath,
+						perm:         s.fileAttrPerm(fileAttr) &^ 0o222,
+					},
+					sourceAttr: SourceAttr{
+						Encrypted: fileAttr.Encrypted,
+						Template:  fileAttr.Template,
+					},
+				}, nil
+			}
+		}
 		return &TargetStateFile{
 			lazyContents: newLazyContentsFunc(contentsFunc),
 			empty:        fileAttr.Empty,
-			perm:         fileAttr.perm() &^ s.umask,
+			perm:         s.fileAttrPerm(fileAttr),
 			sourceAttr: SourceAttr{
 				Encrypted: fileAttr.Encrypted,
 				Template:  fileAttr.Template,
@@ -1786,9 +2761,10 @@ func (s *SourceState) newModifyTargetStateEntryFunc(
 			}
 			if fileAttr.Template {
 				modifierContents, err = s.ExecuteTemplateData(ExecuteTemplateDataOptions{
-					Name:        sourceRelPath.String(),
-					Data:        modifierContents,
-					Destination: destAbsPath.String(),
+					Name:          sourceRelPath.String(),
+					Data:          modifierContents,
+					Destination:   destAbsPath.String(),
+					SourceRelPath: sourceRelPath,
 				})
 				if err != nil {
 					return
@@ -1859,7 +2835,7 @@ func (s *SourceState) newModifyTargetStateEntryFunc(
 		return &TargetStateFile{
 			lazyContents: newLazyContentsFunc(contentsFunc),
 			overwrite:    true,
-			perm:         fileAttr.perm() &^ s.umask,
+			perm:         s.fileAttrPerm(fileAttr),
 		}, nil
 	}
 }
@@ -1882,6 +2858,20 @@ func (s *SourceState) newScriptTargetStateEntryFunc(
 	interpreter *Interpreter,
 ) targetStateEntryFunc {
 	return func(destSystem System, destAbsPath AbsPath) (TargetStateEntry, error) {
+		targetStateScript := &TargetStateScript{
+			name:        targetRelPath,
+			condition:   fileAttr.Condition,
+			interval:    fileAttr.Interval,
+			eventBus:    s.eventBus,
+			interpreter: interpreter,
+			preRunFunc:  s.scriptPreRunFunc,
+			sourceAttr: SourceAttr{
+				Condition: fileAttr.Condition,
+			},
+			scriptLogOptions: s.scriptLogOptions,
+			scriptOptions:    defaultScriptOptions,
+			sharedState:      s.sharedState,
+		}
 		contentsFunc := func() ([]byte, error) {
 			contents, err := sourceLazyContents.Contents()
 			if err != nil {
@@ -1889,26 +2879,104 @@ func (s *SourceState) newScriptTargetStateEntryFunc(
 			}
 			if fileAttr.Template {
 				contents, err = s.ExecuteTemplateData(ExecuteTemplateDataOptions{
-					Name:        sourceRelPath.String(),
-					Data:        contents,
-					Destination: destAbsPath.String(),
+					Name:          sourceRelPath.String(),
+					Data:          contents,
+					Destination:   destAbsPath.String(),
+					SourceRelPath: sourceRelPath,
 				})
 				if err != nil {
 					return nil, err
 				}
 			}
+			contents, env, err := parseAndRemoveScriptEnvDirectives(contents)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", sourceRelPath, err)
+			}
+			for _, keyValue := range env {
+				if key, _, _ := strings.Cut(keyValue, "="); strings.HasPrefix(key, "CHEZMOI_") && s.warnFunc != nil {
+					s.warnFunc("%s: %s: overriding reserved environment variable\n", sourceRelPath, key)
+				}
+			}
+			contents, options, err := parseAndRemoveScriptOptionDirectives(contents)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", sourceRelPath, err)
+			}
+			if len(options.onChange) != 0 {
+				targetStateScript.onChangeSHA256, err = s.onChangeSHA256(destSystem, targetRelPath, options.onChange)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", sourceRelPath, err)
+				}
+			}
+			if options.scope == scriptScopeUser {
+				switch {
+				case fileAttr.Condition != ScriptConditionOnce:
+					return nil, fmt.Errorf("%s: chezmoi:script:scope=user: not a run_once_ script", sourceRelPath)
+				case s.sharedState == nil:
+					return nil, fmt.Errorf("%s: chezmoi:script:scope=user: no shared persistent state", sourceRelPath)
+				}
+			}
+			targetStateScript.env = env
+			targetStateScript.scriptOptions = options
 			return contents, nil
 		}
-		return &TargetStateScript{
-			lazyContents: newLazyContentsFunc(contentsFunc),
-			name:         targetRelPath,
-			condition:    fileAttr.Condition,
-			interpreter:  interpreter,
-			sourceAttr: SourceAttr{
-				Condition: fileAttr.Condition,
-			},
-		}, nil
+		targetStateScript.lazyContents = newLazyContentsFunc(contentsFunc)
+		return targetStateScript, nil
+	}
+}
+
+// onChangeSHA256 returns the SHA256 sum of the target states of all entries
+// that match any of patterns, excluding scripts. patterns are relative to the
+// destination directory and may start with ~/.
+func (s *SourceState) onChangeSHA256(destSystem System, scriptRelPath RelPath, patterns []string) ([]byte, error) {
+	relPatterns := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasPrefix(pattern, "~/"):
+			pattern = pattern[len("~/"):]
+		case path.IsAbs(pattern):
+			pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, s.destDirAbsPath.String()), "/")
+		}
+		relPatterns = append(relPatterns, pattern)
+	}
+
+	var builder bytes.Buffer
+	if err := s.root.ForEach(EmptyRelPath, func(targetRelPath RelPath, sourceStateEntry SourceStateEntry) error {
+		if targetRelPath == scriptRelPath {
+			return nil
+		}
+		if sourceStateFile, ok := sourceStateEntry.(*SourceStateFile); ok && sourceStateFile.Attr.Type == SourceFileTypeScript {
+			return nil
+		}
+		matched := false
+		for _, relPattern := range relPatterns {
+			if ok, _ := doublestar.Match(relPattern, targetRelPath.String()); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(destSystem, s.destDirAbsPath.Join(targetRelPath))
+		if err != nil {
+			return err
+		}
+		entryState, err := targetStateEntry.EntryState(s.umask)
+		if err != nil {
+			return err
+		}
+		data, err := stateFormat.Marshal(entryState)
+		if err != nil {
+			return err
+		}
+		builder.WriteString(targetRelPath.String())
+		builder.WriteByte(0)
+		builder.Write(data)
+		return nil
+	}); err != nil {
+		return nil, err
 	}
+	return SHA256Sum(builder.Bytes()), nil
 }
 
 // newSymlinkTargetStateEntryFunc returns a targetStateEntryFunc that returns a
@@ -1926,9 +2994,10 @@ func (s *SourceState) newSymlinkTargetStateEntryFunc(
 			}
 			if fileAttr.Template {
 				linknameBytes, err = s.ExecuteTemplateData(ExecuteTemplateDataOptions{
-					Name:        sourceRelPath.String(),
-					Data:        linknameBytes,
-					Destination: destAbsPath.String(),
+					Name:          sourceRelPath.String(),
+					Data:          linknameBytes,
+					Destination:   destAbsPath.String(),
+					SourceRelPath: sourceRelPath,
 				})
 				if err != nil {
 					return "", err
@@ -1952,7 +3021,7 @@ func (s *SourceState) newSourceStateFile(
 	targetRelPath RelPath,
 ) (RelPath, *SourceStateFile) {
 	sourceLazyContents := newLazyContentsFunc(func() ([]byte, error) {
-		contents, err := s.system.ReadFile(s.sourceDirAbsPath.Join(sourceRelPath.RelPath()))
+		contents, err := s.system.ReadFile(absPath)
 		if err != nil {
 			return nil, err
 		}
@@ -1970,7 +3039,7 @@ func (s *SourceState) newSourceStateFile(
 	case SourceFileTypeCreate:
 		targetStateEntryFunc = s.newCreateTargetStateEntryFunc(sourceRelPath, fileAttr, sourceLazyContents)
 	case SourceFileTypeFile:
-		targetStateEntryFunc = s.newFileTargetStateEntryFunc(sourceRelPath, fileAttr, sourceLazyContents)
+		targetStateEntryFunc = s.newFileTargetStateEntryFunc(absPath, sourceRelPath, fileAttr, targetRelPath, sourceLazyContents)
 	case SourceFileTypeModify:
 		// If the target has an extension, determine if it indicates an
 		// interpreter to use.
@@ -2021,8 +3090,8 @@ func (s *SourceState) newSourceStateDirEntry(
 	dirAttr := DirAttr{
 		TargetName: fileInfo.Name(),
 		Exact:      options.Exact,
-		Private:    isPrivate(fileInfo),
-		ReadOnly:   isReadOnly(fileInfo),
+		Private:    options.Private || isPrivate(fileInfo),
+		ReadOnly:   options.ReadOnly || isReadOnly(fileInfo),
 	}
 	sourceRelPath := parentSourceRelPath.Join(NewSourceRelDirPath(dirAttr.SourceName()))
 	return &SourceStateDir{
@@ -2030,7 +3099,7 @@ func (s *SourceState) newSourceStateDirEntry(
 		origin:        actualStateDir,
 		sourceRelPath: sourceRelPath,
 		targetStateEntry: &TargetStateDir{
-			perm: fs.ModePerm &^ s.umask,
+			perm: s.dirAttrPerm(DirAttr{}),
 		},
 	}
 }
@@ -2039,6 +3108,7 @@ func (s *SourceState) newSourceStateDirEntry(
 // file in s.
 func (s *SourceState) newSourceStateFileEntryFromFile(
 	actualStateFile *ActualStateFile,
+	targetRelPath RelPath,
 	fileInfo fs.FileInfo,
 	parentSourceRelPath SourceRelPath,
 	options *AddOptions,
@@ -2047,8 +3117,8 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 		TargetName: fileInfo.Name(),
 		Encrypted:  options.Encrypt,
 		Executable: IsExecutable(fileInfo),
-		Private:    isPrivate(fileInfo),
-		ReadOnly:   isReadOnly(fileInfo),
+		Private:    options.Private || isPrivate(fileInfo),
+		ReadOnly:   options.ReadOnly || isReadOnly(fileInfo),
 		Template:   options.Template,
 	}
 	if options.Create {
@@ -2062,7 +3132,10 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 	}
 	if options.AutoTemplate {
 		var replacements bool
-		contents, replacements = autoTemplate(contents, s.TemplateData())
+		contents, replacements, err = s.autoTemplate(targetRelPath, contents, options)
+		if err != nil {
+			return nil, err
+		}
 		if replacements {
 			fileAttr.Template = true
 		}
@@ -2086,15 +3159,43 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 		targetStateEntry: &TargetStateFile{
 			lazyContents: lazyContents,
 			empty:        len(contents) == 0,
-			perm:         0o666 &^ s.umask,
+			perm:         s.fileAttrPerm(FileAttr{}),
 		},
 	}, nil
 }
 
+// autoTemplate returns contents converted into a template using the auto
+// template rules in options, and if the template should be used.
+func (s *SourceState) autoTemplate(targetRelPath RelPath, contents []byte, options *AddOptions) ([]byte, bool, error) {
+	rules := options.AutoTemplateRules
+	if len(rules) == 0 {
+		rules = []AutoTemplateRule{autoTemplateDataRule}
+	}
+	templateData := s.TemplateData()
+	var substitutions []AutoTemplateSubstitution
+	for _, rule := range rules {
+		substitutions = append(substitutions, rule(templateData)...)
+	}
+	templateContents, replacements := autoTemplate(contents, substitutions)
+	if !replacements {
+		return contents, false, nil
+	}
+	if options.AutoTemplateFunc != nil {
+		switch useTemplate, err := options.AutoTemplateFunc(targetRelPath, contents, templateContents); {
+		case err != nil:
+			return nil, false, err
+		case !useTemplate:
+			return contents, false, nil
+		}
+	}
+	return templateContents, true, nil
+}
+
 // newSourceStateFileEntryFromSymlink returns a SourceStateEntry constructed
 // from a symlink in s.
 func (s *SourceState) newSourceStateFileEntryFromSymlink(
 	actualStateSymlink *ActualStateSymlink,
+	targetRelPath RelPath,
 	fileInfo fs.FileInfo,
 	parentSourceRelPath SourceRelPath,
 	options *AddOptions,
@@ -2107,7 +3208,10 @@ func (s *SourceState) newSourceStateFileEntryFromSymlink(
 	template := false
 	switch {
 	case options.AutoTemplate:
-		contents, template = autoTemplate(contents, s.TemplateData())
+		contents, template, err = s.autoTemplate(targetRelPath, contents, options)
+		if err != nil {
+			return nil, err
+		}
 	case options.Template:
 		template = true
 	case !options.Template && options.TemplateSymlinks:
@@ -2134,7 +3238,7 @@ func (s *SourceState) newSourceStateFileEntryFromSymlink(
 		lazyContents:  lazyContents,
 		targetStateEntry: &TargetStateFile{
 			lazyContents: lazyContents,
-			perm:         0o666 &^ s.umask,
+			perm:         s.fileAttrPerm(FileAttr{}),
 		},
 	}, nil
 }
@@ -2150,7 +3254,7 @@ func (s *SourceState) populateImplicitParentDirs(
 			&SourceStateImplicitDir{
 				origin: external,
 				targetStateEntry: &TargetStateDir{
-					perm: fs.ModePerm &^ s.umask,
+					perm: s.dirAttrPerm(DirAttr{}),
 				},
 			},
 		)
@@ -2171,7 +3275,7 @@ func (s *SourceState) readExternal(
 		return s.readExternalArchive(ctx, externalRelPath, parentSourceRelPath, external, options)
 	case ExternalTypeArchiveFile:
 		return s.readExternalArchiveFile(ctx, externalRelPath, parentSourceRelPath, external, options)
-	case ExternalTypeFile:
+	case ExternalTypeFile, ExternalTypeTemplate:
 		return s.readExternalFile(ctx, externalRelPath, parentSourceRelPath, external, options)
 	case ExternalTypeGitRepo:
 		return nil, nil
@@ -2203,7 +3307,7 @@ func (s *SourceState) readExternalArchive(
 		origin:        external,
 		sourceRelPath: parentSourceRelPath.Join(NewSourceRelPath(dirAttr.SourceName())),
 		targetStateEntry: &TargetStateDir{
-			perm: fs.ModePerm &^ s.umask,
+			perm: s.dirAttrPerm(DirAttr{}),
 			sourceAttr: SourceAttr{
 				External: true,
 			},
@@ -2303,7 +3407,7 @@ func (s *SourceState) readExternalArchive(
 			targetStateEntry := &TargetStateFile{
 				lazyContents: lazyContents,
 				empty:        fileAttr.Empty,
-				perm:         fileAttr.perm() &^ s.umask,
+				perm:         s.fileAttrPerm(fileAttr),
 				sourceAttr: SourceAttr{
 					External: true,
 				},
@@ -2388,6 +3492,18 @@ func (s *SourceState) readExternalArchiveFile(
 	if external.ArchivePath == "" {
 		return nil, fmt.Errorf("%s: missing path", externalRelPath)
 	}
+	if !doublestar.ValidatePattern(external.ArchivePath) {
+		return nil, fmt.Errorf("%s: %s: invalid pattern", externalRelPath, external.ArchivePath)
+	}
+	isPattern := strings.ContainsAny(external.ArchivePath, `*?[{\`)
+	matchArchivePath := func(name string) bool {
+		if !isPattern {
+			return name == external.ArchivePath
+		}
+		// The pattern was validated above, so the error can be ignored.
+		match, _ := doublestar.Match(external.ArchivePath, name)
+		return match
+	}
 
 	data, format, err := s.readExternalArchiveData(ctx, externalRelPath, external, options)
 	if err != nil {
@@ -2406,13 +3522,17 @@ func (s *SourceState) readExternalArchiveFile(
 		switch {
 		case name == "":
 			return nil
-		case name != external.ArchivePath:
+		case !matchArchivePath(name):
 			// If this entry is a directory and it cannot contain the file we
 			// are looking for then skip this directory.
-			if fileInfo.IsDir() && !strings.HasPrefix(external.ArchivePath, name) {
+			if !isPattern && fileInfo.IsDir() && !strings.HasPrefix(external.ArchivePath, name) {
 				return fs.SkipDir
 			}
 			return nil
+		case fileInfo.IsDir():
+			// A pattern can match directories as well as files, but only
+			// files are extracted.
+			return nil
 		case fileInfo.Mode()&fs.ModeType == 0:
 			contents, err := io.ReadAll(r)
 			if err != nil {
@@ -2423,7 +3543,12 @@ func (s *SourceState) readExternalArchiveFile(
 				return nil
 			}
 
-			lazyContents := newLazyContents(contents)
+			lazyContents := newLazyContentsFunc(func() ([]byte, error) {
+				if err := verifyExternalExecutable(ctx, externalRelPath, external, contents); err != nil {
+					return nil, err
+				}
+				return contents, nil
+			})
 			fileAttr := FileAttr{
 				TargetName: fileInfo.Name(),
 				Type:       SourceFileTypeFile,
@@ -2436,7 +3561,7 @@ func (s *SourceState) readExternalArchiveFile(
 			targetStateEntry := &TargetStateFile{
 				lazyContents: lazyContents,
 				empty:        fileAttr.Empty,
-				perm:         fileAttr.perm() &^ s.umask,
+				perm:         s.fileAttrPerm(fileAttr),
 				sourceAttr: SourceAttr{
 					External: true,
 				},
@@ -2483,6 +3608,45 @@ func (s *SourceState) readExternalArchiveFile(
 	}), nil
 }
 
+// verifyExternalExecutable verifies that data, the contents of external at
+// externalRelPath, is an executable that runs successfully with the args of
+// external's postExtract and whose output matches external's postExtract
+// output. It does nothing if external has no postExtract args.
+func verifyExternalExecutable(ctx context.Context, externalRelPath RelPath, external *External, data []byte) error {
+	if len(external.PostExtract.Args) == 0 {
+		return nil
+	}
+
+	var outputRx *regexp.Regexp
+	if external.PostExtract.Output != "" {
+		var err error
+		if outputRx, err = regexp.Compile(external.PostExtract.Output); err != nil {
+			return fmt.Errorf("%s: postExtract.output: %w", externalRelPath, err)
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "chezmoi-external")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	executablePath := filepath.Join(tempDir, externalRelPath.Base())
+	if err := os.WriteFile(executablePath, data, 0o700); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, executablePath, external.PostExtract.Args...) //nolint:gosec
+	output, err := chezmoilog.LogCmdCombinedOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", externalRelPath, external.URL, err)
+	}
+	if outputRx != nil && !outputRx.Match(output) {
+		format := "%s: %s: output %q does not match %q"
+		return fmt.Errorf(format, externalRelPath, external.URL, bytes.TrimSpace(output), external.PostExtract.Output)
+	}
+	return nil
+}
+
 // ReadExternalDir returns all source state entries in an external_ dir.
 func (s *SourceState) readExternalDir(
 	rootSourceAbsPath AbsPath,
@@ -2527,7 +3691,7 @@ func (s *SourceState) readExternalDir(
 				targetStateEntry: &TargetStateFile{
 					lazyContents: lazyContents,
 					empty:        true,
-					perm:         fileAttr.perm() &^ s.umask,
+					perm:         s.fileAttrPerm(fileAttr),
 				},
 			}
 		case fs.ModeDir:
@@ -2542,7 +3706,7 @@ func (s *SourceState) readExternalDir(
 				sourceRelPath: rootSourceRelPath.Join(relPath.SourceRelDirPath()),
 				Attr:          dirAttr,
 				targetStateEntry: &TargetStateDir{
-					perm: dirAttr.perm() &^ s.umask,
+					perm: s.dirAttrPerm(dirAttr),
 				},
 			}
 		case fs.ModeSymlink:
@@ -2578,7 +3742,8 @@ func (s *SourceState) readExternalDir(
 	return sourceStateEntries, nil
 }
 
-// readExternalFile reads an external file and returns its SourceStateEntries.
+// readExternalFile reads an external file or template and returns its
+// SourceStateEntries.
 func (s *SourceState) readExternalFile(
 	ctx context.Context,
 	externalRelPath RelPath,
@@ -2587,7 +3752,26 @@ func (s *SourceState) readExternalFile(
 	options *ReadOptions,
 ) (map[RelPath][]SourceStateEntry, error) {
 	lazyContents := newLazyContentsFunc(func() ([]byte, error) {
-		return s.getExternalData(ctx, externalRelPath, external, options)
+		data, err := s.getExternalData(ctx, externalRelPath, external, options)
+		if err != nil {
+			return nil, err
+		}
+		if external.Type == ExternalTypeTemplate {
+			// Execute remote templates with the local template data, so that
+			// shared configs can be parameterized per machine.
+			data, err = s.ExecuteTemplateData(ExecuteTemplateDataOptions{
+				Name:        external.URL,
+				Data:        data,
+				Destination: s.destDirAbsPath.Join(externalRelPath).String(),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := verifyExternalExecutable(ctx, externalRelPath, external, data); err != nil {
+			return nil, err
+		}
+		return data, nil
 	})
 	fileAttr := FileAttr{
 		Empty:      true,
@@ -2596,7 +3780,7 @@ func (s *SourceState) readExternalFile(
 	targetStateEntry := &TargetStateFile{
 		lazyContents: lazyContents,
 		empty:        fileAttr.Empty,
-		perm:         fileAttr.perm() &^ s.umask,
+		perm:         s.fileAttrPerm(fileAttr),
 		sourceAttr: SourceAttr{
 			External: true,
 		},
@@ -2614,7 +3798,10 @@ func (s *SourceState) readExternalFile(
 }
 
 // readScriptsDir reads all scripts in scriptsDirAbsPath.
-func (s *SourceState) readScriptsDir(ctx context.Context, scriptsDirAbsPath AbsPath) (map[RelPath][]SourceStateEntry, error) {
+func (s *SourceState) readScriptsDir(
+	ctx context.Context,
+	sourceDirAbsPath, scriptsDirAbsPath AbsPath,
+) (map[RelPath][]SourceStateEntry, error) {
 	var allSourceStateEntriesMu sync.Mutex
 	allSourceStateEntries := make(map[RelPath][]SourceStateEntry)
 	addSourceStateEntry := func(relPath RelPath, sourceStateEntry SourceStateEntry) {
@@ -2645,7 +3832,7 @@ func (s *SourceState) readScriptsDir(ctx context.Context, scriptsDirAbsPath AbsP
 		}
 
 		sourceRelPath := SourceRelPath{
-			relPath: sourceAbsPath.MustTrimDirPrefix(s.sourceDirAbsPath),
+			relPath: sourceAbsPath.MustTrimDirPrefix(sourceDirAbsPath),
 			isDir:   fileInfo.IsDir(),
 		}
 		parentSourceRelPath, sourceName := sourceRelPath.Split()
@@ -2723,14 +3910,35 @@ func (s *SourceState) sourceStateEntry(
 	case *ActualStateDir:
 		return s.newSourceStateDirEntry(actualStateEntry, fileInfo, parentSourceRelPath, options), nil
 	case *ActualStateFile:
-		return s.newSourceStateFileEntryFromFile(actualStateEntry, fileInfo, parentSourceRelPath, options)
+		targetRelPath := destAbsPath.MustTrimDirPrefix(s.destDirAbsPath)
+		return s.newSourceStateFileEntryFromFile(actualStateEntry, targetRelPath, fileInfo, parentSourceRelPath, options)
 	case *ActualStateSymlink:
-		return s.newSourceStateFileEntryFromSymlink(actualStateEntry, fileInfo, parentSourceRelPath, options)
+		targetRelPath := destAbsPath.MustTrimDirPrefix(s.destDirAbsPath)
+		return s.newSourceStateFileEntryFromSymlink(actualStateEntry, targetRelPath, fileInfo, parentSourceRelPath, options)
 	default:
 		panic(fmt.Sprintf("%T: unsupported type", actualStateEntry))
 	}
 }
 
+// cacheKey returns the key under which the data downloaded for e is cached.
+// Externals with the same URL but different headers or credentials may receive
+// different data, so these are part of the key. Externals without headers or
+// credentials are keyed by their URL alone.
+func (e *External) cacheKey() string {
+	if len(e.Headers) == 0 && e.BasicAuth == (externalBasicAuth{}) {
+		return e.URL
+	}
+	var sb strings.Builder
+	sb.WriteString(e.URL)
+	for _, key := range chezmoimaps.SortedKeys(e.Headers) {
+		sb.WriteString("\x00" + key + ": " + e.Headers[key])
+	}
+	if e.BasicAuth != (externalBasicAuth{}) {
+		sb.WriteString("\x00" + e.BasicAuth.Username + ":" + e.BasicAuth.Password)
+	}
+	return sb.String()
+}
+
 func (e *External) Path() AbsPath {
 	return e.sourceAbsPath
 }
@@ -14,6 +14,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/Shopify/ejson"
 	"github.com/alecthomas/assert/v2"
 	"github.com/coreos/go-semver/semver"
 	vfs "github.com/twpayne/go-vfs/v4"
@@ -788,6 +789,41 @@ func TestSourceStateApplyAll(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "links",
+			root: map[string]any{
+				"/home/user": map[string]any{
+					".local/share/chezmoi": map[string]any{
+						".chezmoilinks": ".dir\n",
+						"dot_dir": map[string]any{
+							"file.tmpl": `{{ "# contents of .dir/file" }}` + "\n",
+						},
+						"dot_file": "# contents of .file\n",
+					},
+				},
+			},
+			sourceStateOptions: []SourceStateOption{
+				WithLinkDir(NewAbsPath("/home/user/.local/share/chezmoi-links")),
+			},
+			tests: []any{
+				vfst.TestPath("/home/user/.dir",
+					vfst.TestIsDir,
+				),
+				vfst.TestPath("/home/user/.dir/file",
+					vfst.TestModeType(fs.ModeSymlink),
+					vfst.TestContentsString("# contents of .dir/file\n"),
+				),
+				vfst.TestPath("/home/user/.local/share/chezmoi-links/.dir/file",
+					vfst.TestModeIsRegular,
+					vfst.TestModePerm(0o444&^chezmoitest.Umask),
+					vfst.TestContentsString("# contents of .dir/file\n"),
+				),
+				vfst.TestPath("/home/user/.file",
+					vfst.TestModeIsRegular,
+					vfst.TestContentsString("# contents of .file\n"),
+				),
+			},
+		},
 		{
 			name: "symlink_template",
 			root: map[string]any{
@@ -1016,6 +1052,7 @@ func TestSourceStateRead(t *testing.T) {
 							sourceAttr: SourceAttr{
 								Condition: ScriptConditionAlways,
 							},
+							scriptOptions: defaultScriptOptions,
 						},
 					},
 				}),
@@ -1046,6 +1083,7 @@ func TestSourceStateRead(t *testing.T) {
 							sourceAttr: SourceAttr{
 								Condition: ScriptConditionAlways,
 							},
+							scriptOptions: defaultScriptOptions,
 						},
 					},
 				}),
@@ -1214,7 +1252,7 @@ func TestSourceStateRead(t *testing.T) {
 			expectedSourceState: NewSourceState(
 				withEntries(map[RelPath]SourceStateEntry{
 					NewRelPath("file"): &SourceStateRemove{
-						origin:        SourceStateOriginRemove{},
+						origin:        SourceStateOriginRemovePatterns{},
 						sourceRelPath: NewSourceRelPath(".chezmoiremove"),
 						targetRelPath: NewRelPath("file"),
 					},
@@ -1241,7 +1279,7 @@ func TestSourceStateRead(t *testing.T) {
 			expectedSourceState: NewSourceState(
 				withEntries(map[RelPath]SourceStateEntry{
 					NewRelPath("file1"): &SourceStateRemove{
-						origin:        SourceStateOriginRemove{},
+						origin:        SourceStateOriginRemovePatterns{},
 						sourceRelPath: NewSourceRelPath(".chezmoiremove"),
 						targetRelPath: NewRelPath("file1"),
 					},
@@ -1288,7 +1326,7 @@ func TestSourceStateRead(t *testing.T) {
 						},
 					},
 					NewRelPath("dir/file1"): &SourceStateRemove{
-						origin:        SourceStateOriginRemove{},
+						origin:        SourceStateOriginRemovePatterns{},
 						sourceRelPath: NewSourceRelPath(".chezmoiremove"),
 						targetRelPath: NewRelPath("dir/file1"),
 					},
@@ -1495,6 +1533,77 @@ func TestSourceStateRead(t *testing.T) {
 	}
 }
 
+func TestSourceStateDefaultModes(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		defaultModes           DefaultModes
+		umask                  fs.FileMode
+		private                bool
+		expectedDirPerm        fs.FileMode
+		expectedExecutablePerm fs.FileMode
+		expectedFilePerm       fs.FileMode
+	}{
+		{
+			name:                   "umask_022",
+			umask:                  0o022,
+			expectedDirPerm:        0o755,
+			expectedExecutablePerm: 0o755,
+			expectedFilePerm:       0o644,
+		},
+		{
+			name:                   "umask_077",
+			umask:                  0o077,
+			expectedDirPerm:        0o700,
+			expectedExecutablePerm: 0o700,
+			expectedFilePerm:       0o600,
+		},
+		{
+			name: "default_modes_override_umask",
+			defaultModes: DefaultModes{
+				Dir:        0o755,
+				Executable: 0o755,
+				File:       0o644,
+			},
+			umask:                  0o077,
+			expectedDirPerm:        0o755,
+			expectedExecutablePerm: 0o755,
+			expectedFilePerm:       0o644,
+		},
+		{
+			name: "partial_default_modes",
+			defaultModes: DefaultModes{
+				File: 0o640,
+			},
+			umask:                  0o022,
+			expectedDirPerm:        0o755,
+			expectedExecutablePerm: 0o755,
+			expectedFilePerm:       0o640,
+		},
+		{
+			name: "private_restricts_default_modes",
+			defaultModes: DefaultModes{
+				Dir:        0o755,
+				Executable: 0o755,
+				File:       0o644,
+			},
+			private:                true,
+			expectedDirPerm:        0o700,
+			expectedExecutablePerm: 0o700,
+			expectedFilePerm:       0o600,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewSourceState(
+				WithDefaultModes(tc.defaultModes),
+				WithUmask(tc.umask),
+			)
+			assert.Equal(t, tc.expectedDirPerm, s.dirAttrPerm(DirAttr{Private: tc.private}))
+			assert.Equal(t, tc.expectedExecutablePerm, s.fileAttrPerm(FileAttr{Executable: true, Private: tc.private}))
+			assert.Equal(t, tc.expectedFilePerm, s.fileAttrPerm(FileAttr{Private: tc.private}))
+		})
+	}
+}
+
 func TestSourceStateReadExternal(t *testing.T) {
 	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte("data"))
@@ -1740,6 +1849,35 @@ func TestSourceStateTargetRelPaths(t *testing.T) {
 				NewRelPath("3after"),
 			},
 		},
+		{
+			name: "chezmoiconditions",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiconditions": chezmoitest.JoinLines(
+						`# comment`,
+						`file1 true`,
+						`file2 false`,
+						`dir1 eq "a" "b"`,
+					),
+					"dir1": map[string]any{
+						"file": "",
+					},
+					"dir2": map[string]any{
+						".chezmoiconditions":   "file* .enabled\n",
+						".chezmoidirdata.yaml": "enabled: false\n",
+						"file":                 "",
+						"other":                "",
+					},
+					"file1": "",
+					"file2": "",
+				},
+			},
+			expectedTargetRelPaths: []RelPath{
+				NewRelPath("dir2"),
+				NewRelPath("dir2/other"),
+				NewRelPath("file1"),
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
@@ -1757,6 +1895,53 @@ func TestSourceStateTargetRelPaths(t *testing.T) {
 	}
 }
 
+func TestSourceStateEncryptedTemplateData(t *testing.T) {
+	encryption := &xorEncryption{
+		key: 0x55,
+	}
+	encryptedYAML, err := encryption.Encrypt([]byte(chezmoitest.JoinLines(
+		"age:",
+		"  key: ageValue",
+	)))
+	assert.NoError(t, err)
+
+	publicKey, privateKey, err := ejson.GenerateKeypair()
+	assert.NoError(t, err)
+	encryptedEJSON := &bytes.Buffer{}
+	_, err = ejson.Encrypt(bytes.NewBufferString(`{"_public_key":"`+publicKey+`","ejson":{"key":"ejsonValue"}}`), encryptedEJSON)
+	assert.NoError(t, err)
+
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			".chezmoidata.ejson":    encryptedEJSON.String(),
+			".chezmoidata.yaml.xor": string(encryptedYAML),
+			".chezmoidata.toml": chezmoitest.JoinLines(
+				`[plain]`,
+				`    key = "plainValue"`,
+			),
+		},
+	}, func(fileSystem vfs.FS) {
+		ctx := context.Background()
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithEJSONKey("", func() (string, error) {
+				return privateKey, nil
+			}),
+			WithEncryption(encryption),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(ctx, nil))
+		templateData := s.TemplateData()
+		assert.Equal(t, any(map[string]any{"key": "ageValue"}), templateData["age"])
+		assert.Equal(t, any(map[string]any{"key": "ejsonValue"}), templateData["ejson"])
+		assert.Equal(t, any(map[string]any{"key": "plainValue"}), templateData["plain"])
+		_, ok := templateData[ejsonPublicKeyKey]
+		assert.False(t, ok)
+	})
+}
+
 func TestTemplateOptionsParseDirectives(t *testing.T) {
 	for _, tc := range []struct {
 		name            string
@@ -2002,3 +2187,102 @@ func manyScripts(amount int) map[string]any {
 	}
 	return scripts
 }
+
+func TestParsePatternsSectionHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		text               string
+		expectedConditions []patternsSectionCondition
+		expectedOK         bool
+	}{
+		{
+			name: "pattern",
+			text: ".config/app",
+		},
+		{
+			name: "character_class",
+			text: "[abc]",
+		},
+		{
+			name: "empty",
+			text: "[]",
+		},
+		{
+			name:       "all",
+			text:       "[*]",
+			expectedOK: true,
+		},
+		{
+			name: "equal",
+			text: "[os=darwin]",
+			expectedConditions: []patternsSectionCondition{
+				{key: "os", value: "darwin"},
+			},
+			expectedOK: true,
+		},
+		{
+			name: "multiple",
+			text: "[os!=windows arch=amd64]",
+			expectedConditions: []patternsSectionCondition{
+				{key: "os", negate: true, value: "windows"},
+				{key: "arch", value: "amd64"},
+			},
+			expectedOK: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualConditions, actualOK := parsePatternsSectionHeader(tc.text)
+			assert.Equal(t, tc.expectedConditions, actualConditions)
+			assert.Equal(t, tc.expectedOK, actualOK)
+		})
+	}
+}
+
+func TestEvaluatePatternsSectionConditions(t *testing.T) {
+	chezmoiTemplateData := map[string]any{
+		"arch": "amd64",
+		"os":   "linux",
+	}
+	for _, tc := range []struct {
+		name          string
+		text          string
+		expected      bool
+		expectedError string
+	}{
+		{
+			name:     "all",
+			text:     "[*]",
+			expected: true,
+		},
+		{
+			name:     "equal",
+			text:     "[os=linux]",
+			expected: true,
+		},
+		{
+			name: "not_equal",
+			text: "[os!=linux]",
+		},
+		{
+			name: "one_false",
+			text: "[os=linux arch=arm64]",
+		},
+		{
+			name:          "unknown",
+			text:          "[unknown=value]",
+			expectedError: "unknown: unknown variable",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conditions, ok := parsePatternsSectionHeader(tc.text)
+			assert.True(t, ok)
+			actual, err := evaluatePatternsSectionConditions(conditions, chezmoiTemplateData)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
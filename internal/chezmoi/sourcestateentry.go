@@ -88,6 +88,10 @@ type SourceStateRemove struct {
 // FIXME remove this when the sources of all removes are tracked.
 type SourceStateOriginRemove struct{}
 
+// A SourceStateOriginRemovePatterns is used for removes that match a pattern in
+// a .chezmoiremove file.
+type SourceStateOriginRemovePatterns struct{}
+
 // Evaluate evaluates s and returns any error.
 func (s *SourceStateCommand) Evaluate() error {
 	return nil
@@ -284,3 +288,13 @@ func (s SourceStateOriginRemove) Path() AbsPath {
 func (s SourceStateOriginRemove) OriginString() string {
 	return "remove"
 }
+
+// Path returns s's path.
+func (s SourceStateOriginRemovePatterns) Path() AbsPath {
+	return EmptyAbsPath
+}
+
+// OriginString returns s's origin.
+func (s SourceStateOriginRemovePatterns) OriginString() string {
+	return removeName
+}
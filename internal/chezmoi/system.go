@@ -3,6 +3,7 @@ package chezmoi
 import (
 	"context"
 	"errors"
+	"io"
 	"io/fs"
 	"os/exec"
 	"sort"
@@ -11,11 +12,17 @@ import (
 
 	vfs "github.com/twpayne/go-vfs/v4"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 )
 
 type RunScriptOptions struct {
 	Interpreter *Interpreter
 	Condition   ScriptCondition
+	Env         []string
+	PreRunFunc  func() error
+	Stdout      io.Writer
+	Stderr      io.Writer
 }
 
 // A System reads from and writes to a filesystem, runs scripts, and persists
@@ -101,6 +108,65 @@ func (noUpdateSystemMixin) WriteSymlink(oldname string, newname AbsPath) error {
 	panic("update to no update system")
 }
 
+// MoveAll moves oldpath to newpath in system. If oldpath and newpath are on
+// different filesystems then MoveAll copies oldpath to newpath recursively and
+// then removes oldpath.
+func MoveAll(system System, oldpath, newpath AbsPath) error {
+	switch err := system.Rename(oldpath, newpath); {
+	case err == nil:
+		return nil
+	case !isCrossDeviceError(err):
+		return err
+	}
+	if err := copyAll(system, oldpath, newpath); err != nil {
+		// Remove any partial copy so that oldpath is left as it was.
+		return chezmoierrors.Combine(err, system.RemoveAll(newpath))
+	}
+	return system.RemoveAll(oldpath)
+}
+
+// copyAll copies oldpath to newpath in system recursively.
+func copyAll(system System, oldpath, newpath AbsPath) error {
+	fileInfo, err := system.Lstat(oldpath)
+	if err != nil {
+		return err
+	}
+	switch fileInfo.Mode().Type() {
+	case fs.ModeDir:
+		if err := system.Mkdir(newpath, fileInfo.Mode().Perm()); err != nil {
+			return err
+		}
+		dirEntries, err := system.ReadDir(oldpath)
+		if err != nil {
+			return err
+		}
+		for _, dirEntry := range dirEntries {
+			name := dirEntry.Name()
+			if err := copyAll(system, oldpath.JoinString(name), newpath.JoinString(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 0:
+		data, err := system.ReadFile(oldpath)
+		if err != nil {
+			return err
+		}
+		return system.WriteFile(newpath, data, fileInfo.Mode().Perm())
+	case fs.ModeSymlink:
+		linkname, err := system.Readlink(oldpath)
+		if err != nil {
+			return err
+		}
+		return system.WriteSymlink(linkname, newpath)
+	default:
+		return &unsupportedFileTypeError{
+			absPath: oldpath,
+			mode:    fileInfo.Mode(),
+		}
+	}
+}
+
 // MkdirAll is the equivalent of os.MkdirAll but operates on system.
 func MkdirAll(system System, absPath AbsPath, perm fs.FileMode) error {
 	switch err := system.Mkdir(absPath, perm); {
@@ -169,9 +235,9 @@ type concurrentWalkSourceDirFunc func(ctx context.Context, absPath AbsPath, file
 // WalkSourceDir does not follow symbolic links found in directories, but if
 // sourceDirAbsPath itself is a symbolic link, its target will be walked.
 //
-// Directory entries .chezmoidata.<format> and .chezmoitemplates are visited
-// before all other entries. All other entries are visited in alphabetical
-// order.
+// Directory entries .chezmoidata.<format>, .chezmoidatasources.<format>, and
+// .chezmoitemplates are visited before all other entries. All other entries
+// are visited in alphabetical order.
 func WalkSourceDir(system System, sourceDirAbsPath AbsPath, walkFunc WalkFunc) error {
 	fileInfo, err := system.Stat(sourceDirAbsPath)
 	if err != nil {
@@ -189,11 +255,27 @@ func WalkSourceDir(system System, sourceDirAbsPath AbsPath, walkFunc WalkFunc) e
 // source directory. More negative values are visited first. Entries with the
 // same order are visited alphabetically. The default order is zero.
 var sourceDirEntryOrder = map[string]int{
-	VersionName:        -3,
-	dataName + ".json": -2,
-	dataName + ".toml": -2,
-	dataName + ".yaml": -2,
-	TemplatesDirName:   -1,
+	VersionName:                                -3,
+	dataName + ".json":                         -2,
+	dataName + ".json" + DefaultAgeSuffix:      -2,
+	dataName + ".json" + DefaultGPGSuffix:      -2,
+	dataName + ".toml":                         -2,
+	dataName + ".toml" + DefaultAgeSuffix:      -2,
+	dataName + ".toml" + DefaultGPGSuffix:      -2,
+	dataName + ".yaml":                         -2,
+	dataName + ".yaml" + DefaultAgeSuffix:      -2,
+	dataName + ".yaml" + DefaultGPGSuffix:      -2,
+	dataName + ejsonExtension:                  -2,
+	dataSourcesName + ".json":                  -2,
+	dataSourcesName + ".json" + TemplateSuffix: -2,
+	dataSourcesName + ".toml":                  -2,
+	dataSourcesName + ".toml" + TemplateSuffix: -2,
+	dataSourcesName + ".yaml":                  -2,
+	dataSourcesName + ".yaml" + TemplateSuffix: -2,
+	dirDataName + ".json":                      -2,
+	dirDataName + ".toml":                      -2,
+	dirDataName + ".yaml":                      -2,
+	TemplatesDirName:                           -1,
 }
 
 // walkSourceDir is a helper function for WalkSourceDir.
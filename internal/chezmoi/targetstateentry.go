@@ -3,11 +3,19 @@ package chezmoi
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 )
 
 // A TargetStateEntry represents the state of an entry in the target state.
@@ -53,18 +61,36 @@ type TargetStateRemove struct{}
 // A TargetStateScript represents the state of a script.
 type TargetStateScript struct {
 	*lazyContents
-	name        RelPath
-	interpreter *Interpreter
-	condition   ScriptCondition
-	sourceAttr  SourceAttr
+	name             RelPath
+	interpreter      *Interpreter
+	condition        ScriptCondition
+	interval         time.Duration
+	env              []string
+	eventBus         *EventBus
+	onChangeSHA256   []byte
+	preRunFunc       func() error
+	sourceAttr       SourceAttr
+	scriptLogOptions ScriptLogOptions
+	scriptOptions    scriptOptions
+	sharedState      SharedPersistentState
 }
 
 // A TargetStateSymlink represents the state of a symlink in the target state.
 type TargetStateSymlink struct {
 	*lazyLinkname
+	linkFile   *linkFile
 	sourceAttr SourceAttr
 }
 
+// A linkFile is a file in the link directory that a symlink points to. If
+// absPath is empty then the file is in a generation of the link directory and
+// is not written when the symlink is applied.
+type linkFile struct {
+	*lazyContents
+	absPath AbsPath
+	perm    fs.FileMode
+}
+
 // A modifyDirWithCmdState records the state of a directory modified by a
 // command.
 type modifyDirWithCmdState struct {
@@ -163,7 +189,15 @@ func (t *TargetStateDir) Apply(
 	if err := actualStateEntry.Remove(system); err != nil {
 		return false, err
 	}
-	return true, system.Mkdir(actualStateEntry.Path(), t.perm)
+	if err := system.Mkdir(actualStateEntry.Path(), t.perm); err != nil {
+		return false, err
+	}
+	// Mkdir is subject to the process's umask, so set the permissions
+	// explicitly if the umask removes any of them.
+	if runtime.GOOS != "windows" && t.perm&Umask != 0 {
+		return true, system.Chmod(actualStateEntry.Path(), t.perm)
+	}
+	return true, nil
 }
 
 // EntryState returns t's entry state.
@@ -326,6 +360,7 @@ func (t *TargetStateScript) Apply(
 	if err != nil {
 		return false, err
 	}
+	scriptStateKey := []byte(hex.EncodeToString(contentsSHA256))
 
 	contents, err := t.Contents()
 	if err != nil {
@@ -333,15 +368,114 @@ func (t *TargetStateScript) Apply(
 	}
 	runAt := time.Now().UTC()
 	if !isEmpty(contents) {
-		if err := system.RunScript(t.name, actualStateEntry.Path().Dir(), contents, RunScriptOptions{
+		// Only systems that really execute scripts call PreRunFunc, so use it
+		// to detect whether the script was executed and should be logged.
+		executed := false
+		attempts := 0
+		locked := false
+		ranElsewhere := false
+		runScriptOptions := RunScriptOptions{
 			Condition:   t.condition,
+			Env:         t.env,
 			Interpreter: t.interpreter,
-		}); err != nil {
-			return false, err
+			PreRunFunc: func() error {
+				// Take the shared lock so that the script is not run by
+				// another machine at the same time.
+				if t.userScope() && !locked {
+					switch ok, err := t.sharedState.TryLock(string(scriptStateKey)); {
+					case err != nil:
+						return err
+					case !ok:
+						return fmt.Errorf("%s: script is being run on another machine", t.name)
+					}
+					locked = true
+					// Another machine may have run the script between
+					// SkipApply reading the shared state and taking the lock,
+					// so read it again.
+					switch scriptState, err := t.sharedState.Get(ScriptStateBucket, scriptStateKey); {
+					case err != nil:
+						return err
+					case scriptState != nil:
+						ranElsewhere = true
+						return errScriptRanElsewhere
+					}
+				}
+				if t.preRunFunc != nil {
+					if err := t.preRunFunc(); err != nil {
+						return err
+					}
+				}
+				executed = true
+				t.eventBus.Emit(&Event{
+					Type:    EventTypeScriptStarted,
+					Name:    t.name.String(),
+					Attempt: attempts,
+				})
+				return nil
+			},
+		}
+		var runErr error
+		var stdout, stderr *tailWriter
+		retryDelay := t.scriptOptions.retryDelay
+		for {
+			attempts++
+			stdout = newTailWriter(t.scriptLogOptions.MaxOutputSize)
+			stderr = newTailWriter(t.scriptLogOptions.MaxOutputSize)
+			if t.scriptLogOptions.CaptureOutput {
+				runScriptOptions.Stdout = stdout
+				runScriptOptions.Stderr = stderr
+			}
+			runErr = system.RunScript(t.name, actualStateEntry.Path().Dir(), contents, runScriptOptions)
+			if runErr == nil || !executed || attempts > t.scriptOptions.retries {
+				break
+			}
+			time.Sleep(retryDelay)
+			retryDelay *= 2
+			if retryDelay > maxScriptRetryDelay {
+				retryDelay = maxScriptRetryDelay
+			}
+		}
+		if ranElsewhere {
+			runErr = nil
+		}
+		if locked {
+			if runErr == nil && !ranElsewhere {
+				runErr = PersistentStateSet(t.sharedState, ScriptStateBucket, scriptStateKey, &scriptState{
+					Name:  t.name,
+					RunAt: runAt,
+				})
+			}
+			runErr = chezmoierrors.Combine(runErr, t.sharedState.Unlock(string(scriptStateKey)))
+		}
+		if executed {
+			scriptLogEntry := newScriptLogEntry(t.name, runAt, runErr)
+			scriptLogEntry.Attempts = attempts
+			scriptLogEntry.Stdout = stdout.String()
+			scriptLogEntry.Stderr = stderr.String()
+			t.eventBus.Emit(&Event{
+				Type:     EventTypeScriptFinished,
+				Name:     t.name.String(),
+				Attempt:  attempts,
+				ExitCode: scriptLogEntry.ExitCode,
+				Duration: scriptLogEntry.Duration,
+				Error:    scriptLogEntry.Error,
+			})
+			if err := addScriptLogEntry(persistentState, scriptLogEntry, t.scriptLogOptions.MaxEntries); err != nil {
+				return false, chezmoierrors.Combine(runErr, err)
+			}
+		}
+		if runErr != nil {
+			switch t.scriptOptions.onError {
+			case scriptOnErrorContinue:
+				return false, nil
+			case scriptOnErrorAbort:
+				return false, &AbortError{Err: runErr}
+			default:
+				return false, runErr
+			}
 		}
 	}
 
-	scriptStateKey := []byte(hex.EncodeToString(contentsSHA256))
 	if err := PersistentStateSet(persistentState, ScriptStateBucket, scriptStateKey, &scriptState{
 		Name:  t.name,
 		RunAt: runAt,
@@ -349,6 +483,15 @@ func (t *TargetStateScript) Apply(
 		return false, err
 	}
 
+	if t.condition == ScriptConditionEvery {
+		if err := PersistentStateSet(persistentState, ScriptScheduleBucket, actualStateEntry.Path().Bytes(), &scriptState{
+			Name:  t.name,
+			RunAt: runAt,
+		}); err != nil {
+			return false, err
+		}
+	}
+
 	entryStateKey := actualStateEntry.Path().Bytes()
 	if err := PersistentStateSet(persistentState, EntryStateBucket, entryStateKey, &EntryState{
 		Type:           EntryStateTypeScript,
@@ -360,6 +503,20 @@ func (t *TargetStateScript) Apply(
 	return true, nil
 }
 
+// ContentsSHA256 returns the SHA256 sum of t's contents and, if t sets any
+// environment variables with directives, its environment variables.
+func (t *TargetStateScript) ContentsSHA256() ([]byte, error) {
+	contentsSHA256, err := t.lazyContents.ContentsSHA256()
+	if err != nil || len(t.env) == 0 && t.onChangeSHA256 == nil {
+		return contentsSHA256, err
+	}
+	components := [][]byte{contentsSHA256, []byte(strings.Join(t.env, "\x00"))}
+	if t.onChangeSHA256 != nil {
+		components = append(components, t.onChangeSHA256)
+	}
+	return SHA256Sum(bytes.Join(components, []byte{0})), nil
+}
+
 // EntryState returns t's entry state.
 func (t *TargetStateScript) EntryState(umask fs.FileMode) (*EntryState, error) {
 	contentsSHA256, err := t.ContentsSHA256()
@@ -380,47 +537,80 @@ func (t *TargetStateScript) Evaluate() error {
 
 // SkipApply implements TargetStateEntry.SkipApply.
 func (t *TargetStateScript) SkipApply(persistentState PersistentState, targetAbsPath AbsPath) (bool, error) {
+	runReason, err := t.RunReason(persistentState, targetAbsPath)
+	if err != nil {
+		return false, err
+	}
+	return runReason == "", nil
+}
+
+// RunReason returns why t will be run by the next apply, or the empty string if
+// t will not be run.
+func (t *TargetStateScript) RunReason(persistentState PersistentState, targetAbsPath AbsPath) (string, error) {
 	switch contents, err := t.Contents(); {
 	case err != nil:
-		return false, err
+		return "", err
 	case len(contents) == 0:
-		return true, nil
+		return "", nil
 	}
 	switch t.condition {
 	case ScriptConditionAlways:
-		return false, nil
+		return "runs on every apply", nil
 	case ScriptConditionOnce:
 		contentsSHA256, err := t.ContentsSHA256()
 		if err != nil {
-			return false, err
+			return "", err
 		}
 		scriptStateKey := []byte(hex.EncodeToString(contentsSHA256))
+		if t.userScope() {
+			switch scriptState, err := t.sharedState.Get(ScriptStateBucket, scriptStateKey); {
+			case err != nil:
+				return "", err
+			case scriptState != nil:
+				return "", nil
+			}
+			return "has not been run by this user on any machine with these contents", nil
+		}
 		switch scriptState, err := persistentState.Get(ScriptStateBucket, scriptStateKey); {
 		case err != nil:
-			return false, err
+			return "", err
 		case scriptState != nil:
-			return true, nil
+			return "", nil
 		}
+		return "has not been run with these contents", nil
+	case ScriptConditionEvery:
+		var scriptState scriptState
+		switch ok, err := PersistentStateGet(persistentState, ScriptScheduleBucket, targetAbsPath.Bytes(), &scriptState); {
+		case err != nil:
+			return "", err
+		case !ok:
+			return "has not been run", nil
+		case time.Since(scriptState.RunAt) < t.interval:
+			return "", nil
+		}
+		return fmt.Sprintf("last run more than %s ago", t.interval), nil
 	case ScriptConditionOnChange:
 		entryStateKey := []byte(targetAbsPath.String())
 		switch entryStateBytes, err := persistentState.Get(EntryStateBucket, entryStateKey); {
 		case err != nil:
-			return false, err
+			return "", err
 		case entryStateBytes != nil:
 			var entryState EntryState
 			if err := stateFormat.Unmarshal(entryStateBytes, &entryState); err != nil {
-				return false, err
+				return "", err
 			}
 			contentsSHA256, err := t.ContentsSHA256()
 			if err != nil {
-				return false, err
+				return "", err
 			}
 			if bytes.Equal(entryState.ContentsSHA256.Bytes(), contentsSHA256) {
-				return true, nil
+				return "", nil
 			}
+			return "contents changed since last run", nil
 		}
+		return "has not been run", nil
 	}
-	return false, nil
+	return "will be run", nil
 }
 
 // SourceAttr implements TargetStateEntry.SourceAttr.
@@ -434,6 +624,13 @@ func (t *TargetStateSymlink) Apply(
 	persistentState PersistentState,
 	actualStateEntry ActualStateEntry,
 ) (bool, error) {
+	linkFileChanged := false
+	if t.linkFile != nil && !t.linkFile.absPath.Empty() {
+		var err error
+		if linkFileChanged, err = t.linkFile.apply(system); err != nil {
+			return false, err
+		}
+	}
 	linkname, err := t.Linkname()
 	if err != nil {
 		return false, err
@@ -454,7 +651,7 @@ func (t *TargetStateSymlink) Apply(
 			return false, err
 		}
 		if normalizeLinkname(actualLinkname) == normalizeLinkname(linkname) {
-			return false, nil
+			return linkFileChanged, nil
 		}
 	}
 	if err := actualStateEntry.Remove(system); err != nil {
@@ -487,6 +684,11 @@ func (t *TargetStateSymlink) EntryState(umask fs.FileMode) (*EntryState, error)
 
 // Evaluate evaluates t.
 func (t *TargetStateSymlink) Evaluate() error {
+	if t.linkFile != nil {
+		if _, err := t.linkFile.Contents(); err != nil {
+			return err
+		}
+	}
 	_, err := t.Linkname()
 	return err
 }
@@ -500,3 +702,196 @@ func (t *TargetStateSymlink) SkipApply(persistentState PersistentState, targetAb
 func (t *TargetStateSymlink) SourceAttr() SourceAttr {
 	return t.sourceAttr
 }
+
+// apply writes f to system if its contents or permissions have changed. It
+// returns true if f was changed.
+func (f *linkFile) apply(system System) (bool, error) {
+	contents, err := f.Contents()
+	if err != nil {
+		return false, err
+	}
+	switch actualContents, err := system.ReadFile(f.absPath); {
+	case err == nil && bytes.Equal(actualContents, contents):
+		fileInfo, err := system.Lstat(f.absPath)
+		if err != nil {
+			return false, err
+		}
+		if runtime.GOOS == "windows" || fileInfo.Mode().Perm() == f.perm {
+			return false, nil
+		}
+		return true, system.Chmod(f.absPath, f.perm)
+	case err == nil:
+		// The link file is read-only, so remove it before writing it again.
+		if err := system.RemoveAll(f.absPath); err != nil {
+			return false, err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return false, err
+	}
+	if err := MkdirAll(system, f.absPath.Dir(), fs.ModePerm); err != nil {
+		return false, err
+	}
+	return true, system.WriteFile(f.absPath, contents, f.perm)
+}
+
+// errScriptRanElsewhere is returned by a script's PreRunFunc to prevent the
+// script from running when it was already run by another machine.
+var errScriptRanElsewhere = errors.New("script already run on another machine")
+
+// userScope returns true if t is run once per user, across all machines,
+// rather than once per machine.
+func (t *TargetStateScript) userScope() bool {
+	return t.scriptOptions.scope == scriptScopeUser && t.sharedState != nil
+}
+
+// A scriptOnError describes what happens when a script fails.
+type scriptOnError string
+
+const (
+	scriptOnErrorFail     scriptOnError = "fail"
+	scriptOnErrorContinue scriptOnError = "continue"
+	scriptOnErrorAbort    scriptOnError = "abort"
+)
+
+// A scriptScope describes where a run_once_ script is recorded as run.
+type scriptScope string
+
+const (
+	scriptScopeMachine scriptScope = "machine"
+	scriptScopeUser    scriptScope = "user"
+)
+
+// maxScriptRetryDelay is the maximum delay between attempts to run a script.
+const maxScriptRetryDelay = time.Minute
+
+// scriptOptions are options set by chezmoi:script directives.
+type scriptOptions struct {
+	retries    int
+	retryDelay time.Duration
+	onError    scriptOnError
+	onChange   []string
+	scope      scriptScope
+}
+
+var (
+	scriptEnvDirectiveRx          = newScriptDirectiveRx("env")
+	scriptOptionDirectiveRx       = newScriptDirectiveRx("script")
+	scriptDirectiveKeyValuePairRx = regexp.MustCompile(`\s*([^\s=]+)=("(?:[^"\\]|\\.)*"|\S*)`)
+	defaultScriptOptions          = scriptOptions{
+		retryDelay: time.Second,
+		onError:    scriptOnErrorFail,
+		scope:      scriptScopeMachine,
+	}
+)
+
+// newScriptDirectiveRx returns a regular expression that matches comment lines
+// containing directives of the form chezmoi:name:....
+func newScriptDirectiveRx(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^[ \t]*(?:#|//|--|;|::|(?i:rem)[ \t])[ \t]*chezmoi:` + name + `:([^\r\n]*)(?:\r?\n|$)`)
+}
+
+// parseAndRemoveScriptDirectives parses all directives matched by directiveRx
+// in data and returns data with the lines containing directives removed and
+// the directives' key-value pairs, in order.
+func parseAndRemoveScriptDirectives(data []byte, name string, directiveRx *regexp.Regexp) ([]byte, [][2]string, error) {
+	directiveMatches := directiveRx.FindAllSubmatchIndex(data, -1)
+	if directiveMatches == nil {
+		return data, nil, nil
+	}
+
+	var keyValuePairs [][2]string
+	for _, directiveMatch := range directiveMatches {
+		directive := data[directiveMatch[2]:directiveMatch[3]]
+		keyValuePairMatches := scriptDirectiveKeyValuePairRx.FindAllSubmatch(directive, -1)
+		if keyValuePairMatches == nil || len(bytes.TrimSpace(scriptDirectiveKeyValuePairRx.ReplaceAll(directive, nil))) != 0 {
+			return nil, nil, fmt.Errorf("chezmoi:%s:%s: invalid directive", name, directive)
+		}
+		for _, keyValuePairMatch := range keyValuePairMatches {
+			keyValuePairs = append(keyValuePairs, [2]string{
+				string(keyValuePairMatch[1]),
+				maybeUnquote(string(keyValuePairMatch[2])),
+			})
+		}
+	}
+
+	return removeMatches(data, directiveMatches), keyValuePairs, nil
+}
+
+// parseAndRemoveScriptEnvDirectives parses all environment variable directives
+// of the form chezmoi:env:$KEY=$VALUE in comment lines in data and returns data
+// with the lines containing directives removed and the environment variables.
+// If a key is set more than once then the last value is used.
+func parseAndRemoveScriptEnvDirectives(data []byte) ([]byte, []string, error) {
+	data, keyValuePairs, err := parseAndRemoveScriptDirectives(data, "env", scriptEnvDirectiveRx)
+	if err != nil || keyValuePairs == nil {
+		return data, nil, err
+	}
+
+	var keys []string
+	values := make(map[string]string)
+	for _, keyValuePair := range keyValuePairs {
+		key, value := keyValuePair[0], keyValuePair[1]
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		env = append(env, key+"="+values[key])
+	}
+	return data, env, nil
+}
+
+// parseAndRemoveScriptOptionDirectives parses all script option directives of
+// the form chezmoi:script:$KEY=$VALUE in comment lines in data and returns data
+// with the lines containing directives removed and the options.
+func parseAndRemoveScriptOptionDirectives(data []byte) ([]byte, scriptOptions, error) {
+	options := defaultScriptOptions
+	data, keyValuePairs, err := parseAndRemoveScriptDirectives(data, "script", scriptOptionDirectiveRx)
+	if err != nil {
+		return nil, options, err
+	}
+
+	for _, keyValuePair := range keyValuePairs {
+		key, value := keyValuePair[0], keyValuePair[1]
+		switch key {
+		case "retries":
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				return nil, options, fmt.Errorf("chezmoi:script:%s=%s: invalid number of retries", key, value)
+			}
+			options.retries = retries
+		case "retry-delay":
+			retryDelay, err := time.ParseDuration(value)
+			if err != nil || retryDelay < 0 {
+				return nil, options, fmt.Errorf("chezmoi:script:%s=%s: invalid duration", key, value)
+			}
+			options.retryDelay = retryDelay
+		case "on-error":
+			switch onError := scriptOnError(value); onError {
+			case scriptOnErrorFail, scriptOnErrorContinue, scriptOnErrorAbort:
+				options.onError = onError
+			default:
+				return nil, options, fmt.Errorf("chezmoi:script:%s=%s: invalid value", key, value)
+			}
+		case "scope":
+			switch scope := scriptScope(value); scope {
+			case scriptScopeMachine, scriptScopeUser:
+				options.scope = scope
+			default:
+				return nil, options, fmt.Errorf("chezmoi:script:%s=%s: invalid value", key, value)
+			}
+		case "onchange":
+			if _, err := doublestar.Match(value, ""); err != nil {
+				return nil, options, fmt.Errorf("chezmoi:script:%s=%s: %w", key, value, err)
+			}
+			options.onChange = append(options.onChange, value)
+		default:
+			return nil, options, fmt.Errorf("chezmoi:script:%s: unknown key", key)
+		}
+	}
+
+	return data, options, nil
+}
@@ -1,9 +1,11 @@
 package chezmoi
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/muesli/combinator"
@@ -106,6 +108,241 @@ func TestTargetStateEntryApply(t *testing.T) {
 	}
 }
 
+func TestParseAndRemoveScriptEnvDirectives(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		dataStr         string
+		expectedDataStr string
+		expectedEnv     []string
+		expectedErr     bool
+	}{
+		{
+			name:            "empty",
+			dataStr:         "",
+			expectedDataStr: "",
+		},
+		{
+			name: "no_directives",
+			dataStr: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"echo hello",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"echo hello",
+			),
+		},
+		{
+			name: "directives",
+			dataStr: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"# chezmoi:env:KEY1=value1 KEY2=\"value 2\"",
+				"# chezmoi:env:KEY3=",
+				"echo hello",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"echo hello",
+			),
+			expectedEnv: []string{
+				"KEY1=value1",
+				"KEY2=value 2",
+				"KEY3=",
+			},
+		},
+		{
+			name: "escaped_quote",
+			dataStr: chezmoitest.JoinLines(
+				`# chezmoi:env:KEY="say \"hello\"" KEY2=value2`,
+			),
+			expectedDataStr: "",
+			expectedEnv: []string{
+				`KEY=say "hello"`,
+				"KEY2=value2",
+			},
+		},
+		{
+			name: "duplicate_key",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:env:KEY1=value1 KEY2=value2",
+				"# chezmoi:env:KEY1=value3",
+			),
+			expectedDataStr: "",
+			expectedEnv: []string{
+				"KEY1=value3",
+				"KEY2=value2",
+			},
+		},
+		{
+			name: "other_comment_styles",
+			dataStr: chezmoitest.JoinLines(
+				"  // chezmoi:env:KEY1=value1",
+				"REM chezmoi:env:KEY2=value2",
+				"-- chezmoi:env:KEY3=value3",
+			),
+			expectedDataStr: "",
+			expectedEnv: []string{
+				"KEY1=value1",
+				"KEY2=value2",
+				"KEY3=value3",
+			},
+		},
+		{
+			name: "code_before_directive",
+			dataStr: chezmoitest.JoinLines(
+				`echo "chezmoi:env:KEY=value"`,
+				`echo hello # chezmoi:env:KEY=value`,
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				`echo "chezmoi:env:KEY=value"`,
+				`echo hello # chezmoi:env:KEY=value`,
+			),
+		},
+		{
+			name: "malformed",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:env:KEY",
+			),
+			expectedErr: true,
+		},
+		{
+			name: "trailing_garbage",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:env:KEY=value garbage",
+			),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualData, actualEnv, err := parseAndRemoveScriptEnvDirectives([]byte(tc.dataStr))
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDataStr, string(actualData))
+			assert.Equal(t, tc.expectedEnv, actualEnv)
+		})
+	}
+}
+
+func TestParseAndRemoveScriptOptionDirectives(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		dataStr         string
+		expectedDataStr string
+		expectedOptions scriptOptions
+		expectedErr     bool
+	}{
+		{
+			name:            "no_directives",
+			dataStr:         "echo hello\n",
+			expectedDataStr: "echo hello\n",
+			expectedOptions: defaultScriptOptions,
+		},
+		{
+			name: "directives",
+			dataStr: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"# chezmoi:script:retries=3 retry-delay=5s",
+				"# chezmoi:script:on-error=continue",
+				"echo hello",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"echo hello",
+			),
+			expectedOptions: scriptOptions{
+				retries:    3,
+				retryDelay: 5 * time.Second,
+				onError:    scriptOnErrorContinue,
+				scope:      scriptScopeMachine,
+			},
+		},
+		{
+			name: "onchange",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:onchange=~/.config/foo/** onchange=.bashrc",
+			),
+			expectedDataStr: "",
+			expectedOptions: scriptOptions{
+				retryDelay: time.Second,
+				onError:    scriptOnErrorFail,
+				onChange: []string{
+					"~/.config/foo/**",
+					".bashrc",
+				},
+				scope: scriptScopeMachine,
+			},
+		},
+		{
+			name: "scope",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:scope=user",
+			),
+			expectedDataStr: "",
+			expectedOptions: scriptOptions{
+				retryDelay: time.Second,
+				onError:    scriptOnErrorFail,
+				scope:      scriptScopeUser,
+			},
+		},
+		{
+			name: "invalid_scope",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:scope=everyone",
+			),
+			expectedErr: true,
+		},
+		{
+			name: "invalid_onchange",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:onchange=[",
+			),
+			expectedErr: true,
+		},
+		{
+			name: "invalid_retries",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:retries=-1",
+			),
+			expectedErr: true,
+		},
+		{
+			name: "invalid_retry_delay",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:retry-delay=soon",
+			),
+			expectedErr: true,
+		},
+		{
+			name: "invalid_on_error",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:on-error=explode",
+			),
+			expectedErr: true,
+		},
+		{
+			name: "unknown_key",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:script:timeout=1s",
+			),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualData, actualOptions, err := parseAndRemoveScriptOptionDirectives([]byte(tc.dataStr))
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDataStr, string(actualData))
+			assert.Equal(t, tc.expectedOptions, actualOptions)
+		})
+	}
+}
+
 func targetStateTest(t *testing.T, ts TargetStateEntry) []vfst.PathTest {
 	t.Helper()
 	switch ts := ts.(type) {
@@ -139,3 +376,62 @@ func targetStateTest(t *testing.T, ts TargetStateEntry) []vfst.PathTest {
 		return nil
 	}
 }
+
+// A racingSharedPersistentState is a SharedPersistentState that simulates
+// another machine running a script immediately before the lock is taken.
+type racingSharedPersistentState struct {
+	SharedPersistentState
+}
+
+func (s *racingSharedPersistentState) TryLock(name string) (bool, error) {
+	if err := s.Set(ScriptStateBucket, []byte(name), []byte(`{}`)); err != nil {
+		return false, err
+	}
+	return s.SharedPersistentState.TryLock(name)
+}
+
+// A runScriptSystem is a System that records whether a script was run.
+type runScriptSystem struct {
+	NullSystem
+	ran bool
+}
+
+func (s *runScriptSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	if options.PreRunFunc != nil {
+		if err := options.PreRunFunc(); err != nil {
+			return err
+		}
+	}
+	s.ran = true
+	return nil
+}
+
+func TestTargetStateScriptApplyUserScopeRace(t *testing.T) {
+	sharedState := newTestHTTPPersistentState(t)(time.Hour)
+	targetStateScript := &TargetStateScript{
+		lazyContents:  newLazyContents([]byte("#!/bin/sh\n")),
+		name:          NewRelPath("script"),
+		condition:     ScriptConditionOnce,
+		scriptOptions: scriptOptions{scope: scriptScopeUser},
+		sharedState: &racingSharedPersistentState{
+			SharedPersistentState: sharedState,
+		},
+	}
+	system := &runScriptSystem{}
+	persistentState := NewMockPersistentState()
+	_, err := targetStateScript.Apply(system, persistentState, &ActualStateAbsent{
+		absPath: NewAbsPath("/home/user/script"),
+	})
+	assert.NoError(t, err)
+	assert.False(t, system.ran)
+
+	// The lock is released and the script is recorded as run on this machine.
+	contentsSHA256, err := targetStateScript.ContentsSHA256()
+	assert.NoError(t, err)
+	ok, err := sharedState.TryLock(hex.EncodeToString(contentsSHA256))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	skip, err := targetStateScript.SkipApply(persistentState, NewAbsPath("/home/user/script"))
+	assert.NoError(t, err)
+	assert.True(t, skip)
+}
@@ -35,6 +35,13 @@ func ParseTemplate(name string, data []byte, funcs template.FuncMap, options Tem
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := funcs[TraceTemplateFuncName]; ok {
+		for _, t := range template.Templates() {
+			if err := traceTemplateTree(t.Tree); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return &Template{
 		name:     name,
 		template: template,
@@ -42,11 +49,25 @@ func ParseTemplate(name string, data []byte, funcs template.FuncMap, options Tem
 	}, nil
 }
 
-// AddParseTree adds tmpl's parse tree to t.
+// AddParseTree adds tmpl's parse tree to t, together with the parse trees of
+// the templates that tmpl defines with block or define actions. Templates that
+// are already defined in t are not replaced, so t can override blocks in tmpl.
 func (t *Template) AddParseTree(tmpl *Template) (*Template, error) {
 	var err error
 	t.template, err = t.template.AddParseTree(tmpl.name, tmpl.template.Tree)
-	return t, err
+	if err != nil {
+		return t, err
+	}
+	for _, associatedTemplate := range tmpl.template.Templates() {
+		name := associatedTemplate.Name()
+		if name == tmpl.name || associatedTemplate.Tree == nil || t.template.Lookup(name) != nil {
+			continue
+		}
+		if _, err := t.template.AddParseTree(name, associatedTemplate.Tree); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
 }
 
 // Execute executes t with data.
@@ -73,3 +73,27 @@ func TestTemplateParseAndExecute(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateAddParseTree(t *testing.T) {
+	base, err := ParseTemplate("base", []byte(chezmoitest.JoinLines(
+		`{{ block "header" . }}# default header{{ end }}`,
+		`{{ block "body" . }}default body{{ end }}`,
+	)), nil, TemplateOptions{})
+	assert.NoError(t, err)
+
+	tmpl, err := ParseTemplate("file", []byte(
+		`{{ define "body" }}{{ .value }}{{ end }}{{ template "base" . }}`,
+	), nil, TemplateOptions{})
+	assert.NoError(t, err)
+	tmpl, err = tmpl.AddParseTree(base)
+	assert.NoError(t, err)
+
+	actual, err := tmpl.Execute(map[string]any{
+		"value": "overridden body",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, chezmoitest.JoinLines(
+		"# default header",
+		"overridden body",
+	), string(actual))
+}
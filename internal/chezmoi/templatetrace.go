@@ -0,0 +1,284 @@
+package chezmoi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+
+	"github.com/rs/zerolog"
+)
+
+// TraceTemplateFuncName is the name of the template function that traces
+// template execution. If a template's functions include a function with this
+// name then the template is instrumented to call it before every action and at
+// the start of every branch.
+const TraceTemplateFuncName = "chezmoiTraceTemplate"
+
+// redacted replaces values that may contain secrets in template traces.
+const redacted = "<redacted>"
+
+// A TemplateTracer logs every action evaluated while executing templates.
+type TemplateTracer struct {
+	sync.Mutex
+	logger          *zerolog.Logger
+	secretFuncNames map[string]struct{}
+	secretVarNames  map[string]map[string]struct{}
+}
+
+// NewTemplateTracer returns a new TemplateTracer that logs to logger. The
+// values of variables assigned from the results of functions in
+// secretFuncNames are redacted.
+func NewTemplateTracer(logger *zerolog.Logger, secretFuncNames []string) *TemplateTracer {
+	t := &TemplateTracer{
+		logger:          logger,
+		secretFuncNames: make(map[string]struct{}, len(secretFuncNames)),
+		secretVarNames:  make(map[string]map[string]struct{}),
+	}
+	for _, secretFuncName := range secretFuncNames {
+		t.secretFuncNames[secretFuncName] = struct{}{}
+	}
+	return t
+}
+
+// Trace is the template function called by instrumented templates. position
+// and text identify the action, funcNames and declNames are comma-separated
+// lists of the functions called and variables declared by the action, and args
+// are pairs of names of variables or fields read by the action and the values
+// that the names are relative to.
+func (t *TemplateTracer) Trace(templateName, position, text, funcNames, declNames string, args ...any) string {
+	t.Lock()
+	defer t.Unlock()
+
+	secretVarNames := t.secretVarNames[templateName]
+	callsSecretFunc := false
+	var funcNamesSlice []string
+	if funcNames != "" {
+		funcNamesSlice = strings.Split(funcNames, ",")
+		for _, funcName := range funcNamesSlice {
+			if _, ok := t.secretFuncNames[funcName]; ok {
+				callsSecretFunc = true
+			}
+		}
+	}
+
+	vars := zerolog.Dict()
+	for i := 0; i+1 < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			continue
+		}
+		varName, _, _ := strings.Cut(name, ".")
+		if _, ok := secretVarNames[varName]; ok && varName != "" {
+			vars.Str(name, redacted)
+			continue
+		}
+		vars.Interface(name, traceValue(name, args[i+1]))
+	}
+
+	if callsSecretFunc && declNames != "" {
+		if secretVarNames == nil {
+			secretVarNames = make(map[string]struct{})
+			t.secretVarNames[templateName] = secretVarNames
+		}
+		for _, declName := range strings.Split(declNames, ",") {
+			secretVarNames[declName] = struct{}{}
+		}
+	}
+
+	t.logger.Info().
+		Str("template", templateName).
+		Str("position", position).
+		Str("action", text).
+		Strs("funcs", funcNamesSlice).
+		Dict("vars", vars).
+		Msg("traceTemplate")
+	return ""
+}
+
+// traceTemplateFuncs are the functions used to parse the trace actions
+// inserted into templates.
+var traceTemplateFuncs = map[string]any{
+	TraceTemplateFuncName: func(...any) string { return "" },
+}
+
+// traceTemplateTree instruments tree so that it calls the trace template
+// function before every action and at the start of every branch.
+func traceTemplateTree(tree *parse.Tree) error {
+	if tree == nil || tree.Root == nil {
+		return nil
+	}
+	return traceTemplateList(tree, tree.Root)
+}
+
+// traceTemplateList instruments all nodes in list.
+func traceTemplateList(tree *parse.Tree, list *parse.ListNode) error {
+	if list == nil {
+		return nil
+	}
+	nodes := make([]parse.Node, 0, 2*len(list.Nodes))
+	for _, node := range list.Nodes {
+		var text, keyword string
+		var pipe *parse.PipeNode
+		var branchNode *parse.BranchNode
+		switch node := node.(type) {
+		case *parse.ActionNode:
+			text, pipe = node.String(), node.Pipe
+		case *parse.IfNode:
+			text, keyword, pipe, branchNode = "if "+node.Pipe.String(), "if", node.Pipe, &node.BranchNode
+		case *parse.RangeNode:
+			text, keyword, pipe, branchNode = "range "+node.Pipe.String(), "range", node.Pipe, &node.BranchNode
+		case *parse.WithNode:
+			text, keyword, pipe, branchNode = "with "+node.Pipe.String(), "with", node.Pipe, &node.BranchNode
+		case *parse.TemplateNode:
+			text, pipe = node.String(), node.Pipe
+		default:
+			nodes = append(nodes, node)
+			continue
+		}
+
+		// Determine the position before instrumenting any branches, as
+		// determining the position formats the node.
+		position, _ := tree.ErrorContext(node)
+		traceActionNode, err := newTraceActionNode(tree.ParseName, position, text, pipe)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, traceActionNode, node)
+
+		if branchNode != nil {
+			for _, branch := range []struct {
+				list *parse.ListNode
+				text string
+			}{
+				{branchNode.List, keyword + " branch taken"},
+				{branchNode.ElseList, keyword + " else branch taken"},
+			} {
+				if branch.list == nil {
+					continue
+				}
+				if err := traceTemplateList(tree, branch.list); err != nil {
+					return err
+				}
+				traceBranchNode, err := newTraceActionNode(tree.ParseName, position, branch.text, nil)
+				if err != nil {
+					return err
+				}
+				branch.list.Nodes = append([]parse.Node{traceBranchNode}, branch.list.Nodes...)
+			}
+		}
+	}
+	list.Nodes = nodes
+	return nil
+}
+
+// newTraceActionNode returns a new action node that calls the trace template
+// function with templateName, position, text, and the functions called,
+// variables declared, and variables and fields read by pipe.
+//
+// The action node is created by parsing a template, as nodes created directly
+// cannot be formatted, which text/template does when reporting errors.
+func newTraceActionNode(templateName, position, text string, pipe *parse.PipeNode) (*parse.ActionNode, error) {
+	var funcNames, declNames, readNames []string
+	readBases := make(map[string]string)
+	if pipe != nil {
+		for _, decl := range pipe.Decl {
+			declNames = append(declNames, decl.Ident[0])
+		}
+		var walk func(parse.Node)
+		walk = func(node parse.Node) {
+			switch node := node.(type) {
+			case *parse.CommandNode:
+				for _, arg := range node.Args {
+					walk(arg)
+				}
+			case *parse.PipeNode:
+				for _, cmd := range node.Cmds {
+					walk(cmd)
+				}
+			case *parse.IdentifierNode:
+				funcNames = append(funcNames, node.Ident)
+			case *parse.FieldNode:
+				name := "." + strings.Join(node.Ident, ".")
+				if _, ok := readBases[name]; !ok {
+					readBases[name] = "."
+					readNames = append(readNames, name)
+				}
+			case *parse.VariableNode:
+				name := strings.Join(node.Ident, ".")
+				if _, ok := readBases[name]; !ok {
+					readBases[name] = node.Ident[0]
+					readNames = append(readNames, name)
+				}
+			case *parse.ChainNode:
+				walk(node.Node)
+			}
+		}
+		walk(pipe)
+	}
+
+	// Declare the variables read so that the template parses.
+	var builder strings.Builder
+	declaredVarNames := make(map[string]struct{})
+	for _, readName := range readNames {
+		base := readBases[readName]
+		if _, ok := declaredVarNames[base]; ok || base == "." || base == "$" {
+			continue
+		}
+		declaredVarNames[base] = struct{}{}
+		builder.WriteString("{{" + base + " := 0}}")
+	}
+	builder.WriteString("{{" + TraceTemplateFuncName)
+	for _, arg := range []string{
+		templateName,
+		position,
+		text,
+		strings.Join(funcNames, ","),
+		strings.Join(declNames, ","),
+	} {
+		builder.WriteString(" " + strconv.Quote(arg))
+	}
+	for _, readName := range readNames {
+		builder.WriteString(" " + strconv.Quote(readName) + " " + readBases[readName])
+	}
+	builder.WriteString("}}")
+
+	tree, err := parse.New(TraceTemplateFuncName).Parse(builder.String(), "{{", "}}", make(map[string]*parse.Tree), traceTemplateFuncs)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Root.Nodes[len(tree.Root.Nodes)-1].(*parse.ActionNode), nil //nolint:forcetypeassert
+}
+
+// traceValue returns the value of the variable or field name relative to
+// base, or nil if it cannot be determined.
+func traceValue(name string, base any) any {
+	var path []string
+	switch {
+	case strings.HasPrefix(name, "."):
+		path = strings.Split(name[1:], ".")
+	default:
+		path = strings.Split(name, ".")[1:]
+	}
+	value := reflect.ValueOf(base)
+	for _, key := range path {
+		for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer) {
+			value = value.Elem()
+		}
+		switch {
+		case !value.IsValid():
+			return nil
+		case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String:
+			value = value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+		case value.Kind() == reflect.Struct:
+			value = value.FieldByName(key)
+		default:
+			return nil
+		}
+	}
+	if !value.IsValid() || !value.CanInterface() {
+		return nil
+	}
+	return value.Interface()
+}
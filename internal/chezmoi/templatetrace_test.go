@@ -0,0 +1,106 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/rs/zerolog"
+)
+
+func TestTemplateTracer(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		dataStr         string
+		data            map[string]any
+		expectedStr     string
+		expectedActions []string
+		expectedLogStrs []string
+	}{
+		{
+			name:        "action",
+			dataStr:     "{{ .a }}",
+			data:        map[string]any{"a": "b"},
+			expectedStr: "b",
+			expectedActions: []string{
+				"{{.a}}",
+			},
+			expectedLogStrs: []string{
+				`"vars":{".a":"b"}`,
+			},
+		},
+		{
+			name:        "if_else",
+			dataStr:     `{{ if eq .a "c" }}c{{ else }}{{ .a }}{{ end }}`,
+			data:        map[string]any{"a": "b"},
+			expectedStr: "b",
+			expectedActions: []string{
+				`if eq .a "c"`,
+				"if else branch taken",
+				"{{.a}}",
+			},
+			expectedLogStrs: []string{
+				`"funcs":["eq"]`,
+			},
+		},
+		{
+			name:        "range",
+			dataStr:     "{{ range $i := .a }}{{ $i }}{{ end }}",
+			data:        map[string]any{"a": []int{1, 2}},
+			expectedStr: "12",
+			expectedActions: []string{
+				"range $i := .a",
+				"range branch taken",
+				"{{$i}}",
+				"range branch taken",
+				"{{$i}}",
+			},
+			expectedLogStrs: []string{
+				`"vars":{"$i":2}`,
+			},
+		},
+		{
+			name:        "secret",
+			dataStr:     `{{ $s := secret "b" }}{{ $s }}`,
+			expectedStr: "b",
+			expectedActions: []string{
+				`{{$s := secret "b"}}`,
+				"{{$s}}",
+			},
+			expectedLogStrs: []string{
+				`"vars":{"$s":"<redacted>"}`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			logger := zerolog.New(buffer)
+			tracer := NewTemplateTracer(&logger, []string{"secret"})
+			funcs := map[string]any{
+				"secret":              func(s string) string { return s },
+				TraceTemplateFuncName: tracer.Trace,
+			}
+			tmpl, err := ParseTemplate(tc.name, []byte(tc.dataStr), funcs, TemplateOptions{})
+			assert.NoError(t, err)
+			actual, err := tmpl.Execute(tc.data)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedStr, string(actual))
+
+			logStr := buffer.String()
+			var actualActions []string
+			for _, line := range strings.Split(strings.TrimSuffix(logStr, "\n"), "\n") {
+				var event struct {
+					Action string `json:"action"`
+				}
+				assert.NoError(t, json.Unmarshal([]byte(line), &event))
+				actualActions = append(actualActions, event.Action)
+			}
+			assert.Equal(t, tc.expectedActions, actualActions)
+			for _, expectedLogStr := range tc.expectedLogStrs {
+				assert.Contains(t, logStr, expectedLogStr)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package chezmoi
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"sort"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v4"
+)
+
+// A TrashSystem is a System that moves entries to a trash directory instead of
+// removing them, and records them in a persistent state so that they can be
+// restored.
+type TrashSystem struct {
+	system          System
+	persistentState PersistentState
+	trashDirAbsPath AbsPath
+	count           int
+}
+
+// A TrashEntry records an entry that was moved to the trash.
+type TrashEntry struct {
+	ID        string    `json:"id"        yaml:"id"`
+	Path      AbsPath   `json:"path"      yaml:"path"`
+	TrashedAt time.Time `json:"trashedAt" yaml:"trashedAt"`
+}
+
+// NewTrashSystem returns a new TrashSystem that wraps system, moves removed
+// entries to trashDirAbsPath, and records them in persistentState.
+func NewTrashSystem(system System, persistentState PersistentState, trashDirAbsPath AbsPath) *TrashSystem {
+	return &TrashSystem{
+		system:          system,
+		persistentState: persistentState,
+		trashDirAbsPath: trashDirAbsPath,
+	}
+}
+
+// TrashEntries returns all the entries in the trash recorded in
+// persistentState, oldest first.
+func TrashEntries(persistentState PersistentState) ([]*TrashEntry, error) {
+	var trashEntries []*TrashEntry
+	if err := persistentState.ForEach(TrashStateBucket, func(k, v []byte) error {
+		var trashEntry TrashEntry
+		if err := stateFormat.Unmarshal(v, &trashEntry); err != nil {
+			return err
+		}
+		trashEntries = append(trashEntries, &trashEntry)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(trashEntries, func(i, j int) bool {
+		return trashEntries[i].ID < trashEntries[j].ID
+	})
+	return trashEntries, nil
+}
+
+// Chmod implements System.Chmod.
+func (s *TrashSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	return s.system.Chmod(name, mode)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *TrashSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *TrashSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *TrashSystem) Link(oldname, newname AbsPath) error {
+	return s.system.Link(oldname, newname)
+}
+
+// Lstat implements System.Lstat.
+func (s *TrashSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *TrashSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *TrashSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *TrashSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *TrashSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *TrashSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove by moving name to the trash.
+func (s *TrashSystem) Remove(name AbsPath) error {
+	return s.trash(name)
+}
+
+// RemoveAll implements System.RemoveAll by moving name to the trash. Like
+// os.RemoveAll, it returns nil if name does not exist.
+func (s *TrashSystem) RemoveAll(name AbsPath) error {
+	if err := s.trash(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Rename implements System.Rename.
+func (s *TrashSystem) Rename(oldpath, newpath AbsPath) error {
+	return s.system.Rename(oldpath, newpath)
+}
+
+// RunCmd implements System.RunCmd.
+func (s *TrashSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *TrashSystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	return s.system.RunScript(scriptname, dir, data, options)
+}
+
+// Stat implements System.Stat.
+func (s *TrashSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *TrashSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *TrashSystem) WriteFile(filename AbsPath, data []byte, perm fs.FileMode) error {
+	return s.system.WriteFile(filename, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *TrashSystem) WriteSymlink(oldname string, newname AbsPath) error {
+	return s.system.WriteSymlink(oldname, newname)
+}
+
+// trash moves name to the trash directory and records it. Entries that are
+// already in the trash directory are removed permanently, and entries that
+// contain the trash directory are never moved to it.
+func (s *TrashSystem) trash(name AbsPath) error {
+	if _, err := s.system.Lstat(name); err != nil {
+		return err
+	}
+	if _, err := name.TrimDirPrefix(s.trashDirAbsPath); err == nil {
+		return s.system.RemoveAll(name)
+	}
+	if _, err := s.trashDirAbsPath.TrimDirPrefix(name); err == nil {
+		return fmt.Errorf("%s: cannot move to trash, contains trash directory %s", name, s.trashDirAbsPath)
+	}
+	if err := MkdirAll(s.system, s.trashDirAbsPath, 0o700); err != nil {
+		return err
+	}
+	trashedAt := time.Now().UTC()
+	s.count++
+	trashEntry := &TrashEntry{
+		ID:        fmt.Sprintf("%s.%d", trashedAt.Format("20060102T150405.000000000Z"), s.count),
+		Path:      name,
+		TrashedAt: trashedAt,
+	}
+	if err := MoveAll(s.system, name, s.trashDirAbsPath.JoinString(trashEntry.ID)); err != nil {
+		return err
+	}
+	return PersistentStateSet(s.persistentState, TrashStateBucket, []byte(trashEntry.ID), trashEntry)
+}
@@ -0,0 +1,62 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ System = &TrashSystem{}
+
+func TestTrashSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir": map[string]any{
+				"file": "# contents of .dir/file\n",
+			},
+			".file": "# contents of .file\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		persistentState := NewMockPersistentState()
+		trashDirAbsPath := NewAbsPath("/home/user/.trash")
+		system := NewTrashSystem(NewRealSystem(fileSystem), persistentState, trashDirAbsPath)
+
+		assert.NoError(t, system.Remove(NewAbsPath("/home/user/.file")))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.missing")))
+		assert.IsError(t, system.Remove(NewAbsPath("/home/user/.missing")), fs.ErrNotExist)
+
+		trashEntries, err := TrashEntries(persistentState)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(trashEntries))
+		assert.Equal(t, NewAbsPath("/home/user/.file"), trashEntries[0].Path)
+		assert.Equal(t, NewAbsPath("/home/user/.dir"), trashEntries[1].Path)
+
+		_, err = fileSystem.Lstat("/home/user/.file")
+		assert.IsError(t, err, fs.ErrNotExist)
+		data, err := fileSystem.ReadFile(trashDirAbsPath.JoinString(trashEntries[0].ID).String())
+		assert.NoError(t, err)
+		assert.Equal(t, "# contents of .file\n", string(data))
+		data, err = fileSystem.ReadFile(trashDirAbsPath.JoinString(trashEntries[1].ID, "file").String())
+		assert.NoError(t, err)
+		assert.Equal(t, "# contents of .dir/file\n", string(data))
+
+		// Removing an entry that is already in the trash removes it
+		// permanently.
+		assert.NoError(t, system.RemoveAll(trashDirAbsPath.JoinString(trashEntries[0].ID)))
+		_, err = fileSystem.Lstat(trashDirAbsPath.JoinString(trashEntries[0].ID).String())
+		assert.IsError(t, err, fs.ErrNotExist)
+		trashEntries, err = TrashEntries(persistentState)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(trashEntries))
+
+		// Removing a directory that contains the trash directory fails.
+		assert.Error(t, system.RemoveAll(NewAbsPath("/home/user")))
+		_, err = fileSystem.Lstat(trashDirAbsPath.String())
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,66 @@
+//go:build unix
+
+package chezmoi
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+	"github.com/twpayne/go-vfs/v4/vfst"
+	"golang.org/x/sys/unix"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+// A crossDeviceSystem is a System whose Rename always fails as if oldpath and
+// newpath were on different filesystems.
+type crossDeviceSystem struct {
+	System
+}
+
+func (s *crossDeviceSystem) Rename(oldpath, newpath AbsPath) error {
+	return &os.LinkError{
+		Op:  "rename",
+		Old: oldpath.String(),
+		New: newpath.String(),
+		Err: unix.EXDEV,
+	}
+}
+
+func TestTrashSystemCrossDevice(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir": map[string]any{
+				"file":    "# contents of .dir/file\n",
+				"subdir":  &vfst.Dir{Perm: 0o700},
+				"symlink": &vfst.Symlink{Target: "file"},
+			},
+		},
+	}, func(fileSystem vfs.FS) {
+		persistentState := NewMockPersistentState()
+		trashDirAbsPath := NewAbsPath("/home/user/.trash")
+		system := NewTrashSystem(&crossDeviceSystem{System: NewRealSystem(fileSystem)}, persistentState, trashDirAbsPath)
+
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+
+		trashEntries, err := TrashEntries(persistentState)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(trashEntries))
+
+		_, err = fileSystem.Lstat("/home/user/.dir")
+		assert.IsError(t, err, fs.ErrNotExist)
+		trashEntryAbsPath := trashDirAbsPath.JoinString(trashEntries[0].ID)
+		data, err := fileSystem.ReadFile(trashEntryAbsPath.JoinString("file").String())
+		assert.NoError(t, err)
+		assert.Equal(t, "# contents of .dir/file\n", string(data))
+		fileInfo, err := fileSystem.Lstat(trashEntryAbsPath.JoinString("subdir").String())
+		assert.NoError(t, err)
+		assert.True(t, fileInfo.IsDir())
+		linkname, err := fileSystem.Readlink(trashEntryAbsPath.JoinString("symlink").String())
+		assert.NoError(t, err)
+		assert.Equal(t, "file", linkname)
+	})
+}
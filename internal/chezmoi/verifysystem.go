@@ -0,0 +1,219 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"os/exec"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v4"
+)
+
+// A VerifyFindingType is a type of difference between the destination state
+// and the target state.
+type VerifyFindingType string
+
+// VerifyFindingTypes.
+const (
+	VerifyFindingTypeContent    VerifyFindingType = "content"
+	VerifyFindingTypeExtraneous VerifyFindingType = "extraneous"
+	VerifyFindingTypeMissing    VerifyFindingType = "missing"
+	VerifyFindingTypeMode       VerifyFindingType = "mode"
+	VerifyFindingTypeScript     VerifyFindingType = "script"
+	VerifyFindingTypeSymlink    VerifyFindingType = "symlink"
+	VerifyFindingTypeType       VerifyFindingType = "type"
+)
+
+// A VerifyFinding is a difference between the destination state and the target
+// state.
+type VerifyFinding struct {
+	Type VerifyFindingType `json:"type" yaml:"type"`
+	Path AbsPath           `json:"path" yaml:"path"`
+}
+
+// A VerifySystem is a System that passes reads to the wrapped System and
+// records writes as VerifyFindings instead of performing them.
+type VerifySystem struct {
+	system   System
+	findings []*VerifyFinding
+	indexes  map[AbsPath]int
+	removed  map[AbsPath]fs.FileMode
+}
+
+// NewVerifySystem returns a new VerifySystem that wraps system.
+func NewVerifySystem(system System) *VerifySystem {
+	return &VerifySystem{
+		system:  system,
+		indexes: make(map[AbsPath]int),
+		removed: make(map[AbsPath]fs.FileMode),
+	}
+}
+
+// Findings returns s's findings in the order in which they were found.
+func (s *VerifySystem) Findings() []*VerifyFinding {
+	return s.findings
+}
+
+// Chmod implements System.Chmod.
+func (s *VerifySystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	s.record(name, VerifyFindingTypeMode)
+	return nil
+}
+
+// Chtimes implements System.Chtimes.
+func (s *VerifySystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return nil
+}
+
+// Glob implements System.Glob.
+func (s *VerifySystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *VerifySystem) Link(oldname, newname AbsPath) error {
+	s.write(newname, 0)
+	return nil
+}
+
+// Lstat implements System.Lstat.
+func (s *VerifySystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *VerifySystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	s.write(name, fs.ModeDir)
+	return nil
+}
+
+// RawPath implements System.RawPath.
+func (s *VerifySystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *VerifySystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *VerifySystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *VerifySystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *VerifySystem) Remove(name AbsPath) error {
+	s.remove(name)
+	return nil
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *VerifySystem) RemoveAll(name AbsPath) error {
+	s.remove(name)
+	return nil
+}
+
+// Rename implements System.Rename.
+func (s *VerifySystem) Rename(oldpath, newpath AbsPath) error {
+	var modeType fs.FileMode
+	if fileInfo, err := s.system.Lstat(oldpath); err == nil {
+		modeType = fileInfo.Mode().Type()
+	}
+	s.remove(oldpath)
+	s.write(newpath, modeType)
+	return nil
+}
+
+// RunCmd implements System.RunCmd. Commands are only run to update
+// directories, for example git repo externals, either in the directory or
+// creating the directory given as their last argument.
+func (s *VerifySystem) RunCmd(cmd *exec.Cmd) error {
+	switch {
+	case cmd.Dir != "":
+		s.record(NewAbsPath(cmd.Dir), VerifyFindingTypeContent)
+	case len(cmd.Args) != 0:
+		s.record(NewAbsPath(cmd.Args[len(cmd.Args)-1]), VerifyFindingTypeMissing)
+	}
+	return nil
+}
+
+// RunScript implements System.RunScript.
+func (s *VerifySystem) RunScript(scriptname RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	s.record(dir.JoinString(scriptname.Base()), VerifyFindingTypeScript)
+	return nil
+}
+
+// Stat implements System.Stat.
+func (s *VerifySystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *VerifySystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *VerifySystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	s.write(name, 0)
+	return nil
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *VerifySystem) WriteSymlink(oldname string, newname AbsPath) error {
+	s.write(newname, fs.ModeSymlink)
+	return nil
+}
+
+// record records a finding of type findingType for name. Only the first
+// finding for each path is recorded, except that an extraneous entry that is
+// replaced is recorded as the replacement.
+func (s *VerifySystem) record(name AbsPath, findingType VerifyFindingType) {
+	if index, ok := s.indexes[name]; ok {
+		if s.findings[index].Type == VerifyFindingTypeExtraneous && findingType != VerifyFindingTypeExtraneous {
+			s.findings[index].Type = findingType
+		}
+		return
+	}
+	s.indexes[name] = len(s.findings)
+	s.findings = append(s.findings, &VerifyFinding{
+		Type: findingType,
+		Path: name,
+	})
+}
+
+// remove records that the entry at name is extraneous.
+func (s *VerifySystem) remove(name AbsPath) {
+	fileInfo, err := s.system.Lstat(name)
+	if err != nil {
+		return
+	}
+	s.removed[name] = fileInfo.Mode().Type()
+	s.record(name, VerifyFindingTypeExtraneous)
+}
+
+// write records that an entry of type modeType is written at name.
+func (s *VerifySystem) write(name AbsPath, modeType fs.FileMode) {
+	actualModeType, ok := s.removed[name]
+	if !ok {
+		fileInfo, err := s.system.Lstat(name)
+		if err != nil {
+			s.record(name, VerifyFindingTypeMissing)
+			return
+		}
+		actualModeType = fileInfo.Mode().Type()
+	}
+	switch {
+	case actualModeType != modeType:
+		s.record(name, VerifyFindingTypeType)
+	case modeType == fs.ModeSymlink:
+		s.record(name, VerifyFindingTypeSymlink)
+	default:
+		s.record(name, VerifyFindingTypeContent)
+	}
+}
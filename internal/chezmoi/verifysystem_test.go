@@ -0,0 +1,53 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+	"github.com/twpayne/go-vfs/v4/vfst"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+var _ System = &VerifySystem{}
+
+func TestVerifySystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir":  &vfst.Dir{Perm: 0o777},
+			".file": "# contents of .file\n",
+			".replaced": &vfst.Dir{
+				Perm: 0o777,
+			},
+			".symlink": &vfst.Symlink{Target: ".file"},
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewVerifySystem(NewRealSystem(fileSystem))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.file"), []byte("# edited\n"), 0o666))
+		assert.NoError(t, system.Chmod(NewAbsPath("/home/user/.dir"), 0o700))
+		assert.NoError(t, system.Mkdir(NewAbsPath("/home/user/.missing"), 0o777))
+		assert.NoError(t, system.Chmod(NewAbsPath("/home/user/.missing"), 0o777))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.replaced")))
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.replaced"), nil, 0o666))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.symlink")))
+		assert.NoError(t, system.WriteSymlink(".dir", NewAbsPath("/home/user/.symlink")))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.absent")))
+		assert.NoError(t, system.RunScript(NewRelPath("script"), NewAbsPath("/home/user"), []byte("#!/bin/sh\n"), RunScriptOptions{}))
+
+		assert.Equal(t, []*VerifyFinding{
+			{Type: VerifyFindingTypeContent, Path: NewAbsPath("/home/user/.file")},
+			{Type: VerifyFindingTypeMode, Path: NewAbsPath("/home/user/.dir")},
+			{Type: VerifyFindingTypeMissing, Path: NewAbsPath("/home/user/.missing")},
+			{Type: VerifyFindingTypeType, Path: NewAbsPath("/home/user/.replaced")},
+			{Type: VerifyFindingTypeSymlink, Path: NewAbsPath("/home/user/.symlink")},
+			{Type: VerifyFindingTypeScript, Path: NewAbsPath("/home/user/script")},
+		}, system.Findings())
+
+		// Nothing is written.
+		data, err := fileSystem.ReadFile("/home/user/.file")
+		assert.NoError(t, err)
+		assert.Equal(t, "# contents of .file\n", string(data))
+	})
+}
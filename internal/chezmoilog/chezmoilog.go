@@ -4,8 +4,11 @@ package chezmoilog
 import (
 	"errors"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -13,7 +16,38 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-const few = 64
+const (
+	few      = 64
+	redacted = "REDACTED"
+)
+
+// sensitiveHTTPHeaders are the canonical names of HTTP headers whose values
+// are always redacted when logged.
+var sensitiveHTTPHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Private-Token":       true,
+	"Proxy-Authorization": true,
+	"X-Jfrog-Art-Api":     true,
+}
+
+// sensitiveNameSubstrings are substrings of the names of HTTP headers and URL
+// query parameters whose values are redacted when logged.
+var sensitiveNameSubstrings = []string{
+	"auth",
+	"key",
+	"password",
+	"secret",
+	"signature",
+	"token",
+}
+
+// An HTTPHeaderLogObject wraps an http.Header and adds
+// github.com/rs/zerolog.LogObjectMarshaler functionality. The values of
+// sensitive headers are redacted.
+type HTTPHeaderLogObject struct {
+	http.Header
+}
 
 // An OSExecCmdLogObject wraps an *os/exec.Cmd and adds
 // github.com/rs/zerolog.LogObjectMarshaler functionality.
@@ -90,6 +124,23 @@ func (p OSProcessStateLogObject) MarshalZerologObject(event *zerolog.Event) {
 	}
 }
 
+// MarshalZerologObject implements
+// github.com/rs/zerolog.LogObjectMarshaler.MarshalZerologObject.
+func (h HTTPHeaderLogObject) MarshalZerologObject(event *zerolog.Event) {
+	names := make([]string, 0, len(h.Header))
+	for name := range h.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if isSensitiveHTTPHeader(name) {
+			event.Str(name, redacted)
+		} else {
+			event.Strs(name, h.Header[name])
+		}
+	}
+}
+
 // FirstFewBytes returns the first few bytes of data in a human-readable form.
 func FirstFewBytes(data []byte) []byte {
 	if len(data) > few {
@@ -104,25 +155,66 @@ func FirstFewBytes(data []byte) []byte {
 func LogHTTPRequest(logger *zerolog.Logger, client *http.Client, req *http.Request) (*http.Response, error) {
 	start := time.Now()
 	resp, err := client.Do(req)
+	event := logger.Err(err).
+		Stringer("duration", time.Since(start)).
+		Str("method", req.Method)
+	if len(req.Header) != 0 {
+		event.Object("header", HTTPHeaderLogObject{req.Header})
+	}
 	if resp != nil {
-		logger.Err(err).
-			Stringer("duration", time.Since(start)).
-			Str("method", req.Method).
+		event.
 			Int64("size", resp.ContentLength).
 			Int("statusCode", resp.StatusCode).
-			Str("status", resp.Status).
-			Stringer("url", req.URL).
-			Msg("HTTPRequest")
-	} else {
-		logger.Err(err).
-			Stringer("duration", time.Since(start)).
-			Str("method", req.Method).
-			Stringer("url", req.URL).
-			Msg("HTTPRequest")
+			Str("status", resp.Status)
 	}
+	event.Str("url", RedactURL(req.URL)).Msg("HTTPRequest")
 	return resp, err
 }
 
+// RedactURL returns u as a string with any password and the values of any
+// sensitive query parameters redacted.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redactedURL := *u
+	if u.RawQuery != "" {
+		query := u.Query()
+		redactedQuery := false
+		for name, values := range query {
+			if !isSensitiveName(name) {
+				continue
+			}
+			for i := range values {
+				values[i] = redacted
+			}
+			redactedQuery = true
+		}
+		if redactedQuery {
+			redactedURL.RawQuery = query.Encode()
+		}
+	}
+	return redactedURL.Redacted()
+}
+
+// isSensitiveHTTPHeader returns if the value of the HTTP header name should be
+// redacted.
+func isSensitiveHTTPHeader(name string) bool {
+	return sensitiveHTTPHeaders[http.CanonicalHeaderKey(name)] || isSensitiveName(name)
+}
+
+// isSensitiveName returns if the value of a header or query parameter called
+// name should be redacted.
+func isSensitiveName(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, substring := range sensitiveNameSubstrings {
+		if strings.Contains(lowerName, substring) {
+			return true
+		}
+	}
+	return false
+}
+
 // LogCmdCombinedOutput calls cmd.CombinedOutput, logs the result, and returns the result.
 func LogCmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
 	start := time.Now()
@@ -151,6 +243,25 @@ func LogCmdOutput(cmd *exec.Cmd) ([]byte, error) {
 	return output, err
 }
 
+// LogCmdOutputRedacted calls cmd.Output, logs the result without the output,
+// and returns the result. It is used for commands whose output contains
+// secrets.
+func LogCmdOutputRedacted(cmd *exec.Cmd) ([]byte, error) {
+	start := time.Now()
+	output, err := cmd.Output()
+	event := log.Err(err).
+		EmbedObject(OSExecCmdLogObject{Cmd: cmd}).
+		EmbedObject(OSExecExitErrorLogObject{Err: err}).
+		Stringer("duration", time.Since(start))
+	if len(output) != 0 {
+		event.Str("output", redacted)
+	}
+	event.
+		Int("size", len(output)).
+		Msg("Output")
+	return output, err
+}
+
 // LogCmdRun calls cmd.Run, logs the result, and returns the result.
 func LogCmdRun(cmd *exec.Cmd) error {
 	start := time.Now()
@@ -0,0 +1,123 @@
+package chezmoilog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// A LogfmtWriter is an io.Writer that converts the JSON log events written by
+// zerolog to logfmt and writes them to an underlying io.Writer.
+type LogfmtWriter struct {
+	w io.Writer
+}
+
+// NewLogfmtWriter returns a new LogfmtWriter that writes to w.
+func NewLogfmtWriter(w io.Writer) *LogfmtWriter {
+	return &LogfmtWriter{
+		w: w,
+	}
+}
+
+// Write implements io.Writer.Write.
+func (w *LogfmtWriter) Write(p []byte) (int, error) {
+	line, err := FormatLogfmt(p)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w.w, line+"\n"); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// FormatLogfmt formats the JSON log event p written by zerolog as logfmt,
+// without a trailing newline.
+func FormatLogfmt(p []byte) (string, error) {
+	fields, err := decodeLogEvent(p)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	for _, key := range []string{
+		zerolog.TimestampFieldName,
+		zerolog.LevelFieldName,
+		zerolog.MessageFieldName,
+	} {
+		if value, ok := fields[key]; ok {
+			writeLogfmtField(&builder, key, value)
+			delete(fields, key)
+		}
+	}
+	writeLogfmtFields(&builder, "", fields)
+	return builder.String(), nil
+}
+
+// decodeLogEvent decodes the JSON log event p written by zerolog.
+func decodeLogEvent(p []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// writeLogfmtFields writes fields to builder in key order, flattening nested
+// objects into dotted keys prefixed by prefix.
+func writeLogfmtFields(builder *strings.Builder, prefix string, fields map[string]any) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if object, ok := fields[key].(map[string]any); ok {
+			writeLogfmtFields(builder, prefix+key+".", object)
+			continue
+		}
+		writeLogfmtField(builder, prefix+key, fields[key])
+	}
+}
+
+// writeLogfmtField writes a single key=value pair to builder.
+func writeLogfmtField(builder *strings.Builder, key string, value any) {
+	if builder.Len() != 0 {
+		builder.WriteByte(' ')
+	}
+	builder.WriteString(key)
+	builder.WriteByte('=')
+	s := logValueString(value)
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		s = strconv.Quote(s)
+	}
+	builder.WriteString(s)
+}
+
+// logValueString returns value, decoded from a JSON log event, as a string.
+func logValueString(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(data)
+	}
+}
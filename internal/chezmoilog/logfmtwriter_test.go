@@ -0,0 +1,41 @@
+package chezmoilog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestLogfmtWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		event    string
+		expected string
+	}{
+		{
+			name:     "simple",
+			event:    `{"level":"info","component":"system","message":"Run"}`,
+			expected: "level=info message=Run component=system\n",
+		},
+		{
+			name:     "quoted",
+			event:    `{"time":"2006-01-02T15:04:05Z","message":"a b","args":["x","y"],"empty":"","ok":true,"size":3}`,
+			expected: `time=2006-01-02T15:04:05Z message="a b" args="[\"x\",\"y\"]" empty="" ok=true size=3` + "\n",
+		},
+		{
+			name:     "nested",
+			event:    `{"version":{"commit":"abc","version":"2.0.0"}}`,
+			expected: "version.commit=abc version.version=2.0.0\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var builder strings.Builder
+			w := NewLogfmtWriter(&builder)
+			n, err := w.Write([]byte(tc.event))
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.event), n)
+			assert.Equal(t, tc.expected, builder.String())
+		})
+	}
+}
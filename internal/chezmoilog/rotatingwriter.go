@@ -0,0 +1,158 @@
+package chezmoilog
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RotatingWriterOptions are options for a RotatingWriter.
+type RotatingWriterOptions struct {
+	// MaxSize is the maximum size of the log file in bytes. If it is zero
+	// then the log file is not rotated based on its size.
+	MaxSize int64
+	// RotateInterval is the interval at which the log file is rotated. If it
+	// is zero then the log file is not rotated based on time.
+	RotateInterval time.Duration
+	// MaxBackups is the number of rotated log files to keep.
+	MaxBackups int
+	// Perm is the permissions of new log files.
+	Perm fs.FileMode
+}
+
+// A RotatingWriter is an io.WriteCloser that writes to a log file and rotates
+// it when it becomes too large or too old. Rotated log files are named with
+// suffixes .1, .2, and so on, with .1 being the most recent.
+type RotatingWriter struct {
+	mutex       sync.Mutex
+	name        string
+	options     RotatingWriterOptions
+	file        *os.File
+	size        int64
+	periodStart time.Time
+}
+
+// NewRotatingWriter returns a new RotatingWriter that writes to the log file
+// name, which is created if it does not exist.
+func NewRotatingWriter(name string, options RotatingWriterOptions) (*RotatingWriter, error) {
+	if options.Perm == 0 {
+		options.Perm = 0o600
+	}
+	w := &RotatingWriter{
+		name:    name,
+		options: options,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close implements io.Closer.Close.
+func (w *RotatingWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Write implements io.Writer.Write.
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return 0, fs.ErrClosed
+	}
+	if w.shouldRotate(time.Now(), len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// open opens w's log file. If the existing log file is already due for
+// rotation then it is rotated first.
+func (w *RotatingWriter) open() error {
+	fileInfo, err := os.Stat(w.name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		w.size = fileInfo.Size()
+		w.periodStart = w.truncate(fileInfo.ModTime())
+		if w.shouldRotate(time.Now(), 0) {
+			return w.rotate()
+		}
+	}
+	file, err := os.OpenFile(w.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, w.options.Perm)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.periodStart = w.truncate(time.Now())
+	return nil
+}
+
+// rotate closes the current log file, renames it and any previously rotated
+// log files, removes the oldest rotated log files, and opens a new log file.
+func (w *RotatingWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	if err := os.Remove(w.backupName(w.options.MaxBackups)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := w.options.MaxBackups - 1; i >= 0; i-- {
+		if err := os.Rename(w.backupName(i), w.backupName(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	w.size = 0
+	return w.open()
+}
+
+// backupName returns the name of the ith rotated log file, where the zeroth
+// rotated log file is the current log file.
+func (w *RotatingWriter) backupName(i int) string {
+	if i == 0 {
+		return w.name
+	}
+	return w.name + "." + strconv.Itoa(i)
+}
+
+// shouldRotate returns whether the log file should be rotated before writing n
+// bytes at now.
+func (w *RotatingWriter) shouldRotate(now time.Time, n int) bool {
+	switch {
+	case w.size == 0:
+		return false
+	case w.options.MaxSize > 0 && w.size+int64(n) > w.options.MaxSize:
+		return true
+	case w.options.RotateInterval > 0 && w.truncate(now).After(w.periodStart):
+		return true
+	default:
+		return false
+	}
+}
+
+// truncate returns t rounded down to the start of its rotation interval.
+func (w *RotatingWriter) truncate(t time.Time) time.Time {
+	if w.options.RotateInterval <= 0 {
+		return t
+	}
+	return t.Truncate(w.options.RotateInterval)
+}
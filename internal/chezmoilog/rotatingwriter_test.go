@@ -0,0 +1,38 @@
+package chezmoilog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "chezmoi.log")
+	w, err := NewRotatingWriter(name, RotatingWriterOptions{
+		MaxSize:    8,
+		MaxBackups: 2,
+	})
+	assert.NoError(t, err)
+	for _, s := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := w.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	for _, tc := range []struct {
+		name     string
+		expected string
+	}{
+		{name: name, expected: "fourth\n"},
+		{name: name + ".1", expected: "third\n"},
+		{name: name + ".2", expected: "second\n"},
+	} {
+		actual, err := os.ReadFile(tc.name)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, string(actual))
+	}
+	_, err = os.Stat(name + ".3")
+	assert.Error(t, err)
+}
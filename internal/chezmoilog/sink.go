@@ -0,0 +1,40 @@
+package chezmoilog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// A LevelWriteCloser is a log sink.
+type LevelWriteCloser interface {
+	zerolog.LevelWriter
+	io.Closer
+}
+
+// A FormatFunc formats a JSON log event written by zerolog as a single
+// message for a log sink.
+type FormatFunc func(p []byte) (string, error)
+
+// FormatConsole formats the JSON log event p in zerolog's console format,
+// without color, the timestamp, or a trailing newline. Log sinks record their
+// own timestamps.
+func FormatConsole(p []byte) (string, error) {
+	var buffer bytes.Buffer
+	consoleWriter := zerolog.ConsoleWriter{
+		Out:          &buffer,
+		NoColor:      true,
+		PartsExclude: []string{zerolog.TimestampFieldName},
+	}
+	if _, err := consoleWriter.Write(p); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
+
+// FormatJSON returns the JSON log event p without a trailing newline.
+func FormatJSON(p []byte) (string, error) {
+	return string(bytes.TrimSuffix(p, []byte{'\n'})), nil
+}
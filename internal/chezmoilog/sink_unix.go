@@ -0,0 +1,203 @@
+//go:build unix
+
+package chezmoilog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/syslog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// journaldSocket is the path of journald's native protocol socket.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// A SyslogWriter is a zerolog.LevelWriter that writes log events to the local
+// syslog daemon.
+type SyslogWriter struct {
+	writer     *syslog.Writer
+	formatFunc FormatFunc
+}
+
+// A JournaldWriter is a zerolog.LevelWriter that writes log events to the
+// systemd journal using journald's native protocol, so that each field of the
+// log event is recorded as a separate journal field.
+type JournaldWriter struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// NewSyslogWriter returns a new SyslogWriter that writes messages formatted
+// with formatFunc and tagged with tag.
+func NewSyslogWriter(tag string, formatFunc FormatFunc) (LevelWriteCloser, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogWriter{
+		writer:     writer,
+		formatFunc: formatFunc,
+	}, nil
+}
+
+// Close closes the connection to the syslog daemon.
+func (w *SyslogWriter) Close() error {
+	return w.writer.Close()
+}
+
+// Write implements io.Writer.Write.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.WriteLevel.
+func (w *SyslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	message, err := w.formatFunc(p)
+	if err != nil {
+		return 0, err
+	}
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		err = w.writer.Debug(message)
+	case zerolog.WarnLevel:
+		err = w.writer.Warning(message)
+	case zerolog.ErrorLevel:
+		err = w.writer.Err(message)
+	case zerolog.FatalLevel:
+		err = w.writer.Crit(message)
+	case zerolog.PanicLevel:
+		err = w.writer.Emerg(message)
+	default:
+		err = w.writer.Info(message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewJournaldWriter returns a new JournaldWriter that records log events with
+// the syslog identifier identifier.
+func NewJournaldWriter(identifier string) (LevelWriteCloser, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: journaldSocket,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &JournaldWriter{
+		conn:       conn,
+		identifier: identifier,
+	}, nil
+}
+
+// Close closes the connection to journald.
+func (w *JournaldWriter) Close() error {
+	return w.conn.Close()
+}
+
+// Write implements io.Writer.Write.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.WriteLevel.
+func (w *JournaldWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	fields, err := decodeLogEvent(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var buffer bytes.Buffer
+	message, _ := fields[zerolog.MessageFieldName].(string)
+	writeJournaldField(&buffer, "MESSAGE", message)
+	writeJournaldField(&buffer, "PRIORITY", strconv.Itoa(journaldPriority(level)))
+	writeJournaldField(&buffer, "SYSLOG_IDENTIFIER", w.identifier)
+	delete(fields, zerolog.LevelFieldName)
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.TimestampFieldName)
+	writeJournaldFields(&buffer, "", fields)
+
+	if _, err := w.conn.Write(buffer.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// journaldPriority returns the syslog priority of level.
+func journaldPriority(level zerolog.Level) int {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return int(syslog.LOG_DEBUG)
+	case zerolog.WarnLevel:
+		return int(syslog.LOG_WARNING)
+	case zerolog.ErrorLevel:
+		return int(syslog.LOG_ERR)
+	case zerolog.FatalLevel:
+		return int(syslog.LOG_CRIT)
+	case zerolog.PanicLevel:
+		return int(syslog.LOG_EMERG)
+	default:
+		return int(syslog.LOG_INFO)
+	}
+}
+
+// writeJournaldFields writes fields to buffer in key order, flattening nested
+// objects into keys prefixed by prefix.
+func writeJournaldFields(buffer *bytes.Buffer, prefix string, fields map[string]any) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if object, ok := fields[key].(map[string]any); ok {
+			writeJournaldFields(buffer, prefix+key+"_", object)
+			continue
+		}
+		if name := journaldFieldName(prefix + key); name != "" {
+			writeJournaldField(buffer, name, logValueString(fields[key]))
+		}
+	}
+}
+
+// writeJournaldField writes a single field to buffer. Values that contain
+// newlines are written in journald's binary format.
+func writeJournaldField(buffer *bytes.Buffer, name, value string) {
+	buffer.WriteString(name)
+	if strings.ContainsRune(value, '\n') {
+		buffer.WriteByte('\n')
+		_ = binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buffer.WriteByte('=')
+	}
+	buffer.WriteString(value)
+	buffer.WriteByte('\n')
+}
+
+// journaldFieldName returns key converted to a valid journald field name, or
+// the empty string if key cannot be converted. Valid field names contain only
+// uppercase letters, digits, and underscores, and do not start with an
+// underscore, which is reserved for trusted fields.
+func journaldFieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, b := range name {
+		if !('A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_') {
+			name[i] = '_'
+		}
+	}
+	return strings.TrimLeft(string(name), "_0123456789")
+}
+
+// NewEventLogWriter returns an error as the Windows Event Log is only available
+// on Windows.
+func NewEventLogWriter(source string, formatFunc FormatFunc) (LevelWriteCloser, error) {
+	return nil, errors.New("the Windows Event Log is only available on Windows")
+}
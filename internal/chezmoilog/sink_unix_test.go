@@ -0,0 +1,29 @@
+//go:build unix
+
+package chezmoilog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestJournaldFieldName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"component":     "COMPONENT",
+		"version.major": "VERSION_MAJOR",
+		"_private":      "PRIVATE",
+		"statusCode":    "STATUSCODE",
+		"0":             "",
+	} {
+		assert.Equal(t, expected, journaldFieldName(key))
+	}
+}
+
+func TestWriteJournaldField(t *testing.T) {
+	var buffer bytes.Buffer
+	writeJournaldField(&buffer, "MESSAGE", "Run")
+	writeJournaldField(&buffer, "OUTPUT", "a\nb")
+	assert.Equal(t, "MESSAGE=Run\nOUTPUT\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", buffer.String())
+}
@@ -0,0 +1,75 @@
+package chezmoilog
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventLogEventID is the event ID of all events that chezmoi writes to the
+// Windows Event Log.
+const eventLogEventID = 1
+
+// An EventLogWriter is a zerolog.LevelWriter that writes log events to the
+// Windows Event Log.
+type EventLogWriter struct {
+	log        *eventlog.Log
+	formatFunc FormatFunc
+}
+
+// NewEventLogWriter returns a new EventLogWriter that writes messages
+// formatted with formatFunc to the Application log with the event source
+// source. The event source does not need to be registered, but if it is not
+// then Event Viewer displays a warning that the event's description cannot be
+// found alongside the message.
+func NewEventLogWriter(source string, formatFunc FormatFunc) (LevelWriteCloser, error) {
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogWriter{
+		log:        log,
+		formatFunc: formatFunc,
+	}, nil
+}
+
+// Close closes the Windows Event Log.
+func (w *EventLogWriter) Close() error {
+	return w.log.Close()
+}
+
+// Write implements io.Writer.Write.
+func (w *EventLogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.WriteLevel.
+func (w *EventLogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	message, err := w.formatFunc(p)
+	if err != nil {
+		return 0, err
+	}
+	switch level {
+	case zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel:
+		err = w.log.Error(eventLogEventID, message)
+	case zerolog.WarnLevel:
+		err = w.log.Warning(eventLogEventID, message)
+	default:
+		err = w.log.Info(eventLogEventID, message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewJournaldWriter returns an error as journald is not available on Windows.
+func NewJournaldWriter(identifier string) (LevelWriteCloser, error) {
+	return nil, errors.New("journald is not available on Windows")
+}
+
+// NewSyslogWriter returns an error as syslog is not available on Windows.
+func NewSyslogWriter(tag string, formatFunc FormatFunc) (LevelWriteCloser, error) {
+	return nil, errors.New("syslog is not available on Windows")
+}
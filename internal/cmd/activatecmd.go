@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// linkGenerationStateBucket is the bucket for recording the generations of
+// the link directory.
+var linkGenerationStateBucket = []byte("linkGenerationState")
+
+type activateCmdConfig struct {
+	generation int
+	list       bool
+}
+
+// A linkGenerationState records a generation of the link directory.
+type linkGenerationState struct {
+	Profile   string    `json:"profile"   yaml:"profile"`
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+}
+
+func (c *Config) newActivateCmd() *cobra.Command {
+	activateCmd := &cobra.Command{
+		Use:               "activate [profile]",
+		Short:             "Render a profile into a new generation of the link directory and switch to it",
+		Long:              mustLongHelp("activate"),
+		Example:           example("activate"),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: c.profileValidArgs,
+		RunE:              c.runActivateCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	activateFlags := activateCmd.Flags()
+	activateFlags.IntVar(&c.activate.generation, "generation", c.activate.generation, "Switch to an existing generation")
+	activateFlags.BoolVar(&c.activate.list, "list", c.activate.list, "List generations")
+	activateCmd.MarkFlagsMutuallyExclusive("generation", "list")
+
+	return activateCmd
+}
+
+func (c *Config) runActivateCmd(cmd *cobra.Command, args []string) error {
+	switch {
+	case c.activate.list:
+		if len(args) != 0 {
+			return errors.New("--list: cannot specify a profile")
+		}
+		return c.listLinkGenerations()
+	case c.activate.generation != 0:
+		if len(args) != 0 {
+			return errors.New("--generation: cannot specify a profile")
+		}
+		generationAbsPath := c.linkGenerationAbsPath(c.activate.generation)
+		if _, err := c.destSystem.Stat(generationAbsPath); err != nil {
+			return fmt.Errorf("generation %d: %w", c.activate.generation, err)
+		}
+		return c.switchLinkGeneration(c.activate.generation)
+	case len(args) == 0:
+		return errors.New("no profile specified")
+	}
+
+	profile := args[0]
+	data, ok := c.Profiles[profile]
+	if !ok {
+		return fmt.Errorf("%s: profile not defined", profile)
+	}
+	sourceState, err := c.newProfileSourceState(cmd, c.DestDirAbsPath, data, chezmoi.WithLinkGenerations(true))
+	if err != nil {
+		return err
+	}
+
+	generations, err := c.linkGenerationNumbers()
+	if err != nil {
+		return err
+	}
+	generation := 1
+	if len(generations) != 0 {
+		generation = generations[len(generations)-1] + 1
+	}
+	generationAbsPath := c.linkGenerationAbsPath(generation)
+	if err := sourceState.WriteLinkGeneration(c.destSystem, chezmoi.NewReadOnlySystem(c.destSystem), generationAbsPath); err != nil {
+		return err
+	}
+	if err := chezmoi.PersistentStateSet(
+		c.persistentState, linkGenerationStateBucket, []byte(strconv.Itoa(generation)), &linkGenerationState{
+			Profile:   profile,
+			CreatedAt: time.Now().UTC(),
+		},
+	); err != nil {
+		return err
+	}
+	return c.switchLinkGeneration(generation)
+}
+
+// linkGenerationAbsPath returns the path of generation in the link directory.
+func (c *Config) linkGenerationAbsPath(generation int) chezmoi.AbsPath {
+	return c.LinkDirAbsPath.JoinString(chezmoi.LinkGenerationsDirName, strconv.Itoa(generation))
+}
+
+// linkGenerationNumbers returns the generations in the link directory, in
+// ascending order.
+func (c *Config) linkGenerationNumbers() ([]int, error) {
+	dirEntries, err := c.baseSystem.ReadDir(c.LinkDirAbsPath.JoinString(chezmoi.LinkGenerationsDirName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	generations := make([]int, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if generation, err := strconv.Atoi(dirEntry.Name()); err == nil && dirEntry.IsDir() {
+			generations = append(generations, generation)
+		}
+	}
+	sort.Ints(generations)
+	return generations, nil
+}
+
+// currentLinkGeneration returns the current generation of the link directory,
+// or zero if there is no current generation.
+func (c *Config) currentLinkGeneration() int {
+	linkname, err := c.baseSystem.Readlink(c.LinkDirAbsPath.JoinString(chezmoi.LinkCurrentName))
+	if err != nil {
+		return 0
+	}
+	generation, err := strconv.Atoi(strings.TrimPrefix(linkname, chezmoi.LinkGenerationsDirName+"/"))
+	if err != nil {
+		return 0
+	}
+	return generation
+}
+
+// linkGenerationsEnabled returns if the link directory has a current
+// generation.
+func (c *Config) linkGenerationsEnabled() bool {
+	fileInfo, err := c.baseSystem.Lstat(c.LinkDirAbsPath.JoinString(chezmoi.LinkCurrentName))
+	return err == nil && fileInfo.Mode().Type() == fs.ModeSymlink
+}
+
+// listLinkGenerations writes a table of the generations of the link
+// directory.
+func (c *Config) listLinkGenerations() error {
+	generations, err := c.linkGenerationNumbers()
+	if err != nil {
+		return err
+	}
+	currentGeneration := c.currentLinkGeneration()
+
+	var builder strings.Builder
+	tabWriter := tabwriter.NewWriter(&builder, 3, 0, 3, ' ', 0)
+	fmt.Fprint(tabWriter, "GENERATION\tPROFILE\tCREATED\tCURRENT\n")
+	for _, generation := range generations {
+		profile, createdAt := "-", "-"
+		var state linkGenerationState
+		switch ok, err := chezmoi.PersistentStateGet(
+			c.persistentState, linkGenerationStateBucket, []byte(strconv.Itoa(generation)), &state,
+		); {
+		case err != nil:
+			return err
+		case ok:
+			profile = state.Profile
+			createdAt = state.CreatedAt.Format(time.RFC3339)
+		}
+		current := ""
+		if generation == currentGeneration {
+			current = "*"
+		}
+		fmt.Fprintf(tabWriter, "%d\t%s\t%s\t%s\n", generation, profile, createdAt, current)
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	return c.writeOutputString(builder.String())
+}
+
+// profileValidArgs returns the names of all profiles.
+func (c *Config) profileValidArgs(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for profile := range c.Profiles {
+		if strings.HasPrefix(profile, toComplete) {
+			completions = append(completions, profile)
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// switchLinkGeneration atomically makes generation the current generation of
+// the link directory by replacing the current symlink.
+func (c *Config) switchLinkGeneration(generation int) error {
+	currentAbsPath := c.LinkDirAbsPath.JoinString(chezmoi.LinkCurrentName)
+	tempAbsPath := c.LinkDirAbsPath.JoinString("." + chezmoi.LinkCurrentName + ".tmp")
+	c.tempAbsPaths[tempAbsPath] = struct{}{}
+	defer delete(c.tempAbsPaths, tempAbsPath)
+	if err := c.destSystem.RemoveAll(tempAbsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	linkname := chezmoi.LinkGenerationsDirName + "/" + strconv.Itoa(generation)
+	if err := c.destSystem.WriteSymlink(linkname, tempAbsPath); err != nil {
+		return err
+	}
+	return c.destSystem.Rename(tempAbsPath, currentAbsPath)
+}
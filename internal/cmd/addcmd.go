@@ -1,27 +1,64 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io/fs"
+	"path"
+	"sort"
+	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+// An autoTemplateStringConfig configures a string that is replaced by a
+// template when automatically creating templates.
+type autoTemplateStringConfig struct {
+	String   string `json:"string"   mapstructure:"string"   yaml:"string"`
+	Template string `json:"template" mapstructure:"template" yaml:"template"`
+}
+
 type addCmdConfig struct {
-	Encrypt          bool     `json:"encrypt"          mapstructure:"encrypt"          yaml:"encrypt"`
-	Secrets          severity `json:"secrets"          mapstructure:"secrets"          yaml:"secrets"`
-	TemplateSymlinks bool     `json:"templateSymlinks" mapstructure:"templateSymlinks" yaml:"templateSymlinks"`
-	autoTemplate     bool
-	create           bool
-	exact            bool
-	filter           *chezmoi.EntryTypeFilter
-	follow           bool
-	prompt           bool
-	quiet            bool
-	recursive        bool
-	template         bool
+	AutoTemplatePreview bool                       `json:"autoTemplatePreview" mapstructure:"autoTemplatePreview" yaml:"autoTemplatePreview"`
+	AutoTemplateRules   []string                   `json:"autoTemplateRules"   mapstructure:"autoTemplateRules"   yaml:"autoTemplateRules"`
+	AutoTemplateStrings []autoTemplateStringConfig `json:"autoTemplateStrings" mapstructure:"autoTemplateStrings" yaml:"autoTemplateStrings"`
+	Encrypt             bool                       `json:"encrypt"             mapstructure:"encrypt"             yaml:"encrypt"`
+	Presets             map[string][]string        `json:"presets"             mapstructure:"presets"             yaml:"presets"`
+	Secrets             severity                   `json:"secrets"             mapstructure:"secrets"             yaml:"secrets"`
+	SecretsAllowlist    secretsAllowlistConfig     `json:"secretsAllowlist"    mapstructure:"secretsAllowlist"    yaml:"secretsAllowlist"`
+	Suggest             bool                       `json:"suggest"             mapstructure:"suggest"             yaml:"suggest"`
+	TemplateSymlinks    bool                       `json:"templateSymlinks"    mapstructure:"templateSymlinks"    yaml:"templateSymlinks"`
+	autoTemplate        bool
+	autoTemplateAll     bool
+	create              bool
+	exact               bool
+	excludeGlobs        []string
+	filter              *chezmoi.EntryTypeFilter
+	follow              bool
+	includeGlobs        []string
+	preset              string
+	private             bool
+	prompt              bool
+	quiet               bool
+	readOnly            bool
+	recursive           bool
+	template            bool
+}
+
+// addPresetAttributes are the attributes that can be set by add presets.
+var addPresetAttributes = []string{
+	"autotemplate",
+	"create",
+	"encrypt",
+	"exact",
+	"private",
+	"readonly",
+	"template",
 }
 
 func (c *Config) newAddCmd() *cobra.Command {
@@ -49,16 +86,26 @@ func (c *Config) newAddCmd() *cobra.Command {
 		c.Add.autoTemplate,
 		"Generate the template when adding files as templates",
 	)
+	flags.BoolVar(
+		&c.Add.AutoTemplatePreview,
+		"autotemplate-preview",
+		c.Add.AutoTemplatePreview,
+		"Preview generated templates before adding them",
+	)
 	flags.BoolVar(&c.Add.create, "create", c.Add.create, "Add files that should exist, irrespective of their contents")
 	flags.BoolVar(&c.Add.Encrypt, "encrypt", c.Add.Encrypt, "Encrypt files")
 	flags.BoolVar(&c.Add.exact, "exact", c.Add.exact, "Add directories exactly")
 	flags.VarP(c.Add.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.StringArrayVar(&c.Add.excludeGlobs, "exclude-glob", c.Add.excludeGlobs, "Exclude paths matching pattern")
 	flags.BoolVarP(&c.Add.follow, "follow", "f", c.Add.follow, "Add symlink targets instead of symlinks")
 	flags.VarP(c.Add.filter.Include, "include", "i", "Include entry types")
+	flags.StringArrayVar(&c.Add.includeGlobs, "include-glob", c.Add.includeGlobs, "Include only paths matching pattern")
+	flags.StringVar(&c.Add.preset, "preset", c.Add.preset, "Set attributes from preset")
 	flags.BoolVarP(&c.Add.prompt, "prompt", "p", c.Add.prompt, "Prompt before adding each entry")
 	flags.BoolVarP(&c.Add.quiet, "quiet", "q", c.Add.quiet, "Suppress warnings")
 	flags.BoolVarP(&c.Add.recursive, "recursive", "r", c.Add.recursive, "Recurse into subdirectories")
 	flags.Var(&c.Add.Secrets, "secrets", "Scan for secrets when adding unencrypted files")
+	flags.BoolVar(&c.Add.Suggest, "suggest", c.Add.Suggest, "Suggest attributes for added files")
 	flags.BoolVarP(&c.Add.template, "template", "T", c.Add.template, "Add files as templates")
 	flags.BoolVar(
 		&c.Add.TemplateSymlinks,
@@ -68,6 +115,9 @@ func (c *Config) newAddCmd() *cobra.Command {
 	)
 
 	registerExcludeIncludeFlagCompletionFuncs(addCmd)
+	if err := addCmd.RegisterFlagCompletionFunc("preset", c.addPresetFlagCompletionFunc); err != nil {
+		panic(err)
+	}
 	if err := addCmd.RegisterFlagCompletionFunc("secrets", severityFlagCompletionFunc); err != nil {
 		panic(err)
 	}
@@ -75,6 +125,186 @@ func (c *Config) newAddCmd() *cobra.Command {
 	return addCmd
 }
 
+// addPresetFlagCompletionFunc completes the names of add presets and
+// attributes.
+func (c *Config) addPresetFlagCompletionFunc(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if index := strings.LastIndex(toComplete, "+"); index != -1 {
+		prefix, toComplete = toComplete[:index+1], toComplete[index+1:]
+	}
+	names := append([]string(nil), addPresetAttributes...)
+	for name := range c.Add.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var completions []string
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, prefix+name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// applyAddPreset sets the attributes in preset, which is a list of attributes
+// or the names of presets in the config file separated by +s.
+func (c *Config) applyAddPreset(preset string, seen map[string]struct{}) error {
+	return c.walkAddPreset(preset, seen, func(attribute string) {
+		switch attribute {
+		case "autotemplate":
+			c.Add.autoTemplate = true
+		case "create":
+			c.Add.create = true
+		case "encrypt":
+			c.Add.Encrypt = true
+		case "exact":
+			c.Add.exact = true
+		case "private":
+			c.Add.private = true
+		case "readonly":
+			c.Add.readOnly = true
+		case "template":
+			c.Add.template = true
+		}
+	})
+}
+
+// walkAddPreset calls f with each attribute in preset, expanding the names of
+// presets in the config file.
+func (c *Config) walkAddPreset(preset string, seen map[string]struct{}, f func(attribute string)) error {
+	for _, name := range strings.Split(preset, "+") {
+		if slices.Contains(addPresetAttributes, name) {
+			f(name)
+			continue
+		}
+		presetAttributes, ok := c.Add.Presets[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown preset or attribute", name)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("%s: recursive preset", name)
+		}
+		seen[name] = struct{}{}
+		for _, presetAttribute := range presetAttributes {
+			if err := c.walkAddPreset(presetAttribute, seen, f); err != nil {
+				return err
+			}
+		}
+		delete(seen, name)
+	}
+	return nil
+}
+
+// addGlobFilterFunc returns whether the entry at targetRelPath should be added,
+// according to the include and exclude glob patterns. Patterns that do not
+// contain a slash match against the entry's name, other patterns match against
+// the entry's path relative to the destination directory. Directories are
+// skipped if they match an exclude pattern, and, if there are include
+// patterns, are only added as parents of included entries.
+func (c *Config) addGlobFilterFunc(targetRelPath chezmoi.RelPath, fileInfo fs.FileInfo) (bool, error) {
+	matchAny := func(patterns []string) (bool, error) {
+		for _, pattern := range patterns {
+			name := targetRelPath.String()
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(name)
+			}
+			switch match, err := doublestar.Match(pattern, name); {
+			case err != nil:
+				return false, fmt.Errorf("%s: %w", pattern, err)
+			case match:
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	switch excluded, err := matchAny(c.Add.excludeGlobs); {
+	case err != nil:
+		return false, err
+	case excluded && fileInfo.IsDir():
+		return false, fs.SkipDir
+	case excluded:
+		return false, nil
+	}
+
+	if len(c.Add.includeGlobs) == 0 {
+		return true, nil
+	}
+	if fileInfo.IsDir() {
+		return false, nil
+	}
+	return matchAny(c.Add.includeGlobs)
+}
+
+// autoTemplateRules returns the auto template rules configured by
+// add.autoTemplateRules and add.autoTemplateStrings.
+func (c *Config) autoTemplateRules() ([]chezmoi.AutoTemplateRule, error) {
+	rules := make([]chezmoi.AutoTemplateRule, 0, len(c.Add.AutoTemplateRules)+1)
+	for _, name := range c.Add.AutoTemplateRules {
+		rule, ok := chezmoi.AutoTemplateRules[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown auto template rule", name)
+		}
+		rules = append(rules, rule)
+	}
+	if len(c.Add.AutoTemplateStrings) > 0 {
+		templates := make(map[string]string, len(c.Add.AutoTemplateStrings))
+		for _, autoTemplateString := range c.Add.AutoTemplateStrings {
+			templates[autoTemplateString.String] = autoTemplateString.Template
+		}
+		rules = append(rules, chezmoi.NewAutoTemplateStringsRule(templates))
+	}
+	return rules, nil
+}
+
+// defaultAutoTemplateFunc prints the changes made by automatically creating a
+// template from contents and prompts the user to confirm that the template
+// should be used.
+func (c *Config) defaultAutoTemplateFunc(
+	targetRelPath chezmoi.RelPath,
+	contents, templateContents []byte,
+) (bool, error) {
+	mode := 0o666 &^ c.Umask
+	diffPatch, err := chezmoi.DiffPatch(targetRelPath, contents, mode, templateContents, mode)
+	if err != nil {
+		return false, err
+	}
+	unifiedEncoder := diff.NewUnifiedEncoder(c.stdout, diff.DefaultContextLines)
+	if c.Color.Value(c.colorAutoFunc) {
+		unifiedEncoder.SetColor(diff.NewColorConfig())
+	}
+	if err := unifiedEncoder.Encode(diffPatch); err != nil {
+		return false, err
+	}
+
+	if c.force || c.Add.autoTemplateAll {
+		return true, nil
+	}
+
+	prompt := fmt.Sprintf("add %s as template", targetRelPath)
+	for {
+		switch choice, err := c.promptChoice(prompt, choicesYesNoAllQuit); {
+		case err != nil:
+			return false, err
+		case choice == "all":
+			c.Add.autoTemplateAll = true
+			return true, nil
+		case choice == "no":
+			return false, nil
+		case choice == "quit":
+			return false, chezmoi.ExitCodeError(0)
+		case choice == "yes":
+			return true, nil
+		default:
+			panic(choice + ": unexpected choice")
+		}
+	}
+}
+
 func (c *Config) defaultOnIgnoreFunc(targetRelPath chezmoi.RelPath) {
 	if !c.Add.quiet {
 		c.errorf("warning: ignoring %s\n", targetRelPath)
@@ -89,19 +319,28 @@ func (c *Config) defaultPreAddFunc(targetRelPath chezmoi.RelPath, fileInfo fs.Fi
 		if err != nil {
 			return err
 		}
-		gitleaksDetector, err := c.getGitleaksDetector()
+		findings, err := c.findSecrets(targetRelPath, content)
 		if err != nil {
 			return err
 		}
-		findings := gitleaksDetector.DetectBytes(content)
 		for _, finding := range findings {
-			c.errorf("%s:%d: %s\n", absPath, finding.StartLine+1, finding.Description)
+			c.errorf("%s:%d: %s\n", absPath, finding.line, finding.description)
+		}
+		if c.Add.Suggest && len(findings) > 0 {
+			c.errorf("%s: suggestion: add with --encrypt\n", absPath)
 		}
 		if !c.force && c.Add.Secrets == severityError && len(findings) > 0 {
 			return chezmoi.ExitCodeError(1)
 		}
 	}
 
+	// Suggest templating machine-specific strings, if configured.
+	if c.Add.Suggest && fileInfo.Mode().Type() == 0 && !c.Add.template && !c.Add.autoTemplate {
+		if err := c.suggestAddTemplate(targetRelPath); err != nil {
+			return err
+		}
+	}
+
 	if !c.Add.prompt {
 		return nil
 	}
@@ -126,6 +365,45 @@ func (c *Config) defaultPreAddFunc(targetRelPath chezmoi.RelPath, fileInfo fs.Fi
 	}
 }
 
+// suggestAddTemplate prints a suggestion to add the file at targetRelPath as a
+// template if it contains machine-specific strings.
+func (c *Config) suggestAddTemplate(targetRelPath chezmoi.RelPath) error {
+	if c.templateData == nil {
+		return nil
+	}
+	absPath := c.DestDirAbsPath.Join(targetRelPath)
+	content, err := c.destSystem.ReadFile(absPath)
+	if err != nil {
+		return err
+	}
+	lines := bytes.Split(content, []byte{'\n'})
+	suggest := false
+	for _, variable := range []struct {
+		name  string
+		value string
+	}{
+		{".chezmoi.homeDir", c.templateData.homeDir.String()},
+		{".chezmoi.fqdnHostname", c.templateData.fqdnHostname},
+		{".chezmoi.hostname", c.templateData.hostname},
+		{".chezmoi.username", c.templateData.username},
+	} {
+		if variable.value == "" {
+			continue
+		}
+		for i, line := range lines {
+			if bytes.Contains(line, []byte(variable.value)) {
+				c.errorf("%s:%d: machine-specific string %q matches %s\n", absPath, i+1, variable.value, variable.name)
+				suggest = true
+				break
+			}
+		}
+	}
+	if suggest {
+		c.errorf("%s: suggestion: add with --autotemplate or --template\n", absPath)
+	}
+	return nil
+}
+
 // defaultReplaceFunc prompts the user for confirmation if the adding the entry
 // would remove any of the encrypted, private, or template attributes.
 func (c *Config) defaultReplaceFunc(
@@ -178,10 +456,25 @@ func (c *Config) defaultReplaceFunc(
 }
 
 func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
-	destAbsPathInfos, err := c.destAbsPathInfos(sourceState, args, destAbsPathInfosOptions{
+	if c.Add.preset != "" {
+		if err := c.applyAddPreset(c.Add.preset, make(map[string]struct{})); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range append(append([]string(nil), c.Add.includeGlobs...), c.Add.excludeGlobs...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("%s: %w", pattern, doublestar.ErrBadPattern)
+		}
+	}
+
+	options := destAbsPathInfosOptions{
 		follow:    c.Mode == chezmoi.ModeSymlink || c.Add.follow,
 		recursive: c.Add.recursive,
-	})
+	}
+	if len(c.Add.includeGlobs) > 0 || len(c.Add.excludeGlobs) > 0 {
+		options.filterFunc = c.addGlobFilterFunc
+	}
+	destAbsPathInfos, err := c.destAbsPathInfos(sourceState, args, options)
 	if err != nil {
 		return err
 	}
@@ -191,20 +484,32 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 		return err
 	}
 
+	autoTemplateRules, err := c.autoTemplateRules()
+	if err != nil {
+		return err
+	}
+	var autoTemplateFunc chezmoi.AutoTemplateFunc
+	if c.Add.AutoTemplatePreview {
+		autoTemplateFunc = c.defaultAutoTemplateFunc
+	}
+
 	return sourceState.Add(
 		c.sourceSystem,
 		c.persistentState,
 		c.destSystem,
 		destAbsPathInfos,
 		&chezmoi.AddOptions{
-			AutoTemplate:    c.Add.autoTemplate,
-			Create:          c.Add.create,
-			Encrypt:         c.Add.Encrypt,
-			EncryptedSuffix: c.encryption.EncryptedSuffix(),
-			Exact:           c.Add.exact,
-			Filter:          c.Add.filter,
-			OnIgnoreFunc:    c.defaultOnIgnoreFunc,
-			PreAddFunc:      c.defaultPreAddFunc,
+			AutoTemplate:      c.Add.autoTemplate,
+			AutoTemplateFunc:  autoTemplateFunc,
+			AutoTemplateRules: autoTemplateRules,
+			Create:            c.Add.create,
+			Encrypt:           c.Add.Encrypt,
+			EncryptedSuffix:   c.encryption.EncryptedSuffix(),
+			Exact:             c.Add.exact,
+			Filter:            c.Add.filter,
+			OnIgnoreFunc:      c.defaultOnIgnoreFunc,
+			PreAddFunc:        c.defaultPreAddFunc,
+			Private:           c.Add.private,
 			ProtectedAbsPaths: []chezmoi.AbsPath{
 				c.CacheDirAbsPath,
 				c.WorkingTreeAbsPath,
@@ -212,6 +517,7 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 				persistentStateFileAbsPath,
 				c.sourceDirAbsPath,
 			},
+			ReadOnly:         c.Add.readOnly,
 			ReplaceFunc:      c.defaultReplaceFunc,
 			Template:         c.Add.template,
 			TemplateSymlinks: c.Add.TemplateSymlinks,
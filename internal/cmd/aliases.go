@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// expandAliases adds a command to rootCmd for each alias in the config file, so
+// that aliases are listed in the help and completed, and returns args with
+// any alias in the command position expanded. Aliases never override builtin
+// commands.
+func (c *Config) expandAliases(rootCmd *cobra.Command, args []string) []string {
+	// When completing, the first argument is the completion command and the
+	// last argument is the word being completed.
+	first, last := 0, len(args)
+	if len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd) {
+		first, last = 1, len(args)-1
+	}
+
+	aliases := c.readAliases(rootCmd.PersistentFlags(), args[first:])
+	if len(aliases) == 0 {
+		return args
+	}
+
+	builtinCmdNames := make(map[string]struct{})
+	for _, cmd := range rootCmd.Commands() {
+		builtinCmdNames[cmd.Name()] = struct{}{}
+		for _, alias := range cmd.Aliases {
+			builtinCmdNames[alias] = struct{}{}
+		}
+	}
+	builtinCmdNames[cobra.ShellCompRequestCmd] = struct{}{}
+	builtinCmdNames[cobra.ShellCompNoDescRequestCmd] = struct{}{}
+	builtinCmdNames["help"] = struct{}{}
+
+	aliasNames := maps.Keys(aliases)
+	slices.Sort(aliasNames)
+	for _, aliasName := range aliasNames {
+		if _, ok := builtinCmdNames[aliasName]; ok {
+			delete(aliases, aliasName)
+			continue
+		}
+		if len(aliases[aliasName]) == 0 {
+			delete(aliases, aliasName)
+			continue
+		}
+		rootCmd.AddCommand(&cobra.Command{
+			Use:                aliasName,
+			Short:              "Alias for " + strings.Join(aliases[aliasName], " "),
+			DisableFlagParsing: true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return fmt.Errorf("%s: cannot expand alias", cmd.Name())
+			},
+			Annotations: newAnnotations(
+				doesNotRequireValidConfig,
+			),
+		})
+	}
+
+	expandedAliases := make(map[string]struct{})
+	for {
+		index, _ := scanArgs(rootCmd.PersistentFlags(), args[first:])
+		if index < 0 || first+index >= last {
+			return args
+		}
+		index += first
+		aliasName := args[index]
+		expansion, ok := aliases[aliasName]
+		if !ok {
+			return args
+		}
+		if _, ok := expandedAliases[aliasName]; ok {
+			return args
+		}
+		expandedAliases[aliasName] = struct{}{}
+		expandedArgs := make([]string, 0, len(args)+len(expansion)-1)
+		expandedArgs = append(expandedArgs, args[:index]...)
+		expandedArgs = append(expandedArgs, expansion...)
+		expandedArgs = append(expandedArgs, args[index+1:]...)
+		last += len(expandedArgs) - len(args)
+		args = expandedArgs
+	}
+}
+
+// readAliases returns the aliases in the config file. It is called before the
+// command line is parsed, so it sets the flags that determine the config file
+// from args itself. Errors are ignored as they are reported when the config
+// file is read normally.
+func (c *Config) readAliases(persistentFlags *pflag.FlagSet, args []string) map[string][]string {
+	_, flagValues := scanArgs(persistentFlags, args)
+	for _, name := range []string{"config", "config-format"} {
+		if value, ok := flagValues[name]; ok {
+			if err := persistentFlags.Lookup(name).Value.Set(value); err != nil {
+				return nil
+			}
+		}
+	}
+
+	configFileAbsPath := c.getConfigFileAbsPath()
+	if configFileAbsPath.Empty() {
+		return nil
+	}
+	var configFile ConfigFile
+	if err := c.decodeConfigFile(configFileAbsPath, &configFile); err != nil {
+		return nil
+	}
+	return configFile.Aliases
+}
+
+// scanArgs returns the index of the first non-flag argument in args, or -1 if
+// there is none, and the values of the flags in flags that precede it.
+func scanArgs(flags *pflag.FlagSet, args []string) (int, map[string]string) {
+	flagValues := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var flag *pflag.Flag
+		var value string
+		var hasValue bool
+		switch {
+		case arg == "--":
+			return -1, flagValues
+		case strings.HasPrefix(arg, "--"):
+			var name string
+			name, value, hasValue = strings.Cut(arg[2:], "=")
+			flag = flags.Lookup(name)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			flag = flags.ShorthandLookup(arg[1:2])
+			if len(arg) > 2 {
+				value, hasValue = strings.TrimPrefix(arg[2:], "="), true
+			}
+		default:
+			return i, flagValues
+		}
+		if flag == nil {
+			continue
+		}
+		switch {
+		case hasValue:
+		case flag.NoOptDefVal != "":
+			value = flag.NoOptDefVal
+		case i+1 < len(args):
+			i++
+			value = args[i]
+		}
+		flagValues[flag.Name] = value
+	}
+	return -1, flagValues
+}
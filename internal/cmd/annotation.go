@@ -21,6 +21,7 @@ var (
 	requiresSourceDirectory       = tagAnnotation("chezmoi_requires_source_directory")
 	requiresWorkingTree           = tagAnnotation("chezmoi_requires_working_tree")
 	runsCommands                  = tagAnnotation("chezmoi_runs_commands")
+	writesSecrets                 = tagAnnotation("chezmoi_writes_secrets")
 )
 
 // Persistent state modes.
@@ -1,15 +1,33 @@
 package cmd
 
 import (
+	"fmt"
+	"io/fs"
+	"time"
+
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+// applyCheckpointStateBucket is the bucket for recording the target entries
+// that have been applied by an apply that has not yet completed.
+var applyCheckpointStateBucket = []byte("applyCheckpointState")
+
 type applyCmdConfig struct {
-	filter    *chezmoi.EntryTypeFilter
-	init      bool
-	recursive bool
+	filter       *chezmoi.EntryTypeFilter
+	init         bool
+	metadataOnly bool
+	recursive    bool
+	resume       bool
+	skipTags     []string
+	tags         []string
+}
+
+// An applyCheckpointState records that a target entry was applied.
+type applyCheckpointState struct {
+	AppliedAt time.Time `json:"appliedAt" yaml:"appliedAt"`
 }
 
 func (c *Config) newApplyCmd() *cobra.Command {
@@ -24,6 +42,7 @@ func (c *Config) newApplyCmd() *cobra.Command {
 			modifiesDestinationDirectory,
 			persistentStateModeReadWrite,
 			requiresSourceDirectory,
+			writesSecrets,
 		),
 	}
 
@@ -31,7 +50,11 @@ func (c *Config) newApplyCmd() *cobra.Command {
 	flags.VarP(c.apply.filter.Exclude, "exclude", "x", "Exclude entry types")
 	flags.VarP(c.apply.filter.Include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.apply.init, "init", c.apply.init, "Recreate config file from template")
+	flags.BoolVar(&c.apply.metadataOnly, "metadata-only", c.apply.metadataOnly, "Only apply changes to metadata")
 	flags.BoolVarP(&c.apply.recursive, "recursive", "r", c.apply.recursive, "Recurse into subdirectories")
+	flags.BoolVar(&c.apply.resume, "resume", c.apply.resume, "Resume an interrupted apply")
+	flags.StringSliceVar(&c.apply.skipTags, "skip-tags", c.apply.skipTags, "Skip entries with tags")
+	flags.StringSliceVar(&c.apply.tags, "tags", c.apply.tags, "Only apply entries with tags")
 
 	registerExcludeIncludeFlagCompletionFuncs(applyCmd)
 
@@ -39,12 +62,199 @@ func (c *Config) newApplyCmd() *cobra.Command {
 }
 
 func (c *Config) runApplyCmd(cmd *cobra.Command, args []string) error {
+	preApplyFunc := c.defaultPreApplyFunc
+	if c.apply.metadataOnly {
+		preApplyFunc = c.metadataOnlyPreApplyFunc
+	}
 	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
 		cmd:          cmd,
+		checkpoint:   true,
 		filter:       c.apply.filter,
+		history:      !c.dryRun,
 		init:         c.apply.init,
+		provision:    len(args) == 0,
 		recursive:    c.apply.recursive,
+		resume:       c.apply.resume,
+		skipTags:     c.apply.skipTags,
+		snapshot:     c.Rollback.Snapshot && !c.dryRun,
+		tags:         c.apply.tags,
 		umask:        c.Umask,
-		preApplyFunc: c.defaultPreApplyFunc,
+		preApplyFunc: preApplyFunc,
 	})
 }
+
+// metadataOnlyPreApplyFunc is a chezmoi.PreApplyFunc that applies only the
+// changes to the metadata of each target, leaving its contents unchanged.
+// Scripts are not run and missing targets are not created.
+func (c *Config) metadataOnlyPreApplyFunc(
+	targetRelPath chezmoi.RelPath,
+	targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+) error {
+	if len(entryStateMetadataChanges(actualEntryState, targetEntryState)) == 0 {
+		return fs.SkipDir
+	}
+	targetAbsPath := c.DestDirAbsPath.Join(targetRelPath)
+	if err := c.destSystem.Chmod(targetAbsPath, targetEntryState.Mode.Perm()); err != nil {
+		return err
+	}
+	// Record the new permissions in the last written entry state so that the
+	// change is not reported as a change made outside chezmoi.
+	if lastWrittenEntryState != nil && lastWrittenEntryState.Type == targetEntryState.Type {
+		entryState := *lastWrittenEntryState
+		entryState.Mode = entryState.Mode.Type() | targetEntryState.Mode.Perm()
+		if err := chezmoi.PersistentStateSet(
+			c.persistentState, chezmoi.EntryStateBucket, targetAbsPath.Bytes(), &entryState,
+		); err != nil {
+			return err
+		}
+	}
+	return fs.SkipDir
+}
+
+// applyHunks prompts the user for each hunk of partialDiff whether it should be
+// applied to targetRelPath and then, after confirmation, writes the selected
+// hunks. If done is true then the pre-apply function should return err: nil if
+// the user selected all hunks so that the target is applied normally, or
+// fs.SkipDir if the selected hunks were written. If done is false then the
+// user selected no hunks or canceled and should be prompted again.
+func (c *Config) applyHunks(
+	targetRelPath chezmoi.RelPath, actualEntryState *chezmoi.EntryState, partialDiff *chezmoi.PartialDiff,
+) (done bool, err error) {
+	options, err := c.diffEncoderOptions()
+	if err != nil {
+		return true, err
+	}
+	var theme *chezmoi.DiffTheme
+	if options.Color {
+		theme = options.Theme
+	}
+
+	n := partialDiff.Len()
+	selected := make([]bool, n)
+	choices := []string{"yes", "no", "rest", "done", "cancel"}
+HUNKS:
+	for i := 0; i < n; i++ {
+		if err := c.writeOutputString(partialDiff.FormatHunk(i, theme)); err != nil {
+			return true, err
+		}
+		prompt := fmt.Sprintf("Apply this hunk to %s (%d/%d)", targetRelPath, i+1, n)
+		switch choice, err := c.promptChoice(prompt, choices); {
+		case err != nil:
+			return true, err
+		case choice == "yes":
+			selected[i] = true
+		case choice == "no":
+		case choice == "rest":
+			for j := i; j < n; j++ {
+				selected[j] = true
+			}
+			break HUNKS
+		case choice == "done":
+			break HUNKS
+		case choice == "cancel":
+			return false, nil
+		default:
+			panic(choice + ": unexpected choice")
+		}
+	}
+
+	count := 0
+	for _, s := range selected {
+		if s {
+			count++
+		}
+	}
+	switch count {
+	case 0:
+		return false, nil
+	case n:
+		return true, nil
+	}
+	prompt := fmt.Sprintf("Apply %d of %d hunks to %s", count, n, targetRelPath)
+	switch ok, err := c.promptBool(prompt); {
+	case err != nil:
+		return true, err
+	case !ok:
+		return false, nil
+	}
+
+	// Write the file with its existing permissions, leaving the last written
+	// entry state unchanged so that the remaining differences are still
+	// reported.
+	targetAbsPath := c.DestDirAbsPath.Join(targetRelPath)
+	contents := partialDiff.Apply(selected)
+	if err := c.destSystem.WriteFile(targetAbsPath, contents, actualEntryState.Mode.Perm()); err != nil {
+		return true, err
+	}
+	return true, fs.SkipDir
+}
+
+// newCheckpointPreApplyFunc returns a chezmoi.PreApplyFunc that calls
+// preApplyFunc and then sets *pending if the entry will be changed, so that it
+// is recorded in the checkpoint once it has been applied.
+func newCheckpointPreApplyFunc(pending *bool, preApplyFunc chezmoi.PreApplyFunc) chezmoi.PreApplyFunc {
+	return func(
+		targetRelPath chezmoi.RelPath,
+		targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+	) error {
+		if preApplyFunc != nil {
+			if err := preApplyFunc(targetRelPath, targetEntryState, lastWrittenEntryState, actualEntryState); err != nil {
+				return err
+			}
+		}
+		*pending = targetEntryState.Type == chezmoi.EntryStateTypeScript || !targetEntryState.Equivalent(actualEntryState)
+		return nil
+	}
+}
+
+// appliedCheckpointRelPaths returns the target entries that were applied by an
+// interrupted apply.
+func (c *Config) appliedCheckpointRelPaths() (map[chezmoi.RelPath]struct{}, error) {
+	appliedRelPaths := make(map[chezmoi.RelPath]struct{})
+	if err := c.persistentState.ForEach(applyCheckpointStateBucket, func(k, v []byte) error {
+		appliedRelPaths[chezmoi.NewRelPath(string(k))] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return appliedRelPaths, nil
+}
+
+// hasAnyTag returns true if targetTags contains any of tags.
+func hasAnyTag(targetTags, tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(targetTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTargetRelPathsByTags returns the elements of targetRelPaths that have
+// at least one of tags, if tags is not empty, and none of skipTags. The parent
+// directories of the returned targets are also returned so that the targets
+// can be created.
+func filterTargetRelPathsByTags(
+	sourceState *chezmoi.SourceState,
+	targetRelPaths chezmoi.RelPaths,
+	tags, skipTags []string,
+) chezmoi.RelPaths {
+	selectedRelPaths := make(map[chezmoi.RelPath]struct{})
+	for _, targetRelPath := range targetRelPaths {
+		targetTags := sourceState.Tags(targetRelPath)
+		if len(tags) != 0 && !hasAnyTag(targetTags, tags) || hasAnyTag(targetTags, skipTags) {
+			continue
+		}
+		for relPath := targetRelPath; relPath.String() != "."; relPath = relPath.Dir() {
+			selectedRelPaths[relPath] = struct{}{}
+		}
+	}
+
+	filteredTargetRelPaths := make(chezmoi.RelPaths, 0, len(selectedRelPaths))
+	for _, targetRelPath := range targetRelPaths {
+		if _, ok := selectedRelPaths[targetRelPath]; ok {
+			filteredTargetRelPaths = append(filteredTargetRelPaths, targetRelPath)
+		}
+	}
+	return filteredTargetRelPaths
+}
@@ -2,23 +2,48 @@ package cmd
 
 import (
 	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
 	"os/user"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
 type archiveCmdConfig struct {
-	filter    *chezmoi.EntryTypeFilter
-	format    chezmoi.ArchiveFormat
-	gzip      bool
-	init      bool
-	recursive bool
+	excludeGlobs []string
+	filter       *chezmoi.EntryTypeFilter
+	format       chezmoi.ArchiveFormat
+	gzip         bool
+	includeGlobs []string
+	init         bool
+	recursive    bool
+	reproducible bool
+	scriptsDir   string
+}
+
+// An archiveSystem is a System that writes an archive.
+type archiveSystem interface {
+	chezmoi.System
+	Close() error
+}
+
+// An archiveScriptsDirSystem is an archiveSystem that writes scripts as
+// executable files in a directory.
+type archiveScriptsDirSystem struct {
+	archiveSystem
+	dirAbsPath chezmoi.AbsPath
+	dirWritten bool
 }
 
 func (c *Config) newArchiveCmd() *cobra.Command {
@@ -37,11 +62,15 @@ func (c *Config) newArchiveCmd() *cobra.Command {
 
 	flags := archiveCmd.Flags()
 	flags.VarP(c.archive.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.StringArrayVar(&c.archive.excludeGlobs, "exclude-glob", c.archive.excludeGlobs, "Exclude paths matching pattern")
 	flags.VarP(&c.archive.format, "format", "f", "Set archive format")
 	flags.BoolVarP(&c.archive.gzip, "gzip", "z", c.archive.gzip, "Compress output with gzip")
 	flags.VarP(c.archive.filter.Exclude, "include", "i", "Include entry types")
+	flags.StringArrayVar(&c.archive.includeGlobs, "include-glob", c.archive.includeGlobs, "Include only paths matching pattern")
 	flags.BoolVar(&c.archive.init, "init", c.archive.init, "Recreate config file from template")
 	flags.BoolVarP(&c.archive.recursive, "recursive", "r", c.archive.recursive, "Recurse into subdirectories")
+	flags.BoolVar(&c.archive.reproducible, "reproducible", c.archive.reproducible, "Generate reproducible output")
+	flags.StringVar(&c.archive.scriptsDir, "scripts-dir", c.archive.scriptsDir, "Write scripts to directory")
 
 	registerExcludeIncludeFlagCompletionFuncs(archiveCmd)
 
@@ -49,6 +78,12 @@ func (c *Config) newArchiveCmd() *cobra.Command {
 }
 
 func (c *Config) runArchiveCmd(cmd *cobra.Command, args []string) error {
+	for _, pattern := range append(append([]string(nil), c.archive.includeGlobs...), c.archive.excludeGlobs...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("%s: %w", pattern, doublestar.ErrBadPattern)
+		}
+	}
+
 	format := c.archive.format
 	if format == chezmoi.ArchiveFormatUnknown {
 		format = chezmoi.GuessArchiveFormat(c.outputAbsPath.String(), nil)
@@ -62,49 +97,153 @@ func (c *Config) runArchiveCmd(cmd *cobra.Command, args []string) error {
 		gzipOutput = true
 	}
 
+	modified := c.now().UTC()
+	headerTemplate := tarHeaderTemplate(modified)
+	if c.archive.reproducible {
+		var err error
+		if modified, err = sourceDateEpoch(); err != nil {
+			return err
+		}
+		headerTemplate = tar.Header{
+			ModTime: modified,
+		}
+	}
+
 	output := strings.Builder{}
-	var archiveSystem interface {
-		chezmoi.System
-		Close() error
+	system, err := newArchiveSystem(format, &output, headerTemplate, modified)
+	if err != nil {
+		return err
 	}
-	switch format {
-	case chezmoi.ArchiveFormatTar, chezmoi.ArchiveFormatTarGz, chezmoi.ArchiveFormatTgz:
-		archiveSystem = chezmoi.NewTarWriterSystem(&output, tarHeaderTemplate())
-	case chezmoi.ArchiveFormatZip:
-		archiveSystem = chezmoi.NewZIPWriterSystem(&output, time.Now().UTC())
-	default:
-		return chezmoi.UnknownArchiveFormatError(format)
+	if c.archive.scriptsDir != "" {
+		system = &archiveScriptsDirSystem{
+			archiveSystem: system,
+			dirAbsPath:    chezmoi.NewAbsPath(path.Clean(c.archive.scriptsDir)),
+		}
 	}
-	if err := c.applyArgs(cmd.Context(), archiveSystem, chezmoi.EmptyAbsPath, args, applyArgsOptions{
-		cmd:       cmd,
-		filter:    c.archive.filter,
-		init:      c.archive.init,
-		recursive: c.archive.recursive,
+	var preApplyFunc chezmoi.PreApplyFunc
+	if len(c.archive.includeGlobs) > 0 || len(c.archive.excludeGlobs) > 0 {
+		preApplyFunc = c.archiveGlobPreApplyFunc
+	}
+	if err := c.applyArgs(cmd.Context(), system, chezmoi.EmptyAbsPath, args, applyArgsOptions{
+		cmd:          cmd,
+		filter:       c.archive.filter,
+		init:         c.archive.init,
+		recursive:    c.archive.recursive,
+		preApplyFunc: preApplyFunc,
 	}); err != nil {
 		return err
 	}
-	if err := archiveSystem.Close(); err != nil {
+	if err := system.Close(); err != nil {
 		return err
 	}
 
-	if format == chezmoi.ArchiveFormatZip || !gzipOutput {
-		return c.writeOutputString(output.String())
-	}
+	return c.writeArchiveOutput(format, gzipOutput, output.String())
+}
 
-	gzippedArchive := strings.Builder{}
-	gzipWriter := gzip.NewWriter(&gzippedArchive)
-	if _, err := gzipWriter.Write([]byte(output.String())); err != nil {
+// writeArchiveOutput writes output, compressing it if required by format or
+// gzipOutput.
+func (c *Config) writeArchiveOutput(format chezmoi.ArchiveFormat, gzipOutput bool, output string) error {
+	var compressedOutput strings.Builder
+	var compressor io.WriteCloser
+	switch {
+	case format == chezmoi.ArchiveFormatTarZst:
+		zstdWriter, err := zstd.NewWriter(&compressedOutput, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		compressor = zstdWriter
+	case format != chezmoi.ArchiveFormatZip && gzipOutput:
+		compressor = gzip.NewWriter(&compressedOutput)
+	default:
+		return c.writeOutputString(output)
+	}
+	if _, err := compressor.Write([]byte(output)); err != nil {
 		return err
 	}
-	if err := gzipWriter.Close(); err != nil {
+	if err := compressor.Close(); err != nil {
 		return err
 	}
-	return c.writeOutputString(gzippedArchive.String())
+	return c.writeOutputString(compressedOutput.String())
+}
+
+// newArchiveSystem returns a new archiveSystem that writes an archive in format
+// to w.
+func newArchiveSystem(
+	format chezmoi.ArchiveFormat, w io.Writer, headerTemplate tar.Header, modified time.Time,
+) (archiveSystem, error) {
+	switch format {
+	case chezmoi.ArchiveFormatTar, chezmoi.ArchiveFormatTarGz, chezmoi.ArchiveFormatTarZst, chezmoi.ArchiveFormatTgz:
+		return chezmoi.NewTarWriterSystem(w, headerTemplate), nil
+	case chezmoi.ArchiveFormatZip:
+		return chezmoi.NewZIPWriterSystem(w, modified), nil
+	default:
+		return nil, chezmoi.UnknownArchiveFormatError(format)
+	}
+}
+
+// archiveGlobPreApplyFunc skips target entries according to the include and
+// exclude glob patterns. An entry matches a pattern if its path relative to the
+// destination directory, or the path of any of its parents, matches the
+// pattern. Patterns that do not contain a slash match against names instead.
+func (c *Config) archiveGlobPreApplyFunc(
+	targetRelPath chezmoi.RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+) error {
+	matchAny := func(patterns []string) bool {
+		for relPath := targetRelPath.String(); relPath != "."; relPath = path.Dir(relPath) {
+			for _, pattern := range patterns {
+				name := relPath
+				if !strings.Contains(pattern, "/") {
+					name = path.Base(name)
+				}
+				if match, _ := doublestar.Match(pattern, name); match {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if matchAny(c.archive.excludeGlobs) {
+		return fs.SkipDir
+	}
+	if len(c.archive.includeGlobs) > 0 && !matchAny(c.archive.includeGlobs) {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// RunScript implements System.RunScript.
+func (s *archiveScriptsDirSystem) RunScript(
+	scriptname chezmoi.RelPath,
+	dir chezmoi.AbsPath,
+	data []byte,
+	options chezmoi.RunScriptOptions,
+) error {
+	if !s.dirWritten {
+		if err := s.Mkdir(s.dirAbsPath, fs.ModePerm); err != nil {
+			return err
+		}
+		s.dirWritten = true
+	}
+	return s.WriteFile(s.dirAbsPath.Join(scriptname), data, 0o755)
+}
+
+// sourceDateEpoch returns the time in $SOURCE_DATE_EPOCH, or the Unix epoch if
+// $SOURCE_DATE_EPOCH is not set.
+func sourceDateEpoch() (time.Time, error) {
+	value, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH: %w", err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
 }
 
 // tarHeaderTemplate returns a tar.Header template populated with the current
-// user and time.
-func tarHeaderTemplate() tar.Header {
+// user and now.
+func tarHeaderTemplate(now time.Time) tar.Header {
 	// Attempt to lookup the current user. Ignore errors because the default
 	// zero values are reasonable.
 	var (
@@ -122,7 +261,6 @@ func tarHeaderTemplate() tar.Header {
 		}
 	}
 
-	now := time.Now().UTC()
 	return tar.Header{
 		Uid:        uid,
 		Gid:        gid,
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+type auditCmdConfig struct {
+	File chezmoi.AbsPath `json:"file" mapstructure:"file" yaml:"file"`
+}
+
+func (c *Config) newAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:     "audit",
+		Args:    cobra.NoArgs,
+		Short:   "Inspect the audit log",
+		Long:    mustLongHelp("audit"),
+		Example: example("audit"),
+	}
+
+	auditVerifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the hash chain of the audit log",
+		Args:  cobra.NoArgs,
+		RunE:  c.runAuditVerifyCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	auditCmd.AddCommand(auditVerifyCmd)
+
+	return auditCmd
+}
+
+func (c *Config) runAuditVerifyCmd(cmd *cobra.Command, args []string) error {
+	if c.Audit.File.Empty() {
+		return errors.New("audit.file not set")
+	}
+	data, err := c.baseSystem.ReadFile(c.Audit.File)
+	if err != nil {
+		return err
+	}
+	count, lastHash, err := chezmoi.VerifyAuditLog(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Audit.File, err)
+	}
+	return c.writeOutputString(fmt.Sprintf("%d entries, last hash %x\n", count, lastHash))
+}
+
+// newAuditLog returns a new audit log for cmd, or nil if the audit log is
+// disabled.
+func (c *Config) newAuditLog(cmd *cobra.Command) *chezmoi.AuditLog {
+	if c.Audit.File.Empty() {
+		return nil
+	}
+	return chezmoi.NewAuditLog(c.fileSystem, c.Audit.File, cmd.CommandPath())
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/assets/templates"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+type bundleCmdConfig struct {
+	binary      chezmoi.AbsPath
+	filter      *chezmoi.EntryTypeFilter
+	init        bool
+	recursive   bool
+	sourceState bool
+}
+
+func (c *Config) newBundleCmd() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:               "bundle [target]...",
+		Short:             "Generate a self-extracting shell script that applies the target state",
+		Long:              mustLongHelp("bundle"),
+		Example:           example("bundle"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runBundleCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+
+	flags := bundleCmd.Flags()
+	flags.Var(&c.bundle.binary, "binary", "Include the chezmoi binary at path")
+	flags.VarP(c.bundle.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.VarP(c.bundle.filter.Include, "include", "i", "Include entry types")
+	flags.BoolVar(&c.bundle.init, "init", c.bundle.init, "Recreate config file from template")
+	flags.BoolVarP(&c.bundle.recursive, "recursive", "r", c.bundle.recursive, "Recurse into subdirectories")
+	flags.BoolVar(&c.bundle.sourceState, "source-state", c.bundle.sourceState, "Bundle the source state")
+
+	registerExcludeIncludeFlagCompletionFuncs(bundleCmd)
+
+	return bundleCmd
+}
+
+func (c *Config) runBundleCmd(cmd *cobra.Command, args []string) error {
+	archive := strings.Builder{}
+	tarWriterSystem := chezmoi.NewTarWriterSystem(&archive, tarHeaderTemplate(c.now().UTC()))
+	if c.bundle.sourceState {
+		if len(args) != 0 {
+			return errors.New("--source-state does not accept targets")
+		}
+		if err := c.writeBundleSourceState(tarWriterSystem); err != nil {
+			return err
+		}
+	} else {
+		if err := c.applyArgs(cmd.Context(), tarWriterSystem, chezmoi.EmptyAbsPath, args, applyArgsOptions{
+			cmd:       cmd,
+			filter:    c.bundle.filter,
+			init:      c.bundle.init,
+			recursive: c.bundle.recursive,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := tarWriterSystem.Close(); err != nil {
+		return err
+	}
+
+	name := "bundle.sh"
+	if !c.outputAbsPath.Empty() && c.outputAbsPath != chezmoi.NewAbsPath("-") {
+		name = c.outputAbsPath.Base()
+	}
+	header, err := bundleHeader(name, c.bundle.sourceState)
+	if err != nil {
+		return err
+	}
+
+	bundle := strings.Builder{}
+	bundle.WriteString(header)
+	gzipWriter := gzip.NewWriter(&bundle)
+	if _, err := gzipWriter.Write([]byte(archive.String())); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+
+	if c.outputAbsPath.Empty() || c.outputAbsPath == chezmoi.NewAbsPath("-") {
+		return c.writeOutputString(bundle.String())
+	}
+	return os.WriteFile(c.outputAbsPath.String(), []byte(bundle.String()), 0o777) //nolint:gosec
+}
+
+// writeBundleSourceState writes the source directory, without its version
+// control system directory, and the chezmoi binary to tarWriterSystem.
+func (c *Config) writeBundleSourceState(tarWriterSystem *chezmoi.TarWriterSystem) error {
+	vcs, err := c.vcs()
+	if err != nil {
+		return err
+	}
+
+	sourceAbsPath := chezmoi.NewAbsPath("source")
+	if err := tarWriterSystem.Mkdir(sourceAbsPath, fs.ModePerm); err != nil {
+		return err
+	}
+	if err := chezmoi.Walk(c.sourceSystem, c.SourceDirAbsPath, func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case absPath == c.SourceDirAbsPath:
+			return nil
+		case fileInfo.IsDir() && fileInfo.Name() == vcs.dirName():
+			return fs.SkipDir
+		}
+		relPath, err := absPath.TrimDirPrefix(c.SourceDirAbsPath)
+		if err != nil {
+			return err
+		}
+		targetAbsPath := sourceAbsPath.Join(relPath)
+		switch fileInfo.Mode().Type() {
+		case fs.ModeDir:
+			return tarWriterSystem.Mkdir(targetAbsPath, fileInfo.Mode().Perm())
+		case 0:
+			data, err := c.sourceSystem.ReadFile(absPath)
+			if err != nil {
+				return err
+			}
+			return tarWriterSystem.WriteFile(targetAbsPath, data, fileInfo.Mode().Perm())
+		case fs.ModeSymlink:
+			linkname, err := c.sourceSystem.Readlink(absPath)
+			if err != nil {
+				return err
+			}
+			return tarWriterSystem.WriteSymlink(linkname, targetAbsPath)
+		default:
+			return fmt.Errorf("%s: unsupported file type", absPath)
+		}
+	}); err != nil {
+		return err
+	}
+
+	binaryAbsPath := c.bundle.binary
+	if binaryAbsPath.Empty() {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		binaryAbsPath = chezmoi.NewAbsPath(executable)
+	}
+	binary, err := os.ReadFile(binaryAbsPath.String())
+	if err != nil {
+		return err
+	}
+	binAbsPath := chezmoi.NewAbsPath("bin")
+	if err := tarWriterSystem.Mkdir(binAbsPath, fs.ModePerm); err != nil {
+		return err
+	}
+	return tarWriterSystem.WriteFile(binAbsPath.JoinString("chezmoi"), binary, 0o755)
+}
+
+// bundleHeader returns the shell script that precedes the archive in a bundle
+// called name.
+func bundleHeader(name string, source bool) (string, error) {
+	tmpl, err := template.New("bundle").Parse(templates.BundleSHTmpl)
+	if err != nil {
+		return "", err
+	}
+	execute := func(offset int) (string, error) {
+		sb := strings.Builder{}
+		if err := tmpl.Execute(&sb, map[string]any{
+			"Name":   name,
+			"Offset": offset,
+			"Source": source,
+		}); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	}
+	// The archive starts on the line after the header. The number of lines in
+	// the header does not depend on the offset, so execute the template once
+	// to count them.
+	header, err := execute(0)
+	if err != nil {
+		return "", err
+	}
+	return execute(strings.Count(header, "\n") + 1)
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -9,10 +11,15 @@ import (
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+type catCmdConfig struct {
+	diffAgainstDest bool
+	format          chezmoi.ArchiveFormat
+}
+
 func (c *Config) newCatCmd() *cobra.Command {
 	catCmd := &cobra.Command{
 		Use:               "cat target...",
-		Short:             "Print the target contents of a file, script, or symlink",
+		Short:             "Print the target contents of a file, script, symlink, or directory",
 		Long:              mustLongHelp("cat"),
 		Example:           example("cat"),
 		ValidArgsFunction: c.targetValidArgs,
@@ -23,6 +30,10 @@ func (c *Config) newCatCmd() *cobra.Command {
 		),
 	}
 
+	flags := catCmd.Flags()
+	flags.BoolVar(&c.cat.diffAgainstDest, "diff-against-dest", c.cat.diffAgainstDest, "Annotate differences with the destination")
+	flags.VarP(&c.cat.format, "format", "f", "Set archive format for directories")
+
 	return catCmd
 }
 
@@ -34,6 +45,19 @@ func (c *Config) runCatCmd(cmd *cobra.Command, args []string, sourceState *chezm
 		return err
 	}
 
+	renderDirs := c.cat.format != chezmoi.ArchiveFormatUnknown
+	for _, targetRelPath := range targetRelPaths {
+		if _, ok := sourceState.MustEntry(targetRelPath).(*chezmoi.SourceStateDir); ok {
+			renderDirs = true
+		}
+	}
+	if renderDirs {
+		if c.cat.diffAgainstDest {
+			return errors.New("--diff-against-dest: cannot be used with directories")
+		}
+		return c.catDirs(sourceState, args)
+	}
+
 	builder := strings.Builder{}
 	for _, targetRelPath := range targetRelPaths {
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
@@ -41,29 +65,148 @@ func (c *Config) runCatCmd(cmd *cobra.Command, args []string, sourceState *chezm
 		if err != nil {
 			return fmt.Errorf("%s: %w", targetRelPath, err)
 		}
-		switch targetStateEntry := targetStateEntry.(type) {
-		case *chezmoi.TargetStateFile:
-			contents, err := targetStateEntry.Contents()
-			if err != nil {
-				return fmt.Errorf("%s: %w", targetRelPath, err)
-			}
-			builder.Write(contents)
-		case *chezmoi.TargetStateScript:
-			contents, err := targetStateEntry.Contents()
+		contents, err := targetStateEntryContents(targetStateEntry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		if c.cat.diffAgainstDest {
+			annotatedContents, err := c.diffAgainstDest(targetRelPath, contents)
 			if err != nil {
 				return fmt.Errorf("%s: %w", targetRelPath, err)
 			}
+			builder.WriteString(annotatedContents)
+		} else {
 			builder.Write(contents)
-		case *chezmoi.TargetStateSymlink:
-			linkname, err := targetStateEntry.Linkname()
-			if err != nil {
-				return fmt.Errorf("%s: %w", targetRelPath, err)
-			}
-			builder.WriteString(linkname)
-			builder.WriteByte('\n')
-		default:
-			return fmt.Errorf("%s: not a file, script, or symlink", targetRelPath)
 		}
 	}
 	return c.writeOutputString(builder.String())
 }
+
+// catDirs renders all targets in args, including the contents of directories,
+// into an archive or, if the output is not an archive, into the output
+// directory. Scripts are not rendered into the output directory.
+func (c *Config) catDirs(sourceState *chezmoi.SourceState, args []string) error {
+	targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+		mustBeManaged: true,
+		recursive:     true,
+	})
+	if err != nil {
+		return err
+	}
+
+	format := c.cat.format
+	if format == chezmoi.ArchiveFormatUnknown {
+		format = chezmoi.GuessArchiveFormat(c.outputAbsPath.String(), nil)
+	}
+
+	var system chezmoi.System
+	var archive archiveSystem
+	var targetDirAbsPath chezmoi.AbsPath
+	filter := chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone)
+	output := strings.Builder{}
+	switch {
+	case format == chezmoi.ArchiveFormatUnknown && !c.outputAbsPath.Empty():
+		if err := chezmoi.MkdirAll(c.baseSystem, c.outputAbsPath, fs.ModePerm); err != nil {
+			return err
+		}
+		system = c.baseSystem
+		targetDirAbsPath = c.outputAbsPath
+		filter = chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypeScripts)
+	default:
+		if format == chezmoi.ArchiveFormatUnknown {
+			format = chezmoi.ArchiveFormatTar
+		}
+		modified := c.now().UTC()
+		archive, err = newArchiveSystem(format, &output, tarHeaderTemplate(modified), modified)
+		if err != nil {
+			return err
+		}
+		system = archive
+	}
+
+	// Render into an empty persistent state so that every target is rendered
+	// and the real persistent state is not modified.
+	persistentState := chezmoi.NewMockPersistentState()
+	for _, targetRelPath := range targetRelPaths {
+		if !targetDirAbsPath.Empty() {
+			parentAbsPath := targetDirAbsPath.Join(targetRelPath).Dir()
+			if err := chezmoi.MkdirAll(system, parentAbsPath, fs.ModePerm); err != nil {
+				return err
+			}
+		}
+		if err := sourceState.Apply(
+			system, c.destSystem, persistentState, targetDirAbsPath, targetRelPath,
+			chezmoi.ApplyOptions{
+				Filter: filter,
+				Umask:  c.Umask,
+			},
+		); err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+	}
+
+	if archive == nil {
+		return nil
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	gzipOutput := format == chezmoi.ArchiveFormatTarGz || format == chezmoi.ArchiveFormatTgz
+	return c.writeArchiveOutput(format, gzipOutput, output.String())
+}
+
+// diffAgainstDest returns contents with each line annotated with the
+// differences from the actual contents of the target at targetRelPath.
+func (c *Config) diffAgainstDest(targetRelPath chezmoi.RelPath, contents []byte) (string, error) {
+	actualStateEntry, err := chezmoi.NewActualStateEntry(
+		c.destSystem, c.DestDirAbsPath.Join(targetRelPath), nil, nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	var actualContents []byte
+	switch actualStateEntry := actualStateEntry.(type) {
+	case *chezmoi.ActualStateFile:
+		if actualContents, err = actualStateEntry.Contents(); err != nil {
+			return "", err
+		}
+	case *chezmoi.ActualStateSymlink:
+		linkname, err := actualStateEntry.Linkname()
+		if err != nil {
+			return "", err
+		}
+		actualContents = []byte(linkname + "\n")
+	}
+	partialDiff := chezmoi.NewPartialDiff(actualContents, contents)
+	if partialDiff == nil {
+		return "", errors.New("cannot annotate binary contents")
+	}
+	options, err := c.diffEncoderOptions()
+	if err != nil {
+		return "", err
+	}
+	var theme *chezmoi.DiffTheme
+	if options.Color {
+		theme = options.Theme
+	}
+	return partialDiff.Format(theme), nil
+}
+
+// targetStateEntryContents returns the contents of targetStateEntry. The
+// contents of a symlink are its linkname followed by a newline.
+func targetStateEntryContents(targetStateEntry chezmoi.TargetStateEntry) ([]byte, error) {
+	switch targetStateEntry := targetStateEntry.(type) {
+	case *chezmoi.TargetStateFile:
+		return targetStateEntry.Contents()
+	case *chezmoi.TargetStateScript:
+		return targetStateEntry.Contents()
+	case *chezmoi.TargetStateSymlink:
+		linkname, err := targetStateEntry.Linkname()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(linkname + "\n"), nil
+	default:
+		return nil, errors.New("not a file, script, or symlink")
+	}
+}
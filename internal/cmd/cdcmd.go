@@ -11,18 +11,40 @@ import (
 )
 
 type cdCmdConfig struct {
-	Command string   `json:"command" mapstructure:"command" yaml:"command"`
-	Args    []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	Command       string   `json:"command" mapstructure:"command" yaml:"command"`
+	Args          []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	print         bool
+	shellFunction string
+	source        bool
+	target        bool
 }
 
+// cdShellFunctions are shell functions that change the current directory of
+// the calling shell with chezmoi cd --print, without launching a subshell.
+var cdShellFunctions = map[string]string{
+	"bash": cdPOSIXShellFunction,
+	"fish": "" +
+		"function chezmoi-cd\n" +
+		"    set -l dir (command chezmoi cd --print $argv); and cd $dir\n" +
+		"end\n",
+	"zsh": cdPOSIXShellFunction,
+}
+
+const cdPOSIXShellFunction = "" +
+	"chezmoi-cd() {\n" +
+	"    local dir\n" +
+	"    dir=\"$(command chezmoi cd --print \"$@\")\" && cd \"${dir}\"\n" +
+	"}\n"
+
 func (c *Config) newCDCmd() *cobra.Command {
 	cdCmd := &cobra.Command{
-		Use:     "cd [path]",
-		Short:   "Launch a shell in the source directory",
-		Long:    mustLongHelp("cd"),
-		Example: example("cd"),
-		RunE:    c.runCDCmd,
-		Args:    cobra.MaximumNArgs(1),
+		Use:               "cd [path]",
+		Short:             "Launch a shell in the source directory",
+		Long:              mustLongHelp("cd"),
+		Example:           example("cd"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runCDCmd,
+		Args:              cobra.MaximumNArgs(1),
 		Annotations: newAnnotations(
 			createSourceDirectoryIfNeeded,
 			doesNotRequireValidConfig,
@@ -31,39 +53,37 @@ func (c *Config) newCDCmd() *cobra.Command {
 		),
 	}
 
+	flags := cdCmd.Flags()
+	flags.BoolVarP(&c.CD.print, "print", "p", c.CD.print, "Print the directory instead of launching a shell")
+	flags.StringVar(&c.CD.shellFunction, "shell-function", c.CD.shellFunction, "Print a shell function for the given shell")
+	flags.BoolVar(&c.CD.source, "source", c.CD.source, "Change to the source directory")
+	flags.BoolVar(&c.CD.target, "target", c.CD.target, "Change to the target directory")
+	cdCmd.MarkFlagsMutuallyExclusive("source", "target")
+	if err := cdCmd.RegisterFlagCompletionFunc("shell-function", cdShellFunctionFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+
 	return cdCmd
 }
 
 func (c *Config) runCDCmd(cmd *cobra.Command, args []string) error {
-	os.Setenv("CHEZMOI_SUBSHELL", "1")
-
-	cdCommand, cdArgs, err := c.cdCommand()
-	if err != nil {
-		return err
+	if c.CD.shellFunction != "" {
+		shellFunction, ok := cdShellFunctions[c.CD.shellFunction]
+		if !ok {
+			return fmt.Errorf("%s: unsupported shell", c.CD.shellFunction)
+		}
+		return c.writeOutputString(shellFunction)
 	}
+
 	var dir chezmoi.AbsPath
-	if len(args) == 0 {
-		dir = c.WorkingTreeAbsPath
+	var err error
+	if c.CD.target {
+		dir, err = c.cdTargetDir(cmd, args)
 	} else {
-		switch argAbsPath, err := chezmoi.NewAbsPathFromExtPath(args[0], c.homeDirAbsPath); {
-		case err != nil:
-			return err
-		case argAbsPath == c.DestDirAbsPath:
-			dir, err = c.getSourceDirAbsPath(nil)
-			if err != nil {
-				return err
-			}
-		default:
-			sourceState, err := c.getSourceState(cmd.Context(), cmd)
-			if err != nil {
-				return err
-			}
-			sourceAbsPaths, err := c.sourceAbsPaths(sourceState, args)
-			if err != nil {
-				return err
-			}
-			dir = sourceAbsPaths[0]
-		}
+		dir, err = c.cdSourceDir(cmd, args)
+	}
+	if err != nil {
+		return err
 	}
 
 	switch fileInfo, err := c.baseSystem.Stat(dir); {
@@ -73,9 +93,71 @@ func (c *Config) runCDCmd(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("%s: not a directory", dir)
 	}
 
+	if c.CD.print {
+		return c.writeOutputString(dir.String() + "\n")
+	}
+
+	os.Setenv("CHEZMOI_SUBSHELL", "1")
+
+	cdCommand, cdArgs, err := c.cdCommand()
+	if err != nil {
+		return err
+	}
+
 	return c.run(dir, cdCommand, cdArgs)
 }
 
+// cdSourceDir returns the source directory corresponding to the optional
+// target path in args.
+func (c *Config) cdSourceDir(cmd *cobra.Command, args []string) (chezmoi.AbsPath, error) {
+	if len(args) == 0 {
+		return c.WorkingTreeAbsPath, nil
+	}
+	switch argAbsPath, err := chezmoi.NewAbsPathFromExtPath(args[0], c.homeDirAbsPath); {
+	case err != nil:
+		return chezmoi.EmptyAbsPath, err
+	case argAbsPath == c.DestDirAbsPath:
+		return c.getSourceDirAbsPath(nil)
+	default:
+		sourceState, err := c.getSourceState(cmd.Context(), cmd)
+		if err != nil {
+			return chezmoi.EmptyAbsPath, err
+		}
+		sourceAbsPaths, err := c.sourceAbsPaths(sourceState, args)
+		if err != nil {
+			return chezmoi.EmptyAbsPath, err
+		}
+		return sourceAbsPaths[0], nil
+	}
+}
+
+// cdTargetDir returns the target directory corresponding to the optional path
+// in args, which may be either a source path or a target path.
+func (c *Config) cdTargetDir(cmd *cobra.Command, args []string) (chezmoi.AbsPath, error) {
+	if len(args) == 0 {
+		return c.DestDirAbsPath, nil
+	}
+	argAbsPath, err := chezmoi.NewAbsPathFromExtPath(args[0], c.homeDirAbsPath)
+	if err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	switch _, err := argAbsPath.TrimDirPrefix(c.SourceDirAbsPath); {
+	case err != nil:
+		return argAbsPath, nil
+	case argAbsPath == c.SourceDirAbsPath:
+		return c.DestDirAbsPath, nil
+	}
+	targetRelPaths, err := c.targetRelPathsBySourcePath(sourceState, args)
+	if err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	return c.DestDirAbsPath.Join(targetRelPaths[0]), nil
+}
+
 func (c *Config) cdCommand() (string, []string, error) {
 	cdCommand := c.CD.Command
 	cdArgs := c.CD.Args
@@ -87,3 +169,9 @@ func (c *Config) cdCommand() (string, []string, error) {
 	cdCommand, _ = shell.CurrentUserShell()
 	return parseCommand(cdCommand, cdArgs)
 }
+
+func cdShellFunctionFlagCompletionFunc(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	return []string{"bash", "fish", "zsh"}, cobra.ShellCompDirectiveNoFileComp
+}
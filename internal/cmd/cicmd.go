@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoimaps"
+)
+
+// A ciConfig is the configuration read from the .chezmoici.yaml file in the
+// source directory.
+type ciConfig struct {
+	Profiles map[string]map[string]any `json:"profiles" yaml:"profiles"`
+}
+
+// A ciTargetError is an error rendering a target in a profile.
+type ciTargetError struct {
+	targetRelPath chezmoi.RelPath
+	err           error
+}
+
+func (c *Config) newCICmd() *cobra.Command {
+	ciCmd := &cobra.Command{
+		Use:     "ci [profile]...",
+		Short:   "Render all templates for each profile in .chezmoici.yaml",
+		Long:    mustLongHelp("ci"),
+		Example: example("ci"),
+		RunE:    c.runCICmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+
+	return ciCmd
+}
+
+func (c *Config) runCICmd(cmd *cobra.Command, args []string) error {
+	ciConfigAbsPath := c.SourceDirAbsPath.JoinString(chezmoi.CIName)
+	var ciConfig ciConfig
+	switch data, err := c.sourceSystem.ReadFile(ciConfigAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%s: no profiles defined", ciConfigAbsPath)
+	case err != nil:
+		return err
+	default:
+		if err := chezmoi.FormatYAML.Unmarshal(data, &ciConfig); err != nil {
+			return fmt.Errorf("%s: %w", ciConfigAbsPath, err)
+		}
+	}
+
+	profileNames := args
+	if len(profileNames) == 0 {
+		profileNames = chezmoimaps.SortedKeys(ciConfig.Profiles)
+	}
+	if len(profileNames) == 0 {
+		return fmt.Errorf("%s: no profiles defined", ciConfigAbsPath)
+	}
+	for _, profileName := range profileNames {
+		if _, ok := ciConfig.Profiles[profileName]; !ok {
+			return fmt.Errorf("%s: profile not defined in %s", profileName, ciConfigAbsPath)
+		}
+	}
+
+	// Render templates in an empty temporary destination directory and never
+	// prompt for values.
+	destDirAbsPath, err := c.tempDir("chezmoi-ci")
+	if err != nil {
+		return err
+	}
+	c.interactiveTemplateFuncs.promptDefaults = true
+
+	builder := strings.Builder{}
+	failed := false
+	for _, profileName := range profileNames {
+		targetErrs, err := c.ciProfile(cmd, destDirAbsPath, ciConfig.Profiles[profileName])
+		switch {
+		case err != nil:
+			failed = true
+			fmt.Fprintf(&builder, "%s: error\n  %v\n", profileName, err)
+		case len(targetErrs) != 0:
+			failed = true
+			fmt.Fprintf(&builder, "%s: %d error(s)\n", profileName, len(targetErrs))
+			for _, targetErr := range targetErrs {
+				fmt.Fprintf(&builder, "  %s: %v\n", targetErr.targetRelPath, targetErr.err)
+			}
+		default:
+			fmt.Fprintf(&builder, "%s: ok\n", profileName)
+		}
+	}
+	if err := c.writeOutputString(builder.String()); err != nil {
+		return err
+	}
+
+	if failed {
+		return chezmoi.ExitCodeError(1)
+	}
+	return nil
+}
+
+// ciProfile renders all targets with the template data overrides in data and
+// returns the errors for each target.
+func (c *Config) ciProfile(
+	cmd *cobra.Command, destDirAbsPath chezmoi.AbsPath, data map[string]any,
+) ([]ciTargetError, error) {
+	sourceState, err := c.newProfileSourceState(cmd, destDirAbsPath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	destSystem := chezmoi.NewReadOnlySystem(c.destSystem)
+	var targetErrs []ciTargetError
+	for _, targetRelPath := range sourceState.TargetRelPaths() {
+		sourceStateEntry := sourceState.Get(targetRelPath)
+		if err := sourceStateEntry.Evaluate(); err != nil {
+			targetErrs = append(targetErrs, ciTargetError{targetRelPath: targetRelPath, err: err})
+			continue
+		}
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(destSystem, destDirAbsPath.Join(targetRelPath))
+		if err == nil {
+			err = targetStateEntry.Evaluate()
+		}
+		if err != nil {
+			targetErrs = append(targetErrs, ciTargetError{targetRelPath: targetRelPath, err: err})
+		}
+	}
+	return targetErrs, nil
+}
+
+// newProfileSourceState returns a new source state with destination directory
+// destDirAbsPath where data overrides the default template data. The home
+// directory is destDirAbsPath unless data overrides it. Externals are not
+// read.
+func (c *Config) newProfileSourceState(
+	cmd *cobra.Command, destDirAbsPath chezmoi.AbsPath, data map[string]any, options ...chezmoi.SourceStateOption,
+) (*chezmoi.SourceState, error) {
+	priorityTemplateData := map[string]any{
+		"chezmoi": map[string]any{
+			"homeDir": destDirAbsPath.String(),
+		},
+	}
+	chezmoi.RecursiveMerge(priorityTemplateData, data)
+
+	return c.newSourceState(cmd.Context(), cmd, append([]chezmoi.SourceStateOption{
+		chezmoi.WithDestDir(destDirAbsPath),
+		chezmoi.WithPriorityTemplateData(priorityTemplateData),
+		chezmoi.WithReadExternals(false),
+	}, options...)...)
+}
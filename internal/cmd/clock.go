@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// A frozenTime is a time that, when set, is used instead of the current time.
+type frozenTime struct {
+	time.Time
+}
+
+// A localeData contains information about the user's locale.
+type localeData struct {
+	name           string
+	language       string
+	territory      string
+	codeset        string
+	firstDayOfWeek string
+}
+
+// A timezoneData contains information about the local timezone.
+type timezoneData struct {
+	name         string
+	abbreviation string
+	offset       int
+}
+
+// firstDayOfWeekByTerritory maps territories to the first day of the week,
+// following the Unicode CLDR. Territories not listed start the week on Monday.
+var firstDayOfWeekByTerritory = map[string]string{
+	"AE": "saturday", "AF": "saturday", "BH": "saturday", "DJ": "saturday",
+	"DZ": "saturday", "EG": "saturday", "IQ": "saturday", "IR": "saturday",
+	"JO": "saturday", "KW": "saturday", "LY": "saturday", "OM": "saturday",
+	"QA": "saturday", "SD": "saturday", "SY": "saturday",
+	"MV": "friday",
+	"AG": "sunday", "AS": "sunday", "BD": "sunday", "BR": "sunday",
+	"BS": "sunday", "BT": "sunday", "BW": "sunday", "BZ": "sunday",
+	"CA": "sunday", "CN": "sunday", "CO": "sunday", "DM": "sunday",
+	"DO": "sunday", "ET": "sunday", "GT": "sunday", "GU": "sunday",
+	"HK": "sunday", "HN": "sunday", "ID": "sunday", "IL": "sunday",
+	"IN": "sunday", "JM": "sunday", "JP": "sunday", "KE": "sunday",
+	"KH": "sunday", "KR": "sunday", "LA": "sunday", "MH": "sunday",
+	"MM": "sunday", "MO": "sunday", "MT": "sunday", "MX": "sunday",
+	"MZ": "sunday", "NI": "sunday", "NP": "sunday", "PA": "sunday",
+	"PE": "sunday", "PH": "sunday", "PK": "sunday", "PR": "sunday",
+	"PT": "sunday", "PY": "sunday", "SA": "sunday", "SG": "sunday",
+	"SV": "sunday", "TH": "sunday", "TT": "sunday", "TW": "sunday",
+	"UM": "sunday", "US": "sunday", "VE": "sunday", "VI": "sunday",
+	"WS": "sunday", "YE": "sunday", "ZA": "sunday", "ZW": "sunday",
+}
+
+// Set implements github.com/spf13/pflag.Value.Set.
+func (t *frozenTime) Set(s string) error {
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	value, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("%s: invalid time, expected RFC3339 format", s)
+	}
+	t.Time = value
+	return nil
+}
+
+// String implements github.com/spf13/pflag.Value.String.
+func (t *frozenTime) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Type implements github.com/spf13/pflag.Value.Type.
+func (t *frozenTime) Type() string {
+	return "time"
+}
+
+// agoTemplateFunc is a replacement for sprig's ago template function that
+// respects --frozen-time.
+func (c *Config) agoTemplateFunc(date any) string {
+	var t time.Time
+	switch date := date.(type) {
+	case time.Time:
+		t = date
+	case int64:
+		t = time.Unix(date, 0)
+	case int:
+		t = time.Unix(int64(date), 0)
+	case int32:
+		t = time.Unix(int64(date), 0)
+	default:
+		t = c.now()
+	}
+	return c.now().Sub(t).Round(time.Second).String()
+}
+
+// now returns the current time, or the frozen time if --frozen-time is set.
+func (c *Config) now() time.Time {
+	if !c.frozenTime.IsZero() {
+		return c.frozenTime.Time
+	}
+	return time.Now()
+}
+
+// nowTemplateFunc is a replacement for sprig's now template function that
+// respects --frozen-time.
+func (c *Config) nowTemplateFunc() time.Time {
+	return c.now()
+}
+
+// getLocaleData returns the user's locale from the environment.
+func getLocaleData() localeData {
+	name := firstNonEmptyString(os.Getenv("LC_ALL"), os.Getenv("LC_TIME"), os.Getenv("LANG"))
+	locale := localeData{
+		name:           name,
+		firstDayOfWeek: "monday",
+	}
+	// Locale names have the form language[_territory][.codeset][@modifier].
+	value, _, _ := strings.Cut(name, "@")
+	value, locale.codeset, _ = strings.Cut(value, ".")
+	locale.language, locale.territory, _ = strings.Cut(value, "_")
+	if locale.language == "C" || locale.language == "POSIX" {
+		locale.language = ""
+	}
+	if firstDayOfWeek, ok := firstDayOfWeekByTerritory[strings.ToUpper(locale.territory)]; ok {
+		locale.firstDayOfWeek = firstDayOfWeek
+	}
+	return locale
+}
+
+// getTimezoneData returns the local timezone at the current time.
+func (c *Config) getTimezoneData() timezoneData {
+	abbreviation, offset := c.now().In(time.Local).Zone()
+	return timezoneData{
+		name:         c.timezoneName(),
+		abbreviation: abbreviation,
+		offset:       offset,
+	}
+}
+
+// timezoneName returns the IANA name of the local timezone, if it can be
+// determined, or the name of Go's local location otherwise.
+func (c *Config) timezoneName() string {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		switch tz = strings.TrimPrefix(tz, ":"); tz {
+		case "":
+			return "UTC"
+		default:
+			return tz
+		}
+	}
+	if target, err := c.fileSystem.Readlink("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	return time.Local.String()
+}
+
+func (l localeData) toMap() map[string]any {
+	return map[string]any{
+		"codeset":        l.codeset,
+		"firstDayOfWeek": l.firstDayOfWeek,
+		"language":       l.language,
+		"name":           l.name,
+		"territory":      l.territory,
+	}
+}
+
+func (t timezoneData) toMap() map[string]any {
+	return map[string]any{
+		"abbreviation": t.abbreviation,
+		"name":         t.name,
+		"offset":       t.offset,
+	}
+}
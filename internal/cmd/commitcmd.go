@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoimaps"
+	"github.com/twpayne/chezmoi/v2/internal/git"
+)
+
+type commitCmdConfig struct {
+	message string
+}
+
+func (c *Config) newCommitCmd() *cobra.Command {
+	commitCmd := &cobra.Command{
+		Use:     "commit",
+		Short:   "Commit changes in the source directory",
+		Long:    mustLongHelp("commit"),
+		Example: example("commit"),
+		Args:    cobra.NoArgs,
+		RunE:    c.runCommitCmd,
+		Annotations: newAnnotations(
+			requiresWorkingTree,
+			runsCommands,
+		),
+	}
+
+	flags := commitCmd.Flags()
+	flags.BoolVarP(&c.interactive, "interactive", "i", c.interactive, "Select changes to commit")
+	flags.StringVarP(&c.commit.message, "message", "m", c.commit.message, "Commit message")
+
+	return commitCmd
+}
+
+func (c *Config) runCommitCmd(cmd *cobra.Command, args []string) error {
+	useBuiltinGit := c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc)
+
+	repo, err := c.openWorkingTreeRepo()
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	worktreeStatus, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, path := range chezmoimaps.SortedKeys(worktreeStatus) {
+		if fileStatus := worktreeStatus[path]; fileStatus.Staging == gogit.Unmodified &&
+			fileStatus.Worktree == gogit.Unmodified {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	if c.interactive {
+		if paths, err = c.selectCommitPaths(repo, paths); err != nil {
+			return err
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if useBuiltinGit {
+		return c.builtinGitCommit(cmd, worktree, paths)
+	}
+
+	if err := c.run(c.WorkingTreeAbsPath, c.Git.Command, append([]string{"add", "--all", "--"}, paths...)); err != nil {
+		return err
+	}
+	output, err := c.cmdOutput(
+		c.WorkingTreeAbsPath,
+		c.Git.Command,
+		append([]string{"status", "--porcelain=v2", "--"}, paths...),
+	)
+	if err != nil {
+		return err
+	}
+	status, err := git.ParseStatusPorcelainV2(output)
+	if err != nil {
+		return err
+	}
+	commitMessage, err := c.commitCmdMessage(cmd, status)
+	if err != nil {
+		return err
+	}
+	gitArgs := append([]string{"commit", "--message", string(commitMessage), "--"}, paths...)
+	return c.run(c.WorkingTreeAbsPath, c.Git.Command, gitArgs)
+}
+
+// builtinGitCommit stages and commits paths using the builtin git.
+func (c *Config) builtinGitCommit(
+	cmd *cobra.Command,
+	worktree *gogit.Worktree,
+	paths []string,
+) error {
+	if c.dryRun {
+		return nil
+	}
+	for _, path := range paths {
+		if _, err := worktree.Add(path); err != nil {
+			return err
+		}
+	}
+
+	worktreeStatus, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+	status := &git.Status{}
+	for _, path := range paths {
+		var x byte
+		switch worktreeStatus.File(path).Staging {
+		case gogit.Added:
+			x = 'A'
+		case gogit.Deleted:
+			x = 'D'
+		case gogit.Modified:
+			x = 'M'
+		default:
+			continue
+		}
+		status.Ordinary = append(status.Ordinary, git.OrdinaryStatus{
+			X:    x,
+			Y:    '.',
+			Path: path,
+		})
+	}
+	if status.Empty() {
+		return nil
+	}
+
+	commitMessage, err := c.commitCmdMessage(cmd, status)
+	if err != nil {
+		return err
+	}
+	_, err = worktree.Commit(string(commitMessage), &gogit.CommitOptions{})
+	return err
+}
+
+// commitCmdMessage returns the commit message for status.
+func (c *Config) commitCmdMessage(cmd *cobra.Command, status *git.Status) ([]byte, error) {
+	if c.commit.message != "" {
+		return []byte(c.commit.message), nil
+	}
+	return c.gitCommitMessage(cmd, status)
+}
+
+// selectCommitPaths prints the diff of each of paths against HEAD and prompts
+// the user to select which to commit.
+func (c *Config) selectCommitPaths(repo *gogit.Repository, paths []string) ([]string, error) {
+	headTree, err := gitHeadTree(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	unifiedEncoder := diff.NewUnifiedEncoder(c.stdout, diff.DefaultContextLines)
+	if c.Color.Value(c.colorAutoFunc) {
+		unifiedEncoder.SetColor(diff.NewColorConfig())
+	}
+
+	selectedPaths := make([]string, 0, len(paths))
+	all := false
+	for _, path := range paths {
+		if all {
+			selectedPaths = append(selectedPaths, path)
+			continue
+		}
+
+		var fromData []byte
+		var fromMode fs.FileMode
+		if headTree != nil {
+			if file, err := headTree.File(path); err == nil {
+				contents, err := file.Contents()
+				if err != nil {
+					return nil, err
+				}
+				fromData = []byte(contents)
+				if fromMode, err = file.Mode.ToOSFileMode(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		var toData []byte
+		var toMode fs.FileMode
+		absPath := c.WorkingTreeAbsPath.JoinString(filepath.FromSlash(path))
+		switch fileInfo, err := c.baseSystem.Lstat(absPath); {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		case fileInfo.Mode().Type() == fs.ModeSymlink:
+			linkname, err := c.baseSystem.Readlink(absPath)
+			if err != nil {
+				return nil, err
+			}
+			toData = []byte(linkname)
+			toMode = fileInfo.Mode()
+		default:
+			if toData, err = c.baseSystem.ReadFile(absPath); err != nil {
+				return nil, err
+			}
+			toMode = fileInfo.Mode()
+		}
+
+		diffPatch, err := chezmoi.DiffPatch(chezmoi.NewRelPath(path), fromData, fromMode, toData, toMode)
+		if err != nil {
+			return nil, err
+		}
+		if err := unifiedEncoder.Encode(diffPatch); err != nil {
+			return nil, err
+		}
+
+		switch choice, err := c.promptChoice(fmt.Sprintf("commit %s", path), choicesYesNoAllQuit); {
+		case err != nil:
+			return nil, err
+		case choice == "all":
+			all = true
+			selectedPaths = append(selectedPaths, path)
+		case choice == "no":
+		case choice == "quit":
+			return nil, chezmoi.ExitCodeError(0)
+		case choice == "yes":
+			selectedPaths = append(selectedPaths, path)
+		default:
+			panic(choice + ": unexpected choice")
+		}
+	}
+	return selectedPaths, nil
+}
+
+// gitHeadTree returns the tree of HEAD in repo, or nil if repo has no commits.
+func gitHeadTree(repo *gogit.Repository) (*object.Tree, error) {
+	head, err := repo.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
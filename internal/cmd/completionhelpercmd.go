@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// A completionFunc returns the completions for toComplete.
+type completionFunc func(cmd *cobra.Command, args []string, toComplete string) ([]string, error)
+
+func (c *Config) newCompletionHelperCmd() *cobra.Command {
+	completionHelperCmd := &cobra.Command{
+		Use:    "completion-helper",
+		Short:  "Print dynamic completions",
+		Hidden: true,
+	}
+
+	completionHelperConfigKeysCmd := &cobra.Command{
+		Use:   "config-keys [prefix]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Print config keys",
+		RunE:  c.makeRunCompletionHelperCmd(0, c.configKeyCompletions),
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+		),
+	}
+	completionHelperCmd.AddCommand(completionHelperConfigKeysCmd)
+
+	completionHelperSourcePathsCmd := &cobra.Command{
+		Use:   "source-paths [prefix]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Print managed source paths",
+		RunE:  c.makeRunCompletionHelperCmd(0, c.sourcePathCompletions),
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+		),
+	}
+	completionHelperCmd.AddCommand(completionHelperSourcePathsCmd)
+
+	completionHelperStateBucketsCmd := &cobra.Command{
+		Use:   "state-buckets [prefix]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Print persistent state bucket names",
+		RunE:  c.makeRunCompletionHelperCmd(0, c.stateBucketCompletions),
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+			persistentStateModeReadOnly,
+		),
+	}
+	completionHelperCmd.AddCommand(completionHelperStateBucketsCmd)
+
+	completionHelperStateKeysCmd := &cobra.Command{
+		Use:   "state-keys bucket [prefix]",
+		Args:  cobra.RangeArgs(1, 2),
+		Short: "Print persistent state keys",
+		RunE: c.makeRunCompletionHelperCmd(1, func(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+			return c.stateKeyCompletions(args[0], toComplete)
+		}),
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+			persistentStateModeReadOnly,
+		),
+	}
+	completionHelperCmd.AddCommand(completionHelperStateKeysCmd)
+
+	completionHelperTargetsCmd := &cobra.Command{
+		Use:   "targets [prefix]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Print managed targets",
+		RunE:  c.makeRunCompletionHelperCmd(0, c.targetCompletions),
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+		),
+	}
+	completionHelperCmd.AddCommand(completionHelperTargetsCmd)
+
+	return completionHelperCmd
+}
+
+// makeRunCompletionHelperCmd returns a function that runs completionFunc and
+// prints each completion on its own line. The argument at prefixArgIndex, if
+// present, is the prefix to complete.
+func (c *Config) makeRunCompletionHelperCmd(
+	prefixArgIndex int, completionFunc completionFunc,
+) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		var toComplete string
+		if len(args) > prefixArgIndex {
+			toComplete = args[prefixArgIndex]
+		}
+		completions, err := completionFunc(cmd, args, toComplete)
+		if err != nil {
+			return err
+		}
+		builder := strings.Builder{}
+		for _, completion := range completions {
+			builder.WriteString(completion)
+			builder.WriteByte('\n')
+		}
+		return c.writeOutputString(builder.String())
+	}
+}
+
+// makeValidArgsFunc returns a github.com/spf13/cobra.Command.ValidArgsFunction
+// that returns the completions from completionFunc.
+func (c *Config) makeValidArgsFunc(
+	completionFunc completionFunc,
+) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if !c.Completion.Custom {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		completions, err := completionFunc(cmd, args, toComplete)
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// configKeyCompletions returns the dotted config keys that start with
+// toComplete.
+func (c *Config) configKeyCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+	configMap, err := c.configMap()
+	if err != nil {
+		return nil, err
+	}
+	var completions []string
+	var walk func(string, map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for key, value := range m {
+			completion := prefix + key
+			if strings.HasPrefix(completion, toComplete) {
+				completions = append(completions, completion)
+			}
+			if valueMap, ok := value.(map[string]any); ok {
+				walk(completion+".", valueMap)
+			}
+		}
+	}
+	walk("", configMap)
+	slices.Sort(completions)
+	return completions, nil
+}
+
+// configMap returns c as a generic map, keyed by the same names that are used
+// in the config file.
+func (c *Config) configMap() (map[string]any, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var configMap map[string]any
+	if err := json.Unmarshal(data, &configMap); err != nil {
+		return nil, err
+	}
+	return configMap, nil
+}
+
+// moduleCompletions returns the names of the modules that start with
+// toComplete.
+func (c *Config) moduleCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+	var completions []string
+	for _, module := range sourceState.Modules() {
+		if strings.HasPrefix(module.Name, toComplete) {
+			completions = append(completions, module.Name)
+		}
+	}
+	return completions, nil
+}
+
+// sourcePathCompletions returns the source paths of managed entries that start
+// with toComplete.
+func (c *Config) sourcePathCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+	toCompleteAbsPath, err := chezmoi.NewAbsPathFromExtPath(toComplete, c.homeDirAbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var completions []string
+	if err := sourceState.ForEach(func(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) error {
+		sourceRelPath := sourceStateEntry.SourceRelPath()
+		if sourceRelPath.Empty() {
+			return nil
+		}
+		completion := c.SourceDirAbsPath.Join(sourceRelPath.RelPath()).String()
+		if _, ok := sourceStateEntry.(*chezmoi.SourceStateDir); ok {
+			completion += "/"
+		}
+		if strings.HasPrefix(completion, toCompleteAbsPath.String()) {
+			completions = append(completions, completion)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return c.relativeCompletions(completions, toComplete), nil
+}
+
+// stateBucketCompletions returns the names of the buckets in the persistent
+// state that start with toComplete.
+func (c *Config) stateBucketCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+	var completions []string
+	if err := c.withCompletionPersistentState(func(persistentState chezmoi.PersistentState) error {
+		buckets, err := chezmoi.PersistentStateBuckets(persistentState)
+		if err != nil {
+			return err
+		}
+		for _, bucket := range buckets {
+			if strings.HasPrefix(bucket, toComplete) {
+				completions = append(completions, bucket)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return completions, nil
+}
+
+// stateKeyCompletions returns the keys in bucket that start with toComplete.
+func (c *Config) stateKeyCompletions(bucket, toComplete string) ([]string, error) {
+	if bucket == "" {
+		return nil, nil
+	}
+	completionSet := make(map[string]struct{})
+	if err := c.withCompletionPersistentState(func(persistentState chezmoi.PersistentState) error {
+		return persistentState.ForEach([]byte(bucket), func(k, v []byte) error {
+			if key := string(k); strings.HasPrefix(key, toComplete) {
+				completionSet[key] = struct{}{}
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	completions := maps.Keys(completionSet)
+	slices.Sort(completions)
+	return completions, nil
+}
+
+// targetCompletions returns the managed targets that start with toComplete.
+func (c *Config) targetCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+	toCompleteAbsPath, err := chezmoi.NewAbsPathFromExtPath(toComplete, c.homeDirAbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var completions []string
+	if err := sourceState.ForEach(func(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) error {
+		completion := c.DestDirAbsPath.Join(targetRelPath).String()
+		if _, ok := sourceStateEntry.(*chezmoi.SourceStateDir); ok {
+			completion += "/"
+		}
+		if strings.HasPrefix(completion, toCompleteAbsPath.String()) {
+			completions = append(completions, completion)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return c.relativeCompletions(completions, toComplete), nil
+}
+
+// relativeCompletions makes completions relative to the command directory if
+// toComplete is not absolute.
+func (c *Config) relativeCompletions(completions []string, toComplete string) []string {
+	if !filepath.IsAbs(toComplete) {
+		for i, completion := range completions {
+			completions[i] = strings.TrimPrefix(completion, c.commandDirAbsPath.String()+"/")
+		}
+	}
+	return completions
+}
+
+// withCompletionPersistentState calls f with a read-only snapshot of the
+// persistent state. Completion functions run without the root command's
+// pre-run hooks or, for __complete, with a null persistent state, so the
+// persistent state must be opened here.
+func (c *Config) withCompletionPersistentState(f func(chezmoi.PersistentState) error) (err error) {
+	persistentState := c.persistentState
+	if _, ok := persistentState.(chezmoi.NullPersistentState); ok || persistentState == nil {
+		persistentStateFileAbsPath, err := c.persistentStateFile()
+		if err != nil {
+			return err
+		}
+		system := c.baseSystem
+		if system == nil {
+			system = chezmoi.NewRealSystem(c.fileSystem)
+		}
+		boltPersistentState, err := chezmoi.NewBoltPersistentState(
+			system,
+			persistentStateFileAbsPath,
+			chezmoi.BoltPersistentStateSnapshot,
+		)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := boltPersistentState.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		persistentState = boltPersistentState
+	}
+	return f(persistentState)
+}
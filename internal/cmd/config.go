@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"runtime/debug"
 	"runtime/pprof"
 	"sort"
 	"strconv"
@@ -27,8 +29,6 @@ import (
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/coreos/go-semver/semver"
-	gogit "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/gregjones/httpcache"
 	"github.com/gregjones/httpcache/diskcache"
 	"github.com/mitchellh/mapstructure"
@@ -66,6 +66,7 @@ const (
 	logComponentValuePersistentState = "persistentState"
 	logComponentValueSourceState     = "sourceState"
 	logComponentValueSystem          = "system"
+	logComponentValueTemplate        = "template"
 )
 
 type doPurgeOptions struct {
@@ -91,6 +92,11 @@ type templateConfig struct {
 	Options []string `json:"options" mapstructure:"options" yaml:"options"`
 }
 
+type trashConfig struct {
+	DirAbsPath chezmoi.AbsPath `json:"dir"     mapstructure:"dir"     yaml:"dir"`
+	Enabled    bool            `json:"enabled" mapstructure:"enabled" yaml:"enabled"`
+}
+
 type warningsConfig struct {
 	ConfigFileTemplateHasChanged bool `json:"configFileTemplateHasChanged" mapstructure:"configFileTemplateHasChanged" yaml:"configFileTemplateHasChanged"`
 }
@@ -98,32 +104,53 @@ type warningsConfig struct {
 // ConfigFile contains all data settable in the config file.
 type ConfigFile struct {
 	// Global configuration.
-	CacheDirAbsPath        chezmoi.AbsPath                 `json:"cacheDir"        mapstructure:"cacheDir"        yaml:"cacheDir"`
-	Color                  autoBool                        `json:"color"           mapstructure:"color"           yaml:"color"`
-	Data                   map[string]any                  `json:"data"            mapstructure:"data"            yaml:"data"`
-	Env                    map[string]string               `json:"env"             mapstructure:"env"             yaml:"env"`
-	Format                 writeDataFormat                 `json:"format"          mapstructure:"format"          yaml:"format"`
-	DestDirAbsPath         chezmoi.AbsPath                 `json:"destDir"         mapstructure:"destDir"         yaml:"destDir"`
-	GitHub                 gitHubConfig                    `json:"gitHub"          mapstructure:"gitHub"          yaml:"gitHub"`
-	Hooks                  map[string]hookConfig           `json:"hooks"           mapstructure:"hooks"           yaml:"hooks"`
-	Interpreters           map[string]*chezmoi.Interpreter `json:"interpreters"    mapstructure:"interpreters"    yaml:"interpreters"`
-	Mode                   chezmoi.Mode                    `json:"mode"            mapstructure:"mode"            yaml:"mode"`
-	Pager                  string                          `json:"pager"           mapstructure:"pager"           yaml:"pager"`
-	PersistentStateAbsPath chezmoi.AbsPath                 `json:"persistentState" mapstructure:"persistentState" yaml:"persistentState"`
-	PINEntry               pinEntryConfig                  `json:"pinentry"        mapstructure:"pinentry"        yaml:"pinentry"`
-	Progress               autoBool                        `json:"progress"        mapstructure:"progress"        yaml:"progress"`
-	Safe                   bool                            `json:"safe"            mapstructure:"safe"            yaml:"safe"`
-	ScriptEnv              map[string]string               `json:"scriptEnv"       mapstructure:"scriptEnv"       yaml:"scriptEnv"`
-	ScriptTempDir          chezmoi.AbsPath                 `json:"scriptTempDir"   mapstructure:"scriptTempDir"   yaml:"scriptTempDir"`
-	SourceDirAbsPath       chezmoi.AbsPath                 `json:"sourceDir"       mapstructure:"sourceDir"       yaml:"sourceDir"`
-	Template               templateConfig                  `json:"template"        mapstructure:"template"        yaml:"template"`
-	TextConv               textConv                        `json:"textConv"        mapstructure:"textConv"        yaml:"textConv"`
-	Umask                  fs.FileMode                     `json:"umask"           mapstructure:"umask"           yaml:"umask"`
-	UseBuiltinAge          autoBool                        `json:"useBuiltinAge"   mapstructure:"useBuiltinAge"   yaml:"useBuiltinAge"`
-	UseBuiltinGit          autoBool                        `json:"useBuiltinGit"   mapstructure:"useBuiltinGit"   yaml:"useBuiltinGit"`
-	Verbose                bool                            `json:"verbose"         mapstructure:"verbose"         yaml:"verbose"`
-	Warnings               warningsConfig                  `json:"warnings"        mapstructure:"warnings"        yaml:"warnings"`
-	WorkingTreeAbsPath     chezmoi.AbsPath                 `json:"workingTree"     mapstructure:"workingTree"     yaml:"workingTree"`
+	Aliases                map[string][]string             `json:"aliases"                mapstructure:"aliases"                yaml:"aliases"`
+	CacheDirAbsPath        chezmoi.AbsPath                 `json:"cacheDir"               mapstructure:"cacheDir"               yaml:"cacheDir"`
+	Color                  autoBool                        `json:"color"                  mapstructure:"color"                  yaml:"color"`
+	Conflicts              conflictsConfig                 `json:"conflicts"              mapstructure:"conflicts"              yaml:"conflicts"`
+	Data                   map[string]any                  `json:"data"                   mapstructure:"data"                   yaml:"data"`
+	DefaultModes           chezmoi.DefaultModes            `json:"defaultModes"           mapstructure:"defaultModes"           yaml:"defaultModes"`
+	Env                    map[string]string               `json:"env"                    mapstructure:"env"                    yaml:"env"`
+	EnvTemplate            bool                            `json:"envTemplate"            mapstructure:"envTemplate"            yaml:"envTemplate"`
+	Ephemeral              autoBool                        `json:"ephemeral"              mapstructure:"ephemeral"              yaml:"ephemeral"`
+	Format                 writeDataFormat                 `json:"format"                 mapstructure:"format"                 yaml:"format"`
+	DestDirAbsPath         chezmoi.AbsPath                 `json:"destDir"                mapstructure:"destDir"                yaml:"destDir"`
+	Gitea                  forgeConfig                     `json:"gitea"                  mapstructure:"gitea"                  yaml:"gitea"`
+	GitHub                 gitHubConfig                    `json:"gitHub"                 mapstructure:"gitHub"                 yaml:"gitHub"`
+	GitLab                 forgeConfig                     `json:"gitLab"                 mapstructure:"gitLab"                 yaml:"gitLab"`
+	Hooks                  map[string]hookConfig           `json:"hooks"                  mapstructure:"hooks"                  yaml:"hooks"`
+	HTTP                   httpConfig                      `json:"http"                   mapstructure:"http"                   yaml:"http"`
+	Identity               identityConfig                  `json:"identity"               mapstructure:"identity"               yaml:"identity"`
+	Interpreters           map[string]*chezmoi.Interpreter `json:"interpreters"           mapstructure:"interpreters"           yaml:"interpreters"`
+	LinkDirAbsPath         chezmoi.AbsPath                 `json:"linkDir"                mapstructure:"linkDir"                yaml:"linkDir"`
+	Log                    logConfig                       `json:"log"                    mapstructure:"log"                    yaml:"log"`
+	Metrics                metricsConfig                   `json:"metrics"                mapstructure:"metrics"                yaml:"metrics"`
+	Mode                   chezmoi.Mode                    `json:"mode"                   mapstructure:"mode"                   yaml:"mode"`
+	Network                networkConfig                   `json:"network"                mapstructure:"network"                yaml:"network"`
+	Pager                  string                          `json:"pager"                  mapstructure:"pager"                  yaml:"pager"`
+	PersistentStateAbsPath chezmoi.AbsPath                 `json:"persistentState"        mapstructure:"persistentState"        yaml:"persistentState"`
+	PersistentStateTimeout time.Duration                   `json:"persistentStateTimeout" mapstructure:"persistentStateTimeout" yaml:"persistentStateTimeout"`
+	PINEntry               pinEntryConfig                  `json:"pinentry"               mapstructure:"pinentry"               yaml:"pinentry"`
+	Profiles               map[string]map[string]any       `json:"profiles"               mapstructure:"profiles"               yaml:"profiles"`
+	Progress               autoBool                        `json:"progress"               mapstructure:"progress"               yaml:"progress"`
+	Safe                   bool                            `json:"safe"                   mapstructure:"safe"                   yaml:"safe"`
+	ScriptEnv              map[string]string               `json:"scriptEnv"              mapstructure:"scriptEnv"              yaml:"scriptEnv"`
+	ScriptTempDir          chezmoi.AbsPath                 `json:"scriptTempDir"          mapstructure:"scriptTempDir"          yaml:"scriptTempDir"`
+	SecretFixtures         chezmoi.AbsPath                 `json:"secretFixtures"         mapstructure:"secretFixtures"         yaml:"secretFixtures"`
+	SharedState            sharedStateConfig               `json:"sharedState"            mapstructure:"sharedState"            yaml:"sharedState"`
+	SourceDirAbsPath       chezmoi.AbsPath                 `json:"sourceDir"              mapstructure:"sourceDir"              yaml:"sourceDir"`
+	SourceLayers           []sourceLayerConfig             `json:"sourceLayers"           mapstructure:"sourceLayers"           yaml:"sourceLayers"`
+	SSHKeys                map[string]*sshKeyConfig        `json:"sshKeys"                mapstructure:"sshKeys"                yaml:"sshKeys"`
+	Template               templateConfig                  `json:"template"               mapstructure:"template"               yaml:"template"`
+	TextConv               textConv                        `json:"textConv"               mapstructure:"textConv"               yaml:"textConv"`
+	Trash                  trashConfig                     `json:"trash"                  mapstructure:"trash"                  yaml:"trash"`
+	Umask                  fs.FileMode                     `json:"umask"                  mapstructure:"umask"                  yaml:"umask"`
+	UseBuiltinAge          autoBool                        `json:"useBuiltinAge"          mapstructure:"useBuiltinAge"          yaml:"useBuiltinAge"`
+	UseBuiltinGit          autoBool                        `json:"useBuiltinGit"          mapstructure:"useBuiltinGit"          yaml:"useBuiltinGit"`
+	VCS                    string                          `json:"vcs"                    mapstructure:"vcs"                    yaml:"vcs"`
+	Verbose                bool                            `json:"verbose"                mapstructure:"verbose"                yaml:"verbose"`
+	Warnings               warningsConfig                  `json:"warnings"               mapstructure:"warnings"               yaml:"warnings"`
+	WorkingTreeAbsPath     chezmoi.AbsPath                 `json:"workingTree"            mapstructure:"workingTree"            yaml:"workingTree"`
 
 	// Password manager configurations.
 	AWSSecretsManager awsSecretsManagerConfig `json:"awsSecretsManager" mapstructure:"awsSecretsManager" yaml:"awsSecretsManager"`
@@ -141,23 +168,36 @@ type ConfigFile struct {
 	Onepassword       onepasswordConfig       `json:"onepassword"       mapstructure:"onepassword"       yaml:"onepassword"`
 	Pass              passConfig              `json:"pass"              mapstructure:"pass"              yaml:"pass"`
 	Passhole          passholeConfig          `json:"passhole"          mapstructure:"passhole"          yaml:"passhole"`
+	ProtonPass        protonPassConfig        `json:"protonPass"        mapstructure:"protonPass"        yaml:"protonPass"`
 	RBW               rbwConfig               `json:"rbw"               mapstructure:"rbw"               yaml:"rbw"`
 	Secret            secretConfig            `json:"secret"            mapstructure:"secret"            yaml:"secret"`
 	Vault             vaultConfig             `json:"vault"             mapstructure:"vault"             yaml:"vault"`
 
+	// Version control system configurations.
+	Fossil        vcsConfig           `json:"fossil" mapstructure:"fossil" yaml:"fossil"`
+	Hg            vcsConfig           `json:"hg"     mapstructure:"hg"     yaml:"hg"`
+	JJ            vcsConfig           `json:"jj"            mapstructure:"jj"            yaml:"jj"`
+	SourceArchive sourceArchiveConfig `json:"sourceArchive" mapstructure:"sourceArchive" yaml:"sourceArchive"`
+
 	// Encryption configurations.
-	Encryption string                `json:"encryption" mapstructure:"encryption" yaml:"encryption"`
-	Age        chezmoi.AgeEncryption `json:"age"        mapstructure:"age"        yaml:"age"`
-	GPG        chezmoi.GPGEncryption `json:"gpg"        mapstructure:"gpg"        yaml:"gpg"`
+	Encryption             string                `json:"encryption"             mapstructure:"encryption"             yaml:"encryption"`
+	EncryptPersistentState bool                  `json:"encryptPersistentState" mapstructure:"encryptPersistentState" yaml:"encryptPersistentState"`
+	Age                    chezmoi.AgeEncryption `json:"age"                    mapstructure:"age"                    yaml:"age"`
+	GPG                    chezmoi.GPGEncryption `json:"gpg"                    mapstructure:"gpg"                    yaml:"gpg"`
 
 	// Command configurations.
 	Add        addCmdConfig        `json:"add"        mapstructure:"add"        yaml:"add"`
+	Audit      auditCmdConfig      `json:"audit"      mapstructure:"audit"      yaml:"audit"`
 	CD         cdCmdConfig         `json:"cd"         mapstructure:"cd"         yaml:"cd"`
 	Completion completionCmdConfig `json:"completion" mapstructure:"completion" yaml:"completion"`
 	Diff       diffCmdConfig       `json:"diff"       mapstructure:"diff"       yaml:"diff"`
 	Edit       editCmdConfig       `json:"edit"       mapstructure:"edit"       yaml:"edit"`
+	Externals  externalsCmdConfig  `json:"externals"  mapstructure:"externals"  yaml:"externals"`
 	Git        gitCmdConfig        `json:"git"        mapstructure:"git"        yaml:"git"`
+	History    historyCmdConfig    `json:"history"    mapstructure:"history"    yaml:"history"`
 	Merge      mergeCmdConfig      `json:"merge"      mapstructure:"merge"      yaml:"merge"`
+	Rollback   rollbackCmdConfig   `json:"rollback"   mapstructure:"rollback"   yaml:"rollback"`
+	Scripts    scriptsCmdConfig    `json:"scripts"    mapstructure:"scripts"    yaml:"scripts"`
 	Status     statusCmdConfig     `json:"status"     mapstructure:"status"     yaml:"status"`
 	Update     updateCmdConfig     `json:"update"     mapstructure:"update"     yaml:"update"`
 	Verify     verifyCmdConfig     `json:"verify"     mapstructure:"verify"     yaml:"verify"`
@@ -168,41 +208,66 @@ type Config struct {
 	ConfigFile
 
 	// Global configuration.
-	configFormat     readDataFormat
-	cpuProfile       chezmoi.AbsPath
-	debug            bool
-	dryRun           bool
-	force            bool
-	homeDir          string
-	interactive      bool
-	keepGoing        bool
-	noPager          bool
-	noTTY            bool
-	outputAbsPath    chezmoi.AbsPath
-	refreshExternals chezmoi.RefreshExternals
-	sourcePath       bool
-	templateFuncs    template.FuncMap
+	configFormat       readDataFormat
+	closeLogWriter     func() error
+	cpuProfile         chezmoi.AbsPath
+	debug              bool
+	dryRun             bool
+	eventBus           *chezmoi.EventBus
+	events             eventsFormat
+	force              bool
+	frozenTime         frozenTime
+	homeDir            string
+	interactive        bool
+	keepGoing          bool
+	logComponentLevels map[string]zerolog.Level
+	noPager            bool
+	nonInteractive     bool
+	noTTY              bool
+	outputAbsPath      chezmoi.AbsPath
+	refreshExternals   chezmoi.RefreshExternals
+	runMetrics         *runMetrics
+	sourcePath         bool
+	templateFuncs      template.FuncMap
+	traceTemplates     bool
+	writeSecrets       bool
 
 	// Password manager data.
-	gitHub  gitHubData
-	keyring keyringData
+	forgeAPIResponseCache map[string][]byte
+	gitHub                gitHubData
+	keyring               keyringData
 
 	// Command configurations, not settable in the config file.
+	activate        activateCmdConfig
 	age             ageCmdConfig
 	apply           applyCmdConfig
 	archive         archiveCmdConfig
+	bundle          bundleCmdConfig
+	cat             catCmdConfig
 	chattr          chattrCmdConfig
+	commit          commitCmdConfig
+	daemon          daemonCmdConfig
 	dump            dumpCmdConfig
+	dumpConfig      dumpConfigCmdConfig
 	executeTemplate executeTemplateCmdConfig
+	explain         explainCmdConfig
+	export          exportCmdConfig
+	generate        generateCmdConfig
+	identity        identityCmdConfig
+	ignored         ignoredCmdConfig
 	_import         importCmdConfig
 	init            initCmdConfig
 	managed         managedCmdConfig
 	mergeAll        mergeAllCmdConfig
+	module          moduleCmdConfig
 	purge           purgeCmdConfig
 	reAdd           reAddCmdConfig
 	remove          removeCmdConfig
+	restore         restoreCmdConfig
 	secret          secretCmdConfig
+	sourcePathCmd   sourcePathCmdConfig
 	state           stateCmdConfig
+	targetPathCmd   targetPathCmdConfig
 	unmanaged       unmanagedCmdConfig
 	upgrade         upgradeCmdConfig
 
@@ -231,6 +296,9 @@ type Config struct {
 	commandDirAbsPath   chezmoi.AbsPath
 	homeDirAbsPath      chezmoi.AbsPath
 	encryption          chezmoi.Encryption
+	envTemplateCache    map[string]string
+	envTemplateDataFunc func() map[string]any
+	envTemplatesNeeded  bool
 	sourceDirAbsPath    chezmoi.AbsPath
 	sourceDirAbsPathErr error
 	sourceState         *chezmoi.SourceState
@@ -239,6 +307,10 @@ type Config struct {
 	gitleaksDetector    *detect.Detector
 	gitleaksDetectorErr error
 
+	// secretsScannedContents contains the SHA256 sums of contents already
+	// scanned for secrets, so that they are only reported once.
+	secretsScannedContents map[[sha256.Size]byte]struct{}
+
 	stdin             io.Reader
 	stdout            io.Writer
 	stderr            io.Writer
@@ -248,6 +320,10 @@ type Config struct {
 
 	tempDirs map[string]chezmoi.AbsPath
 
+	// tempAbsPaths are temporary files that have been written but not yet
+	// renamed into place, and that are removed if chezmoi panics.
+	tempAbsPaths map[chezmoi.AbsPath]struct{}
+
 	ioregData ioregData
 
 	restoreWindowsConsole func() error
@@ -261,6 +337,7 @@ type templateData struct {
 	commandDir        chezmoi.AbsPath
 	config            map[string]any
 	configFile        chezmoi.AbsPath
+	ephemeral         bool
 	executable        chezmoi.AbsPath
 	fqdnHostname      string
 	gid               string
@@ -268,11 +345,13 @@ type templateData struct {
 	homeDir           chezmoi.AbsPath
 	hostname          string
 	kernel            map[string]any
+	locale            localeData
 	os                string
 	osRelease         map[string]any
 	pathListSeparator string
 	pathSeparator     string
 	sourceDir         chezmoi.AbsPath
+	timezone          timezoneData
 	uid               string
 	username          string
 	version           map[string]any
@@ -291,16 +370,17 @@ var (
 	chezmoiRelPath             = chezmoi.NewRelPath("chezmoi")
 	persistentStateFileRelPath = chezmoi.NewRelPath("chezmoistate.boltdb")
 	httpCacheDirRelPath        = chezmoi.NewRelPath("httpcache")
+	linkDirRelPath             = chezmoi.NewRelPath("chezmoi-links")
 
 	configStateKey = []byte("configState")
 
 	defaultAgeEncryptionConfig = chezmoi.AgeEncryption{
 		Command: "age",
-		Suffix:  ".age",
+		Suffix:  chezmoi.DefaultAgeSuffix,
 	}
 	defaultGPGEncryptionConfig = chezmoi.GPGEncryption{
 		Command: "gpg",
-		Suffix:  ".asc",
+		Suffix:  chezmoi.DefaultGPGSuffix,
 	}
 
 	whitespaceRx = regexp.MustCompile(`\s+`)
@@ -340,6 +420,10 @@ func newConfig(options ...configOption) (*Config, error) {
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			recursive: true,
 		},
+		bundle: bundleCmdConfig{
+			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypeScripts),
+			recursive: true,
+		},
 		dump: dumpCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			recursive: true,
@@ -347,6 +431,13 @@ func newConfig(options ...configOption) (*Config, error) {
 		executeTemplate: executeTemplateCmdConfig{
 			stdinIsATTY: true,
 		},
+		export: exportCmdConfig{
+			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypeScripts),
+			format:    "oci",
+			gid:       -1,
+			recursive: true,
+			uid:       -1,
+		},
 		_import: importCmdConfig{
 			destination: homeDirAbsPath,
 			filter:      chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
@@ -359,6 +450,7 @@ func newConfig(options ...configOption) (*Config, error) {
 		},
 		managed: managedCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			format:    listFormatList,
 			pathStyle: chezmoi.PathStyleRelative,
 		},
 		mergeAll: mergeAllCmdConfig{
@@ -367,12 +459,19 @@ func newConfig(options ...configOption) (*Config, error) {
 		reAdd: reAddCmdConfig{
 			filter: chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 		},
+		remove: removeCmdConfig{
+			filter: chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+		},
 		unmanaged: unmanagedCmdConfig{
+			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			format:    listFormatList,
 			pathStyle: chezmoi.PathStyleRelative,
 		},
 		upgrade: upgradeCmdConfig{
-			owner: gitHubOwner,
-			repo:  gitHubRepo,
+			channel:   upgradeChannelStable,
+			owner:     gitHubOwner,
+			repo:      gitHubRepo,
+			signature: upgradeSignatureNone,
 		},
 
 		// Configuration.
@@ -383,7 +482,9 @@ func newConfig(options ...configOption) (*Config, error) {
 		// Computed configuration.
 		homeDirAbsPath: homeDirAbsPath,
 
-		tempDirs: make(map[string]chezmoi.AbsPath),
+		secretsScannedContents: make(map[[sha256.Size]byte]struct{}),
+		tempAbsPaths:           make(map[chezmoi.AbsPath]struct{}),
+		tempDirs:               make(map[string]chezmoi.AbsPath),
 
 		stdin:  os.Stdin,
 		stdout: os.Stdout,
@@ -392,92 +493,137 @@ func newConfig(options ...configOption) (*Config, error) {
 
 	// Override sprig template functions. Delete them from the template function
 	// map first to avoid a duplicate function panic.
+	delete(c.templateFuncs, "ago")
 	delete(c.templateFuncs, "fromJson")
+	delete(c.templateFuncs, "now")
 	delete(c.templateFuncs, "toPrettyJson")
 
 	// The completion template function is added in persistentPreRunRootE as
 	// it needs a *cobra.Command, which we don't yet have.
 	for key, value := range map[string]any{
-		"awsSecretsManager":        c.awsSecretsManagerTemplateFunc,
-		"awsSecretsManagerRaw":     c.awsSecretsManagerRawTemplateFunc,
-		"azureKeyVault":            c.azureKeyVaultTemplateFunc,
-		"bitwarden":                c.bitwardenTemplateFunc,
-		"bitwardenAttachment":      c.bitwardenAttachmentTemplateFunc,
-		"bitwardenAttachmentByRef": c.bitwardenAttachmentByRefTemplateFunc,
-		"bitwardenFields":          c.bitwardenFieldsTemplateFunc,
-		"bitwardenSecrets":         c.bitwardenSecretsTemplateFunc,
-		"comment":                  c.commentTemplateFunc,
-		"dashlaneNote":             c.dashlaneNoteTemplateFunc,
-		"dashlanePassword":         c.dashlanePasswordTemplateFunc,
-		"decrypt":                  c.decryptTemplateFunc,
-		"deleteValueAtPath":        c.deleteValueAtPathTemplateFunc,
-		"doppler":                  c.dopplerTemplateFunc,
-		"dopplerProjectJson":       c.dopplerProjectJSONTemplateFunc,
-		"ejsonDecrypt":             c.ejsonDecryptTemplateFunc,
-		"ejsonDecryptWithKey":      c.ejsonDecryptWithKeyTemplateFunc,
-		"encrypt":                  c.encryptTemplateFunc,
-		"eqFold":                   c.eqFoldTemplateFunc,
-		"findExecutable":           c.findExecutableTemplateFunc,
-		"findOneExecutable":        c.findOneExecutableTemplateFunc,
-		"fromIni":                  c.fromIniTemplateFunc,
-		"fromJson":                 c.fromJsonTemplateFunc,
-		"fromJsonc":                c.fromJsoncTemplateFunc,
-		"fromToml":                 c.fromTomlTemplateFunc,
-		"fromYaml":                 c.fromYamlTemplateFunc,
-		"gitHubKeys":               c.gitHubKeysTemplateFunc,
-		"gitHubLatestRelease":      c.gitHubLatestReleaseTemplateFunc,
-		"gitHubLatestTag":          c.gitHubLatestTagTemplateFunc,
-		"gitHubReleases":           c.gitHubReleasesTemplateFunc,
-		"gitHubTags":               c.gitHubTagsTemplateFunc,
-		"glob":                     c.globTemplateFunc,
-		"gopass":                   c.gopassTemplateFunc,
-		"gopassRaw":                c.gopassRawTemplateFunc,
-		"hcpVaultSecret":           c.hcpVaultSecretTemplateFunc,
-		"hcpVaultSecretJson":       c.hcpVaultSecretJSONTemplateFunc,
-		"hexDecode":                c.hexDecodeTemplateFunc,
-		"hexEncode":                c.hexEncodeTemplateFunc,
-		"include":                  c.includeTemplateFunc,
-		"includeTemplate":          c.includeTemplateTemplateFunc,
-		"ioreg":                    c.ioregTemplateFunc,
-		"isExecutable":             c.isExecutableTemplateFunc,
-		"joinPath":                 c.joinPathTemplateFunc,
-		"jq":                       c.jqTemplateFunc,
-		"keepassxc":                c.keepassxcTemplateFunc,
-		"keepassxcAttachment":      c.keepassxcAttachmentTemplateFunc,
-		"keepassxcAttribute":       c.keepassxcAttributeTemplateFunc,
-		"keeper":                   c.keeperTemplateFunc,
-		"keeperDataFields":         c.keeperDataFieldsTemplateFunc,
-		"keeperFindPassword":       c.keeperFindPasswordTemplateFunc,
-		"keyring":                  c.keyringTemplateFunc,
-		"lastpass":                 c.lastpassTemplateFunc,
-		"lastpassRaw":              c.lastpassRawTemplateFunc,
-		"lookPath":                 c.lookPathTemplateFunc,
-		"lstat":                    c.lstatTemplateFunc,
-		"mozillaInstallHash":       c.mozillaInstallHashTemplateFunc,
-		"onepassword":              c.onepasswordTemplateFunc,
-		"onepasswordDetailsFields": c.onepasswordDetailsFieldsTemplateFunc,
-		"onepasswordDocument":      c.onepasswordDocumentTemplateFunc,
-		"onepasswordItemFields":    c.onepasswordItemFieldsTemplateFunc,
-		"onepasswordRead":          c.onepasswordReadTemplateFunc,
-		"output":                   c.outputTemplateFunc,
-		"pass":                     c.passTemplateFunc,
-		"passFields":               c.passFieldsTemplateFunc,
-		"passhole":                 c.passholeTemplateFunc,
-		"passRaw":                  c.passRawTemplateFunc,
-		"pruneEmptyDicts":          c.pruneEmptyDictsTemplateFunc,
-		"quoteList":                c.quoteListTemplateFunc,
-		"rbw":                      c.rbwTemplateFunc,
-		"rbwFields":                c.rbwFieldsTemplateFunc,
-		"replaceAllRegex":          c.replaceAllRegexTemplateFunc,
-		"secret":                   c.secretTemplateFunc,
-		"secretJSON":               c.secretJSONTemplateFunc,
-		"setValueAtPath":           c.setValueAtPathTemplateFunc,
-		"stat":                     c.statTemplateFunc,
-		"toIni":                    c.toIniTemplateFunc,
-		"toPrettyJson":             c.toPrettyJsonTemplateFunc,
-		"toToml":                   c.toTomlTemplateFunc,
-		"toYaml":                   c.toYamlTemplateFunc,
-		"vault":                    c.vaultTemplateFunc,
+		"ago":                              c.agoTemplateFunc,
+		"awsSecretsManager":                c.awsSecretsManagerTemplateFunc,
+		"awsSecretsManagerRaw":             c.awsSecretsManagerRawTemplateFunc,
+		"azureKeyVault":                    c.azureKeyVaultTemplateFunc,
+		"base32Decode":                     c.base32DecodeTemplateFunc,
+		"base32Encode":                     c.base32EncodeTemplateFunc,
+		"base85Decode":                     c.base85DecodeTemplateFunc,
+		"base85Encode":                     c.base85EncodeTemplateFunc,
+		"bitwarden":                        c.bitwardenTemplateFunc,
+		"bitwardenAttachment":              c.bitwardenAttachmentTemplateFunc,
+		"bitwardenAttachmentByRef":         c.bitwardenAttachmentByRefTemplateFunc,
+		"bitwardenFields":                  c.bitwardenFieldsTemplateFunc,
+		"bitwardenSecrets":                 c.bitwardenSecretsTemplateFunc,
+		"comment":                          c.commentTemplateFunc,
+		"dashlaneNote":                     c.dashlaneNoteTemplateFunc,
+		"dashlanePassword":                 c.dashlanePasswordTemplateFunc,
+		"decrypt":                          c.decryptTemplateFunc,
+		"defaultRouteInterface":            c.defaultRouteInterfaceTemplateFunc,
+		"deleteValueAtPath":                c.deleteValueAtPathTemplateFunc,
+		"doppler":                          c.dopplerTemplateFunc,
+		"dopplerProjectJson":               c.dopplerProjectJSONTemplateFunc,
+		"ejsonDecrypt":                     c.ejsonDecryptTemplateFunc,
+		"ejsonDecryptWithKey":              c.ejsonDecryptWithKeyTemplateFunc,
+		"encrypt":                          c.encryptTemplateFunc,
+		"eqFold":                           c.eqFoldTemplateFunc,
+		"findExecutable":                   c.findExecutableTemplateFunc,
+		"findOneExecutable":                c.findOneExecutableTemplateFunc,
+		"fromIni":                          c.fromIniTemplateFunc,
+		"fromJson":                         c.fromJsonTemplateFunc,
+		"fromJsonc":                        c.fromJsoncTemplateFunc,
+		"fromToml":                         c.fromTomlTemplateFunc,
+		"fromYaml":                         c.fromYamlTemplateFunc,
+		"gitHubKeys":                       c.gitHubKeysTemplateFunc,
+		"gitHubLatestRelease":              c.gitHubLatestReleaseTemplateFunc,
+		"gitHubLatestReleaseAssetChecksum": c.gitHubLatestReleaseAssetChecksumTemplateFunc,
+		"gitHubLatestReleaseAssetURL":      c.gitHubLatestReleaseAssetURLTemplateFunc,
+		"gitHubLatestTag":                  c.gitHubLatestTagTemplateFunc,
+		"gitHubReleases":                   c.gitHubReleasesTemplateFunc,
+		"gitHubTags":                       c.gitHubTagsTemplateFunc,
+		"gitLabKeys":                       c.gitLabKeysTemplateFunc,
+		"gitLabLatestRelease":              c.gitLabLatestReleaseTemplateFunc,
+		"gitLabLatestTag":                  c.gitLabLatestTagTemplateFunc,
+		"gitLabReleases":                   c.gitLabReleasesTemplateFunc,
+		"gitLabTags":                       c.gitLabTagsTemplateFunc,
+		"giteaKeys":                        c.giteaKeysTemplateFunc,
+		"giteaLatestRelease":               c.giteaLatestReleaseTemplateFunc,
+		"giteaLatestTag":                   c.giteaLatestTagTemplateFunc,
+		"giteaReleases":                    c.giteaReleasesTemplateFunc,
+		"giteaTags":                        c.giteaTagsTemplateFunc,
+		"glob":                             c.globTemplateFunc,
+		"gopass":                           c.gopassTemplateFunc,
+		"gopassBinary":                     c.gopassBinaryTemplateFunc,
+		"gopassData":                       c.gopassDataTemplateFunc,
+		"gopassList":                       c.gopassListTemplateFunc,
+		"gopassRaw":                        c.gopassRawTemplateFunc,
+		"hcpVaultSecret":                   c.hcpVaultSecretTemplateFunc,
+		"hcpVaultSecretJson":               c.hcpVaultSecretJSONTemplateFunc,
+		"hexDecode":                        c.hexDecodeTemplateFunc,
+		"hexEncode":                        c.hexEncodeTemplateFunc,
+		"include":                          c.includeTemplateFunc,
+		"includeTemplate":                  c.includeTemplateTemplateFunc,
+		"ioreg":                            c.ioregTemplateFunc,
+		"isExecutable":                     c.isExecutableTemplateFunc,
+		"joinPath":                         c.joinPathTemplateFunc,
+		"jq":                               c.jqTemplateFunc,
+		"keepassxc":                        c.keepassxcTemplateFunc,
+		"keepassxcAttachment":              c.keepassxcAttachmentTemplateFunc,
+		"keepassxcAttribute":               c.keepassxcAttributeTemplateFunc,
+		"keeper":                           c.keeperTemplateFunc,
+		"keeperDataFields":                 c.keeperDataFieldsTemplateFunc,
+		"keeperFindPassword":               c.keeperFindPasswordTemplateFunc,
+		"keyring":                          c.keyringTemplateFunc,
+		"keyringSet":                       c.keyringSetTemplateFunc,
+		"lastpass":                         c.lastpassTemplateFunc,
+		"lastpassAttachment":               c.lastpassAttachmentTemplateFunc,
+		"lastpassRaw":                      c.lastpassRawTemplateFunc,
+		"lookPath":                         c.lookPathTemplateFunc,
+		"lookupIP":                         c.lookupIPTemplateFunc,
+		"lstat":                            c.lstatTemplateFunc,
+		"machineIdentity":                  c.machineIdentityTemplateFunc,
+		"machineRecipients":                c.machineRecipientsTemplateFunc,
+		"machineUUID":                      c.machineUUIDTemplateFunc,
+		"machines":                         c.machinesTemplateFunc,
+		"mozillaInstallHash":               c.mozillaInstallHashTemplateFunc,
+		"now":                              c.nowTemplateFunc,
+		"onepassword":                      c.onepasswordTemplateFunc,
+		"onepasswordDetailsFields":         c.onepasswordDetailsFieldsTemplateFunc,
+		"onepasswordDocument":              c.onepasswordDocumentTemplateFunc,
+		"onepasswordItemFields":            c.onepasswordItemFieldsTemplateFunc,
+		"onepasswordRead":                  c.onepasswordReadTemplateFunc,
+		"onepasswordWrite":                 c.onepasswordWriteTemplateFunc,
+		"output":                           c.outputTemplateFunc,
+		"pass":                             c.passTemplateFunc,
+		"passFields":                       c.passFieldsTemplateFunc,
+		"passhole":                         c.passholeTemplateFunc,
+		"passRaw":                          c.passRawTemplateFunc,
+		"protonPass":                       c.protonPassTemplateFunc,
+		"protonPassJSON":                   c.protonPassJSONTemplateFunc,
+		"proxyActive":                      c.proxyActiveTemplateFunc,
+		"pruneEmptyDicts":                  c.pruneEmptyDictsTemplateFunc,
+		"quoteList":                        c.quoteListTemplateFunc,
+		"rbw":                              c.rbwTemplateFunc,
+		"rbwFields":                        c.rbwFieldsTemplateFunc,
+		"regexCaptures":                    c.regexCapturesTemplateFunc,
+		"regexCapturesAll":                 c.regexCapturesAllTemplateFunc,
+		"replaceAllRegex":                  c.replaceAllRegexTemplateFunc,
+		"secret":                           c.secretTemplateFunc,
+		"secretJSON":                       c.secretJSONTemplateFunc,
+		"semverCmp":                        c.semverCmpTemplateFunc,
+		"semverMaxSatisfying":              c.semverMaxSatisfyingTemplateFunc,
+		"semverSort":                       c.semverSortTemplateFunc,
+		"setValueAtPath":                   c.setValueAtPathTemplateFunc,
+		"sortNatural":                      c.sortNaturalTemplateFunc,
+		"sshPublicKey":                     c.sshPublicKeyTemplateFunc,
+		"stat":                             c.statTemplateFunc,
+		"tcpReachable":                     c.tcpReachableTemplateFunc,
+		"toIni":                            c.toIniTemplateFunc,
+		"toPrettyJson":                     c.toPrettyJsonTemplateFunc,
+		"toToml":                           c.toTomlTemplateFunc,
+		"toYaml":                           c.toYamlTemplateFunc,
+		"vault":                            c.vaultTemplateFunc,
+		"vaultWrite":                       c.vaultWriteTemplateFunc,
+		"vpnActive":                        c.vpnActiveTemplateFunc,
 	} {
 		c.addTemplateFunc(key, value)
 	}
@@ -544,9 +690,16 @@ func (c *Config) addTemplateFunc(key string, value any) {
 
 type applyArgsOptions struct {
 	cmd          *cobra.Command
+	checkpoint   bool
 	filter       *chezmoi.EntryTypeFilter
+	history      bool
 	init         bool
+	provision    bool
 	recursive    bool
+	resume       bool
+	skipTags     []string
+	snapshot     bool
+	tags         []string
 	umask        fs.FileMode
 	preApplyFunc chezmoi.PreApplyFunc
 }
@@ -611,6 +764,14 @@ func (c *Config) applyArgs(
 		}
 	}
 
+	// Generate any missing SSH keys before reading the source state so that
+	// templates can use their public keys.
+	if options.provision {
+		if err := c.provisionSSHKeys(ctx); err != nil {
+			return err
+		}
+	}
+
 	sourceState, err := c.getSourceState(ctx, options.cmd)
 	if err != nil {
 		return err
@@ -635,23 +796,107 @@ func (c *Config) applyArgs(
 		}
 	}
 
+	if len(options.tags) != 0 || len(options.skipTags) != 0 {
+		targetRelPaths = filterTargetRelPathsByTags(sourceState, targetRelPaths, options.tags, options.skipTags)
+	}
+
+	// Skip targets that are disabled on this machine.
+	disabledTargets, err := c.disabledTargets()
+	if err != nil {
+		return err
+	}
+	if len(disabledTargets) != 0 {
+		enabledTargetRelPaths := make(chezmoi.RelPaths, 0, len(targetRelPaths))
+		for _, targetRelPath := range targetRelPaths {
+			if !disabledTargets.contains(targetRelPath) {
+				enabledTargetRelPaths = append(enabledTargetRelPaths, targetRelPath)
+			}
+		}
+		targetRelPaths = enabledTargetRelPaths
+	}
+
+	defer c.reportScriptRuns(time.Now())
+
+	preApplyFunc := options.preApplyFunc
+	var generation *generation
+	if options.history {
+		generation, err = c.newGeneration()
+		if err != nil {
+			return err
+		}
+		defer c.recordGeneration(generation)
+		preApplyFunc = c.newGenerationPreApplyFunc(generation, preApplyFunc)
+	}
+	if options.snapshot {
+		snapshot := newSnapshot()
+		defer c.recordSnapshot(snapshot)
+		preApplyFunc = c.newSnapshotPreApplyFunc(snapshot, targetDirAbsPath, preApplyFunc)
+	}
+
 	applyOptions := chezmoi.ApplyOptions{
 		Filter:       options.filter,
-		PreApplyFunc: options.preApplyFunc,
+		PreApplyFunc: preApplyFunc,
 		Umask:        options.umask,
 	}
 
+	// If resuming, skip the target entries that were already applied.
+	// Otherwise, discard any checkpoint left by an interrupted apply. Only
+	// target entries that are changed are recorded, so that an apply that does
+	// nothing does not modify the persistent state.
+	var appliedRelPaths map[chezmoi.RelPath]struct{}
+	checkpointPending, checkpointed := false, false
+	if options.resume || options.checkpoint {
+		appliedRelPaths, err = c.appliedCheckpointRelPaths()
+		if err != nil {
+			return err
+		}
+		checkpointed = len(appliedRelPaths) > 0
+		if !options.resume && checkpointed {
+			if err := c.persistentState.DeleteBucket(applyCheckpointStateBucket); err != nil {
+				return err
+			}
+			appliedRelPaths, checkpointed = nil, false
+		}
+	}
+	if options.checkpoint {
+		applyOptions.PreApplyFunc = newCheckpointPreApplyFunc(&checkpointPending, applyOptions.PreApplyFunc)
+	}
+
 	keptGoingAfterErr := false
 	for _, targetRelPath := range targetRelPaths {
+		if _, ok := appliedRelPaths[targetRelPath]; ok {
+			continue
+		}
+		if generation != nil {
+			generation.pending = nil
+		}
+		checkpointPending = false
+		var abortError *chezmoi.AbortError
 		switch err := sourceState.Apply(targetSystem, c.destSystem, c.persistentState, targetDirAbsPath, targetRelPath, applyOptions); {
 		case errors.Is(err, fs.SkipDir):
 			continue
+		case errors.As(err, &abortError):
+			return err
 		case err != nil && c.keepGoing:
 			c.errorf("%v\n", err)
 			keptGoingAfterErr = true
+			continue
 		case err != nil:
 			return err
 		}
+		if generation != nil {
+			if err := c.commitGenerationEntry(generation); err != nil {
+				return err
+			}
+		}
+		if checkpointPending {
+			checkpointed = true
+			if err := chezmoi.PersistentStateSet(c.persistentState, applyCheckpointStateBucket, []byte(targetRelPath.String()), &applyCheckpointState{
+				AppliedAt: time.Now().UTC(),
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	switch err := sourceState.PostApply(targetSystem, c.persistentState, targetDirAbsPath, targetRelPaths); {
@@ -666,6 +911,12 @@ func (c *Config) applyArgs(
 		return chezmoi.ExitCodeError(1)
 	}
 
+	if checkpointed {
+		if err := c.persistentState.DeleteBucket(applyCheckpointStateBucket); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -718,6 +969,23 @@ func (c *Config) colorAutoFunc() bool {
 	return false
 }
 
+// isEphemeral returns whether chezmoi is running in one-shot mode or in an
+// ephemeral environment.
+func (c *Config) isEphemeral() bool {
+	return c.init.oneShot || c.Ephemeral.Value(c.ephemeralAutoFunc)
+}
+
+// ephemeralAutoFunc detects whether chezmoi is running in an ephemeral
+// environment, like a GitHub Codespace or a development container.
+func (c *Config) ephemeralAutoFunc() bool {
+	for _, key := range []string{"CODESPACES", "REMOTE_CONTAINERS"} {
+		if value, _ := strconv.ParseBool(os.Getenv(key)); value {
+			return true
+		}
+	}
+	return false
+}
+
 // createAndReloadConfigFile creates a config file if it there is a config file
 // template and reloads it.
 func (c *Config) createAndReloadConfigFile(cmd *cobra.Command) error {
@@ -788,7 +1056,7 @@ func (c *Config) createAndReloadConfigFile(cmd *cobra.Command) error {
 		return err
 	}
 
-	if err := c.setEnvironmentVariables(); err != nil {
+	if err := c.setEnvironmentVariables(cmd); err != nil {
 		return err
 	}
 
@@ -923,6 +1191,14 @@ func (c *Config) decodeConfigFile(configFileAbsPath chezmoi.AbsPath, configFile
 		)
 	}
 
+	if err := validateGitRemotes(configFile.Git.Remotes); err != nil {
+		return fmt.Errorf("%s: %w", configFileAbsPath, err)
+	}
+
+	if err := validateSourceLayers(configFile.SourceLayers); err != nil {
+		return fmt.Errorf("%s: %w", configFileAbsPath, err)
+	}
+
 	return nil
 }
 
@@ -935,6 +1211,7 @@ func (c *Config) decodeConfigMap(configMap map[string]any, configFile *ConfigFil
 			chezmoi.StringSliceToEntryTypeSetHookFunc(),
 			chezmoi.StringToAbsPathHookFunc(),
 			StringOrBoolToAutoBoolHookFunc(),
+			StringOrMapToSecretStringHookFunc(),
 		),
 		Result: configFile,
 	})
@@ -965,7 +1242,18 @@ func (c *Config) defaultPreApplyFunc(
 		return nil
 	}
 
+	promptAnswerState, err := c.getPromptAnswerState(targetRelPath)
+	if err != nil {
+		return err
+	}
+
 	if c.interactive {
+		switch promptAnswerState.Apply {
+		case promptAnswerAlways:
+			return nil
+		case promptAnswerNever:
+			return fs.SkipDir
+		}
 		prompt := fmt.Sprintf("Apply %s", targetRelPath)
 		var choices []string
 		actualContents := actualEntryState.Contents()
@@ -973,7 +1261,15 @@ func (c *Config) defaultPreApplyFunc(
 		if actualContents != nil || targetContents != nil {
 			choices = append(choices, "diff")
 		}
+		var partialDiff *chezmoi.PartialDiff
+		if actualEntryState.Type == chezmoi.EntryStateTypeFile && targetEntryState.Type == chezmoi.EntryStateTypeFile {
+			partialDiff = chezmoi.NewPartialDiff(actualContents, targetContents)
+		}
+		if partialDiff != nil && partialDiff.Len() > 0 {
+			choices = append(choices, "patch")
+		}
 		choices = append(choices, choicesYesNoAllQuit...)
+		choices = append(choices, promptAnswerAlways, promptAnswerNever)
 		for {
 			switch choice, err := c.promptChoice(prompt, choices); {
 			case err != nil:
@@ -983,6 +1279,10 @@ func (c *Config) defaultPreApplyFunc(
 				if err != nil {
 					return err
 				}
+			case choice == "patch":
+				if done, err := c.applyHunks(targetRelPath, actualEntryState, partialDiff); done {
+					return err
+				}
 			case choice == "yes":
 				return nil
 			case choice == "no":
@@ -992,6 +1292,15 @@ func (c *Config) defaultPreApplyFunc(
 				return nil
 			case choice == "quit":
 				return chezmoi.ExitCodeError(0)
+			case choice == promptAnswerAlways:
+				promptAnswerState.Apply = promptAnswerAlways
+				return c.setPromptAnswerState(targetRelPath, promptAnswerState)
+			case choice == promptAnswerNever:
+				promptAnswerState.Apply = promptAnswerNever
+				if err := c.setPromptAnswerState(targetRelPath, promptAnswerState); err != nil {
+					return err
+				}
+				return fs.SkipDir
 			default:
 				panic(choice + ": unexpected choice")
 			}
@@ -1009,6 +1318,17 @@ func (c *Config) defaultPreApplyFunc(
 		return nil
 	}
 
+	switch promptAnswerState.Overwrite {
+	case promptAnswerAlways:
+		return nil
+	case promptAnswerNever:
+		return fs.SkipDir
+	}
+
+	if policy := c.Conflicts.policy(targetRelPath, c.nonInteractive); policy != conflictPolicyNone {
+		return resolveConflict(targetRelPath, policy)
+	}
+
 	prompt := fmt.Sprintf("%s has changed since chezmoi last wrote it", targetRelPath)
 	var choices []string
 	actualContents := actualEntryState.Contents()
@@ -1016,7 +1336,7 @@ func (c *Config) defaultPreApplyFunc(
 	if actualContents != nil || targetContents != nil {
 		choices = append(choices, "diff")
 	}
-	choices = append(choices, "overwrite", "all-overwrite", "skip", "quit")
+	choices = append(choices, "overwrite", "all-overwrite", "skip", "quit", promptAnswerAlways, promptAnswerNever)
 	for {
 		switch choice, err := c.promptChoice(prompt, choices); {
 		case err != nil:
@@ -1034,6 +1354,15 @@ func (c *Config) defaultPreApplyFunc(
 			return fs.SkipDir
 		case choice == "quit":
 			return chezmoi.ExitCodeError(0)
+		case choice == promptAnswerAlways:
+			promptAnswerState.Overwrite = promptAnswerAlways
+			return c.setPromptAnswerState(targetRelPath, promptAnswerState)
+		case choice == promptAnswerNever:
+			promptAnswerState.Overwrite = promptAnswerNever
+			if err := c.setPromptAnswerState(targetRelPath, promptAnswerState); err != nil {
+				return err
+			}
+			return fs.SkipDir
 		default:
 			panic(choice + ": unexpected choice")
 		}
@@ -1063,6 +1392,7 @@ func (c *Config) defaultSourceDir(fileSystem vfs.Stater, bds *xdg.BaseDirectoryS
 }
 
 type destAbsPathInfosOptions struct {
+	filterFunc     func(chezmoi.RelPath, fs.FileInfo) (bool, error)
 	follow         bool
 	ignoreNotExist bool
 	recursive      bool
@@ -1100,6 +1430,18 @@ func (c *Config) destAbsPathInfos(
 						return err
 					}
 				}
+				if options.filterFunc != nil {
+					targetRelPath, err := c.targetRelPath(destAbsPath)
+					if err != nil {
+						return err
+					}
+					switch include, err := options.filterFunc(targetRelPath, fileInfo); {
+					case err != nil:
+						return err
+					case !include:
+						return nil
+					}
+				}
 				return sourceState.AddDestAbsPathInfos(destAbsPathInfos, c.destSystem, destAbsPath, fileInfo)
 			}
 			if err := chezmoi.Walk(c.destSystem, destAbsPath, walkFunc); err != nil {
@@ -1136,10 +1478,9 @@ func (c *Config) diffFile(
 	toMode fs.FileMode,
 ) error {
 	builder := strings.Builder{}
-	unifiedEncoder := diff.NewUnifiedEncoder(&builder, diff.DefaultContextLines)
-	color := c.Color.Value(c.colorAutoFunc)
-	if color {
-		unifiedEncoder.SetColor(diff.NewColorConfig())
+	diffEncoder, err := c.newDiffEncoder(&builder)
+	if err != nil {
+		return err
 	}
 	if fromMode.IsRegular() {
 		var err error
@@ -1159,26 +1500,50 @@ func (c *Config) diffFile(
 	if err != nil {
 		return err
 	}
-	if err := unifiedEncoder.Encode(diffPatch); err != nil {
+	if err := chezmoi.AddBinaryDiffOutput(diffPatch, fromData, toData, c.binaryDiff); err != nil {
+		return err
+	}
+	if err := diffEncoder.Encode(diffPatch); err != nil {
 		return err
 	}
 	return c.pageDiffOutput(builder.String())
 }
 
-// editor returns the path to the user's editor and any extra arguments.
-func (c *Config) editor(args []string) (string, []string, error) {
+// editor returns the path to the user's editor for name and any extra
+// arguments.
+func (c *Config) editor(name string, args []string) (string, []string, error) {
+	editor, err := findPatternCommand(c.Edit.Editors, name)
+	if err != nil {
+		return "", nil, fmt.Errorf("edit.editors: %w", err)
+	}
+	return c.editorCommand(editor, args)
+}
+
+// editorCommand returns the path to editor and any extra arguments, or the
+// user's default editor if editor is nil.
+func (c *Config) editorCommand(editor *patternCommandConfig, args []string) (string, []string, error) {
+	// If the user has set an editor then use it.
+	if editor != nil {
+		editArgs := append(slices.Clone(editor.Args), args...)
+		return editor.Command, withBlockingArgs(editor.Command, editArgs), nil
+	}
+
 	editCommand := c.Edit.Command
-	editArgs := c.Edit.Args
+	editArgs := append(slices.Clone(c.Edit.Args), args...)
 
 	// If the user has set an edit command then use it.
 	if editCommand != "" {
-		return editCommand, append(editArgs, args...), nil
+		return editCommand, withBlockingArgs(editCommand, editArgs), nil
 	}
 
 	// Prefer $VISUAL over $EDITOR and fallback to the OS's default editor.
 	editCommand = firstNonEmptyString(os.Getenv("VISUAL"), os.Getenv("EDITOR"), defaultEditor)
 
-	return parseCommand(editCommand, append(editArgs, args...))
+	editCommand, editArgs, err := parseCommand(editCommand, editArgs)
+	if err != nil {
+		return "", nil, err
+	}
+	return editCommand, withBlockingArgs(editCommand, editArgs), nil
 }
 
 // errorf writes an error to stderr.
@@ -1187,14 +1552,25 @@ func (c *Config) errorf(format string, args ...any) {
 }
 
 // execute creates a new root command and executes it with args.
-func (c *Config) execute(args []string) error {
+func (c *Config) execute(args []string) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = c.recoverPanic(value, debug.Stack())
+		}
+	}()
+
 	rootCmd, err := c.newRootCmd()
 	if err != nil {
 		return err
 	}
+	args = c.expandAliases(rootCmd, args)
 	rootCmd.SetArgs(args)
 
-	return rootCmd.Execute()
+	err = rootCmd.Execute()
+	if metricsErr := c.writeMetrics(err); metricsErr != nil {
+		c.errorf("warning: metrics: %v\n", metricsErr)
+	}
+	return err
 }
 
 // filterInput reads from args (or the standard input if args is empty),
@@ -1348,15 +1724,58 @@ func (c *Config) getHTTPClient() (*http.Client, error) {
 		return c.httpClient, nil
 	}
 
+	transport, err := c.newHTTPTransport()
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := c.newCachingHTTPClient(transport)
+	if err != nil {
+		return nil, err
+	}
+	c.httpClient = httpClient
+
+	return c.httpClient, nil
+}
+
+// newCachingHTTPClient returns a new HTTP client that caches responses from
+// transport in the HTTP cache.
+func (c *Config) newCachingHTTPClient(transport http.RoundTripper) (*http.Client, error) {
 	httpCacheBasePath, err := c.baseSystem.RawPath(c.CacheDirAbsPath.Join(httpCacheDirRelPath))
 	if err != nil {
 		return nil, err
 	}
 	httpCache := diskcache.New(httpCacheBasePath.String())
 	httpTransport := httpcache.NewTransport(httpCache)
-	c.httpClient = httpTransport.Client()
+	httpTransport.Transport = transport
+	return httpTransport.Client(), nil
+}
 
-	return c.httpClient, nil
+// downloadURL returns the body of an HTTP GET request to url.
+func (c *Config) downloadURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := c.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chezmoilog.LogHTTPRequest(c.logger, httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 type getSourceDirAbsPathOptions struct {
@@ -1413,6 +1832,7 @@ func (c *Config) getTemplateDataMap(cmd *cobra.Command) map[string]any {
 			"commandDir":        templateData.commandDir.String(),
 			"config":            templateData.config,
 			"configFile":        templateData.configFile.String(),
+			"ephemeral":         templateData.ephemeral,
 			"executable":        templateData.executable.String(),
 			"fqdnHostname":      templateData.fqdnHostname,
 			"gid":               templateData.gid,
@@ -1420,11 +1840,13 @@ func (c *Config) getTemplateDataMap(cmd *cobra.Command) map[string]any {
 			"homeDir":           templateData.homeDir.String(),
 			"hostname":          templateData.hostname,
 			"kernel":            templateData.kernel,
+			"locale":            templateData.locale.toMap(),
 			"os":                templateData.os,
 			"osRelease":         templateData.osRelease,
 			"pathListSeparator": templateData.pathListSeparator,
 			"pathSeparator":     templateData.pathSeparator,
 			"sourceDir":         templateData.sourceDir.String(),
+			"timezone":          templateData.timezone.toMap(),
 			"uid":               templateData.uid,
 			"username":          templateData.username,
 			"version":           templateData.version,
@@ -1434,37 +1856,49 @@ func (c *Config) getTemplateDataMap(cmd *cobra.Command) map[string]any {
 	}
 }
 
-// gitAutoAdd adds all changes to the git index and returns the new git status.
-func (c *Config) gitAutoAdd() (*git.Status, error) {
-	if err := c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"add", "."}); err != nil {
-		return nil, err
-	}
-	output, err := c.cmdOutput(c.WorkingTreeAbsPath, c.Git.Command, []string{"status", "--porcelain=v2"})
+// autoAdd adds all changes to the working tree's version control system and
+// returns the new status.
+func (c *Config) autoAdd() (*git.Status, error) {
+	vcs, err := c.vcs()
 	if err != nil {
 		return nil, err
 	}
-	return git.ParseStatusPorcelainV2(output)
+	return vcs.autoAdd(c)
 }
 
-// gitAutoCommit commits all changes in the git index, including generating a
-// commit message from status.
-func (c *Config) gitAutoCommit(cmd *cobra.Command, status *git.Status) error {
+// autoCommit commits all added changes, including generating a commit message
+// from status.
+func (c *Config) autoCommit(cmd *cobra.Command, status *git.Status) error {
 	if status.Empty() {
 		return nil
 	}
+	switch found, err := c.scanGitStatusForSecrets(status); {
+	case err != nil:
+		return err
+	case found && !c.force && c.Add.Secrets == severityError:
+		return errors.New("refusing to commit possible secrets, use --force to commit anyway")
+	}
 	commitMessage, err := c.gitCommitMessage(cmd, status)
 	if err != nil {
 		return err
 	}
-	return c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"commit", "--message", string(commitMessage)})
+	vcs, err := c.vcs()
+	if err != nil {
+		return err
+	}
+	return vcs.commit(c, commitMessage)
 }
 
-// gitAutoPush pushes all changes to the remote if status is not empty.
-func (c *Config) gitAutoPush(status *git.Status) error {
+// autoPush pushes all changes to the remote if status is not empty.
+func (c *Config) autoPush(status *git.Status) error {
 	if status.Empty() {
 		return nil
 	}
-	return c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"push"})
+	vcs, err := c.vcs()
+	if err != nil {
+		return err
+	}
+	return vcs.push(c)
 }
 
 // gitCommitMessage returns the git commit message for the given status.
@@ -1496,9 +1930,14 @@ func (c *Config) gitCommitMessage(cmd *cobra.Command, status *git.Status) ([]byt
 		if err != nil {
 			return nil, err
 		}
-	default:
+	case c.Git.CommitMessageStyle == "" || c.Git.CommitMessageStyle == "default":
 		name = "COMMIT_MESSAGE"
 		commitMessageTemplateData = []byte(templates.CommitMessageTmpl)
+	case c.Git.CommitMessageStyle == "conventional":
+		name = "CONVENTIONAL_COMMIT_MESSAGE"
+		commitMessageTemplateData = []byte(templates.ConventionalCommitMessageTmpl)
+	default:
+		return nil, fmt.Errorf("%s: unknown git.commitMessageStyle", c.Git.CommitMessageStyle)
 	}
 	commitMessageTmpl, err := chezmoi.ParseTemplate(name, commitMessageTemplateData, funcMap, chezmoi.TemplateOptions{
 		Options: slices.Clone(c.Template.Options),
@@ -1511,10 +1950,50 @@ func (c *Config) gitCommitMessage(cmd *cobra.Command, status *git.Status) ([]byt
 		return nil, err
 	}
 	templateDataMap := sourceState.TemplateData()
-	templateDataMap["chezmoi"].(map[string]any)["status"] = status //nolint:forcetypeassert
+	changes := c.gitCommitChanges(status)
+	changeCounts := make(map[string]int)
+	for _, change := range changes {
+		changeCounts[change.Action]++
+	}
+	chezmoiTemplateData := templateDataMap["chezmoi"].(map[string]any) //nolint:forcetypeassert
+	chezmoiTemplateData["changeCounts"] = changeCounts
+	chezmoiTemplateData["changes"] = changes
+	chezmoiTemplateData["status"] = status
 	return commitMessageTmpl.Execute(templateDataMap)
 }
 
+// gitCommitChanges returns the changes to targets in status.
+func (c *Config) gitCommitChanges(status *git.Status) []gitCommitChange {
+	newGitCommitChange := func(action, sourcePath string) gitCommitChange {
+		targetRelPath := chezmoi.NewSourceRelPath(sourcePath).TargetRelPath(c.encryption.EncryptedSuffix())
+		return gitCommitChange{
+			Action:     action,
+			SourcePath: sourcePath,
+			TargetPath: targetRelPath.String(),
+		}
+	}
+	var changes []gitCommitChange
+	for _, ordinary := range status.Ordinary {
+		if ordinary.Y != '.' {
+			continue
+		}
+		switch ordinary.X {
+		case 'A':
+			changes = append(changes, newGitCommitChange("add", ordinary.Path))
+		case 'D':
+			changes = append(changes, newGitCommitChange("remove", ordinary.Path))
+		case 'M':
+			changes = append(changes, newGitCommitChange("update", ordinary.Path))
+		}
+	}
+	for _, renamedOrCopied := range status.RenamedOrCopied {
+		if renamedOrCopied.X == 'R' && renamedOrCopied.Y == '.' {
+			changes = append(changes, newGitCommitChange("chattr", renamedOrCopied.Path))
+		}
+	}
+	return changes
+}
+
 // makeRunEWithSourceState returns a function for
 // github.com/spf13/cobra.Command.RunE that includes reading the source state.
 func (c *Config) makeRunEWithSourceState(
@@ -1555,10 +2034,14 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 	persistentFlags.Var(&c.CacheDirAbsPath, "cache", "Set cache directory")
 	persistentFlags.Var(&c.Color, "color", "Colorize output")
 	persistentFlags.VarP(&c.DestDirAbsPath, "destination", "D", "Set destination directory")
+	persistentFlags.Var(&c.Log.File, "log-file", "Write log output to file")
+	persistentFlags.Var(&c.Log.Format, "log-format", "Set log format")
+	persistentFlags.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Set log level")
 	persistentFlags.Var(&c.Mode, "mode", "Mode")
 	persistentFlags.Var(&c.PersistentStateAbsPath, "persistent-state", "Set persistent state file")
 	persistentFlags.Var(&c.Progress, "progress", "Display progress bars")
 	persistentFlags.BoolVar(&c.Safe, "safe", c.Safe, "Safely replace files and symlinks")
+	persistentFlags.Var(&c.SecretFixtures, "secret-fixtures", "Resolve secret template functions from file")
 	persistentFlags.VarP(&c.SourceDirAbsPath, "source", "S", "Set source directory")
 	persistentFlags.Var(&c.UseBuiltinAge, "use-builtin-age", "Use builtin age")
 	persistentFlags.Var(&c.UseBuiltinGit, "use-builtin-git", "Use builtin git")
@@ -1570,26 +2053,35 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 	persistentFlags.Var(&c.cpuProfile, "cpu-profile", "Write a CPU profile to path")
 	persistentFlags.BoolVar(&c.debug, "debug", c.debug, "Include debug information in output")
 	persistentFlags.BoolVarP(&c.dryRun, "dry-run", "n", c.dryRun, "Do not make any modifications to the destination directory")
+	persistentFlags.Var(&c.events, "events", "Write progress events to stderr in format")
 	persistentFlags.BoolVar(&c.force, "force", c.force, "Make all changes without prompting")
+	persistentFlags.Var(&c.frozenTime, "frozen-time", "Use time instead of the current time in templates")
 	persistentFlags.BoolVar(&c.interactive, "interactive", c.interactive, "Prompt for all changes")
 	persistentFlags.BoolVarP(&c.keepGoing, "keep-going", "k", c.keepGoing, "Keep going as far as possible after an error")
 	persistentFlags.BoolVar(&c.noPager, "no-pager", c.noPager, "Do not use the pager")
 	persistentFlags.BoolVar(&c.noTTY, "no-tty", c.noTTY, "Do not attempt to get a TTY for prompts")
+	persistentFlags.BoolVar(&c.nonInteractive, "non-interactive", c.nonInteractive, "Never prompt, resolve conflicts with the configured policy")
 	persistentFlags.VarP(&c.outputAbsPath, "output", "o", "Write output to path instead of stdout")
 	persistentFlags.VarP(&c.refreshExternals, "refresh-externals", "R", "Refresh external cache")
 	persistentFlags.Lookup("refresh-externals").NoOptDefVal = chezmoi.RefreshExternalsAlways.String()
 	persistentFlags.BoolVar(&c.sourcePath, "source-path", c.sourcePath, "Specify targets by source path")
+	persistentFlags.BoolVar(&c.traceTemplates, "trace-templates", c.traceTemplates, "Log every template action evaluated")
 
 	if err := chezmoierrors.Combine(
 		rootCmd.MarkPersistentFlagFilename("config"),
 		rootCmd.MarkPersistentFlagFilename("cpu-profile"),
 		persistentFlags.MarkHidden("cpu-profile"),
 		rootCmd.MarkPersistentFlagDirname("destination"),
+		rootCmd.MarkPersistentFlagFilename("log-file"),
 		rootCmd.MarkPersistentFlagFilename("output"),
 		persistentFlags.MarkHidden("safe"),
+		rootCmd.MarkPersistentFlagFilename("secret-fixtures"),
 		rootCmd.MarkPersistentFlagDirname("source"),
 		rootCmd.RegisterFlagCompletionFunc("color", autoBoolFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("config-format", readDataFormatFlagCompletionFunc),
+		rootCmd.RegisterFlagCompletionFunc("events", eventsFormatFlagCompletionFunc),
+		rootCmd.RegisterFlagCompletionFunc("log-format", logFormatFlagCompletionFunc),
+		rootCmd.RegisterFlagCompletionFunc("log-level", logLevelFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("mode", chezmoi.ModeFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("refresh-externals", chezmoi.RefreshExternalsFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("use-builtin-age", autoBoolFlagCompletionFunc),
@@ -1600,29 +2092,43 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 
 	rootCmd.SetHelpCommand(c.newHelpCmd())
 	for _, cmd := range []*cobra.Command{
+		c.newActivateCmd(),
 		c.newAddCmd(),
 		c.newAgeCmd(),
 		c.newApplyCmd(),
 		c.newArchiveCmd(),
+		c.newAuditCmd(),
+		c.newBundleCmd(),
 		c.newCatCmd(),
 		c.newCatConfigCmd(),
 		c.newCDCmd(),
 		c.newChattrCmd(),
+		c.newCICmd(),
+		c.newCommitCmd(),
 		c.newCompletionCmd(),
+		c.newCompletionHelperCmd(),
+		c.newDaemonCmd(),
 		c.newDataCmd(),
 		c.newDecryptCommand(),
 		c.newDiffCmd(),
+		c.newDisableCmd(),
 		c.newDoctorCmd(),
 		c.newDumpCmd(),
 		c.newDumpConfigCmd(),
 		c.newEditCmd(),
 		c.newEditConfigCmd(),
 		c.newEditConfigTemplateCmd(),
+		c.newEnableCmd(),
 		c.newEncryptCommand(),
 		c.newExecuteTemplateCmd(),
+		c.newExplainCmd(),
+		c.newExportCmd(),
+		c.newExternalsCmd(),
 		c.newForgetCmd(),
 		c.newGenerateCmd(),
 		c.newGitCmd(),
+		c.newHistoryCmd(),
+		c.newIdentityCmd(),
 		c.newIgnoredCmd(),
 		c.newImportCmd(),
 		c.newInitCmd(),
@@ -1632,14 +2138,21 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newManagedCmd(),
 		c.newMergeCmd(),
 		c.newMergeAllCmd(),
+		c.newModuleCmd(),
 		c.newPurgeCmd(),
 		c.newReAddCmd(),
 		c.newRemoveCmd(),
+		c.newRestoreCmd(),
+		c.newRollbackCmd(),
+		c.newScriptsCmd(),
 		c.newSecretCmd(),
 		c.newSourcePathCmd(),
+		c.newSSHKeyCmd(),
 		c.newStateCmd(),
 		c.newStatusCmd(),
+		c.newSupportBundleCmd(),
 		c.newTargetPathCmd(),
+		c.newTestCmd(),
 		c.newUnmanagedCmd(),
 		c.newUpdateCmd(),
 		c.newUpgradeCmd(),
@@ -1656,23 +2169,32 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 
 // newDiffSystem returns a system that logs all changes to s to w using
 // diff.command if set or the builtin git diff otherwise.
-func (c *Config) newDiffSystem(s chezmoi.System, w io.Writer, dirAbsPath chezmoi.AbsPath) chezmoi.System {
-	if c.Diff.useBuiltinDiff || c.Diff.Command == "" {
+func (c *Config) newDiffSystem(s chezmoi.System, w io.Writer, dirAbsPath chezmoi.AbsPath) (chezmoi.System, error) {
+	if c.builtinDiff() {
+		diffEncoderOptions, err := c.diffEncoderOptions()
+		if err != nil {
+			return nil, err
+		}
 		options := &chezmoi.GitDiffSystemOptions{
-			Color:          c.Color.Value(c.colorAutoFunc),
+			BinaryDiffFunc: c.binaryDiff,
+			Color:          diffEncoderOptions.Color,
 			Filter:         chezmoi.NewEntryTypeFilter(c.Diff.include.Bits(), c.Diff.Exclude.Bits()),
+			Format:         c.Diff.Format,
 			Reverse:        c.Diff.Reverse,
 			ScriptContents: c.Diff.ScriptContents,
 			TextConvFunc:   c.TextConv.convert,
+			Theme:          diffEncoderOptions.Theme,
+			Width:          diffEncoderOptions.Width,
 		}
-		return chezmoi.NewGitDiffSystem(s, w, dirAbsPath, options)
+		return chezmoi.NewGitDiffSystem(s, w, dirAbsPath, options), nil
 	}
 	options := &chezmoi.ExternalDiffSystemOptions{
 		Filter:         chezmoi.NewEntryTypeFilter(c.Diff.include.Bits(), c.Diff.Exclude.Bits()),
 		Reverse:        c.Diff.Reverse,
 		ScriptContents: c.Diff.ScriptContents,
+		PreRunFunc:     c.setTemplatedEnvironmentVariables,
 	}
-	return chezmoi.NewExternalDiffSystem(s, c.Diff.Command, c.Diff.Args, c.DestDirAbsPath, options)
+	return chezmoi.NewExternalDiffSystem(s, c.Diff.Command, c.Diff.Args, c.DestDirAbsPath, options), nil
 }
 
 // newSourceState returns a new SourceState with options.
@@ -1690,13 +2212,21 @@ func (c *Config) newSourceState(
 		return nil, err
 	}
 
-	sourceStateLogger := c.logger.With().Str(logComponentKey, logComponentValueSourceState).Logger()
-
 	c.SourceDirAbsPath, err = c.getSourceDirAbsPath(nil)
 	if err != nil {
 		return nil, err
 	}
 
+	sharedState, err := c.SharedState.newSharedPersistentState(httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	disabledModules, err := c.disabledModules()
+	if err != nil {
+		return nil, err
+	}
+
 	if err := c.runHookPre(readSourceStateHookName); err != nil {
 		return nil, err
 	}
@@ -1704,22 +2234,44 @@ func (c *Config) newSourceState(
 	sourceState := chezmoi.NewSourceState(append([]chezmoi.SourceStateOption{
 		chezmoi.WithBaseSystem(c.baseSystem),
 		chezmoi.WithCacheDir(c.CacheDirAbsPath),
+		chezmoi.WithDefaultModes(c.DefaultModes),
 		chezmoi.WithDefaultTemplateDataFunc(func() map[string]any {
 			return c.getTemplateDataMap(cmd)
 		}),
 		chezmoi.WithDestDir(c.DestDirAbsPath),
+		chezmoi.WithDisabledModules(disabledModules),
+		chezmoi.WithEJSONKey(c.Ejson.KeyDir, c.ejsonKey),
 		chezmoi.WithEncryption(c.encryption),
+		chezmoi.WithEventBus(c.eventBus),
+		chezmoi.WithExternalDownloadOptions(chezmoi.ExternalDownloadOptions{
+			Retries:        c.Externals.Retries,
+			RetryDelay:     c.Externals.RetryDelay,
+			BandwidthLimit: c.Externals.BandwidthLimit,
+		}),
 		chezmoi.WithHTTPClient(httpClient),
 		chezmoi.WithInterpreters(c.Interpreters),
-		chezmoi.WithLogger(&sourceStateLogger),
+		chezmoi.WithLayerSourceDirs(c.sourceLayerDirAbsPaths()),
+		chezmoi.WithLinkDir(c.LinkDirAbsPath),
+		chezmoi.WithLinkGenerations(c.linkGenerationsEnabled()),
+		chezmoi.WithLogger(c.componentLogger(logComponentValueSourceState)),
 		chezmoi.WithMode(c.Mode),
 		chezmoi.WithPriorityTemplateData(c.Data),
+		chezmoi.WithScriptLogOptions(chezmoi.ScriptLogOptions{
+			CaptureOutput: c.Scripts.CaptureOutput,
+			MaxEntries:    c.Scripts.MaxLogEntries,
+			MaxOutputSize: c.Scripts.MaxOutputSize,
+		}),
+		chezmoi.WithScriptPreRunFunc(c.setTemplatedEnvironmentVariables),
+		chezmoi.WithSharedPersistentState(sharedState),
 		chezmoi.WithSourceDir(c.SourceDirAbsPath),
 		chezmoi.WithSystem(c.sourceSystem),
 		chezmoi.WithTemplateFuncs(c.templateFuncs),
 		chezmoi.WithTemplateOptions(c.Template.Options),
 		chezmoi.WithUmask(c.Umask),
 		chezmoi.WithVersion(c.version),
+		chezmoi.WithWarnFunc(func(format string, args ...any) {
+			c.errorf("warning: "+format, args...)
+		}),
 	}, options...)...)
 
 	if err := sourceState.Read(ctx, &chezmoi.ReadOptions{
@@ -1744,6 +2296,12 @@ func (c *Config) persistentPostRunRootE(cmd *cobra.Command, args []string) error
 		return err
 	}
 
+	if c.closeLogWriter != nil {
+		defer func() {
+			_ = c.closeLogWriter()
+		}()
+	}
+
 	// Close any connection to keepassxc-cli.
 	if err := c.keepassxcClose(); err != nil {
 		return err
@@ -1788,18 +2346,18 @@ func (c *Config) persistentPostRunRootE(cmd *cobra.Command, args []string) error
 		var status *git.Status
 		if c.Git.AutoAdd || c.Git.AutoCommit || c.Git.AutoPush {
 			var err error
-			status, err = c.gitAutoAdd()
+			status, err = c.autoAdd()
 			if err != nil {
 				return err
 			}
 		}
 		if c.Git.AutoCommit || c.Git.AutoPush {
-			if err := c.gitAutoCommit(cmd, status); err != nil {
+			if err := c.autoCommit(cmd, status); err != nil {
 				return err
 			}
 		}
 		if c.Git.AutoPush {
-			if err := c.gitAutoPush(status); err != nil {
+			if err := c.autoPush(status); err != nil {
 				return err
 			}
 		}
@@ -1865,15 +2423,21 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	}
 
 	// Save flags that were set on the command line. Skip some types as
-	// spf13/pflag does not round trip them correctly.
+	// spf13/pflag does not round trip them correctly. Setting a slice flag
+	// appends to it, so save and restore slice flags as slices.
 	changedFlags := make(map[pflag.Value]string)
+	changedSliceFlags := make(map[pflag.SliceValue][]string)
 	brokenFlagTypes := map[string]bool{
 		"stringToInt":    true,
 		"stringToInt64":  true,
 		"stringToString": true,
 	}
 	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
-		if flag.Changed && !brokenFlagTypes[flag.Value.Type()] {
+		switch value, isSliceValue := flag.Value.(pflag.SliceValue); {
+		case !flag.Changed:
+		case isSliceValue:
+			changedSliceFlags[value] = value.GetSlice()
+		case !brokenFlagTypes[flag.Value.Type()]:
 			changedFlags[flag.Value] = flag.Value.String()
 		}
 	})
@@ -1898,44 +2462,130 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 			return err
 		}
 	}
+	for value, original := range changedSliceFlags {
+		if err := value.Replace(original); err != nil {
+			return err
+		}
+	}
 
 	if c.force && c.interactive {
 		return errors.New("the --force and --interactive flags are mutually exclusive")
 	}
+	if c.interactive && c.nonInteractive {
+		return errors.New("the --interactive and --non-interactive flags are mutually exclusive")
+	}
+	if err := c.Conflicts.validate(); err != nil {
+		return err
+	}
 
-	// Configure the logger.
-	log.Logger = log.Output(zerolog.NewConsoleWriter(
+	// Configure the logger. Template traces are logged independently of
+	// debug information.
+	consoleLogger := log.Output(zerolog.NewConsoleWriter(
 		func(w *zerolog.ConsoleWriter) {
 			w.Out = c.stderr
 			w.NoColor = !c.Color.Value(c.colorAutoFunc)
 			w.TimeFormat = time.RFC3339
 		},
 	))
-	if c.debug {
+	logLevel, err := c.logLevel()
+	if err != nil {
+		return fmt.Errorf("log.level: %w", err)
+	}
+	c.logComponentLevels, err = c.parseLogComponentLevels()
+	if err != nil {
+		return err
+	}
+	globalLogLevel := logLevel
+	for _, level := range c.logComponentLevels {
+		if level < globalLogLevel {
+			globalLogLevel = level
+		}
+	}
+	switch {
+	case globalLogLevel != zerolog.Disabled:
+		logWriter, closeLogWriter, err := c.newLogWriter()
+		if err != nil {
+			return err
+		}
+		c.closeLogWriter = closeLogWriter
+		zerolog.SetGlobalLevel(globalLogLevel)
+		log.Logger = zerolog.New(logWriter).Level(logLevel).With().Timestamp().Logger()
+	case c.traceTemplates:
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	} else {
+		log.Logger = consoleLogger.Level(zerolog.Disabled)
+	default:
 		zerolog.SetGlobalLevel(zerolog.Disabled)
+		log.Logger = consoleLogger
+	}
+	if c.traceTemplates && zerolog.GlobalLevel() > zerolog.InfoLevel {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 	c.logger = &log.Logger
 
+	// Set up the event bus. Events are only written if a format is set.
+	c.eventBus = chezmoi.NewEventBus()
+	eventHandler := newEventHandler(c.events, c.stderr)
+	if eventHandler != nil {
+		c.eventBus.Subscribe(eventHandler)
+	}
+	// Only write secrets from templates when applying, so that commands that
+	// only render templates, like cat and execute-template, and dry runs have
+	// no side effects.
+	c.writeSecrets = annotations.hasTag(writesSecrets) && !c.dryRun
+
+	if annotations.hasTag(modifiesDestinationDirectory) && !c.dryRun &&
+		(!c.Metrics.Textfile.Empty() || c.Metrics.StatsD != "") {
+		c.runMetrics = newRunMetrics(cmd)
+		c.eventBus.Subscribe(c.runMetrics)
+	}
+
+	if c.traceTemplates {
+		templateLogger := consoleLogger.With().Str(logComponentKey, logComponentValueTemplate).Logger()
+		templateTracer := chezmoi.NewTemplateTracer(&templateLogger, secretTemplateFuncNames)
+		c.templateFuncs[chezmoi.TraceTemplateFuncName] = templateTracer.Trace
+	}
+
 	// Log basic information.
 	c.logger.Info().
 		Object("version", c.versionInfo).
 		Strs("args", os.Args).
 		Str("goVersion", runtime.Version()).
 		Msg("persistentPreRunRootE")
+	var openPTYFunc chezmoi.OpenPTYFunc
+	if !c.noTTY {
+		openPTYFunc = openScriptPTY
+	}
 	realSystem := chezmoi.NewRealSystem(c.fileSystem,
+		chezmoi.RealSystemWithOpenPTYFunc(openPTYFunc),
 		chezmoi.RealSystemWithSafe(c.Safe),
 		chezmoi.RealSystemWithScriptTempDir(c.ScriptTempDir),
 	)
 	c.baseSystem = realSystem
-	if c.debug {
-		systemLogger := c.logger.With().Str(logComponentKey, logComponentValueSystem).Logger()
-		c.baseSystem = chezmoi.NewDebugSystem(c.baseSystem, &systemLogger)
+	if c.componentLogEnabled(logComponentValueSystem) {
+		c.baseSystem = chezmoi.NewDebugSystem(c.baseSystem, c.componentLogger(logComponentValueSystem))
+	}
+
+	if !c.SecretFixtures.Empty() {
+		if err := c.useSecretFixtures(); err != nil {
+			return err
+		}
+	}
+	if eventHandler != nil {
+		c.emitSecretFetchedEvents()
 	}
 
-	// Set up the persistent state.
-	switch persistentStateMode := annotations.persistentStateMode(); {
+	if err := c.setEncryption(); err != nil {
+		return err
+	}
+
+	// Set up the persistent state. One-shot mode leaves no persistent state
+	// behind. Auto-detected ephemeral environments keep their persistent state
+	// so that scripts are not re-run and changes are still detected.
+	persistentStateMode := annotations.persistentStateMode()
+	if c.init.oneShot {
+		persistentStateMode = persistentStateModeEmpty
+	}
+	switch {
 	case persistentStateMode == persistentStateModeEmpty:
 		c.persistentState = chezmoi.NewMockPersistentState()
 	case persistentStateMode == persistentStateModeReadOnly:
@@ -1946,7 +2596,7 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		c.persistentState, err = chezmoi.NewBoltPersistentState(
 			c.baseSystem,
 			persistentStateFileAbsPath,
-			chezmoi.BoltPersistentStateReadOnly,
+			chezmoi.BoltPersistentStateSnapshot,
 		)
 		if err != nil {
 			return err
@@ -1961,7 +2611,7 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		persistentState, err := chezmoi.NewBoltPersistentState(
 			c.baseSystem,
 			persistentStateFileAbsPath,
-			chezmoi.BoltPersistentStateReadOnly,
+			chezmoi.BoltPersistentStateSnapshot,
 		)
 		if err != nil {
 			return err
@@ -1983,6 +2633,14 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 			c.baseSystem,
 			persistentStateFileAbsPath,
 			chezmoi.BoltPersistentStateReadWrite,
+			chezmoi.WithBoltLockTimeout(c.PersistentStateTimeout),
+			chezmoi.WithBoltWaitFunc(func(pid int) {
+				if pid == 0 {
+					c.errorf("waiting for another process to release %s\n", persistentStateFileAbsPath)
+				} else {
+					c.errorf("waiting for chezmoi process %d to release %s\n", pid, persistentStateFileAbsPath)
+				}
+			}),
 		)
 		if err != nil {
 			return err
@@ -1990,11 +2648,17 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	default:
 		c.persistentState = chezmoi.NullPersistentState{}
 	}
-	if c.debug && c.persistentState != nil {
-		persistentStateLogger := c.logger.With().
-			Str(logComponentKey, logComponentValuePersistentState).
-			Logger()
-		c.persistentState = chezmoi.NewDebugPersistentState(c.persistentState, &persistentStateLogger)
+	if c.EncryptPersistentState {
+		switch persistentStateMode {
+		case persistentStateModeReadOnly, persistentStateModeReadMockWrite, persistentStateModeReadWrite:
+			c.persistentState = chezmoi.NewEncryptedPersistentState(c.persistentState, c.encryption)
+		}
+	}
+	if c.componentLogEnabled(logComponentValuePersistentState) && c.persistentState != nil {
+		c.persistentState = chezmoi.NewDebugPersistentState(
+			c.persistentState,
+			c.componentLogger(logComponentValuePersistentState),
+		)
 	}
 
 	// Set up the source and destination systems.
@@ -2006,6 +2670,24 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	if !annotations.hasTag(modifiesSourceDirectory) {
 		c.sourceSystem = chezmoi.NewReadOnlySystem(c.sourceSystem)
 	}
+	// Only move removed entries to the trash if they can be recorded in the
+	// persistent state.
+	if c.Trash.Enabled && annotations.hasTag(modifiesDestinationDirectory) &&
+		persistentStateMode == persistentStateModeReadWrite && !c.dryRun {
+		trashDirAbsPath, err := c.trashDir()
+		if err != nil {
+			return err
+		}
+		c.destSystem = chezmoi.NewTrashSystem(c.destSystem, c.persistentState, trashDirAbsPath)
+	}
+	if auditLog := c.newAuditLog(cmd); auditLog != nil && !c.dryRun && !annotations.hasTag(dryRun) {
+		if annotations.hasTag(modifiesDestinationDirectory) {
+			c.destSystem = chezmoi.NewAuditSystem(c.destSystem, auditLog)
+		}
+		if annotations.hasTag(modifiesSourceDirectory) {
+			c.sourceSystem = chezmoi.NewAuditSystem(c.sourceSystem, auditLog)
+		}
+	}
 	if c.dryRun || annotations.hasTag(dryRun) {
 		c.sourceSystem = chezmoi.NewDryRunSystem(c.sourceSystem)
 		c.destSystem = chezmoi.NewDryRunSystem(c.destSystem)
@@ -2033,12 +2715,12 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 			c.diffPagerCmd = pagerCmd
 			c.diffPagerCmdStdin = lazyWriter
 		}
-		c.sourceSystem = c.newDiffSystem(c.sourceSystem, writer, c.SourceDirAbsPath)
-		c.destSystem = c.newDiffSystem(c.destSystem, writer, c.DestDirAbsPath)
-	}
-
-	if err := c.setEncryption(); err != nil {
-		return err
+		if c.sourceSystem, err = c.newDiffSystem(c.sourceSystem, writer, c.SourceDirAbsPath); err != nil {
+			return err
+		}
+		if c.destSystem, err = c.newDiffSystem(c.destSystem, writer, c.DestDirAbsPath); err != nil {
+			return err
+		}
 	}
 
 	// Create the config directory if needed.
@@ -2084,11 +2766,15 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 
 	// Determine the working tree directory if it is not configured.
 	if c.WorkingTreeAbsPath.Empty() {
+		vcs, err := c.vcs()
+		if err != nil {
+			return err
+		}
 		workingTreeAbsPath := c.SourceDirAbsPath
 	FOR:
 		for {
-			gitDirAbsPath := workingTreeAbsPath.JoinString(gogit.GitDirName)
-			if _, err := c.baseSystem.Stat(gitDirAbsPath); err == nil {
+			vcsDirAbsPath := workingTreeAbsPath.JoinString(vcs.dirName())
+			if _, err := c.baseSystem.Stat(vcsDirAbsPath); err == nil {
 				c.WorkingTreeAbsPath = workingTreeAbsPath
 				break FOR
 			}
@@ -2150,7 +2836,7 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		}
 	}
 
-	if err := c.setEnvironmentVariables(); err != nil {
+	if err := c.setEnvironmentVariables(cmd); err != nil {
 		return err
 	}
 
@@ -2293,6 +2979,7 @@ func (c *Config) newTemplateData(cmd *cobra.Command) *templateData {
 		commandDir:        c.commandDirAbsPath,
 		config:            c.ConfigFile.toMap(),
 		configFile:        c.getConfigFileAbsPath(),
+		ephemeral:         c.isEphemeral(),
 		executable:        chezmoi.NewAbsPath(executable),
 		fqdnHostname:      fqdnHostname,
 		gid:               gid,
@@ -2300,11 +2987,13 @@ func (c *Config) newTemplateData(cmd *cobra.Command) *templateData {
 		homeDir:           c.homeDirAbsPath,
 		hostname:          hostname,
 		kernel:            kernel,
+		locale:            getLocaleData(),
 		os:                runtime.GOOS,
 		osRelease:         osRelease,
 		pathListSeparator: string(os.PathListSeparator),
 		pathSeparator:     string(os.PathSeparator),
 		sourceDir:         sourceDirAbsPath,
+		timezone:          c.getTimezoneData(),
 		uid:               uid,
 		username:          username,
 		version: map[string]any{
@@ -2350,23 +3039,61 @@ func (c *Config) run(dir chezmoi.AbsPath, name string, args []string) error {
 	return c.baseSystem.RunCmd(cmd)
 }
 
-// runEditor runs the configured editor with args.
-func (c *Config) runEditor(args []string) error {
+// runEditor runs the configured editors with args. names are the names used to
+// select the editor for each arg. If names is nil then args are used. Args that
+// select the same editor are edited with a single invocation of the editor.
+func (c *Config) runEditor(args, names []string) error {
 	if err := c.persistentState.Close(); err != nil {
 		return err
 	}
-	editor, editorArgs, err := c.editor(args)
-	if err != nil {
-		return err
+	if names == nil {
+		names = args
+	}
+
+	// Group args by editor, preserving the order of args.
+	type editorArgs struct {
+		editor *patternCommandConfig
+		args   []string
+	}
+	var editorsArgs []*editorArgs
+	if len(args) == 0 {
+		editorsArgs = append(editorsArgs, &editorArgs{})
+	}
+FOR:
+	for i, arg := range args {
+		editor, err := findPatternCommand(c.Edit.Editors, names[i])
+		if err != nil {
+			return fmt.Errorf("edit.editors: %w", err)
+		}
+		for _, ea := range editorsArgs {
+			if ea.editor == editor {
+				ea.args = append(ea.args, arg)
+				continue FOR
+			}
+		}
+		editorsArgs = append(editorsArgs, &editorArgs{
+			editor: editor,
+			args:   []string{arg},
+		})
 	}
-	start := time.Now()
-	err = c.run(chezmoi.EmptyAbsPath, editor, editorArgs)
-	if runtime.GOOS != "windows" && c.Edit.MinDuration != 0 {
-		if duration := time.Since(start); duration < c.Edit.MinDuration {
-			c.errorf("warning: %s: returned in less than %s\n", shellQuoteCommand(editor, editorArgs), c.Edit.MinDuration)
+
+	for _, ea := range editorsArgs {
+		editor, editorArgs, err := c.editorCommand(ea.editor, ea.args)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = c.run(chezmoi.EmptyAbsPath, editor, editorArgs)
+		if runtime.GOOS != "windows" && c.Edit.MinDuration != 0 {
+			if duration := time.Since(start); duration < c.Edit.MinDuration {
+				c.errorf("warning: %s: returned in less than %s\n", shellQuoteCommand(editor, editorArgs), c.Edit.MinDuration)
+			}
+		}
+		if err != nil {
+			return err
 		}
 	}
-	return err
+	return nil
 }
 
 // runHookPost runs the hook's post command, if it is set.
@@ -2375,6 +3102,9 @@ func (c *Config) runHookPost(hook string) error {
 	if command.Command == "" {
 		return nil
 	}
+	if err := c.setTemplatedEnvironmentVariables(); err != nil {
+		return err
+	}
 	return c.run(c.homeDirAbsPath, command.Command, command.Args)
 }
 
@@ -2384,6 +3114,9 @@ func (c *Config) runHookPre(hook string) error {
 	if command.Command == "" {
 		return nil
 	}
+	if err := c.setTemplatedEnvironmentVariables(); err != nil {
+		return err
+	}
 	return c.run(c.homeDirAbsPath, command.Command, command.Args)
 }
 
@@ -2415,31 +3148,59 @@ func (c *Config) setEncryption() error {
 		return fmt.Errorf("%s: unknown encryption", c.Encryption)
 	}
 
-	if c.debug {
-		encryptionLogger := c.logger.With().
-			Str(logComponentKey, logComponentValueEncryption).
-			Logger()
-		c.encryption = chezmoi.NewDebugEncryption(c.encryption, &encryptionLogger)
+	if c.componentLogEnabled(logComponentValueEncryption) {
+		c.encryption = chezmoi.NewDebugEncryption(c.encryption, c.componentLogger(logComponentValueEncryption))
 	}
 
 	return nil
 }
 
-// setEnvironmentVariables sets all environment variables defined in c.
-func (c *Config) setEnvironmentVariables() error {
-	var env map[string]string
-	switch {
-	case len(c.Env) != 0 && len(c.ScriptEnv) != 0:
+// setEnvironmentVariables sets all environment variables defined in c. If
+// envTemplate is set then values are templates, which are only executed once
+// they are needed, see setTemplatedEnvironmentVariables.
+func (c *Config) setEnvironmentVariables(cmd *cobra.Command) error {
+	if len(c.Env) != 0 && len(c.ScriptEnv) != 0 {
 		return errors.New("only one of env or scriptEnv may be set")
-	case len(c.Env) != 0:
-		env = c.Env
-	case len(c.ScriptEnv) != 0:
-		env = c.ScriptEnv
+	}
+	c.envTemplateDataFunc = func() map[string]any {
+		return c.getTemplateDataMap(cmd)
+	}
+	if c.EnvTemplate && !c.envTemplatesNeeded {
+		return nil
+	}
+	return c.setConfigEnvironmentVariables()
+}
+
+// setTemplatedEnvironmentVariables executes and sets templated environment
+// variables, if they have not already been set. It must be called before
+// chezmoi runs a script, hook, diff tool, or merge tool so that password
+// managers are only invoked when the environment variables are actually used.
+func (c *Config) setTemplatedEnvironmentVariables() error {
+	if !c.EnvTemplate || c.envTemplatesNeeded {
+		return nil
+	}
+	c.envTemplatesNeeded = true
+	return c.setConfigEnvironmentVariables()
+}
+
+// setConfigEnvironmentVariables sets the environment variables from the env
+// or scriptEnv configuration variables.
+func (c *Config) setConfigEnvironmentVariables() error {
+	configKey, env := "env", c.Env
+	if len(c.ScriptEnv) != 0 {
+		configKey, env = "scriptEnv", c.ScriptEnv
 	}
 	for key, value := range env {
 		if strings.HasPrefix(key, "CHEZMOI_") {
 			c.errorf("warning: %s: overriding reserved environment variable", key)
 		}
+		if c.EnvTemplate {
+			var err error
+			value, err = c.executeEnvTemplate(configKey+"."+key, value)
+			if err != nil {
+				return err
+			}
+		}
 		if err := os.Setenv(key, value); err != nil {
 			return err
 		}
@@ -2447,6 +3208,30 @@ func (c *Config) setEnvironmentVariables() error {
 	return nil
 }
 
+// executeEnvTemplate executes the environment variable template text named
+// name. Results are cached so that each template is only executed once.
+func (c *Config) executeEnvTemplate(name, text string) (string, error) {
+	if value, ok := c.envTemplateCache[text]; ok {
+		return value, nil
+	}
+	tmpl, err := chezmoi.ParseTemplate(name, []byte(text), c.templateFuncs, chezmoi.TemplateOptions{
+		Options: slices.Clone(c.Template.Options),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	valueBytes, err := tmpl.Execute(c.envTemplateDataFunc())
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	value := string(valueBytes)
+	if c.envTemplateCache == nil {
+		c.envTemplateCache = make(map[string]string)
+	}
+	c.envTemplateCache[text] = value
+	return value, nil
+}
+
 // sourceAbsPaths returns the source absolute paths for each target path in
 // args.
 func (c *Config) sourceAbsPaths(sourceState *chezmoi.SourceState, args []string) ([]chezmoi.AbsPath, error) {
@@ -2564,46 +3349,15 @@ func (c *Config) targetRelPathsBySourcePath(sourceState *chezmoi.SourceState, ar
 	return targetRelPaths, nil
 }
 
+// sourcePathValidArgs returns source path completions for toComplete given
+// args.
+func (c *Config) sourcePathValidArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return c.makeValidArgsFunc(c.sourcePathCompletions)(cmd, args, toComplete)
+}
+
 // targetValidArgs returns target completions for toComplete given args.
 func (c *Config) targetValidArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-	if !c.Completion.Custom {
-		return nil, cobra.ShellCompDirectiveDefault
-	}
-
-	toCompleteAbsPath, err := chezmoi.NewAbsPathFromExtPath(toComplete, c.homeDirAbsPath)
-	if err != nil {
-		cobra.CompErrorln(err.Error())
-		return nil, cobra.ShellCompDirectiveError
-	}
-
-	sourceState, err := c.getSourceState(cmd.Context(), cmd)
-	if err != nil {
-		cobra.CompErrorln(err.Error())
-		return nil, cobra.ShellCompDirectiveError
-	}
-
-	var completions []string
-	if err := sourceState.ForEach(func(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) error {
-		completion := c.DestDirAbsPath.Join(targetRelPath).String()
-		if _, ok := sourceStateEntry.(*chezmoi.SourceStateDir); ok {
-			completion += "/"
-		}
-		if strings.HasPrefix(completion, toCompleteAbsPath.String()) {
-			completions = append(completions, completion)
-		}
-		return nil
-	}); err != nil {
-		cobra.CompErrorln(err.Error())
-		return nil, cobra.ShellCompDirectiveError
-	}
-
-	if !filepath.IsAbs(toComplete) {
-		for i, completion := range completions {
-			completions[i] = strings.TrimPrefix(completion, c.commandDirAbsPath.String()+"/")
-		}
-	}
-
-	return completions, cobra.ShellCompDirectiveNoFileComp
+	return c.makeValidArgsFunc(c.targetCompletions)(cmd, args, toComplete)
 }
 
 // tempDir returns the temporary directory for the given key, creating it if
@@ -2666,8 +3420,19 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		Color: autoBool{
 			auto: true,
 		},
-		Interpreters: defaultInterpreters,
-		Pager:        os.Getenv("PAGER"),
+		Ephemeral: autoBool{
+			auto: true,
+		},
+		Interpreters:   defaultInterpreters,
+		LinkDirAbsPath: chezmoi.NewAbsPath(bds.DataHome).Join(linkDirRelPath),
+		Log: logConfig{
+			Tag: "chezmoi",
+		},
+		Metrics: metricsConfig{
+			Prefix: "chezmoi",
+		},
+		Pager:                  os.Getenv("PAGER"),
+		PersistentStateTimeout: time.Minute,
 		Progress: autoBool{
 			auto: true,
 		},
@@ -2675,6 +3440,9 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 			Options: pinEntryDefaultOptions,
 		},
 		Safe: true,
+		SharedState: sharedStateConfig{
+			LockTTL: defaultSharedStateLockTTL,
+		},
 		Template: templateConfig{
 			Options: chezmoi.DefaultTemplateOptions,
 		},
@@ -2706,7 +3474,9 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 			KeyDir: firstNonEmptyString(os.Getenv("EJSON_KEYDIR"), "/opt/ejson/keys"),
 		},
 		Gopass: gopassConfig{
-			Command: "gopass",
+			Command:        "gopass",
+			JSONAPICommand: "gopass-jsonapi",
+			Mode:           gopassModeCLI,
 		},
 		HCPVaultSecrets: hcpVaultSecretConfig{
 			Command: "vlt",
@@ -2722,6 +3492,9 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		Lastpass: lastpassConfig{
 			Command: "lpass",
 		},
+		Network: networkConfig{
+			Timeout: time.Second,
+		},
 		Onepassword: onepasswordConfig{
 			Command: "op",
 			Prompt:  true,
@@ -2733,6 +3506,9 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 			Command: "ph",
 			Prompt:  true,
 		},
+		ProtonPass: protonPassConfig{
+			Command: "pass-cli",
+		},
 		RBW: rbwConfig{
 			Command: "rbw",
 		},
@@ -2740,6 +3516,20 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 			Command: "vault",
 		},
 
+		// Version control system configurations.
+		Fossil: vcsConfig{
+			Command: "fossil",
+		},
+		Hg: vcsConfig{
+			Command: "hg",
+		},
+		JJ: vcsConfig{
+			Command: "jj",
+		},
+		SourceArchive: sourceArchiveConfig{
+			Checksum: true,
+		},
+
 		// Encryption configurations.
 		Age: defaultAgeEncryptionConfig,
 		GPG: defaultGPGEncryptionConfig,
@@ -2752,8 +3542,10 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		},
 		Diff: diffCmdConfig{
 			Exclude:        chezmoi.NewEntryTypeSet(chezmoi.EntryTypesNone),
+			Format:         chezmoi.DiffFormatUnified,
 			Pager:          defaultSentinel,
 			ScriptContents: true,
+			Theme:          chezmoi.DefaultDiffThemeName,
 			include:        chezmoi.NewEntryTypeSet(chezmoi.EntryTypesAll),
 		},
 		Edit: editCmdConfig{
@@ -2761,23 +3553,49 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 			MinDuration: 1 * time.Second,
 			filter:      chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 		},
+		Externals: externalsCmdConfig{
+			Retries:    3,
+			RetryDelay: 1 * time.Second,
+		},
 		Format: writeDataFormatJSON,
 		Git: gitCmdConfig{
 			Command: "git",
 		},
+		Gitea: forgeConfig{
+			BaseURL:       "https://gitea.com",
+			RefreshPeriod: 1 * time.Minute,
+		},
 		GitHub: gitHubConfig{
+			RateLimit:     gitHubRateLimitModeFail,
 			RefreshPeriod: 1 * time.Minute,
 		},
+		GitLab: forgeConfig{
+			BaseURL:       "https://gitlab.com",
+			RefreshPeriod: 1 * time.Minute,
+		},
+		History: historyCmdConfig{
+			MaxGenerations: 100,
+		},
 		Merge: mergeCmdConfig{
 			Command: "vimdiff",
 		},
+		Rollback: rollbackCmdConfig{
+			MaxSnapshots: 10,
+		},
+		Scripts: scriptsCmdConfig{
+			CaptureOutput: true,
+			MaxLogEntries: 100,
+			MaxOutputSize: 64 << 10,
+		},
 		Status: statusCmdConfig{
 			Exclude:   chezmoi.NewEntryTypeSet(chezmoi.EntryTypesNone),
 			PathStyle: chezmoi.PathStyleRelative.Copy(),
+			format:    writeDataFormatJSON,
 			include:   chezmoi.NewEntryTypeSet(chezmoi.EntryTypesAll),
 			recursive: true,
 		},
 		Update: updateCmdConfig{
+			Autostash:         true,
 			RecurseSubmodules: true,
 			apply:             true,
 			filter:            chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// A conflictPolicy determines how chezmoi resolves a conflict between a target
+// and an entry that has changed since chezmoi last wrote it.
+type conflictPolicy string
+
+const (
+	conflictPolicyNone      conflictPolicy = ""
+	conflictPolicyFail      conflictPolicy = "fail"
+	conflictPolicyOverwrite conflictPolicy = "overwrite"
+	conflictPolicySkip      conflictPolicy = "skip"
+)
+
+// A conflictRule sets the policy for targets matching a pattern.
+type conflictRule struct {
+	Pattern string         `json:"pattern" mapstructure:"pattern" yaml:"pattern"`
+	Policy  conflictPolicy `json:"policy"  mapstructure:"policy"  yaml:"policy"`
+}
+
+// A conflictsConfig declares how conflicts are resolved without prompting.
+type conflictsConfig struct {
+	Default conflictPolicy `json:"default" mapstructure:"default" yaml:"default"`
+	Rules   []conflictRule `json:"rules"   mapstructure:"rules"   yaml:"rules"`
+}
+
+// A conflictError is returned when a conflict is resolved with
+// conflictPolicyFail.
+type conflictError struct {
+	targetRelPath chezmoi.RelPath
+}
+
+func (e *conflictError) Error() string {
+	return e.targetRelPath.String() + " has changed since chezmoi last wrote it"
+}
+
+// A nonInteractiveError is returned when chezmoi would prompt for input in
+// non-interactive mode.
+type nonInteractiveError struct {
+	prompt string
+}
+
+func (e *nonInteractiveError) Error() string {
+	return fmt.Sprintf("%s: cannot prompt in non-interactive mode", e.prompt)
+}
+
+// validate returns an error if c contains an invalid pattern or policy.
+func (c *conflictsConfig) validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("conflicts.default: %w", err)
+	}
+	for i, rule := range c.Rules {
+		if !doublestar.ValidatePattern(rule.Pattern) {
+			return fmt.Errorf("conflicts.rules[%d]: %s: invalid pattern", i, rule.Pattern)
+		}
+		if rule.Policy == conflictPolicyNone {
+			return fmt.Errorf("conflicts.rules[%d]: missing policy", i)
+		}
+		if err := rule.Policy.validate(); err != nil {
+			return fmt.Errorf("conflicts.rules[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// policy returns the policy for targetRelPath. The policy of the first rule
+// whose pattern matches targetRelPath is returned. If no rule matches then the
+// default policy is returned if nonInteractive is true, otherwise
+// conflictPolicyNone is returned and the user should be prompted.
+func (c *conflictsConfig) policy(targetRelPath chezmoi.RelPath, nonInteractive bool) conflictPolicy {
+	for _, rule := range c.Rules {
+		if ok, _ := doublestar.Match(rule.Pattern, targetRelPath.String()); ok {
+			return rule.Policy
+		}
+	}
+	if !nonInteractive {
+		return conflictPolicyNone
+	}
+	if c.Default == conflictPolicyNone {
+		return conflictPolicyFail
+	}
+	return c.Default
+}
+
+// resolveConflict resolves the conflict for targetRelPath with policy. It
+// returns nil if the target should be overwritten and fs.SkipDir if it should
+// be skipped.
+func resolveConflict(targetRelPath chezmoi.RelPath, policy conflictPolicy) error {
+	switch policy {
+	case conflictPolicyOverwrite:
+		return nil
+	case conflictPolicySkip:
+		return fs.SkipDir
+	default:
+		return &conflictError{
+			targetRelPath: targetRelPath,
+		}
+	}
+}
+
+// validate returns an error if p is not a valid policy.
+func (p conflictPolicy) validate() error {
+	switch p {
+	case conflictPolicyNone, conflictPolicyFail, conflictPolicyOverwrite, conflictPolicySkip:
+		return nil
+	default:
+		return fmt.Errorf("%s: unknown conflict policy", string(p))
+	}
+}
@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// daemonQueryDialTimeout is how long chezmoi daemon query waits for the daemon
+// to start listening.
+const daemonQueryDialTimeout = 5 * time.Second
+
+var daemonSocketRelPath = chezmoi.NewRelPath("daemon.sock")
+
+type daemonCmdConfig struct {
+	socket chezmoi.AbsPath
+
+	// The following fields are only used by the daemon itself.
+	mutex        sync.Mutex
+	pathMappings []pathMapping
+	shutdown     func()
+}
+
+// A daemonRequest is a request to the daemon. Requests and responses are
+// encoded as JSON, one per line.
+type daemonRequest struct {
+	ID     any    `json:"id,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path,omitempty"`
+}
+
+// A daemonResponse is a response from the daemon.
+type daemonResponse struct {
+	ID     any    `json:"id,omitempty"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// A daemonRenderResult is the result of a render request.
+type daemonRenderResult struct {
+	Type     string `json:"type"`
+	Contents string `json:"contents"`
+}
+
+// A daemonStatusResult is the result of a status request.
+type daemonStatusResult struct {
+	Status string `json:"status"`
+}
+
+func (c *Config) newDaemonCmd() *cobra.Command {
+	daemonCmd := &cobra.Command{
+		Use:     "daemon",
+		Short:   "Answer queries about the source state over a unix socket",
+		Long:    mustLongHelp("daemon"),
+		Example: example("daemon"),
+		Args:    cobra.NoArgs,
+		RunE:    c.runDaemonCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+
+	persistentFlags := daemonCmd.PersistentFlags()
+	persistentFlags.Var(&c.daemon.socket, "socket", "Set socket path")
+
+	daemonQueryCmd := &cobra.Command{
+		Use:   "query method [path]",
+		Short: "Send a query to the daemon",
+		Args:  cobra.RangeArgs(1, 2),
+		ValidArgs: []string{
+			"ping",
+			"reload",
+			"render",
+			"shutdown",
+			"sourcePath",
+			"status",
+			"targetPath",
+		},
+		RunE: c.runDaemonQueryCmd,
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+			persistentStateModeEmpty,
+		),
+	}
+	daemonCmd.AddCommand(daemonQueryCmd)
+
+	return daemonCmd
+}
+
+func (c *Config) runDaemonCmd(cmd *cobra.Command, args []string) error {
+	socketAbsPath := c.daemonSocketAbsPath()
+	if err := chezmoi.MkdirAll(c.baseSystem, socketAbsPath.Dir(), 0o700); err != nil {
+		return err
+	}
+
+	// Remove any stale socket left by a previous daemon, but refuse to start
+	// if another daemon is still listening.
+	if conn, err := net.Dial("unix", socketAbsPath.String()); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: daemon already running", socketAbsPath)
+	}
+	if err := os.Remove(socketAbsPath.String()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", socketAbsPath.String())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketAbsPath.String())
+
+	ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	c.daemon.shutdown = cancel
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	watcher, err := c.newDaemonWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	go c.watchDaemonSourceDir(ctx, watcher)
+
+	// Parse the source state before accepting connections so that the first
+	// query is as fast as the rest. The watcher is already running, so hold
+	// the mutex.
+	c.daemon.mutex.Lock()
+	_, err = c.daemonPathMappings(cmd)
+	c.daemon.mutex.Unlock()
+	if err != nil {
+		c.errorf("warning: %v\n", err)
+	}
+
+	c.logger.Info().
+		Stringer("socket", socketAbsPath).
+		Msg("daemon")
+
+	for {
+		conn, err := listener.Accept()
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return err
+		}
+		go c.serveDaemonConn(cmd, conn)
+	}
+}
+
+func (c *Config) runDaemonQueryCmd(cmd *cobra.Command, args []string) error {
+	request := daemonRequest{
+		Method: args[0],
+	}
+	if len(args) > 1 {
+		request.Path = args[1]
+	}
+
+	socketAbsPath := c.daemonSocketAbsPath()
+	var conn net.Conn
+	deadline := time.Now().Add(daemonQueryDialTimeout)
+	for {
+		var err error
+		conn, err = net.Dial("unix", socketAbsPath.String())
+		if err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("%s: %w", socketAbsPath, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(&request); err != nil {
+		return err
+	}
+	var response daemonResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return c.marshal(writeDataFormatJSON, response.Result)
+}
+
+// daemonPathMappings returns the path mappings of all managed entries,
+// computing them if needed. The caller must hold c.daemon.mutex.
+func (c *Config) daemonPathMappings(cmd *cobra.Command) ([]pathMapping, error) {
+	if c.daemon.pathMappings != nil {
+		return c.daemon.pathMappings, nil
+	}
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+	c.daemon.pathMappings = c.allPathMappings(sourceState)
+	return c.daemon.pathMappings, nil
+}
+
+// daemonSocketAbsPath returns the path of the daemon's socket.
+func (c *Config) daemonSocketAbsPath() chezmoi.AbsPath {
+	if !c.daemon.socket.Empty() {
+		return c.daemon.socket
+	}
+	return c.CacheDirAbsPath.Join(daemonSocketRelPath)
+}
+
+// handleDaemonRequest returns the result of request.
+func (c *Config) handleDaemonRequest(cmd *cobra.Command, request *daemonRequest) (any, error) {
+	c.daemon.mutex.Lock()
+	defer c.daemon.mutex.Unlock()
+
+	switch request.Method {
+	case "ping":
+		return "pong", nil
+	case "reload":
+		c.resetDaemonSourceState()
+		if _, err := c.daemonPathMappings(cmd); err != nil {
+			return nil, err
+		}
+		return true, nil
+	case "shutdown":
+		// The daemon is shut down once the response has been written.
+		return true, nil
+	}
+
+	if request.Path == "" {
+		return nil, fmt.Errorf("%s: missing path", request.Method)
+	}
+	absPath, err := chezmoi.NewAbsPathFromExtPath(request.Path, c.homeDirAbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.Method {
+	case "sourcePath", "targetPath":
+		pathMappings, err := c.daemonPathMappings(cmd)
+		if err != nil {
+			return nil, err
+		}
+		for _, pathMapping := range pathMappings {
+			if request.Method == "sourcePath" && pathMapping.Target == absPath.String() ||
+				request.Method == "targetPath" && pathMapping.Source == absPath.String() {
+				return pathMapping, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: not managed", absPath)
+	case "render":
+		sourceStateEntry, targetRelPath, err := c.daemonSourceStateEntry(cmd, absPath)
+		if err != nil {
+			return nil, err
+		}
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(c.destSystem, c.DestDirAbsPath.Join(targetRelPath))
+		if err != nil {
+			return nil, err
+		}
+		contents, err := targetStateEntryContents(targetStateEntry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", absPath, err)
+		}
+		return &daemonRenderResult{
+			Type:     targetStateEntryType(targetStateEntry),
+			Contents: string(contents),
+		}, nil
+	case "status":
+		return c.daemonStatus(cmd, absPath)
+	default:
+		return nil, fmt.Errorf("%s: unknown method", request.Method)
+	}
+}
+
+// daemonSourceStateEntry returns the source state entry of the target at
+// absPath.
+func (c *Config) daemonSourceStateEntry(
+	cmd *cobra.Command, absPath chezmoi.AbsPath,
+) (chezmoi.SourceStateEntry, chezmoi.RelPath, error) {
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, chezmoi.EmptyRelPath, err
+	}
+	targetRelPath, err := c.targetRelPath(absPath)
+	if err != nil {
+		return nil, chezmoi.EmptyRelPath, err
+	}
+	sourceStateEntry := sourceState.Get(targetRelPath)
+	if sourceStateEntry == nil {
+		return nil, chezmoi.EmptyRelPath, fmt.Errorf("%s: not managed", absPath)
+	}
+	return sourceStateEntry, targetRelPath, nil
+}
+
+// daemonStatus returns the status of the target at absPath, in the same format
+// as chezmoi status.
+func (c *Config) daemonStatus(cmd *cobra.Command, absPath chezmoi.AbsPath) (*daemonStatusResult, error) {
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+	_, targetRelPath, err := c.daemonSourceStateEntry(cmd, absPath)
+	if err != nil {
+		return nil, err
+	}
+	persistentState, err := c.snapshotPersistentState()
+	if err != nil {
+		return nil, err
+	}
+
+	status := "  "
+	preApplyFunc := func(
+		targetRelPath chezmoi.RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+	) error {
+		if !targetEntryState.Equivalent(actualEntryState) {
+			status = string([]rune{
+				statusRune(lastWrittenEntryState, actualEntryState),
+				statusRune(actualEntryState, targetEntryState),
+			})
+		}
+		return fs.SkipDir
+	}
+	if err := sourceState.Apply(
+		chezmoi.NewDryRunSystem(c.destSystem), c.destSystem, persistentState, c.DestDirAbsPath, targetRelPath,
+		chezmoi.ApplyOptions{
+			Filter:       chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			PreApplyFunc: preApplyFunc,
+			Umask:        c.Umask,
+		},
+	); err != nil && !errors.Is(err, fs.SkipDir) {
+		return nil, err
+	}
+	return &daemonStatusResult{
+		Status: status,
+	}, nil
+}
+
+// newDaemonWatcher returns a new watcher that watches all directories in the
+// source directory.
+func (c *Config) newDaemonWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.watchDaemonDirs(watcher); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// resetDaemonSourceState discards the cached source state. The caller must
+// hold c.daemon.mutex.
+func (c *Config) resetDaemonSourceState() {
+	c.resetSourceState()
+	c.daemon.pathMappings = nil
+}
+
+// snapshotPersistentState returns an in-memory copy of the persistent state so
+// that changes made by other chezmoi processes are taken into account without
+// the daemon holding a lock on the persistent state.
+func (c *Config) snapshotPersistentState() (chezmoi.PersistentState, error) {
+	persistentStateFileAbsPath, err := c.persistentStateFile()
+	if err != nil {
+		return nil, err
+	}
+	boltPersistentState, err := chezmoi.NewBoltPersistentState(
+		c.baseSystem,
+		persistentStateFileAbsPath,
+		chezmoi.BoltPersistentStateSnapshot,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer boltPersistentState.Close()
+	persistentState := chezmoi.NewMockPersistentState()
+	if err := boltPersistentState.CopyTo(persistentState); err != nil {
+		return nil, err
+	}
+	return persistentState, nil
+}
+
+// serveDaemonConn answers requests on conn until it is closed.
+func (c *Config) serveDaemonConn(cmd *cobra.Command, conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, 1<<20)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var request daemonRequest
+		var response daemonResponse
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			response.Error = err.Error()
+		} else {
+			start := time.Now()
+			result, err := c.handleDaemonRequest(cmd, &request)
+			c.logger.Info().
+				Str("method", request.Method).
+				Str("path", request.Path).
+				Err(err).
+				Dur("duration", time.Since(start)).
+				Msg("daemonRequest")
+			response.ID = request.ID
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = result
+			}
+		}
+		if err := encoder.Encode(&response); err != nil {
+			return
+		}
+		if request.Method == "shutdown" && response.Error == "" {
+			c.daemon.shutdown()
+			return
+		}
+	}
+}
+
+// watchDaemonDirs adds all directories in the source directory to watcher.
+func (c *Config) watchDaemonDirs(watcher *fsnotify.Watcher) error {
+	return chezmoi.Walk(c.sourceSystem, c.SourceDirAbsPath, func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case !fileInfo.IsDir():
+			return nil
+		case fileInfo.Name() == ".git":
+			return fs.SkipDir
+		}
+		rawAbsPath, err := c.baseSystem.RawPath(absPath)
+		if err != nil {
+			return err
+		}
+		return watcher.Add(rawAbsPath.String())
+	})
+}
+
+// watchDaemonSourceDir discards the cached source state whenever the source
+// directory changes, until ctx is done.
+func (c *Config) watchDaemonSourceDir(ctx context.Context, watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			c.logger.Debug().
+				Stringer("Op", event.Op).
+				Str("Name", event.Name).
+				Msg("watcher.Events")
+			c.daemon.mutex.Lock()
+			c.resetDaemonSourceState()
+			if event.Has(fsnotify.Create) {
+				if err := c.watchDaemonDirs(watcher); err != nil {
+					c.logger.Error().
+						Err(err).
+						Msg("watchDaemonDirs")
+				}
+			}
+			c.daemon.mutex.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			c.logger.Error().
+				Err(err).
+				Msg("watcher.Errors")
+		}
+	}
+}
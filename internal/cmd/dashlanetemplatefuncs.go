@@ -65,9 +65,9 @@ func (c *Config) dashlaneOutput(args ...string) ([]byte, error) {
 	args = append(slices.Clone(c.Dashlane.Args), args...)
 	cmd := exec.Command(name, args...)
 	cmd.Stderr = os.Stderr
-	output, err := chezmoilog.LogCmdOutput(cmd)
+	output, err := chezmoilog.LogCmdOutputRedacted(cmd)
 	if err != nil {
-		return nil, err
+		return nil, newCmdOutputError(cmd, output, err)
 	}
 	return output, nil
 }
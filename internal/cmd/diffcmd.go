@@ -1,18 +1,35 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
 )
 
 type diffCmdConfig struct {
-	Command        string                `json:"command"        mapstructure:"command"        yaml:"command"`
-	Args           []string              `json:"args"           mapstructure:"args"           yaml:"args"`
-	Exclude        *chezmoi.EntryTypeSet `json:"exclude"        mapstructure:"exclude"        yaml:"exclude"`
-	Pager          string                `json:"pager"          mapstructure:"pager"          yaml:"pager"`
-	Reverse        bool                  `json:"reverse"        mapstructure:"reverse"        yaml:"reverse"`
-	ScriptContents bool                  `json:"scriptContents" mapstructure:"scriptContents" yaml:"scriptContents"`
+	Command        string                 `json:"command"        mapstructure:"command"        yaml:"command"`
+	Args           []string               `json:"args"           mapstructure:"args"           yaml:"args"`
+	BinaryTools    []patternCommandConfig `json:"binaryTools"    mapstructure:"binaryTools"    yaml:"binaryTools"`
+	Exclude        *chezmoi.EntryTypeSet  `json:"exclude"        mapstructure:"exclude"        yaml:"exclude"`
+	Format         chezmoi.DiffFormat     `json:"format"         mapstructure:"format"         yaml:"format"`
+	Pager          string                 `json:"pager"          mapstructure:"pager"          yaml:"pager"`
+	Reverse        bool                   `json:"reverse"        mapstructure:"reverse"        yaml:"reverse"`
+	ScriptContents bool                   `json:"scriptContents" mapstructure:"scriptContents" yaml:"scriptContents"`
+	Theme          string                 `json:"theme"          mapstructure:"theme"          yaml:"theme"`
+	generation     int
 	include        *chezmoi.EntryTypeSet
 	init           bool
 	recursive      bool
@@ -37,20 +54,32 @@ func (c *Config) newDiffCmd() *cobra.Command {
 
 	flags := diffCmd.Flags()
 	flags.VarP(c.Diff.Exclude, "exclude", "x", "Exclude entry types")
+	flags.Var(&c.Diff.Format, "format", "Set diff format")
+	flags.IntVar(&c.Diff.generation, "generation", c.Diff.generation, "Print the changes made by generation")
 	flags.VarP(c.Diff.include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.Diff.init, "init", c.Diff.init, "Recreate config file from template")
 	flags.StringVar(&c.Diff.Pager, "pager", c.Diff.Pager, "Set pager")
 	flags.BoolVarP(&c.Diff.recursive, "recursive", "r", c.Diff.recursive, "Recurse into subdirectories")
 	flags.BoolVar(&c.Diff.Reverse, "reverse", c.Diff.Reverse, "Reverse the direction of the diff")
 	flags.BoolVar(&c.Diff.ScriptContents, "script-contents", c.Diff.ScriptContents, "Show script contents")
+	flags.StringVar(&c.Diff.Theme, "theme", c.Diff.Theme, "Set diff color theme")
 	flags.BoolVarP(&c.Diff.useBuiltinDiff, "use-builtin-diff", "", c.Diff.useBuiltinDiff, "Use the builtin diff")
 
 	registerExcludeIncludeFlagCompletionFuncs(diffCmd)
+	if err := chezmoierrors.Combine(
+		diffCmd.RegisterFlagCompletionFunc("format", chezmoi.DiffFormatFlagCompletionFunc),
+		diffCmd.RegisterFlagCompletionFunc("theme", chezmoi.FlagCompletionFunc(chezmoi.DiffThemeNames())),
+	); err != nil {
+		panic(err)
+	}
 
 	return diffCmd
 }
 
 func (c *Config) runDiffCmd(cmd *cobra.Command, args []string) (err error) {
+	if cmd.Flags().Changed("generation") {
+		return c.diffGeneration(c.Diff.generation)
+	}
 	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
 		cmd:       cmd,
 		filter:    chezmoi.NewEntryTypeFilter(c.Diff.include.Bits(), c.Diff.Exclude.Bits()),
@@ -59,3 +88,188 @@ func (c *Config) runDiffCmd(cmd *cobra.Command, args []string) (err error) {
 		umask:     c.Umask,
 	})
 }
+
+// diffGeneration prints the changes made by the generation number.
+func (c *Config) diffGeneration(number int) error {
+	generation, err := c.generationArg(strconv.Itoa(number))
+	if err != nil {
+		return err
+	}
+	if !generation.contentsRecorded() {
+		return fmt.Errorf("generation %d: contents not recorded, set history.recordContents to record them", number)
+	}
+
+	var builder strings.Builder
+	diffEncoder, err := c.newDiffEncoder(&builder)
+	if err != nil {
+		return err
+	}
+	for _, generationEntry := range generation.Entries {
+		fromData, fromMode, fromOK := c.generationEntryStateData(&generationEntry.Before)
+		toData, toMode, toOK := c.generationEntryStateData(&generationEntry.After)
+		if !fromOK || !toOK {
+			fmt.Fprintf(&builder, "%c %s (contents not recorded)\n", generationEntry.statusChar(), generationEntry.Path)
+			continue
+		}
+		if c.Diff.Reverse {
+			fromData, fromMode, toData, toMode = toData, toMode, fromData, fromMode
+		}
+		diffPatch, err := chezmoi.DiffPatch(generationEntry.Path, fromData, fromMode, toData, toMode)
+		if err != nil {
+			return err
+		}
+		if err := chezmoi.AddBinaryDiffOutput(diffPatch, fromData, toData, c.binaryDiff); err != nil {
+			return err
+		}
+		if err := diffEncoder.Encode(diffPatch); err != nil {
+			return err
+		}
+	}
+	return c.pageDiffOutput(builder.String())
+}
+
+// binaryDiff returns the output of the first of diff.binaryTools whose
+// pattern matches binaryDiff's media type, or nil if there is no such tool.
+// Tools are only run if both the old and new files exist.
+func (c *Config) binaryDiff(
+	path chezmoi.RelPath,
+	binaryDiff *chezmoi.BinaryDiff,
+	fromData, toData []byte,
+) ([]byte, error) {
+	if binaryDiff.From == nil || binaryDiff.To == nil {
+		return nil, nil
+	}
+	mediaType, _, _ := strings.Cut(binaryDiff.MediaType(), ";")
+	tool, err := findPatternCommand(c.Diff.BinaryTools, mediaType)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("diff.binaryTools: %w", err)
+	case tool == nil:
+		return nil, nil
+	}
+
+	tempDirAbsPath, err := c.tempDir("chezmoi-diff")
+	if err != nil {
+		return nil, err
+	}
+	templateData := struct {
+		Destination string
+		Target      string
+	}{}
+	for _, file := range []struct {
+		dir        string
+		data       []byte
+		absPathPtr *string
+	}{
+		{dir: "a", data: fromData, absPathPtr: &templateData.Destination},
+		{dir: "b", data: toData, absPathPtr: &templateData.Target},
+	} {
+		dirAbsPath := tempDirAbsPath.JoinString(file.dir)
+		if err := chezmoi.MkdirAll(c.baseSystem, dirAbsPath, 0o700); err != nil {
+			return nil, err
+		}
+		absPath := dirAbsPath.JoinString(path.Base())
+		if err := c.baseSystem.WriteFile(absPath, file.data, 0o600); err != nil {
+			return nil, err
+		}
+		*file.absPathPtr = absPath.String()
+	}
+
+	args := make([]string, 0, len(tool.Args))
+	anyTemplateArgs := false
+	for i, arg := range tool.Args {
+		tmpl, err := template.New("diff.binaryTools.args[" + strconv.Itoa(i) + "]").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		builder := strings.Builder{}
+		if err := tmpl.Execute(&builder, templateData); err != nil {
+			return nil, err
+		}
+		args = append(args, builder.String())
+		if arg != builder.String() {
+			anyTemplateArgs = true
+		}
+	}
+	if !anyTemplateArgs {
+		args = append(args, templateData.Destination, templateData.Target)
+	}
+
+	cmd := exec.Command(tool.Command, args...) //nolint:gosec
+	cmd.Stderr = c.stderr
+	output, err := chezmoilog.LogCmdOutput(cmd)
+	// Diff tools traditionally exit with code 1 if the files differ.
+	if exitError := (&exec.ExitError{}); errors.As(err, &exitError) && exitError.ProcessState.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return output, nil
+}
+
+// builtinDiff returns whether the builtin diff should be used instead of
+// diff.command.
+func (c *Config) builtinDiff() bool {
+	if c.Diff.useBuiltinDiff || c.Diff.Command == "" {
+		return true
+	}
+	// Only the builtin diff can generate formats other than unified diffs.
+	return c.Diff.Format != "" && c.Diff.Format != chezmoi.DiffFormatUnified
+}
+
+// diffEncoderOptions returns the options for the builtin diff.
+func (c *Config) diffEncoderOptions() (*chezmoi.DiffEncoderOptions, error) {
+	themeName := c.Diff.Theme
+	if themeName == "" {
+		themeName = chezmoi.DefaultDiffThemeName
+	}
+	theme, ok := chezmoi.DiffThemes[themeName]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown diff theme", c.Diff.Theme)
+	}
+	var width int
+	if stdout, ok := c.stdout.(*os.File); ok {
+		if columns, _, err := term.GetSize(int(stdout.Fd())); err == nil {
+			width = columns
+		}
+	}
+	return &chezmoi.DiffEncoderOptions{
+		Color: c.Color.Value(c.colorAutoFunc),
+		Theme: theme,
+		Width: width,
+	}, nil
+}
+
+// newDiffEncoder returns a new chezmoi.DiffEncoder that writes diffs to w in
+// the configured format.
+func (c *Config) newDiffEncoder(w io.Writer) (chezmoi.DiffEncoder, error) {
+	options, err := c.diffEncoderOptions()
+	if err != nil {
+		return nil, err
+	}
+	return chezmoi.NewDiffEncoder(w, c.Diff.Format, options), nil
+}
+
+// generationEntryStateData returns the contents and mode of s for diffing, and
+// whether they are available.
+func (c *Config) generationEntryStateData(s *generationEntryState) ([]byte, fs.FileMode, bool) {
+	switch s.Type {
+	case chezmoi.EntryStateTypeDir:
+		return nil, fs.ModeDir | s.Mode.Perm(), true
+	case chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeSymlink:
+		if !s.ContentsRecorded {
+			return nil, 0, false
+		}
+		data, err := c.readObject(s.ContentsSHA256)
+		if err != nil {
+			return nil, 0, false
+		}
+		if s.Type == chezmoi.EntryStateTypeSymlink {
+			return data, fs.ModeSymlink, true
+		}
+		return data, s.Mode.Perm(), true
+	default:
+		return nil, 0, true
+	}
+}
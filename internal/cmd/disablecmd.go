@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// disabledTargetStateBucket is the bucket for recording the targets that are
+// disabled on this machine.
+var disabledTargetStateBucket = []byte("disabledTargetState")
+
+// A disabledTargetState records that a target is disabled.
+type disabledTargetState struct {
+	DisabledAt time.Time `json:"disabledAt" yaml:"disabledAt"`
+}
+
+func (c *Config) newDisableCmd() *cobra.Command {
+	disableCmd := &cobra.Command{
+		Use:               "disable [target]...",
+		Short:             "Stop applying targets on this machine",
+		Long:              mustLongHelp("disable"),
+		Example:           example("disable"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runDisableCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+		),
+	}
+
+	return disableCmd
+}
+
+func (c *Config) runDisableCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	if len(args) == 0 {
+		disabledTargets, err := c.disabledTargets()
+		if err != nil {
+			return err
+		}
+		builder := strings.Builder{}
+		for _, disabledRelPath := range disabledTargets.sorted() {
+			fmt.Fprintln(&builder, disabledRelPath)
+		}
+		return c.writeOutputString(builder.String())
+	}
+
+	targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+		mustBeManaged: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, targetRelPath := range targetRelPaths {
+		if err := chezmoi.PersistentStateSet(c.persistentState, disabledTargetStateBucket, []byte(targetRelPath.String()), &disabledTargetState{
+			DisabledAt: time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A disabledTargetSet is a set of disabled targets.
+type disabledTargetSet map[chezmoi.RelPath]struct{}
+
+// contains returns if targetRelPath or any of its parent directories is
+// disabled.
+func (d disabledTargetSet) contains(targetRelPath chezmoi.RelPath) bool {
+	for relPath := targetRelPath; relPath.String() != "."; relPath = relPath.Dir() {
+		if _, ok := d[relPath]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted returns the disabled targets in order.
+func (d disabledTargetSet) sorted() chezmoi.RelPaths {
+	relPaths := make(chezmoi.RelPaths, 0, len(d))
+	for relPath := range d {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Sort(relPaths)
+	return relPaths
+}
+
+// disabledTargets returns the targets that are disabled on this machine.
+func (c *Config) disabledTargets() (disabledTargetSet, error) {
+	disabledTargets := make(disabledTargetSet)
+	if err := c.persistentState.ForEach(disabledTargetStateBucket, func(k, v []byte) error {
+		disabledTargets[chezmoi.NewRelPath(string(k))] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return disabledTargets, nil
+}
@@ -169,7 +169,7 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 	shellCommand, _ := shell.CurrentUserShell()
 	shellCommand, shellArgs, _ := parseCommand(shellCommand, nil)
 	cdCommand, cdArgs, _ := c.cdCommand()
-	editCommand, editArgs, _ := c.editor(nil)
+	editCommand, editArgs, _ := c.editor("", nil)
 	checks := []check{
 		&versionCheck{
 			versionInfo: c.versionInfo,
@@ -208,7 +208,9 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 			name:    "dest-dir",
 			dirname: c.DestDirAbsPath,
 		},
-		umaskCheck{},
+		umaskCheck{
+			defaultModes: c.DefaultModes,
+		},
 		&binaryCheck{
 			name:       "cd-command",
 			binaryname: cdCommand,
@@ -385,6 +387,14 @@ func (c *Config) runDoctorCmd(cmd *cobra.Command, args []string) error {
 			versionRx:   regexp.MustCompile(`^(\d+\.\d+\.\d+)`),
 			minVersion:  &passholeMinVersion,
 		},
+		&binaryCheck{
+			name:        "protonpass-command",
+			binaryname:  c.ProtonPass.Command,
+			ifNotSet:    checkResultWarning,
+			ifNotExist:  checkResultInfo,
+			versionArgs: []string{"--version"},
+			versionRx:   regexp.MustCompile(`(\d+\.\d+\.\d+)`),
+		},
 		&binaryCheck{
 			name:        "rbw-command",
 			binaryname:  c.RBW.Command,
@@ -17,7 +17,7 @@ import (
 
 type (
 	systeminfoCheck struct{ skippedCheck }
-	umaskCheck      struct{}
+	umaskCheck      struct{ defaultModes chezmoi.DefaultModes }
 	unameCheck      struct{}
 )
 
@@ -25,14 +25,17 @@ func (umaskCheck) Name() string {
 	return "umask"
 }
 
-func (umaskCheck) Run(system chezmoi.System, homeDirAbsPath chezmoi.AbsPath) (checkResult, string) {
+func (c umaskCheck) Run(system chezmoi.System, homeDirAbsPath chezmoi.AbsPath) (checkResult, string) {
 	umask := unix.Umask(0)
 	unix.Umask(umask)
-	result := checkResultOK
-	if umask != 0o002 && umask != 0o022 {
-		result = checkResultWarning
+	switch {
+	case umask == 0o002 || umask == 0o022:
+		return checkResultOK, fmt.Sprintf("%03o", umask)
+	case c.defaultModes.Dir != 0 && c.defaultModes.Executable != 0 && c.defaultModes.File != 0:
+		return checkResultInfo, fmt.Sprintf("%03o, overridden by defaultModes", umask)
+	default:
+		return checkResultWarning, fmt.Sprintf("%03o, set defaultModes for consistent modes", umask)
 	}
-	return result, fmt.Sprintf("%03o", umask)
 }
 
 func (unameCheck) Name() string {
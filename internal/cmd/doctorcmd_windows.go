@@ -13,8 +13,11 @@ import (
 
 type (
 	systeminfoCheck struct{}
-	umaskCheck      struct{ skippedCheck }
-	unameCheck      struct{ skippedCheck }
+	umaskCheck      struct {
+		skippedCheck
+		defaultModes chezmoi.DefaultModes
+	}
+	unameCheck struct{ skippedCheck }
 )
 
 func (systeminfoCheck) Name() string {
@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/twpayne/chezmoi/v2/assets/schemas"
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
@@ -10,6 +11,7 @@ type dumpCmdConfig struct {
 	filter    *chezmoi.EntryTypeFilter
 	init      bool
 	recursive bool
+	schema    bool
 }
 
 func (c *Config) newDumpCmd() *cobra.Command {
@@ -32,6 +34,7 @@ func (c *Config) newDumpCmd() *cobra.Command {
 	flags.VarP(c.dump.filter.Include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.dump.init, "init", c.dump.init, "Recreate config file from template")
 	flags.BoolVarP(&c.dump.recursive, "recursive", "r", c.dump.recursive, "Recurse into subdirectories")
+	flags.BoolVar(&c.dump.schema, "schema", c.dump.schema, "Print the JSON schema of the output")
 	if err := dumpCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
 		panic(err)
 	}
@@ -42,6 +45,10 @@ func (c *Config) newDumpCmd() *cobra.Command {
 }
 
 func (c *Config) runDumpCmd(cmd *cobra.Command, args []string) error {
+	if c.dump.schema {
+		return c.writeOutputString(schemas.DumpV1SchemaJSON)
+	}
+
 	dumpSystem := chezmoi.NewDumpSystem()
 	if err := c.applyArgs(cmd.Context(), dumpSystem, chezmoi.EmptyAbsPath, args, applyArgsOptions{
 		cmd:       cmd,
@@ -1,24 +1,67 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/assets/schemas"
+)
+
+type dumpConfigCmdConfig struct {
+	schema bool
+}
 
 func (c *Config) newDumpConfigCmd() *cobra.Command {
 	dumpConfigCmd := &cobra.Command{
-		Use:         "dump-config",
-		Short:       "Dump the configuration values",
-		Long:        mustLongHelp("dump-config"),
-		Example:     example("dump-config"),
-		Args:        cobra.NoArgs,
-		RunE:        c.runDumpConfigCmd,
-		Annotations: newAnnotations(),
+		Use:               "dump-config [key]",
+		Short:             "Dump the configuration values",
+		Long:              mustLongHelp("dump-config"),
+		Example:           example("dump-config"),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: c.configKeyValidArgs,
+		RunE:              c.runDumpConfigCmd,
+		Annotations:       newAnnotations(),
 	}
 
 	flags := dumpConfigCmd.Flags()
 	flags.VarP(&c.Format, "format", "f", "Output format")
+	flags.BoolVar(&c.dumpConfig.schema, "schema", c.dumpConfig.schema, "Print the JSON schema of the output")
 
 	return dumpConfigCmd
 }
 
 func (c *Config) runDumpConfigCmd(cmd *cobra.Command, args []string) error {
-	return c.marshal(c.Format, c)
+	if c.dumpConfig.schema {
+		return c.writeOutputString(schemas.DumpConfigV1SchemaJSON)
+	}
+
+	if len(args) == 0 {
+		return c.marshal(c.Format, c)
+	}
+
+	configMap, err := c.configMap()
+	if err != nil {
+		return err
+	}
+	var value any = configMap
+	for _, component := range strings.Split(args[0], ".") {
+		valueMap, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: unknown config key", args[0])
+		}
+		if value, ok = valueMap[component]; !ok {
+			return fmt.Errorf("%s: unknown config key", args[0])
+		}
+	}
+	return c.marshal(c.Format, value)
+}
+
+// configKeyValidArgs returns config key completions for toComplete given args.
+func (c *Config) configKeyValidArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return c.makeValidArgsFunc(c.configKeyCompletions)(cmd, args, toComplete)
 }
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v4"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/assets/schemas"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+// TestDumpConfigSchema tests that the dump-config schema describes exactly the
+// keys in the output of dump-config, so that keys cannot be removed or added
+// without updating the schema.
+func TestDumpConfigSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(schemas.DumpConfigV1SchemaJSON), &schema))
+	schemaKeys := maps.Keys(schema.Properties)
+	slices.Sort(schemaKeys)
+
+	chezmoitest.WithTestFS(t, nil, func(fileSystem vfs.FS) {
+		config := newTestConfig(t, fileSystem)
+		configMap, err := config.configMap()
+		assert.NoError(t, err)
+		configKeys := maps.Keys(configMap)
+		slices.Sort(configKeys)
+		assert.Equal(t, schemaKeys, configKeys)
+	})
+}
+
+func TestDumpSchema(t *testing.T) {
+	var schema struct {
+		Defs map[string]any `json:"$defs"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(schemas.DumpV1SchemaJSON), &schema))
+	defs := maps.Keys(schema.Defs)
+	slices.Sort(defs)
+	assert.Equal(t, []string{"command", "dir", "file", "script", "symlink"}, defs)
+}
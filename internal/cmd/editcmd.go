@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -9,17 +13,20 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoimaps"
 )
 
 type editCmdConfig struct {
-	Command     string        `json:"command"     mapstructure:"command"     yaml:"command"`
-	Args        []string      `json:"args"        mapstructure:"args"        yaml:"args"`
-	Hardlink    bool          `json:"hardlink"    mapstructure:"hardlink"    yaml:"hardlink"`
-	MinDuration time.Duration `json:"minDuration" mapstructure:"minDuration" yaml:"minDuration"`
-	Watch       bool          `json:"watch"       mapstructure:"watch"       yaml:"watch"`
-	Apply       bool          `json:"apply"       mapstructure:"apply"       yaml:"apply"`
+	Command     string                 `json:"command"     mapstructure:"command"     yaml:"command"`
+	Args        []string               `json:"args"        mapstructure:"args"        yaml:"args"`
+	Editors     []patternCommandConfig `json:"editors"     mapstructure:"editors"     yaml:"editors"`
+	Hardlink    bool                   `json:"hardlink"    mapstructure:"hardlink"    yaml:"hardlink"`
+	MinDuration time.Duration          `json:"minDuration" mapstructure:"minDuration" yaml:"minDuration"`
+	Watch       bool                   `json:"watch"       mapstructure:"watch"       yaml:"watch"`
+	Apply       bool                   `json:"apply"       mapstructure:"apply"       yaml:"apply"`
 	filter      *chezmoi.EntryTypeFilter
 	init        bool
+	rendered    bool
 }
 
 func (c *Config) newEditCmd() *cobra.Command {
@@ -45,6 +52,7 @@ func (c *Config) newEditCmd() *cobra.Command {
 	flags.BoolVar(&c.Edit.Hardlink, "hardlink", c.Edit.Hardlink, "Invoke editor with a hardlink to the source file")
 	flags.VarP(c.Edit.filter.Include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.Edit.init, "init", c.Edit.init, "Recreate config file from template")
+	flags.BoolVar(&c.Edit.rendered, "rendered", c.Edit.rendered, "Edit the rendered targets of templates")
 	flags.BoolVar(&c.Edit.Watch, "watch", c.Edit.Watch, "Apply on save")
 
 	registerExcludeIncludeFlagCompletionFuncs(editCmd)
@@ -53,8 +61,12 @@ func (c *Config) newEditCmd() *cobra.Command {
 }
 
 func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
+	if c.Edit.rendered && c.Edit.Watch {
+		return errors.New("the --rendered and --watch flags are mutually exclusive")
+	}
+
 	if len(args) == 0 {
-		if err := c.runEditor([]string{c.WorkingTreeAbsPath.String()}); err != nil {
+		if err := c.runEditor([]string{c.WorkingTreeAbsPath.String()}, nil); err != nil {
 			return err
 		}
 		if c.Edit.Apply {
@@ -86,16 +98,68 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 	}
 
 	editorArgs := make([]string, 0, len(targetRelPaths))
+	editorNames := make([]string, 0, len(targetRelPaths))
 	type transparentlyDecryptedFile struct {
 		sourceAbsPath    chezmoi.AbsPath
 		decryptedAbsPath chezmoi.AbsPath
 	}
 	var transparentlyDecryptedFiles []transparentlyDecryptedFile
+	type hardlinkedFile struct {
+		sourceAbsPath   chezmoi.AbsPath
+		hardlinkAbsPath chezmoi.AbsPath
+	}
+	var hardlinkedFiles []hardlinkedFile
+	type renderedFile struct {
+		targetRelPath    chezmoi.RelPath
+		sourceAbsPath    chezmoi.AbsPath
+		renderedAbsPath  chezmoi.AbsPath
+		contents         []byte
+		encrypted        bool
+		renderedTemplate *chezmoi.RenderedTemplate
+	}
+	var renderedFiles []renderedFile
 TARGET_REL_PATH:
 	for _, targetRelPath := range targetRelPaths {
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
 		sourceRelPath := sourceStateEntry.SourceRelPath()
+		editorNames = append(editorNames, targetRelPath.String())
 		switch sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile); {
+		case ok && c.Edit.rendered && sourceStateFile.Attr.Template && sourceStateFile.Attr.Type != chezmoi.SourceFileTypeModify:
+			// Render the template to a temporary directory so that the
+			// changes to the rendered target can be back-propagated to the
+			// template when the editor exits.
+			contents, err := sourceStateFile.Contents()
+			if err != nil {
+				return err
+			}
+			renderedTemplate, err := sourceState.RenderTemplateData(chezmoi.ExecuteTemplateDataOptions{
+				Name:        sourceRelPath.String(),
+				Data:        contents,
+				Destination: c.DestDirAbsPath.Join(targetRelPath).String(),
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", targetRelPath, err)
+			}
+			tempDirAbsPath, err := c.tempDir("chezmoi-rendered")
+			if err != nil {
+				return err
+			}
+			renderedAbsPath := tempDirAbsPath.Join(targetRelPath)
+			if err := os.MkdirAll(renderedAbsPath.Dir().String(), 0o700); err != nil {
+				return err
+			}
+			if err := c.baseSystem.WriteFile(renderedAbsPath, renderedTemplate.Contents(), 0o600); err != nil {
+				return err
+			}
+			renderedFiles = append(renderedFiles, renderedFile{
+				targetRelPath:    targetRelPath,
+				sourceAbsPath:    c.SourceDirAbsPath.Join(sourceRelPath.RelPath()),
+				renderedAbsPath:  renderedAbsPath,
+				contents:         contents,
+				encrypted:        sourceStateFile.Attr.Encrypted,
+				renderedTemplate: renderedTemplate,
+			})
+			editorArgs = append(editorArgs, renderedAbsPath.String())
 		case ok && sourceStateFile.Attr.Encrypted:
 			// FIXME in the case that the file is an encrypted template then we
 			// should first decrypt the file to a temporary directory and
@@ -153,7 +217,12 @@ TARGET_REL_PATH:
 			if err := os.MkdirAll(hardlinkAbsPath.Dir().String(), 0o700); err != nil {
 				return err
 			}
-			if err := c.baseSystem.Link(c.SourceDirAbsPath.Join(sourceRelPath.RelPath()), hardlinkAbsPath); err == nil {
+			sourceAbsPath := c.SourceDirAbsPath.Join(sourceRelPath.RelPath())
+			if err := c.baseSystem.Link(sourceAbsPath, hardlinkAbsPath); err == nil {
+				hardlinkedFiles = append(hardlinkedFiles, hardlinkedFile{
+					sourceAbsPath:   sourceAbsPath,
+					hardlinkAbsPath: hardlinkAbsPath,
+				})
 				editorArgs = append(editorArgs, hardlinkAbsPath.String())
 				continue TARGET_REL_PATH
 			}
@@ -168,6 +237,64 @@ TARGET_REL_PATH:
 	}
 
 	postEditFunc := func() error {
+		// Back-propagate changes to rendered targets to their templates.
+		conflicts := false
+		for _, renderedFile := range renderedFiles {
+			edited, err := c.baseSystem.ReadFile(renderedFile.renderedAbsPath)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(edited, renderedFile.renderedTemplate.Contents()) {
+				continue
+			}
+			data, templateConflicts := renderedFile.renderedTemplate.BackPropagate(edited)
+			for _, templateConflict := range templateConflicts {
+				c.errorf(
+					"%s:%d: cannot back-propagate change to templated text: %q -> %q\n",
+					c.DestDirAbsPath.Join(renderedFile.targetRelPath),
+					templateConflict.Line,
+					templateConflict.Old,
+					templateConflict.New,
+				)
+				conflicts = true
+			}
+			if bytes.Equal(data, renderedFile.contents) {
+				continue
+			}
+			if renderedFile.encrypted {
+				data, err = c.encryption.Encrypt(data)
+				if err != nil {
+					return err
+				}
+			}
+			if err := c.baseSystem.WriteFile(renderedFile.sourceAbsPath, data, 0o666); err != nil {
+				return err
+			}
+		}
+
+		// Editors that save files by replacing them break hard links, in which
+		// case copy the edited file back to the source directory.
+		for _, hardlinkedFile := range hardlinkedFiles {
+			hardlinkFileInfo, err := c.baseSystem.Stat(hardlinkedFile.hardlinkAbsPath)
+			if err != nil {
+				return err
+			}
+			sourceFileInfo, err := c.baseSystem.Stat(hardlinkedFile.sourceAbsPath)
+			if err != nil {
+				return err
+			}
+			if os.SameFile(hardlinkFileInfo, sourceFileInfo) {
+				continue
+			}
+			contents, err := c.baseSystem.ReadFile(hardlinkedFile.hardlinkAbsPath)
+			if err != nil {
+				return err
+			}
+			if err := c.baseSystem.WriteFile(hardlinkedFile.sourceAbsPath, contents, 0o666); err != nil {
+				return err
+			}
+		}
+
 		for _, transparentlyDecryptedFile := range transparentlyDecryptedFiles {
 			contents, err := c.encryption.EncryptFile(transparentlyDecryptedFile.decryptedAbsPath)
 			if err != nil {
@@ -198,6 +325,9 @@ TARGET_REL_PATH:
 			}
 		}
 
+		if conflicts {
+			return chezmoi.ExitCodeError(1)
+		}
 		return nil
 	}
 
@@ -206,16 +336,26 @@ TARGET_REL_PATH:
 		if err != nil {
 			return err
 		}
-		defer watcher.Close()
 
+		// Watch the directories containing the edited files, rather than the
+		// files themselves, so that saves that replace the edited files are
+		// detected.
+		editedNames := make(map[string]struct{}, len(editorArgs))
+		editedDirNames := make(map[string]struct{})
 		for _, editorArg := range editorArgs {
-			// FIXME watch directories recursively
-			if err := watcher.Add(editorArg); err != nil {
+			editedNames[filepath.Clean(editorArg)] = struct{}{}
+			editedDirNames[filepath.Dir(editorArg)] = struct{}{}
+		}
+		for _, dirName := range chezmoimaps.SortedKeys(editedDirNames) {
+			if err := watcher.Add(dirName); err != nil {
+				watcher.Close()
 				return err
 			}
 		}
 
+		done := make(chan struct{})
 		go func() {
+			defer close(done)
 			for {
 				select {
 				case event, ok := <-watcher.Events:
@@ -226,10 +366,19 @@ TARGET_REL_PATH:
 						Stringer("Op", event.Op).
 						Str("Name", event.Name).
 						Msg("watcher.Events")
+					if _, ok := editedNames[filepath.Clean(event.Name)]; !ok {
+						continue
+					}
+					if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+						continue
+					}
 					err := postEditFunc()
 					c.logger.Err(err).
 						Msg("postEditFunc")
-				case _, ok := <-watcher.Errors:
+					if err != nil {
+						c.errorf("%s: %v\n", event.Name, err)
+					}
+				case err, ok := <-watcher.Errors:
 					if !ok {
 						return
 					}
@@ -239,9 +388,20 @@ TARGET_REL_PATH:
 				}
 			}
 		}()
+
+		// Stop watching once the editor exits, so that the final post edit
+		// function does not run concurrently with one triggered by the
+		// watcher.
+		err = c.runEditor(editorArgs, editorNames)
+		watcher.Close()
+		<-done
+		if err != nil {
+			return err
+		}
+		return postEditFunc()
 	}
 
-	if err := c.runEditor(editorArgs); err != nil {
+	if err := c.runEditor(editorArgs, editorNames); err != nil {
 		return err
 	}
 
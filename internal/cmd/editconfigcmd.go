@@ -24,5 +24,5 @@ func (c *Config) newEditConfigCmd() *cobra.Command {
 }
 
 func (c *Config) runEditConfigCmd(cmd *cobra.Command, args []string) error {
-	return c.runEditor([]string{c.getConfigFileAbsPath().String()})
+	return c.runEditor([]string{c.getConfigFileAbsPath().String()}, nil)
 }
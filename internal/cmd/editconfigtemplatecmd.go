@@ -52,5 +52,5 @@ func (c *Config) runEditConfigTemplateCmd(cmd *cobra.Command, args []string, sou
 			}
 		}
 	}
-	return c.runEditor([]string{configTemplateAbsPath.String()})
+	return c.runEditor([]string{configTemplateAbsPath.String()}, nil)
 }
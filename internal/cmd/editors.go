@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"golang.org/x/exp/slices"
+)
+
+// A patternCommandConfig is a command that is used for files whose names match
+// any of its patterns.
+type patternCommandConfig struct {
+	Patterns []string `json:"patterns" mapstructure:"patterns" yaml:"patterns"`
+	Command  string   `json:"command"  mapstructure:"command"  yaml:"command"`
+	Args     []string `json:"args"     mapstructure:"args"     yaml:"args"`
+}
+
+// editorBlockingArgs are the arguments that editors need to wait until the
+// edited files are closed before exiting, indexed by editor name.
+var editorBlockingArgs = map[string][]string{
+	"atom":          {"--wait", "-w"},
+	"code":          {"--wait", "-w"},
+	"code-insiders": {"--wait", "-w"},
+	"codium":        {"--wait", "-w"},
+	"gedit":         {"--wait", "-w"},
+	"gvim":          {"-f", "--nofork"},
+	"mate":          {"-w", "--wait"},
+	"mvim":          {"-f", "--nofork"},
+	"subl":          {"--wait", "-w"},
+	"zed":           {"--wait", "-w"},
+}
+
+// findPatternCommand returns the first command in commands with a pattern that
+// matches name, or nil if there is no such command. Patterns that do not
+// contain a slash match against the base name of name.
+func findPatternCommand(commands []patternCommandConfig, name string) (*patternCommandConfig, error) {
+	if name == "" {
+		return nil, nil
+	}
+	for i := range commands {
+		for _, pattern := range commands[i].Patterns {
+			matchName := filepath.ToSlash(name)
+			if !strings.Contains(pattern, "/") {
+				matchName = path.Base(matchName)
+			}
+			switch match, err := doublestar.Match(pattern, matchName); {
+			case err != nil:
+				return nil, fmt.Errorf("%s: %w", pattern, err)
+			case match:
+				return &commands[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// withBlockingArgs returns args with the arguments that command needs to block
+// until the edited files are closed, if command is a known editor that does
+// not block by default.
+func withBlockingArgs(command string, args []string) []string {
+	base := filepath.Base(command)
+	blockingArgs, ok := editorBlockingArgs[strings.TrimSuffix(base, filepath.Ext(base))]
+	if !ok {
+		return args
+	}
+	for _, arg := range args {
+		if slices.Contains(blockingArgs, arg) {
+			return args
+		}
+	}
+	return append([]string{blockingArgs[0]}, args...)
+}
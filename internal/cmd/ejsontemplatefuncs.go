@@ -2,13 +2,14 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/Shopify/ejson"
 )
 
 type ejsonConfig struct {
-	KeyDir string `json:"keyDir" mapstructure:"keyDir" yaml:"keyDir"`
-	Key    string `json:"key"    mapstructure:"key"    yaml:"key"`
+	KeyDir string       `json:"keyDir" mapstructure:"keyDir" yaml:"keyDir"`
+	Key    secretString `json:"key"    mapstructure:"key"    yaml:"key"`
 	cache  map[string]any
 }
 
@@ -36,5 +37,18 @@ func (c *Config) ejsonDecryptWithKeyTemplateFunc(filePath, key string) any {
 }
 
 func (c *Config) ejsonDecryptTemplateFunc(filePath string) any {
-	return c.ejsonDecryptWithKeyTemplateFunc(filePath, c.Ejson.Key)
+	key, err := c.ejsonKey()
+	if err != nil {
+		panic(err)
+	}
+	return c.ejsonDecryptWithKeyTemplateFunc(filePath, key)
+}
+
+// ejsonKey returns the configured ejson private key, if any.
+func (c *Config) ejsonKey() (string, error) {
+	key, err := c.secretStringValue(&c.Ejson.Key)
+	if err != nil {
+		return "", fmt.Errorf("ejson.key: %w", err)
+	}
+	return key, nil
 }
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+func (c *Config) newEnableCmd() *cobra.Command {
+	enableCmd := &cobra.Command{
+		Use:               "enable target...",
+		Short:             "Resume applying targets on this machine",
+		Long:              mustLongHelp("enable"),
+		Example:           example("enable"),
+		ValidArgsFunction: c.targetValidArgs,
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              c.makeRunEWithSourceState(c.runEnableCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+		),
+	}
+
+	return enableCmd
+}
+
+func (c *Config) runEnableCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	// Targets do not need to be managed, so that targets that were removed
+	// from the source state after they were disabled can still be enabled.
+	targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, targetRelPath := range targetRelPaths {
+		if err := c.persistentState.Delete(disabledTargetStateBucket, []byte(targetRelPath.String())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// An eventsFormat is the format in which events are written. It implements the
+// github.com/spf13/pflag.Value interface.
+type eventsFormat string
+
+const (
+	eventsFormatNone eventsFormat = ""
+	eventsFormatText eventsFormat = "text"
+	eventsFormatTTY  eventsFormat = "tty"
+	eventsFormatJSON eventsFormat = "json"
+)
+
+var eventsFormatFlagCompletionFunc = chezmoi.FlagCompletionFunc([]string{
+	string(eventsFormatText),
+	string(eventsFormatTTY),
+	string(eventsFormatJSON),
+})
+
+// Set implements github.com/spf13/pflag.Value.Set.
+func (f *eventsFormat) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "", "none":
+		*f = eventsFormatNone
+	case "text":
+		*f = eventsFormatText
+	case "tty":
+		*f = eventsFormatTTY
+	case "json":
+		*f = eventsFormatJSON
+	default:
+		return errors.New("invalid or unsupported events format")
+	}
+	return nil
+}
+
+// String implements github.com/spf13/pflag.Value.String.
+func (f eventsFormat) String() string {
+	return string(f)
+}
+
+// Type implements github.com/spf13/pflag.Value.Type.
+func (f eventsFormat) Type() string {
+	return "text|tty|json"
+}
+
+// newEventHandler returns a new chezmoi.EventHandler that writes events to w
+// in format, or nil if format is eventsFormatNone.
+func newEventHandler(format eventsFormat, w io.Writer) chezmoi.EventHandler {
+	switch format {
+	case eventsFormatText:
+		return &textEventHandler{
+			w: w,
+		}
+	case eventsFormatTTY:
+		return &ttyEventHandler{
+			textEventHandler: textEventHandler{
+				w: w,
+			},
+		}
+	case eventsFormatJSON:
+		return &jsonEventHandler{
+			encoder: json.NewEncoder(w),
+		}
+	default:
+		return nil
+	}
+}
+
+// A jsonEventHandler writes events as JSON lines, for consumption by other
+// tools.
+type jsonEventHandler struct {
+	encoder *json.Encoder
+}
+
+// HandleEvent implements chezmoi.EventHandler.HandleEvent.
+func (h *jsonEventHandler) HandleEvent(event *chezmoi.Event) {
+	_ = h.encoder.Encode(event)
+}
+
+// A textEventHandler writes events as plain text, one line per event. Download
+// progress events are ignored.
+type textEventHandler struct {
+	w io.Writer
+}
+
+// HandleEvent implements chezmoi.EventHandler.HandleEvent.
+func (h *textEventHandler) HandleEvent(event *chezmoi.Event) {
+	if line := formatEvent(event); line != "" {
+		fmt.Fprintln(h.w, line)
+	}
+}
+
+// A ttyEventHandler writes events as plain text, and displays download
+// progress on a single line that is overwritten as the download progresses.
+type ttyEventHandler struct {
+	textEventHandler
+	mutex        sync.Mutex
+	progressLine bool
+}
+
+// HandleEvent implements chezmoi.EventHandler.HandleEvent.
+func (h *ttyEventHandler) HandleEvent(event *chezmoi.Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.progressLine {
+		fmt.Fprint(h.w, "\r\x1b[K")
+		h.progressLine = false
+	}
+	if event.Type != chezmoi.EventTypeDownloadProgress {
+		h.textEventHandler.HandleEvent(event)
+		return
+	}
+	if event.TotalBytes > 0 {
+		fmt.Fprintf(h.w, "%s %d/%d bytes (%d%%)", event.Target, event.Bytes, event.TotalBytes, 100*event.Bytes/event.TotalBytes)
+	} else {
+		fmt.Fprintf(h.w, "%s %d bytes", event.Target, event.Bytes)
+	}
+	h.progressLine = true
+}
+
+// formatEvent returns event formatted as a single line of text, or the empty
+// string if event should not be displayed as text.
+func formatEvent(event *chezmoi.Event) string {
+	switch event.Type {
+	case chezmoi.EventTypeEntryApplied:
+		return "applied " + event.Target
+	case chezmoi.EventTypeEntryFailed:
+		return fmt.Sprintf("failed to apply %s: %s", event.Target, event.Error)
+	case chezmoi.EventTypeScriptStarted:
+		if event.Attempt > 1 {
+			return fmt.Sprintf("running %s (attempt %d)", event.Name, event.Attempt)
+		}
+		return "running " + event.Name
+	case chezmoi.EventTypeScriptFinished:
+		status := "ok"
+		if event.Error != "" {
+			status = "failed"
+		}
+		return fmt.Sprintf("ran %s %s (exit code %d, %s)", event.Name, status, event.ExitCode, time.Duration(event.Duration))
+	case chezmoi.EventTypeDownloadStarted:
+		return fmt.Sprintf("downloading %s from %s", event.Target, event.URL)
+	case chezmoi.EventTypeDownloadFinished:
+		return fmt.Sprintf("downloaded %s (%d bytes)", event.Target, event.Bytes)
+	case chezmoi.EventTypeSecretFetched:
+		return "fetched secret with " + event.Name
+	default:
+		return ""
+	}
+}
+
+// emitSecretFetchedEvents wraps c's secret template functions so that they
+// emit a chezmoi.EventTypeSecretFetched event each time they succeed. Only the
+// name of the template function is included in the event, never its arguments
+// or result.
+func (c *Config) emitSecretFetchedEvents() {
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for _, name := range secretTemplateFuncNames {
+		templateFunc, ok := c.templateFuncs[name]
+		if !ok {
+			continue
+		}
+		name := name
+		funcValue := reflect.ValueOf(templateFunc)
+		funcType := funcValue.Type()
+		c.templateFuncs[name] = reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+			var results []reflect.Value
+			if funcType.IsVariadic() {
+				results = funcValue.CallSlice(args)
+			} else {
+				results = funcValue.Call(args)
+			}
+			if n := len(results); n != 0 && funcType.Out(n-1) == errorType && !results[n-1].IsNil() {
+				return results
+			}
+			c.eventBus.Emit(&chezmoi.Event{
+				Type: chezmoi.EventTypeSecretFetched,
+				Name: name,
+			})
+			return results
+		}).Interface()
+	}
+}
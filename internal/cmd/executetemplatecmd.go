@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -18,6 +21,7 @@ type executeTemplateCmdConfig struct {
 	promptChoice    map[string]string
 	promptInt       map[string]int
 	promptString    map[string]string
+	repl            bool
 	stdinIsATTY     bool
 	templateOptions chezmoi.TemplateOptions
 	withStdin       bool
@@ -52,6 +56,7 @@ func (c *Config) newExecuteTemplateCmd() *cobra.Command {
 		c.executeTemplate.promptString,
 		"Simulate promptString",
 	)
+	flags.BoolVar(&c.executeTemplate.repl, "repl", c.executeTemplate.repl, "Start an interactive template prompt")
 	flags.BoolVar(&c.executeTemplate.stdinIsATTY, "stdinisatty", c.executeTemplate.stdinIsATTY, "Simulate stdinIsATTY")
 	flags.StringVar(
 		&c.executeTemplate.templateOptions.LeftDelimiter,
@@ -257,6 +262,13 @@ func (c *Config) runExecuteTemplateCmd(cmd *cobra.Command, args []string) error
 		chezmoi.RecursiveMerge(c.templateFuncs, initTemplateFuncs)
 	}
 
+	if c.executeTemplate.repl {
+		if len(args) != 0 {
+			return errors.New("--repl does not take any arguments")
+		}
+		return c.runExecuteTemplateREPL(sourceState)
+	}
+
 	if len(args) == 0 {
 		data, err := io.ReadAll(c.stdin)
 		if err != nil {
@@ -289,3 +301,97 @@ func (c *Config) runExecuteTemplateCmd(cmd *cobra.Command, args []string) error
 	}
 	return c.writeOutputString(output.String())
 }
+
+// replAssignmentRx matches template variable assignments entered in the
+// execute-template REPL.
+var replAssignmentRx = regexp.MustCompile(`^\$[A-Za-z_][A-Za-z0-9_]*\s*:?=`)
+
+// runExecuteTemplateREPL reads template expressions from stdin, one per line,
+// and prints their pretty-printed values. Variable assignments are remembered
+// and are available to later expressions.
+func (c *Config) runExecuteTemplateREPL(sourceState *chezmoi.SourceState) error {
+	leftDelimiter := c.executeTemplate.templateOptions.LeftDelimiter
+	if leftDelimiter == "" {
+		leftDelimiter = "{{"
+	}
+	rightDelimiter := c.executeTemplate.templateOptions.RightDelimiter
+	if rightDelimiter == "" {
+		rightDelimiter = "}}"
+	}
+	action := func(text string) string {
+		return leftDelimiter + " " + text + " " + rightDelimiter
+	}
+
+	interactive := c.stdinIsATTYInitTemplateFunc()
+	var assignments strings.Builder
+	var history []string
+	scanner := bufio.NewScanner(c.stdin)
+	for {
+		if interactive {
+			fmt.Fprint(c.stdout, "chezmoi> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+
+		// Handle REPL commands, including re-running lines from the history.
+		switch {
+		case line == "":
+			continue
+		case line == ":help":
+			fmt.Fprintf(c.stdout, "Enter a template expression to print its value, for example .chezmoi.os.\n"+
+				"Lines containing %s are executed as templates.\n"+
+				"Variable assignments, for example $x := 1, are available to later lines.\n"+
+				":history prints the history, !n re-runs line n, and :quit exits.\n", leftDelimiter)
+			continue
+		case line == ":history":
+			for i, historyLine := range history {
+				fmt.Fprintf(c.stdout, "%d %s\n", i+1, historyLine)
+			}
+			continue
+		case line == ":quit":
+			return nil
+		case strings.HasPrefix(line, "!"):
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(history) {
+				c.errorf("%s: invalid history reference\n", line)
+				continue
+			}
+			line = history[n-1]
+			fmt.Fprintln(c.stdout, line)
+		}
+		history = append(history, line)
+
+		var data string
+		isAssignment := replAssignmentRx.MatchString(line)
+		switch {
+		case isAssignment:
+			data = assignments.String() + action(line)
+		case strings.Contains(line, leftDelimiter):
+			data = assignments.String() + line
+		default:
+			data = assignments.String() + action("toYaml ("+line+")")
+		}
+		output, err := sourceState.ExecuteTemplateData(chezmoi.ExecuteTemplateDataOptions{
+			Name:            "repl",
+			Data:            []byte(data),
+			TemplateOptions: c.executeTemplate.templateOptions,
+		})
+		if err != nil {
+			c.errorf("%v\n", err)
+			continue
+		}
+		if isAssignment {
+			assignments.WriteString(action(line))
+			continue
+		}
+		if len(output) > 0 && output[len(output)-1] != '\n' {
+			output = append(output, '\n')
+		}
+		if _, err := c.stdout.Write(output); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
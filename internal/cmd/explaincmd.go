@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+type explainCmdConfig struct {
+	includes *[]string
+}
+
+// An explanation explains how chezmoi computes the target state of a single
+// target.
+type explanation struct {
+	Target        chezmoi.RelPath     `json:"target"                  yaml:"target"`
+	Ignored       bool                `json:"ignored"                 yaml:"ignored"`
+	IgnorePattern string              `json:"ignorePattern,omitempty" yaml:"ignorePattern,omitempty"`
+	Managed       bool                `json:"managed"                 yaml:"managed"`
+	Source        string              `json:"source,omitempty"        yaml:"source,omitempty"`
+	Type          string              `json:"type,omitempty"          yaml:"type,omitempty"`
+	Attributes    []string            `json:"attributes,omitempty"    yaml:"attributes,omitempty"`
+	Includes      []string            `json:"includes,omitempty"      yaml:"includes,omitempty"`
+	RemovePattern string              `json:"removePattern,omitempty" yaml:"removePattern,omitempty"`
+	RemovedBy     string              `json:"removedBy,omitempty"     yaml:"removedBy,omitempty"`
+	TargetState   *chezmoi.EntryState `json:"targetState,omitempty"   yaml:"targetState,omitempty"`
+}
+
+func (c *Config) newExplainCmd() *cobra.Command {
+	explainCmd := &cobra.Command{
+		Use:               "explain target...",
+		Short:             "Explain how the target state of targets is computed",
+		Long:              mustLongHelp("explain"),
+		Example:           example("explain"),
+		ValidArgsFunction: c.targetValidArgs,
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              c.makeRunEWithSourceState(c.runExplainCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+
+	flags := explainCmd.Flags()
+	flags.VarP(&c.Format, "format", "f", "Output format")
+	if err := explainCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+
+	return explainCmd
+}
+
+func (c *Config) runExplainCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	explanations := make([]*explanation, 0, len(args))
+	for _, arg := range args {
+		destAbsPath, err := chezmoi.NewAbsPathFromExtPath(filepath.Clean(arg), c.homeDirAbsPath)
+		if err != nil {
+			return err
+		}
+		targetRelPath, err := c.targetRelPath(destAbsPath)
+		if err != nil {
+			return err
+		}
+		explanation, err := c.explainTarget(sourceState, targetRelPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		explanations = append(explanations, explanation)
+	}
+	return c.marshal(c.Format, explanations)
+}
+
+// explainTarget returns the explanation of targetRelPath.
+func (c *Config) explainTarget(sourceState *chezmoi.SourceState, targetRelPath chezmoi.RelPath) (*explanation, error) {
+	explanation := &explanation{
+		Target:        targetRelPath,
+		Ignored:       sourceState.Ignore(targetRelPath),
+		RemovePattern: sourceState.RemovePattern(targetRelPath),
+	}
+	if explanation.Ignored {
+		explanation.IgnorePattern = sourceState.IgnorePattern(targetRelPath)
+	}
+
+	sourceStateEntry := sourceState.Get(targetRelPath)
+	if sourceStateEntry == nil {
+		return explanation, nil
+	}
+	explanation.Managed = true
+	explanation.Source = sourceStateEntry.Origin().OriginString()
+
+	switch sourceStateEntry := sourceStateEntry.(type) {
+	case *chezmoi.SourceStateDir:
+		explanation.Type = "dir"
+		explanation.Attributes = dirAttributes(sourceStateEntry.Attr)
+	case *chezmoi.SourceStateFile:
+		explanation.Type = sourceStateEntry.Attr.Type.String()
+		explanation.Attributes = fileAttributes(sourceStateEntry.Attr)
+	case *chezmoi.SourceStateImplicitDir:
+		explanation.Type = "dir"
+	case *chezmoi.SourceStateRemove:
+		explanation.Type = "remove"
+		if _, ok := sourceStateEntry.Origin().(chezmoi.SourceStateOriginRemovePatterns); ok {
+			explanation.Source = ""
+			explanation.RemovedBy = ".chezmoiremove"
+		} else {
+			explanation.RemovedBy = "exact directory"
+		}
+	}
+
+	// Record the templates included while the target state entry is
+	// evaluated.
+	includes := []string{}
+	c.explain.includes = &includes
+	defer func() {
+		c.explain.includes = nil
+	}()
+	targetStateEntry, err := sourceStateEntry.TargetStateEntry(c.destSystem, c.DestDirAbsPath.Join(targetRelPath))
+	if err != nil {
+		return nil, err
+	}
+	if err := targetStateEntry.Evaluate(); err != nil {
+		return nil, err
+	}
+	if len(includes) > 0 {
+		explanation.Includes = includes
+	}
+	explanation.TargetState, err = targetStateEntry.EntryState(c.Umask)
+	if err != nil {
+		return nil, err
+	}
+
+	return explanation, nil
+}
+
+// recordInclude records that the template filename was included, if an
+// explanation is being computed.
+func (c *Config) recordInclude(filename string) {
+	if c.explain.includes != nil {
+		*c.explain.includes = append(*c.explain.includes, filename)
+	}
+}
+
+// dirAttributes returns the names of the attributes set in dirAttr.
+func dirAttributes(dirAttr chezmoi.DirAttr) []string {
+	var attributes []string
+	for _, attribute := range []struct {
+		name string
+		set  bool
+	}{
+		{"exact", dirAttr.Exact},
+		{"external", dirAttr.External},
+		{"private", dirAttr.Private},
+		{"readonly", dirAttr.ReadOnly},
+		{"remove", dirAttr.Remove},
+	} {
+		if attribute.set {
+			attributes = append(attributes, attribute.name)
+		}
+	}
+	return attributes
+}
+
+// fileAttributes returns the names of the attributes set in fileAttr.
+func fileAttributes(fileAttr chezmoi.FileAttr) []string {
+	var attributes []string
+	for _, attribute := range []struct {
+		name string
+		set  bool
+	}{
+		{"empty", fileAttr.Empty},
+		{"encrypted", fileAttr.Encrypted},
+		{"executable", fileAttr.Executable},
+		{"private", fileAttr.Private},
+		{"readonly", fileAttr.ReadOnly},
+		{"template", fileAttr.Template},
+	} {
+		if attribute.set {
+			attributes = append(attributes, attribute.name)
+		}
+	}
+	if fileAttr.Condition != chezmoi.ScriptConditionNone && fileAttr.Condition != chezmoi.ScriptConditionAlways {
+		attributes = append(attributes, string(fileAttr.Condition))
+	}
+	return attributes
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// OCI image media types.
+const (
+	ociImageConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociImageIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociImageLayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociImageManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+)
+
+type exportCmdConfig struct {
+	filter    *chezmoi.EntryTypeFilter
+	format    string
+	gid       int
+	init      bool
+	recursive bool
+	uid       int
+}
+
+// An ociDescriptor describes an OCI blob.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int               `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// An ociImageConfig is an OCI image configuration.
+type ociImageConfig struct {
+	Architecture string         `json:"architecture"`
+	OS           string         `json:"os"`
+	Config       struct{}       `json:"config"`
+	RootFS       ociImageRootFS `json:"rootfs"`
+}
+
+// An ociImageRootFS is the root filesystem of an OCI image configuration.
+type ociImageRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// An ociImageManifest is an OCI image manifest.
+type ociImageManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// An ociImageIndex is an OCI image index.
+type ociImageIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+func (c *Config) newExportCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:               "export [target]...",
+		Short:             "Export the target state as a container image",
+		Long:              mustLongHelp("export"),
+		Example:           example("export"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runExportCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+
+	flags := exportCmd.Flags()
+	flags.VarP(c.export.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.StringVarP(&c.export.format, "format", "f", c.export.format, "Set export format")
+	flags.IntVar(&c.export.gid, "gid", c.export.gid, "Set group ID of entries")
+	flags.VarP(c.export.filter.Include, "include", "i", "Include entry types")
+	flags.BoolVar(&c.export.init, "init", c.export.init, "Recreate config file from template")
+	flags.BoolVarP(&c.export.recursive, "recursive", "r", c.export.recursive, "Recurse into subdirectories")
+	flags.IntVar(&c.export.uid, "uid", c.export.uid, "Set user ID of entries")
+
+	registerExcludeIncludeFlagCompletionFuncs(exportCmd)
+
+	return exportCmd
+}
+
+func (c *Config) runExportCmd(cmd *cobra.Command, args []string) error {
+	if c.export.format != "oci" {
+		return fmt.Errorf("%s: unknown export format", c.export.format)
+	}
+
+	// Write the target state to a tar archive, with paths relative to the
+	// root of the image.
+	headerTemplate := tarHeaderTemplate(c.now().UTC())
+	if c.export.uid != -1 {
+		headerTemplate.Uid = c.export.uid
+		headerTemplate.Uname = ""
+	}
+	if c.export.gid != -1 {
+		headerTemplate.Gid = c.export.gid
+		headerTemplate.Gname = ""
+	}
+	layer := strings.Builder{}
+	layerSystem := chezmoi.NewTarWriterSystem(&layer, headerTemplate)
+	layerDirAbsPath := chezmoi.NewAbsPath(strings.TrimPrefix(c.DestDirAbsPath.String(), "/"))
+	if err := layerSystem.Mkdir(layerDirAbsPath, 0o755); err != nil {
+		return err
+	}
+	if err := c.applyArgs(cmd.Context(), layerSystem, layerDirAbsPath, args, applyArgsOptions{
+		cmd:       cmd,
+		filter:    c.export.filter,
+		init:      c.export.init,
+		recursive: c.export.recursive,
+	}); err != nil {
+		return err
+	}
+	if err := layerSystem.Close(); err != nil {
+		return err
+	}
+
+	gzippedLayer := strings.Builder{}
+	gzipWriter := gzip.NewWriter(&gzippedLayer)
+	if _, err := gzipWriter.Write([]byte(layer.String())); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+
+	// Write the OCI image layout.
+	image := strings.Builder{}
+	imageSystem := chezmoi.NewTarWriterSystem(&image, tarHeaderTemplate(c.now().UTC()))
+	blobsAbsPath := chezmoi.NewAbsPath("blobs/sha256")
+	for _, absPath := range []chezmoi.AbsPath{blobsAbsPath.Dir(), blobsAbsPath} {
+		if err := imageSystem.Mkdir(absPath, fs.ModePerm); err != nil {
+			return err
+		}
+	}
+	writeBlob := func(mediaType string, data []byte) (ociDescriptor, error) {
+		sha256 := fmt.Sprintf("%x", chezmoi.SHA256Sum(data))
+		if err := imageSystem.WriteFile(blobsAbsPath.JoinString(sha256), data, 0o666); err != nil {
+			return ociDescriptor{}, err
+		}
+		return ociDescriptor{
+			MediaType: mediaType,
+			Digest:    "sha256:" + sha256,
+			Size:      len(data),
+		}, nil
+	}
+	writeJSONBlob := func(mediaType string, value any) (ociDescriptor, error) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+		return writeBlob(mediaType, data)
+	}
+
+	layerDescriptor, err := writeBlob(ociImageLayerMediaType, []byte(gzippedLayer.String()))
+	if err != nil {
+		return err
+	}
+	configDescriptor, err := writeJSONBlob(ociImageConfigMediaType, &ociImageConfig{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		RootFS: ociImageRootFS{
+			Type: "layers",
+			DiffIDs: []string{
+				fmt.Sprintf("sha256:%x", chezmoi.SHA256Sum([]byte(layer.String()))),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	manifestDescriptor, err := writeJSONBlob(ociImageManifestMediaType, &ociImageManifest{
+		SchemaVersion: 2,
+		MediaType:     ociImageManifestMediaType,
+		Config:        configDescriptor,
+		Layers:        []ociDescriptor{layerDescriptor},
+	})
+	if err != nil {
+		return err
+	}
+	indexData, err := json.Marshal(&ociImageIndex{
+		SchemaVersion: 2,
+		MediaType:     ociImageIndexMediaType,
+		Manifests:     []ociDescriptor{manifestDescriptor},
+	})
+	if err != nil {
+		return err
+	}
+	if err := imageSystem.WriteFile(chezmoi.NewAbsPath("index.json"), indexData, 0o666); err != nil {
+		return err
+	}
+	ociLayoutData := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err := imageSystem.WriteFile(chezmoi.NewAbsPath("oci-layout"), ociLayoutData, 0o666); err != nil {
+		return err
+	}
+	if err := imageSystem.Close(); err != nil {
+		return err
+	}
+
+	return c.writeOutputString(image.String())
+}
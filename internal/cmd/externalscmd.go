@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+type externalsCmdConfig struct {
+	BandwidthLimit int           `json:"bandwidthLimit" mapstructure:"bandwidthLimit" yaml:"bandwidthLimit"`
+	Retries        int           `json:"retries"        mapstructure:"retries"        yaml:"retries"`
+	RetryDelay     time.Duration `json:"retryDelay"     mapstructure:"retryDelay"     yaml:"retryDelay"`
+	status         externalsStatusCmdConfig
+}
+
+type externalsStatusCmdConfig struct {
+	format writeDataFormat
+}
+
+// An externalStatus is the status of an external's cache.
+type externalStatus struct {
+	Path          string               `json:"path"                    yaml:"path"`
+	Type          chezmoi.ExternalType `json:"type"                    yaml:"type"`
+	URL           string               `json:"url"                     yaml:"url"`
+	Cached        bool                 `json:"cached"                  yaml:"cached"`
+	LastRefreshed *time.Time           `json:"lastRefreshed,omitempty" yaml:"lastRefreshed,omitempty"`
+	Age           chezmoi.Duration     `json:"age,omitempty"           yaml:"age,omitempty"`
+	RefreshPeriod chezmoi.Duration     `json:"refreshPeriod"           yaml:"refreshPeriod"`
+	Pending       bool                 `json:"pending"                 yaml:"pending"`
+}
+
+func (c *Config) newExternalsCmd() *cobra.Command {
+	externalsCmd := &cobra.Command{
+		Use:     "externals",
+		Args:    cobra.NoArgs,
+		Short:   "Manage externals",
+		Long:    mustLongHelp("externals"),
+		Example: example("externals"),
+	}
+
+	externalsListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List externals",
+		Args:  cobra.NoArgs,
+		RunE:  c.runExternalsListCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	externalsCmd.AddCommand(externalsListCmd)
+
+	externalsPruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached data of externals that are no longer referenced",
+		Args:  cobra.NoArgs,
+		RunE:  c.runExternalsPruneCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	externalsCmd.AddCommand(externalsPruneCmd)
+
+	externalsStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the cache status of externals",
+		Args:  cobra.NoArgs,
+		RunE:  c.runExternalsStatusCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	externalsStatusFlags := externalsStatusCmd.Flags()
+	externalsStatusFlags.VarP(&c.Externals.status.format, "format", "f", "Output format")
+	if err := externalsStatusCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+	externalsCmd.AddCommand(externalsStatusCmd)
+
+	externalsUpdateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update the external lock file",
+		Args:  cobra.NoArgs,
+		RunE:  c.runExternalsUpdateCmd,
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+	externalsCmd.AddCommand(externalsUpdateCmd)
+
+	return externalsCmd
+}
+
+func (c *Config) runExternalsListCmd(cmd *cobra.Command, args []string) error {
+	sourceState, err := c.newSourceState(cmd.Context(), cmd, chezmoi.WithReadExternals(false))
+	if err != nil {
+		return err
+	}
+
+	externalRelPaths, _ := sourceState.Externals()
+	var builder strings.Builder
+	for _, externalRelPath := range externalRelPaths {
+		builder.WriteString(externalRelPath.String())
+		builder.WriteByte('\n')
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runExternalsPruneCmd(cmd *cobra.Command, args []string) error {
+	sourceState, err := c.newSourceState(cmd.Context(), cmd, chezmoi.WithReadExternals(false))
+	if err != nil {
+		return err
+	}
+
+	// The external cache is not in the destination directory, so remove
+	// entries from it with the base system.
+	var system chezmoi.System = c.baseSystem
+	if c.dryRun {
+		system = chezmoi.NewDryRunSystem(system)
+	}
+
+	externalCacheAbsPaths := sourceState.ExternalCacheAbsPaths()
+	externalCacheDirAbsPath := sourceState.ExternalCacheDirAbsPath()
+	dirEntries, err := system.ReadDir(externalCacheDirAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	for _, dirEntry := range dirEntries {
+		absPath := externalCacheDirAbsPath.JoinString(dirEntry.Name())
+		if _, ok := externalCacheAbsPaths[absPath]; ok {
+			continue
+		}
+		if c.Verbose {
+			fmt.Fprintln(c.stdout, absPath)
+		}
+		if err := system.RemoveAll(absPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) runExternalsStatusCmd(cmd *cobra.Command, args []string) error {
+	sourceState, err := c.newSourceState(cmd.Context(), cmd, chezmoi.WithReadExternals(false))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var externalStatuses []*externalStatus
+	externalRelPaths, externals := sourceState.Externals()
+	for _, externalRelPath := range externalRelPaths {
+		for _, external := range externals[externalRelPath] {
+			status := &externalStatus{
+				Path:          externalRelPath.String(),
+				Type:          external.Type,
+				URL:           external.URL,
+				RefreshPeriod: external.RefreshPeriod,
+			}
+			if external.Type != chezmoi.ExternalTypeGitRepo {
+				switch fileInfo, err := c.baseSystem.Stat(sourceState.ExternalCacheAbsPath(external)); {
+				case errors.Is(err, fs.ErrNotExist):
+					status.Pending = true
+				case err != nil:
+					return err
+				default:
+					lastRefreshed := fileInfo.ModTime()
+					status.Cached = true
+					status.LastRefreshed = &lastRefreshed
+					status.Age = chezmoi.Duration(now.Sub(lastRefreshed).Round(time.Second))
+					status.Pending = external.RefreshPeriod != 0 && status.Age > external.RefreshPeriod
+				}
+			}
+			externalStatuses = append(externalStatuses, status)
+		}
+	}
+
+	if c.Externals.status.format != "" {
+		return c.marshal(c.Externals.status.format, externalStatuses)
+	}
+
+	var builder strings.Builder
+	tabWriter := tabwriter.NewWriter(&builder, 3, 0, 3, ' ', 0)
+	fmt.Fprint(tabWriter, "PATH\tTYPE\tCACHE\tLAST REFRESHED\tAGE\tPENDING\n")
+	for _, status := range externalStatuses {
+		cache, lastRefreshed, age := "-", "-", "-"
+		switch {
+		case status.Type == chezmoi.ExternalTypeGitRepo:
+		case status.Cached:
+			cache = "cached"
+			lastRefreshed = status.LastRefreshed.Local().Format(time.RFC3339)
+			age = time.Duration(status.Age).String()
+		default:
+			cache = "missing"
+		}
+		pending := "no"
+		if status.Pending {
+			pending = "yes"
+		}
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\n", status.Path, status.Type, cache, lastRefreshed, age, pending)
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runExternalsUpdateCmd(cmd *cobra.Command, args []string) error {
+	// Always download externals so that the lock file records their current
+	// state, not the state of the cache.
+	c.refreshExternals = chezmoi.RefreshExternalsAlways
+	sourceState, err := c.newSourceState(cmd.Context(), cmd, chezmoi.WithIgnoreExternalLock(true))
+	if err != nil {
+		return err
+	}
+
+	externalLock, err := sourceState.ExternalLock(cmd.Context(), &chezmoi.ReadOptions{
+		ReadHTTPResponse: c.readHTTPResponse,
+		RefreshExternals: c.refreshExternals,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := chezmoi.FormatJSON.Marshal(externalLock)
+	if err != nil {
+		return err
+	}
+	externalLockAbsPath := c.SourceDirAbsPath.JoinString(chezmoi.ExternalLockName)
+	return c.sourceSystem.WriteFile(externalLockAbsPath, data, 0o666&^c.Umask)
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+// A forgeConfig is the configuration of the API of a software forge other than
+// GitHub, like GitLab or Gitea.
+type forgeConfig struct {
+	BaseURL       string        `json:"baseURL"       mapstructure:"baseURL"       yaml:"baseURL"`
+	RefreshPeriod time.Duration `json:"refreshPeriod" mapstructure:"refreshPeriod" yaml:"refreshPeriod"`
+	Token         secretString  `json:"token"         mapstructure:"token"         yaml:"token"`
+}
+
+// A forgeAPI describes how to make requests to a forge's API.
+type forgeAPI struct {
+	config        *forgeConfig
+	apiPath       string
+	authScheme    string
+	tokenEnvVars  []string
+	ownerRepoPath func(ownerRepo string) (string, error)
+}
+
+type forgeAPIResponseState struct {
+	RequestedAt time.Time       `json:"requestedAt" yaml:"requestedAt"`
+	Body        json.RawMessage `json:"body"        yaml:"body"`
+}
+
+var forgeAPIResponseStateBucket = []byte("forgeAPIResponseState")
+
+// forgeAPIGet decodes the JSON response of a GET request to path relative to
+// api's base URL into value. Responses are cached in memory and, if api's
+// refresh period is non-zero, in the persistent state.
+func (c *Config) forgeAPIGet(api *forgeAPI, path string, value any) error {
+	url := strings.TrimSuffix(api.config.BaseURL, "/") + api.apiPath + path
+
+	if body, ok := c.forgeAPIResponseCache[url]; ok {
+		return json.Unmarshal(body, value)
+	}
+
+	now := time.Now()
+	forgeAPIResponseKey := []byte(url)
+	if api.config.RefreshPeriod != 0 {
+		var forgeAPIResponseStateValue forgeAPIResponseState
+		switch ok, err := chezmoi.PersistentStateGet(c.persistentState, forgeAPIResponseStateBucket, forgeAPIResponseKey, &forgeAPIResponseStateValue); {
+		case err != nil:
+			return err
+		case ok && now.Before(forgeAPIResponseStateValue.RequestedAt.Add(api.config.RefreshPeriod)):
+			return json.Unmarshal(forgeAPIResponseStateValue.Body, value)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	token, err := c.forgeAPIToken(api)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", api.authScheme+" "+token)
+	}
+
+	httpClient, err := c.getHTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := chezmoilog.LogHTTPRequest(c.logger, httpClient, req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case err != nil:
+		return err
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+
+	if err := chezmoi.PersistentStateSet(c.persistentState, forgeAPIResponseStateBucket, forgeAPIResponseKey, &forgeAPIResponseState{
+		RequestedAt: now,
+		Body:        body,
+	}); err != nil {
+		return err
+	}
+
+	if c.forgeAPIResponseCache == nil {
+		c.forgeAPIResponseCache = make(map[string][]byte)
+	}
+	c.forgeAPIResponseCache[url] = body
+
+	return nil
+}
+
+// forgeAPIRequest makes an uncached request with method to path relative to
+// api's base URL. If body is non-nil then it is sent as JSON. If value is
+// non-nil then the JSON response is decoded into it.
+func (c *Config) forgeAPIRequest(api *forgeAPI, method, path string, body, value any) error {
+	url := strings.TrimSuffix(api.config.BaseURL, "/") + api.apiPath + path
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var bodyReader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token, err := c.forgeAPIToken(api)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", api.authScheme+" "+token)
+	}
+
+	httpClient, err := c.getHTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := chezmoilog.LogHTTPRequest(c.logger, httpClient, req)
+	if err != nil {
+		return err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case err != nil:
+		return err
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	case value == nil:
+		return nil
+	}
+	if err := json.Unmarshal(respBody, value); err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	return nil
+}
+
+// forgeAPIGetOwnerRepo is like forgeAPIGet but path is relative to the API
+// path of the repo ownerRepo.
+func (c *Config) forgeAPIGetOwnerRepo(api *forgeAPI, ownerRepo, path string, value any) error {
+	ownerRepoPath, err := api.ownerRepoPath(ownerRepo)
+	if err != nil {
+		return err
+	}
+	return c.forgeAPIGet(api, ownerRepoPath+path, value)
+}
+
+// forgeAPIToken returns the access token for api, if any.
+func (c *Config) forgeAPIToken(api *forgeAPI) (string, error) {
+	if api.config.Token.isSet() {
+		return c.secretStringValue(&api.config.Token)
+	}
+	for _, key := range api.tokenEnvVars {
+		if token := os.Getenv(key); token != "" {
+			return token, nil
+		}
+	}
+	return "", nil
+}
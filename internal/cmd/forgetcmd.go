@@ -44,7 +44,7 @@ TARGET_REL_PATH:
 		switch sourceStateOrigin := sourceStateEntry.Origin(); sourceStateOrigin.(type) {
 		case chezmoi.SourceStateOriginAbsPath:
 			// OK, keep going.
-		case chezmoi.SourceStateOriginRemove:
+		case chezmoi.SourceStateOriginRemove, chezmoi.SourceStateOriginRemovePatterns:
 			c.errorf("warning: %s: cannot forget entry from remove\n", targetRelPath)
 			continue TARGET_REL_PATH
 		case *chezmoi.External:
@@ -1,29 +1,61 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
+	"text/template"
 
+	"github.com/klauspost/compress/gzip"
 	"github.com/spf13/cobra"
 
+	"github.com/twpayne/chezmoi/v2/assets/scripts"
 	"github.com/twpayne/chezmoi/v2/assets/templates"
 	"github.com/twpayne/chezmoi/v2/internal/git"
 )
 
+type generateCmdConfig struct {
+	pin bool
+}
+
+// generateCompletionFilenames maps shells to the filenames of their completion
+// code in completion bundles.
+var generateCompletionFilenames = map[string]string{
+	"bash":       "chezmoi-completion.bash",
+	"fish":       "chezmoi.fish",
+	"powershell": "chezmoi.ps1",
+	"zsh":        "chezmoi.zsh",
+}
+
 func (c *Config) newGenerateCmd() *cobra.Command {
 	generateCmd := &cobra.Command{
-		Use:       "generate file",
-		Short:     "Generate a file for use with chezmoi",
-		Long:      mustLongHelp("generate"),
-		Example:   example("generate"),
-		Args:      cobra.ExactArgs(1),
-		ValidArgs: []string{"install.sh"},
-		RunE:      c.runGenerateCmd,
+		Use:     "generate file",
+		Short:   "Generate a file for use with chezmoi",
+		Long:    mustLongHelp("generate"),
+		Example: example("generate"),
+		Args:    cobra.ExactArgs(1),
+		ValidArgs: []string{
+			"completions.tar.gz",
+			"devcontainer-feature-install.sh",
+			"devcontainer-feature.json",
+			"git-commit-message",
+			"github-workflow.yaml",
+			"install.sh",
+			"path-mapping.json",
+		},
+		RunE: c.runGenerateCmd,
 		Annotations: newAnnotations(
 			doesNotRequireValidConfig,
 		),
 	}
 
+	flags := generateCmd.Flags()
+	flags.BoolVar(&c.generate.pin, "pin", c.generate.pin, "Pin the current version of chezmoi")
+
 	return generateCmd
 }
 
@@ -31,6 +63,20 @@ func (c *Config) runGenerateCmd(cmd *cobra.Command, args []string) error {
 	builder := strings.Builder{}
 	builder.Grow(16384)
 	switch args[0] {
+	case "completions.tar.gz":
+		data, err := completionBundle(cmd)
+		if err != nil {
+			return err
+		}
+		return c.writeOutput(data)
+	case "devcontainer-feature-install.sh":
+		if err := c.executeGenerateTemplate(&builder, templates.DevcontainerFeatureInstallSHTmpl); err != nil {
+			return err
+		}
+	case "devcontainer-feature.json":
+		if err := c.executeGenerateTemplate(&builder, templates.DevcontainerFeatureJSONTmpl); err != nil {
+			return err
+		}
 	case "git-commit-message":
 		output, err := c.cmdOutput(c.WorkingTreeAbsPath, c.Git.Command, []string{"status", "--porcelain=v2"})
 		if err != nil {
@@ -47,12 +93,82 @@ func (c *Config) runGenerateCmd(cmd *cobra.Command, args []string) error {
 		if _, err := builder.Write(data); err != nil {
 			return err
 		}
+	case "github-workflow.yaml":
+		if err := c.executeGenerateTemplate(&builder, templates.GitHubWorkflowYAMLTmpl); err != nil {
+			return err
+		}
 	case "install.sh":
-		if _, err := builder.Write(templates.InstallSH); err != nil {
+		if err := c.executeGenerateTemplate(&builder, templates.InstallSHTmpl); err != nil {
+			return err
+		}
+	case "path-mapping.json":
+		sourceState, err := c.getSourceState(cmd.Context(), cmd)
+		if err != nil {
 			return err
 		}
+		return c.marshal(writeDataFormatJSON, &pathMappingFile{
+			Version:   pathMappingVersion,
+			SourceDir: c.SourceDirAbsPath.String(),
+			DestDir:   c.DestDirAbsPath.String(),
+			Paths:     c.allPathMappings(sourceState),
+		})
 	default:
 		return fmt.Errorf("%s: unsupported file", args[0])
 	}
 	return c.writeOutputString(builder.String())
 }
+
+// executeGenerateTemplate executes the template text to builder.
+func (c *Config) executeGenerateTemplate(builder *strings.Builder, text string) error {
+	data := map[string]any{
+		"InstallScriptURL": "https://get.chezmoi.io",
+		"Version":          "",
+	}
+	if c.generate.pin {
+		if c.versionInfo.Version == "" {
+			return errors.New("--pin: cannot pin a development version of chezmoi")
+		}
+		version := c.version.String()
+		installScriptSHA256 := sha256.Sum256(scripts.InstallSH)
+		data["InstallScriptSHA256"] = hex.EncodeToString(installScriptSHA256[:])
+		data["InstallScriptURL"] = "https://raw.githubusercontent.com/twpayne/chezmoi/v" + version + "/assets/scripts/install.sh"
+		data["Version"] = version
+	}
+	tmpl, err := template.New("generate").Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(builder, data)
+}
+
+// completionBundle returns a gzipped tar archive containing the completion
+// code for all supported shells.
+func completionBundle(cmd *cobra.Command) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, shell := range []string{"bash", "fish", "powershell", "zsh"} {
+		completion, err := completion(cmd, shell)
+		if err != nil {
+			return nil, err
+		}
+		if err := tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "completions/" + generateCompletionFilenames[shell],
+			Size:     int64(len(completion)),
+			Mode:     0o644,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tarWriter.Write([]byte(completion)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
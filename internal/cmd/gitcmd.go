@@ -5,12 +5,21 @@ import (
 )
 
 type gitCmdConfig struct {
-	Command                   string `json:"command"                   mapstructure:"command"                   yaml:"command"`
-	AutoAdd                   bool   `json:"autoadd"                   mapstructure:"autoadd"                   yaml:"autoadd"`
-	AutoCommit                bool   `json:"autocommit"                mapstructure:"autocommit"                yaml:"autocommit"`
-	AutoPush                  bool   `json:"autopush"                  mapstructure:"autopush"                  yaml:"autopush"`
-	CommitMessageTemplate     string `json:"commitMessageTemplate"     mapstructure:"commitMessageTemplate"     yaml:"commitMessageTemplate"`
-	CommitMessageTemplateFile string `json:"commitMessageTemplateFile" mapstructure:"commitMessageTemplateFile" yaml:"commitMessageTemplateFile"`
+	Command                   string            `json:"command"                   mapstructure:"command"                   yaml:"command"`
+	AutoAdd                   bool              `json:"autoadd"                   mapstructure:"autoadd"                   yaml:"autoadd"`
+	AutoCommit                bool              `json:"autocommit"                mapstructure:"autocommit"                yaml:"autocommit"`
+	AutoPush                  bool              `json:"autopush"                  mapstructure:"autopush"                  yaml:"autopush"`
+	CommitMessageStyle        string            `json:"commitMessageStyle"        mapstructure:"commitMessageStyle"        yaml:"commitMessageStyle"`
+	CommitMessageTemplate     string            `json:"commitMessageTemplate"     mapstructure:"commitMessageTemplate"     yaml:"commitMessageTemplate"`
+	CommitMessageTemplateFile string            `json:"commitMessageTemplateFile" mapstructure:"commitMessageTemplateFile" yaml:"commitMessageTemplateFile"`
+	Remotes                   []gitRemoteConfig `json:"remotes"                   mapstructure:"remotes"                   yaml:"remotes"`
+}
+
+// A gitCommitChange is a change to a target included in a commit.
+type gitCommitChange struct {
+	Action     string
+	SourcePath string
+	TargetPath string
 }
 
 func (c *Config) newGitCmd() *cobra.Command {
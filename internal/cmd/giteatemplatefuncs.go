@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type giteaKey struct {
+	ID          int        `json:"id"          yaml:"id"`
+	Key         string     `json:"key"         yaml:"key"`
+	Title       string     `json:"title"       yaml:"title"`
+	Fingerprint string     `json:"fingerprint" yaml:"fingerprint"`
+	CreatedAt   *time.Time `json:"created_at"  yaml:"created_at"`
+}
+
+type giteaRelease struct {
+	ID          int        `json:"id"           yaml:"id"`
+	TagName     string     `json:"tag_name"     yaml:"tag_name"`
+	Name        string     `json:"name"         yaml:"name"`
+	Body        string     `json:"body"         yaml:"body"`
+	Draft       bool       `json:"draft"        yaml:"draft"`
+	Prerelease  bool       `json:"prerelease"   yaml:"prerelease"`
+	CreatedAt   *time.Time `json:"created_at"   yaml:"created_at"`
+	PublishedAt *time.Time `json:"published_at" yaml:"published_at"`
+	TarballURL  string     `json:"tarball_url"  yaml:"tarball_url"`
+	ZipballURL  string     `json:"zipball_url"  yaml:"zipball_url"`
+	Assets      []struct {
+		ID                 int    `json:"id"                   yaml:"id"`
+		Name               string `json:"name"                 yaml:"name"`
+		Size               int64  `json:"size"                 yaml:"size"`
+		BrowserDownloadURL string `json:"browser_download_url" yaml:"browser_download_url"`
+	} `json:"assets" yaml:"assets"`
+}
+
+type giteaTag struct {
+	Name    string `json:"name"    yaml:"name"`
+	Message string `json:"message" yaml:"message"`
+	ID      string `json:"id"      yaml:"id"`
+	Commit  struct {
+		SHA string `json:"sha" yaml:"sha"`
+		URL string `json:"url" yaml:"url"`
+	} `json:"commit" yaml:"commit"`
+	TarballURL string `json:"tarball_url" yaml:"tarball_url"`
+	ZipballURL string `json:"zipball_url" yaml:"zipball_url"`
+}
+
+func (c *Config) giteaKeysTemplateFunc(user string) []*giteaKey {
+	var keys []*giteaKey
+	if err := c.forgeAPIGet(c.giteaAPI(), "/users/"+url.PathEscape(user)+"/keys", &keys); err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+func (c *Config) giteaLatestReleaseTemplateFunc(ownerRepo string) *giteaRelease {
+	var release giteaRelease
+	if err := c.forgeAPIGetOwnerRepo(c.giteaAPI(), ownerRepo, "/releases/latest", &release); err != nil {
+		panic(err)
+	}
+	return &release
+}
+
+func (c *Config) giteaLatestTagTemplateFunc(ownerRepo string) *giteaTag {
+	tags := c.giteaTagsTemplateFunc(ownerRepo)
+	if len(tags) > 0 {
+		return tags[0]
+	}
+	return nil
+}
+
+func (c *Config) giteaReleasesTemplateFunc(ownerRepo string) []*giteaRelease {
+	var releases []*giteaRelease
+	if err := c.forgeAPIGetOwnerRepo(c.giteaAPI(), ownerRepo, "/releases", &releases); err != nil {
+		panic(err)
+	}
+	return releases
+}
+
+func (c *Config) giteaTagsTemplateFunc(ownerRepo string) []*giteaTag {
+	var tags []*giteaTag
+	if err := c.forgeAPIGetOwnerRepo(c.giteaAPI(), ownerRepo, "/tags", &tags); err != nil {
+		panic(err)
+	}
+	return tags
+}
+
+// giteaAPI returns the Gitea API, which is also implemented by Forgejo.
+func (c *Config) giteaAPI() *forgeAPI {
+	return &forgeAPI{
+		config:     &c.Gitea,
+		apiPath:    "/api/v1",
+		authScheme: "token",
+		tokenEnvVars: []string{
+			"CHEZMOI_GITEA_ACCESS_TOKEN",
+			"CHEZMOI_GITEA_TOKEN",
+			"GITEA_ACCESS_TOKEN",
+			"GITEA_TOKEN",
+		},
+		ownerRepoPath: func(ownerRepo string) (string, error) {
+			owner, repo, ok := strings.Cut(ownerRepo, "/")
+			if !ok {
+				return "", fmt.Errorf("%s: not an owner/repo", ownerRepo)
+			}
+			return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo), nil
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+type gitHubRateLimitMode string
+
+const (
+	gitHubRateLimitModeFail gitHubRateLimitMode = "fail"
+	gitHubRateLimitModeWait gitHubRateLimitMode = "wait"
+)
+
+const (
+	// gitHubRateLimitMaxAttempts is the maximum number of attempts of a GitHub
+	// API request that is rate limited when waiting for rate limits.
+	gitHubRateLimitMaxAttempts = 3
+
+	// gitHubSecondaryRateLimitWait is how long to wait after hitting a
+	// secondary rate limit without a Retry-After header.
+	gitHubSecondaryRateLimitWait = time.Minute
+)
+
+// A gitHubCacheTTLTransport is an http.RoundTripper that sets the lifetime of
+// successful GitHub API responses to ttl. Within ttl, responses are served from
+// the HTTP cache without a request. After ttl, they are revalidated with their
+// ETag, which does not count against the rate limit if they are unchanged.
+type gitHubCacheTTLTransport struct {
+	transport http.RoundTripper
+	ttl       time.Duration
+}
+
+// RoundTrip implements net/http.RoundTripper.RoundTrip.
+func (t *gitHubCacheTTLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == http.MethodGet {
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusNotModified:
+			resp.Header.Set("Cache-Control", "private, max-age="+strconv.Itoa(int(t.ttl/time.Second)))
+		}
+	}
+	return resp, nil
+}
+
+// gitHubCall calls f, which makes a GitHub API request, and handles rate limit
+// errors according to c's configuration. If c is configured to wait for rate
+// limits then gitHubCall waits until the rate limit resets and calls f again,
+// otherwise it fails immediately.
+func gitHubCall[T any](ctx context.Context, c *Config, f func() (T, *github.Response, error)) (T, *github.Response, error) {
+	for attempt := 1; ; attempt++ {
+		value, resp, err := f()
+		reset, ok := gitHubRateLimitReset(err, time.Now())
+		switch {
+		case !ok:
+			return value, resp, err
+		case c.GitHub.RateLimit == gitHubRateLimitModeFail:
+			return value, resp, fmt.Errorf(
+				"GitHub API rate limit exceeded until %s, set gitHub.token to increase the limit or "+
+					"gitHub.rateLimit to %s to wait: %w",
+				reset.Format(time.RFC3339), gitHubRateLimitModeWait, err,
+			)
+		case c.GitHub.RateLimit != gitHubRateLimitModeWait:
+			return value, resp, fmt.Errorf("%s: invalid GitHub rate limit mode", c.GitHub.RateLimit)
+		case attempt == gitHubRateLimitMaxAttempts:
+			return value, resp, fmt.Errorf("GitHub API rate limit exceeded after %d attempts: %w", attempt, err)
+		}
+
+		wait := time.Until(reset).Round(time.Second) + time.Second
+		c.errorf("warning: GitHub API rate limit exceeded, waiting %s\n", wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return value, resp, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// gitHubRateLimitReset returns when the rate limit that caused err resets and
+// true if err is a GitHub API rate limit error.
+func gitHubRateLimitReset(err error, now time.Time) (time.Time, bool) {
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		if reset := rateLimitErr.Rate.Reset.Time; reset.After(now) {
+			return reset, true
+		}
+		return now, true
+	case errors.As(err, &abuseRateLimitErr):
+		if retryAfter := abuseRateLimitErr.GetRetryAfter(); retryAfter > 0 {
+			return now.Add(retryAfter), true
+		}
+		return now.Add(gitHubSecondaryRateLimitWait), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// newGitHubHTTPClient returns a new HTTP client for GitHub API requests.
+func (c *Config) newGitHubHTTPClient() (*http.Client, error) {
+	if c.GitHub.CacheTTL == 0 {
+		return c.getHTTPClient()
+	}
+	transport, err := c.newHTTPTransport()
+	if err != nil {
+		return nil, err
+	}
+	return c.newCachingHTTPClient(&gitHubCacheTTLTransport{
+		transport: transport,
+		ttl:       c.GitHub.CacheTTL,
+	})
+}
@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"path"
+	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
@@ -12,7 +17,12 @@ import (
 )
 
 type gitHubConfig struct {
-	RefreshPeriod time.Duration `json:"refreshPeriod" mapstructure:"refreshPeriod" yaml:"refreshPeriod"`
+	BaseURL       string              `json:"baseURL"       mapstructure:"baseURL"       yaml:"baseURL"`
+	CacheTTL      time.Duration       `json:"cacheTTL"      mapstructure:"cacheTTL"      yaml:"cacheTTL"`
+	RateLimit     gitHubRateLimitMode `json:"rateLimit"     mapstructure:"rateLimit"     yaml:"rateLimit"`
+	RefreshPeriod time.Duration       `json:"refreshPeriod" mapstructure:"refreshPeriod" yaml:"refreshPeriod"`
+	Token         secretString        `json:"token"         mapstructure:"token"         yaml:"token"`
+	TokenArgs     []string            `json:"tokenArgs"     mapstructure:"tokenArgs"     yaml:"tokenArgs"`
 }
 
 type gitHubKeysState struct {
@@ -42,9 +52,50 @@ var (
 	gitHubTagsStateBucket          = []byte("gitHubTagsState")
 )
 
+var (
+	// gitHubAssetArchAliases maps GOARCH values to the names commonly used
+	// for them in release asset names.
+	gitHubAssetArchAliases = map[string][]string{
+		"386":   {"386", "i386", "i686", "x86", "32bit"},
+		"amd64": {"amd64", "x64", "64bit"},
+		"arm":   {"arm", "armv6", "armv7", "armhf", "armel"},
+		"arm64": {"arm64", "armv8"},
+	}
+
+	// gitHubAssetOSAliases maps GOOS values to the names commonly used for
+	// them in release asset names.
+	gitHubAssetOSAliases = map[string][]string{
+		"darwin":  {"darwin", "macos", "osx", "apple"},
+		"freebsd": {"freebsd"},
+		"linux":   {"linux"},
+		"openbsd": {"openbsd"},
+		"windows": {"windows", "win", "win32", "win64"},
+	}
+
+	// gitHubAssetIgnoreExts are the extensions of release assets that are
+	// never selected automatically, like checksums and signatures.
+	gitHubAssetIgnoreExts = []string{
+		".asc",
+		".json",
+		".md5",
+		".pem",
+		".sbom",
+		".sha256",
+		".sha256sum",
+		".sha512",
+		".sig",
+		".txt",
+	}
+
+	gitHubAssetNameTokenRx = regexp.MustCompile(`[a-z0-9]+`)
+	gitHubChecksumsAssetRx = regexp.MustCompile(`(?i)(?:checksums|sha256sums)(?:\.txt)?\z`)
+	gitHubChecksumLineRx   = regexp.MustCompile(`\A([0-9A-Fa-f]{64})(?:\s+\*?(\S+))?\z`)
+)
+
 type gitHubData struct {
 	client             *github.Client
 	clientErr          error
+	checksumsCache     map[string]map[string]string
 	keysCache          map[string][]*github.Key
 	latestReleaseCache map[string]map[string]*github.RepositoryRelease
 	releasesCache      map[string]map[string][]*github.RepositoryRelease
@@ -81,7 +132,9 @@ func (c *Config) gitHubKeysTemplateFunc(user string) []*github.Key {
 		PerPage: 100,
 	}
 	for {
-		keys, resp, err := gitHubClient.Users.ListKeys(ctx, user, opts)
+		keys, resp, err := gitHubCall(ctx, c, func() ([]*github.Key, *github.Response, error) {
+			return gitHubClient.Users.ListKeys(ctx, user, opts)
+		})
 		if err != nil {
 			panic(err)
 		}
@@ -137,7 +190,9 @@ func (c *Config) gitHubLatestReleaseTemplateFunc(ownerRepo string) *github.Repos
 		panic(err)
 	}
 
-	release, _, err := gitHubClient.Repositories.GetLatestRelease(ctx, owner, repo)
+	release, _, err := gitHubCall(ctx, c, func() (*github.RepositoryRelease, *github.Response, error) {
+		return gitHubClient.Repositories.GetLatestRelease(ctx, owner, repo)
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -160,6 +215,28 @@ func (c *Config) gitHubLatestReleaseTemplateFunc(ownerRepo string) *github.Repos
 	return release
 }
 
+func (c *Config) gitHubLatestReleaseAssetChecksumTemplateFunc(ownerRepo string, patterns ...string) string {
+	release := c.gitHubLatestReleaseTemplateFunc(ownerRepo)
+	releaseAsset, err := gitHubSelectReleaseAsset(release, patterns, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", ownerRepo, err))
+	}
+	checksum, err := c.getGitHubReleaseAssetChecksum(release, releaseAsset)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", ownerRepo, err))
+	}
+	return checksum
+}
+
+func (c *Config) gitHubLatestReleaseAssetURLTemplateFunc(ownerRepo string, patterns ...string) string {
+	release := c.gitHubLatestReleaseTemplateFunc(ownerRepo)
+	releaseAsset, err := gitHubSelectReleaseAsset(release, patterns, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", ownerRepo, err))
+	}
+	return releaseAsset.GetBrowserDownloadURL()
+}
+
 func (c *Config) gitHubLatestTagTemplateFunc(ownerRepo string) *github.RepositoryTag {
 	tags, err := c.getGitHubTags(ownerRepo)
 	if err != nil {
@@ -203,7 +280,9 @@ func (c *Config) gitHubReleasesTemplateFunc(ownerRepo string) []*github.Reposito
 		panic(err)
 	}
 
-	releases, _, err := gitHubClient.Repositories.ListReleases(ctx, owner, repo, nil)
+	releases, _, err := gitHubCall(ctx, c, func() ([]*github.RepositoryRelease, *github.Response, error) {
+		return gitHubClient.Repositories.ListReleases(ctx, owner, repo, nil)
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -265,7 +344,9 @@ func (c *Config) getGitHubTags(ownerRepo string) ([]*github.RepositoryTag, error
 		return nil, err
 	}
 
-	tags, _, err := gitHubClient.Repositories.ListTags(ctx, owner, repo, nil)
+	tags, _, err := gitHubCall(ctx, c, func() ([]*github.RepositoryTag, *github.Response, error) {
+		return gitHubClient.Repositories.ListTags(ctx, owner, repo, nil)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -293,14 +374,192 @@ func (c *Config) getGitHubClient(ctx context.Context) (*github.Client, error) {
 		return c.gitHub.client, c.gitHub.clientErr
 	}
 
-	httpClient, err := c.getHTTPClient()
+	c.gitHub.client, c.gitHub.clientErr = c.newGitHubClient(ctx)
+	return c.gitHub.client, c.gitHub.clientErr
+}
+
+// getGitHubReleaseAssetChecksum returns the SHA256 checksum of releaseAsset,
+// read from the checksums file published with release.
+func (c *Config) getGitHubReleaseAssetChecksum(
+	release *github.RepositoryRelease, releaseAsset *github.ReleaseAsset,
+) (string, error) {
+	name := releaseAsset.GetName()
+
+	// Prefer a checksum file for the asset itself, for example
+	// asset.tar.gz.sha256, over a checksums file for the whole release.
+	checksumsAsset := getReleaseAssetByName(release, name+".sha256")
+	if checksumsAsset == nil {
+		checksumsAsset = getReleaseAssetByName(release, name+".sha256sum")
+	}
+	if checksumsAsset == nil {
+		for _, asset := range release.Assets {
+			if gitHubChecksumsAssetRx.MatchString(asset.GetName()) {
+				checksumsAsset = asset
+				break
+			}
+		}
+	}
+	if checksumsAsset == nil {
+		return "", fmt.Errorf("%s: no checksums file", release.GetTagName())
+	}
+
+	checksumsURL := checksumsAsset.GetBrowserDownloadURL()
+	checksums, ok := c.gitHub.checksumsCache[checksumsURL]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		data, err := c.downloadURL(ctx, checksumsURL)
+		if err != nil {
+			return "", err
+		}
+		checksums, err = parseChecksums(data, name)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", checksumsAsset.GetName(), err)
+		}
+
+		if c.gitHub.checksumsCache == nil {
+			c.gitHub.checksumsCache = make(map[string]map[string]string)
+		}
+		c.gitHub.checksumsCache[checksumsURL] = checksums
+	}
+
+	checksum, ok := checksums[name]
+	if !ok {
+		return "", fmt.Errorf("%s: checksum not found in %s", name, checksumsAsset.GetName())
+	}
+	return checksum, nil
+}
+
+// newGitHubClient returns a new GitHub client configured with c's base URL and
+// access token.
+func (c *Config) newGitHubClient(ctx context.Context) (*github.Client, error) {
+	httpClient, err := c.newGitHubHTTPClient()
 	if err != nil {
-		c.gitHub.clientErr = err
 		return nil, err
 	}
 
-	c.gitHub.client = chezmoi.NewGitHubClient(ctx, httpClient)
-	return c.gitHub.client, nil
+	token, err := c.secretStringValue(&c.GitHub.Token)
+	if err != nil {
+		return nil, fmt.Errorf("gitHub.token: %w", err)
+	}
+	if token == "" && len(c.GitHub.TokenArgs) > 0 {
+		output, err := c.secretOutput(c.GitHub.TokenArgs)
+		if err != nil {
+			return nil, err
+		}
+		token = string(bytes.TrimSpace(output))
+	}
+
+	var client *github.Client
+	if token != "" {
+		client = github.NewClient(httpClient).WithAuthToken(token)
+	} else {
+		client = chezmoi.NewGitHubClient(ctx, httpClient)
+	}
+
+	if c.GitHub.BaseURL != "" {
+		return client.WithEnterpriseURLs(c.GitHub.BaseURL, c.GitHub.BaseURL)
+	}
+	return client, nil
+}
+
+// getReleaseAssetByName returns the release asset from rr with the given name.
+func getReleaseAssetByName(rr *github.RepositoryRelease, name string) *github.ReleaseAsset {
+	for i, ra := range rr.Assets {
+		if ra.GetName() == name {
+			return rr.Assets[i]
+		}
+	}
+	return nil
+}
+
+// gitHubSelectReleaseAsset returns the asset of release whose name matches the
+// first of patterns that matches any asset. If patterns is empty then it
+// returns the first asset whose name contains both goos and goarch or one of
+// their aliases.
+func gitHubSelectReleaseAsset(
+	release *github.RepositoryRelease, patterns []string, goos, goarch string,
+) (*github.ReleaseAsset, error) {
+	if len(patterns) > 0 {
+		for _, pattern := range patterns {
+			for _, asset := range release.Assets {
+				switch match, err := path.Match(pattern, asset.GetName()); {
+				case err != nil:
+					return nil, fmt.Errorf("%s: %w", pattern, err)
+				case match:
+					return asset, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s: no asset matches %s", release.GetTagName(), strings.Join(patterns, ", "))
+	}
+
+	osAliases := append([]string{goos}, gitHubAssetOSAliases[goos]...)
+	archAliases := append([]string{goarch}, gitHubAssetArchAliases[goarch]...)
+	var universalAsset *github.ReleaseAsset
+ASSET:
+	for _, asset := range release.Assets {
+		name := strings.ToLower(asset.GetName())
+		for _, ext := range gitHubAssetIgnoreExts {
+			if strings.HasSuffix(name, ext) {
+				continue ASSET
+			}
+		}
+		// Normalize architecture names that contain separators so that they
+		// form a single token.
+		name = strings.NewReplacer("x86_64", "amd64", "x86-64", "amd64", "aarch64", "arm64").Replace(name)
+		tokens := gitHubAssetNameTokenRx.FindAllString(name, -1)
+		if !containsAny(tokens, osAliases) {
+			continue
+		}
+		if containsAny(tokens, archAliases) {
+			return asset, nil
+		}
+		if universalAsset == nil && containsAny(tokens, []string{"all", "universal"}) {
+			universalAsset = asset
+		}
+	}
+	if universalAsset != nil {
+		return universalAsset, nil
+	}
+	return nil, fmt.Errorf("%s: no asset for %s/%s", release.GetTagName(), goos, goarch)
+}
+
+// containsAny returns if any element of ss is in values.
+func containsAny(ss, values []string) bool {
+	for _, s := range ss {
+		for _, value := range values {
+			if s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseChecksums parses data as the output of sha256sum and returns a map of
+// names to hex-encoded checksums. A file containing only a checksum is
+// assumed to be the checksum of defaultName.
+func parseChecksums(data []byte, defaultName string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		m := gitHubChecksumLineRx.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("%q: cannot parse checksum", line)
+		}
+		name := m[2]
+		if name == "" {
+			name = defaultName
+		}
+		checksums[path.Base(name)] = strings.ToLower(m[1])
+	}
+	return checksums, s.Err()
 }
 
 func gitHubSplitOwnerRepo(ownerRepo string) (string, string, error) {
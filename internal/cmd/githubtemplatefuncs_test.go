@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/google/go-github/v58/github"
+)
+
+func TestGitHubSelectReleaseAsset(t *testing.T) {
+	release := &github.RepositoryRelease{
+		TagName: github.String("v1.0.0"),
+		Assets: []*github.ReleaseAsset{
+			{Name: github.String("tool_1.0.0_checksums.txt")},
+			{Name: github.String("tool_1.0.0_darwin_all.tar.gz")},
+			{Name: github.String("tool_1.0.0_linux_arm64.tar.gz")},
+			{Name: github.String("tool_1.0.0_linux_x86_64.tar.gz")},
+			{Name: github.String("tool_1.0.0_linux_x86_64.tar.gz.sig")},
+			{Name: github.String("tool_1.0.0_windows_amd64.zip")},
+		},
+	}
+	for _, tc := range []struct {
+		name          string
+		patterns      []string
+		goos          string
+		goarch        string
+		expectedName  string
+		expectedError string
+	}{
+		{
+			name:         "linux_amd64",
+			goos:         "linux",
+			goarch:       "amd64",
+			expectedName: "tool_1.0.0_linux_x86_64.tar.gz",
+		},
+		{
+			name:         "linux_arm64",
+			goos:         "linux",
+			goarch:       "arm64",
+			expectedName: "tool_1.0.0_linux_arm64.tar.gz",
+		},
+		{
+			name:         "darwin_universal",
+			goos:         "darwin",
+			goarch:       "arm64",
+			expectedName: "tool_1.0.0_darwin_all.tar.gz",
+		},
+		{
+			name:          "no_match",
+			goos:          "freebsd",
+			goarch:        "amd64",
+			expectedError: "v1.0.0: no asset for freebsd/amd64",
+		},
+		{
+			name:         "patterns",
+			patterns:     []string{"*_openbsd_*", "*_windows_*.zip"},
+			expectedName: "tool_1.0.0_windows_amd64.zip",
+		},
+		{
+			name:          "patterns_no_match",
+			patterns:      []string{"*.deb"},
+			expectedError: "v1.0.0: no asset matches *.deb",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := gitHubSelectReleaseAsset(release, tc.patterns, tc.goos, tc.goarch)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, actual.GetName())
+		})
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		data          string
+		expected      map[string]string
+		expectedError bool
+	}{
+		{
+			name: "sha256sum",
+			data: "" +
+				"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef  tool_linux_amd64.tar.gz\n" +
+				"FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210 *dist/tool_windows_amd64.zip\n",
+			expected: map[string]string{
+				"tool_linux_amd64.tar.gz": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				"tool_windows_amd64.zip":  "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210",
+			},
+		},
+		{
+			name: "checksum_only",
+			data: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef\n",
+			expected: map[string]string{
+				"default": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+		},
+		{
+			name:          "invalid",
+			data:          "not a checksum\n",
+			expectedError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseChecksums([]byte(tc.data), "default")
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestGitHubRateLimitReset(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	retryAfter := 30 * time.Second
+	for _, tc := range []struct {
+		name          string
+		err           error
+		expectedReset time.Time
+		expectedOK    bool
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "other_error",
+			err:  errors.New("other"),
+		},
+		{
+			name: "rate_limit",
+			err: fmt.Errorf("wrapped: %w", &github.RateLimitError{
+				Rate: github.Rate{
+					Reset: github.Timestamp{Time: now.Add(10 * time.Minute)},
+				},
+			}),
+			expectedReset: now.Add(10 * time.Minute),
+			expectedOK:    true,
+		},
+		{
+			name: "rate_limit_reset_in_past",
+			err: &github.RateLimitError{
+				Rate: github.Rate{
+					Reset: github.Timestamp{Time: now.Add(-time.Minute)},
+				},
+			},
+			expectedReset: now,
+			expectedOK:    true,
+		},
+		{
+			name: "secondary_rate_limit_with_retry_after",
+			err: &github.AbuseRateLimitError{
+				RetryAfter: &retryAfter,
+			},
+			expectedReset: now.Add(retryAfter),
+			expectedOK:    true,
+		},
+		{
+			name:          "secondary_rate_limit",
+			err:           &github.AbuseRateLimitError{},
+			expectedReset: now.Add(gitHubSecondaryRateLimitWait),
+			expectedOK:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualReset, actualOK := gitHubRateLimitReset(tc.err, now)
+			assert.Equal(t, tc.expectedReset, actualReset)
+			assert.Equal(t, tc.expectedOK, actualOK)
+		})
+	}
+}
+
+func TestGitHubCacheTTLTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &gitHubCacheTTLTransport{
+			transport: http.DefaultTransport,
+			ttl:       time.Hour,
+		},
+	}
+	for _, tc := range []struct {
+		path                 string
+		expectedCacheControl string
+	}{
+		{
+			path:                 "/repos/owner/repo/releases/latest",
+			expectedCacheControl: "private, max-age=3600",
+		},
+		{
+			path:                 "/missing",
+			expectedCacheControl: "private, max-age=60",
+		},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tc.path)
+			assert.NoError(t, err)
+			assert.NoError(t, resp.Body.Close())
+			assert.Equal(t, tc.expectedCacheControl, resp.Header.Get("Cache-Control"))
+		})
+	}
+}
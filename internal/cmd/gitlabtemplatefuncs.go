@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"net/url"
+	"time"
+)
+
+type gitLabKey struct {
+	ID        int        `json:"id"         yaml:"id"`
+	Title     string     `json:"title"      yaml:"title"`
+	Key       string     `json:"key"        yaml:"key"`
+	CreatedAt *time.Time `json:"created_at" yaml:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+type gitLabRelease struct {
+	TagName     string     `json:"tag_name"    yaml:"tag_name"`
+	Name        string     `json:"name"        yaml:"name"`
+	Description string     `json:"description" yaml:"description"`
+	CreatedAt   *time.Time `json:"created_at"  yaml:"created_at"`
+	ReleasedAt  *time.Time `json:"released_at" yaml:"released_at"`
+	Assets      struct {
+		Links []struct {
+			ID             int    `json:"id"               yaml:"id"`
+			Name           string `json:"name"             yaml:"name"`
+			URL            string `json:"url"              yaml:"url"`
+			DirectAssetURL string `json:"direct_asset_url" yaml:"direct_asset_url"`
+			LinkType       string `json:"link_type"        yaml:"link_type"`
+		} `json:"links" yaml:"links"`
+		Sources []struct {
+			Format string `json:"format" yaml:"format"`
+			URL    string `json:"url"    yaml:"url"`
+		} `json:"sources" yaml:"sources"`
+	} `json:"assets" yaml:"assets"`
+}
+
+type gitLabTag struct {
+	Name    string `json:"name"    yaml:"name"`
+	Message string `json:"message" yaml:"message"`
+	Target  string `json:"target"  yaml:"target"`
+	Commit  struct {
+		ID        string     `json:"id"         yaml:"id"`
+		ShortID   string     `json:"short_id"   yaml:"short_id"`
+		Title     string     `json:"title"      yaml:"title"`
+		CreatedAt *time.Time `json:"created_at" yaml:"created_at"`
+	} `json:"commit" yaml:"commit"`
+	Protected bool `json:"protected" yaml:"protected"`
+}
+
+func (c *Config) gitLabKeysTemplateFunc(user string) []*gitLabKey {
+	var keys []*gitLabKey
+	if err := c.forgeAPIGet(c.gitLabAPI(), "/users/"+url.PathEscape(user)+"/keys", &keys); err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+func (c *Config) gitLabLatestReleaseTemplateFunc(project string) *gitLabRelease {
+	var release gitLabRelease
+	if err := c.forgeAPIGetOwnerRepo(c.gitLabAPI(), project, "/releases/permalink/latest", &release); err != nil {
+		panic(err)
+	}
+	return &release
+}
+
+func (c *Config) gitLabLatestTagTemplateFunc(project string) *gitLabTag {
+	tags := c.gitLabTagsTemplateFunc(project)
+	if len(tags) > 0 {
+		return tags[0]
+	}
+	return nil
+}
+
+func (c *Config) gitLabReleasesTemplateFunc(project string) []*gitLabRelease {
+	var releases []*gitLabRelease
+	if err := c.forgeAPIGetOwnerRepo(c.gitLabAPI(), project, "/releases", &releases); err != nil {
+		panic(err)
+	}
+	return releases
+}
+
+func (c *Config) gitLabTagsTemplateFunc(project string) []*gitLabTag {
+	var tags []*gitLabTag
+	if err := c.forgeAPIGetOwnerRepo(c.gitLabAPI(), project, "/repository/tags", &tags); err != nil {
+		panic(err)
+	}
+	return tags
+}
+
+// gitLabAPI returns the GitLab API.
+func (c *Config) gitLabAPI() *forgeAPI {
+	return &forgeAPI{
+		config:     &c.GitLab,
+		apiPath:    "/api/v4",
+		authScheme: "Bearer",
+		tokenEnvVars: []string{
+			"CHEZMOI_GITLAB_ACCESS_TOKEN",
+			"CHEZMOI_GITLAB_TOKEN",
+			"GITLAB_ACCESS_TOKEN",
+			"GITLAB_TOKEN",
+		},
+		ownerRepoPath: func(project string) (string, error) {
+			// GitLab projects can be in nested groups, so the project is
+			// identified by its URL-encoded full path.
+			return "/projects/" + url.PathEscape(project), nil
+		},
+	}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// gitCredentialHelper is a git credential helper that reads the username and
+// password from environment variables, so that they do not appear in
+// command line arguments.
+const gitCredentialHelper = `credential.helper=!f() { ` +
+	`echo "username=${CHEZMOI_GIT_USERNAME}"; ` +
+	`echo "password=${CHEZMOI_GIT_PASSWORD}"; ` +
+	`}; f`
+
+// gitMirrorRefSpecs are the refspecs pushed to mirror remotes.
+var gitMirrorRefSpecs = []string{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// A gitRemoteConfig is the configuration of a git remote. Username and
+// Password are templates so that they can be read from password managers.
+type gitRemoteConfig struct {
+	Name     string `json:"name"     mapstructure:"name"     yaml:"name"`
+	URL      string `json:"url"      mapstructure:"url"      yaml:"url"`
+	Primary  bool   `json:"primary"  mapstructure:"primary"  yaml:"primary"`
+	Mirror   bool   `json:"mirror"   mapstructure:"mirror"   yaml:"mirror"`
+	Username string `json:"username" mapstructure:"username" yaml:"username"`
+	Password string `json:"password" mapstructure:"password" yaml:"password"`
+}
+
+// validateGitRemotes returns an error if remotes are not valid.
+func validateGitRemotes(remotes []gitRemoteConfig) error {
+	primaries := 0
+	for _, remote := range remotes {
+		switch {
+		case remote.Name == "":
+			return errors.New("git.remotes: missing name")
+		case remote.URL == "":
+			return fmt.Errorf("git.remotes.%s: missing url", remote.Name)
+		case remote.Primary && remote.Mirror:
+			return fmt.Errorf("git.remotes.%s: cannot be both primary and mirror", remote.Name)
+		case remote.Primary:
+			primaries++
+		}
+	}
+	if primaries > 1 {
+		return errors.New("git.remotes: more than one primary remote")
+	}
+	return nil
+}
+
+// gitPrimaryRemote returns the primary git remote, or nil if there is no
+// primary git remote.
+func (c *Config) gitPrimaryRemote() *gitRemoteConfig {
+	for i := range c.Git.Remotes {
+		if c.Git.Remotes[i].Primary {
+			return &c.Git.Remotes[i]
+		}
+	}
+	return nil
+}
+
+// gitRemoteCredentials returns the username and password for remote.
+func (c *Config) gitRemoteCredentials(remote *gitRemoteConfig) (username, password string, err error) {
+	if remote.Username != "" {
+		username, err = c.executeEnvTemplate("git.remotes."+remote.Name+".username", remote.Username)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if remote.Password != "" {
+		password, err = c.executeEnvTemplate("git.remotes."+remote.Name+".password", remote.Password)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return strings.TrimSpace(username), strings.TrimSpace(password), nil
+}
+
+// gitRemoteAuth returns the builtin git authentication method for remote.
+func (c *Config) gitRemoteAuth(remote *gitRemoteConfig) (transport.AuthMethod, error) {
+	username, password, err := c.gitRemoteCredentials(remote)
+	switch {
+	case err != nil:
+		return nil, err
+	case username == "" && password == "":
+		return nil, nil
+	default:
+		return &http.BasicAuth{
+			Username: username,
+			Password: password,
+		}, nil
+	}
+}
+
+// runGitWithRemote runs git with args in the working tree with the
+// credentials for remote.
+func (c *Config) runGitWithRemote(remote *gitRemoteConfig, args []string) error {
+	username, password, err := c.gitRemoteCredentials(remote)
+	if err != nil {
+		return err
+	}
+	if username == "" && password == "" {
+		return c.run(c.WorkingTreeAbsPath, c.Git.Command, args)
+	}
+
+	gitArgs := append([]string{"-c", "credential.helper=", "-c", gitCredentialHelper}, args...)
+	cmd := exec.Command(c.Git.Command, gitArgs...)
+	workingTreeRawAbsPath, err := c.baseSystem.RawPath(c.WorkingTreeAbsPath)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = workingTreeRawAbsPath.String()
+	cmd.Env = append(os.Environ(),
+		"CHEZMOI_GIT_USERNAME="+username,
+		"CHEZMOI_GIT_PASSWORD="+password,
+	)
+	cmd.Stdin = c.stdin
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+	return c.baseSystem.RunCmd(cmd)
+}
+
+// syncGitRemotes adds the configured git remotes to repo, or updates their
+// URLs if they have changed.
+func (c *Config) syncGitRemotes(repo *gogit.Repository) error {
+	if c.dryRun {
+		return nil
+	}
+	for _, remote := range c.Git.Remotes {
+		switch existingRemote, err := repo.Remote(remote.Name); {
+		case errors.Is(err, gogit.ErrRemoteNotFound):
+		case err != nil:
+			return err
+		case len(existingRemote.Config().URLs) == 1 && existingRemote.Config().URLs[0] == remote.URL:
+			continue
+		default:
+			if err := repo.DeleteRemote(remote.Name); err != nil {
+				return err
+			}
+		}
+		if _, err := repo.CreateRemote(&config.RemoteConfig{
+			Name: remote.Name,
+			URLs: []string{remote.URL},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openWorkingTreeRepo opens the git repository in the working tree.
+func (c *Config) openWorkingTreeRepo() (*gogit.Repository, error) {
+	rawWorkingTreeAbsPath, err := c.baseSystem.RawPath(c.WorkingTreeAbsPath)
+	if err != nil {
+		return nil, err
+	}
+	return gogit.PlainOpen(rawWorkingTreeAbsPath.String())
+}
+
+// pushGitMirrors pushes all branches and tags to the mirror git remotes.
+func (c *Config) pushGitMirrors() error {
+	repo, err := c.openWorkingTreeRepo()
+	if err != nil {
+		return err
+	}
+	if err := c.syncGitRemotes(repo); err != nil {
+		return err
+	}
+	useBuiltinGit := c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc)
+	for i := range c.Git.Remotes {
+		remote := &c.Git.Remotes[i]
+		if !remote.Mirror {
+			continue
+		}
+		if !useBuiltinGit {
+			args := append([]string{"push", "--force", "--prune", remote.Name}, gitMirrorRefSpecs...)
+			if err := c.runGitWithRemote(remote, args); err != nil {
+				return err
+			}
+			continue
+		}
+		if c.dryRun {
+			continue
+		}
+		auth, err := c.gitRemoteAuth(remote)
+		if err != nil {
+			return err
+		}
+		refSpecs, err := gitMirrorPushRefSpecs(repo, remote.Name, auth)
+		if err != nil {
+			return fmt.Errorf("%s: %w", remote.Name, err)
+		}
+		if err := repo.Push(&gogit.PushOptions{
+			RemoteName: remote.Name,
+			RefSpecs:   refSpecs,
+			Auth:       auth,
+			Force:      true,
+		}); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("%s: %w", remote.Name, err)
+		}
+	}
+	return nil
+}
+
+// gitMirrorPushRefSpecs returns the refspecs to push to the remote named
+// remoteName to mirror repo, including refspecs that delete branches and tags
+// that no longer exist in repo.
+func gitMirrorPushRefSpecs(
+	repo *gogit.Repository,
+	remoteName string,
+	auth transport.AuthMethod,
+) ([]config.RefSpec, error) {
+	refSpecs := make([]config.RefSpec, 0, len(gitMirrorRefSpecs))
+	for _, refSpec := range gitMirrorRefSpecs {
+		refSpecs = append(refSpecs, config.RefSpec(refSpec))
+	}
+
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, err := remote.List(&gogit.ListOptions{
+		Auth: auth,
+	})
+	switch {
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		return refSpecs, nil
+	case err != nil:
+		return nil, err
+	}
+	for _, remoteRef := range remoteRefs {
+		name := remoteRef.Name()
+		if !name.IsBranch() && !name.IsTag() {
+			continue
+		}
+		switch _, err := repo.Reference(name, false); {
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			refSpecs = append(refSpecs, config.RefSpec(":"+name.String()))
+		case err != nil:
+			return nil, err
+		}
+	}
+	return refSpecs, nil
+}
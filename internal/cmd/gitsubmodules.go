@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// gitModulesName is the name of the file that configures git submodules.
+const gitModulesName = ".gitmodules"
+
+// gitSubmodulesProgress returns whether progress should be reported while
+// updating submodules.
+func (c *Config) gitSubmodulesProgress() bool {
+	return c.Verbose || !c.noTTY && c.Progress.Value(c.progressAutoFunc)
+}
+
+// skipGitSubmodule returns whether the submodule at relPath, relative to the
+// root of the working tree, should not be updated.
+func (c *Config) skipGitSubmodule(relPath string) bool {
+	return slices.Contains(c.Update.SkipSubmodules, relPath)
+}
+
+// updateGitSubmodules initializes and updates the submodules of the working
+// tree, recursing into nested submodules up to update.submoduleDepth levels.
+func (c *Config) updateGitSubmodules() error {
+	return c.updateGitSubmodulesInDir(c.WorkingTreeAbsPath, "", c.Update.SubmoduleDepth)
+}
+
+// updateGitSubmodulesInDir updates the submodules of the working tree in
+// dirAbsPath with git. prefix is the path of dirAbsPath relative to the root
+// of the working tree. If depth is zero then all nested submodules are
+// updated.
+func (c *Config) updateGitSubmodulesInDir(dirAbsPath chezmoi.AbsPath, prefix string, depth int) error {
+	switch _, err := c.baseSystem.Stat(dirAbsPath.JoinString(gitModulesName)); {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	output, err := c.cmdOutput(dirAbsPath, c.Git.Command, []string{
+		"config", "--file", gitModulesName, "--get-regexp", `^submodule\..*\.path$`,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		_, submodulePath, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		relPath := path.Join(prefix, submodulePath)
+		if c.skipGitSubmodule(relPath) {
+			continue
+		}
+		if c.gitSubmodulesProgress() {
+			fmt.Fprintf(c.stderr, "Updating submodule %s\n", relPath)
+		}
+		args := []string{"submodule", "update", "--init", "--", submodulePath}
+		if err := c.run(dirAbsPath, c.Git.Command, args); err != nil {
+			return err
+		}
+		if depth == 1 {
+			continue
+		}
+		nextDepth := depth
+		if depth > 1 {
+			nextDepth--
+		}
+		if err := c.updateGitSubmodulesInDir(dirAbsPath.JoinString(submodulePath), relPath, nextDepth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateGitSubmodulesBuiltin updates the submodules of wt with chezmoi's
+// builtin git. prefix and depth are as for updateGitSubmodulesInDir.
+func (c *Config) updateGitSubmodulesBuiltin(wt *git.Worktree, prefix string, depth int) error {
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return err
+	}
+
+	for _, submodule := range submodules {
+		relPath := path.Join(prefix, submodule.Config().Path)
+		if c.skipGitSubmodule(relPath) {
+			continue
+		}
+		if c.gitSubmodulesProgress() {
+			fmt.Fprintf(c.stderr, "Updating submodule %s\n", relPath)
+		}
+		if err := submodule.Update(&git.SubmoduleUpdateOptions{
+			Init: true,
+		}); err != nil {
+			return err
+		}
+		if depth == 1 {
+			continue
+		}
+		submoduleRepo, err := submodule.Repository()
+		if err != nil {
+			return err
+		}
+		submoduleWorktree, err := submoduleRepo.Worktree()
+		if err != nil {
+			return err
+		}
+		nextDepth := depth
+		if depth > 1 {
+			nextDepth--
+		}
+		if err := c.updateGitSubmodulesBuiltin(submoduleWorktree, relPath, nextDepth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
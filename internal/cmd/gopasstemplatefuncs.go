@@ -2,15 +2,30 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/coreos/go-semver/semver"
 
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
 )
 
+type gopassMode string
+
+const (
+	gopassModeCLI     gopassMode = "cli"
+	gopassModeJSONAPI gopassMode = "jsonapi"
+)
+
 var (
 	// chezmoi uses gopass show --password which was added in
 	// https://github.com/gopasspw/gopass/commit/8fa13d84e3656cfc4ee6717f5f485c9e471ad996
@@ -20,10 +35,33 @@ var (
 	gopassVersionRx   = regexp.MustCompile(`gopass\s+(\d+\.\d+\.\d+)`)
 )
 
+// gopassJSONAPIMaxMessageLength is the maximum length of a message from the
+// gopass JSON API. The native messaging protocol limits messages from the host
+// to 1MB.
+const gopassJSONAPIMaxMessageLength = 1024 * 1024
+
 type gopassConfig struct {
-	Command  string `json:"command" mapstructure:"command" yaml:"command"`
-	cache    map[string]string
-	rawCache map[string][]byte
+	Command        string     `json:"command"        mapstructure:"command"        yaml:"command"`
+	JSONAPICommand string     `json:"jsonapiCommand" mapstructure:"jsonapiCommand" yaml:"jsonapiCommand"`
+	Mode           gopassMode `json:"mode"           mapstructure:"mode"           yaml:"mode"`
+	cache          map[string]string
+	rawCache       map[string][]byte
+	binaryCache    map[string][]byte
+	dataCache      map[string]map[string]any
+	listCache      map[string][]string
+}
+
+// A gopassJSONAPIRequest is a request to the gopass JSON API.
+type gopassJSONAPIRequest struct {
+	Type  string `json:"type"`
+	Entry string `json:"entry,omitempty"`
+	Query string `json:"query,omitempty"`
+}
+
+// A gopassJSONAPILogin is the response to a getLogin request.
+type gopassJSONAPILogin struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 func (c *Config) gopassTemplateFunc(id string) string {
@@ -31,15 +69,29 @@ func (c *Config) gopassTemplateFunc(id string) string {
 		return password
 	}
 
-	args := []string{"show", "--password", id}
-	output, err := c.gopassOutput(args...)
-	if err != nil {
-		panic(err)
+	var password string
+	switch c.Gopass.Mode {
+	case gopassModeCLI:
+		args := []string{"show", "--password", id}
+		output, err := c.gopassOutput(args...)
+		if err != nil {
+			panic(err)
+		}
+		passwordBytes, _, _ := bytes.Cut(output, []byte{'\n'})
+		password = string(passwordBytes)
+	case gopassModeJSONAPI:
+		var login gopassJSONAPILogin
+		if err := c.gopassJSONAPI(&gopassJSONAPIRequest{
+			Type:  "getLogin",
+			Entry: id,
+		}, &login); err != nil {
+			panic(err)
+		}
+		password = login.Password
+	default:
+		panic(fmt.Errorf("%s: invalid mode", c.Gopass.Mode))
 	}
 
-	passwordBytes, _, _ := bytes.Cut(output, []byte{'\n'})
-	password := string(passwordBytes)
-
 	if c.Gopass.cache == nil {
 		c.Gopass.cache = make(map[string]string)
 	}
@@ -48,6 +100,122 @@ func (c *Config) gopassTemplateFunc(id string) string {
 	return password
 }
 
+func (c *Config) gopassBinaryTemplateFunc(id string) string {
+	if output, ok := c.Gopass.binaryCache[id]; ok {
+		return string(output)
+	}
+
+	// The gopass JSON API does not support binary secrets, so always use the
+	// gopass CLI.
+	output, err := c.gopassOutput("cat", id)
+	if err != nil {
+		panic(err)
+	}
+
+	if c.Gopass.binaryCache == nil {
+		c.Gopass.binaryCache = make(map[string][]byte)
+	}
+	c.Gopass.binaryCache[id] = output
+
+	return string(output)
+}
+
+func (c *Config) gopassDataTemplateFunc(id string) map[string]any {
+	if data, ok := c.Gopass.dataCache[id]; ok {
+		return data
+	}
+
+	var data map[string]any
+	switch c.Gopass.Mode {
+	case gopassModeCLI:
+		// The first line of a secret is the password and the remainder is
+		// either a YAML document or key: value pairs, both of which can be
+		// parsed as YAML.
+		args := []string{"show", "--noparsing", id}
+		output, err := c.gopassOutput(args...)
+		if err != nil {
+			panic(err)
+		}
+		_, body, _ := bytes.Cut(output, []byte{'\n'})
+		if err := chezmoi.FormatYAML.Unmarshal(body, &data); err != nil {
+			panic(newParseCmdOutputError(c.Gopass.Command, args, output, err))
+		}
+	case gopassModeJSONAPI:
+		var stringData map[string]string
+		if err := c.gopassJSONAPI(&gopassJSONAPIRequest{
+			Type:  "getData",
+			Entry: id,
+		}, &stringData); err != nil {
+			panic(err)
+		}
+		data = make(map[string]any, len(stringData))
+		for key, value := range stringData {
+			data[key] = value
+		}
+	default:
+		panic(fmt.Errorf("%s: invalid mode", c.Gopass.Mode))
+	}
+	if data == nil {
+		data = make(map[string]any)
+	}
+
+	if c.Gopass.dataCache == nil {
+		c.Gopass.dataCache = make(map[string]map[string]any)
+	}
+	c.Gopass.dataCache[id] = data
+
+	return data
+}
+
+func (c *Config) gopassListTemplateFunc(prefix string) []string {
+	if entries, ok := c.Gopass.listCache[prefix]; ok {
+		return entries
+	}
+
+	var entries []string
+	switch c.Gopass.Mode {
+	case gopassModeCLI:
+		args := []string{"ls", "--flat"}
+		if prefix != "" {
+			args = append(args, prefix)
+		}
+		output, err := c.gopassOutput(args...)
+		if err != nil {
+			panic(err)
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if entry := strings.TrimSpace(line); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	case gopassModeJSONAPI:
+		// query matches entries anywhere in their name, so filter the results
+		// to the entries under prefix.
+		var results []string
+		if err := c.gopassJSONAPI(&gopassJSONAPIRequest{
+			Type:  "query",
+			Query: prefix,
+		}, &results); err != nil {
+			panic(err)
+		}
+		for _, entry := range results {
+			if prefix == "" || entry == prefix || strings.HasPrefix(entry, strings.TrimSuffix(prefix, "/")+"/") {
+				entries = append(entries, entry)
+			}
+		}
+	default:
+		panic(fmt.Errorf("%s: invalid mode", c.Gopass.Mode))
+	}
+	sort.Strings(entries)
+
+	if c.Gopass.listCache == nil {
+		c.Gopass.listCache = make(map[string][]string)
+	}
+	c.Gopass.listCache[prefix] = entries
+
+	return entries
+}
+
 func (c *Config) gopassRawTemplateFunc(id string) string {
 	if output, ok := c.Gopass.rawCache[id]; ok {
 		return string(output)
@@ -67,6 +235,89 @@ func (c *Config) gopassRawTemplateFunc(id string) string {
 	return string(output)
 }
 
+// gopassJSONAPI sends request to the gopass JSON API and unmarshals the
+// response into response. Messages are framed as in the native messaging
+// protocol used by browsers: a 32-bit length followed by that many bytes of
+// JSON.
+func (c *Config) gopassJSONAPI(request *gopassJSONAPIRequest, response any) error {
+	requestData, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	stdin := &bytes.Buffer{}
+	if err := gopassJSONAPIWriteMessage(stdin, requestData); err != nil {
+		return err
+	}
+
+	args := []string{"listen"}
+	cmd := exec.Command(c.Gopass.JSONAPICommand, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = os.Stderr
+	output, err := chezmoilog.LogCmdOutput(cmd)
+	if err != nil {
+		return newCmdOutputError(cmd, output, err)
+	}
+
+	responseData, err := gopassJSONAPIReadMessage(bytes.NewReader(output))
+	if err != nil {
+		return newParseCmdOutputError(c.Gopass.JSONAPICommand, args, output, err)
+	}
+	if err := gopassJSONAPIResponseError(request.Type, responseData); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(responseData, response); err != nil {
+		return newParseCmdOutputError(c.Gopass.JSONAPICommand, args, output, err)
+	}
+	return nil
+}
+
+// gopassJSONAPIResponseError returns the error reported by the gopass JSON API
+// in response data to a request of type requestType, or nil if data is not an
+// error response.
+func gopassJSONAPIResponseError(requestType string, data []byte) error {
+	var errorResponse struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &errorResponse) == nil && errorResponse.Error != "" {
+		return fmt.Errorf("%s: %s", requestType, errorResponse.Error)
+	}
+	return nil
+}
+
+// gopassJSONAPIWriteMessage writes data to w as a single length-prefixed
+// message.
+func gopassJSONAPIWriteMessage(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// gopassJSONAPIReadMessage reads a single length-prefixed message from r.
+func gopassJSONAPIReadMessage(r io.Reader) ([]byte, error) {
+	var length uint32
+	switch err := binary.Read(r, binary.LittleEndian, &length); {
+	case errors.Is(err, io.EOF):
+		return nil, errors.New("no message")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, errors.New("message length truncated")
+	case err != nil:
+		return nil, err
+	}
+	if length > gopassJSONAPIMaxMessageLength {
+		return nil, fmt.Errorf("message length %d exceeds maximum of %d", length, gopassJSONAPIMaxMessageLength)
+	}
+	data := make([]byte, length)
+	switch n, err := io.ReadFull(r, data); {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, fmt.Errorf("message truncated after %d of %d bytes", n, length)
+	case err != nil:
+		return nil, err
+	}
+	return data, nil
+}
+
 func (c *Config) gopassOutput(args ...string) ([]byte, error) {
 	name := c.Gopass.Command
 	cmd := exec.Command(name, args...)
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestGopassJSONAPIWriteMessage(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, gopassJSONAPIWriteMessage(buffer, []byte(`{"type":"query"}`)))
+	assert.Equal(t, append([]byte{16, 0, 0, 0}, `{"type":"query"}`...), buffer.Bytes())
+}
+
+func TestGopassJSONAPIReadMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		input         []byte
+		expected      []byte
+		expectedError string
+	}{
+		{
+			name:     "message",
+			input:    append([]byte{2, 0, 0, 0}, "[]"...),
+			expected: []byte("[]"),
+		},
+		{
+			name:     "empty_message",
+			input:    []byte{0, 0, 0, 0},
+			expected: []byte{},
+		},
+		{
+			name:     "trailing_data",
+			input:    append([]byte{2, 0, 0, 0}, "[][]"...),
+			expected: []byte("[]"),
+		},
+		{
+			name:          "no_message",
+			expectedError: "no message",
+		},
+		{
+			name:          "length_truncated",
+			input:         []byte{2, 0},
+			expectedError: "message length truncated",
+		},
+		{
+			name:          "body_missing",
+			input:         []byte{2, 0, 0, 0},
+			expectedError: "message truncated after 0 of 2 bytes",
+		},
+		{
+			name:          "body_truncated",
+			input:         append([]byte{2, 0, 0, 0}, "["...),
+			expectedError: "message truncated after 1 of 2 bytes",
+		},
+		{
+			name:          "too_long",
+			input:         []byte{0, 0, 0, 1},
+			expectedError: "message length 16777216 exceeds maximum of 1048576",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := gopassJSONAPIReadMessage(bytes.NewReader(tc.input))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestGopassJSONAPIWriteReadMessage(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 300)
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, gopassJSONAPIWriteMessage(buffer, data))
+	actual, err := gopassJSONAPIReadMessage(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, data, actual)
+}
+
+func TestGopassJSONAPIResponseError(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		data          string
+		expectedError string
+	}{
+		{
+			name: "login",
+			data: `{"username":"user","password":"password"}`,
+		},
+		{
+			name: "list",
+			data: `["misc/example.com"]`,
+		},
+		{
+			name: "empty_error",
+			data: `{"error":""}`,
+		},
+		{
+			name: "invalid_json",
+			data: `{`,
+		},
+		{
+			name:          "error",
+			data:          `{"error":"entry not found"}`,
+			expectedError: "getLogin: entry not found",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := gopassJSONAPIResponseError("getLogin", []byte(tc.data))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// generationStateBucket is the bucket for recording the history of applies.
+var generationStateBucket = []byte("generationState")
+
+type historyCmdConfig struct {
+	MaxGenerations int  `json:"maxGenerations" mapstructure:"maxGenerations" yaml:"maxGenerations"`
+	RecordContents bool `json:"recordContents" mapstructure:"recordContents" yaml:"recordContents"`
+	format         writeDataFormat
+}
+
+// A generation records a single apply: when it started, the commit of the
+// source directory it applied, the entries it changed, and the scripts it ran.
+type generation struct {
+	Number       int                `json:"number"                 yaml:"number"`
+	StartedAt    time.Time          `json:"startedAt"              yaml:"startedAt"`
+	SourceCommit string             `json:"sourceCommit,omitempty" yaml:"sourceCommit,omitempty"`
+	Entries      []*generationEntry `json:"entries"                yaml:"entries"`
+	Scripts      []chezmoi.RelPath  `json:"scripts,omitempty"      yaml:"scripts,omitempty"`
+	pending      *generationEntry
+}
+
+// A generationEntry records the change of a single entry in a generation.
+type generationEntry struct {
+	Path           chezmoi.RelPath      `json:"path"   yaml:"path"`
+	Before         generationEntryState `json:"before" yaml:"before"`
+	After          generationEntryState `json:"after"  yaml:"after"`
+	beforeContents []byte
+	afterContents  []byte
+}
+
+// A generationEntryState records the state of an entry before or after a
+// generation. If ContentsRecorded is true then the contents of the entry are
+// in the object store.
+type generationEntryState struct {
+	Type             chezmoi.EntryStateType `json:"type"                       yaml:"type"`
+	Mode             fs.FileMode            `json:"mode,omitempty"             yaml:"mode,omitempty"`
+	ContentsSHA256   chezmoi.HexBytes       `json:"contentsSHA256,omitempty"   yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
+	ContentsRecorded bool                   `json:"contentsRecorded,omitempty" yaml:"contentsRecorded,omitempty"`
+}
+
+func (c *Config) newHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:     "history [generation]",
+		Short:   "Print the history of applies",
+		Long:    mustLongHelp("history"),
+		Example: example("history"),
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    c.runHistoryCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+
+	flags := historyCmd.Flags()
+	flags.VarP(&c.History.format, "format", "f", "Output format")
+	if err := historyCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+
+	return historyCmd
+}
+
+func (c *Config) runHistoryCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 {
+		generation, err := c.generationArg(args[0])
+		if err != nil {
+			return err
+		}
+		if c.History.format != "" {
+			return c.marshal(c.History.format, generation)
+		}
+		var builder strings.Builder
+		for _, generationEntry := range generation.Entries {
+			fmt.Fprintf(&builder, "%c %s\n", generationEntry.statusChar(), generationEntry.Path)
+		}
+		for _, script := range generation.Scripts {
+			fmt.Fprintf(&builder, "R %s\n", script)
+		}
+		return c.writeOutputString(builder.String())
+	}
+
+	generations, err := c.generations()
+	if err != nil {
+		return err
+	}
+	if c.History.format != "" {
+		return c.marshal(c.History.format, generations)
+	}
+	var builder strings.Builder
+	for _, generation := range generations {
+		sourceCommit := generation.SourceCommit
+		if len(sourceCommit) > 7 {
+			sourceCommit = sourceCommit[:7]
+		}
+		if sourceCommit == "" {
+			sourceCommit = "-"
+		}
+		fmt.Fprintf(&builder, "%d %s %s %d entries %d scripts\n",
+			generation.Number,
+			generation.StartedAt.Local().Format(time.RFC3339),
+			sourceCommit,
+			len(generation.Entries),
+			len(generation.Scripts),
+		)
+	}
+	return c.writeOutputString(builder.String())
+}
+
+// statusChar returns the character that summarizes e's change: A if the entry
+// was added, D if it was deleted, and M if it was modified.
+func (e *generationEntry) statusChar() rune {
+	switch {
+	case e.Before.Type == chezmoi.EntryStateTypeRemove:
+		return 'A'
+	case e.After.Type == chezmoi.EntryStateTypeRemove:
+		return 'D'
+	default:
+		return 'M'
+	}
+}
+
+// contentsRecorded returns true if the contents of all files and symlinks
+// changed by g were recorded.
+func (g *generation) contentsRecorded() bool {
+	for _, generationEntry := range g.Entries {
+		for _, state := range []*generationEntryState{&generationEntry.Before, &generationEntry.After} {
+			switch state.Type {
+			case chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeSymlink:
+				if !state.ContentsRecorded {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// commitGenerationEntry adds the pending entry of generation, if any, to
+// generation's entries.
+func (c *Config) commitGenerationEntry(generation *generation) error {
+	generationEntry := generation.pending
+	generation.pending = nil
+	if generationEntry == nil {
+		return nil
+	}
+	if c.History.RecordContents {
+		for _, x := range []struct {
+			state    *generationEntryState
+			contents []byte
+		}{
+			{&generationEntry.Before, generationEntry.beforeContents},
+			{&generationEntry.After, generationEntry.afterContents},
+		} {
+			switch x.state.Type {
+			case chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeSymlink:
+				if err := c.writeObject(x.state.ContentsSHA256, x.contents); err != nil {
+					return err
+				}
+				x.state.ContentsRecorded = true
+			}
+		}
+	}
+	generation.Entries = append(generation.Entries, generationEntry)
+	return nil
+}
+
+// generationArg returns the generation with the number arg.
+func (c *Config) generationArg(arg string) (*generation, error) {
+	number, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid generation", arg)
+	}
+	data, err := c.persistentState.Get(generationStateBucket, []byte(strconv.Itoa(number)))
+	switch {
+	case err != nil:
+		return nil, err
+	case data == nil:
+		return nil, fmt.Errorf("%d: generation not found", number)
+	}
+	var generation generation
+	if err := chezmoi.FormatJSON.Unmarshal(data, &generation); err != nil {
+		return nil, err
+	}
+	return &generation, nil
+}
+
+// generations returns all generations, oldest first.
+func (c *Config) generations() ([]*generation, error) {
+	var generations []*generation
+	if err := c.persistentState.ForEach(generationStateBucket, func(k, v []byte) error {
+		var generation generation
+		if err := chezmoi.FormatJSON.Unmarshal(v, &generation); err != nil {
+			return err
+		}
+		generations = append(generations, &generation)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i].Number < generations[j].Number
+	})
+	return generations, nil
+}
+
+// newGeneration returns a new generation, numbered after the most recent
+// generation.
+func (c *Config) newGeneration() (*generation, error) {
+	generations, err := c.generations()
+	if err != nil {
+		return nil, err
+	}
+	number := 1
+	if len(generations) > 0 {
+		number = generations[len(generations)-1].Number + 1
+	}
+	return &generation{
+		Number:       number,
+		StartedAt:    time.Now().UTC(),
+		SourceCommit: c.sourceCommit(),
+	}, nil
+}
+
+// newGenerationPreApplyFunc returns a chezmoi.PreApplyFunc that calls
+// preApplyFunc and then records the change of the entry as generation's
+// pending entry.
+func (c *Config) newGenerationPreApplyFunc(
+	generation *generation,
+	preApplyFunc chezmoi.PreApplyFunc,
+) chezmoi.PreApplyFunc {
+	return func(
+		targetRelPath chezmoi.RelPath,
+		targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+	) error {
+		if preApplyFunc != nil {
+			if err := preApplyFunc(targetRelPath, targetEntryState, lastWrittenEntryState, actualEntryState); err != nil {
+				return err
+			}
+		}
+		if targetEntryState.Type == chezmoi.EntryStateTypeScript || targetEntryState.Equivalent(actualEntryState) {
+			return nil
+		}
+		generation.pending = &generationEntry{
+			Path: targetRelPath,
+			Before: generationEntryState{
+				Type:           actualEntryState.Type,
+				Mode:           actualEntryState.Mode,
+				ContentsSHA256: actualEntryState.ContentsSHA256,
+			},
+			After: generationEntryState{
+				Type:           targetEntryState.Type,
+				Mode:           targetEntryState.Mode,
+				ContentsSHA256: targetEntryState.ContentsSHA256,
+			},
+			beforeContents: actualEntryState.Contents(),
+			afterContents:  targetEntryState.Contents(),
+		}
+		return nil
+	}
+}
+
+// recordGeneration records generation, together with the scripts run since it
+// started, and prunes old generations. Generations that changed nothing are not
+// recorded.
+func (c *Config) recordGeneration(generation *generation) {
+	if err := c.recordGenerationErr(generation); err != nil {
+		c.errorf("%v\n", err)
+	}
+}
+
+func (c *Config) recordGenerationErr(generation *generation) error {
+	scriptLogEntries, err := chezmoi.ScriptLogEntries(c.persistentState)
+	if err != nil {
+		return err
+	}
+	for _, scriptLogEntry := range scriptLogEntries {
+		if !scriptLogEntry.StartedAt.Before(generation.StartedAt) {
+			generation.Scripts = append(generation.Scripts, scriptLogEntry.Name)
+		}
+	}
+	if len(generation.Entries) == 0 && len(generation.Scripts) == 0 {
+		return nil
+	}
+
+	key := []byte(strconv.Itoa(generation.Number))
+	if err := chezmoi.PersistentStateSet(c.persistentState, generationStateBucket, key, generation); err != nil {
+		return err
+	}
+
+	if c.History.MaxGenerations <= 0 {
+		return nil
+	}
+	generations, err := c.generations()
+	if err != nil {
+		return err
+	}
+	if len(generations) <= c.History.MaxGenerations {
+		return nil
+	}
+	for _, generation := range generations[:len(generations)-c.History.MaxGenerations] {
+		if err := c.persistentState.Delete(generationStateBucket, []byte(strconv.Itoa(generation.Number))); err != nil {
+			return err
+		}
+	}
+	return c.removeUnreferencedObjects()
+}
+
+// sourceCommit returns the hash of the commit checked out in the working tree,
+// or the empty string if it cannot be determined.
+func (c *Config) sourceCommit() string {
+	rawWorkingTreeAbsPath, err := c.baseSystem.RawPath(c.WorkingTreeAbsPath)
+	if err != nil {
+		return ""
+	}
+	repo, err := gogit.PlainOpen(rawWorkingTreeAbsPath.String())
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// An httpConfig configures the HTTP client used for all of chezmoi's HTTP
+// requests.
+type httpConfig struct {
+	CACerts    []chezmoi.AbsPath `json:"caCerts"    mapstructure:"caCerts"    yaml:"caCerts"`
+	ClientCert chezmoi.AbsPath   `json:"clientCert" mapstructure:"clientCert" yaml:"clientCert"`
+	ClientKey  chezmoi.AbsPath   `json:"clientKey"  mapstructure:"clientKey"  yaml:"clientKey"`
+	NoProxy    []string          `json:"noProxy"    mapstructure:"noProxy"    yaml:"noProxy"`
+	Proxy      string            `json:"proxy"      mapstructure:"proxy"      yaml:"proxy"`
+}
+
+// newHTTPTransport returns a new http.Transport configured with c's proxy and
+// TLS settings.
+func (c *Config) newHTTPTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+
+	proxyFunc, err := c.HTTP.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxyFunc
+
+	tlsConfig, err := c.newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// newTLSConfig returns a new tls.Config with c's extra CA certificates and
+// client certificate, or nil if neither is configured.
+func (c *Config) newTLSConfig() (*tls.Config, error) {
+	if len(c.HTTP.CACerts) == 0 && c.HTTP.ClientCert.Empty() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(c.HTTP.CACerts) != 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		for _, caCertAbsPath := range c.HTTP.CACerts {
+			data, err := c.baseSystem.ReadFile(caCertAbsPath)
+			if err != nil {
+				return nil, err
+			}
+			if !rootCAs.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("%s: no certificates found", caCertAbsPath)
+			}
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if !c.HTTP.ClientCert.Empty() {
+		clientKeyAbsPath := c.HTTP.ClientKey
+		if clientKeyAbsPath.Empty() {
+			clientKeyAbsPath = c.HTTP.ClientCert
+		}
+		certPEMBlock, err := c.baseSystem.ReadFile(c.HTTP.ClientCert)
+		if err != nil {
+			return nil, err
+		}
+		keyPEMBlock, err := c.baseSystem.ReadFile(clientKeyAbsPath)
+		if err != nil {
+			return nil, err
+		}
+		clientCert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.HTTP.ClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return tlsConfig, nil
+}
+
+// proxyFunc returns the function that selects the proxy for each request. If
+// no proxy is configured then the proxy is taken from the environment.
+func (h *httpConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if h.Proxy == "" && len(h.NoProxy) == 0 {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyConfig := httpproxy.FromEnvironment()
+	if h.Proxy != "" {
+		if _, err := url.Parse(h.Proxy); err != nil {
+			return nil, fmt.Errorf("http.proxy: %w", err)
+		}
+		proxyConfig.HTTPProxy = h.Proxy
+		proxyConfig.HTTPSProxy = h.Proxy
+	}
+	if len(h.NoProxy) != 0 {
+		noProxy := nonEmptyStrings(append([]string{proxyConfig.NoProxy}, h.NoProxy...))
+		proxyConfig.NoProxy = strings.Join(noProxy, ",")
+	}
+	proxyURLFunc := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyURLFunc(req.URL)
+	}, nil
+}
+
+// nonEmptyStrings returns the non-empty strings in ss.
+func nonEmptyStrings(ss []string) []string {
+	result := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,481 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// identityMachineCommentPrefix prefixes the comment line in the identity file
+// that records the machine ID.
+const identityMachineCommentPrefix = "# machine: "
+
+var identityFileRelPath = chezmoi.NewRelPath("identity.txt")
+
+type identityConfig struct {
+	Generate bool            `json:"generate" mapstructure:"generate" yaml:"generate"`
+	Path     chezmoi.AbsPath `json:"path"     mapstructure:"path"     yaml:"path"`
+}
+
+type identityCmdConfig struct {
+	format   writeDataFormat
+	generate identityGenerateCmdConfig
+}
+
+type identityGenerateCmdConfig struct {
+	force bool
+}
+
+// A machineIdentity is the identity of the current machine.
+type machineIdentity struct {
+	MachineID string          `json:"machineID" yaml:"machineID"`
+	Hostname  string          `json:"hostname"  yaml:"hostname"`
+	Recipient string          `json:"recipient" yaml:"recipient"`
+	Path      chezmoi.AbsPath `json:"path"      yaml:"path"`
+}
+
+// A machineRegistry is the list of machines registered in the source
+// directory.
+type machineRegistry struct {
+	Machines []*registeredMachine `json:"machines" yaml:"machines"`
+}
+
+// A registeredMachine is a single machine in a machineRegistry.
+type registeredMachine struct {
+	MachineID    string    `json:"machineID"    yaml:"machineID"`
+	Hostname     string    `json:"hostname"     yaml:"hostname"`
+	Recipient    string    `json:"recipient"    yaml:"recipient"`
+	RegisteredAt time.Time `json:"registeredAt" yaml:"registeredAt"`
+}
+
+func (c *Config) newIdentityCmd() *cobra.Command {
+	identityCmd := &cobra.Command{
+		Use:     "identity",
+		Short:   "Manage the machine identity and registry",
+		Long:    mustLongHelp("identity"),
+		Example: example("identity"),
+	}
+
+	identityGenerateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate the machine identity",
+		Args:  cobra.NoArgs,
+		RunE:  c.runIdentityGenerateCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	identityGenerateFlags := identityGenerateCmd.Flags()
+	identityGenerateFlags.BoolVar(
+		&c.identity.generate.force,
+		"force",
+		c.identity.generate.force,
+		"Replace an existing identity",
+	)
+	identityCmd.AddCommand(identityGenerateCmd)
+
+	identityListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the registered machines",
+		Args:  cobra.NoArgs,
+		RunE:  c.runIdentityListCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	identityListFlags := identityListCmd.Flags()
+	identityListFlags.VarP(&c.identity.format, "format", "f", "Output format")
+	if err := identityListCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+	identityCmd.AddCommand(identityListCmd)
+
+	identityRecipientsCmd := &cobra.Command{
+		Use:   "recipients [machine...]",
+		Short: "Print the age recipients of registered machines",
+		RunE:  c.runIdentityRecipientsCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	identityCmd.AddCommand(identityRecipientsCmd)
+
+	identityRegisterCmd := &cobra.Command{
+		Use:   "register",
+		Short: "Register the machine identity in the source directory",
+		Args:  cobra.NoArgs,
+		RunE:  c.runIdentityRegisterCmd,
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+	identityCmd.AddCommand(identityRegisterCmd)
+
+	identityRemoveCmd := &cobra.Command{
+		Use:   "remove machine...",
+		Short: "Remove machines from the registry",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  c.runIdentityRemoveCmd,
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+	identityCmd.AddCommand(identityRemoveCmd)
+
+	identityShowCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the machine identity",
+		Args:  cobra.NoArgs,
+		RunE:  c.runIdentityShowCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	identityShowFlags := identityShowCmd.Flags()
+	identityShowFlags.VarP(&c.identity.format, "format", "f", "Output format")
+	if err := identityShowCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+	identityCmd.AddCommand(identityShowCmd)
+
+	return identityCmd
+}
+
+func (c *Config) runIdentityGenerateCmd(cmd *cobra.Command, args []string) error {
+	identity, err := c.generateMachineIdentity(c.identity.generate.force)
+	if err != nil {
+		return err
+	}
+	return c.writeOutputString(identity.Recipient + "\n")
+}
+
+func (c *Config) runIdentityListCmd(cmd *cobra.Command, args []string) error {
+	registry, err := c.readMachineRegistry()
+	if err != nil {
+		return err
+	}
+	if c.identity.format != "" {
+		return c.marshal(c.identity.format, registry.Machines)
+	}
+	var builder strings.Builder
+	for _, machine := range registry.Machines {
+		fmt.Fprintf(&builder, "%s %s %s\n", machine.MachineID, machine.Hostname, machine.Recipient)
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runIdentityRecipientsCmd(cmd *cobra.Command, args []string) error {
+	recipients, err := c.machineRecipients(args...)
+	if err != nil {
+		return err
+	}
+	var builder strings.Builder
+	for _, recipient := range recipients {
+		builder.WriteString(recipient)
+		builder.WriteByte('\n')
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runIdentityRegisterCmd(cmd *cobra.Command, args []string) error {
+	identity, err := c.readMachineIdentity()
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return errors.New("no machine identity, run chezmoi identity generate first")
+	}
+	registry, err := c.readMachineRegistry()
+	if err != nil {
+		return err
+	}
+	registry.Machines = slices.DeleteFunc(registry.Machines, func(machine *registeredMachine) bool {
+		return machine.MachineID == identity.MachineID
+	})
+	registry.Machines = append(registry.Machines, &registeredMachine{
+		MachineID:    identity.MachineID,
+		Hostname:     identity.Hostname,
+		Recipient:    identity.Recipient,
+		RegisteredAt: time.Now().UTC().Truncate(time.Second),
+	})
+	return c.writeMachineRegistry(registry)
+}
+
+func (c *Config) runIdentityRemoveCmd(cmd *cobra.Command, args []string) error {
+	registry, err := c.readMachineRegistry()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		index := slices.IndexFunc(registry.Machines, func(machine *registeredMachine) bool {
+			return machine.matches(arg)
+		})
+		if index == -1 {
+			return fmt.Errorf("%s: machine not registered", arg)
+		}
+		registry.Machines = slices.Delete(registry.Machines, index, index+1)
+	}
+	return c.writeMachineRegistry(registry)
+}
+
+func (c *Config) runIdentityShowCmd(cmd *cobra.Command, args []string) error {
+	identity, err := c.readMachineIdentity()
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return errors.New("no machine identity, run chezmoi identity generate first")
+	}
+	if c.identity.format != "" {
+		return c.marshal(c.identity.format, identity)
+	}
+	return c.writeOutputString(fmt.Sprintf(
+		"machineID: %s\nrecipient: %s\npath: %s\n",
+		identity.MachineID, identity.Recipient, identity.Path,
+	))
+}
+
+// generateMachineIdentity generates a new age identity for the current machine
+// and writes it to the identity file. If an identity already exists then it is
+// returned unless force is true.
+func (c *Config) generateMachineIdentity(force bool) (*machineIdentity, error) {
+	if !force {
+		switch identity, err := c.readMachineIdentity(); {
+		case err != nil:
+			return nil, err
+		case identity != nil:
+			return identity, nil
+		}
+	}
+
+	identityFileAbsPath, err := c.identityFile()
+	if err != nil {
+		return nil, err
+	}
+	x25519Identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, err
+	}
+	machineID := c.machineUUIDTemplateFunc("identity")
+	recipient := x25519Identity.Recipient().String()
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# created: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&builder, "%s%s\n", identityMachineCommentPrefix, machineID)
+	fmt.Fprintf(&builder, "# public key: %s\n", recipient)
+	fmt.Fprintf(&builder, "%s\n", x25519Identity)
+	if err := chezmoi.MkdirAll(c.baseSystem, identityFileAbsPath.Dir(), fs.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := c.baseSystem.WriteFile(identityFileAbsPath, []byte(builder.String()), 0o600); err != nil {
+		return nil, err
+	}
+
+	return &machineIdentity{
+		MachineID: machineID,
+		Hostname:  c.getTemplateData(nil).hostname,
+		Recipient: recipient,
+		Path:      identityFileAbsPath,
+	}, nil
+}
+
+// identityFile returns the absolute path to the identity file.
+func (c *Config) identityFile() (chezmoi.AbsPath, error) {
+	if !c.Identity.Path.Empty() {
+		return c.Identity.Path, nil
+	}
+	if !c.getConfigFileAbsPath().Empty() {
+		return c.getConfigFileAbsPath().Dir().Join(identityFileRelPath), nil
+	}
+	defaultConfigFileAbsPath, err := c.defaultConfigFile(c.fileSystem, c.bds)
+	if err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	return defaultConfigFileAbsPath.Dir().Join(identityFileRelPath), nil
+}
+
+// machineRecipients returns the age recipients of the registered machines
+// matching machines, or of all registered machines if machines is empty.
+func (c *Config) machineRecipients(machines ...string) ([]string, error) {
+	registry, err := c.readMachineRegistry()
+	if err != nil {
+		return nil, err
+	}
+	if len(machines) == 0 {
+		recipients := make([]string, 0, len(registry.Machines))
+		for _, machine := range registry.Machines {
+			recipients = append(recipients, machine.Recipient)
+		}
+		return recipients, nil
+	}
+	recipients := make([]string, 0, len(machines))
+	for _, arg := range machines {
+		index := slices.IndexFunc(registry.Machines, func(machine *registeredMachine) bool {
+			return machine.matches(arg)
+		})
+		if index == -1 {
+			return nil, fmt.Errorf("%s: machine not registered", arg)
+		}
+		recipients = append(recipients, registry.Machines[index].Recipient)
+	}
+	return recipients, nil
+}
+
+// readMachineIdentity reads the identity of the current machine. It returns
+// nil if the identity has not been generated.
+func (c *Config) readMachineIdentity() (*machineIdentity, error) {
+	identityFileAbsPath, err := c.identityFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.baseSystem.ReadFile(identityFileAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	identity := &machineIdentity{
+		Hostname: c.getTemplateData(nil).hostname,
+		Path:     identityFileAbsPath,
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, identityMachineCommentPrefix):
+			identity.MachineID = strings.TrimPrefix(line, identityMachineCommentPrefix)
+		case strings.HasPrefix(line, "AGE-SECRET-KEY-"):
+			x25519Identity, err := age.ParseX25519Identity(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", identityFileAbsPath, err)
+			}
+			identity.Recipient = x25519Identity.Recipient().String()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case identity.MachineID == "":
+		return nil, fmt.Errorf("%s: no machine ID", identityFileAbsPath)
+	case identity.Recipient == "":
+		return nil, fmt.Errorf("%s: no identity", identityFileAbsPath)
+	}
+	return identity, nil
+}
+
+// readMachineRegistry reads the machine registry from the source directory.
+func (c *Config) readMachineRegistry() (*machineRegistry, error) {
+	var registry machineRegistry
+	registryAbsPath := c.SourceDirAbsPath.JoinString(chezmoi.MachinesName)
+	switch data, err := c.sourceSystem.ReadFile(registryAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+		return &registry, nil
+	case err != nil:
+		return nil, err
+	default:
+		if err := chezmoi.FormatYAML.Unmarshal(data, &registry); err != nil {
+			return nil, fmt.Errorf("%s: %w", registryAbsPath, err)
+		}
+		return &registry, nil
+	}
+}
+
+// writeMachineRegistry writes registry to the source directory.
+func (c *Config) writeMachineRegistry(registry *machineRegistry) error {
+	slices.SortFunc(registry.Machines, func(a, b *registeredMachine) int {
+		if a.Hostname != b.Hostname {
+			return strings.Compare(a.Hostname, b.Hostname)
+		}
+		return strings.Compare(a.MachineID, b.MachineID)
+	})
+	data, err := chezmoi.FormatYAML.Marshal(registry)
+	if err != nil {
+		return err
+	}
+	return c.sourceSystem.WriteFile(c.SourceDirAbsPath.JoinString(chezmoi.MachinesName), data, 0o666&^c.Umask)
+}
+
+// matches returns true if m's machine ID or hostname is machine.
+func (m *registeredMachine) matches(machine string) bool {
+	return m.MachineID == machine || m.Hostname == machine
+}
+
+// machineIdentityTemplateFunc returns the identity of the current machine, or
+// nil if it has not been generated.
+func (c *Config) machineIdentityTemplateFunc() map[string]any {
+	identity, err := c.readMachineIdentity()
+	if err != nil {
+		panic(err)
+	}
+	if identity == nil {
+		return nil
+	}
+	return map[string]any{
+		"machineID": identity.MachineID,
+		"hostname":  identity.Hostname,
+		"recipient": identity.Recipient,
+		"path":      identity.Path.String(),
+	}
+}
+
+// machinesTemplateFunc returns the machines in the registry.
+func (c *Config) machinesTemplateFunc() []any {
+	registry, err := c.readMachineRegistry()
+	if err != nil {
+		panic(err)
+	}
+	machines := make([]any, 0, len(registry.Machines))
+	for _, machine := range registry.Machines {
+		machines = append(machines, map[string]any{
+			"machineID":    machine.MachineID,
+			"hostname":     machine.Hostname,
+			"recipient":    machine.Recipient,
+			"registeredAt": machine.RegisteredAt,
+		})
+	}
+	return machines
+}
+
+// machineRecipientsTemplateFunc returns the age recipients of the registered
+// machines matching machines, or of all registered machines if machines is
+// empty.
+func (c *Config) machineRecipientsTemplateFunc(machines ...string) []string {
+	recipients, err := c.machineRecipients(machines...)
+	if err != nil {
+		panic(err)
+	}
+	return recipients
+}
+
+// ensureMachineIdentity generates the machine identity if it is configured to
+// be generated and does not already exist.
+func (c *Config) ensureMachineIdentity() error {
+	if !c.Identity.Generate && !c.init.identity {
+		return nil
+	}
+	identity, err := c.generateMachineIdentity(false)
+	if err != nil {
+		return err
+	}
+	if c.Verbose {
+		c.errorf("machine identity %s: %s\n", identity.MachineID, identity.Recipient)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -8,6 +9,10 @@ import (
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+type ignoredCmdConfig struct {
+	patterns bool
+}
+
 func (c *Config) newIgnoredCmd() *cobra.Command {
 	ignoredCmd := &cobra.Command{
 		Use:         "ignored",
@@ -19,12 +24,21 @@ func (c *Config) newIgnoredCmd() *cobra.Command {
 		Annotations: newAnnotations(),
 	}
 
+	flags := ignoredCmd.Flags()
+	flags.BoolVarP(&c.ignored.patterns, "patterns", "p", c.ignored.patterns, "Print the pattern that ignores each target")
+
 	return ignoredCmd
 }
 
 func (c *Config) runIgnoredCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
 	builder := strings.Builder{}
 	for _, relPath := range sourceState.Ignored() {
+		if c.ignored.patterns {
+			if pattern := sourceState.IgnorePattern(relPath); pattern != "" {
+				fmt.Fprintf(&builder, "%s %s\n", relPath, pattern)
+				continue
+			}
+		}
 		if _, err := builder.WriteString(relPath.String()); err != nil {
 			return err
 		}
@@ -1,19 +1,38 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+// importExternalRelPath is the path of the file that chezmoi import --external
+// writes externals to, relative to the source directory.
+var importExternalRelPath = chezmoi.NewRelPath(chezmoi.Prefix + "external.toml")
+
 type importCmdConfig struct {
+	autoTemplate      bool
+	create            bool
 	destination       chezmoi.AbsPath
+	encrypt           bool
 	exact             bool
+	external          bool
 	filter            *chezmoi.EntryTypeFilter
+	format            chezmoi.ArchiveFormat
+	pathMap           map[string]string
+	preset            string
+	private           bool
+	readOnly          bool
 	removeDestination bool
 	stripComponents   int
+	template          bool
 }
 
 func (c *Config) newImportCmd() *cobra.Command {
@@ -40,7 +59,11 @@ func (c *Config) newImportCmd() *cobra.Command {
 		"Set exact_ attribute on imported directories",
 	)
 	flags.VarP(c._import.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.BoolVar(&c._import.external, "external", c._import.external, "Add an external instead of importing")
+	flags.Var(&c._import.format, "format", "Set archive format")
 	flags.VarP(c._import.filter.Include, "include", "i", "Include entry types")
+	flags.StringToStringVar(&c._import.pathMap, "map", c._import.pathMap, "Map paths in the archive to destinations")
+	flags.StringVar(&c._import.preset, "preset", c._import.preset, "Set attributes from preset")
 	flags.BoolVarP(
 		&c._import.removeDestination,
 		"remove-destination",
@@ -56,23 +79,46 @@ func (c *Config) newImportCmd() *cobra.Command {
 	)
 
 	registerExcludeIncludeFlagCompletionFuncs(importCmd)
+	if err := importCmd.RegisterFlagCompletionFunc("preset", c.addPresetFlagCompletionFunc); err != nil {
+		panic(err)
+	}
 
 	return importCmd
 }
 
 func (c *Config) runImportCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	if c._import.external {
+		return c.runImportExternal(args, sourceState)
+	}
+
+	if c._import.preset != "" {
+		if err := c.applyImportPreset(c._import.preset); err != nil {
+			return err
+		}
+	}
+
 	var (
 		name string
 		data []byte
 	)
-	if len(args) == 0 {
-		name = ".tar"
+	switch {
+	case len(args) == 0:
 		var err error
 		data, err = io.ReadAll(c.stdin)
 		if err != nil {
 			return err
 		}
-	} else {
+	case isImportURL(args[0]):
+		archiveURL, err := url.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		name = archiveURL.Path
+		data, err = c.downloadURL(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+	default:
 		absPath, err := chezmoi.NewAbsPathFromExtPath(args[0], c.homeDirAbsPath)
 		if err != nil {
 			return err
@@ -84,9 +130,10 @@ func (c *Config) runImportCmd(cmd *cobra.Command, args []string, sourceState *ch
 		}
 	}
 	archiveReaderSystem, err := chezmoi.NewArchiveReaderSystem(
-		name, data, chezmoi.ArchiveFormatUnknown, chezmoi.ArchiveReaderSystemOptions{
+		name, data, c._import.format, chezmoi.ArchiveReaderSystemOptions{
 			RootAbsPath:     c._import.destination,
 			StripComponents: c._import.stripComponents,
+			PathMap:         c._import.pathMap,
 		},
 	)
 	if err != nil {
@@ -99,15 +146,115 @@ func (c *Config) runImportCmd(cmd *cobra.Command, args []string, sourceState *ch
 			return err
 		}
 	}
+	var autoTemplateRules []chezmoi.AutoTemplateRule
+	if c._import.autoTemplate {
+		autoTemplateRules, err = c.autoTemplateRules()
+		if err != nil {
+			return err
+		}
+	}
 	return sourceState.Add(
 		c.sourceSystem,
 		c.persistentState,
 		archiveReaderSystem,
 		archiveReaderSystem.FileInfos(),
 		&chezmoi.AddOptions{
-			Exact:     c._import.exact,
-			Filter:    c._import.filter,
-			RemoveDir: removeDir,
+			AutoTemplate:      c._import.autoTemplate,
+			AutoTemplateRules: autoTemplateRules,
+			Create:            c._import.create,
+			Encrypt:           c._import.encrypt,
+			EncryptedSuffix:   c.encryption.EncryptedSuffix(),
+			Exact:             c._import.exact,
+			Filter:            c._import.filter,
+			Private:           c._import.private,
+			ReadOnly:          c._import.readOnly,
+			RemoveDir:         removeDir,
+			Template:          c._import.template,
 		},
 	)
 }
+
+// runImportExternal adds an archive external for the URL in args at the
+// destination to the source state instead of importing the archive.
+func (c *Config) runImportExternal(args []string, sourceState *chezmoi.SourceState) error {
+	switch {
+	case len(args) == 0 || !isImportURL(args[0]):
+		return errors.New("--external: archive must be a URL")
+	case len(c._import.pathMap) != 0:
+		return errors.New("--external: cannot be used with --map")
+	case c._import.preset != "":
+		return errors.New("--external: cannot be used with --preset")
+	}
+
+	targetRelPath, err := c._import.destination.TrimDirPrefix(c.DestDirAbsPath)
+	if err != nil {
+		return err
+	}
+	if targetRelPath.Empty() {
+		return errors.New("--external: destination must be a subdirectory of the destination directory")
+	}
+	if _, externals := sourceState.Externals(); len(externals[targetRelPath]) != 0 {
+		return fmt.Errorf("%s: already an external", targetRelPath)
+	}
+
+	external := map[string]any{
+		"type": chezmoi.ExternalTypeArchive,
+		"url":  args[0],
+	}
+	if c._import.exact {
+		external["exact"] = true
+	}
+	if c._import.format != chezmoi.ArchiveFormatUnknown {
+		external["format"] = c._import.format
+	}
+	if c._import.stripComponents != 0 {
+		external["stripComponents"] = c._import.stripComponents
+	}
+	data, err := chezmoi.FormatTOML.Marshal(map[string]any{
+		targetRelPath.String(): external,
+	})
+	if err != nil {
+		return err
+	}
+
+	externalAbsPath := c.sourceDirAbsPath.Join(importExternalRelPath)
+	switch contents, err := c.sourceSystem.ReadFile(externalAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	case len(contents) != 0:
+		if !strings.HasSuffix(string(contents), "\n") {
+			contents = append(contents, '\n')
+		}
+		data = append(append(contents, '\n'), data...)
+	}
+	return c.sourceSystem.WriteFile(externalAbsPath, data, 0o666)
+}
+
+// applyImportPreset sets the attributes in preset, which is a list of
+// attributes or the names of add presets in the config file separated by +s.
+func (c *Config) applyImportPreset(preset string) error {
+	return c.walkAddPreset(preset, make(map[string]struct{}), func(attribute string) {
+		switch attribute {
+		case "autotemplate":
+			c._import.autoTemplate = true
+		case "create":
+			c._import.create = true
+		case "encrypt":
+			c._import.encrypt = true
+		case "exact":
+			c._import.exact = true
+		case "private":
+			c._import.private = true
+		case "readonly":
+			c._import.readOnly = true
+		case "template":
+			c._import.template = true
+		}
+	})
+}
+
+// isImportURL returns if arg is the URL of an archive to import.
+func isImportURL(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
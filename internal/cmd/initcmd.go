@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/fs"
 	"regexp"
-	"strconv"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -25,6 +24,7 @@ type initCmdConfig struct {
 	depth             int
 	filter            *chezmoi.EntryTypeFilter
 	guessRepoURL      bool
+	identity          bool
 	oneShot           bool
 	purge             bool
 	purgeBinary       bool
@@ -97,6 +97,7 @@ func (c *Config) newInitCmd() *cobra.Command {
 			persistentStateModeReadWrite,
 			requiresWorkingTree,
 			runsCommands,
+			writesSecrets,
 		),
 	}
 
@@ -110,6 +111,7 @@ func (c *Config) newInitCmd() *cobra.Command {
 	flags.VarP(c.init.filter.Exclude, "exclude", "x", "Exclude entry types")
 	flags.BoolVarP(&c.init.guessRepoURL, "guess-repo-url", "g", c.init.guessRepoURL, "Guess the repo URL")
 	flags.VarP(c.init.filter.Include, "include", "i", "Include entry types")
+	flags.BoolVar(&c.init.identity, "identity", c.init.identity, "Generate the machine identity")
 	flags.BoolVar(&c.init.oneShot, "one-shot", c.init.oneShot, "Run in one-shot mode")
 	flags.BoolVarP(&c.init.purge, "purge", "p", c.init.purge, "Purge config and source directories after running")
 	flags.BoolVarP(&c.init.purgeBinary, "purge-binary", "P", c.init.purgeBinary, "Purge chezmoi binary after running")
@@ -119,32 +121,64 @@ func (c *Config) newInitCmd() *cobra.Command {
 	return initCmd
 }
 
-func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
+func (c *Config) runInitCmd(cmd *cobra.Command, args []string) (err error) {
 	if c.init.oneShot {
 		c.force = true
 		c.init.apply = true
 		c.init.depth = 1
 		c.init.purge = true
 		c.init.purgeBinary = true
+		c.interactiveTemplateFuncs.promptDefaults = true
 	}
 
+	// Purge. In one-shot mode, if initializing or applying failed, only purge
+	// the config and persistent state, keeping the binary and source directory
+	// so that the failure can be investigated and chezmoi run again.
+	defer func() {
+		switch {
+		case !c.init.purge && !c.init.purgeBinary:
+			return
+		case err != nil && !c.init.oneShot:
+			return
+		case err != nil:
+			if purgeErr := c.doPurge(&doPurgeOptions{
+				config:          true,
+				persistentState: true,
+			}); purgeErr != nil {
+				c.errorf("warning: %v\n", purgeErr)
+			}
+			return
+		}
+		if purgeErr := c.doPurge(&doPurgeOptions{
+			binary:          c.init.purgeBinary,
+			cache:           c.init.purge,
+			config:          c.init.purge,
+			persistentState: c.init.purge,
+			sourceDir:       c.init.purge,
+			workingTree:     c.init.purge,
+		}); err == nil {
+			err = purgeErr
+		}
+	}()
+
 	// If we're not in a working tree then init it or clone it.
-	gitDirAbsPath := c.WorkingTreeAbsPath.JoinString(git.GitDirName)
-	switch _, err := c.baseSystem.Stat(gitDirAbsPath); {
+	vcs, err := c.vcs()
+	if err != nil {
+		return err
+	}
+	if c.VCS == "" && len(args) != 0 && isSourceArchiveURL(args[0]) {
+		vcs = archiveVCS{}
+	}
+	vcsDirAbsPath := c.WorkingTreeAbsPath.JoinString(vcs.dirName())
+	switch _, err := c.baseSystem.Stat(vcsDirAbsPath); {
 	case errors.Is(err, fs.ErrNotExist):
 		workingTreeRawPath, err := c.baseSystem.RawPath(c.WorkingTreeAbsPath)
 		if err != nil {
 			return err
 		}
 
-		useBuiltinGit := c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc)
-
 		if len(args) == 0 {
-			if useBuiltinGit {
-				if err := c.builtinGitInit(workingTreeRawPath); err != nil {
-					return err
-				}
-			} else if err := c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"init", "--quiet"}); err != nil {
+			if err := vcs.init(c, workingTreeRawPath); err != nil {
 				return err
 			}
 		} else {
@@ -154,33 +188,8 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 			} else {
 				repoURLStr = args[0]
 			}
-			if useBuiltinGit {
-				if err := c.builtinGitClone(repoURLStr, workingTreeRawPath); err != nil {
-					return err
-				}
-			} else {
-				args := []string{
-					"clone",
-				}
-				if c.init.recurseSubmodules {
-					args = append(args,
-						"--recurse-submodules",
-					)
-				}
-				if c.init.branch != "" {
-					args = append(args,
-						"--branch", c.init.branch,
-					)
-				}
-				if c.init.depth != 0 {
-					args = append(args,
-						"--depth", strconv.Itoa(c.init.depth),
-					)
-				}
-				args = append(args, repoURLStr, workingTreeRawPath.String())
-				if err := c.run(chezmoi.EmptyAbsPath, c.Git.Command, args); err != nil {
-					return err
-				}
+			if err := vcs.clone(c, repoURLStr, workingTreeRawPath); err != nil {
+				return err
 			}
 		}
 	case err != nil:
@@ -195,11 +204,17 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := c.ensureMachineIdentity(); err != nil {
+		return err
+	}
+
 	// Apply.
 	if c.init.apply {
 		if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, noArgs, applyArgsOptions{
 			cmd:          cmd,
 			filter:       c.init.filter,
+			history:      !c.dryRun,
+			provision:    true,
 			recursive:    false,
 			umask:        c.Umask,
 			preApplyFunc: c.defaultPreApplyFunc,
@@ -208,20 +223,6 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Purge.
-	if c.init.purge || c.init.purgeBinary {
-		if err := c.doPurge(&doPurgeOptions{
-			binary:          c.init.purgeBinary,
-			cache:           c.init.purge,
-			config:          c.init.purge,
-			persistentState: c.init.purge,
-			sourceDir:       c.init.purge,
-			workingTree:     c.init.purge,
-		}); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -16,6 +16,18 @@ func (c *Config) newInternalTestCmd() *cobra.Command {
 		Hidden: true,
 	}
 
+	internalTestPanicCmd := &cobra.Command{
+		Use:   "panic",
+		Args:  cobra.NoArgs,
+		Short: "Panic while holding the persistent state and writing a temporary file",
+		RunE:  c.runInternalTestPanicCmd,
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+			persistentStateModeReadWrite,
+		),
+	}
+	internalTestCmd.AddCommand(internalTestPanicCmd)
+
 	internalTestPromptBoolCmd := &cobra.Command{
 		Use:   "prompt-bool",
 		Args:  cobra.MinimumNArgs(1),
@@ -74,6 +86,18 @@ func (c *Config) newInternalTestCmd() *cobra.Command {
 	return internalTestCmd
 }
 
+func (c *Config) runInternalTestPanicCmd(cmd *cobra.Command, args []string) error {
+	if err := chezmoi.MkdirAll(c.baseSystem, c.CacheDirAbsPath, 0o700); err != nil {
+		return err
+	}
+	tempAbsPath := c.CacheDirAbsPath.JoinString(".internal-test-panic.tmp")
+	c.tempAbsPaths[tempAbsPath] = struct{}{}
+	if err := c.baseSystem.WriteFile(tempAbsPath, []byte("partial"), 0o600); err != nil {
+		return err
+	}
+	panic("test panic")
+}
+
 func (c *Config) runInternalTestPromptBoolCmd(cmd *cobra.Command, args []string) error {
 	boolArgs := make([]bool, 0, len(args)-1)
 	for _, arg := range args[1:] {
@@ -0,0 +1,132 @@
+//go:build !freebsd || (freebsd && cgo)
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// A keyringItem identifies an item in a keyring. service and user identify the
+// item on all platforms. The remaining fields are only used by the backends
+// that support them and are ignored by the others.
+type keyringItem struct {
+	service    string
+	user       string
+	collection string            // Secret Service collection or macOS keychain.
+	target     string            // Windows Credential Manager target name.
+	label      string            // Item label.
+	attributes map[string]string // Extra item attributes.
+}
+
+// A keyringBackend is a keyring that stores values for keyringItems.
+type keyringBackend interface {
+	Delete(item *keyringItem) error
+	Get(item *keyringItem) (string, error)
+	Set(item *keyringItem, value string) error
+}
+
+// A goKeyringBackend is a keyringBackend that uses
+// github.com/zalando/go-keyring and only supports service and user.
+type goKeyringBackend struct{}
+
+// Delete implements keyringBackend.Delete.
+func (goKeyringBackend) Delete(item *keyringItem) error {
+	return keyring.Delete(item.service, item.user)
+}
+
+// Get implements keyringBackend.Get.
+func (goKeyringBackend) Get(item *keyringItem) (string, error) {
+	return keyring.Get(item.service, item.user)
+}
+
+// Set implements keyringBackend.Set.
+func (goKeyringBackend) Set(item *keyringItem, value string) error {
+	return keyring.Set(item.service, item.user, value)
+}
+
+// newKeyringItem returns a new keyringItem for service and user with options.
+// Valid options are collection, target, label, and attributes.
+func newKeyringItem(service, user string, options map[string]any) (*keyringItem, error) {
+	item := &keyringItem{
+		service: service,
+		user:    user,
+	}
+	for key, value := range options {
+		switch key {
+		case "collection", "label", "target":
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a string, got a %T", key, value)
+			}
+			switch key {
+			case "collection":
+				item.collection = s
+			case "label":
+				item.label = s
+			case "target":
+				item.target = s
+			}
+		case "attributes":
+			attributes, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a map, got a %T", key, value)
+			}
+			item.attributes = make(map[string]string, len(attributes))
+			for attributeKey, attributeValue := range attributes {
+				item.attributes[attributeKey] = fmt.Sprint(attributeValue)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown option", key)
+		}
+	}
+	return item, nil
+}
+
+// cacheKey returns a key that uniquely identifies item.
+func (i *keyringItem) cacheKey() string {
+	attributes := make([]string, 0, len(i.attributes))
+	for key, value := range i.attributes {
+		attributes = append(attributes, key+"="+value)
+	}
+	sort.Strings(attributes)
+	return strings.Join(append([]string{
+		i.service, i.user, i.collection, i.target, i.label,
+	}, attributes...), "\x00")
+}
+
+// String implements fmt.Stringer.String.
+func (i *keyringItem) String() string {
+	return i.service + " " + i.user
+}
+
+// keyringBackend returns c's keyring backend.
+func (c *Config) keyringBackend() keyringBackend {
+	if c.keyring.backend == nil {
+		c.keyring.backend = newKeyringBackend()
+	}
+	return c.keyring.backend
+}
+
+// keyringSet sets item to value. If item already has value then keyringSet does
+// nothing. It returns true if item was modified.
+func (c *Config) keyringSet(item *keyringItem, value string) (bool, error) {
+	switch currentValue, err := c.keyringBackend().Get(item); {
+	case errors.Is(err, keyring.ErrNotFound):
+	case err != nil:
+		return false, err
+	case currentValue == value:
+		return false, nil
+	}
+	if c.dryRun {
+		return true, nil
+	}
+	if err := c.keyringBackend().Set(item, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+const (
+	keychainSecurityCommand = "/usr/bin/security"
+
+	// keychainEncodingPrefix and keychainBase64EncodingPrefix are the
+	// prefixes used by github.com/zalando/go-keyring to encode values.
+	keychainEncodingPrefix       = "go-keyring-encoded:"
+	keychainBase64EncodingPrefix = "go-keyring-base64:"
+)
+
+// keychainAttributeFlags maps macOS keychain item attributes to their
+// security(1) flags.
+var keychainAttributeFlags = map[string]string{
+	"comment": "-j",
+	"creator": "-c",
+	"generic": "-G",
+	"kind":    "-D",
+	"type":    "-C",
+}
+
+// A keychainKeyringBackend is a keyringBackend that uses the macOS keychain,
+// which supports keychains as collections, labels, and item attributes.
+type keychainKeyringBackend struct {
+	goKeyringBackend
+}
+
+func newKeyringBackend() keyringBackend {
+	return keychainKeyringBackend{}
+}
+
+// Delete implements keyringBackend.Delete.
+func (b keychainKeyringBackend) Delete(item *keyringItem) error {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Delete(item)
+	}
+	args := []string{"delete-generic-password", "-s", item.service, "-a", item.user}
+	if item.collection != "" {
+		args = append(args, item.collection)
+	}
+	_, err := b.run(args)
+	return err
+}
+
+// Get implements keyringBackend.Get.
+func (b keychainKeyringBackend) Get(item *keyringItem) (string, error) {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Get(item)
+	}
+	args := []string{"find-generic-password", "-s", item.service, "-a", item.user}
+	if item.label != "" {
+		args = append(args, "-l", item.label)
+	}
+	attributeArgs, err := b.attributeArgs(item)
+	if err != nil {
+		return "", err
+	}
+	args = append(args, attributeArgs...)
+	args = append(args, "-w")
+	if item.collection != "" {
+		args = append(args, item.collection)
+	}
+	output, err := b.run(args)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(output))
+	switch {
+	case strings.HasPrefix(value, keychainEncodingPrefix):
+		decodedValue, err := hex.DecodeString(strings.TrimPrefix(value, keychainEncodingPrefix))
+		return string(decodedValue), err
+	case strings.HasPrefix(value, keychainBase64EncodingPrefix):
+		decodedValue, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, keychainBase64EncodingPrefix))
+		return string(decodedValue), err
+	default:
+		return value, nil
+	}
+}
+
+// Set implements keyringBackend.Set.
+func (b keychainKeyringBackend) Set(item *keyringItem, value string) error {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Set(item, value)
+	}
+	// Encode the value in the same way as github.com/zalando/go-keyring so
+	// that multi-line and non-ASCII values are returned unmodified.
+	encodedValue := keychainBase64EncodingPrefix + base64.StdEncoding.EncodeToString([]byte(value))
+	args := []string{"add-generic-password", "-U", "-s", item.service, "-a", item.user, "-w", encodedValue}
+	if item.label != "" {
+		args = append(args, "-l", item.label)
+	}
+	attributeArgs, err := b.attributeArgs(item)
+	if err != nil {
+		return err
+	}
+	args = append(args, attributeArgs...)
+	if item.collection != "" {
+		args = append(args, item.collection)
+	}
+
+	// Pass the command on the standard input of security(1) so that the value
+	// does not appear in the process list.
+	quotedArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		quotedArgs = append(quotedArgs, shellQuote(arg))
+	}
+	command := strings.Join(quotedArgs, " ") + "\n"
+	if len(command) > 4096 {
+		return keyring.ErrSetDataTooBig
+	}
+	cmd := exec.Command(keychainSecurityCommand, "-i")
+	cmd.Stdin = strings.NewReader(command)
+	if output, err := chezmoilog.LogCmdCombinedOutput(cmd); err != nil {
+		return newCmdOutputError(cmd, output, err)
+	}
+	return nil
+}
+
+// attributeArgs returns the security(1) arguments for item's attributes.
+func (keychainKeyringBackend) attributeArgs(item *keyringItem) ([]string, error) {
+	keys := make([]string, 0, len(item.attributes))
+	for key := range item.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	args := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		flag, ok := keychainAttributeFlags[key]
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported keychain attribute", key)
+		}
+		args = append(args, flag, item.attributes[key])
+	}
+	return args, nil
+}
+
+// extended returns if item uses any options that go-keyring does not support.
+func (keychainKeyringBackend) extended(item *keyringItem) bool {
+	return item.collection != "" || item.label != "" || len(item.attributes) != 0
+}
+
+// run runs security(1) with args and returns its output.
+func (keychainKeyringBackend) run(args []string) ([]byte, error) {
+	cmd := exec.Command(keychainSecurityCommand, args...)
+	output, err := chezmoilog.LogCmdCombinedOutput(cmd)
+	switch {
+	case err != nil && strings.Contains(string(output), "could not be found"):
+		return nil, keyring.ErrNotFound
+	case err != nil:
+		return nil, newCmdOutputError(cmd, output, err)
+	default:
+		return output, nil
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !darwin && !windows && !freebsd && !linux && !netbsd && !openbsd && !(dragonfly && cgo)
+
+package cmd
+
+func newKeyringBackend() keyringBackend {
+	return goKeyringBackend{}
+}
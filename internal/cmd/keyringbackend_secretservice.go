@@ -0,0 +1,127 @@
+//go:build (dragonfly && cgo) || (freebsd && cgo) || linux || netbsd || openbsd
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/zalando/go-keyring"
+	ss "github.com/zalando/go-keyring/secret_service"
+)
+
+// A secretServiceKeyringBackend is a keyringBackend that uses the freedesktop
+// Secret Service API, which supports collections, labels, and attributes.
+type secretServiceKeyringBackend struct {
+	goKeyringBackend
+}
+
+func newKeyringBackend() keyringBackend {
+	return secretServiceKeyringBackend{}
+}
+
+// Delete implements keyringBackend.Delete.
+func (b secretServiceKeyringBackend) Delete(item *keyringItem) error {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Delete(item)
+	}
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		return err
+	}
+	itemPath, err := b.findItem(svc, item)
+	if err != nil {
+		return err
+	}
+	return svc.Delete(itemPath)
+}
+
+// Get implements keyringBackend.Get.
+func (b secretServiceKeyringBackend) Get(item *keyringItem) (string, error) {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Get(item)
+	}
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		return "", err
+	}
+	itemPath, err := b.findItem(svc, item)
+	if err != nil {
+		return "", err
+	}
+	session, err := svc.OpenSession()
+	if err != nil {
+		return "", err
+	}
+	defer svc.Close(session)
+	secret, err := svc.GetSecret(itemPath, session.Path())
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Value), nil
+}
+
+// Set implements keyringBackend.Set.
+func (b secretServiceKeyringBackend) Set(item *keyringItem, value string) error {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Set(item, value)
+	}
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		return err
+	}
+	session, err := svc.OpenSession()
+	if err != nil {
+		return err
+	}
+	defer svc.Close(session)
+	collection := b.collection(svc, item)
+	if err := svc.Unlock(collection.Path()); err != nil {
+		return err
+	}
+	label := item.label
+	if label == "" {
+		label = fmt.Sprintf("Password for '%s' on '%s'", item.user, item.service)
+	}
+	return svc.CreateItem(collection, label, b.attributes(item), ss.NewSecret(session.Path(), value))
+}
+
+// attributes returns the Secret Service attributes of item.
+func (secretServiceKeyringBackend) attributes(item *keyringItem) map[string]string {
+	attributes := make(map[string]string, len(item.attributes)+2)
+	for key, value := range item.attributes {
+		attributes[key] = value
+	}
+	attributes["service"] = item.service
+	attributes["username"] = item.user
+	return attributes
+}
+
+// collection returns the collection of item.
+func (secretServiceKeyringBackend) collection(svc *ss.SecretService, item *keyringItem) dbus.BusObject {
+	if item.collection == "" {
+		return svc.GetLoginCollection()
+	}
+	return svc.GetCollection(item.collection)
+}
+
+// extended returns if item uses any options that go-keyring does not support.
+func (secretServiceKeyringBackend) extended(item *keyringItem) bool {
+	return item.collection != "" || item.label != "" || len(item.attributes) != 0
+}
+
+// findItem returns the path of item.
+func (b secretServiceKeyringBackend) findItem(svc *ss.SecretService, item *keyringItem) (dbus.ObjectPath, error) {
+	collection := b.collection(svc, item)
+	if err := svc.Unlock(collection.Path()); err != nil {
+		return "", err
+	}
+	results, err := svc.SearchItems(collection, b.attributes(item))
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", keyring.ErrNotFound
+	}
+	return results[0], nil
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"syscall"
+
+	"github.com/danieljoos/wincred"
+	"github.com/zalando/go-keyring"
+)
+
+// A wincredKeyringBackend is a keyringBackend that uses the Windows Credential
+// Manager, which supports target names, comments, and attributes.
+type wincredKeyringBackend struct {
+	goKeyringBackend
+}
+
+func newKeyringBackend() keyringBackend {
+	return wincredKeyringBackend{}
+}
+
+// Delete implements keyringBackend.Delete.
+func (b wincredKeyringBackend) Delete(item *keyringItem) error {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Delete(item)
+	}
+	credential, err := b.getCredential(item)
+	if err != nil {
+		return err
+	}
+	return credential.Delete()
+}
+
+// Get implements keyringBackend.Get.
+func (b wincredKeyringBackend) Get(item *keyringItem) (string, error) {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Get(item)
+	}
+	credential, err := b.getCredential(item)
+	if err != nil {
+		return "", err
+	}
+	return string(credential.CredentialBlob), nil
+}
+
+// Set implements keyringBackend.Set.
+func (b wincredKeyringBackend) Set(item *keyringItem, value string) error {
+	if !b.extended(item) {
+		return b.goKeyringBackend.Set(item, value)
+	}
+	// Credential blobs are limited to 2560 bytes, see
+	// https://github.com/jaraco/keyring/issues/540#issuecomment-968329967.
+	if len(value) > 2560 {
+		return keyring.ErrSetDataTooBig
+	}
+	credential := wincred.NewGenericCredential(b.targetName(item))
+	credential.UserName = item.user
+	credential.Comment = item.label
+	credential.CredentialBlob = []byte(value)
+	keys := make([]string, 0, len(item.attributes))
+	for key := range item.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		credential.Attributes = append(credential.Attributes, wincred.CredentialAttribute{
+			Keyword: key,
+			Value:   []byte(item.attributes[key]),
+		})
+	}
+	return credential.Write()
+}
+
+// extended returns if item uses any options that go-keyring does not support.
+func (wincredKeyringBackend) extended(item *keyringItem) bool {
+	return item.target != "" || item.label != "" || len(item.attributes) != 0
+}
+
+// getCredential returns the credential for item.
+func (b wincredKeyringBackend) getCredential(item *keyringItem) (*wincred.GenericCredential, error) {
+	credential, err := wincred.GetGenericCredential(b.targetName(item))
+	if errors.Is(err, syscall.ERROR_NOT_FOUND) {
+		return nil, keyring.ErrNotFound
+	}
+	return credential, err
+}
+
+// targetName returns the target name of item. By default, this is the same
+// target name as used by github.com/zalando/go-keyring.
+func (wincredKeyringBackend) targetName(item *keyringItem) string {
+	if item.target != "" {
+		return item.target
+	}
+	return item.service + ":" + item.user
+}
@@ -4,36 +4,58 @@ package cmd
 
 import (
 	"fmt"
-
-	"github.com/zalando/go-keyring"
 )
 
-type keyringKey struct {
-	service string
-	user    string
-}
-
 type keyringData struct {
-	cache map[keyringKey]string
+	backend keyringBackend
+	cache   map[string]string
 }
 
-func (c *Config) keyringTemplateFunc(service, user string) string {
-	key := keyringKey{
-		service: service,
-		user:    user,
-	}
+func (c *Config) keyringTemplateFunc(service, user string, options ...map[string]any) string {
+	item := c.keyringTemplateFuncItem(service, user, options)
+	key := item.cacheKey()
 	if password, ok := c.keyring.cache[key]; ok {
 		return password
 	}
-	password, err := keyring.Get(service, user)
+	password, err := c.keyringBackend().Get(item)
 	if err != nil {
-		panic(fmt.Errorf("%s %s: %w", service, user, err))
+		panic(fmt.Errorf("%s: %w", item, err))
 	}
 
 	if c.keyring.cache == nil {
-		c.keyring.cache = make(map[keyringKey]string)
+		c.keyring.cache = make(map[string]string)
 	}
 
 	c.keyring.cache[key] = password
 	return password
 }
+
+func (c *Config) keyringSetTemplateFunc(service, user, value string, options ...map[string]any) string {
+	item := c.keyringTemplateFuncItem(service, user, options)
+	if _, err := c.keyringSet(item, value); err != nil {
+		panic(fmt.Errorf("%s: %w", item, err))
+	}
+	if c.keyring.cache == nil {
+		c.keyring.cache = make(map[string]string)
+	}
+	c.keyring.cache[item.cacheKey()] = value
+	return ""
+}
+
+// keyringTemplateFuncItem returns the keyringItem for the arguments of a
+// keyring template function.
+func (c *Config) keyringTemplateFuncItem(service, user string, options []map[string]any) *keyringItem {
+	var itemOptions map[string]any
+	switch len(options) {
+	case 0:
+	case 1:
+		itemOptions = options[0]
+	default:
+		panic(fmt.Errorf("expected at most one options argument, got %d", len(options)))
+	}
+	item, err := newKeyringItem(service, user, itemOptions)
+	if err != nil {
+		panic(fmt.Errorf("%s %s: %w", service, user, err))
+	}
+	return item
+}
@@ -4,6 +4,10 @@ package cmd
 
 type keyringData struct{}
 
-func (c *Config) keyringTemplateFunc(service, user string) string {
+func (c *Config) keyringTemplateFunc(service, user string, options ...map[string]any) string {
+	return ""
+}
+
+func (c *Config) keyringSetTemplateFunc(service, user, value string, options ...map[string]any) string {
 	return ""
 }
@@ -26,24 +26,60 @@ var (
 	lastpassVersionRx   = regexp.MustCompile(`^LastPass CLI v(\d+\.\d+\.\d+)`)
 )
 
+type lastpassAttachmentCacheKey struct {
+	id           string
+	attachmentID string
+}
+
 type lastpassConfig struct {
-	Command string `json:"command" mapstructure:"command" yaml:"command"`
-	cache   map[string][]map[string]any
+	Command         string `json:"command" mapstructure:"command" yaml:"command"`
+	cache           map[string][]map[string]any
+	attachmentCache map[lastpassAttachmentCacheKey]string
 }
 
 func (c *Config) lastpassTemplateFunc(id string) []map[string]any {
-	data, err := c.lastpassData(id)
+	rawData, err := c.lastpassData(id)
 	if err != nil {
 		panic(err)
 	}
-	for _, d := range data {
+	// Copy the raw data so that parsing the notes does not modify the cached
+	// data returned by lastpassRaw.
+	data := make([]map[string]any, 0, len(rawData))
+	for _, rawD := range rawData {
+		d := make(map[string]any, len(rawD))
+		for key, value := range rawD {
+			d[key] = value
+		}
 		if note, ok := d["note"].(string); ok {
 			d["note"], err = lastpassParseNote(note)
 			if err != nil {
 				panic(err)
 			}
 		}
+		data = append(data, d)
+	}
+	return data
+}
+
+func (c *Config) lastpassAttachmentTemplateFunc(id, attachmentID string) string {
+	key := lastpassAttachmentCacheKey{
+		id:           id,
+		attachmentID: attachmentID,
 	}
+	if data, ok := c.Lastpass.attachmentCache[key]; ok {
+		return data
+	}
+
+	output, err := c.lastpassOutput("show", "--quiet", "--attach="+attachmentID, id)
+	if err != nil {
+		panic(err)
+	}
+	data := string(output)
+
+	if c.Lastpass.attachmentCache == nil {
+		c.Lastpass.attachmentCache = make(map[lastpassAttachmentCacheKey]string)
+	}
+	c.Lastpass.attachmentCache[key] = data
 	return data
 }
 
@@ -65,9 +101,10 @@ func (c *Config) lastpassData(id string) ([]map[string]any, error) {
 		return nil, err
 	}
 
+	// Do not include the output in the error as it contains secrets.
 	var data []map[string]any
 	if err := json.Unmarshal(output, &data); err != nil {
-		return nil, fmt.Errorf("%s: parse error: %w", output, err)
+		return nil, fmt.Errorf("%s: parse error: %w", id, err)
 	}
 
 	if c.Lastpass.cache == nil {
@@ -82,9 +119,9 @@ func (c *Config) lastpassOutput(args ...string) ([]byte, error) {
 	cmd := exec.Command(name, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
-	output, err := chezmoilog.LogCmdOutput(cmd)
+	output, err := chezmoilog.LogCmdOutputRedacted(cmd)
 	if err != nil {
-		return nil, err
+		return nil, newCmdOutputError(cmd, output, err)
 	}
 	return output, nil
 }
@@ -94,8 +131,8 @@ func lastpassParseNote(note string) (map[string]string, error) {
 	s := bufio.NewScanner(bytes.NewBufferString(note))
 	key := ""
 	for s.Scan() {
-		if m := lastpassParseNoteRx.FindStringSubmatch(s.Text()); m != nil {
-			keyComponents := strings.Split(m[1], " ")
+		if m := lastpassParseNoteRx.FindStringSubmatch(s.Text()); m != nil && strings.TrimSpace(m[1]) != "" {
+			keyComponents := strings.Fields(m[1])
 			firstComponentRunes := []rune(keyComponents[0])
 			firstComponentRunes[0] = unicode.ToLower(firstComponentRunes[0])
 			keyComponents[0] = string(firstComponentRunes)
@@ -58,6 +58,20 @@ func TestLastpassParseNote(t *testing.T) {
 				"notes":       "\n",
 			},
 		},
+		{
+			note: chezmoitest.JoinLines(
+				"Foo:bar",
+				":baz",
+				" :qux",
+			),
+			expected: map[string]string{
+				"foo": chezmoitest.JoinLines(
+					"bar",
+					":baz",
+					" :qux",
+				),
+			},
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := lastpassParseNote(tc.note)
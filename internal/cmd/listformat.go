@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// A listFormat is the output format of a command that lists paths.
+type listFormat string
+
+const (
+	listFormatList listFormat = "list"
+	listFormatJSON listFormat = "json"
+	listFormatTree listFormat = "tree"
+	listFormatYAML listFormat = "yaml"
+)
+
+var listFormatFlagCompletionFunc = chezmoi.FlagCompletionFunc([]string{
+	string(listFormatJSON),
+	string(listFormatList),
+	string(listFormatTree),
+	string(listFormatYAML),
+})
+
+// A pathTreeNode is a node in a tree of paths.
+type pathTreeNode map[string]pathTreeNode
+
+// Set implements github.com/spf13/pflag.Value.Set.
+func (f *listFormat) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "", "list":
+		*f = listFormatList
+	case "json":
+		*f = listFormatJSON
+	case "tree":
+		*f = listFormatTree
+	case "yaml":
+		*f = listFormatYAML
+	default:
+		return errors.New("invalid or unsupported list format")
+	}
+	return nil
+}
+
+// String implements github.com/spf13/pflag.Value.String.
+func (f listFormat) String() string {
+	return string(f)
+}
+
+// Type implements github.com/spf13/pflag.Value.Type.
+func (f listFormat) Type() string {
+	return "list|json|tree|yaml"
+}
+
+// writeDataFormat returns the data format corresponding to f, if any.
+func (f listFormat) writeDataFormat() writeDataFormat {
+	switch f {
+	case listFormatJSON:
+		return writeDataFormatJSON
+	case listFormatYAML:
+		return writeDataFormatYAML
+	default:
+		return ""
+	}
+}
+
+// writePaths writes paths in format. If format is listFormatTree then paths
+// must be slash-separated and relative to root.
+func (c *Config) writePaths(format listFormat, root string, paths []string) error {
+	builder := strings.Builder{}
+	switch format {
+	case listFormatTree:
+		tree := make(pathTreeNode)
+		for _, path := range paths {
+			node := tree
+			for _, component := range strings.Split(path, "/") {
+				child, ok := node[component]
+				if !ok {
+					child = make(pathTreeNode)
+					node[component] = child
+				}
+				node = child
+			}
+		}
+		builder.WriteString(root)
+		builder.WriteByte('\n')
+		tree.write(&builder, "")
+	default:
+		for _, path := range paths {
+			builder.WriteString(path)
+			builder.WriteByte('\n')
+		}
+	}
+	return c.writeOutputString(builder.String())
+}
+
+// write writes the children of n to builder, each line prefixed with prefix.
+func (n pathTreeNode) write(builder *strings.Builder, prefix string) {
+	names := make([]string, 0, len(n))
+	for name := range n {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		branch, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+		builder.WriteString(prefix)
+		builder.WriteString(branch)
+		builder.WriteString(name)
+		builder.WriteByte('\n')
+		n[name].write(builder, prefix+indent)
+	}
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	vfs "github.com/twpayne/go-vfs/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+// A logFormat is the format of log output. It implements the
+// github.com/spf13/pflag.Value interface.
+type logFormat string
+
+const (
+	logFormatConsole logFormat = "console"
+	logFormatJSON    logFormat = "json"
+	logFormatLogfmt  logFormat = "logfmt"
+)
+
+const (
+	logSinkEventLog = "eventlog"
+	logSinkFile     = "file"
+	logSinkJournald = "journald"
+	logSinkSyslog   = "syslog"
+)
+
+var logFormatFlagCompletionFunc = chezmoi.FlagCompletionFunc([]string{
+	string(logFormatConsole),
+	string(logFormatJSON),
+	string(logFormatLogfmt),
+})
+
+var logLevelFlagCompletionFunc = chezmoi.FlagCompletionFunc([]string{
+	zerolog.LevelTraceValue,
+	zerolog.LevelDebugValue,
+	zerolog.LevelInfoValue,
+	zerolog.LevelWarnValue,
+	zerolog.LevelErrorValue,
+	"disabled",
+})
+
+// A logConfig configures chezmoi's log output.
+type logConfig struct {
+	File           chezmoi.AbsPath   `json:"file"           mapstructure:"file"           yaml:"file"`
+	Format         logFormat         `json:"format"         mapstructure:"format"         yaml:"format"`
+	Level          string            `json:"level"          mapstructure:"level"          yaml:"level"`
+	Levels         map[string]string `json:"levels"         mapstructure:"levels"         yaml:"levels"`
+	MaxBackups     int               `json:"maxBackups"     mapstructure:"maxBackups"     yaml:"maxBackups"`
+	MaxSize        int64             `json:"maxSize"        mapstructure:"maxSize"        yaml:"maxSize"`
+	RotateInterval time.Duration     `json:"rotateInterval" mapstructure:"rotateInterval" yaml:"rotateInterval"`
+	Sink           string            `json:"sink"           mapstructure:"sink"           yaml:"sink"`
+	Tag            string            `json:"tag"            mapstructure:"tag"            yaml:"tag"`
+}
+
+// Set implements github.com/spf13/pflag.Value.Set.
+func (f *logFormat) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "", "console":
+		*f = logFormatConsole
+	case "json":
+		*f = logFormatJSON
+	case "logfmt":
+		*f = logFormatLogfmt
+	default:
+		return errors.New("invalid or unsupported log format")
+	}
+	return nil
+}
+
+// String implements github.com/spf13/pflag.Value.String.
+func (f logFormat) String() string {
+	return string(f)
+}
+
+// Type implements github.com/spf13/pflag.Value.Type.
+func (f logFormat) Type() string {
+	return "console|json|logfmt"
+}
+
+// newLogWriter returns the io.Writer to which log output is written and a
+// function to close it.
+func (c *Config) newLogWriter() (io.Writer, func() error, error) {
+	switch c.Log.Sink {
+	case "", logSinkFile:
+		return c.newLogFileWriter()
+	case logSinkEventLog, logSinkJournald, logSinkSyslog:
+	default:
+		return nil, nil, fmt.Errorf("%s: unknown log sink", c.Log.Sink)
+	}
+
+	var formatFunc chezmoilog.FormatFunc
+	switch c.Log.Format {
+	case "", logFormatConsole:
+		formatFunc = chezmoilog.FormatConsole
+	case logFormatJSON:
+		formatFunc = chezmoilog.FormatJSON
+	case logFormatLogfmt:
+		formatFunc = chezmoilog.FormatLogfmt
+	default:
+		return nil, nil, fmt.Errorf("%s: invalid log format", c.Log.Format)
+	}
+
+	var sink chezmoilog.LevelWriteCloser
+	var err error
+	switch c.Log.Sink {
+	case logSinkEventLog:
+		sink, err = chezmoilog.NewEventLogWriter(c.Log.Tag, formatFunc)
+	case logSinkJournald:
+		sink, err = chezmoilog.NewJournaldWriter(c.Log.Tag)
+	case logSinkSyslog:
+		sink, err = chezmoilog.NewSyslogWriter(c.Log.Tag, formatFunc)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("log.sink: %s: %w", c.Log.Sink, err)
+	}
+	return sink, sink.Close, nil
+}
+
+// newLogFileWriter returns the io.Writer that writes log output to stderr or
+// to the log file, and a function to close it.
+func (c *Config) newLogFileWriter() (io.Writer, func() error, error) {
+	var w io.Writer = c.stderr
+	closeFunc := func() error { return nil }
+	color := c.Color.Value(c.colorAutoFunc)
+	if !c.Log.File.Empty() {
+		if err := vfs.MkdirAll(c.fileSystem, c.Log.File.Dir().String(), fs.ModePerm); err != nil {
+			return nil, nil, err
+		}
+		rotatingWriter, err := chezmoilog.NewRotatingWriter(c.Log.File.String(), chezmoilog.RotatingWriterOptions{
+			MaxSize:        c.Log.MaxSize,
+			RotateInterval: c.Log.RotateInterval,
+			MaxBackups:     c.Log.MaxBackups,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		w = rotatingWriter
+		closeFunc = rotatingWriter.Close
+		color = false
+	}
+
+	switch c.Log.Format {
+	case "", logFormatConsole:
+		out := w
+		w = zerolog.NewConsoleWriter(func(consoleWriter *zerolog.ConsoleWriter) {
+			consoleWriter.Out = out
+			consoleWriter.NoColor = !color
+			consoleWriter.TimeFormat = time.RFC3339
+		})
+	case logFormatJSON:
+	case logFormatLogfmt:
+		w = chezmoilog.NewLogfmtWriter(w)
+	default:
+		return nil, nil, fmt.Errorf("%s: invalid log format", c.Log.Format)
+	}
+
+	return w, closeFunc, nil
+}
+
+// logLevel returns the level at which log output is written. chezmoi logs its
+// debug information at the info level, so the --debug flag sets the info
+// level. Otherwise, if no level is configured, then debug information is
+// logged if a log file or sink is set and nothing is logged otherwise.
+func (c *Config) logLevel() (zerolog.Level, error) {
+	switch {
+	case c.debug:
+		return zerolog.InfoLevel, nil
+	case c.Log.Level != "":
+		return parseLogLevel(c.Log.Level)
+	case !c.Log.File.Empty() || c.Log.Sink != "" && c.Log.Sink != logSinkFile:
+		return zerolog.InfoLevel, nil
+	default:
+		return zerolog.Disabled, nil
+	}
+}
+
+// parseLogComponentLevels parses c's per-component log level overrides.
+// Components may optionally be prefixed with "chezmoi.".
+func (c *Config) parseLogComponentLevels() (map[string]zerolog.Level, error) {
+	logComponentLevels := make(map[string]zerolog.Level, len(c.Log.Levels))
+	for component, levelStr := range c.Log.Levels {
+		component = strings.TrimPrefix(component, "chezmoi.")
+		switch component {
+		case logComponentValueEncryption:
+		case logComponentValuePersistentState:
+		case logComponentValueSourceState:
+		case logComponentValueSystem:
+		default:
+			return nil, fmt.Errorf("log.levels: %s: unknown component", component)
+		}
+		level, err := parseLogLevel(levelStr)
+		if err != nil {
+			return nil, fmt.Errorf("log.levels: %s: %w", component, err)
+		}
+		logComponentLevels[component] = level
+	}
+	return logComponentLevels, nil
+}
+
+// componentLogger returns a new logger for component, with any log level
+// override for component applied.
+func (c *Config) componentLogger(component string) *zerolog.Logger {
+	logger := c.logger.With().Str(logComponentKey, component).Logger()
+	if level, ok := c.logComponentLevels[component]; ok {
+		logger = logger.Level(level)
+	}
+	return &logger
+}
+
+// componentLogEnabled returns whether chezmoi's debug information for
+// component is logged.
+func (c *Config) componentLogEnabled(component string) bool {
+	level := c.componentLogger(component).GetLevel()
+	if globalLevel := zerolog.GlobalLevel(); globalLevel > level {
+		level = globalLevel
+	}
+	return level <= zerolog.InfoLevel
+}
+
+// parseLogLevel parses a log level.
+func parseLogLevel(s string) (zerolog.Level, error) {
+	if strings.ToLower(s) == "disabled" {
+		return zerolog.Disabled, nil
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(s))
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("%s: invalid log level", s)
+	}
+	return level, nil
+}
@@ -201,16 +201,35 @@ func cmdExpandEnv(ts *testscript.TestScript, neg bool, args []string) {
 }
 
 // cmdHTTPD starts an HTTP server serving files from the given directory and
-// sets the HTTPD_URL environment variable to the URL of the server.
+// sets the HTTPD_URL environment variable to the URL of the server. Any extra
+// arguments of the form name=value are headers that the server requires on all
+// requests.
 func cmdHTTPD(ts *testscript.TestScript, neg bool, args []string) {
 	if neg {
 		ts.Fatalf("unsupported: ! httpd")
 	}
-	if len(args) != 1 {
-		ts.Fatalf("usage: httpd dir")
+	if len(args) < 1 {
+		ts.Fatalf("usage: httpd dir [name=value]...")
 	}
 	dir := ts.MkAbs(args[0])
-	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	requiredHeaders := make(map[string]string)
+	for _, arg := range args[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			ts.Fatalf("%s: invalid header", arg)
+		}
+		requiredHeaders[name] = value
+	}
+	fileServer := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range requiredHeaders {
+			if r.Header.Get(name) != value {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
 	ts.Setenv("HTTPD_URL", server.URL)
 }
 
@@ -1,18 +1,32 @@
 package cmd
 
 import (
-	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 )
 
 type managedCmdConfig struct {
 	filter    *chezmoi.EntryTypeFilter
+	format    listFormat
 	pathStyle chezmoi.PathStyle
+	skipTags  []string
+	tags      []string
+}
+
+// A managedEntry is a managed entry, as written by chezmoi managed.
+type managedEntry struct {
+	Path       string   `json:"path"       yaml:"path"`
+	SourcePath string   `json:"sourcePath" yaml:"sourcePath"`
+	Type       string   `json:"type"       yaml:"type"`
+	Encrypted  bool     `json:"encrypted"  yaml:"encrypted"`
+	External   bool     `json:"external"   yaml:"external"`
+	Template   bool     `json:"template"   yaml:"template"`
+	Tags       []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	treePath   string
 }
 
 func (c *Config) newManagedCmd() *cobra.Command {
@@ -29,11 +43,17 @@ func (c *Config) newManagedCmd() *cobra.Command {
 
 	flags := managedCmd.Flags()
 	flags.VarP(c.managed.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.VarP(&c.managed.format, "format", "f", "Output format")
 	flags.VarP(c.managed.filter.Include, "include", "i", "Include entry types")
 	flags.VarP(&c.managed.pathStyle, "path-style", "p", "Path style")
+	flags.StringSliceVar(&c.managed.skipTags, "skip-tags", c.managed.skipTags, "Skip entries with tags")
+	flags.StringSliceVar(&c.managed.tags, "tags", c.managed.tags, "Only list entries with tags")
 
 	registerExcludeIncludeFlagCompletionFuncs(managedCmd)
-	if err := managedCmd.RegisterFlagCompletionFunc("path-style", chezmoi.PathStyleFlagCompletionFunc); err != nil {
+	if err := chezmoierrors.Combine(
+		managedCmd.RegisterFlagCompletionFunc("format", listFormatFlagCompletionFunc),
+		managedCmd.RegisterFlagCompletionFunc("path-style", chezmoi.PathStyleFlagCompletionFunc),
+	); err != nil {
 		panic(err)
 	}
 
@@ -54,7 +74,7 @@ func (c *Config) runManagedCmd(cmd *cobra.Command, args []string, sourceState *c
 		}
 	}
 
-	var paths []string
+	var entries []*managedEntry
 	_ = sourceState.ForEach(
 		func(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) error {
 			if !c.managed.filter.IncludeSourceStateEntry(sourceStateEntry) {
@@ -83,26 +103,85 @@ func (c *Config) runManagedCmd(cmd *cobra.Command, args []string, sourceState *c
 				}
 			}
 
-			var path string
+			// When tags are given, only include entries with these tags.
+			targetTags := sourceState.Tags(targetRelPath)
+			if len(c.managed.tags) != 0 && !hasAnyTag(targetTags, c.managed.tags) ||
+				hasAnyTag(targetTags, c.managed.skipTags) {
+				return nil
+			}
+
+			sourceRelPath := sourceStateEntry.SourceRelPath().RelPath()
+			entry := &managedEntry{
+				SourcePath: sourceRelPath.String(),
+				Type:       targetStateEntryType(targetStateEntry),
+				Tags:       targetTags,
+			}
+			if sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile); ok {
+				entry.Encrypted = sourceStateFile.Attr.Encrypted
+				entry.Template = sourceStateFile.Attr.Template
+			}
+			_, entry.External = sourceStateEntry.Origin().(*chezmoi.External)
 			switch c.managed.pathStyle {
 			case chezmoi.PathStyleAbsolute:
-				path = c.DestDirAbsPath.Join(targetRelPath).String()
+				entry.Path = c.DestDirAbsPath.Join(targetRelPath).String()
+				entry.treePath = targetRelPath.String()
 			case chezmoi.PathStyleRelative:
-				path = targetRelPath.String()
+				entry.Path = targetRelPath.String()
+				entry.treePath = targetRelPath.String()
 			case chezmoi.PathStyleSourceAbsolute:
-				path = c.SourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath()).String()
+				entry.Path = c.SourceDirAbsPath.Join(sourceRelPath).String()
+				entry.treePath = sourceRelPath.String()
 			case chezmoi.PathStyleSourceRelative:
-				path = sourceStateEntry.SourceRelPath().RelPath().String()
+				entry.Path = sourceRelPath.String()
+				entry.treePath = sourceRelPath.String()
 			}
-			paths = append(paths, path)
+			entries = append(entries, entry)
 			return nil
 		},
 	)
 
-	sort.Strings(paths)
-	builder := strings.Builder{}
-	for _, path := range paths {
-		fmt.Fprintln(&builder, path)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	if dataFormat := c.managed.format.writeDataFormat(); dataFormat != "" {
+		return c.marshal(dataFormat, entries)
+	}
+
+	var root string
+	switch c.managed.pathStyle {
+	case chezmoi.PathStyleAbsolute:
+		root = c.DestDirAbsPath.String()
+	case chezmoi.PathStyleSourceAbsolute:
+		root = c.SourceDirAbsPath.String()
+	default:
+		root = "."
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if c.managed.format == listFormatTree {
+			paths = append(paths, entry.treePath)
+		} else {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return c.writePaths(c.managed.format, root, paths)
+}
+
+// targetStateEntryType returns the type of targetStateEntry as a string.
+func targetStateEntryType(targetStateEntry chezmoi.TargetStateEntry) string {
+	switch targetStateEntry.(type) {
+	case *chezmoi.TargetStateDir, *chezmoi.TargetStateModifyDirWithCmd:
+		return "dir"
+	case *chezmoi.TargetStateFile:
+		return "file"
+	case *chezmoi.TargetStateRemove:
+		return "remove"
+	case *chezmoi.TargetStateScript:
+		return "script"
+	case *chezmoi.TargetStateSymlink:
+		return "symlink"
+	default:
+		return ""
 	}
-	return c.writeOutputString(builder.String())
 }
@@ -14,8 +14,9 @@ import (
 )
 
 type mergeCmdConfig struct {
-	Command string   `json:"command" mapstructure:"command" yaml:"command"`
-	Args    []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	Command string                 `json:"command" mapstructure:"command" yaml:"command"`
+	Args    []string               `json:"args"    mapstructure:"args"    yaml:"args"`
+	Tools   []patternCommandConfig `json:"tools"   mapstructure:"tools"   yaml:"tools"`
 }
 
 func (c *Config) newMergeCmd() *cobra.Command {
@@ -132,7 +133,17 @@ func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi
 		Target:      targetStateAbsPath.String(),
 	}
 
-	args := make([]string, 0, len(c.Merge.Args))
+	// Use the merge tool for the target, if any.
+	mergeCommand, mergeArgs := c.Merge.Command, c.Merge.Args
+	var tool *patternCommandConfig
+	if tool, err = findPatternCommand(c.Merge.Tools, targetRelPath.String()); err != nil {
+		err = fmt.Errorf("merge.tools: %w", err)
+		return
+	} else if tool != nil {
+		mergeCommand, mergeArgs = tool.Command, tool.Args
+	}
+
+	args := make([]string, 0, len(mergeArgs))
 
 	// Work around a regression introduced in 2.1.4
 	// (https://github.com/twpayne/chezmoi/pull/1324) in a user-friendly
@@ -146,7 +157,7 @@ func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi
 	// is considered a template if, after execution as a template, it is
 	// not equal to the original arg.
 	anyTemplateArgs := false
-	for i, arg := range c.Merge.Args {
+	for i, arg := range mergeArgs {
 		var tmpl *template.Template
 		if tmpl, err = template.New("merge.args[" + strconv.Itoa(i) + "]").Parse(arg); err != nil {
 			return
@@ -174,7 +185,11 @@ func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi
 		return
 	}
 
-	if err = c.run(c.DestDirAbsPath, c.Merge.Command, args); err != nil {
+	if err = c.setTemplatedEnvironmentVariables(); err != nil {
+		return
+	}
+
+	if err = c.run(c.DestDirAbsPath, mergeCommand, withBlockingArgs(mergeCommand, args)); err != nil {
 		err = fmt.Errorf("%s: %w", targetRelPath, err)
 		return
 	}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// A metricsConfig configures the metrics that chezmoi writes after each run
+// that modifies the destination directory.
+type metricsConfig struct {
+	Prefix   string          `json:"prefix"   mapstructure:"prefix"   yaml:"prefix"`
+	StatsD   string          `json:"statsd"   mapstructure:"statsd"   yaml:"statsd"`
+	Textfile chezmoi.AbsPath `json:"textfile" mapstructure:"textfile" yaml:"textfile"`
+}
+
+// runMetrics collects metrics about a single run of chezmoi from events.
+type runMetrics struct {
+	command            string
+	startedAt          time.Time
+	entriesApplied     int
+	entriesFailed      int
+	scriptsRun         int
+	scriptsFailed      int
+	scriptsDuration    time.Duration
+	externalsRefreshed int
+	externalsBytes     int64
+}
+
+// A metric is a single metric value.
+type metric struct {
+	name       string
+	help       string
+	value      float64
+	statsDType string
+}
+
+// newRunMetrics returns a new runMetrics for cmd.
+func newRunMetrics(cmd *cobra.Command) *runMetrics {
+	return &runMetrics{
+		command:   cmd.Name(),
+		startedAt: time.Now(),
+	}
+}
+
+// HandleEvent implements chezmoi.EventHandler.HandleEvent.
+func (m *runMetrics) HandleEvent(event *chezmoi.Event) {
+	switch event.Type {
+	case chezmoi.EventTypeEntryApplied:
+		m.entriesApplied++
+	case chezmoi.EventTypeEntryFailed:
+		m.entriesFailed++
+	case chezmoi.EventTypeScriptFinished:
+		m.scriptsRun++
+		if event.Error != "" {
+			m.scriptsFailed++
+		}
+		m.scriptsDuration += time.Duration(event.Duration)
+	case chezmoi.EventTypeDownloadFinished:
+		m.externalsRefreshed++
+		m.externalsBytes += event.Bytes
+	}
+}
+
+// metrics returns m's metrics at now for a run that returned runErr.
+func (m *runMetrics) metrics(now time.Time, runErr error) []metric {
+	success := 1.0
+	if runErr != nil {
+		success = 0
+	}
+	return []metric{
+		{
+			name:       "entries_applied",
+			help:       "Number of entries applied.",
+			value:      float64(m.entriesApplied),
+			statsDType: "c",
+		},
+		{
+			name:       "entries_failed",
+			help:       "Number of entries that failed to apply.",
+			value:      float64(m.entriesFailed),
+			statsDType: "c",
+		},
+		{
+			name:       "scripts_run",
+			help:       "Number of scripts run.",
+			value:      float64(m.scriptsRun),
+			statsDType: "c",
+		},
+		{
+			name:       "scripts_failed",
+			help:       "Number of scripts that failed.",
+			value:      float64(m.scriptsFailed),
+			statsDType: "c",
+		},
+		{
+			name:       "scripts_duration_seconds",
+			help:       "Total duration of scripts run in seconds.",
+			value:      m.scriptsDuration.Seconds(),
+			statsDType: "ms",
+		},
+		{
+			name:       "externals_refreshed",
+			help:       "Number of externals downloaded.",
+			value:      float64(m.externalsRefreshed),
+			statsDType: "c",
+		},
+		{
+			name:       "externals_downloaded_bytes",
+			help:       "Number of bytes downloaded for externals.",
+			value:      float64(m.externalsBytes),
+			statsDType: "c",
+		},
+		{
+			name:       "run_duration_seconds",
+			help:       "Duration of the run in seconds.",
+			value:      now.Sub(m.startedAt).Seconds(),
+			statsDType: "ms",
+		},
+		{
+			name:       "last_run_success",
+			help:       "Whether the run succeeded.",
+			value:      success,
+			statsDType: "g",
+		},
+		{
+			name:       "last_run_timestamp_seconds",
+			help:       "Time of the end of the run as a Unix timestamp.",
+			value:      float64(now.Unix()),
+			statsDType: "g",
+		},
+	}
+}
+
+// prometheusText returns metrics in the Prometheus text exposition format,
+// labeled with m's command.
+func (m *runMetrics) prometheusText(prefix string, metrics []metric) []byte {
+	var buffer bytes.Buffer
+	for _, metric := range metrics {
+		name := prefix + "_" + metric.name
+		fmt.Fprintf(&buffer, "# HELP %s %s\n", name, metric.help)
+		fmt.Fprintf(&buffer, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&buffer, "%s{command=%q} %g\n", name, m.command, metric.value)
+	}
+	return buffer.Bytes()
+}
+
+// statsDText returns metrics in the StatsD format, with one metric per line.
+// Durations are converted to milliseconds.
+func (m *runMetrics) statsDText(prefix string, metrics []metric) []byte {
+	var buffer bytes.Buffer
+	for _, metric := range metrics {
+		name := prefix + "." + m.command + "." + strings.TrimSuffix(metric.name, "_seconds")
+		value := metric.value
+		if metric.statsDType == "ms" {
+			value *= 1000
+		}
+		fmt.Fprintf(&buffer, "%s:%g|%s\n", name, value, metric.statsDType)
+	}
+	return buffer.Bytes()
+}
+
+// writeMetrics writes the metrics of the current run, which returned runErr,
+// to the configured Prometheus textfile and StatsD server, if any.
+func (c *Config) writeMetrics(runErr error) error {
+	if c.runMetrics == nil {
+		return nil
+	}
+	prefix := c.Metrics.Prefix
+	if prefix == "" {
+		prefix = "chezmoi"
+	}
+	metrics := c.runMetrics.metrics(time.Now(), runErr)
+
+	if !c.Metrics.Textfile.Empty() {
+		if err := chezmoi.MkdirAll(c.baseSystem, c.Metrics.Textfile.Dir(), 0o777); err != nil {
+			return err
+		}
+		// Write to a temporary file and rename it so that the textfile
+		// collector never reads a partially-written file.
+		tempAbsPath := c.Metrics.Textfile.Dir().JoinString("." + c.Metrics.Textfile.Base() + ".tmp")
+		c.tempAbsPaths[tempAbsPath] = struct{}{}
+		defer delete(c.tempAbsPaths, tempAbsPath)
+		if err := c.baseSystem.WriteFile(tempAbsPath, c.runMetrics.prometheusText(prefix, metrics), 0o666&^c.Umask); err != nil {
+			return err
+		}
+		if err := c.baseSystem.Rename(tempAbsPath, c.Metrics.Textfile); err != nil {
+			return err
+		}
+	}
+
+	if c.Metrics.StatsD != "" {
+		conn, err := net.Dial("udp", c.Metrics.StatsD)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := conn.Write(c.runMetrics.statsDText(prefix, metrics)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// disabledModuleStateBucket is the bucket for recording the modules that are
+// disabled on this machine.
+var disabledModuleStateBucket = []byte("disabledModuleState")
+
+type moduleCmdConfig struct {
+	format          writeDataFormat
+	sha256          string
+	stripComponents int
+}
+
+// A disabledModuleState records that a module is disabled.
+type disabledModuleState struct {
+	DisabledAt time.Time `json:"disabledAt" yaml:"disabledAt"`
+}
+
+// A moduleStatus is the status of a module.
+type moduleStatus struct {
+	Name        string           `json:"name"                  yaml:"name"`
+	Version     string           `json:"version,omitempty"     yaml:"version,omitempty"`
+	Description string           `json:"description,omitempty" yaml:"description,omitempty"`
+	Dir         string           `json:"dir"                   yaml:"dir"`
+	URL         string           `json:"url,omitempty"         yaml:"url,omitempty"`
+	SHA256      chezmoi.HexBytes `json:"sha256,omitempty"      yaml:"sha256,omitempty"`
+	Enabled     bool             `json:"enabled"               yaml:"enabled"`
+}
+
+func (c *Config) newModuleCmd() *cobra.Command {
+	moduleCmd := &cobra.Command{
+		Use:     "module",
+		Args:    cobra.NoArgs,
+		Short:   "Manage modules",
+		Long:    mustLongHelp("module"),
+		Example: example("module"),
+	}
+
+	moduleDisableCmd := &cobra.Command{
+		Use:               "disable name...",
+		Short:             "Disable modules on this machine",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: c.moduleValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runModuleDisableCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+	moduleCmd.AddCommand(moduleDisableCmd)
+
+	moduleEnableCmd := &cobra.Command{
+		Use:               "enable name...",
+		Short:             "Enable modules on this machine",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: c.moduleValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runModuleEnableCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+	moduleCmd.AddCommand(moduleEnableCmd)
+
+	moduleImportCmd := &cobra.Command{
+		Use:   "import url dir",
+		Short: "Import a module from an archive",
+		Args:  cobra.ExactArgs(2),
+		RunE:  c.runModuleImportCmd,
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	moduleImportFlags := moduleImportCmd.Flags()
+	moduleImportFlags.StringVar(&c.module.sha256, "sha256", c.module.sha256, "Set expected SHA256 sum of archive")
+	moduleImportFlags.IntVar(&c.module.stripComponents, "strip-components", c.module.stripComponents, "Strip leading path components")
+	moduleCmd.AddCommand(moduleImportCmd)
+
+	moduleListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List modules",
+		Args:  cobra.NoArgs,
+		RunE:  c.makeRunEWithSourceState(c.runModuleListCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	moduleListFlags := moduleListCmd.Flags()
+	moduleListFlags.VarP(&c.module.format, "format", "f", "Output format")
+	if err := moduleListCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+	moduleCmd.AddCommand(moduleListCmd)
+
+	moduleUpdateCmd := &cobra.Command{
+		Use:               "update name [url]",
+		Short:             "Update a module from its archive",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: c.moduleValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runModuleUpdateCmd),
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	moduleUpdateFlags := moduleUpdateCmd.Flags()
+	moduleUpdateFlags.StringVar(&c.module.sha256, "sha256", c.module.sha256, "Set expected SHA256 sum of archive")
+	moduleUpdateFlags.IntVar(&c.module.stripComponents, "strip-components", c.module.stripComponents, "Strip leading path components")
+	moduleCmd.AddCommand(moduleUpdateCmd)
+
+	return moduleCmd
+}
+
+func (c *Config) runModuleDisableCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	if _, err := c.findModules(sourceState, args); err != nil {
+		return err
+	}
+	for _, name := range args {
+		if err := chezmoi.PersistentStateSet(c.persistentState, disabledModuleStateBucket, []byte(name), &disabledModuleState{
+			DisabledAt: time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) runModuleEnableCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	if _, err := c.findModules(sourceState, args); err != nil {
+		return err
+	}
+	for _, name := range args {
+		if err := c.persistentState.Delete(disabledModuleStateBucket, []byte(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) runModuleImportCmd(cmd *cobra.Command, args []string) error {
+	urlStr, dir := args[0], args[1]
+	dirRelPath := chezmoi.NewRelPath(path.Clean(strings.ReplaceAll(dir, `\`, "/")))
+	if path.IsAbs(dirRelPath.String()) || dirRelPath.String() == "." ||
+		dirRelPath.String() == ".." || strings.HasPrefix(dirRelPath.String(), "../") {
+		return fmt.Errorf("%s: not a subdirectory of the source directory", dir)
+	}
+	dirAbsPath := c.SourceDirAbsPath.Join(dirRelPath)
+	switch _, err := c.baseSystem.Lstat(dirAbsPath); {
+	case err == nil:
+		return fmt.Errorf("%s: already exists", dirAbsPath)
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	expectedSHA256, err := c.moduleExpectedSHA256()
+	if err != nil {
+		return err
+	}
+	return c.installModule(urlStr, expectedSHA256, dirAbsPath)
+}
+
+func (c *Config) runModuleListCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	modules := sourceState.Modules()
+	moduleStatuses := make([]*moduleStatus, 0, len(modules))
+	for _, module := range modules {
+		moduleStatuses = append(moduleStatuses, &moduleStatus{
+			Name:        module.Name,
+			Version:     module.Version,
+			Description: module.Description,
+			Dir:         module.SourceRelPath.String(),
+			URL:         module.URL,
+			SHA256:      module.SHA256,
+			Enabled:     module.Enabled,
+		})
+	}
+
+	if c.module.format != "" {
+		return c.marshal(c.module.format, moduleStatuses)
+	}
+
+	var builder strings.Builder
+	tabWriter := tabwriter.NewWriter(&builder, 3, 0, 3, ' ', 0)
+	fmt.Fprint(tabWriter, "NAME\tVERSION\tENABLED\tDIR\tURL\n")
+	for _, status := range moduleStatuses {
+		version, enabled, urlStr := "-", "no", "-"
+		if status.Version != "" {
+			version = status.Version
+		}
+		if status.Enabled {
+			enabled = "yes"
+		}
+		if status.URL != "" {
+			urlStr = status.URL
+		}
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\n", status.Name, version, enabled, status.Dir, urlStr)
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runModuleUpdateCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	modules, err := c.findModules(sourceState, args[:1])
+	if err != nil {
+		return err
+	}
+	module := modules[0]
+
+	// Without a new URL, reinstall the module from its pinned URL and verify
+	// it against its pinned SHA256 sum.
+	urlStr := module.URL
+	expectedSHA256 := []byte(module.SHA256)
+	if len(args) > 1 {
+		urlStr = args[1]
+		if expectedSHA256, err = c.moduleExpectedSHA256(); err != nil {
+			return err
+		}
+	}
+	if urlStr == "" {
+		return fmt.Errorf("%s: module was not imported from a URL", module.Name)
+	}
+
+	dirAbsPath := c.SourceDirAbsPath.Join(module.SourceRelPath.RelPath())
+	return c.installModule(urlStr, expectedSHA256, dirAbsPath)
+}
+
+// disabledModules returns the names of the modules that are disabled on this
+// machine.
+func (c *Config) disabledModules() ([]string, error) {
+	if c.persistentState == nil {
+		return nil, nil
+	}
+	var disabledModules []string
+	if err := c.persistentState.ForEach(disabledModuleStateBucket, func(k, v []byte) error {
+		disabledModules = append(disabledModules, string(k))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return disabledModules, nil
+}
+
+// findModules returns the modules in sourceState with names.
+func (c *Config) findModules(sourceState *chezmoi.SourceState, names []string) ([]*chezmoi.Module, error) {
+	modulesByName := make(map[string]*chezmoi.Module)
+	for _, module := range sourceState.Modules() {
+		modulesByName[module.Name] = module
+	}
+	modules := make([]*chezmoi.Module, 0, len(names))
+	for _, name := range names {
+		module, ok := modulesByName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: module not found", name)
+		}
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
+
+// installModule downloads the archive at urlStr, verifies it against
+// expectedSHA256 if it is not empty, and replaces the contents of dirAbsPath
+// with it. The URL and SHA256 sum of the archive are pinned in the module's
+// manifest.
+func (c *Config) installModule(urlStr string, expectedSHA256 []byte, dirAbsPath chezmoi.AbsPath) error {
+	archiveURL, err := url.Parse(urlStr)
+	if err != nil {
+		return err
+	}
+	data, err := c.downloadSourceArchiveFile(urlStr)
+	if err != nil {
+		return err
+	}
+	sha256 := chezmoi.SHA256Sum(data)
+	if len(expectedSHA256) != 0 && !bytes.Equal(sha256, expectedSHA256) {
+		return fmt.Errorf("%s: checksum mismatch, expected %x, got %x", urlStr, expectedSHA256, sha256)
+	}
+
+	archiveReaderSystem, err := chezmoi.NewArchiveReaderSystem(
+		archiveURL.Path, data, chezmoi.ArchiveFormatUnknown, chezmoi.ArchiveReaderSystemOptions{
+			RootAbsPath:     dirAbsPath,
+			StripComponents: c.module.stripComponents,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := c.baseSystem.RemoveAll(dirAbsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := chezmoi.MkdirAll(c.baseSystem, dirAbsPath, fs.ModePerm); err != nil {
+		return err
+	}
+	if err := c.extractArchiveReaderSystem(urlStr, archiveReaderSystem, dirAbsPath); err != nil {
+		return err
+	}
+
+	manifestAbsPath := dirAbsPath.JoinString(chezmoi.ModuleName)
+	var manifest chezmoi.ModuleManifest
+	switch manifestData, err := c.baseSystem.ReadFile(manifestAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := chezmoi.FormatYAML.Unmarshal(manifestData, &manifest); err != nil {
+			return fmt.Errorf("%s: %w", manifestAbsPath, err)
+		}
+	}
+	manifest.URL = urlStr
+	manifest.SHA256 = sha256
+	manifestData, err := chezmoi.FormatYAML.Marshal(&manifest)
+	if err != nil {
+		return err
+	}
+	return c.baseSystem.WriteFile(manifestAbsPath, manifestData, 0o666&^c.Umask)
+}
+
+// moduleExpectedSHA256 returns the value of the --sha256 flag.
+func (c *Config) moduleExpectedSHA256() ([]byte, error) {
+	if c.module.sha256 == "" {
+		return nil, nil
+	}
+	expectedSHA256, err := hex.DecodeString(c.module.sha256)
+	if err != nil {
+		return nil, fmt.Errorf("--sha256: %w", err)
+	}
+	return expectedSHA256, nil
+}
+
+// moduleValidArgs returns the names of all modules.
+func (c *Config) moduleValidArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return c.makeValidArgsFunc(c.moduleCompletions)(cmd, args, toComplete)
+}
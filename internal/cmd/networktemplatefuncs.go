@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vpnInterfaceNamePrefixes are the prefixes of the names of network interfaces
+// that are commonly created by VPN clients.
+var vpnInterfaceNamePrefixes = []string{
+	"gpd",
+	"ipsec",
+	"ppp",
+	"tap",
+	"tun",
+	"utun",
+	"wg",
+}
+
+// proxyEnvVars are the environment variables that configure proxies.
+var proxyEnvVars = []string{
+	"ALL_PROXY",
+	"HTTPS_PROXY",
+	"HTTP_PROXY",
+	"all_proxy",
+	"https_proxy",
+	"http_proxy",
+}
+
+type networkConfig struct {
+	Timeout           time.Duration `json:"timeout" mapstructure:"timeout" yaml:"timeout"`
+	lookupIPCache     map[string][]string
+	tcpReachableCache map[string]bool
+}
+
+func (c *Config) defaultRouteInterfaceTemplateFunc() string {
+	// Connecting a UDP socket does not send any packets, but selects the
+	// local address that would be used to reach the destination using the
+	// default route. 192.0.2.1 is reserved for documentation.
+	conn, err := net.Dial("udp", "192.0.2.1:9")
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	localUDPAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		panic(err)
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(localUDPAddr.IP) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
+
+func (c *Config) lookupIPTemplateFunc(host string) []string {
+	if ips, ok := c.Network.lookupIPCache[host]; ok {
+		return ips
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Network.Timeout)
+	defer cancel()
+	var ips []string
+	var dnsErr *net.DNSError
+	switch ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host); {
+	case errors.As(err, &dnsErr):
+		// Treat failed lookups, including timeouts, as hosts with no
+		// addresses so that templates can test for them.
+		ips = []string{}
+	case err != nil:
+		panic(err)
+	default:
+		ips = make([]string, 0, len(ipAddrs))
+		for _, ipAddr := range ipAddrs {
+			ips = append(ips, ipAddr.IP.String())
+		}
+		sort.Strings(ips)
+	}
+
+	if c.Network.lookupIPCache == nil {
+		c.Network.lookupIPCache = make(map[string][]string)
+	}
+	c.Network.lookupIPCache[host] = ips
+
+	return ips
+}
+
+func (c *Config) proxyActiveTemplateFunc() bool {
+	for _, key := range proxyEnvVars {
+		if os.Getenv(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) tcpReachableTemplateFunc(address string) bool {
+	if reachable, ok := c.Network.tcpReachableCache[address]; ok {
+		return reachable
+	}
+
+	reachable := false
+	if conn, err := net.DialTimeout("tcp", address, c.Network.Timeout); err == nil {
+		reachable = true
+		conn.Close()
+	}
+
+	if c.Network.tcpReachableCache == nil {
+		c.Network.tcpReachableCache = make(map[string]bool)
+	}
+	c.Network.tcpReachableCache[address] = reachable
+
+	return reachable
+}
+
+func (c *Config) vpnActiveTemplateFunc() bool {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		panic(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if iface.Flags&net.FlagPointToPoint == 0 && !hasAnyPrefix(iface.Name, vpnInterfaceNamePrefixes) {
+			continue
+		}
+		// Ignore interfaces without routable addresses, like the utun
+		// interfaces that macOS creates for its own services.
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAnyPrefix returns if s has any of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
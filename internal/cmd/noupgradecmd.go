@@ -9,10 +9,17 @@ import (
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+const (
+	upgradeChannelStable = "stable"
+	upgradeSignatureNone = "none"
+)
+
 type upgradeCmdConfig struct {
-	method string
-	owner  string
-	repo   string
+	channel   string
+	method    string
+	owner     string
+	repo      string
+	signature string
 }
 
 func (c *Config) newUpgradeCmd() *cobra.Command {
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/fs"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// The object store holds the contents of files and the linknames of symlinks
+// recorded by apply snapshots and by the generation history. Objects are
+// stored in a directory next to the persistent state file, named by the hex
+// encoding of the SHA256 sum of their contents, so identical contents are only
+// stored once.
+
+// objectsDir returns the directory containing objects.
+func (c *Config) objectsDir() (chezmoi.AbsPath, error) {
+	persistentStateFileAbsPath, err := c.persistentStateFile()
+	if err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	return persistentStateFileAbsPath.Dir().JoinString("objects"), nil
+}
+
+// readObject reads the object with the SHA256 sum contentsSHA256.
+func (c *Config) readObject(contentsSHA256 []byte) ([]byte, error) {
+	objectsDirAbsPath, err := c.objectsDir()
+	if err != nil {
+		return nil, err
+	}
+	return c.baseSystem.ReadFile(objectsDirAbsPath.JoinString(hex.EncodeToString(contentsSHA256)))
+}
+
+// removeUnreferencedObjects removes all objects that are not referenced by any
+// snapshot or generation.
+func (c *Config) removeUnreferencedObjects() error {
+	referenced := make(map[string]struct{})
+	addReference := func(contentsSHA256 []byte) {
+		if contentsSHA256 != nil {
+			referenced[hex.EncodeToString(contentsSHA256)] = struct{}{}
+		}
+	}
+
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		for _, snapshotEntry := range snapshot.Entries {
+			addReference(snapshotEntry.ContentsSHA256)
+		}
+	}
+
+	generations, err := c.generations()
+	if err != nil {
+		return err
+	}
+	for _, generation := range generations {
+		for _, generationEntry := range generation.Entries {
+			for _, generationEntryState := range []generationEntryState{generationEntry.Before, generationEntry.After} {
+				if generationEntryState.ContentsRecorded {
+					addReference(generationEntryState.ContentsSHA256)
+				}
+			}
+		}
+	}
+
+	objectsDirAbsPath, err := c.objectsDir()
+	if err != nil {
+		return err
+	}
+	dirEntries, err := c.baseSystem.ReadDir(objectsDirAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	for _, dirEntry := range dirEntries {
+		if _, ok := referenced[dirEntry.Name()]; ok {
+			continue
+		}
+		if err := c.baseSystem.Remove(objectsDirAbsPath.JoinString(dirEntry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeObject writes contents to the object with the SHA256 sum
+// contentsSHA256, if it does not already exist.
+func (c *Config) writeObject(contentsSHA256, contents []byte) error {
+	objectsDirAbsPath, err := c.objectsDir()
+	if err != nil {
+		return err
+	}
+	objectAbsPath := objectsDirAbsPath.JoinString(hex.EncodeToString(contentsSHA256))
+	switch _, err := c.baseSystem.Lstat(objectAbsPath); {
+	case err == nil:
+		return nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	if err := chezmoi.MkdirAll(c.baseSystem, objectsDirAbsPath, 0o700); err != nil {
+		return err
+	}
+	return c.baseSystem.WriteFile(objectAbsPath, contents, 0o600)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -48,6 +49,7 @@ type onepasswordArgs struct {
 	vault   string
 	account string
 	args    []string
+	stdin   []byte
 }
 
 type onepasswordItem struct {
@@ -204,7 +206,7 @@ func (c *Config) onepasswordItem(userArgs []string) (*onepasswordItem, error) {
 
 func (c *Config) onepasswordOutput(args *onepasswordArgs, withSessionToken withSessionTokenType) ([]byte, error) {
 	key := strings.Join(args.args, "\x00")
-	if output, ok := c.Onepassword.outputCache[key]; ok {
+	if output, ok := c.Onepassword.outputCache[key]; ok && args.stdin == nil {
 		return output, nil
 	}
 
@@ -220,12 +222,19 @@ func (c *Config) onepasswordOutput(args *onepasswordArgs, withSessionToken withS
 	}
 
 	cmd := exec.Command(c.Onepassword.Command, commandArgs...) //nolint:gosec
-	cmd.Stdin = os.Stdin
+	if args.stdin != nil {
+		cmd.Stdin = bytes.NewReader(args.stdin)
+	} else {
+		cmd.Stdin = os.Stdin
+	}
 	cmd.Stderr = os.Stderr
 	output, err := chezmoilog.LogCmdOutput(cmd)
 	if err != nil {
 		return nil, newCmdOutputError(cmd, output, err)
 	}
+	if args.stdin != nil {
+		return output, nil
+	}
 
 	if c.Onepassword.outputCache == nil {
 		c.Onepassword.outputCache = make(map[string][]byte)
@@ -257,6 +266,91 @@ func (c *Config) onepasswordReadTemplateFunc(url string, args ...string) string
 	return string(output)
 }
 
+func (c *Config) onepasswordWriteTemplateFunc(item, field, value string, args ...string) string {
+	if len(args) > 2 {
+		panic(fmt.Errorf("expected 3, 4, or 5 arguments, got %d", 3+len(args)))
+	}
+	if !c.writeSecrets {
+		return ""
+	}
+	if _, err := c.onepasswordWrite(append([]string{item}, args...), field, value, false); err != nil {
+		panic(err)
+	}
+	return ""
+}
+
+// onepasswordWrite sets field in the item described by userArgs to value. If
+// field already has value then onepasswordWrite does nothing. If the item does
+// not exist and create is true then a new Secure Note is created. It returns
+// true if the item was modified.
+func (c *Config) onepasswordWrite(userArgs []string, field, value string, create bool) (bool, error) {
+	// The item is passed to op as a JSON template on the standard input so
+	// that value does not appear in the process list.
+	var baseArgs []string
+	var item map[string]any
+	getArgs, err := c.newOnepasswordArgs([]string{"item", "get", "--format", "json"}, userArgs)
+	if err != nil {
+		return false, err
+	}
+	switch output, err := c.onepasswordOutput(getArgs, withSessionToken); {
+	case err != nil && create:
+		baseArgs = []string{"item", "create", "--category", "Secure Note", "--title"}
+		item = map[string]any{
+			"category": "SECURE_NOTE",
+			"fields": []any{
+				onepasswordNewField(field, value),
+			},
+		}
+	case err != nil:
+		return false, err
+	default:
+		if err := json.Unmarshal(output, &item); err != nil {
+			return false, newParseCmdOutputError(c.Onepassword.Command, getArgs.args, output, err)
+		}
+		fields, _ := item["fields"].([]any)
+		fieldExists := false
+		for _, f := range fields {
+			itemField, ok := f.(map[string]any)
+			if !ok {
+				continue
+			}
+			if _, ok := itemField["section"]; ok {
+				continue
+			}
+			if itemField["id"] == field || itemField["label"] == field {
+				if itemField["value"] == value {
+					return false, nil
+				}
+				// Preserve the type of existing fields.
+				itemField["value"] = value
+				fieldExists = true
+				break
+			}
+		}
+		if !fieldExists {
+			item["fields"] = append(fields, onepasswordNewField(field, value))
+		}
+		baseArgs = []string{"item", "edit"}
+	}
+	if c.dryRun {
+		return true, nil
+	}
+
+	args, err := c.newOnepasswordArgs(baseArgs, userArgs)
+	if err != nil {
+		return false, err
+	}
+	if args.stdin, err = json.Marshal(item); err != nil {
+		return false, err
+	}
+	_, err = c.onepasswordOutput(args, withSessionToken)
+
+	// Discard all cached output as it may now be stale.
+	c.Onepassword.outputCache = nil
+
+	return err == nil, err
+}
+
 func (c *Config) onepasswordAccount(key string) string {
 	accounts, err := c.onepasswordAccounts()
 	if err != nil {
@@ -378,3 +472,13 @@ func onepasswordUniqueSessionToken(environ []string) string {
 	}
 	return token
 }
+
+// onepasswordNewField returns a new text field with label and value for an
+// item template.
+func onepasswordNewField(label, value string) map[string]any {
+	return map[string]any{
+		"label": label,
+		"type":  "STRING",
+		"value": value,
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// pathMappingVersion is the version of the format of the path mapping file.
+const pathMappingVersion = 1
+
+// errAllWithPaths is returned when paths are given with --all.
+var errAllWithPaths = errors.New("--all: cannot specify paths")
+
+// A pathMapping maps a source path to a target path.
+type pathMapping struct {
+	Source string `json:"source" yaml:"source"`
+	Target string `json:"target" yaml:"target"`
+}
+
+// A pathMappingFile is a file containing the path mappings of all managed
+// entries, for use by editor plugins.
+type pathMappingFile struct {
+	Version   int           `json:"version"   yaml:"version"`
+	SourceDir string        `json:"sourceDir" yaml:"sourceDir"`
+	DestDir   string        `json:"destDir"   yaml:"destDir"`
+	Paths     []pathMapping `json:"paths"     yaml:"paths"`
+}
+
+// allPathMappings returns the path mappings of all managed entries that have
+// both a source path and a target path, sorted by target path. Scripts and
+// entries to be removed do not have a target path and externals do not have a
+// source path.
+func (c *Config) allPathMappings(sourceState *chezmoi.SourceState) []pathMapping {
+	pathMappings := []pathMapping{}
+	_ = sourceState.ForEach(func(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) error {
+		switch sourceStateEntry := sourceStateEntry.(type) {
+		case *chezmoi.SourceStateFile:
+			if sourceStateEntry.Attr.Type == chezmoi.SourceFileTypeScript {
+				return nil
+			}
+		case *chezmoi.SourceStateRemove:
+			return nil
+		}
+		if _, ok := sourceStateEntry.Origin().(*chezmoi.External); ok {
+			return nil
+		}
+		sourceRelPath := sourceStateEntry.SourceRelPath()
+		if sourceRelPath.Empty() {
+			return nil
+		}
+		pathMappings = append(pathMappings, pathMapping{
+			Source: c.SourceDirAbsPath.Join(sourceRelPath.RelPath()).String(),
+			Target: c.DestDirAbsPath.Join(targetRelPath).String(),
+		})
+		return nil
+	})
+	sort.Slice(pathMappings, func(i, j int) bool {
+		return pathMappings[i].Target < pathMappings[j].Target
+	})
+	return pathMappings
+}
+
+func pathMappingSource(pathMapping pathMapping) string {
+	return pathMapping.Source
+}
+
+func pathMappingTarget(pathMapping pathMapping) string {
+	return pathMapping.Target
+}
+
+// writePathMappings writes pathMappings as JSON if asJSON is true, or the
+// value of key for each path mapping otherwise.
+func (c *Config) writePathMappings(pathMappings []pathMapping, asJSON bool, key func(pathMapping) string) error {
+	if asJSON {
+		return c.marshal(writeDataFormatJSON, pathMappings)
+	}
+	builder := strings.Builder{}
+	for _, pathMapping := range pathMappings {
+		builder.WriteString(key(pathMapping))
+		builder.WriteByte('\n')
+	}
+	return c.writeOutputString(builder.String())
+}
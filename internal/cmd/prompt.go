@@ -16,6 +16,10 @@ import (
 // readBool reads a bool.
 func (c *Config) readBool(prompt string, defaultValue *bool) (bool, error) {
 	switch {
+	case c.nonInteractive && defaultValue != nil:
+		return *defaultValue, nil
+	case c.nonInteractive:
+		return false, &nonInteractiveError{prompt: prompt}
 	case c.noTTY:
 		fullPrompt := prompt
 		if defaultValue != nil {
@@ -47,6 +51,10 @@ func (c *Config) readBool(prompt string, defaultValue *bool) (bool, error) {
 // readChoice reads a choice.
 func (c *Config) readChoice(prompt string, choices []string, defaultValue *string) (string, error) {
 	switch {
+	case c.nonInteractive && defaultValue != nil:
+		return *defaultValue, nil
+	case c.nonInteractive:
+		return "", &nonInteractiveError{prompt: prompt}
 	case c.noTTY:
 		fullPrompt := prompt + " (" + strings.Join(choices, "/")
 		if defaultValue != nil {
@@ -79,6 +87,10 @@ func (c *Config) readChoice(prompt string, choices []string, defaultValue *strin
 // readInt reads an int.
 func (c *Config) readInt(prompt string, defaultValue *int64) (int64, error) {
 	switch {
+	case c.nonInteractive && defaultValue != nil:
+		return *defaultValue, nil
+	case c.nonInteractive:
+		return 0, &nonInteractiveError{prompt: prompt}
 	case c.noTTY:
 		fullPrompt := prompt
 		if defaultValue != nil {
@@ -126,6 +138,8 @@ func (c *Config) readLineRaw(prompt string) (string, error) {
 // readPassword reads a password.
 func (c *Config) readPassword(prompt string) (string, error) {
 	switch {
+	case c.nonInteractive:
+		return "", &nonInteractiveError{prompt: prompt}
 	case c.noTTY:
 		return c.readLineRaw(prompt)
 	case c.PINEntry.Command != "":
@@ -143,6 +157,10 @@ func (c *Config) readPassword(prompt string) (string, error) {
 // readString reads a string.
 func (c *Config) readString(prompt string, defaultValue *string) (string, error) {
 	switch {
+	case c.nonInteractive && defaultValue != nil:
+		return *defaultValue, nil
+	case c.nonInteractive:
+		return "", &nonInteractiveError{prompt: prompt}
 	case c.noTTY:
 		fullPrompt := prompt
 		if defaultValue != nil {
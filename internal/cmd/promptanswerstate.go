@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// promptAnswerStateBucket is the bucket for recording "always" and "never"
+// answers to apply prompts.
+var promptAnswerStateBucket = []byte("promptAnswerState")
+
+// Persistent prompt answers.
+const (
+	promptAnswerAlways = "always"
+	promptAnswerNever  = "never"
+)
+
+// A promptAnswerState records the persistent answers to the prompts for a
+// single target.
+type promptAnswerState struct {
+	Apply      string    `json:"apply,omitempty"`
+	Overwrite  string    `json:"overwrite,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// getPromptAnswerState returns the persistent answers to the prompts for
+// targetRelPath.
+func (c *Config) getPromptAnswerState(targetRelPath chezmoi.RelPath) (*promptAnswerState, error) {
+	var state promptAnswerState
+	if _, err := chezmoi.PersistentStateGet(
+		c.persistentState, promptAnswerStateBucket, []byte(targetRelPath.String()), &state,
+	); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// setPromptAnswerState records state as the persistent answers to the prompts
+// for targetRelPath.
+func (c *Config) setPromptAnswerState(targetRelPath chezmoi.RelPath, state *promptAnswerState) error {
+	state.RecordedAt = time.Now().UTC()
+	return chezmoi.PersistentStateSet(c.persistentState, promptAnswerStateBucket, []byte(targetRelPath.String()), state)
+}
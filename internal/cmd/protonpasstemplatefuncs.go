@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+type protonPassConfig struct {
+	Command   string   `json:"command" mapstructure:"command" yaml:"command"`
+	Args      []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	cache     map[string]string
+	cacheJSON map[string]any
+}
+
+func (c *Config) protonPassTemplateFunc(uri string) string {
+	if value, ok := c.ProtonPass.cache[uri]; ok {
+		return value
+	}
+
+	output, err := c.protonPassOutput("item", "view", uri)
+	if err != nil {
+		panic(err)
+	}
+	value := strings.TrimSuffix(string(output), "\n")
+
+	if c.ProtonPass.cache == nil {
+		c.ProtonPass.cache = make(map[string]string)
+	}
+	c.ProtonPass.cache[uri] = value
+	return value
+}
+
+func (c *Config) protonPassJSONTemplateFunc(uri string) any {
+	if data, ok := c.ProtonPass.cacheJSON[uri]; ok {
+		return data
+	}
+
+	output, err := c.protonPassOutput("item", "view", "--output", "json", uri)
+	if err != nil {
+		panic(err)
+	}
+
+	// Do not include the output in the error as it contains secrets.
+	var data any
+	if err := json.Unmarshal(output, &data); err != nil {
+		panic(fmt.Errorf("%s: parse error: %w", uri, err))
+	}
+
+	if c.ProtonPass.cacheJSON == nil {
+		c.ProtonPass.cacheJSON = make(map[string]any)
+	}
+	c.ProtonPass.cacheJSON[uri] = data
+	return data
+}
+
+func (c *Config) protonPassOutput(args ...string) ([]byte, error) {
+	name := c.ProtonPass.Command
+	args = append(slices.Clone(c.ProtonPass.Args), args...)
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := chezmoilog.LogCmdOutputRedacted(cmd)
+	if err != nil {
+		return nil, newCmdOutputError(cmd, output, err)
+	}
+	return output, nil
+}
@@ -103,9 +103,16 @@ func (c *Config) doPurge(options *doPurgeOptions) error {
 		}
 	}
 
+	// Remove the paths with the base system so that they are not moved to the
+	// trash, which is itself in the config directory by default.
+	var system chezmoi.System = c.baseSystem
+	if c.dryRun {
+		system = chezmoi.NewDryRunSystem(system)
+	}
+
 	// Remove all paths that exist.
 	for _, absPath := range absPaths {
-		switch _, err := c.destSystem.Stat(absPath); {
+		switch _, err := system.Stat(absPath); {
 		case errors.Is(err, fs.ErrNotExist):
 			continue
 		case err != nil:
@@ -126,7 +133,7 @@ func (c *Config) doPurge(options *doPurgeOptions) error {
 			}
 		}
 
-		switch err := c.destSystem.RemoveAll(absPath); {
+		switch err := system.RemoveAll(absPath); {
 		case errors.Is(err, fs.ErrPermission):
 			continue
 		case err != nil:
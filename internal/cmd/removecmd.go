@@ -4,14 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"sort"
+	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
 type removeCmdConfig struct {
-	recursive bool
+	excludePaths []string
+	filter       *chezmoi.EntryTypeFilter
+	recursive    bool
 }
 
 func (c *Config) newRemoveCmd() *cobra.Command {
@@ -32,12 +38,21 @@ func (c *Config) newRemoveCmd() *cobra.Command {
 	}
 
 	flags := removeCmd.Flags()
+	flags.VarP(c.remove.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.StringArrayVar(&c.remove.excludePaths, "exclude-path", c.remove.excludePaths, "Exclude targets matching pattern")
+	flags.VarP(c.remove.filter.Include, "include", "i", "Include entry types")
 	flags.BoolVarP(&c.remove.recursive, "recursive", "r", c.remove.recursive, "Recurse into subdirectories")
 
+	registerExcludeIncludeFlagCompletionFuncs(removeCmd)
+
 	return removeCmd
 }
 
 func (c *Config) runRemoveCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	args, err := c.expandTargetGlobs(sourceState, args)
+	if err != nil {
+		return err
+	}
 	targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{
 		mustBeManaged: true,
 		recursive:     c.remove.recursive,
@@ -45,6 +60,14 @@ func (c *Config) runRemoveCmd(cmd *cobra.Command, args []string, sourceState *ch
 	if err != nil {
 		return err
 	}
+	keptTargetRelPaths, err := c.removeKeptTargetRelPaths(sourceState)
+	if err != nil {
+		return err
+	}
+
+	// In dry run mode, collect the paths that would be removed instead of
+	// removing them.
+	dryRunAbsPaths := make(map[chezmoi.AbsPath]struct{})
 
 	for _, targetRelPath := range targetRelPaths {
 		destAbsPath := c.DestDirAbsPath.Join(targetRelPath)
@@ -62,11 +85,29 @@ func (c *Config) runRemoveCmd(cmd *cobra.Command, args []string, sourceState *ch
 		// present in the source state, we generate SourceStateRemove entries.
 		// So, if the source state entry is a SourceStateRemove then we know
 		// that there is no actual source state entry to remove.
+		if _, ok := keptTargetRelPaths[targetRelPath]; ok {
+			continue
+		}
 		var sourceAbsPath chezmoi.AbsPath
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
+		if !c.remove.filter.IncludeSourceStateEntry(sourceStateEntry) {
+			continue
+		}
 		if _, ok := sourceStateEntry.(*chezmoi.SourceStateRemove); !ok {
 			sourceAbsPath = c.SourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath())
 		}
+		if err := c.checkNoUnmanagedSubdirs(sourceState, destAbsPath); err != nil {
+			return err
+		}
+		if c.dryRun {
+			if err := c.addDestAbsPaths(dryRunAbsPaths, destAbsPath); err != nil {
+				return err
+			}
+			if !sourceAbsPath.Empty() {
+				dryRunAbsPaths[sourceAbsPath] = struct{}{}
+			}
+			continue
+		}
 		if !c.force {
 			var prompt string
 			if sourceAbsPath.Empty() {
@@ -100,5 +141,174 @@ func (c *Config) runRemoveCmd(cmd *cobra.Command, args []string, sourceState *ch
 			return err
 		}
 	}
+
+	if c.dryRun {
+		sortedAbsPaths := chezmoi.AbsPaths(maps.Keys(dryRunAbsPaths))
+		sort.Sort(sortedAbsPaths)
+		var builder strings.Builder
+		for _, absPath := range sortedAbsPaths {
+			fmt.Fprintln(&builder, absPath)
+		}
+		return c.writeOutputString(builder.String())
+	}
+
+	return nil
+}
+
+// addDestAbsPaths adds destAbsPath and, if it is a directory, everything in it,
+// to absPaths.
+func (c *Config) addDestAbsPaths(absPaths map[chezmoi.AbsPath]struct{}, destAbsPath chezmoi.AbsPath) error {
+	walkFunc := func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		}
+		absPaths[absPath] = struct{}{}
+		return nil
+	}
+	return chezmoi.Walk(c.destSystem, destAbsPath, walkFunc)
+}
+
+// removeKeptTargetRelPaths returns the targets that chezmoi remove must keep
+// because of the --exclude-path patterns. These are the targets that match a
+// pattern, everything in them, and the directories that contain them, as
+// removing a directory would remove the excluded targets in it.
+func (c *Config) removeKeptTargetRelPaths(sourceState *chezmoi.SourceState) (map[chezmoi.RelPath]struct{}, error) {
+	keptTargetRelPaths := make(map[chezmoi.RelPath]struct{})
+	if len(c.remove.excludePaths) == 0 {
+		return keptTargetRelPaths, nil
+	}
+	patterns := make([]string, 0, len(c.remove.excludePaths))
+	for _, arg := range c.remove.excludePaths {
+		pattern, err := c.targetRelPathPattern(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("%s: %w", arg, doublestar.ErrBadPattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	for _, targetRelPath := range sourceState.TargetRelPaths() {
+		// A target is excluded if it or any of its parent directories matches
+		// a pattern.
+		ancestorRelPaths := targetRelPathAncestors(targetRelPath)
+		excluded := false
+	FOR:
+		for _, relPath := range ancestorRelPaths {
+			for _, pattern := range patterns {
+				if match, _ := doublestar.Match(pattern, relPath.String()); match {
+					excluded = true
+					break FOR
+				}
+			}
+		}
+		if excluded {
+			for _, relPath := range ancestorRelPaths {
+				keptTargetRelPaths[relPath] = struct{}{}
+			}
+		}
+	}
+	return keptTargetRelPaths, nil
+}
+
+// targetRelPathAncestors returns targetRelPath and all of its parent
+// directories.
+func targetRelPathAncestors(targetRelPath chezmoi.RelPath) []chezmoi.RelPath {
+	components := targetRelPath.SplitAll()
+	ancestorRelPaths := make([]chezmoi.RelPath, 0, len(components))
+	for i := range components {
+		ancestorRelPaths = append(ancestorRelPaths, chezmoi.EmptyRelPath.Join(components[:i+1]...))
+	}
+	return ancestorRelPaths
+}
+
+// checkNoUnmanagedSubdirs returns an error if destAbsPath is a directory that
+// contains a non-empty directory that is not managed, to prevent chezmoi remove
+// from removing data that chezmoi does not know about.
+func (c *Config) checkNoUnmanagedSubdirs(sourceState *chezmoi.SourceState, destAbsPath chezmoi.AbsPath) error {
+	// vfs.Walk ignores errors returned for directories other than
+	// fs.SkipDir, so record the first unmanaged non-empty directory instead.
+	var unmanagedDirAbsPath chezmoi.AbsPath
+	walkFunc := func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		case !unmanagedDirAbsPath.Empty():
+			return fs.SkipDir
+		case absPath == destAbsPath || !fileInfo.IsDir():
+			return nil
+		}
+		targetRelPath, err := c.targetRelPath(absPath)
+		if err != nil {
+			return err
+		}
+		if sourceState.Get(targetRelPath) != nil {
+			return nil
+		}
+		dirEntries, err := c.destSystem.ReadDir(absPath)
+		if err != nil {
+			return err
+		}
+		if len(dirEntries) != 0 {
+			unmanagedDirAbsPath = absPath
+		}
+		return fs.SkipDir
+	}
+	if err := chezmoi.Walk(c.destSystem, destAbsPath, walkFunc); err != nil {
+		return err
+	}
+	if !unmanagedDirAbsPath.Empty() {
+		return fmt.Errorf("%s: refusing to remove, contains unmanaged non-empty directory %s", destAbsPath, unmanagedDirAbsPath)
+	}
 	return nil
 }
+
+// expandTargetGlobs returns args with every argument that contains a glob
+// pattern replaced by the targets that it matches.
+func (c *Config) expandTargetGlobs(sourceState *chezmoi.SourceState, args []string) ([]string, error) {
+	expandedArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[{") {
+			expandedArgs = append(expandedArgs, arg)
+			continue
+		}
+		pattern, err := c.targetRelPathPattern(arg)
+		if err != nil {
+			return nil, err
+		}
+		matches := 0
+		for _, targetRelPath := range sourceState.TargetRelPaths() {
+			switch match, err := doublestar.Match(pattern, targetRelPath.String()); {
+			case err != nil:
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			case match:
+				expandedArgs = append(expandedArgs, c.DestDirAbsPath.Join(targetRelPath).String())
+				matches++
+			}
+		}
+		if matches == 0 {
+			return nil, fmt.Errorf("%s: no matching targets", arg)
+		}
+	}
+	return expandedArgs, nil
+}
+
+// targetRelPathPattern returns the glob pattern arg, which is relative to the
+// current directory or the home directory, as a pattern relative to the
+// destination directory.
+func (c *Config) targetRelPathPattern(arg string) (string, error) {
+	patternAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
+	if err != nil {
+		return "", err
+	}
+	patternRelPath, err := c.targetRelPath(patternAbsPath)
+	if err != nil {
+		return "", err
+	}
+	return patternRelPath.String(), nil
+}
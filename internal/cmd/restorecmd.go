@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+type restoreCmdConfig struct {
+	purge bool
+}
+
+func (c *Config) newRestoreCmd() *cobra.Command {
+	restoreCmd := &cobra.Command{
+		Use:     "restore [target]...",
+		Short:   "Restore targets from the trash",
+		Long:    mustLongHelp("restore"),
+		Example: example("restore"),
+		RunE:    c.runRestoreCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+		),
+	}
+
+	flags := restoreCmd.Flags()
+	flags.BoolVar(&c.restore.purge, "purge", c.restore.purge, "Permanently remove everything in the trash")
+
+	return restoreCmd
+}
+
+func (c *Config) runRestoreCmd(cmd *cobra.Command, args []string) error {
+	trashEntries, err := chezmoi.TrashEntries(c.persistentState)
+	if err != nil {
+		return err
+	}
+	trashDirAbsPath, err := c.trashDir()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.restore.purge:
+		for _, trashEntry := range trashEntries {
+			if err := c.baseSystem.RemoveAll(trashDirAbsPath.JoinString(trashEntry.ID)); err != nil {
+				return err
+			}
+			if err := c.persistentState.Delete(chezmoi.TrashStateBucket, []byte(trashEntry.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case len(args) == 0:
+		var builder strings.Builder
+		for _, trashEntry := range trashEntries {
+			fmt.Fprintf(&builder, "%s %s\n", trashEntry.TrashedAt.Local().Format(time.RFC3339), trashEntry.Path)
+		}
+		return c.writeOutputString(builder.String())
+	}
+
+	// Index the most recently trashed entry for each path.
+	latestTrashEntries := make(map[chezmoi.AbsPath]*chezmoi.TrashEntry)
+	for _, trashEntry := range trashEntries {
+		latestTrashEntries[trashEntry.Path] = trashEntry
+	}
+
+	for _, arg := range args {
+		destAbsPath, err := chezmoi.NewAbsPathFromExtPath(filepath.Clean(arg), c.homeDirAbsPath)
+		if err != nil {
+			return err
+		}
+		trashEntry, ok := latestTrashEntries[destAbsPath]
+		if !ok {
+			return fmt.Errorf("%s: not in trash", arg)
+		}
+
+		switch _, err := c.destSystem.Lstat(destAbsPath); {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		case !c.force:
+			return fmt.Errorf("%s: already exists", arg)
+		default:
+			if err := c.destSystem.RemoveAll(destAbsPath); err != nil {
+				return err
+			}
+		}
+
+		if err := chezmoi.MkdirAll(c.destSystem, destAbsPath.Dir(), fs.ModePerm&^c.Umask); err != nil {
+			return err
+		}
+		if err := chezmoi.MoveAll(c.destSystem, trashDirAbsPath.JoinString(trashEntry.ID), destAbsPath); err != nil {
+			return err
+		}
+		if err := c.persistentState.Delete(chezmoi.TrashStateBucket, []byte(trashEntry.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trashDir returns the directory that removed entries are moved to if the
+// trash is enabled. By default, it is next to the persistent state file.
+func (c *Config) trashDir() (chezmoi.AbsPath, error) {
+	if !c.Trash.DirAbsPath.Empty() {
+		return c.Trash.DirAbsPath, nil
+	}
+	persistentStateFileAbsPath, err := c.persistentStateFile()
+	if err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	return persistentStateFileAbsPath.Dir().JoinString("trash"), nil
+}
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// snapshotStateBucket is the bucket for recording snapshots of the destination
+// state taken before apply.
+var snapshotStateBucket = []byte("snapshotState")
+
+// snapshotIDFormat is the format of snapshot IDs. It has a fixed width so that
+// IDs sort chronologically.
+const snapshotIDFormat = "20060102T150405.000000000Z"
+
+type rollbackCmdConfig struct {
+	MaxSnapshots int  `json:"maxSnapshots" mapstructure:"maxSnapshots" yaml:"maxSnapshots"`
+	Snapshot     bool `json:"snapshot"     mapstructure:"snapshot"     yaml:"snapshot"`
+	list         bool
+	to           string
+}
+
+// An applySnapshot records the state of entries in the destination directory
+// before they were changed by an apply.
+type applySnapshot struct {
+	ID        string           `json:"id"        yaml:"id"`
+	StartedAt time.Time        `json:"startedAt" yaml:"startedAt"`
+	Entries   []*snapshotEntry `json:"entries"   yaml:"entries"`
+}
+
+// A snapshotEntry records the state of a single entry before it was changed.
+// The contents of files and the linknames of symlinks are stored in the
+// snapshot objects directory, addressed by their SHA256 sum. Descendant
+// entries record the contents of a directory that was replaced, which are not
+// managed by chezmoi.
+type snapshotEntry struct {
+	Path           chezmoi.AbsPath        `json:"path"                     yaml:"path"`
+	Type           chezmoi.EntryStateType `json:"type"                     yaml:"type"`
+	Mode           fs.FileMode            `json:"mode,omitempty"           yaml:"mode,omitempty"`
+	ContentsSHA256 chezmoi.HexBytes       `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
+	Descendant     bool                   `json:"descendant,omitempty"     yaml:"descendant,omitempty"`
+}
+
+func (c *Config) newRollbackCmd() *cobra.Command {
+	rollbackCmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   "Restore the destination directory to its state before an apply",
+		Long:    mustLongHelp("rollback"),
+		Example: example("rollback"),
+		Args:    cobra.NoArgs,
+		RunE:    c.runRollbackCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+		),
+	}
+
+	flags := rollbackCmd.Flags()
+	flags.BoolVarP(&c.Rollback.list, "list", "l", c.Rollback.list, "List snapshots")
+	flags.StringVar(&c.Rollback.to, "to", c.Rollback.to, "Restore the state before snapshot ID")
+
+	return rollbackCmd
+}
+
+func (c *Config) runRollbackCmd(cmd *cobra.Command, args []string) error {
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return err
+	}
+
+	if c.Rollback.list {
+		var builder strings.Builder
+		for _, snapshot := range snapshots {
+			fmt.Fprintf(&builder, "%s %s %d\n",
+				snapshot.ID,
+				snapshot.StartedAt.Local().Format(time.RFC3339),
+				len(snapshot.Entries),
+			)
+		}
+		return c.writeOutputString(builder.String())
+	}
+
+	if len(snapshots) == 0 {
+		return errors.New("no snapshots")
+	}
+	index := len(snapshots) - 1
+	if c.Rollback.to != "" {
+		index = sort.Search(len(snapshots), func(i int) bool {
+			return snapshots[i].ID >= c.Rollback.to
+		})
+		if index == len(snapshots) || snapshots[index].ID != c.Rollback.to {
+			return fmt.Errorf("%s: snapshot not found", c.Rollback.to)
+		}
+	}
+
+	// Restore snapshots newest first, so that the destination directory ends
+	// up in the state before the oldest restored snapshot.
+	for i := len(snapshots) - 1; i >= index; i-- {
+		snapshot := snapshots[i]
+		for j := len(snapshot.Entries) - 1; j >= 0; j-- {
+			if err := c.restoreSnapshotEntry(snapshot.Entries[j]); err != nil {
+				return err
+			}
+		}
+		if err := c.persistentState.Delete(snapshotStateBucket, []byte(snapshot.ID)); err != nil {
+			return err
+		}
+	}
+
+	return c.removeUnreferencedObjects()
+}
+
+// newSnapshot returns a new snapshot.
+func newSnapshot() *applySnapshot {
+	startedAt := time.Now().UTC()
+	return &applySnapshot{
+		ID:        startedAt.Format(snapshotIDFormat),
+		StartedAt: startedAt,
+	}
+}
+
+// newSnapshotPreApplyFunc returns a chezmoi.PreApplyFunc that calls
+// preApplyFunc and then records the actual state of entries that are about to
+// be changed in snapshot.
+func (c *Config) newSnapshotPreApplyFunc(
+	snapshot *applySnapshot,
+	targetDirAbsPath chezmoi.AbsPath,
+	preApplyFunc chezmoi.PreApplyFunc,
+) chezmoi.PreApplyFunc {
+	return func(
+		targetRelPath chezmoi.RelPath,
+		targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+	) error {
+		if preApplyFunc != nil {
+			if err := preApplyFunc(targetRelPath, targetEntryState, lastWrittenEntryState, actualEntryState); err != nil {
+				return err
+			}
+		}
+		if targetEntryState.Type == chezmoi.EntryStateTypeScript || targetEntryState.Equivalent(actualEntryState) {
+			return nil
+		}
+
+		snapshotEntry := &snapshotEntry{
+			Path: targetDirAbsPath.Join(targetRelPath),
+			Type: actualEntryState.Type,
+			Mode: actualEntryState.Mode,
+		}
+		switch actualEntryState.Type {
+		case chezmoi.EntryStateTypeDir:
+			// If the directory is about to be replaced then its contents are
+			// removed too, so record them. Entries are restored in reverse
+			// order, so record them in reverse so that parent directories are
+			// restored before their children.
+			if targetEntryState.Type != chezmoi.EntryStateTypeDir {
+				descendantEntries, err := c.snapshotDescendantEntries(snapshotEntry.Path)
+				if err != nil {
+					return err
+				}
+				for i := len(descendantEntries) - 1; i >= 0; i-- {
+					snapshot.Entries = append(snapshot.Entries, descendantEntries[i])
+				}
+			}
+		case chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeSymlink:
+			contents := actualEntryState.Contents()
+			contentsSHA256 := chezmoi.SHA256Sum(contents)
+			if err := c.writeObject(contentsSHA256, contents); err != nil {
+				return err
+			}
+			snapshotEntry.ContentsSHA256 = contentsSHA256
+		}
+		snapshot.Entries = append(snapshot.Entries, snapshotEntry)
+		return nil
+	}
+}
+
+// recordSnapshot records snapshot once the apply has finished and prunes old
+// snapshots. Snapshots without entries are not recorded.
+func (c *Config) recordSnapshot(snapshot *applySnapshot) {
+	if err := c.recordSnapshotErr(snapshot); err != nil {
+		c.errorf("%v\n", err)
+	}
+}
+
+func (c *Config) recordSnapshotErr(snapshot *applySnapshot) error {
+	if len(snapshot.Entries) == 0 {
+		return nil
+	}
+	if err := chezmoi.PersistentStateSet(c.persistentState, snapshotStateBucket, []byte(snapshot.ID), snapshot); err != nil {
+		return err
+	}
+	return c.pruneSnapshots()
+}
+
+// snapshotDescendantEntries records the entries in the directory dirAbsPath,
+// parents before children.
+func (c *Config) snapshotDescendantEntries(dirAbsPath chezmoi.AbsPath) ([]*snapshotEntry, error) {
+	var snapshotEntries []*snapshotEntry
+	if err := chezmoi.Walk(c.destSystem, dirAbsPath, func(absPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case absPath == dirAbsPath:
+			return nil
+		}
+		snapshotEntry := &snapshotEntry{
+			Path:       absPath,
+			Mode:       fileInfo.Mode(),
+			Descendant: true,
+		}
+		var contents []byte
+		switch fileInfo.Mode().Type() {
+		case fs.ModeDir:
+			snapshotEntry.Type = chezmoi.EntryStateTypeDir
+			snapshotEntry.Mode = fs.ModeDir | fileInfo.Mode().Perm()
+		case 0:
+			snapshotEntry.Type = chezmoi.EntryStateTypeFile
+			if contents, err = c.destSystem.ReadFile(absPath); err != nil {
+				return err
+			}
+		case fs.ModeSymlink:
+			snapshotEntry.Type = chezmoi.EntryStateTypeSymlink
+			snapshotEntry.Mode = fs.ModeSymlink
+			linkname, err := c.destSystem.Readlink(absPath)
+			if err != nil {
+				return err
+			}
+			contents = []byte(linkname)
+		default:
+			// Other file types, like sockets and named pipes, cannot be
+			// restored.
+			return nil
+		}
+		if snapshotEntry.Type != chezmoi.EntryStateTypeDir {
+			snapshotEntry.ContentsSHA256 = chezmoi.SHA256Sum(contents)
+			if err := c.writeObject(snapshotEntry.ContentsSHA256, contents); err != nil {
+				return err
+			}
+		}
+		snapshotEntries = append(snapshotEntries, snapshotEntry)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return snapshotEntries, nil
+}
+
+// pruneSnapshots removes the oldest snapshots so that at most
+// c.Rollback.MaxSnapshots remain.
+func (c *Config) pruneSnapshots() error {
+	if c.Rollback.MaxSnapshots <= 0 {
+		return nil
+	}
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) <= c.Rollback.MaxSnapshots {
+		return nil
+	}
+	for _, snapshot := range snapshots[:len(snapshots)-c.Rollback.MaxSnapshots] {
+		if err := c.persistentState.Delete(snapshotStateBucket, []byte(snapshot.ID)); err != nil {
+			return err
+		}
+	}
+	return c.removeUnreferencedObjects()
+}
+
+// restoreSnapshotEntry restores the entry recorded in snapshotEntry.
+func (c *Config) restoreSnapshotEntry(snapshotEntry *snapshotEntry) error {
+	absPath := snapshotEntry.Path
+	fileInfo, err := c.destSystem.Lstat(absPath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	entryState := &chezmoi.EntryState{
+		Type:           snapshotEntry.Type,
+		Mode:           snapshotEntry.Mode,
+		ContentsSHA256: snapshotEntry.ContentsSHA256,
+	}
+	switch snapshotEntry.Type {
+	case chezmoi.EntryStateTypeRemove:
+		if exists {
+			if err := c.destSystem.Remove(absPath); err != nil {
+				return err
+			}
+		}
+		return c.persistentState.Delete(chezmoi.EntryStateBucket, absPath.Bytes())
+	case chezmoi.EntryStateTypeDir:
+		switch {
+		case exists && fileInfo.IsDir():
+			if err := c.destSystem.Chmod(absPath, snapshotEntry.Mode.Perm()); err != nil {
+				return err
+			}
+		default:
+			if exists {
+				if err := c.destSystem.RemoveAll(absPath); err != nil {
+					return err
+				}
+			}
+			if err := c.destSystem.Mkdir(absPath, snapshotEntry.Mode.Perm()); err != nil {
+				return err
+			}
+		}
+	case chezmoi.EntryStateTypeFile, chezmoi.EntryStateTypeSymlink:
+		contents, err := c.readObject(snapshotEntry.ContentsSHA256)
+		if err != nil {
+			return err
+		}
+		if exists && (snapshotEntry.Type == chezmoi.EntryStateTypeSymlink || !fileInfo.Mode().IsRegular()) {
+			if err := c.destSystem.RemoveAll(absPath); err != nil {
+				return err
+			}
+		}
+		if snapshotEntry.Type == chezmoi.EntryStateTypeSymlink {
+			if err := c.destSystem.WriteSymlink(string(contents), absPath); err != nil {
+				return err
+			}
+		} else if err := c.destSystem.WriteFile(absPath, contents, snapshotEntry.Mode.Perm()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: unsupported snapshot entry type %s", absPath, snapshotEntry.Type)
+	}
+	if snapshotEntry.Descendant {
+		return nil
+	}
+	return chezmoi.PersistentStateSet(c.persistentState, chezmoi.EntryStateBucket, absPath.Bytes(), entryState)
+}
+
+// snapshots returns all snapshots, oldest first.
+func (c *Config) snapshots() ([]*applySnapshot, error) {
+	var snapshots []*applySnapshot
+	if err := c.persistentState.ForEach(snapshotStateBucket, func(k, v []byte) error {
+		var snapshot applySnapshot
+		if err := chezmoi.FormatJSON.Unmarshal(v, &snapshot); err != nil {
+			return err
+		}
+		snapshots = append(snapshots, &snapshot)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots, nil
+}
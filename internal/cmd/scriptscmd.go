@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+type scriptsCmdConfig struct {
+	CaptureOutput bool `json:"captureOutput" mapstructure:"captureOutput" yaml:"captureOutput"`
+	MaxLogEntries int  `json:"maxLogEntries" mapstructure:"maxLogEntries" yaml:"maxLogEntries"`
+	MaxOutputSize int  `json:"maxOutputSize" mapstructure:"maxOutputSize" yaml:"maxOutputSize"`
+	log           scriptsLogCmdConfig
+}
+
+type scriptsLogCmdConfig struct {
+	failed bool
+	format writeDataFormat
+	limit  int
+}
+
+func (c *Config) newScriptsCmd() *cobra.Command {
+	scriptsCmd := &cobra.Command{
+		Use:     "scripts",
+		Short:   "Inspect scripts",
+		Long:    mustLongHelp("scripts"),
+		Example: example("scripts"),
+	}
+
+	scriptsLogCmd := &cobra.Command{
+		Use:   "log [script]...",
+		Short: "Print the log of script runs",
+		RunE:  c.runScriptsLogCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	scriptsLogFlags := scriptsLogCmd.Flags()
+	scriptsLogFlags.BoolVar(&c.Scripts.log.failed, "failed", c.Scripts.log.failed, "Only print failed runs")
+	scriptsLogFlags.VarP(&c.Scripts.log.format, "format", "f", "Output format")
+	scriptsLogFlags.IntVar(&c.Scripts.log.limit, "limit", c.Scripts.log.limit, "Print at most this many runs")
+	if err := scriptsLogCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+	scriptsCmd.AddCommand(scriptsLogCmd)
+
+	return scriptsCmd
+}
+
+func (c *Config) runScriptsLogCmd(cmd *cobra.Command, args []string) error {
+	scriptLogEntries, err := chezmoi.ScriptLogEntries(c.persistentState)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]struct{}, len(args))
+	for _, arg := range args {
+		names[arg] = struct{}{}
+	}
+	filteredScriptLogEntries := make([]*chezmoi.ScriptLogEntry, 0, len(scriptLogEntries))
+	for _, scriptLogEntry := range scriptLogEntries {
+		if c.Scripts.log.failed && !scriptLogEntry.Failed() {
+			continue
+		}
+		if len(names) != 0 {
+			if _, ok := names[scriptLogEntry.Name.String()]; !ok {
+				if _, ok := names[scriptLogEntry.Name.Base()]; !ok {
+					continue
+				}
+			}
+		}
+		filteredScriptLogEntries = append(filteredScriptLogEntries, scriptLogEntry)
+	}
+	if limit := c.Scripts.log.limit; limit > 0 && len(filteredScriptLogEntries) > limit {
+		filteredScriptLogEntries = filteredScriptLogEntries[len(filteredScriptLogEntries)-limit:]
+	}
+
+	if c.Scripts.log.format != "" {
+		return c.marshal(c.Scripts.log.format, filteredScriptLogEntries)
+	}
+
+	return c.writeOutputString(formatScriptLogEntries(filteredScriptLogEntries, true))
+}
+
+// reportScriptRuns prints a summary of the scripts run since startedAt to
+// stderr if any of them failed.
+func (c *Config) reportScriptRuns(startedAt time.Time) {
+	scriptLogEntries, err := chezmoi.ScriptLogEntries(c.persistentState)
+	if err != nil {
+		c.errorf("%v\n", err)
+		return
+	}
+	var runScriptLogEntries []*chezmoi.ScriptLogEntry
+	failed := false
+	for _, scriptLogEntry := range scriptLogEntries {
+		if scriptLogEntry.StartedAt.Before(startedAt) {
+			continue
+		}
+		runScriptLogEntries = append(runScriptLogEntries, scriptLogEntry)
+		failed = failed || scriptLogEntry.Failed()
+	}
+	if !failed {
+		return
+	}
+	fmt.Fprintf(c.stderr, "chezmoi: ran %d script(s):\n", len(runScriptLogEntries))
+	fmt.Fprint(c.stderr, formatScriptLogEntries(runScriptLogEntries, false))
+}
+
+// formatScriptLogEntries returns scriptLogEntries formatted as text. If
+// includeOutput is true then any recorded output is included.
+func formatScriptLogEntries(scriptLogEntries []*chezmoi.ScriptLogEntry, includeOutput bool) string {
+	var builder strings.Builder
+	for _, scriptLogEntry := range scriptLogEntries {
+		status := "ok"
+		if scriptLogEntry.Failed() {
+			status = "failed"
+		}
+		attempts := ""
+		if scriptLogEntry.Attempts > 1 {
+			attempts = fmt.Sprintf(", %d attempts", scriptLogEntry.Attempts)
+		}
+		fmt.Fprintf(&builder, "%s %s %s (exit code %d, %s%s)\n",
+			scriptLogEntry.StartedAt.Local().Format(time.RFC3339),
+			scriptLogEntry.Name,
+			status,
+			scriptLogEntry.ExitCode,
+			time.Duration(scriptLogEntry.Duration),
+			attempts,
+		)
+		if !includeOutput {
+			continue
+		}
+		if scriptLogEntry.Error != "" {
+			fmt.Fprintf(&builder, "error: %s\n", scriptLogEntry.Error)
+		}
+		builder.WriteString(scriptLogEntry.Stdout)
+		builder.WriteString(scriptLogEntry.Stderr)
+	}
+	return builder.String()
+}
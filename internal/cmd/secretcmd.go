@@ -3,7 +3,9 @@ package cmd
 import "github.com/spf13/cobra"
 
 type secretCmdConfig struct {
-	keyring secretKeyringCmdConfig
+	keyring     secretKeyringCmdConfig
+	onepassword secretOnepasswordCmdConfig
+	vault       secretVaultCmdConfig
 }
 
 func (c *Config) newSecretCmd() *cobra.Command {
@@ -18,6 +20,8 @@ func (c *Config) newSecretCmd() *cobra.Command {
 	if secretKeyringCmd := c.newSecretKeyringCmd(); secretKeyringCmd != nil {
 		secretCmd.AddCommand(secretKeyringCmd)
 	}
+	secretCmd.AddCommand(c.newSecretOnepasswordCmd())
+	secretCmd.AddCommand(c.newSecretVaultCmd())
 
 	return secretCmd
 }
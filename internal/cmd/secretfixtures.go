@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// secretFixturesWildcardKey is the key of the fixture that matches any
+// arguments.
+const secretFixturesWildcardKey = "*"
+
+// useSecretFixtures replaces c's secret template functions with functions that
+// return values from the secret fixtures file instead of contacting secret
+// managers, and c's secret write template functions with functions that do
+// nothing.
+//
+// The secret fixtures file maps template function names to maps of arguments,
+// joined with spaces, to values.
+func (c *Config) useSecretFixtures() error {
+	format, err := chezmoi.FormatFromAbsPath(c.SecretFixtures)
+	if err != nil {
+		return err
+	}
+	data, err := c.baseSystem.ReadFile(c.SecretFixtures)
+	if err != nil {
+		return err
+	}
+	var fixtures map[string]map[string]any
+	if err := format.Unmarshal(data, &fixtures); err != nil {
+		return fmt.Errorf("%s: %w", c.SecretFixtures, err)
+	}
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for _, name := range secretTemplateFuncNames {
+		templateFunc, ok := c.templateFuncs[name]
+		if !ok {
+			continue
+		}
+		name := name
+		funcType := reflect.TypeOf(templateFunc)
+		c.templateFuncs[name] = reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+			key := secretFixtureKey(funcType, args)
+			value, ok := fixtures[name][key]
+			if !ok {
+				value, ok = fixtures[name][secretFixturesWildcardKey]
+			}
+			if !ok {
+				panic(fmt.Errorf("%s: no fixture for %s %s", c.SecretFixtures, name, key))
+			}
+			result, err := secretFixtureValue(value, funcType.Out(0))
+			if err != nil {
+				panic(fmt.Errorf("%s: %s %s: %w", c.SecretFixtures, name, key, err))
+			}
+			results := []reflect.Value{result}
+			if funcType.NumOut() == 2 && funcType.Out(1) == errorType {
+				results = append(results, reflect.Zero(errorType))
+			}
+			return results
+		}).Interface()
+	}
+
+	for _, name := range secretWriteTemplateFuncNames {
+		templateFunc, ok := c.templateFuncs[name]
+		if !ok {
+			continue
+		}
+		funcType := reflect.TypeOf(templateFunc)
+		c.templateFuncs[name] = reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+			results := make([]reflect.Value, 0, funcType.NumOut())
+			for i := 0; i < funcType.NumOut(); i++ {
+				results = append(results, reflect.Zero(funcType.Out(i)))
+			}
+			return results
+		}).Interface()
+	}
+
+	return nil
+}
+
+// secretFixtureKey returns the fixture key for args passed to a function of
+// type funcType.
+func secretFixtureKey(funcType reflect.Type, args []reflect.Value) string {
+	var argStrs []string
+	for i, arg := range args {
+		if funcType.IsVariadic() && i == len(args)-1 {
+			for j := 0; j < arg.Len(); j++ {
+				argStrs = append(argStrs, fmt.Sprint(arg.Index(j).Interface()))
+			}
+			continue
+		}
+		argStrs = append(argStrs, fmt.Sprint(arg.Interface()))
+	}
+	return strings.Join(argStrs, " ")
+}
+
+// secretFixtureValue converts the fixture value to type outType.
+func secretFixtureValue(value any, outType reflect.Type) (reflect.Value, error) {
+	switch {
+	case value == nil:
+		return reflect.Zero(outType), nil
+	case reflect.TypeOf(value).AssignableTo(outType):
+		result := reflect.New(outType).Elem()
+		result.Set(reflect.ValueOf(value))
+		return result, nil
+	case outType.Kind() == reflect.String:
+		return reflect.ValueOf(fmt.Sprint(value)).Convert(outType), nil
+	case outType == reflect.TypeOf([]byte(nil)):
+		if s, ok := value.(string); ok {
+			return reflect.ValueOf([]byte(s)), nil
+		}
+		fallthrough
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result := reflect.New(outType)
+		if err := json.Unmarshal(data, result.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+		return result.Elem(), nil
+	}
+}
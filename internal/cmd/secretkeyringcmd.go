@@ -4,7 +4,7 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
-	"github.com/zalando/go-keyring"
+	"github.com/spf13/pflag"
 )
 
 type secretKeyringCmdConfig struct {
@@ -14,19 +14,26 @@ type secretKeyringCmdConfig struct {
 }
 
 type secretKeyringDeleteCmdConfig struct {
-	service string
-	user    string
+	secretKeyringItemConfig
 }
 
 type secretKeyringGetCmdConfig struct {
-	service string
-	user    string
+	secretKeyringItemConfig
 }
 
 type secretKeyringSetCmdConfig struct {
-	service string
-	user    string
-	value   string
+	secretKeyringItemConfig
+	value string
+}
+
+// A secretKeyringItemConfig contains the flags that identify a keyring item.
+type secretKeyringItemConfig struct {
+	service    string
+	user       string
+	collection string
+	target     string
+	label      string
+	attributes map[string]string
 }
 
 func (c *Config) newSecretKeyringCmd() *cobra.Command {
@@ -46,8 +53,7 @@ func (c *Config) newSecretKeyringCmd() *cobra.Command {
 		),
 	}
 	secretKeyringDeletePersistentFlags := keyringDeleteCmd.PersistentFlags()
-	secretKeyringDeletePersistentFlags.StringVar(&c.secret.keyring.delete.service, "service", "", "service")
-	secretKeyringDeletePersistentFlags.StringVar(&c.secret.keyring.delete.user, "user", "", "user")
+	c.secret.keyring.delete.addFlags(secretKeyringDeletePersistentFlags)
 	markPersistentFlagsRequired(keyringDeleteCmd, "service", "user")
 	keyringCmd.AddCommand(keyringDeleteCmd)
 
@@ -61,8 +67,7 @@ func (c *Config) newSecretKeyringCmd() *cobra.Command {
 		),
 	}
 	secretKeyringGetPersistentFlags := keyringGetCmd.PersistentFlags()
-	secretKeyringGetPersistentFlags.StringVar(&c.secret.keyring.get.service, "service", "", "service")
-	secretKeyringGetPersistentFlags.StringVar(&c.secret.keyring.get.user, "user", "", "user")
+	c.secret.keyring.get.addFlags(secretKeyringGetPersistentFlags)
 	markPersistentFlagsRequired(keyringGetCmd, "service", "user")
 	keyringCmd.AddCommand(keyringGetCmd)
 
@@ -76,8 +81,7 @@ func (c *Config) newSecretKeyringCmd() *cobra.Command {
 		),
 	}
 	secretKeyringSetPersistentFlags := keyringSetCmd.PersistentFlags()
-	secretKeyringSetPersistentFlags.StringVar(&c.secret.keyring.set.service, "service", "", "service")
-	secretKeyringSetPersistentFlags.StringVar(&c.secret.keyring.set.user, "user", "", "user")
+	c.secret.keyring.set.addFlags(secretKeyringSetPersistentFlags)
 	secretKeyringSetPersistentFlags.StringVar(&c.secret.keyring.set.value, "value", "", "value")
 	markPersistentFlagsRequired(keyringSetCmd, "service", "user")
 	keyringCmd.AddCommand(keyringSetCmd)
@@ -86,11 +90,11 @@ func (c *Config) newSecretKeyringCmd() *cobra.Command {
 }
 
 func (c *Config) runSecretKeyringDeleteCmdE(cmd *cobra.Command, args []string) error {
-	return keyring.Delete(c.secret.keyring.delete.service, c.secret.keyring.delete.user)
+	return c.keyringBackend().Delete(c.secret.keyring.delete.item())
 }
 
 func (c *Config) runSecretKeyringGetCmdE(cmd *cobra.Command, args []string) error {
-	value, err := keyring.Get(c.secret.keyring.get.service, c.secret.keyring.get.user)
+	value, err := c.keyringBackend().Get(c.secret.keyring.get.item())
 	if err != nil {
 		return err
 	}
@@ -106,5 +110,28 @@ func (c *Config) runSecretKeyringSetCmdE(cmd *cobra.Command, args []string) erro
 			return err
 		}
 	}
-	return keyring.Set(c.secret.keyring.set.service, c.secret.keyring.set.user, value)
+	_, err := c.keyringSet(c.secret.keyring.set.item(), value)
+	return err
+}
+
+// addFlags adds the flags that identify a keyring item to flags.
+func (c *secretKeyringItemConfig) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.service, "service", "", "service")
+	flags.StringVar(&c.user, "user", "", "user")
+	flags.StringVar(&c.collection, "collection", "", "collection or keychain")
+	flags.StringVar(&c.target, "target", "", "Windows Credential Manager target name")
+	flags.StringVar(&c.label, "label", "", "label")
+	flags.StringToStringVar(&c.attributes, "attribute", nil, "attribute")
+}
+
+// item returns the keyring item identified by c.
+func (c *secretKeyringItemConfig) item() *keyringItem {
+	return &keyringItem{
+		service:    c.service,
+		user:       c.user,
+		collection: c.collection,
+		target:     c.target,
+		label:      c.label,
+		attributes: c.attributes,
+	}
 }
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type secretOnepasswordCmdConfig struct {
+	set secretOnepasswordSetCmdConfig
+}
+
+type secretOnepasswordSetCmdConfig struct {
+	account string
+	create  bool
+	field   string
+	item    string
+	value   string
+	vault   string
+}
+
+func (c *Config) newSecretOnepasswordCmd() *cobra.Command {
+	onepasswordCmd := &cobra.Command{
+		Use:   "onepassword",
+		Args:  cobra.NoArgs,
+		Short: "Interact with 1Password",
+	}
+
+	onepasswordSetCmd := &cobra.Command{
+		Use:   "set",
+		Args:  cobra.NoArgs,
+		Short: "Set a field in 1Password",
+		RunE:  c.runSecretOnepasswordSetCmdE,
+	}
+	secretOnepasswordSetPersistentFlags := onepasswordSetCmd.PersistentFlags()
+	secretOnepasswordSetPersistentFlags.StringVar(&c.secret.onepassword.set.account, "account", "", "account")
+	secretOnepasswordSetPersistentFlags.BoolVar(&c.secret.onepassword.set.create, "create", false, "Create the item if it does not exist")
+	secretOnepasswordSetPersistentFlags.StringVar(&c.secret.onepassword.set.field, "field", "", "field")
+	secretOnepasswordSetPersistentFlags.StringVar(&c.secret.onepassword.set.item, "item", "", "item")
+	secretOnepasswordSetPersistentFlags.StringVar(&c.secret.onepassword.set.value, "value", "", "value")
+	secretOnepasswordSetPersistentFlags.StringVar(&c.secret.onepassword.set.vault, "vault", "", "vault")
+	markPersistentFlagsRequired(onepasswordSetCmd, "item", "field")
+	onepasswordCmd.AddCommand(onepasswordSetCmd)
+
+	return onepasswordCmd
+}
+
+func (c *Config) runSecretOnepasswordSetCmdE(cmd *cobra.Command, args []string) error {
+	value := c.secret.onepassword.set.value
+	if value == "" {
+		var err error
+		value, err = c.readPassword("Value: ")
+		if err != nil {
+			return err
+		}
+	}
+	userArgs := []string{
+		c.secret.onepassword.set.item,
+		c.secret.onepassword.set.vault,
+		c.secret.onepassword.set.account,
+	}
+	_, err := c.onepasswordWrite(userArgs, c.secret.onepassword.set.field, value, c.secret.onepassword.set.create)
+	return err
+}
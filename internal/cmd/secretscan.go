@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/git"
+)
+
+const (
+	// secretAllowComment is the comment that allows secrets on a line.
+	secretAllowComment = "gitleaks:allow"
+
+	// secretMinEntropy is the minimum Shannon entropy, in bits per
+	// character, of tokens reported as high-entropy strings.
+	secretMinEntropy = 4.5
+)
+
+// secretTokenRx matches tokens that might be secrets if they have a high
+// entropy.
+var secretTokenRx = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{32,}`)
+
+// A secretsAllowlistConfig contains the paths and secrets that are never
+// reported by the secret scanner.
+type secretsAllowlistConfig struct {
+	Paths   []string `json:"paths"   mapstructure:"paths"   yaml:"paths"`
+	Regexes []string `json:"regexes" mapstructure:"regexes" yaml:"regexes"`
+}
+
+// A secretFinding is a possible secret found by the secret scanner.
+type secretFinding struct {
+	line        int
+	description string
+}
+
+// findSecrets returns the possible secrets in content, which will be added to
+// the source state as targetRelPath.
+func (c *Config) findSecrets(targetRelPath chezmoi.RelPath, content []byte) ([]secretFinding, error) {
+	c.secretsScannedContents[sha256.Sum256(content)] = struct{}{}
+
+	for _, pattern := range c.Add.SecretsAllowlist.Paths {
+		name := targetRelPath.String()
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(name)
+		}
+		switch match, err := doublestar.Match(pattern, name); {
+		case err != nil:
+			return nil, fmt.Errorf("add.secretsAllowlist.paths: %s: %w", pattern, err)
+		case match:
+			return nil, nil
+		}
+	}
+	allowlistRxs := make([]*regexp.Regexp, 0, len(c.Add.SecretsAllowlist.Regexes))
+	for _, regex := range c.Add.SecretsAllowlist.Regexes {
+		allowlistRx, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, fmt.Errorf("add.secretsAllowlist.regexes: %w", err)
+		}
+		allowlistRxs = append(allowlistRxs, allowlistRx)
+	}
+	allowed := func(secret string) bool {
+		for _, allowlistRx := range allowlistRxs {
+			if allowlistRx.MatchString(secret) {
+				return true
+			}
+		}
+		return false
+	}
+
+	gitleaksDetector, err := c.getGitleaksDetector()
+	if err != nil {
+		return nil, err
+	}
+	var findings []secretFinding
+	reportedLines := make(map[int]struct{})
+	for _, finding := range gitleaksDetector.DetectBytes(content) {
+		if allowed(finding.Secret) {
+			continue
+		}
+		findings = append(findings, secretFinding{
+			line:        finding.StartLine + 1,
+			description: finding.Description,
+		})
+		reportedLines[finding.StartLine+1] = struct{}{}
+	}
+
+	// Find high-entropy strings on lines that do not already contain a known
+	// secret.
+	for i, line := range bytes.Split(content, []byte{'\n'}) {
+		if _, ok := reportedLines[i+1]; ok || bytes.Contains(line, []byte(secretAllowComment)) {
+			continue
+		}
+		for _, token := range secretTokenRx.FindAll(line, -1) {
+			if shannonEntropy(token) < secretMinEntropy || allowed(string(token)) {
+				continue
+			}
+			findings = append(findings, secretFinding{
+				line:        i + 1,
+				description: "High-entropy string that may be a secret.",
+			})
+			break
+		}
+	}
+
+	return findings, nil
+}
+
+// scanGitStatusForSecrets scans the unencrypted files in the working tree that
+// are changed in status for secrets and returns whether any were found.
+func (c *Config) scanGitStatusForSecrets(status *git.Status) (bool, error) {
+	if c.Add.Secrets == severityIgnore {
+		return false, nil
+	}
+
+	var paths []string
+	for _, ordinary := range status.Ordinary {
+		paths = append(paths, ordinary.Path)
+	}
+	for _, renamedOrCopied := range status.RenamedOrCopied {
+		paths = append(paths, renamedOrCopied.Path)
+	}
+
+	found := false
+	for _, relPath := range paths {
+		absPath := c.WorkingTreeAbsPath.JoinString(relPath)
+		if strings.HasPrefix(path.Base(relPath), "encrypted_") {
+			continue
+		}
+		content, err := c.baseSystem.ReadFile(absPath)
+		if err != nil {
+			// Skip deleted files and directories, for example submodules.
+			continue
+		}
+		if _, ok := c.secretsScannedContents[sha256.Sum256(content)]; ok {
+			continue
+		}
+
+		// Report files in the source directory by their target paths.
+		targetRelPath := chezmoi.NewRelPath(relPath)
+		if sourceRelPath, err := absPath.TrimDirPrefix(c.sourceDirAbsPath); err == nil {
+			targetRelPath = chezmoi.NewSourceRelPath(sourceRelPath.String()).TargetRelPath(c.encryption.EncryptedSuffix())
+		}
+		findings, err := c.findSecrets(targetRelPath, content)
+		if err != nil {
+			return false, err
+		}
+		for _, finding := range findings {
+			c.errorf("%s:%d: %s\n", absPath, finding.line, finding.description)
+			found = true
+		}
+	}
+	return found, nil
+}
+
+// shannonEntropy returns the Shannon entropy of data in bits per byte.
+func shannonEntropy(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
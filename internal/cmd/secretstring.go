@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+)
+
+// onepasswordSecretRefPrefix is the prefix of 1Password secret references.
+const onepasswordSecretRefPrefix = "op://"
+
+// A secretString is a config value that is either a literal string or a
+// reference to a secret. References are only resolved when the value is first
+// used, so the secret itself never needs to be stored in the config file.
+type secretString struct {
+	value    string
+	ref      string
+	command  []string
+	resolved bool
+}
+
+// MarshalJSON implements encoding/json.Marshaler.MarshalJSON. Resolved secrets
+// are never marshaled.
+func (s secretString) MarshalJSON() ([]byte, error) {
+	value, _ := s.MarshalYAML()
+	return json.Marshal(value)
+}
+
+// MarshalYAML implements gopkg.in/yaml.v3.Marshaler. Resolved secrets are never
+// marshaled.
+func (s secretString) MarshalYAML() (any, error) {
+	switch {
+	case s.ref != "":
+		return s.ref, nil
+	case s.command != nil:
+		return map[string]any{
+			"command": s.command,
+		}, nil
+	default:
+		return s.value, nil
+	}
+}
+
+// String implements fmt.Stringer.String. It never returns the value of a
+// secret.
+func (s *secretString) String() string {
+	switch {
+	case s.ref != "":
+		return s.ref
+	case s.command != nil:
+		return shellQuoteCommand(s.command[0], s.command[1:])
+	case s.value != "":
+		return "REDACTED"
+	default:
+		return ""
+	}
+}
+
+// isSet returns if s is set.
+func (s *secretString) isSet() bool {
+	return s.value != "" || s.ref != "" || s.command != nil
+}
+
+// secretStringValue returns the value of s, resolving its secret reference on
+// first use.
+func (c *Config) secretStringValue(s *secretString) (string, error) {
+	if s.resolved || s.ref == "" && s.command == nil {
+		return s.value, nil
+	}
+
+	var value string
+	switch {
+	case s.ref != "":
+		output, err := c.onepasswordOutput(&onepasswordArgs{
+			args: []string{"read", "--no-newline", s.ref},
+		}, withSessionToken)
+		if err != nil {
+			return "", err
+		}
+		value = string(output)
+	default:
+		cmd := exec.Command(s.command[0], s.command[1:]...) //nolint:gosec
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		output, err := chezmoilog.LogCmdOutputRedacted(cmd)
+		if err != nil {
+			return "", newCmdOutputError(cmd, output, err)
+		}
+		value = strings.TrimSpace(string(output))
+	}
+
+	s.value = value
+	s.resolved = true
+	return s.value, nil
+}
+
+// StringOrMapToSecretStringHookFunc is a
+// github.com/mitchellh/mapstructure.DecodeHookFunc that parses a secretString
+// from a string or a map with a command key.
+func StringOrMapToSecretStringHookFunc() mapstructure.DecodeHookFunc {
+	return func(from, to reflect.Type, data any) (any, error) {
+		if to != reflect.TypeOf(secretString{}) {
+			return data, nil
+		}
+		var s secretString
+		switch data := data.(type) {
+		case string:
+			if strings.HasPrefix(data, onepasswordSecretRefPrefix) {
+				s.ref = data
+			} else {
+				s.value = data
+			}
+		case map[string]any:
+			for key, value := range data {
+				if key != "command" {
+					return nil, fmt.Errorf("%s: unknown key", key)
+				}
+				command, err := secretStringCommand(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+				s.command = command
+			}
+			if s.command == nil {
+				return nil, errors.New("command: missing")
+			}
+		default:
+			return nil, fmt.Errorf("expected a string or map, got a %T", data)
+		}
+		return s, nil
+	}
+}
+
+// secretStringCommand returns the command in value.
+func secretStringCommand(value any) ([]string, error) {
+	var command []string
+	switch value := value.(type) {
+	case []string:
+		command = value
+	case []any:
+		command = make([]string, 0, len(value))
+		for _, element := range value {
+			s, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string, got a %T", element)
+			}
+			command = append(command, s)
+		}
+	default:
+		return nil, fmt.Errorf("expected a list, got a %T", value)
+	}
+	if len(command) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return command, nil
+}
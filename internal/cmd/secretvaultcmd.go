@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type secretVaultCmdConfig struct {
+	put secretVaultPutCmdConfig
+}
+
+type secretVaultPutCmdConfig struct {
+	path  string
+	key   string
+	value string
+}
+
+func (c *Config) newSecretVaultCmd() *cobra.Command {
+	vaultCmd := &cobra.Command{
+		Use:   "vault",
+		Args:  cobra.NoArgs,
+		Short: "Interact with Vault",
+	}
+
+	vaultPutCmd := &cobra.Command{
+		Use:   "put",
+		Args:  cobra.NoArgs,
+		Short: "Set a value in Vault",
+		RunE:  c.runSecretVaultPutCmdE,
+	}
+	secretVaultPutPersistentFlags := vaultPutCmd.PersistentFlags()
+	secretVaultPutPersistentFlags.StringVar(&c.secret.vault.put.path, "path", "", "path")
+	secretVaultPutPersistentFlags.StringVar(&c.secret.vault.put.key, "key", "", "key")
+	secretVaultPutPersistentFlags.StringVar(&c.secret.vault.put.value, "value", "", "value")
+	markPersistentFlagsRequired(vaultPutCmd, "path", "key")
+	vaultCmd.AddCommand(vaultPutCmd)
+
+	return vaultCmd
+}
+
+func (c *Config) runSecretVaultPutCmdE(cmd *cobra.Command, args []string) error {
+	value := c.secret.vault.put.value
+	if value == "" {
+		var err error
+		value, err = c.readPassword("Value: ")
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.vaultWrite(c.secret.vault.put.path, c.secret.vault.put.key, value)
+	return err
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// defaultSharedStateLockTTL is how long a lock on the shared state is held
+// before it is considered stale and can be taken over by another machine.
+const defaultSharedStateLockTTL = time.Hour
+
+// A sharedStateConfig configures the persistent state shared between
+// machines, used by run_once_ scripts with the chezmoi:script:scope=user
+// directive.
+type sharedStateConfig struct {
+	URL     string            `json:"url"     mapstructure:"url"     yaml:"url"`
+	Headers map[string]string `json:"headers" mapstructure:"headers" yaml:"headers"`
+	LockTTL time.Duration     `json:"lockTTL" mapstructure:"lockTTL" yaml:"lockTTL"`
+}
+
+// newSharedPersistentState returns a new chezmoi.SharedPersistentState
+// configured by c, or nil if no shared state is configured.
+func (c *sharedStateConfig) newSharedPersistentState(httpClient *http.Client) (chezmoi.SharedPersistentState, error) {
+	if c.URL == "" {
+		return nil, nil
+	}
+	sharedStateURL, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("sharedState.url: %w", err)
+	}
+	switch sharedStateURL.Scheme {
+	case "http", "https":
+		header := make(http.Header, len(c.Headers))
+		for key, value := range c.Headers {
+			header.Set(key, value)
+		}
+		return chezmoi.NewHTTPPersistentState(httpClient, sharedStateURL, header, c.LockTTL), nil
+	default:
+		return nil, fmt.Errorf("sharedState.url: %s: unsupported scheme", sharedStateURL.Scheme)
+	}
+}
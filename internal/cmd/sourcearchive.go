@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
+	"github.com/twpayne/chezmoi/v2/internal/git"
+)
+
+// sourceArchiveMarkerName is the name of the file in the working tree that
+// records the archive that the source state was extracted from.
+const sourceArchiveMarkerName = ".source-archive"
+
+var errSourceArchiveReadOnly = errors.New("archive sources cannot be committed or pushed")
+
+type sourceArchiveConfig struct {
+	Checksum        bool `json:"checksum"        mapstructure:"checksum"        yaml:"checksum"`
+	Signature       bool `json:"signature"       mapstructure:"signature"       yaml:"signature"`
+	StripComponents int  `json:"stripComponents" mapstructure:"stripComponents" yaml:"stripComponents"`
+}
+
+// A sourceArchiveMarker records the archive that the source state was
+// extracted from.
+type sourceArchiveMarker struct {
+	URL    string           `json:"url"`
+	SHA256 chezmoi.HexBytes `json:"sha256"`
+}
+
+// An archiveVCS is a read-only version control system that downloads the
+// source state as an archive.
+type archiveVCS struct{}
+
+func (archiveVCS) autoAdd(c *Config) (*git.Status, error) {
+	return nil, errSourceArchiveReadOnly
+}
+
+func (archiveVCS) clone(c *Config, repoURLStr string, workingTreeRawPath chezmoi.AbsPath) error {
+	return c.fetchSourceArchive(repoURLStr, nil)
+}
+
+func (archiveVCS) commit(c *Config, message []byte) error {
+	return errSourceArchiveReadOnly
+}
+
+func (archiveVCS) dirName() string {
+	return sourceArchiveMarkerName
+}
+
+func (archiveVCS) init(c *Config, workingTreeRawPath chezmoi.AbsPath) error {
+	return errors.New("archive sources require a URL")
+}
+
+func (archiveVCS) pull(c *Config) error {
+	data, err := c.baseSystem.ReadFile(c.WorkingTreeAbsPath.JoinString(sourceArchiveMarkerName))
+	if err != nil {
+		return err
+	}
+	var marker sourceArchiveMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return fmt.Errorf("%s: %w", sourceArchiveMarkerName, err)
+	}
+	return c.fetchSourceArchive(marker.URL, marker.SHA256)
+}
+
+func (archiveVCS) push(c *Config) error {
+	return errSourceArchiveReadOnly
+}
+
+// isSourceArchiveURL returns if repoURLStr looks like the URL of an archive.
+func isSourceArchiveURL(repoURLStr string) bool {
+	repoURL, err := url.Parse(repoURLStr)
+	if err != nil || repoURL.Scheme != "http" && repoURL.Scheme != "https" {
+		return false
+	}
+	return chezmoi.GuessArchiveFormat(repoURL.Path, nil) != chezmoi.ArchiveFormatUnknown
+}
+
+// fetchSourceArchive downloads and verifies the archive at archiveURLStr and
+// replaces the contents of the working tree with it. If the archive's SHA256
+// sum is equal to currentSHA256 then the working tree is left unchanged.
+func (c *Config) fetchSourceArchive(archiveURLStr string, currentSHA256 []byte) error {
+	archiveURL, err := url.Parse(archiveURLStr)
+	if err != nil {
+		return err
+	}
+
+	data, err := c.downloadSourceArchiveFile(archiveURLStr)
+	if err != nil {
+		return err
+	}
+	sha256 := chezmoi.SHA256Sum(data)
+
+	if c.SourceArchive.Checksum {
+		checksumData, err := c.downloadSourceArchiveFile(archiveURLStr + ".sha256")
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(string(checksumData))
+		if len(fields) == 0 {
+			return fmt.Errorf("%s.sha256: missing checksum", archiveURLStr)
+		}
+		expectedSHA256, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return fmt.Errorf("%s.sha256: %w", archiveURLStr, err)
+		}
+		if !bytes.Equal(sha256, expectedSHA256) {
+			return fmt.Errorf("%s: checksum mismatch, expected %x, got %x", archiveURLStr, expectedSHA256, sha256)
+		}
+	}
+
+	if c.SourceArchive.Signature {
+		if err := c.verifySourceArchiveSignature(archiveURLStr, data); err != nil {
+			return err
+		}
+	}
+
+	if bytes.Equal(sha256, currentSHA256) {
+		return nil
+	}
+
+	archiveReaderSystem, err := chezmoi.NewArchiveReaderSystem(
+		archiveURL.Path, data, chezmoi.ArchiveFormatUnknown, chezmoi.ArchiveReaderSystemOptions{
+			RootAbsPath:     c.WorkingTreeAbsPath,
+			StripComponents: c.SourceArchive.StripComponents,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Remove the previous source state.
+	dirEntries, err := c.baseSystem.ReadDir(c.WorkingTreeAbsPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, dirEntry := range dirEntries {
+		if err := c.baseSystem.RemoveAll(c.WorkingTreeAbsPath.JoinString(dirEntry.Name())); err != nil {
+			return err
+		}
+	}
+
+	if err := c.extractArchiveReaderSystem(archiveURLStr, archiveReaderSystem, c.WorkingTreeAbsPath); err != nil {
+		return err
+	}
+
+	markerData, err := json.MarshalIndent(&sourceArchiveMarker{
+		URL:    archiveURLStr,
+		SHA256: sha256,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	markerData = append(markerData, '\n')
+	return c.baseSystem.WriteFile(c.WorkingTreeAbsPath.JoinString(sourceArchiveMarkerName), markerData, 0o666)
+}
+
+// extractArchiveReaderSystem writes the contents of archiveReaderSystem, read
+// from archiveURLStr, to dirAbsPath.
+func (c *Config) extractArchiveReaderSystem(
+	archiveURLStr string, archiveReaderSystem *chezmoi.ArchiveReaderSystem, dirAbsPath chezmoi.AbsPath,
+) error {
+	fileInfos := archiveReaderSystem.FileInfos()
+	absPaths := make([]chezmoi.AbsPath, 0, len(fileInfos))
+	for absPath := range fileInfos {
+		if _, err := absPath.TrimDirPrefix(dirAbsPath); err != nil {
+			return fmt.Errorf("%s: %s: outside %s", archiveURLStr, absPath, dirAbsPath)
+		}
+		absPaths = append(absPaths, absPath)
+	}
+	sort.Slice(absPaths, func(i, j int) bool {
+		return absPaths[i].Less(absPaths[j])
+	})
+	for _, absPath := range absPaths {
+		if err := chezmoi.MkdirAll(c.baseSystem, absPath.Dir(), fs.ModePerm); err != nil {
+			return err
+		}
+		switch fileInfo := fileInfos[absPath]; fileInfo.Mode().Type() {
+		case fs.ModeDir:
+			if err := chezmoi.MkdirAll(c.baseSystem, absPath, fs.ModePerm); err != nil {
+				return err
+			}
+		case 0:
+			contents, err := archiveReaderSystem.ReadFile(absPath)
+			if err != nil {
+				return err
+			}
+			if err := c.baseSystem.WriteFile(absPath, contents, fileInfo.Mode().Perm()); err != nil {
+				return err
+			}
+		case fs.ModeSymlink:
+			linkname, err := archiveReaderSystem.Readlink(absPath)
+			if err != nil {
+				return err
+			}
+			if err := c.baseSystem.WriteSymlink(linkname, absPath); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: %s: unsupported file type", archiveURLStr, absPath)
+		}
+	}
+	return nil
+}
+
+// downloadSourceArchiveFile downloads the file at urlStr.
+func (c *Config) downloadSourceArchiveFile(urlStr string) ([]byte, error) {
+	httpClient, err := c.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, urlStr, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	// Always fetch the latest archive, even if a cached copy is still fresh.
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := chezmoilog.LogHTTPRequest(c.logger, httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.readHTTPResponse(resp)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || http.StatusMultipleChoices <= resp.StatusCode {
+		return nil, fmt.Errorf("%s: %s", urlStr, resp.Status)
+	}
+	return data, nil
+}
+
+// verifySourceArchiveSignature verifies the detached signature of data,
+// downloaded from archiveURLStr + ".sig", with gpg.
+func (c *Config) verifySourceArchiveSignature(archiveURLStr string, data []byte) error {
+	signature, err := c.downloadSourceArchiveFile(archiveURLStr + ".sig")
+	if err != nil {
+		return err
+	}
+	tempDirAbsPath, err := c.tempDir("chezmoi-source-archive")
+	if err != nil {
+		return err
+	}
+	archiveAbsPath := tempDirAbsPath.JoinString("archive")
+	if err := c.baseSystem.WriteFile(archiveAbsPath, data, 0o600); err != nil {
+		return err
+	}
+	signatureAbsPath := tempDirAbsPath.JoinString("archive.sig")
+	if err := c.baseSystem.WriteFile(signatureAbsPath, signature, 0o600); err != nil {
+		return err
+	}
+	args := append(append([]string(nil), c.GPG.Args...), "--verify", signatureAbsPath.String(), archiveAbsPath.String())
+	cmd := exec.Command(c.GPG.Command, args...)
+	cmd.Stderr = c.stderr
+	if err := chezmoilog.LogCmdRun(cmd); err != nil {
+		return fmt.Errorf("%s: signature verification failed: %w", archiveURLStr, err)
+	}
+	return nil
+}
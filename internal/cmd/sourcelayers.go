@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// A sourceLayerConfig is the configuration of a source layer. Source layers
+// are additional source directories that are read before the source
+// directory, so that, for example, a shared base repo can be combined with a
+// personal repo. Entries in later layers replace entries for the same target
+// in earlier layers, and entries in the source directory replace entries in
+// all layers.
+type sourceLayerConfig struct {
+	SourceDirAbsPath chezmoi.AbsPath `json:"sourceDir" mapstructure:"sourceDir" yaml:"sourceDir"`
+	URL              string          `json:"url"       mapstructure:"url"       yaml:"url"`
+}
+
+// validateSourceLayers returns an error if sourceLayers are not valid.
+func validateSourceLayers(sourceLayers []sourceLayerConfig) error {
+	for i, sourceLayer := range sourceLayers {
+		if sourceLayer.SourceDirAbsPath.Empty() {
+			return fmt.Errorf("sourceLayers[%d]: missing sourceDir", i)
+		}
+	}
+	return nil
+}
+
+// sourceLayerDirAbsPaths returns the source directories of all source layers,
+// in order of increasing precedence.
+func (c *Config) sourceLayerDirAbsPaths() []chezmoi.AbsPath {
+	sourceLayerDirAbsPaths := make([]chezmoi.AbsPath, 0, len(c.SourceLayers))
+	for _, sourceLayer := range c.SourceLayers {
+		sourceLayerDirAbsPaths = append(sourceLayerDirAbsPaths, sourceLayer.SourceDirAbsPath)
+	}
+	return sourceLayerDirAbsPaths
+}
+
+// updateSourceLayers updates all source layers that are git working trees.
+// Source layers that do not exist yet are cloned from their URL, if set.
+func (c *Config) updateSourceLayers() error {
+	for _, sourceLayer := range c.SourceLayers {
+		dirAbsPath := sourceLayer.SourceDirAbsPath
+		switch _, err := c.baseSystem.Stat(dirAbsPath.JoinString(git.GitDirName)); {
+		case err == nil:
+			if err := c.run(dirAbsPath, c.Git.Command, []string{"pull", "--autostash", "--rebase"}); err != nil {
+				return err
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		case sourceLayer.URL == "":
+			// Not a git working tree and no URL to clone from, so there is
+			// nothing to update.
+		default:
+			switch _, err := c.baseSystem.Stat(dirAbsPath); {
+			case err == nil:
+				return fmt.Errorf("%s: not a git working tree", dirAbsPath)
+			case !errors.Is(err, fs.ErrNotExist):
+				return err
+			}
+			cloneArgs := []string{"clone", sourceLayer.URL, dirAbsPath.String()}
+			if err := c.run(chezmoi.EmptyAbsPath, c.Git.Command, cloneArgs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 package cmd
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/spf13/cobra"
 )
 
+type sourcePathCmdConfig struct {
+	all  bool
+	json bool
+}
+
 func (c *Config) newSourcePathCmd() *cobra.Command {
 	sourcePathCmd := &cobra.Command{
 		Use:               "source-path [target]...",
@@ -18,11 +20,19 @@ func (c *Config) newSourcePathCmd() *cobra.Command {
 		Annotations:       newAnnotations(),
 	}
 
+	flags := sourcePathCmd.Flags()
+	flags.BoolVarP(&c.sourcePathCmd.all, "all", "a", c.sourcePathCmd.all, "Print the source paths of all managed targets")
+	flags.BoolVar(&c.sourcePathCmd.json, "json", c.sourcePathCmd.json, "Print source and target paths as JSON")
+
 	return sourcePathCmd
 }
 
 func (c *Config) runSourcePathCmd(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
+	if c.sourcePathCmd.all && len(args) != 0 {
+		return errAllWithPaths
+	}
+
+	if len(args) == 0 && !c.sourcePathCmd.all && !c.sourcePathCmd.json {
 		sourceDirAbsPath, err := c.getSourceDirAbsPath(nil)
 		if err != nil {
 			return err
@@ -35,14 +45,24 @@ func (c *Config) runSourcePathCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	sourceAbsPaths, err := c.sourceAbsPaths(sourceState, args)
+	if c.sourcePathCmd.all {
+		return c.writePathMappings(c.allPathMappings(sourceState), c.sourcePathCmd.json, pathMappingSource)
+	}
+
+	targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+		mustBeInSourceState: true,
+		mustBeManaged:       true,
+	})
 	if err != nil {
 		return err
 	}
-
-	builder := strings.Builder{}
-	for _, sourceAbsPath := range sourceAbsPaths {
-		fmt.Fprintln(&builder, sourceAbsPath)
+	pathMappings := make([]pathMapping, 0, len(targetRelPaths))
+	for _, targetRelPath := range targetRelPaths {
+		sourceRelPath := sourceState.MustEntry(targetRelPath).SourceRelPath()
+		pathMappings = append(pathMappings, pathMapping{
+			Source: c.SourceDirAbsPath.Join(sourceRelPath.RelPath()).String(),
+			Target: c.DestDirAbsPath.Join(targetRelPath).String(),
+		})
 	}
-	return c.writeOutputString(builder.String())
+	return c.writePathMappings(pathMappings, c.sourcePathCmd.json, pathMappingSource)
 }
@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+// SSH key types.
+const (
+	sshKeyTypeECDSA   = "ecdsa"
+	sshKeyTypeED25519 = "ed25519"
+	sshKeyTypeRSA     = "rsa"
+)
+
+// Forges that SSH keys can be uploaded to.
+const (
+	sshKeyUploadGitHub = "github"
+	sshKeyUploadGitLab = "gitlab"
+)
+
+// An sshKeyConfig configures a managed SSH key.
+type sshKeyConfig struct {
+	Type    string          `json:"type"    mapstructure:"type"    yaml:"type"`
+	Bits    int             `json:"bits"    mapstructure:"bits"    yaml:"bits"`
+	Comment string          `json:"comment" mapstructure:"comment" yaml:"comment"`
+	Path    chezmoi.AbsPath `json:"path"    mapstructure:"path"    yaml:"path"`
+	Title   string          `json:"title"   mapstructure:"title"   yaml:"title"`
+	Upload  []string        `json:"upload"  mapstructure:"upload"  yaml:"upload"`
+}
+
+func (c *Config) newSSHKeyCmd() *cobra.Command {
+	sshKeyCmd := &cobra.Command{
+		Use:     "ssh-key",
+		Short:   "Manage SSH keys",
+		Long:    mustLongHelp("ssh-key"),
+		Example: example("ssh-key"),
+	}
+
+	sshKeyGenerateCmd := &cobra.Command{
+		Use:   "generate [name...]",
+		Short: "Generate SSH keys",
+		RunE:  c.runSSHKeyGenerateCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeEmpty,
+		),
+	}
+	sshKeyCmd.AddCommand(sshKeyGenerateCmd)
+
+	sshKeyListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List SSH keys",
+		Args:  cobra.NoArgs,
+		RunE:  c.runSSHKeyListCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	sshKeyCmd.AddCommand(sshKeyListCmd)
+
+	sshKeyUploadCmd := &cobra.Command{
+		Use:   "upload [name...]",
+		Short: "Upload public SSH keys",
+		RunE:  c.runSSHKeyUploadCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	sshKeyCmd.AddCommand(sshKeyUploadCmd)
+
+	return sshKeyCmd
+}
+
+func (c *Config) runSSHKeyGenerateCmd(cmd *cobra.Command, args []string) error {
+	names, err := c.sshKeyNames(args)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		generated, err := c.generateSSHKey(name, c.force)
+		if err != nil {
+			return err
+		}
+		if generated && c.Verbose {
+			c.errorf("generated SSH key %s\n", name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) runSSHKeyListCmd(cmd *cobra.Command, args []string) error {
+	var builder strings.Builder
+	for _, name := range c.sortedSSHKeyNames() {
+		sshKey := c.SSHKeys[name]
+		publicKey, err := c.readSSHPublicKey(name)
+		if err != nil {
+			return err
+		}
+		status := "absent"
+		if publicKey != "" {
+			if parsedPublicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey)); err == nil {
+				status = ssh.FingerprintSHA256(parsedPublicKey)
+			} else {
+				status = "invalid"
+			}
+		}
+		fmt.Fprintf(&builder, "%s %s %s %s\n", name, c.sshKeyType(sshKey), c.sshKeyPath(name), status)
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runSSHKeyUploadCmd(cmd *cobra.Command, args []string) error {
+	names, err := c.sshKeyNames(args)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := c.uploadSSHKey(cmd.Context(), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateSSHKey generates the SSH key name if it does not already exist or if
+// force is true. It returns whether the key was generated.
+func (c *Config) generateSSHKey(name string, force bool) (bool, error) {
+	sshKey := c.SSHKeys[name]
+	privateKeyAbsPath := c.sshKeyPath(name)
+	if !force {
+		switch _, err := c.destSystem.Lstat(privateKeyAbsPath); {
+		case err == nil:
+			return false, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return false, err
+		}
+	}
+
+	var privateKey crypto.Signer
+	switch keyType := c.sshKeyType(sshKey); keyType {
+	case sshKeyTypeECDSA:
+		var curve elliptic.Curve
+		switch sshKey.Bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return false, fmt.Errorf("sshKeys.%s.bits: %d: invalid ecdsa key size", name, sshKey.Bits)
+		}
+		ecdsaKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return false, err
+		}
+		privateKey = ecdsaKey
+	case sshKeyTypeED25519:
+		_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return false, err
+		}
+		privateKey = ed25519Key
+	case sshKeyTypeRSA:
+		bits := sshKey.Bits
+		if bits == 0 {
+			bits = 4096
+		} else if bits < 2048 {
+			return false, fmt.Errorf("sshKeys.%s.bits: %d: rsa keys must be at least 2048 bits", name, bits)
+		}
+		rsaKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return false, err
+		}
+		privateKey = rsaKey
+	default:
+		return false, fmt.Errorf("sshKeys.%s.type: %s: unknown SSH key type", name, keyType)
+	}
+
+	comment := c.sshKeyComment(sshKey)
+	privateKeyPEM, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return false, err
+	}
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		return false, err
+	}
+	authorizedKey := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(publicKey)), "\n")
+	if comment != "" {
+		authorizedKey += " " + comment
+	}
+
+	if err := chezmoi.MkdirAll(c.destSystem, privateKeyAbsPath.Dir(), 0o700); err != nil {
+		return false, err
+	}
+	if err := c.destSystem.WriteFile(privateKeyAbsPath, pem.EncodeToMemory(privateKeyPEM), 0o600); err != nil {
+		return false, err
+	}
+	if err := c.destSystem.WriteFile(privateKeyAbsPath.Append(".pub"), []byte(authorizedKey+"\n"), 0o644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// provisionSSHKeys generates all configured SSH keys that do not already exist
+// and uploads the newly-generated keys.
+func (c *Config) provisionSSHKeys(ctx context.Context) error {
+	for _, name := range c.sortedSSHKeyNames() {
+		generated, err := c.generateSSHKey(name, false)
+		if err != nil {
+			return err
+		}
+		if generated && !c.dryRun {
+			if err := c.uploadSSHKey(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readSSHPublicKey returns the public key of the SSH key name in authorized
+// keys format, or the empty string if the key has not been generated.
+func (c *Config) readSSHPublicKey(name string) (string, error) {
+	data, err := c.destSystem.ReadFile(c.sshKeyPath(name).Append(".pub"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", nil
+	case err != nil:
+		return "", err
+	default:
+		return strings.TrimSpace(string(data)), nil
+	}
+}
+
+// sshKeyComment returns the comment of sshKey.
+func (c *Config) sshKeyComment(sshKey *sshKeyConfig) string {
+	if sshKey.Comment != "" {
+		return sshKey.Comment
+	}
+	templateData := c.getTemplateData(nil)
+	return templateData.username + "@" + templateData.hostname
+}
+
+// sshKeyNames returns the names of the SSH keys in args, or all SSH keys if
+// args is empty.
+func (c *Config) sshKeyNames(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return c.sortedSSHKeyNames(), nil
+	}
+	for _, arg := range args {
+		if _, ok := c.SSHKeys[arg]; !ok {
+			return nil, fmt.Errorf("%s: SSH key not configured", arg)
+		}
+	}
+	return args, nil
+}
+
+// sshKeyPath returns the path of the private key of the SSH key name.
+func (c *Config) sshKeyPath(name string) chezmoi.AbsPath {
+	if sshKey := c.SSHKeys[name]; !sshKey.Path.Empty() {
+		return sshKey.Path
+	}
+	return c.DestDirAbsPath.JoinString(".ssh", name)
+}
+
+// sshKeyType returns the type of sshKey.
+func (c *Config) sshKeyType(sshKey *sshKeyConfig) string {
+	if sshKey.Type == "" {
+		return sshKeyTypeED25519
+	}
+	return strings.ToLower(sshKey.Type)
+}
+
+// sortedSSHKeyNames returns the names of the configured SSH keys in order.
+func (c *Config) sortedSSHKeyNames() []string {
+	names := maps.Keys(c.SSHKeys)
+	slices.Sort(names)
+	return names
+}
+
+// uploadSSHKey uploads the public key of the SSH key name to the forges
+// configured for it, unless it is already present.
+func (c *Config) uploadSSHKey(ctx context.Context, name string) error {
+	sshKey := c.SSHKeys[name]
+	if len(sshKey.Upload) == 0 {
+		return nil
+	}
+	authorizedKey, err := c.readSSHPublicKey(name)
+	if err != nil {
+		return err
+	}
+	if authorizedKey == "" {
+		return fmt.Errorf("%s: SSH key not generated", name)
+	}
+	// Forges return public keys without their comments, so compare only the
+	// key type and key.
+	keyFields := strings.Fields(authorizedKey)
+	if len(keyFields) < 2 {
+		return fmt.Errorf("%s: invalid public key", c.sshKeyPath(name).Append(".pub"))
+	}
+	key := keyFields[0] + " " + keyFields[1]
+	title := sshKey.Title
+	if title == "" {
+		title = c.sshKeyComment(sshKey)
+	}
+
+	for _, forge := range sshKey.Upload {
+		switch forge {
+		case sshKeyUploadGitHub:
+			client, err := c.getGitHubClient(ctx)
+			if err != nil {
+				return err
+			}
+			existingKeys, _, err := gitHubCall(ctx, c, func() ([]*github.Key, *github.Response, error) {
+				return client.Users.ListKeys(ctx, "", &github.ListOptions{PerPage: 100})
+			})
+			if err != nil {
+				return fmt.Errorf("%s: github: %w", name, err)
+			}
+			if slices.ContainsFunc(existingKeys, func(existingKey *github.Key) bool {
+				return sshKeyEqual(existingKey.GetKey(), key)
+			}) {
+				continue
+			}
+			if _, _, err := gitHubCall(ctx, c, func() (*github.Key, *github.Response, error) {
+				return client.Users.CreateKey(ctx, &github.Key{
+					Title: github.String(title),
+					Key:   github.String(key),
+				})
+			}); err != nil {
+				return fmt.Errorf("%s: github: %w", name, err)
+			}
+		case sshKeyUploadGitLab:
+			var existingKeys []*gitLabKey
+			if err := c.forgeAPIRequest(c.gitLabAPI(), http.MethodGet, "/user/keys", nil, &existingKeys); err != nil {
+				return fmt.Errorf("%s: gitlab: %w", name, err)
+			}
+			if slices.ContainsFunc(existingKeys, func(existingKey *gitLabKey) bool {
+				return sshKeyEqual(existingKey.Key, key)
+			}) {
+				continue
+			}
+			if err := c.forgeAPIRequest(c.gitLabAPI(), http.MethodPost, "/user/keys", map[string]string{
+				"title": title,
+				"key":   key,
+			}, nil); err != nil {
+				return fmt.Errorf("%s: gitlab: %w", name, err)
+			}
+		default:
+			return fmt.Errorf("sshKeys.%s.upload: %s: unknown forge", name, forge)
+		}
+		if c.Verbose {
+			c.errorf("uploaded SSH key %s to %s\n", name, forge)
+		}
+	}
+	return nil
+}
+
+// sshPublicKeyTemplateFunc returns the public key of the SSH key name in
+// authorized keys format, or the empty string if it has not been generated.
+func (c *Config) sshPublicKeyTemplateFunc(name string) string {
+	if _, ok := c.SSHKeys[name]; !ok {
+		panic(fmt.Errorf("%s: SSH key not configured", name))
+	}
+	publicKey, err := c.readSSHPublicKey(name)
+	if err != nil {
+		panic(err)
+	}
+	return publicKey
+}
+
+// sshKeyEqual returns whether the authorized keys a and b have the same type
+// and key, ignoring any comments.
+func sshKeyEqual(a, b string) bool {
+	aFields := strings.Fields(a)
+	bFields := strings.Fields(b)
+	return len(aFields) >= 2 && len(bFields) >= 2 && aFields[0] == bFields[0] && aFields[1] == bFields[1]
+}
@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
@@ -15,12 +22,16 @@ type stateCmdConfig struct {
 	deleteBucket stateDeleteBucketCmdConfig
 	get          stateGetCmdConfig
 	getBucket    stateGetBucketCmdConfig
+	importCmd    stateImportCmdConfig
+	list         stateListCmdConfig
+	orphans      stateOrphansCmdConfig
 	set          stateSetCmdConfig
 }
 
 type stateDeleteCmdConfig struct {
-	bucket string
-	key    string
+	bucket  string
+	key     string
+	pattern string
 }
 
 type stateDeleteBucketCmdConfig struct {
@@ -36,6 +47,19 @@ type stateGetBucketCmdConfig struct {
 	bucket string
 }
 
+type stateImportCmdConfig struct {
+	replace bool
+}
+
+type stateListCmdConfig struct {
+	bucket string
+	values bool
+}
+
+type stateOrphansCmdConfig struct {
+	delete bool
+}
+
 type stateSetCmdConfig struct {
 	bucket string
 	key    string
@@ -50,6 +74,17 @@ func (c *Config) newStateCmd() *cobra.Command {
 		Example: example("state"),
 	}
 
+	stateCompactCmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Compact the persistent state",
+		Args:  cobra.NoArgs,
+		RunE:  c.runStateCompactCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+		),
+	}
+	stateCmd.AddCommand(stateCompactCmd)
+
 	stateDataCmd := &cobra.Command{
 		Use:   "data",
 		Short: "Print the raw data in the persistent state",
@@ -78,6 +113,7 @@ func (c *Config) newStateCmd() *cobra.Command {
 	stateDeletePersistentFlags := stateDeleteCmd.PersistentFlags()
 	stateDeletePersistentFlags.StringVar(&c.state.delete.bucket, "bucket", c.state.delete.bucket, "Bucket")
 	stateDeletePersistentFlags.StringVar(&c.state.delete.key, "key", c.state.delete.key, "Key")
+	stateDeletePersistentFlags.StringVar(&c.state.delete.pattern, "pattern", c.state.delete.pattern, "Key pattern")
 	stateCmd.AddCommand(stateDeleteCmd)
 
 	stateDeleteBucketCmd := &cobra.Command{
@@ -109,6 +145,17 @@ func (c *Config) newStateCmd() *cobra.Command {
 	}
 	stateCmd.AddCommand(stateDumpCmd)
 
+	stateExportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the persistent state as JSON",
+		Args:  cobra.NoArgs,
+		RunE:  c.runStateExportCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	stateCmd.AddCommand(stateExportCmd)
+
 	stateGetCmd := &cobra.Command{
 		Use:   "get",
 		Short: "Get a value from the persistent state",
@@ -140,6 +187,51 @@ func (c *Config) newStateCmd() *cobra.Command {
 	}
 	stateCmd.AddCommand(stateGetBucketCmd)
 
+	stateImportCmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import the persistent state from JSON",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  c.runStateImportCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+		),
+	}
+	stateImportPersistentFlags := stateImportCmd.PersistentFlags()
+	stateImportPersistentFlags.BoolVar(&c.state.importCmd.replace, "replace", c.state.importCmd.replace, "Replace imported buckets")
+	stateCmd.AddCommand(stateImportCmd)
+
+	stateListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the buckets or keys in the persistent state",
+		Args:  cobra.NoArgs,
+		RunE:  c.runStateListCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	stateListPersistentFlags := stateListCmd.PersistentFlags()
+	stateListPersistentFlags.StringVar(&c.state.list.bucket, "bucket", c.state.list.bucket, "Bucket")
+	stateListPersistentFlags.BoolVar(&c.state.list.values, "values", c.state.list.values, "Print decoded values")
+	stateListPersistentFlags.VarP(&c.Format, "format", "f", "Output format")
+	if err := stateListCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
+	stateCmd.AddCommand(stateListCmd)
+
+	stateOrphansCmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "List entry states of targets that are no longer managed",
+		Args:  cobra.NoArgs,
+		RunE:  c.runStateOrphansCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+	stateOrphansPersistentFlags := stateOrphansCmd.PersistentFlags()
+	stateOrphansPersistentFlags.BoolVar(&c.state.orphans.delete, "delete", c.state.orphans.delete, "Delete orphaned entry states")
+	stateCmd.AddCommand(stateOrphansCmd)
+
 	stateResetCmd := &cobra.Command{
 		Use:   "reset",
 		Short: "Reset the persistent state",
@@ -166,9 +258,61 @@ func (c *Config) newStateCmd() *cobra.Command {
 	stateSetPersistentFlags.StringVar(&c.state.set.value, "value", c.state.set.value, "Value")
 	stateCmd.AddCommand(stateSetCmd)
 
+	for _, cmd := range stateCmd.Commands() {
+		if cmd.PersistentFlags().Lookup("bucket") != nil {
+			if err := cmd.RegisterFlagCompletionFunc("bucket", c.stateBucketFlagCompletionFunc); err != nil {
+				panic(err)
+			}
+		}
+		if cmd.PersistentFlags().Lookup("key") != nil {
+			if err := cmd.RegisterFlagCompletionFunc("key", c.stateKeyFlagCompletionFunc); err != nil {
+				panic(err)
+			}
+		}
+	}
+
 	return stateCmd
 }
 
+// stateBucketFlagCompletionFunc completes the --bucket flag with the names of
+// the buckets in the persistent state.
+func (c *Config) stateBucketFlagCompletionFunc(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	return c.makeValidArgsFunc(c.stateBucketCompletions)(cmd, args, toComplete)
+}
+
+// stateKeyFlagCompletionFunc completes the --key flag with the keys in the
+// bucket given by the --bucket flag.
+func (c *Config) stateKeyFlagCompletionFunc(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	return c.makeValidArgsFunc(func(cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+		bucket, err := cmd.Flags().GetString("bucket")
+		if err != nil {
+			return nil, err
+		}
+		return c.stateKeyCompletions(bucket, toComplete)
+	})(cmd, args, toComplete)
+}
+
+func (c *Config) runStateCompactCmd(cmd *cobra.Command, args []string) error {
+	persistentStateFileAbsPath, err := c.persistentStateFile()
+	if err != nil {
+		return err
+	}
+	switch _, err := c.baseSystem.Stat(persistentStateFileAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	if c.dryRun {
+		return nil
+	}
+	return chezmoi.CompactBoltPersistentState(c.baseSystem, persistentStateFileAbsPath)
+}
+
 func (c *Config) runStateDataCmd(cmd *cobra.Command, args []string) error {
 	data, err := c.persistentState.Data()
 	if err != nil {
@@ -178,7 +322,37 @@ func (c *Config) runStateDataCmd(cmd *cobra.Command, args []string) error {
 }
 
 func (c *Config) runStateDeleteCmd(cmd *cobra.Command, args []string) error {
-	return c.persistentState.Delete([]byte(c.state.delete.bucket), []byte(c.state.delete.key))
+	if c.state.delete.pattern == "" {
+		return c.persistentState.Delete([]byte(c.state.delete.bucket), []byte(c.state.delete.key))
+	}
+
+	if c.state.delete.key != "" {
+		return errors.New("the --key and --pattern flags are mutually exclusive")
+	}
+	if !doublestar.ValidatePattern(c.state.delete.pattern) {
+		return fmt.Errorf("%s: invalid pattern", c.state.delete.pattern)
+	}
+	bucket := []byte(c.state.delete.bucket)
+	var keys []string
+	if err := c.persistentState.ForEach(bucket, func(k, v []byte) error {
+		if ok, _ := doublestar.Match(c.state.delete.pattern, string(k)); ok {
+			keys = append(keys, string(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if c.Verbose {
+			if err := c.writeOutputString(key + "\n"); err != nil {
+				return err
+			}
+		}
+		if err := c.persistentState.Delete(bucket, []byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Config) runStateDeleteBucketCmd(cmd *cobra.Command, args []string) error {
@@ -187,14 +361,20 @@ func (c *Config) runStateDeleteBucketCmd(cmd *cobra.Command, args []string) erro
 
 func (c *Config) runStateDumpCmd(cmd *cobra.Command, args []string) error {
 	data, err := chezmoi.PersistentStateData(c.persistentState, map[string][]byte{
+		"applyCheckpointState":     applyCheckpointStateBucket,
 		"configState":              chezmoi.ConfigStateBucket,
 		"entryState":               chezmoi.EntryStateBucket,
+		"generationState":          generationStateBucket,
 		"gitHubKeysState":          gitHubKeysStateBucket,
 		"gitHubLatestReleaseState": gitHubLatestReleaseStateBucket,
 		"gitHubReleasesState":      gitHubReleasesStateBucket,
 		"gitHubTagsState":          gitHubTagsStateBucket,
 		"gitRepoExternalState":     chezmoi.GitRepoExternalStateBucket,
+		"scriptLog":                chezmoi.ScriptLogBucket,
+		"scriptSchedule":           chezmoi.ScriptScheduleBucket,
 		"scriptState":              chezmoi.ScriptStateBucket,
+		"snapshotState":            snapshotStateBucket,
+		"trashState":               chezmoi.TrashStateBucket,
 	})
 	if err != nil {
 		return err
@@ -202,6 +382,25 @@ func (c *Config) runStateDumpCmd(cmd *cobra.Command, args []string) error {
 	return c.marshal(c.Format, data)
 }
 
+func (c *Config) runStateExportCmd(cmd *cobra.Command, args []string) error {
+	buckets, err := chezmoi.PersistentStateBuckets(c.persistentState)
+	if err != nil {
+		return err
+	}
+	data := make(map[string]map[string]any, len(buckets))
+	for _, bucket := range buckets {
+		bucketData := make(map[string]any)
+		if err := c.persistentState.ForEach([]byte(bucket), func(k, v []byte) error {
+			bucketData[string(k)] = exportStateValue(v)
+			return nil
+		}); err != nil {
+			return err
+		}
+		data[bucket] = bucketData
+	}
+	return c.marshal(writeDataFormatJSON, data)
+}
+
 func (c *Config) runStateGetCmd(cmd *cobra.Command, args []string) error {
 	value, err := c.persistentState.Get([]byte(c.state.get.bucket), []byte(c.state.get.key))
 	if err != nil {
@@ -218,6 +417,142 @@ func (c *Config) runStateGetBucketCmd(cmd *cobra.Command, args []string) error {
 	return c.marshal(c.Format, data)
 }
 
+func (c *Config) runStateImportCmd(cmd *cobra.Command, args []string) error {
+	var data []byte
+	var err error
+	if len(args) == 0 {
+		data, err = io.ReadAll(c.stdin)
+	} else {
+		var absPath chezmoi.AbsPath
+		if absPath, err = chezmoi.NewAbsPathFromExtPath(args[0], c.homeDirAbsPath); err != nil {
+			return err
+		}
+		data, err = c.baseSystem.ReadFile(absPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	var state map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	buckets := maps.Keys(state)
+	slices.Sort(buckets)
+	for _, bucket := range buckets {
+		if c.state.importCmd.replace {
+			if err := c.persistentState.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		for key, rawValue := range state[bucket] {
+			value, err := importStateValue(rawValue)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", bucket, key, err)
+			}
+			if err := c.persistentState.Set([]byte(bucket), []byte(key), value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) runStateListCmd(cmd *cobra.Command, args []string) error {
+	var buckets []string
+	if c.state.list.bucket != "" {
+		buckets = []string{c.state.list.bucket}
+	} else {
+		var err error
+		if buckets, err = chezmoi.PersistentStateBuckets(c.persistentState); err != nil {
+			return err
+		}
+	}
+
+	if c.state.list.values {
+		data := make(map[string]map[string]any, len(buckets))
+		for _, bucket := range buckets {
+			bucketData := make(map[string]any)
+			if err := c.persistentState.ForEach([]byte(bucket), func(k, v []byte) error {
+				bucketData[string(k)] = decodeStateValue(v)
+				return nil
+			}); err != nil {
+				return err
+			}
+			data[bucket] = bucketData
+		}
+		if c.state.list.bucket != "" {
+			return c.marshal(c.Format, data[c.state.list.bucket])
+		}
+		return c.marshal(c.Format, data)
+	}
+
+	var builder strings.Builder
+	if c.state.list.bucket == "" {
+		for _, bucket := range buckets {
+			builder.WriteString(bucket + "\n")
+		}
+		return c.writeOutputString(builder.String())
+	}
+	var keys []string
+	if err := c.persistentState.ForEach([]byte(c.state.list.bucket), func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}); err != nil {
+		return err
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		builder.WriteString(key + "\n")
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runStateOrphansCmd(cmd *cobra.Command, args []string) error {
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return err
+	}
+	managedAbsPaths := make(map[chezmoi.AbsPath]struct{})
+	for _, targetRelPath := range sourceState.TargetRelPaths() {
+		managedAbsPaths[c.DestDirAbsPath.Join(targetRelPath)] = struct{}{}
+	}
+
+	// Only entry states in the destination directory are considered, as
+	// entry states elsewhere may belong to other destination directories.
+	var orphans []string
+	if err := c.persistentState.ForEach(chezmoi.EntryStateBucket, func(k, v []byte) error {
+		absPath := chezmoi.NewAbsPath(string(k))
+		if targetRelPath, err := absPath.TrimDirPrefix(c.DestDirAbsPath); err != nil || targetRelPath.Empty() {
+			return nil //nolint:nilerr
+		}
+		if _, ok := managedAbsPaths[absPath]; !ok {
+			orphans = append(orphans, absPath.String())
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	slices.Sort(orphans)
+
+	var builder strings.Builder
+	for _, orphan := range orphans {
+		builder.WriteString(orphan + "\n")
+	}
+	if err := c.writeOutputString(builder.String()); err != nil {
+		return err
+	}
+
+	if c.state.orphans.delete {
+		for _, orphan := range orphans {
+			if err := c.persistentState.Delete(chezmoi.EntryStateBucket, []byte(orphan)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *Config) runStateResetCmd(cmd *cobra.Command, args []string) error {
 	persistentStateFileAbsPath, err := c.persistentStateFile()
 	if err != nil {
@@ -246,3 +581,40 @@ func (c *Config) runStateResetCmd(cmd *cobra.Command, args []string) error {
 func (c *Config) runStateSetCmd(cmd *cobra.Command, args []string) error {
 	return c.persistentState.Set([]byte(c.state.set.bucket), []byte(c.state.set.key), []byte(c.state.set.value))
 }
+
+// decodeStateValue returns value decoded from JSON, or value as a string if it
+// is not valid JSON.
+func decodeStateValue(value []byte) any {
+	var result any
+	if err := json.Unmarshal(value, &result); err != nil {
+		return string(value)
+	}
+	return result
+}
+
+// exportStateValue returns the value to export for value. JSON values other
+// than strings are exported as is so that they are readable. All other values
+// are exported as strings containing the raw value.
+func exportStateValue(value []byte) any {
+	if !json.Valid(value) || bytes.HasPrefix(bytes.TrimSpace(value), []byte{'"'}) {
+		return string(value)
+	}
+	return json.RawMessage(value)
+}
+
+// importStateValue returns the raw value for rawValue, the inverse of
+// exportStateValue.
+func importStateValue(rawValue json.RawMessage) ([]byte, error) {
+	if bytes.HasPrefix(rawValue, []byte{'"'}) {
+		var value string
+		if err := json.Unmarshal(rawValue, &value); err != nil {
+			return nil, err
+		}
+		return []byte(value), nil
+	}
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, rawValue); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
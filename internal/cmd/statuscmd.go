@@ -1,22 +1,59 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net/http"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
 )
 
 type statusCmdConfig struct {
-	Exclude   *chezmoi.EntryTypeSet `json:"exclude"   mapstructure:"exclude"   yaml:"exclude"`
-	PathStyle *chezmoi.PathStyle    `json:"pathStyle" mapstructure:"pathStyle" yaml:"pathStyle"`
-	include   *chezmoi.EntryTypeSet
-	init      bool
-	recursive bool
+	Exclude    *chezmoi.EntryTypeSet `json:"exclude"   mapstructure:"exclude"   yaml:"exclude"`
+	PathStyle  *chezmoi.PathStyle    `json:"pathStyle" mapstructure:"pathStyle" yaml:"pathStyle"`
+	Report     statusReportConfig    `json:"report"    mapstructure:"report"    yaml:"report"`
+	explain    bool
+	extraneous bool
+	format     writeDataFormat
+	include    *chezmoi.EntryTypeSet
+	init       bool
+	metadata   bool
+	recursive  bool
+	report     bool
+}
+
+// A statusReportConfig configures where status reports are sent.
+type statusReportConfig struct {
+	Headers map[string]string `json:"headers" mapstructure:"headers" yaml:"headers"`
+	URL     string            `json:"url"     mapstructure:"url"     yaml:"url"`
+}
+
+// A statusReport summarizes the state of a machine, for aggregation by a
+// central server.
+type statusReport struct {
+	Hostname       string     `json:"hostname"                 yaml:"hostname"`
+	OS             string     `json:"os"                       yaml:"os"`
+	Arch           string     `json:"arch"                     yaml:"arch"`
+	Username       string     `json:"username"                 yaml:"username"`
+	Version        string     `json:"version"                  yaml:"version"`
+	GeneratedAt    time.Time  `json:"generatedAt"              yaml:"generatedAt"`
+	SourceCommit   string     `json:"sourceCommit,omitempty"   yaml:"sourceCommit,omitempty"`
+	LastApply      *time.Time `json:"lastApply,omitempty"      yaml:"lastApply,omitempty"`
+	Drift          int        `json:"drift"                    yaml:"drift"`
+	DriftedEntries []string   `json:"driftedEntries,omitempty" yaml:"driftedEntries,omitempty"`
+	PendingScripts []string   `json:"pendingScripts,omitempty" yaml:"pendingScripts,omitempty"`
+	FailedScripts  []string   `json:"failedScripts,omitempty"  yaml:"failedScripts,omitempty"`
 }
 
 func (c *Config) newStatusCmd() *cobra.Command {
@@ -36,9 +73,13 @@ func (c *Config) newStatusCmd() *cobra.Command {
 
 	flags := statusCmd.Flags()
 	flags.VarP(c.Status.Exclude, "exclude", "x", "Exclude entry types")
+	flags.BoolVar(&c.Status.explain, "explain", c.Status.explain, "Explain why each entry is reported")
+	flags.BoolVar(&c.Status.extraneous, "extraneous", c.Status.extraneous, "Report unmanaged entries in managed directories")
+	flags.VarP(&c.Status.format, "format", "f", "Report format")
 	flags.VarP(c.Status.PathStyle, "path-style", "p", "Path style")
 	flags.VarP(c.Status.include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.Status.init, "init", c.Status.init, "Recreate config file from template")
+	flags.BoolVar(&c.Status.metadata, "metadata", c.Status.metadata, "Show changes to metadata")
 	flags.BoolVarP(
 		&c.Status.recursive,
 		"recursive",
@@ -46,14 +87,28 @@ func (c *Config) newStatusCmd() *cobra.Command {
 		c.Status.recursive,
 		"Recurse into subdirectories",
 	)
+	flags.BoolVar(&c.Status.report, "report", c.Status.report, "Write a report for aggregation by a central server")
 
 	registerExcludeIncludeFlagCompletionFuncs(statusCmd)
+	if err := statusCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
 
 	return statusCmd
 }
 
 func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
+	scriptLogEntries, err := chezmoi.ScriptLogEntries(c.persistentState)
+	if err != nil {
+		return err
+	}
+	lastScriptLogEntries := make(map[chezmoi.RelPath]*chezmoi.ScriptLogEntry, len(scriptLogEntries))
+	for _, scriptLogEntry := range scriptLogEntries {
+		lastScriptLogEntries[scriptLogEntry.Name] = scriptLogEntry
+	}
+
 	builder := strings.Builder{}
+	var report statusReport
 	preApplyFunc := func(targetRelPath chezmoi.RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState) error {
 		c.logger.Info().
 			Stringer("targetRelPath", targetRelPath).
@@ -68,6 +123,9 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 		)
 		switch {
 		case targetEntryState.Type == chezmoi.EntryStateTypeScript:
+			if scriptLogEntry, ok := lastScriptLogEntries[targetRelPath]; ok && scriptLogEntry.Failed() {
+				x = 'F'
+			}
 			y = 'R'
 		case !targetEntryState.Equivalent(actualEntryState):
 			x = statusRune(lastWrittenEntryState, actualEntryState)
@@ -75,19 +133,32 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 		}
 
 		if x != ' ' || y != ' ' {
-			var path string
-			switch *c.Status.PathStyle {
-			case chezmoi.PathStyleAbsolute:
-				path = c.DestDirAbsPath.Join(targetRelPath).String()
-			case chezmoi.PathStyleRelative:
-				path = targetRelPath.String()
-			case chezmoi.PathStyleSourceAbsolute:
-				return errors.New("source-absolute not supported for status")
-			case chezmoi.PathStyleSourceRelative:
-				return errors.New("source-relative not supported for status")
+			path, err := c.statusPath(targetRelPath)
+			if err != nil {
+				return err
+			}
+			if c.Status.explain {
+				explanation, err := c.statusExplanation(cmd, targetRelPath, x, y, targetEntryState, actualEntryState)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(&builder, "%c%c %s (%s)\n", x, y, path, explanation)
+			} else {
+				fmt.Fprintf(&builder, "%c%c %s\n", x, y, path)
+			}
+			if c.Status.metadata {
+				for _, metadataChange := range entryStateMetadataChanges(actualEntryState, targetEntryState) {
+					fmt.Fprintf(&builder, "    %s\n", metadataChange)
+				}
+			}
+			switch {
+			case targetEntryState.Type != chezmoi.EntryStateTypeScript:
+				report.DriftedEntries = append(report.DriftedEntries, path)
+			case x == 'F':
+				report.FailedScripts = append(report.FailedScripts, path)
+			default:
+				report.PendingScripts = append(report.PendingScripts, path)
 			}
-
-			fmt.Fprintf(&builder, "%c%c %s\n", x, y, path)
 		}
 		return fs.SkipDir
 	}
@@ -101,7 +172,292 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 	}); err != nil {
 		return err
 	}
-	return c.writeOutputString(builder.String())
+
+	if c.Status.explain {
+		sourceState, err := c.getSourceState(cmd.Context(), cmd)
+		if err != nil {
+			return err
+		}
+		if err := c.writeStatusExternals(&builder, sourceState); err != nil {
+			return err
+		}
+	}
+
+	if c.Status.extraneous {
+		sourceState, err := c.getSourceState(cmd.Context(), cmd)
+		if err != nil {
+			return err
+		}
+		extraneousRelPaths, err := c.extraneousRelPaths(sourceState, args)
+		if err != nil {
+			return err
+		}
+		for _, extraneousRelPath := range extraneousRelPaths {
+			path, err := c.statusPath(extraneousRelPath)
+			if err != nil {
+				return err
+			}
+			if c.Status.explain {
+				fmt.Fprintf(&builder, "?? %s (neither managed nor ignored)\n", path)
+			} else {
+				fmt.Fprintf(&builder, "?? %s\n", path)
+			}
+		}
+	}
+
+	if !c.Status.report {
+		return c.writeOutputString(builder.String())
+	}
+
+	report.Drift = len(report.DriftedEntries)
+	if err := c.completeStatusReport(cmd, &report); err != nil {
+		return err
+	}
+	if c.Status.Report.URL != "" {
+		if err := c.postStatusReport(cmd.Context(), &report); err != nil {
+			return err
+		}
+	}
+	return c.marshal(c.Status.format, &report)
+}
+
+// completeStatusReport fills in the fields of report that identify the
+// machine and its last apply.
+func (c *Config) completeStatusReport(cmd *cobra.Command, report *statusReport) error {
+	templateData := c.getTemplateData(cmd)
+	report.Hostname = templateData.fqdnHostname
+	report.OS = runtime.GOOS
+	report.Arch = runtime.GOARCH
+	report.Username = templateData.username
+	report.Version = c.versionInfo.Version
+	report.GeneratedAt = time.Now().UTC()
+	report.SourceCommit = c.sourceCommit()
+
+	generations, err := c.generations()
+	if err != nil {
+		return err
+	}
+	if len(generations) > 0 {
+		lastApply := generations[len(generations)-1].StartedAt
+		report.LastApply = &lastApply
+	}
+	return nil
+}
+
+// postStatusReport sends report as JSON in an HTTP POST request to the
+// configured report URL.
+func (c *Config) postStatusReport(ctx context.Context, report *statusReport) error {
+	data, err := chezmoi.FormatJSON.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Status.Report.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.Status.Report.Headers {
+		req.Header.Set(key, value)
+	}
+
+	transport, err := c.newHTTPTransport()
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{
+		Transport: transport,
+	}
+	resp, err := chezmoilog.LogHTTPRequest(c.logger, httpClient, req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%s: %s", c.Status.Report.URL, resp.Status)
+	}
+	return nil
+}
+
+// statusExplanation returns why targetRelPath is reported with status x and y.
+func (c *Config) statusExplanation(
+	cmd *cobra.Command,
+	targetRelPath chezmoi.RelPath,
+	x, y rune,
+	targetEntryState, actualEntryState *chezmoi.EntryState,
+) (string, error) {
+	var explanations []string
+	switch x {
+	case 'F':
+		explanations = append(explanations, "failed last time it was run")
+	case 'A', 'D', 'M':
+		explanations = append(explanations, "changed since chezmoi last wrote it")
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return "", err
+	}
+	sourceStateEntry := sourceState.Get(targetRelPath)
+
+	switch {
+	case targetEntryState.Type == chezmoi.EntryStateTypeScript && sourceStateEntry != nil:
+		targetAbsPath := c.DestDirAbsPath.Join(targetRelPath)
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(c.destSystem, targetAbsPath)
+		if err != nil {
+			return "", err
+		}
+		if targetStateScript, ok := targetStateEntry.(*chezmoi.TargetStateScript); ok {
+			runReason, err := targetStateScript.RunReason(c.persistentState, targetAbsPath)
+			if err != nil {
+				return "", err
+			}
+			explanations = append(explanations, runReason)
+		}
+	case y == 'D':
+		explanations = append(explanations, statusRemoveExplanation(sourceStateEntry))
+	case y == 'A':
+		explanations = append(explanations, "missing")
+	case y == 'M':
+		switch {
+		case actualEntryState.Type != targetEntryState.Type:
+			explanations = append(explanations, fmt.Sprintf("is a %s, should be a %s", actualEntryState.Type, targetEntryState.Type))
+		case !bytes.Equal(actualEntryState.ContentsSHA256, targetEntryState.ContentsSHA256):
+			explanations = append(explanations, "contents differ")
+		case actualEntryState.Mode != targetEntryState.Mode:
+			explanations = append(explanations, fmt.Sprintf("mode is %03o, should be %03o", actualEntryState.Mode.Perm(), targetEntryState.Mode.Perm()))
+		}
+	}
+	return strings.Join(explanations, ", "), nil
+}
+
+// entryStateMetadataChanges returns the changes to the metadata of an entry
+// from fromEntryState to toEntryState, one per element. The only metadata that
+// chezmoi manages are the permissions of files and directories.
+func entryStateMetadataChanges(fromEntryState, toEntryState *chezmoi.EntryState) []string {
+	if fromEntryState == nil || toEntryState == nil || fromEntryState.Type != toEntryState.Type {
+		return nil
+	}
+	switch toEntryState.Type {
+	case chezmoi.EntryStateTypeDir, chezmoi.EntryStateTypeFile:
+	default:
+		return nil
+	}
+	if fromEntryState.Mode.Perm() == toEntryState.Mode.Perm() {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("mode %04o -> %04o", fromEntryState.Mode.Perm(), toEntryState.Mode.Perm()),
+	}
+}
+
+// statusRemoveExplanation returns why the target of sourceStateEntry will be
+// removed.
+func statusRemoveExplanation(sourceStateEntry chezmoi.SourceStateEntry) string {
+	switch sourceStateEntry := sourceStateEntry.(type) {
+	case *chezmoi.SourceStateRemove:
+		if origin, ok := sourceStateEntry.Origin().(chezmoi.SourceStateOriginRemovePatterns); ok {
+			return "matches " + origin.OriginString()
+		}
+		return "not managed in exact directory"
+	case *chezmoi.SourceStateFile:
+		if sourceStateEntry.Attr.Type == chezmoi.SourceFileTypeRemove {
+			return "has remove_ attribute"
+		}
+		return "source file is empty"
+	default:
+		return "will be removed"
+	}
+}
+
+// writeStatusExternals writes the externals that were refreshed while reading
+// sourceState, or that need refreshing, and why.
+func (c *Config) writeStatusExternals(builder *strings.Builder, sourceState *chezmoi.SourceState) error {
+	externalRefreshReasons := sourceState.ExternalRefreshReasons()
+	now := time.Now()
+	externalRelPaths, externals := sourceState.Externals()
+	for _, externalRelPath := range externalRelPaths {
+		refreshReason, ok := externalRefreshReasons[externalRelPath]
+		if ok {
+			refreshReason = "refreshed, " + refreshReason
+		} else {
+			for _, external := range externals[externalRelPath] {
+				refreshReason = sourceState.ExternalRefreshReason(external, chezmoi.RefreshExternalsAuto, now)
+				if refreshReason != "" {
+					refreshReason = "needs refresh, " + refreshReason
+					break
+				}
+			}
+		}
+		if refreshReason == "" {
+			continue
+		}
+		path, err := c.statusPath(externalRelPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(builder, " E %s (external %s)\n", path, refreshReason)
+	}
+	return nil
+}
+
+// extraneousRelPaths returns the target paths of all unmanaged, unignored
+// entries in managed directories. Entries in exact directories are excluded as
+// they are already reported as deleted.
+func (c *Config) extraneousRelPaths(sourceState *chezmoi.SourceState, args []string) ([]chezmoi.RelPath, error) {
+	var targetRelPaths []chezmoi.RelPath
+	if len(args) == 0 {
+		targetRelPaths = sourceState.TargetRelPaths()
+	} else {
+		var err error
+		targetRelPaths, err = c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+			mustBeManaged: true,
+			recursive:     true,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var extraneousRelPaths chezmoi.RelPaths
+	for _, targetRelPath := range targetRelPaths {
+		sourceStateDir, ok := sourceState.Get(targetRelPath).(*chezmoi.SourceStateDir)
+		if !ok || sourceStateDir.Attr.Exact {
+			continue
+		}
+		dirEntries, err := c.destSystem.ReadDir(c.DestDirAbsPath.Join(targetRelPath))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		for _, dirEntry := range dirEntries {
+			entryRelPath := targetRelPath.JoinString(dirEntry.Name())
+			if sourceState.Get(entryRelPath) != nil || sourceState.Ignore(entryRelPath) {
+				continue
+			}
+			extraneousRelPaths = append(extraneousRelPaths, entryRelPath)
+		}
+	}
+	sort.Sort(extraneousRelPaths)
+	return extraneousRelPaths, nil
+}
+
+// statusPath returns the path of targetRelPath in the configured path style.
+func (c *Config) statusPath(targetRelPath chezmoi.RelPath) (string, error) {
+	switch *c.Status.PathStyle {
+	case chezmoi.PathStyleAbsolute:
+		return c.DestDirAbsPath.Join(targetRelPath).String(), nil
+	case chezmoi.PathStyleRelative:
+		return targetRelPath.String(), nil
+	case chezmoi.PathStyleSourceAbsolute:
+		return "", errors.New("source-absolute not supported for status")
+	case chezmoi.PathStyleSourceRelative:
+		return "", errors.New("source-relative not supported for status")
+	default:
+		return "", fmt.Errorf("%s: invalid path style", *c.Status.PathStyle)
+	}
 }
 
 func statusRune(fromState, toState *chezmoi.EntryState) rune {
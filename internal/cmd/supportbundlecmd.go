@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/spf13/cobra"
+	vfs "github.com/twpayne/go-vfs/v4"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+)
+
+const (
+	supportBundleMaxLogSize = 1 << 20
+	supportBundleRedacted   = "<redacted>"
+)
+
+var (
+	lastPanicFileRelPath = chezmoi.NewRelPath("last-panic.txt")
+
+	// supportBundleSecretKeyRx matches config keys whose values are likely to
+	// be secrets.
+	supportBundleSecretKeyRx = regexp.MustCompile(`(?i)key|passphrase|password|secret|token`)
+
+	// supportBundleSecretValueRx matches assignments of likely secrets in log
+	// lines.
+	supportBundleSecretValueRx = regexp.MustCompile(
+		`(?i)((?:key|passphrase|password|secret|token)\w*["']?\s*[:=]\s*["']?)[^\s"',}]+`,
+	)
+
+	// supportBundleURLUserinfoRx matches the userinfo, for example the
+	// username and password, in URLs.
+	supportBundleURLUserinfoRx = regexp.MustCompile(`(\b[A-Za-z][\w+.-]*://)[^/\s@]+@`)
+
+	// supportBundleRedactedConfigKeys are the config keys whose values are
+	// always redacted.
+	supportBundleRedactedConfigKeys = map[string]bool{
+		"data":      true,
+		"env":       true,
+		"headers":   true,
+		"scriptEnv": true,
+	}
+)
+
+func (c *Config) newSupportBundleCmd() *cobra.Command {
+	supportBundleCmd := &cobra.Command{
+		Use:     "support-bundle",
+		Short:   "Write an archive of diagnostic information for bug reports",
+		Long:    mustLongHelp("support-bundle"),
+		Example: example("support-bundle"),
+		Args:    cobra.NoArgs,
+		RunE:    c.runSupportBundleCmd,
+		Annotations: newAnnotations(
+			doesNotRequireValidConfig,
+			runsCommands,
+		),
+	}
+
+	return supportBundleCmd
+}
+
+func (c *Config) runSupportBundleCmd(cmd *cobra.Command, args []string) error {
+	files := make(map[string][]byte)
+
+	// Capture the output of chezmoi doctor.
+	doctorOutput := &bytes.Buffer{}
+	stdout := c.stdout
+	c.stdout = doctorOutput
+	doctorErr := c.runDoctorCmd(cmd, nil)
+	c.stdout = stdout
+	if doctorErr != nil {
+		fmt.Fprintf(doctorOutput, "error: %v\n", doctorErr)
+	}
+	files["doctor.txt"] = doctorOutput.Bytes()
+
+	// Dump the config with secrets removed.
+	configMap, err := c.configMap()
+	if err != nil {
+		return err
+	}
+	config, err := chezmoi.FormatYAML.Marshal(redactConfig(configMap, false))
+	if err != nil {
+		return err
+	}
+	files["config.yaml"] = config
+
+	// Collect facts about the operating system.
+	osFacts := map[string]any{
+		"arch":      runtime.GOARCH,
+		"goVersion": runtime.Version(),
+		"numCPU":    runtime.NumCPU(),
+		"os":        runtime.GOOS,
+		"version":   c.versionStr,
+	}
+	if kernel, err := chezmoi.Kernel(c.fileSystem); err == nil && kernel != nil {
+		osFacts["kernel"] = kernel
+	}
+	if osRelease, err := chezmoi.OSRelease(c.fileSystem); err == nil {
+		osFacts["osRelease"] = osRelease
+	}
+	osFactsData, err := chezmoi.FormatYAML.Marshal(osFacts)
+	if err != nil {
+		return err
+	}
+	files["os.yaml"] = osFactsData
+
+	// Include the tail of the log file, if any.
+	if !c.Log.File.Empty() {
+		switch log, err := c.fileSystem.ReadFile(c.Log.File.String()); {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			if len(log) > supportBundleMaxLogSize {
+				log = log[len(log)-supportBundleMaxLogSize:]
+			}
+			files["log.txt"] = redactLog(log)
+		}
+	}
+
+	// Include the last panic, if any.
+	switch lastPanic, err := c.fileSystem.ReadFile(c.CacheDirAbsPath.Join(lastPanicFileRelPath).String()); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		files["last-panic.txt"] = redactLog(lastPanic)
+	}
+
+	// Replace the user's home directory with ~ in all files.
+	for name, data := range files {
+		files[name] = bytes.ReplaceAll(data, []byte(c.homeDirAbsPath.String()), []byte("~"))
+	}
+
+	data, err := supportBundleArchive(files)
+	if err != nil {
+		return err
+	}
+	return c.writeOutput(data)
+}
+
+// recoverPanic cleans up after a panic with value and stack, so that the
+// persistent state is not left locked and no partially-written temporary
+// files remain, records a crash report, and returns an error describing the
+// panic.
+func (c *Config) recoverPanic(value any, stack []byte) error {
+	if c.persistentState != nil {
+		if err := c.persistentState.Close(); err != nil {
+			c.errorf("warning: %v\n", err)
+		}
+		c.persistentState = nil
+	}
+	for tempAbsPath := range c.tempAbsPaths {
+		if err := c.fileSystem.RemoveAll(tempAbsPath.String()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.errorf("warning: %v\n", err)
+		}
+		delete(c.tempAbsPaths, tempAbsPath)
+	}
+	c.errorf("panic: %v\n", value)
+	if lastPanicAbsPath, err := c.recordPanic(value, stack); err != nil {
+		c.errorf("warning: cannot write crash report: %v\n", err)
+		c.errorf("%s\n", stack)
+	} else {
+		c.errorf("crash report written to %s, run chezmoi support-bundle to include it in a bug report\n", lastPanicAbsPath)
+	}
+	return chezmoi.ExitCodeError(2)
+}
+
+// recordPanic writes value and stack to the cache directory so that it can be
+// included in a support bundle. It returns the path of the crash report.
+func (c *Config) recordPanic(value any, stack []byte) (chezmoi.AbsPath, error) {
+	if c.CacheDirAbsPath.Empty() {
+		return chezmoi.EmptyAbsPath, errors.New("no cache directory")
+	}
+	builder := strings.Builder{}
+	fmt.Fprintf(&builder, "time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&builder, "version: %s\n", c.versionStr)
+	fmt.Fprintf(&builder, "args: %q\n", os.Args)
+	fmt.Fprintf(&builder, "panic: %v\n\n", value)
+	builder.Write(stack)
+	if err := vfs.MkdirAll(c.fileSystem, c.CacheDirAbsPath.String(), 0o700); err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	lastPanicAbsPath := c.CacheDirAbsPath.Join(lastPanicFileRelPath)
+	if err := c.fileSystem.WriteFile(lastPanicAbsPath.String(), []byte(builder.String()), 0o600); err != nil {
+		return chezmoi.EmptyAbsPath, err
+	}
+	return lastPanicAbsPath, nil
+}
+
+// redactLog returns log with likely secrets redacted.
+func redactLog(log []byte) []byte {
+	log = supportBundleURLUserinfoRx.ReplaceAll(log, []byte("${1}"+supportBundleRedacted+"@"))
+	return supportBundleSecretValueRx.ReplaceAll(log, []byte("${1}"+supportBundleRedacted))
+}
+
+// redactURLUserinfo returns s with the userinfo of any URLs redacted.
+func redactURLUserinfo(s string) string {
+	return supportBundleURLUserinfoRx.ReplaceAllString(s, "${1}"+supportBundleRedacted+"@")
+}
+
+// redactConfig returns a copy of value with likely secrets redacted. If
+// redactAll is true then all leaf values are redacted.
+func redactConfig(value any, redactAll bool) any {
+	switch value := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for k, v := range value {
+			redact := redactAll || supportBundleRedactedConfigKeys[k] || supportBundleSecretKeyRx.MatchString(k)
+			result[k] = redactConfig(v, redact)
+		}
+		return result
+	case []any:
+		result := make([]any, 0, len(value))
+		for _, v := range value {
+			result = append(result, redactConfig(v, redactAll))
+		}
+		return result
+	case nil:
+		return nil
+	case string:
+		if redactAll {
+			return supportBundleRedacted
+		}
+		return redactURLUserinfo(value)
+	default:
+		if redactAll {
+			return supportBundleRedacted
+		}
+		return value
+	}
+}
+
+// supportBundleArchive returns a gzipped tar archive containing files.
+func supportBundleArchive(files map[string][]byte) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+	names := maps.Keys(files)
+	slices.Sort(names)
+	for _, name := range names {
+		data := files[name]
+		if err := tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "chezmoi-support-bundle/" + name,
+			Size:     int64(len(data)),
+			Mode:     0o644,
+			ModTime:  modTime,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tarWriter.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -1,33 +1,51 @@
 package cmd
 
 import (
-	"strings"
-
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+type targetPathCmdConfig struct {
+	all  bool
+	json bool
+}
+
 func (c *Config) newTargetPathCmd() *cobra.Command {
 	targetPathCmd := &cobra.Command{
-		Use:         "target-path [source-path]...",
-		Short:       "Print the target path of a source path",
-		Long:        mustLongHelp("target-path"),
-		Example:     example("target-path"),
-		RunE:        c.runTargetPathCmd,
-		Annotations: newAnnotations(),
+		Use:               "target-path [source-path]...",
+		Short:             "Print the target path of a source path",
+		Long:              mustLongHelp("target-path"),
+		Example:           example("target-path"),
+		ValidArgsFunction: c.sourcePathValidArgs,
+		RunE:              c.runTargetPathCmd,
+		Annotations:       newAnnotations(),
 	}
 
+	flags := targetPathCmd.Flags()
+	flags.BoolVarP(&c.targetPathCmd.all, "all", "a", c.targetPathCmd.all, "Print the target paths of all managed source paths")
+	flags.BoolVar(&c.targetPathCmd.json, "json", c.targetPathCmd.json, "Print source and target paths as JSON")
+
 	return targetPathCmd
 }
 
 func (c *Config) runTargetPathCmd(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
-		return c.writeOutputString(c.DestDirAbsPath.String() + "\n")
+	if c.targetPathCmd.all {
+		if len(args) != 0 {
+			return errAllWithPaths
+		}
+		sourceState, err := c.getSourceState(cmd.Context(), cmd)
+		if err != nil {
+			return err
+		}
+		return c.writePathMappings(c.allPathMappings(sourceState), c.targetPathCmd.json, pathMappingTarget)
 	}
 
-	builder := strings.Builder{}
+	if len(args) == 0 && !c.targetPathCmd.json {
+		return c.writeOutputString(c.DestDirAbsPath.String() + "\n")
+	}
 
+	pathMappings := make([]pathMapping, 0, len(args))
 	for _, arg := range args {
 		argAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
 		if err != nil {
@@ -51,19 +69,11 @@ func (c *Config) runTargetPathCmd(cmd *cobra.Command, args []string) error {
 
 		targetRelPath := sourceRelPath.TargetRelPath(c.encryption.EncryptedSuffix())
 
-		if _, err := builder.WriteString(c.DestDirAbsPath.String()); err != nil {
-			return err
-		}
-		if err := builder.WriteByte('/'); err != nil {
-			return err
-		}
-		if _, err := builder.WriteString(targetRelPath.String()); err != nil {
-			return err
-		}
-		if err := builder.WriteByte('\n'); err != nil {
-			return err
-		}
+		pathMappings = append(pathMappings, pathMapping{
+			Source: argAbsPath.String(),
+			Target: c.DestDirAbsPath.Join(targetRelPath).String(),
+		})
 	}
 
-	return c.writeOutputString(builder.String())
+	return c.writePathMappings(pathMappings, c.targetPathCmd.json, pathMappingTarget)
 }
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/ascii85"
+	"encoding/base32"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -12,10 +15,14 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/bradenhilton/mozillainstallhash"
+	"github.com/google/uuid"
 	"github.com/itchyny/gojq"
 	"gopkg.in/ini.v1"
 	"howett.net/plist"
@@ -59,10 +66,109 @@ func (e invalidPathTypeError) Error() string {
 // errEmptyPath is returned when a path is empty.
 var errEmptyPath = errors.New("empty path")
 
+// machineUUIDNamespace is the namespace of the UUIDs returned by machineUUID.
+var machineUUIDNamespace = uuid.MustParse("6b0a4a3e-8d1c-5f6e-9a3b-63686573686d")
+
+// machineIDFiles are the files that contain the machine ID, in order of
+// preference.
+var machineIDFiles = []string{
+	"/etc/machine-id",
+	"/var/lib/dbus/machine-id",
+}
+
 // needsQuoteRx matches any string that contains non-printable characters,
 // double quotes, or a backslash.
 var needsQuoteRx = regexp.MustCompile(`[^\x21\x23-\x5b\x5d-\x7e]`)
 
+// secretTemplateFuncNames are the names of the template functions that return
+// secrets. The values of variables assigned from them are redacted in template
+// traces.
+var secretTemplateFuncNames = []string{
+	"awsSecretsManager",
+	"awsSecretsManagerRaw",
+	"azureKeyVault",
+	"bitwarden",
+	"bitwardenAttachment",
+	"bitwardenAttachmentByRef",
+	"bitwardenFields",
+	"bitwardenSecrets",
+	"dashlaneNote",
+	"dashlanePassword",
+	"decrypt",
+	"doppler",
+	"dopplerProjectJson",
+	"ejsonDecrypt",
+	"ejsonDecryptWithKey",
+	"gopass",
+	"gopassBinary",
+	"gopassData",
+	"gopassList",
+	"gopassRaw",
+	"hcpVaultSecret",
+	"hcpVaultSecretJson",
+	"keepassxc",
+	"keepassxcAttachment",
+	"keepassxcAttribute",
+	"keeper",
+	"keeperDataFields",
+	"keeperFindPassword",
+	"keyring",
+	"lastpass",
+	"lastpassAttachment",
+	"lastpassRaw",
+	"onepassword",
+	"onepasswordDetailsFields",
+	"onepasswordDocument",
+	"onepasswordItemFields",
+	"onepasswordRead",
+	"pass",
+	"passFields",
+	"passRaw",
+	"passhole",
+	"protonPass",
+	"protonPassJSON",
+	"rbw",
+	"rbwFields",
+	"secret",
+	"secretJSON",
+	"vault",
+}
+
+// secretWriteTemplateFuncNames are the names of the template functions that
+// write secrets.
+var secretWriteTemplateFuncNames = []string{
+	"keyringSet",
+	"onepasswordWrite",
+	"vaultWrite",
+}
+
+func (c *Config) base32DecodeTemplateFunc(s string) string {
+	result, err := base32.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(result)
+}
+
+func (c *Config) base32EncodeTemplateFunc(s string) string {
+	return base32.StdEncoding.EncodeToString([]byte(s))
+}
+
+func (c *Config) base85DecodeTemplateFunc(s string) string {
+	result := make([]byte, len(s))
+	n, _, err := ascii85.Decode(result, []byte(s), true)
+	if err != nil {
+		panic(err)
+	}
+	return string(result[:n])
+}
+
+func (c *Config) base85EncodeTemplateFunc(s string) string {
+	result := make([]byte, ascii85.MaxEncodedLen(len(s)))
+	n := ascii85.Encode(result, []byte(s))
+	return string(result[:n])
+}
+
 func (c *Config) commentTemplateFunc(prefix, s string) string {
 	type stateType int
 	const (
@@ -247,6 +353,7 @@ func (c *Config) hexEncodeTemplateFunc(s string) string {
 }
 
 func (c *Config) includeTemplateFunc(filename string) string {
+	c.recordInclude(filename)
 	searchDirAbsPaths := []chezmoi.AbsPath{c.SourceDirAbsPath}
 	contents, err := c.readFile(filename, searchDirAbsPaths)
 	if err != nil {
@@ -256,6 +363,7 @@ func (c *Config) includeTemplateFunc(filename string) string {
 }
 
 func (c *Config) includeTemplateTemplateFunc(filename string, args ...any) string {
+	c.recordInclude(filename)
 	var data any
 	switch len(args) {
 	case 0:
@@ -379,6 +487,11 @@ func (c *Config) lstatTemplateFunc(name string) any {
 	}
 }
 
+func (c *Config) machineUUIDTemplateFunc(names ...string) string {
+	machineID := c.machineID()
+	return uuid.NewSHA1(machineUUIDNamespace, []byte(strings.Join(append([]string{machineID}, names...), "\x00"))).String()
+}
+
 func (c *Config) mozillaInstallHashTemplateFunc(path string) string {
 	mozillaInstallHash, err := mozillainstallhash.MozillaInstallHash(path)
 	if err != nil {
@@ -445,10 +558,86 @@ func (c *Config) readFile(filename string, searchDirAbsPaths []chezmoi.AbsPath)
 	return data, err
 }
 
+func (c *Config) regexCapturesTemplateFunc(expr, s string) map[string]string {
+	re := regexp.MustCompile(expr)
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+	return regexCapturesMap(re, match)
+}
+
+func (c *Config) regexCapturesAllTemplateFunc(expr, s string) []map[string]string {
+	re := regexp.MustCompile(expr)
+	matches := re.FindAllStringSubmatch(s, -1)
+	result := make([]map[string]string, 0, len(matches))
+	for _, match := range matches {
+		result = append(result, regexCapturesMap(re, match))
+	}
+	return result
+}
+
 func (c *Config) replaceAllRegexTemplateFunc(expr, repl, s string) string {
 	return regexp.MustCompile(expr).ReplaceAllString(s, repl)
 }
 
+func (c *Config) semverCmpTemplateFunc(v1, v2 string) int {
+	version1, err := semver.NewVersion(v1)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", v1, err))
+	}
+	version2, err := semver.NewVersion(v2)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", v2, err))
+	}
+	return version1.Compare(version2)
+}
+
+func (c *Config) semverMaxSatisfyingTemplateFunc(constraint string, versionList []any) string {
+	constraints, err := semver.NewConstraint(constraint)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", constraint, err))
+	}
+	versionStrs, err := anySliceToStringSlice(versionList)
+	if err != nil {
+		panic(err)
+	}
+	var maxVersion *semver.Version
+	var maxVersionStr string
+	for _, versionStr := range versionStrs {
+		version, err := semver.NewVersion(versionStr)
+		if err != nil {
+			continue
+		}
+		if constraints.Check(version) && (maxVersion == nil || version.GreaterThan(maxVersion)) {
+			maxVersion = version
+			maxVersionStr = versionStr
+		}
+	}
+	return maxVersionStr
+}
+
+func (c *Config) semverSortTemplateFunc(versionList []any) []string {
+	versionStrs, err := anySliceToStringSlice(versionList)
+	if err != nil {
+		panic(err)
+	}
+	versions := make([]*semver.Version, 0, len(versionStrs))
+	for _, versionStr := range versionStrs {
+		version, err := semver.NewVersion(versionStr)
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", versionStr, err))
+		}
+		versions = append(versions, version)
+	}
+	sort.Stable(semver.Collection(versions))
+	result := make([]string, 0, len(versions))
+	for _, version := range versions {
+		result = append(result, version.Original())
+	}
+	return result
+}
+
 func (c *Config) setValueAtPathTemplateFunc(path, value, dict any) any {
 	keys, lastKey, err := keysFromPath(path)
 	if err != nil {
@@ -481,6 +670,17 @@ func (c *Config) setValueAtPathTemplateFunc(path, value, dict any) any {
 	return result
 }
 
+func (c *Config) sortNaturalTemplateFunc(list []any) []string {
+	result, err := anySliceToStringSlice(list)
+	if err != nil {
+		panic(err)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return naturalLess(result[i], result[j])
+	})
+	return result
+}
+
 func (c *Config) statTemplateFunc(name string) any {
 	switch fileInfo, err := c.fileSystem.Stat(name); {
 	case err == nil:
@@ -545,6 +745,19 @@ func (c *Config) toYamlTemplateFunc(data any) string {
 	return string(yaml)
 }
 
+// machineID returns an identifier for the machine that is stable across
+// reboots, falling back to the hostname if no machine ID is available.
+func (c *Config) machineID() string {
+	for _, machineIDFile := range machineIDFiles {
+		if data, err := c.fileSystem.ReadFile(machineIDFile); err == nil {
+			if machineID := string(bytes.TrimSpace(data)); machineID != "" {
+				return machineID
+			}
+		}
+	}
+	return c.getTemplateData(nil).fqdnHostname
+}
+
 func fileInfoToMap(fileInfo fs.FileInfo) map[string]any {
 	return map[string]any{
 		"name":    fileInfo.Name(),
@@ -694,6 +907,56 @@ func writeIniMap(w io.Writer, data map[string]any, sectionPrefix string) error {
 	return nil
 }
 
+// naturalLess returns if a is less than b, comparing runs of digits
+// numerically.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		aDigits := leadingDigits(a)
+		bDigits := leadingDigits(b)
+		switch {
+		case aDigits != "" && bDigits != "":
+			aNumber := strings.TrimLeft(aDigits, "0")
+			bNumber := strings.TrimLeft(bDigits, "0")
+			if len(aNumber) != len(bNumber) {
+				return len(aNumber) < len(bNumber)
+			}
+			if aNumber != bNumber {
+				return aNumber < bNumber
+			}
+			a, b = a[len(aDigits):], b[len(bDigits):]
+		case a[0] != b[0]:
+			return a[0] < b[0]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// leadingDigits returns the leading ASCII digits of s.
+func leadingDigits(s string) string {
+	for i, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsDigit(r) {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// regexCapturesMap returns a map of the capture groups in match, which is a
+// match of re. Named capture groups are keyed by their name and all capture
+// groups are keyed by their index.
+func regexCapturesMap(re *regexp.Regexp, match []string) map[string]string {
+	result := make(map[string]string, 2*len(match))
+	for i, name := range re.SubexpNames() {
+		result[strconv.Itoa(i)] = match[i]
+		if name != "" {
+			result[name] = match[i]
+		}
+	}
+	return result
+}
+
 func maybeQuote(s string) string {
 	if needsQuote(s) {
 		return strconv.Quote(s)
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/rogpeppe/go-internal/txtar"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoimaps"
+)
+
+// testDataName is the name of the file in a test archive that contains the
+// template data.
+const testDataName = "data.yaml"
+
+// A testFile is a test in YAML format.
+type testFile struct {
+	Data    map[string]any    `yaml:"data"`
+	Targets map[string]string `yaml:"targets"`
+}
+
+// A testTarget is the expected contents of a target.
+type testTarget struct {
+	targetRelPath chezmoi.RelPath
+	contents      []byte
+}
+
+func (c *Config) newTestCmd() *cobra.Command {
+	testCmd := &cobra.Command{
+		Use:     "test [file]...",
+		Short:   "Run the template tests in the source directory",
+		Long:    mustLongHelp("test"),
+		Example: example("test"),
+		RunE:    c.runTestCmd,
+		Annotations: newAnnotations(
+			persistentStateModeEmpty,
+			requiresSourceDirectory,
+		),
+	}
+
+	return testCmd
+}
+
+func (c *Config) runTestCmd(cmd *cobra.Command, args []string) error {
+	var testAbsPaths []chezmoi.AbsPath
+	if len(args) == 0 {
+		testsDirAbsPath := c.SourceDirAbsPath.JoinString(chezmoi.TestsDirName)
+		var matches []string
+		for _, pattern := range []string{"*.txtar", "*.yaml"} {
+			patternMatches, err := c.sourceSystem.Glob(testsDirAbsPath.JoinString(pattern).String())
+			if err != nil {
+				return err
+			}
+			matches = append(matches, patternMatches...)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			testAbsPaths = append(testAbsPaths, chezmoi.NewAbsPath(match))
+		}
+	} else {
+		for _, arg := range args {
+			testAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
+			if err != nil {
+				return err
+			}
+			testAbsPaths = append(testAbsPaths, testAbsPath)
+		}
+	}
+
+	// Render templates in an empty temporary destination directory and never
+	// prompt for values.
+	destDirAbsPath, err := c.tempDir("chezmoi-test")
+	if err != nil {
+		return err
+	}
+	c.interactiveTemplateFuncs.promptDefaults = true
+
+	builder := strings.Builder{}
+	failed := false
+	for _, testAbsPath := range testAbsPaths {
+		name := strings.TrimSuffix(testAbsPath.Base(), path.Ext(testAbsPath.Base()))
+		switch failures, err := c.runTest(cmd, destDirAbsPath, testAbsPath); {
+		case err != nil:
+			failed = true
+			fmt.Fprintf(&builder, "FAIL %s\n  %v\n", name, err)
+		case failures != "":
+			failed = true
+			fmt.Fprintf(&builder, "FAIL %s\n%s", name, failures)
+		default:
+			fmt.Fprintf(&builder, "ok   %s\n", name)
+		}
+	}
+	if err := c.writeOutputString(builder.String()); err != nil {
+		return err
+	}
+
+	if failed {
+		return chezmoi.ExitCodeError(1)
+	}
+	return nil
+}
+
+// runTest runs the test at testAbsPath and returns a description of any
+// failures.
+func (c *Config) runTest(cmd *cobra.Command, destDirAbsPath, testAbsPath chezmoi.AbsPath) (string, error) {
+	data, err := c.baseSystem.ReadFile(testAbsPath)
+	if err != nil {
+		return "", err
+	}
+
+	var templateData map[string]any
+	var testTargets []testTarget
+	if testAbsPath.Ext() == ".yaml" {
+		templateData, testTargets, err = parseYAMLTest(data)
+	} else {
+		templateData, testTargets, err = parseTxtarTest(data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", testAbsPath, err)
+	}
+	if len(testTargets) == 0 {
+		return "", fmt.Errorf("%s: no targets", testAbsPath)
+	}
+
+	sourceState, err := c.newProfileSourceState(cmd, destDirAbsPath, templateData)
+	if err != nil {
+		return "", err
+	}
+
+	destSystem := chezmoi.NewReadOnlySystem(c.destSystem)
+	builder := strings.Builder{}
+	for _, testTarget := range testTargets {
+		targetRelPath := testTarget.targetRelPath
+		sourceStateEntry := sourceState.Get(targetRelPath)
+		if sourceStateEntry == nil {
+			fmt.Fprintf(&builder, "  %s: not managed\n", targetRelPath)
+			continue
+		}
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(destSystem, destDirAbsPath.Join(targetRelPath))
+		if err != nil {
+			fmt.Fprintf(&builder, "  %s: %v\n", targetRelPath, err)
+			continue
+		}
+		contents, err := targetStateEntryContents(targetStateEntry)
+		if err != nil {
+			fmt.Fprintf(&builder, "  %s: %v\n", targetRelPath, err)
+			continue
+		}
+		if bytes.Equal(contents, testTarget.contents) {
+			continue
+		}
+		diffPatch, err := chezmoi.DiffPatch(targetRelPath, testTarget.contents, 0o644, contents, 0o644)
+		if err != nil {
+			return "", err
+		}
+		if err := diff.NewUnifiedEncoder(&builder, diff.DefaultContextLines).Encode(diffPatch); err != nil {
+			return "", err
+		}
+	}
+	return builder.String(), nil
+}
+
+// parseTxtarTest parses a test in txtar format. The archive contains an
+// optional data.yaml file with template data overrides and, for each target to
+// check, a file whose name is ~/ followed by the target's path and whose
+// contents are the expected contents of the target.
+func parseTxtarTest(data []byte) (map[string]any, []testTarget, error) {
+	templateData := make(map[string]any)
+	var testTargets []testTarget
+	for _, file := range txtar.Parse(data).Files {
+		switch {
+		case file.Name == testDataName:
+			if err := chezmoi.FormatYAML.Unmarshal(file.Data, &templateData); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", file.Name, err)
+			}
+		case strings.HasPrefix(file.Name, "~/"):
+			testTargets = append(testTargets, testTarget{
+				targetRelPath: chezmoi.NewRelPath(path.Clean(strings.TrimPrefix(file.Name, "~/"))),
+				contents:      file.Data,
+			})
+		default:
+			return nil, nil, fmt.Errorf("%s: invalid file name", file.Name)
+		}
+	}
+	return templateData, testTargets, nil
+}
+
+// parseYAMLTest parses a test in YAML format.
+func parseYAMLTest(data []byte) (map[string]any, []testTarget, error) {
+	var testFile testFile
+	if err := chezmoi.FormatYAML.Unmarshal(data, &testFile); err != nil {
+		return nil, nil, err
+	}
+	testTargets := make([]testTarget, 0, len(testFile.Targets))
+	for _, target := range chezmoimaps.SortedKeys(testFile.Targets) {
+		testTargets = append(testTargets, testTarget{
+			targetRelPath: chezmoi.NewRelPath(path.Clean(target)),
+			contents:      []byte(testFile.Targets[target]),
+		})
+	}
+	return testFile.Data, testTargets, nil
+}
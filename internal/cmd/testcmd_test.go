@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v4"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
+)
+
+func TestParseTxtarTest(t *testing.T) {
+	templateData, testTargets, err := parseTxtarTest([]byte(chezmoitest.JoinLines(
+		"Test description.",
+		"-- data.yaml --",
+		"email: me@example.com",
+		"-- ~/.gitconfig --",
+		"[user]",
+		"    email = me@example.com",
+	)))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"email": "me@example.com"}, templateData)
+	assert.Equal(t, []testTarget{
+		{
+			targetRelPath: chezmoi.NewRelPath(".gitconfig"),
+			contents:      []byte(chezmoitest.JoinLines("[user]", "    email = me@example.com")),
+		},
+	}, testTargets)
+
+	_, _, err = parseTxtarTest([]byte(chezmoitest.JoinLines(
+		"-- .gitconfig --",
+	)))
+	assert.Error(t, err)
+}
+
+func TestTestCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fails due to Windows paths on GitHub Actions")
+	}
+	for _, tc := range []struct {
+		name          string
+		test          string
+		expectedErr   bool
+		expectedLines []string
+	}{
+		{
+			name: "pass",
+			test: chezmoitest.JoinLines(
+				"data:",
+				"  email: me@example.com",
+				"targets:",
+				"  .file: |",
+				"    # me@example.com",
+			),
+			expectedLines: []string{
+				"ok   test",
+			},
+		},
+		{
+			name: "fail",
+			test: chezmoitest.JoinLines(
+				"data:",
+				"  email: you@example.com",
+				"targets:",
+				"  .file: |",
+				"    # me@example.com",
+			),
+			expectedErr: true,
+			expectedLines: []string{
+				"FAIL test",
+				"-# me@example.com",
+				"+# you@example.com",
+			},
+		},
+		{
+			name: "not_managed",
+			test: chezmoitest.JoinLines(
+				"targets:",
+				"  .missing: |",
+				"    contents",
+			),
+			expectedErr: true,
+			expectedLines: []string{
+				"FAIL test",
+				"  .missing: not managed",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoitests/test.yaml": tc.test,
+					"dot_file.tmpl":           "# {{ .email }}\n",
+				},
+			}, func(fileSystem vfs.FS) {
+				stdout := strings.Builder{}
+				c := newTestConfig(t, fileSystem, withStdout(&stdout))
+				err := c.execute([]string{"test"})
+				if tc.expectedErr {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+				for _, expectedLine := range tc.expectedLines {
+					assert.Contains(t, stdout.String(), expectedLine+"\n")
+				}
+			})
+		})
+	}
+}
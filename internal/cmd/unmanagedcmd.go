@@ -1,21 +1,28 @@
 package cmd
 
 import (
-	"fmt"
 	"io/fs"
 	"sort"
-	"strings"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/maps"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 )
 
 type unmanagedCmdConfig struct {
+	filter    *chezmoi.EntryTypeFilter
+	format    listFormat
 	pathStyle chezmoi.PathStyle
 }
 
+// An unmanagedEntry is an unmanaged entry, as written by chezmoi unmanaged.
+type unmanagedEntry struct {
+	Path string `json:"path" yaml:"path"`
+	Type string `json:"type" yaml:"type"`
+}
+
 func (c *Config) newUnmanagedCmd() *cobra.Command {
 	unmanagedCmd := &cobra.Command{
 		Use:         "unmanaged [path]...",
@@ -28,9 +35,16 @@ func (c *Config) newUnmanagedCmd() *cobra.Command {
 	}
 
 	flags := unmanagedCmd.Flags()
+	flags.VarP(c.unmanaged.filter.Exclude, "exclude", "x", "Exclude entry types")
+	flags.VarP(&c.unmanaged.format, "format", "f", "Output format")
+	flags.VarP(c.unmanaged.filter.Include, "include", "i", "Include entry types")
 	flags.VarP(&c.unmanaged.pathStyle, "path-style", "p", "Path style")
 
-	if err := unmanagedCmd.RegisterFlagCompletionFunc("path-style", chezmoi.PathStyleFlagCompletionFunc); err != nil {
+	registerExcludeIncludeFlagCompletionFuncs(unmanagedCmd)
+	if err := chezmoierrors.Combine(
+		unmanagedCmd.RegisterFlagCompletionFunc("format", listFormatFlagCompletionFunc),
+		unmanagedCmd.RegisterFlagCompletionFunc("path-style", chezmoi.PathStyleFlagCompletionFunc),
+	); err != nil {
 		panic(err)
 	}
 
@@ -56,7 +70,7 @@ func (c *Config) runUnmanagedCmd(cmd *cobra.Command, args []string, sourceState
 		sort.Sort(absPaths)
 	}
 
-	unmanagedRelPaths := make(map[chezmoi.RelPath]struct{})
+	unmanagedRelPaths := make(map[chezmoi.RelPath]fs.FileInfo)
 	walkFunc := func(destAbsPath chezmoi.AbsPath, fileInfo fs.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -71,8 +85,8 @@ func (c *Config) runUnmanagedCmd(cmd *cobra.Command, args []string, sourceState
 		sourceStateEntry := sourceState.Get(targetRelPath)
 		managed := sourceStateEntry != nil
 		ignored := sourceState.Ignore(targetRelPath)
-		if !managed && !ignored {
-			unmanagedRelPaths[targetRelPath] = struct{}{}
+		if !managed && !ignored && c.unmanaged.filter.IncludeFileInfo(fileInfo) {
+			unmanagedRelPaths[targetRelPath] = fileInfo
 		}
 		if fileInfo.IsDir() {
 			switch {
@@ -96,16 +110,57 @@ func (c *Config) runUnmanagedCmd(cmd *cobra.Command, args []string, sourceState
 		}
 	}
 
-	builder := strings.Builder{}
 	sortedRelPaths := chezmoi.RelPaths(maps.Keys(unmanagedRelPaths))
 	sort.Sort(sortedRelPaths)
+
+	if c.unmanaged.format == listFormatTree {
+		root := "."
+		if c.unmanaged.pathStyle == chezmoi.PathStyleAbsolute {
+			root = c.DestDirAbsPath.String()
+		}
+		paths := make([]string, 0, len(sortedRelPaths))
+		for _, relPath := range sortedRelPaths {
+			paths = append(paths, relPath.String())
+		}
+		return c.writePaths(c.unmanaged.format, root, paths)
+	}
+
+	entries := make([]*unmanagedEntry, 0, len(sortedRelPaths))
 	for _, relPath := range sortedRelPaths {
+		var path string
 		switch c.unmanaged.pathStyle {
 		case chezmoi.PathStyleAbsolute:
-			fmt.Fprintln(&builder, c.DestDirAbsPath.Join(relPath))
+			path = c.DestDirAbsPath.Join(relPath).String()
 		case chezmoi.PathStyleRelative:
-			fmt.Fprintln(&builder, relPath)
+			path = relPath.String()
 		}
+		entries = append(entries, &unmanagedEntry{
+			Path: path,
+			Type: fileInfoEntryType(unmanagedRelPaths[relPath]),
+		})
+	}
+
+	if dataFormat := c.unmanaged.format.writeDataFormat(); dataFormat != "" {
+		return c.marshal(dataFormat, entries)
+	}
+
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return c.writePaths(c.unmanaged.format, "", paths)
+}
+
+// fileInfoEntryType returns the type of fileInfo as a string.
+func fileInfoEntryType(fileInfo fs.FileInfo) string {
+	switch {
+	case fileInfo.IsDir():
+		return "dir"
+	case fileInfo.Mode().IsRegular():
+		return "file"
+	case fileInfo.Mode().Type() == fs.ModeSymlink:
+		return "symlink"
+	default:
+		return "other"
 	}
-	return c.writeOutputString(builder.String())
 }
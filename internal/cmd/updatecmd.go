@@ -2,20 +2,29 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
-	"github.com/go-git/go-git/v5"
+	gogit "github.com/go-git/go-git/v5"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
+	"github.com/twpayne/chezmoi/v2/internal/git"
 )
 
 type updateCmdConfig struct {
 	Command           string   `json:"command"           mapstructure:"command"           yaml:"command"`
 	Args              []string `json:"args"              mapstructure:"args"              yaml:"args"`
+	Autostash         bool     `json:"autostash"         mapstructure:"autostash"         yaml:"autostash"`
 	RecurseSubmodules bool     `json:"recurseSubmodules" mapstructure:"recurseSubmodules" yaml:"recurseSubmodules"`
+	SkipSubmodules    []string `json:"skipSubmodules"    mapstructure:"skipSubmodules"    yaml:"skipSubmodules"`
+	SubmoduleDepth    int      `json:"submoduleDepth"    mapstructure:"submoduleDepth"    yaml:"submoduleDepth"`
 	apply             bool
 	filter            *chezmoi.EntryTypeFilter
 	init              bool
+	pushMirrors       bool
 	recursive         bool
 }
 
@@ -33,20 +42,25 @@ func (c *Config) newUpdateCmd() *cobra.Command {
 			requiresSourceDirectory,
 			requiresWorkingTree,
 			runsCommands,
+			writesSecrets,
 		),
 	}
 
 	flags := updateCmd.Flags()
 	flags.BoolVarP(&c.Update.apply, "apply", "a", c.Update.apply, "Apply after pulling")
+	flags.BoolVar(&c.Update.Autostash, "autostash", c.Update.Autostash, "Stash uncommitted changes before pulling")
 	flags.VarP(c.Update.filter.Exclude, "exclude", "x", "Exclude entry types")
 	flags.VarP(c.Update.filter.Include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.Update.init, "init", c.Update.init, "Recreate config file from template")
+	flags.BoolVar(&c.Update.pushMirrors, "push-mirrors", c.Update.pushMirrors, "Push to mirror remotes after pulling")
 	flags.BoolVar(
 		&c.Update.RecurseSubmodules,
 		"recurse-submodules",
 		c.Update.RecurseSubmodules,
 		"Recursively update submodules",
 	)
+	flags.StringSliceVar(&c.Update.SkipSubmodules, "skip-submodules", c.Update.SkipSubmodules, "Skip submodules")
+	flags.IntVar(&c.Update.SubmoduleDepth, "submodule-depth", c.Update.SubmoduleDepth, "Maximum submodule depth")
 	flags.BoolVarP(&c.Update.recursive, "recursive", "r", c.Update.recursive, "Recurse into subdirectories")
 
 	registerExcludeIncludeFlagCompletionFuncs(updateCmd)
@@ -55,57 +69,280 @@ func (c *Config) newUpdateCmd() *cobra.Command {
 }
 
 func (c *Config) runUpdateCmd(cmd *cobra.Command, args []string) error {
-	switch {
-	case c.Update.Command != "":
+	vcs, err := c.vcs()
+	if err != nil {
+		return err
+	}
+
+	if c.Update.Command != "" {
 		if err := c.run(c.WorkingTreeAbsPath, c.Update.Command, c.Update.Args); err != nil {
 			return err
 		}
-	case c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc):
-		rawWorkingTreeAbsPath, err := c.baseSystem.RawPath(c.WorkingTreeAbsPath)
-		if err != nil {
+	} else if err := vcs.pull(c); err != nil {
+		return err
+	}
+
+	if err := c.updateSourceLayers(); err != nil {
+		return err
+	}
+
+	if c.Update.pushMirrors {
+		if _, ok := vcs.(gitVCS); !ok {
+			return errors.New("--push-mirrors requires git")
+		}
+		if err := c.pushGitMirrors(); err != nil {
 			return err
 		}
-		repo, err := git.PlainOpen(rawWorkingTreeAbsPath.String())
-		if err != nil {
+	}
+
+	if c.Update.apply {
+		if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
+			cmd:          cmd,
+			filter:       c.Update.filter,
+			history:      !c.dryRun,
+			init:         c.Update.init,
+			provision:    len(args) == 0,
+			recursive:    c.Update.recursive,
+			umask:        c.Umask,
+			preApplyFunc: c.defaultPreApplyFunc,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gitPull pulls changes with git, from the primary remote if configured, and
+// then updates submodules.
+func (c *Config) gitPull() error {
+	useBuiltinGit := c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc)
+
+	var repo *gogit.Repository
+	if len(c.Git.Remotes) != 0 || useBuiltinGit {
+		var err error
+		if repo, err = c.openWorkingTreeRepo(); err != nil {
+			return err
+		}
+		if err := c.syncGitRemotes(repo); err != nil {
 			return err
 		}
+	}
+	primaryRemote := c.gitPrimaryRemote()
+
+	if useBuiltinGit {
 		wt, err := repo.Worktree()
 		if err != nil {
 			return err
 		}
-		if err := wt.Pull(&git.PullOptions{
-			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-		}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		// The builtin git cannot stash, so refuse to pull over uncommitted
+		// changes rather than failing with a less helpful error.
+		paths, err := builtinGitUncommittedPaths(wt)
+		if err != nil {
 			return err
 		}
-	default:
-		gitArgs := []string{
-			"pull",
-			"--autostash",
-			"--rebase",
-		}
-		if c.Update.RecurseSubmodules {
-			gitArgs = append(gitArgs,
-				"--recurse-submodules",
+		if len(paths) != 0 {
+			return fmt.Errorf(
+				"uncommitted changes in source directory: %s: the builtin git cannot stash them, "+
+					"commit or discard them and try again",
+				strings.Join(paths, ", "),
 			)
 		}
-		if err := c.run(c.WorkingTreeAbsPath, c.Git.Command, gitArgs); err != nil {
+		pullOptions := &gogit.PullOptions{}
+		if primaryRemote != nil {
+			head, err := repo.Head()
+			if err != nil {
+				return err
+			}
+			auth, err := c.gitRemoteAuth(primaryRemote)
+			if err != nil {
+				return err
+			}
+			pullOptions.RemoteName = primaryRemote.Name
+			pullOptions.ReferenceName = head.Name()
+			pullOptions.Auth = auth
+		}
+		if err := wt.Pull(pullOptions); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
 			return err
 		}
+		if !c.Update.RecurseSubmodules {
+			return nil
+		}
+		return c.updateGitSubmodulesBuiltin(wt, "", c.Update.SubmoduleDepth)
 	}
 
-	if c.Update.apply {
-		if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
-			cmd:          cmd,
-			filter:       c.Update.filter,
-			init:         c.Update.init,
-			recursive:    c.Update.recursive,
-			umask:        c.Umask,
-			preApplyFunc: c.defaultPreApplyFunc,
-		}); err != nil {
+	gitArgs := []string{
+		"pull",
+		"--no-autostash",
+		"--rebase",
+	}
+	if primaryRemote != nil {
+		branch, err := c.cmdOutput(c.WorkingTreeAbsPath, c.Git.Command, []string{"symbolic-ref", "--short", "HEAD"})
+		if err != nil {
 			return err
 		}
+		gitArgs = append(gitArgs, primaryRemote.Name, strings.TrimSpace(string(branch)))
 	}
 
-	return nil
+	// Stash uncommitted changes explicitly, rather than with git pull
+	// --autostash, so that conflicts can be reported clearly.
+	stashed, err := c.gitAutostash()
+	if err != nil {
+		return err
+	}
+
+	var pullErr error
+	if primaryRemote == nil {
+		pullErr = c.run(c.WorkingTreeAbsPath, c.Git.Command, gitArgs)
+	} else {
+		pullErr = c.runGitWithRemote(primaryRemote, gitArgs)
+	}
+	if pullErr != nil {
+		return c.gitPullError(pullErr, stashed)
+	}
+
+	if stashed {
+		if err := c.gitStashPop(); err != nil {
+			return err
+		}
+	}
+
+	if !c.Update.RecurseSubmodules {
+		return nil
+	}
+	return c.updateGitSubmodules()
+}
+
+// gitAutostashMessage is the message of stashes created by chezmoi update.
+const gitAutostashMessage = "chezmoi update autostash"
+
+// gitAutostash stashes any uncommitted changes in the working tree. It returns
+// true if changes were stashed. If there are uncommitted changes and
+// update.autostash is false then it returns an error listing the changed
+// paths.
+func (c *Config) gitAutostash() (bool, error) {
+	status, err := c.gitWorkingTreeStatus()
+	if err != nil {
+		return false, err
+	}
+	paths := gitUncommittedPaths(status)
+	switch {
+	case len(paths) == 0:
+		return false, nil
+	case !c.Update.Autostash:
+		return false, fmt.Errorf(
+			"uncommitted changes in source directory: %s: commit or stash them, or use --autostash",
+			strings.Join(paths, ", "),
+		)
+	}
+	if err := c.run(
+		c.WorkingTreeAbsPath, c.Git.Command, []string{"stash", "push", "--message", gitAutostashMessage},
+	); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// gitPullError returns an error describing the failure pullErr of git pull,
+// including any conflicts and how to resolve them. If stashed is true and
+// there are no conflicts then the stashed changes are restored.
+func (c *Config) gitPullError(pullErr error, stashed bool) error {
+	status, err := c.gitWorkingTreeStatus()
+	if err != nil {
+		return chezmoierrors.Combine(pullErr, err)
+	}
+	paths := gitUnmergedPaths(status)
+	if len(paths) == 0 {
+		if stashed {
+			if err := c.gitStashPop(); err != nil {
+				return chezmoierrors.Combine(pullErr, err)
+			}
+		}
+		return pullErr
+	}
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "conflicts while rebasing local commits: %s\n", strings.Join(paths, ", "))
+	builder.WriteString("resolve the conflicts in the source directory, then run git rebase --continue")
+	if stashed {
+		builder.WriteString(" and git stash pop to restore your uncommitted changes")
+	}
+	return errors.New(builder.String())
+}
+
+// gitStashPop restores the changes stashed by gitAutostash. If they conflict
+// with the pulled changes then the stash is kept and an error describing the
+// conflicts is returned.
+func (c *Config) gitStashPop() error {
+	popErr := c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"stash", "pop"})
+	if popErr == nil {
+		return nil
+	}
+	status, err := c.gitWorkingTreeStatus()
+	if err != nil {
+		return chezmoierrors.Combine(popErr, err)
+	}
+	paths := gitUnmergedPaths(status)
+	if len(paths) == 0 {
+		return popErr
+	}
+	return fmt.Errorf(
+		"uncommitted changes conflict with pulled changes: %s\n"+
+			"resolve the conflicts in the source directory, then run git stash drop",
+		strings.Join(paths, ", "),
+	)
+}
+
+// gitWorkingTreeStatus returns the status of the working tree.
+func (c *Config) gitWorkingTreeStatus() (*git.Status, error) {
+	output, err := c.cmdOutput(
+		c.WorkingTreeAbsPath, c.Git.Command, []string{"status", "--porcelain=v2", "--untracked-files=no"},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return git.ParseStatusPorcelainV2(output)
+}
+
+// gitUncommittedPaths returns the paths with uncommitted changes in status.
+func gitUncommittedPaths(status *git.Status) []string {
+	var paths []string
+	for _, s := range status.Ordinary {
+		paths = append(paths, s.Path)
+	}
+	for _, s := range status.RenamedOrCopied {
+		paths = append(paths, s.Path)
+	}
+	for _, s := range status.Unmerged {
+		paths = append(paths, s.Path)
+	}
+	return paths
+}
+
+// gitUnmergedPaths returns the paths with conflicts in status.
+func gitUnmergedPaths(status *git.Status) []string {
+	paths := make([]string, 0, len(status.Unmerged))
+	for _, s := range status.Unmerged {
+		paths = append(paths, s.Path)
+	}
+	return paths
+}
+
+// builtinGitUncommittedPaths returns the sorted paths with uncommitted changes
+// in wt, ignoring untracked files.
+func builtinGitUncommittedPaths(wt *gogit.Worktree) ([]string, error) {
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == gogit.Untracked || fileStatus.Staging == gogit.Untracked {
+			continue
+		}
+		if fileStatus.Worktree != gogit.Unmodified || fileStatus.Staging != gogit.Unmodified {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
 }
@@ -12,7 +12,6 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"net/http"
 	"os"
 	"os/exec"
 	"regexp"
@@ -23,17 +22,29 @@ import (
 	"github.com/google/go-github/v58/github"
 	"github.com/spf13/cobra"
 
+	"github.com/twpayne/chezmoi/v2/assets/cosign"
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
 )
 
 const (
 	upgradeMethodBrewUpgrade       = "brew-upgrade"
+	upgradeMethodMacPortsUpgrade   = "macports-upgrade"
+	upgradeMethodNix               = "nix"
 	upgradeMethodReplaceExecutable = "replace-executable"
+	upgradeMethodScoopUpdate       = "scoop-update"
 	upgradeMethodSnapRefresh       = "snap-refresh"
 	upgradeMethodUpgradePackage    = "upgrade-package"
 	upgradeMethodSudoPrefix        = "sudo-"
 	upgradeMethodWinGetUpgrade     = "winget-upgrade"
+
+	upgradeChannelPrerelease = "prerelease"
+	upgradeChannelStable     = "stable"
+
+	upgradeSignatureCosign   = "cosign"
+	upgradeSignatureMinisign = "minisign"
+	upgradeSignatureNone     = "none"
 )
 
 var (
@@ -42,10 +53,13 @@ var (
 )
 
 type upgradeCmdConfig struct {
+	channel    string
 	executable string
 	method     string
 	owner      string
+	publicKey  chezmoi.AbsPath
 	repo       string
+	signature  string
 }
 
 func (c *Config) newUpgradeCmd() *cobra.Command {
@@ -62,10 +76,21 @@ func (c *Config) newUpgradeCmd() *cobra.Command {
 	}
 
 	flags := upgradeCmd.Flags()
+	flags.StringVar(&c.upgrade.channel, "channel", c.upgrade.channel, "Set release channel")
 	flags.StringVar(&c.upgrade.executable, "executable", c.upgrade.method, "Set executable to replace")
 	flags.StringVar(&c.upgrade.method, "method", c.upgrade.method, "Set upgrade method")
 	flags.StringVar(&c.upgrade.owner, "owner", c.upgrade.owner, "Set owner")
+	flags.Var(&c.upgrade.publicKey, "public-key", "Set public key to verify signatures")
 	flags.StringVar(&c.upgrade.repo, "repo", c.upgrade.repo, "Set repo")
+	flags.StringVar(&c.upgrade.signature, "signature", c.upgrade.signature, "Set signature verification method")
+
+	if err := chezmoierrors.Combine(
+		upgradeCmd.MarkFlagFilename("public-key"),
+		upgradeCmd.RegisterFlagCompletionFunc("channel", upgradeChannelFlagCompletionFunc),
+		upgradeCmd.RegisterFlagCompletionFunc("signature", upgradeSignatureFlagCompletionFunc),
+	); err != nil {
+		panic(err)
+	}
 
 	return upgradeCmd
 }
@@ -85,12 +110,8 @@ func (c *Config) runUpgradeCmd(cmd *cobra.Command, args []string) error {
 	}
 	client := chezmoi.NewGitHubClient(ctx, httpClient)
 
-	// Get the latest release.
-	rr, _, err := client.Repositories.GetLatestRelease(ctx, c.upgrade.owner, c.upgrade.repo)
-	if err != nil {
-		return err
-	}
-	version, err := semver.NewVersion(strings.TrimPrefix(rr.GetName(), "v"))
+	// Get the latest release in the channel.
+	rr, version, err := c.getUpgradeRelease(ctx, client)
 	if err != nil {
 		return err
 	}
@@ -132,10 +153,20 @@ func (c *Config) runUpgradeCmd(cmd *cobra.Command, args []string) error {
 		if err := c.brewUpgrade(); err != nil {
 			return err
 		}
+	case upgradeMethodMacPortsUpgrade:
+		if err := c.macPortsUpgrade(); err != nil {
+			return err
+		}
+	case upgradeMethodNix:
+		return fmt.Errorf("%s: installed with Nix, upgrade with Nix instead", executableAbsPath)
 	case upgradeMethodReplaceExecutable:
 		if err := c.replaceExecutable(ctx, executableAbsPath, version, rr); err != nil {
 			return err
 		}
+	case upgradeMethodScoopUpdate:
+		if err := c.scoopUpdate(); err != nil {
+			return err
+		}
 	case upgradeMethodSnapRefresh:
 		if err := c.snapRefresh(); err != nil {
 			return err
@@ -187,6 +218,9 @@ func (c *Config) getChecksums(ctx context.Context, rr *github.RepositoryRelease)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.verifySignature(ctx, rr, name, data); err != nil {
+		return nil, err
+	}
 
 	checksums := make(map[string][]byte)
 	s := bufio.NewScanner(bytes.NewReader(data))
@@ -200,31 +234,51 @@ func (c *Config) getChecksums(ctx context.Context, rr *github.RepositoryRelease)
 	return checksums, s.Err()
 }
 
-func (c *Config) downloadURL(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
-	if err != nil {
-		return nil, err
-	}
-	httpClient, err := c.getHTTPClient()
-	if err != nil {
-		return nil, err
-	}
-	resp, err := chezmoilog.LogHTTPRequest(c.logger, httpClient, req)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != http.StatusOK {
-		_ = resp.Body.Close()
-		return nil, fmt.Errorf("%s: %s", url, resp.Status)
-	}
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if err := resp.Body.Close(); err != nil {
-		return nil, err
+// getUpgradeRelease returns the latest release in the configured channel and
+// its version.
+func (c *Config) getUpgradeRelease(
+	ctx context.Context,
+	client *github.Client,
+) (*github.RepositoryRelease, *semver.Version, error) {
+	switch c.upgrade.channel {
+	case upgradeChannelStable:
+		rr, _, err := client.Repositories.GetLatestRelease(ctx, c.upgrade.owner, c.upgrade.repo)
+		if err != nil {
+			return nil, nil, err
+		}
+		version, err := semver.NewVersion(strings.TrimPrefix(rr.GetName(), "v"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return rr, version, nil
+	case upgradeChannelPrerelease:
+		rrs, _, err := client.Repositories.ListReleases(ctx, c.upgrade.owner, c.upgrade.repo, &github.ListOptions{
+			PerPage: 100,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		var latestRR *github.RepositoryRelease
+		var latestVersion *semver.Version
+		for _, rr := range rrs {
+			if rr.GetDraft() {
+				continue
+			}
+			version, err := semver.NewVersion(strings.TrimPrefix(rr.GetTagName(), "v"))
+			if err != nil {
+				continue
+			}
+			if latestVersion == nil || latestVersion.LessThan(*version) {
+				latestRR, latestVersion = rr, version
+			}
+		}
+		if latestRR == nil {
+			return nil, nil, fmt.Errorf("%s/%s: no releases found", c.upgrade.owner, c.upgrade.repo)
+		}
+		return latestRR, latestVersion, nil
+	default:
+		return nil, nil, fmt.Errorf("%s: invalid channel", c.upgrade.channel)
 	}
-	return data, nil
 }
 
 func (c *Config) replaceExecutable(
@@ -320,12 +374,102 @@ func (c *Config) verifyChecksum(ctx context.Context, rr *github.RepositoryReleas
 	return nil
 }
 
-// getReleaseAssetByName returns the release asset from rr with the given name.
-func getReleaseAssetByName(rr *github.RepositoryRelease, name string) *github.ReleaseAsset {
-	for i, ra := range rr.Assets {
-		if ra.GetName() == name {
-			return rr.Assets[i]
+// verifySignature verifies the signature of the release asset name with data
+// using the configured signature verification method.
+func (c *Config) verifySignature(ctx context.Context, rr *github.RepositoryRelease, name string, data []byte) error {
+	var signatureName string
+	switch c.upgrade.signature {
+	case "", upgradeSignatureNone:
+		return nil
+	case upgradeSignatureCosign:
+		signatureName = name + ".sig"
+	case upgradeSignatureMinisign:
+		signatureName = name + ".minisig"
+	default:
+		return fmt.Errorf("%s: invalid signature verification method", c.upgrade.signature)
+	}
+
+	signatureReleaseAsset := getReleaseAssetByName(rr, signatureName)
+	if signatureReleaseAsset == nil {
+		return fmt.Errorf("%s: cannot find release asset", signatureName)
+	}
+	signatureData, err := c.downloadURL(ctx, signatureReleaseAsset.GetBrowserDownloadURL())
+	if err != nil {
+		return err
+	}
+
+	// If no public key is given, then cosign uses the public key embedded in
+	// chezmoi, which is only valid for chezmoi's own releases. The public key
+	// is never downloaded from the release, as an attacker who can replace the
+	// release assets could also replace the public key. minisign public keys
+	// must always be given explicitly.
+	var publicKeyData []byte
+	switch {
+	case !c.upgrade.publicKey.Empty():
+		if publicKeyData, err = c.baseSystem.ReadFile(c.upgrade.publicKey); err != nil {
+			return err
 		}
+	case c.upgrade.signature == upgradeSignatureCosign && c.upgrade.owner == gitHubOwner && c.upgrade.repo == gitHubRepo:
+		publicKeyData = cosign.PublicKey
+	default:
+		return fmt.Errorf("%s: public key required", c.upgrade.signature)
+	}
+	if len(publicKeyData) == 0 {
+		return fmt.Errorf("%s: empty public key", c.upgrade.signature)
+	}
+
+	tempDirAbsPath, err := c.tempDir("chezmoi-upgrade")
+	if err != nil {
+		return err
+	}
+	dataAbsPath := tempDirAbsPath.JoinString(name)
+	signatureAbsPath := tempDirAbsPath.JoinString(signatureName)
+	publicKeyAbsPath := tempDirAbsPath.JoinString(c.upgrade.signature + ".pub")
+	for absPath, data := range map[chezmoi.AbsPath][]byte{
+		dataAbsPath:      data,
+		signatureAbsPath: signatureData,
+		publicKeyAbsPath: publicKeyData,
+	} {
+		if err := c.baseSystem.WriteFile(absPath, data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	var args []string
+	switch c.upgrade.signature {
+	case upgradeSignatureCosign:
+		args = []string{
+			"verify-blob",
+			"--key", publicKeyAbsPath.String(),
+			"--signature", signatureAbsPath.String(),
+			dataAbsPath.String(),
+		}
+	case upgradeSignatureMinisign:
+		args = []string{
+			"-V",
+			"-p", publicKeyAbsPath.String(),
+			"-x", signatureAbsPath.String(),
+			"-m", dataAbsPath.String(),
+		}
+	}
+	if err := c.run(chezmoi.EmptyAbsPath, c.upgrade.signature, args); err != nil {
+		return fmt.Errorf("%s: signature verification failed: %w", name, err)
 	}
 	return nil
 }
+
+func upgradeChannelFlagCompletionFunc(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	return []string{upgradeChannelPrerelease, upgradeChannelStable}, cobra.ShellCompDirectiveNoFileComp
+}
+
+func upgradeSignatureFlagCompletionFunc(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	return []string{
+		upgradeSignatureCosign,
+		upgradeSignatureMinisign,
+		upgradeSignatureNone,
+	}, cobra.ShellCompDirectiveNoFileComp
+}
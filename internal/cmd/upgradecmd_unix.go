@@ -67,6 +67,15 @@ func (c *Config) brewUpgrade() error {
 	return c.run(chezmoi.EmptyAbsPath, "brew", []string{"upgrade", c.upgrade.repo})
 }
 
+func (c *Config) macPortsUpgrade() error {
+	var args []string
+	if os.Getuid() != 0 {
+		args = append(args, "sudo")
+	}
+	args = append(args, "port", "upgrade", c.upgrade.repo)
+	return c.run(chezmoi.EmptyAbsPath, args[0], args[1:])
+}
+
 func (c *Config) getPackageFilename(packageType string, version *semver.Version, os, arch string) (string, error) {
 	if archReplacement, ok := archReplacements[packageType][arch]; ok {
 		arch = archReplacement
@@ -83,6 +92,10 @@ func (c *Config) getPackageFilename(packageType string, version *semver.Version,
 	}
 }
 
+func (c *Config) scoopUpdate() error {
+	return errUnsupportedUpgradeMethod
+}
+
 func (c *Config) snapRefresh() error {
 	return c.run(chezmoi.EmptyAbsPath, "snap", []string{"refresh", c.upgrade.repo})
 }
@@ -225,6 +238,10 @@ func getUpgradeMethod(fileSystem vfs.Stater, executableAbsPath chezmoi.AbsPath)
 		return upgradeMethodBrewUpgrade, nil
 	case runtime.GOOS == "linux" && strings.Contains(executableAbsPath.String(), "/.linuxbrew/"):
 		return upgradeMethodBrewUpgrade, nil
+	case runtime.GOOS == "darwin" && strings.HasPrefix(executableAbsPath.String(), "/opt/local/"):
+		return upgradeMethodMacPortsUpgrade, nil
+	case strings.HasPrefix(executableAbsPath.String(), "/nix/store/"):
+		return upgradeMethodNix, nil
 	}
 
 	// If the executable is in the user's home directory, then always use
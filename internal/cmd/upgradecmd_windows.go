@@ -9,6 +9,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/google/go-github/v58/github"
@@ -37,6 +38,14 @@ func (c *Config) brewUpgrade() error {
 	return errUnsupportedUpgradeMethod
 }
 
+func (c *Config) macPortsUpgrade() error {
+	return errUnsupportedUpgradeMethod
+}
+
+func (c *Config) scoopUpdate() error {
+	return c.run(chezmoi.EmptyAbsPath, "scoop", []string{"update", c.upgrade.repo})
+}
+
 // isWinGetInstall determines if executableAbsPath contains a WinGet installation path.
 func isWinGetInstall(fileSystem vfs.Stater, executableAbsPath string) (bool, error) {
 	realExecutableAbsPath := executableAbsPath
@@ -114,6 +123,12 @@ func getUpgradeMethod(fileSystem vfs.Stater, executableAbsPath chezmoi.AbsPath)
 		return upgradeMethodWinGetUpgrade, nil
 	}
 
+	// Scoop installs applications in $SCOOP\apps, which defaults to
+	// %USERPROFILE%\scoop\apps, so check before the user's home directory.
+	if strings.Contains(strings.ToLower(executableAbsPath.String()), "/scoop/apps/") {
+		return upgradeMethodScoopUpdate, nil
+	}
+
 	// If the executable is in the user's home directory, then always use
 	// replace-executable.
 	switch userHomeDir, err := os.UserHomeDir(); {
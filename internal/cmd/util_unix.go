@@ -4,9 +4,14 @@ package cmd
 
 import (
 	"io/fs"
+	"os"
 	"syscall"
 
+	"github.com/creack/pty/v2"
+	"golang.org/x/term"
+
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/chezmoierrors"
 )
 
 const defaultEditor = "vi"
@@ -17,6 +22,26 @@ func fileInfoUID(info fs.FileInfo) int {
 	return int(info.Sys().(*syscall.Stat_t).Uid) //nolint:forcetypeassert
 }
 
+// openScriptPTY opens a pseudo-terminal for the captured output of a script if
+// terminal is a terminal. The pseudo-terminal is put in raw mode so that the
+// script's output is passed through unmodified.
+func openScriptPTY(terminal *os.File) (*os.File, *os.File, error) {
+	if !term.IsTerminal(int(terminal.Fd())) {
+		return nil, nil, nil
+	}
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pty.InheritSize(terminal, tty); err != nil {
+		return nil, nil, chezmoierrors.Combine(err, tty.Close(), ptmx.Close())
+	}
+	if _, err := term.MakeRaw(int(tty.Fd())); err != nil {
+		return nil, nil, chezmoierrors.Combine(err, tty.Close(), ptmx.Close())
+	}
+	return ptmx, tty, nil
+}
+
 func windowsVersion() (map[string]any, error) {
 	return nil, nil
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"golang.org/x/sys/windows/registry"
@@ -34,6 +35,12 @@ var defaultInterpreters = map[string]*chezmoi.Interpreter{
 	},
 }
 
+// openScriptPTY returns no pseudo-terminal, as scripts' captured output is
+// always written to a pipe on Windows.
+func openScriptPTY(terminal *os.File) (*os.File, *os.File, error) {
+	return nil, nil, nil
+}
+
 func windowsVersion() (map[string]any, error) {
 	registryKey, err := registry.OpenKey(
 		registry.LOCAL_MACHINE,
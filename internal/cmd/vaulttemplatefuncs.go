@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoilog"
 )
@@ -39,3 +41,79 @@ func (c *Config) vaultTemplateFunc(key string) any {
 
 	return data
 }
+
+func (c *Config) vaultWriteTemplateFunc(path, key, value string) string {
+	if !c.writeSecrets {
+		return ""
+	}
+	if _, err := c.vaultWrite(path, key, value); err != nil {
+		panic(err)
+	}
+	return ""
+}
+
+// vaultSecretData returns the key/value pairs of the secret at path. If there
+// is no secret at path then it returns false.
+func (c *Config) vaultSecretData(path string) (map[string]any, bool, error) {
+	args := []string{"kv", "get", "-format=json", path}
+	cmd := exec.Command(c.Vault.Command, args...) //nolint:gosec
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := chezmoilog.LogCmdOutput(cmd)
+	var exitError *exec.ExitError
+	switch {
+	case errors.As(err, &exitError) && exitError.ExitCode() == 2:
+		// vault exits with code 2 if there is no secret at path.
+		return nil, false, nil
+	case err != nil:
+		return nil, false, newCmdOutputError(cmd, output, err)
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(output, &secret); err != nil {
+		return nil, false, newParseCmdOutputError(c.Vault.Command, args, output, err)
+	}
+
+	// Secrets in version 2 key/value secrets engines have their key/value pairs
+	// nested alongside metadata.
+	if data, ok := secret.Data["data"].(map[string]any); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return data, true, nil
+		}
+	}
+	return secret.Data, true, nil
+}
+
+// vaultWrite sets key in the secret at path to value. If key already has value
+// then vaultWrite does nothing. It returns true if the secret was modified.
+func (c *Config) vaultWrite(path, key, value string) (bool, error) {
+	data, exists, err := c.vaultSecretData(path)
+	if err != nil {
+		return false, err
+	}
+	if currentValue, ok := data[key].(string); ok && currentValue == value {
+		return false, nil
+	}
+	if c.dryRun {
+		return true, nil
+	}
+
+	// Pass the value on the standard input so that it does not appear in the
+	// process list.
+	subcommand := "put"
+	if exists {
+		subcommand = "patch"
+	}
+	args := []string{"kv", subcommand, path, key + "=-"}
+	cmd := exec.Command(c.Vault.Command, args...) //nolint:gosec
+	cmd.Stdin = strings.NewReader(value)
+	cmd.Stderr = os.Stderr
+	if output, err := chezmoilog.LogCmdOutput(cmd); err != nil {
+		return false, newCmdOutputError(cmd, output, err)
+	}
+
+	delete(c.Vault.cache, path)
+	return true, nil
+}
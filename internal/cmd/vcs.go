@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/git"
+)
+
+// A vcsConfig is the configuration of a version control system.
+type vcsConfig struct {
+	Command string `json:"command" mapstructure:"command" yaml:"command"`
+}
+
+// A vcs is a version control system that versions the working tree.
+//
+// Statuses are returned as git statuses containing only ordinary changes so
+// that commit message templates and secret scanning work with all version
+// control systems.
+type vcs interface {
+	// autoAdd adds all changes in the working tree and returns the status.
+	autoAdd(c *Config) (*git.Status, error)
+
+	// clone clones the repo at repoURLStr into workingTreeRawPath.
+	clone(c *Config, repoURLStr string, workingTreeRawPath chezmoi.AbsPath) error
+
+	// commit commits all added changes with message.
+	commit(c *Config, message []byte) error
+
+	// dirName returns the name of the file or directory that marks the root
+	// of a working tree.
+	dirName() string
+
+	// init creates a new repo in workingTreeRawPath.
+	init(c *Config, workingTreeRawPath chezmoi.AbsPath) error
+
+	// pull pulls changes from the remote and updates the working tree.
+	pull(c *Config) error
+
+	// push pushes commits to the remote.
+	push(c *Config) error
+}
+
+type (
+	fossilVCS struct{}
+	gitVCS    struct{}
+	hgVCS     struct{}
+	jjVCS     struct{}
+)
+
+// vcs returns the configured version control system.
+func (c *Config) vcs() (vcs, error) {
+	switch c.VCS {
+	case "":
+		markerAbsPath := c.SourceDirAbsPath.JoinString(sourceArchiveMarkerName)
+		if _, err := c.baseSystem.Stat(markerAbsPath); err == nil {
+			return archiveVCS{}, nil
+		}
+		return gitVCS{}, nil
+	case "archive":
+		return archiveVCS{}, nil
+	case "git":
+		return gitVCS{}, nil
+	case "fossil":
+		return fossilVCS{}, nil
+	case "hg":
+		return hgVCS{}, nil
+	case "jj":
+		return jjVCS{}, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown VCS", c.VCS)
+	}
+}
+
+func (gitVCS) autoAdd(c *Config) (*git.Status, error) {
+	if err := c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"add", "."}); err != nil {
+		return nil, err
+	}
+	output, err := c.cmdOutput(c.WorkingTreeAbsPath, c.Git.Command, []string{"status", "--porcelain=v2"})
+	if err != nil {
+		return nil, err
+	}
+	return git.ParseStatusPorcelainV2(output)
+}
+
+func (gitVCS) clone(c *Config, repoURLStr string, workingTreeRawPath chezmoi.AbsPath) error {
+	if c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc) {
+		return c.builtinGitClone(repoURLStr, workingTreeRawPath)
+	}
+	args := []string{
+		"clone",
+	}
+	if c.init.recurseSubmodules {
+		args = append(args,
+			"--recurse-submodules",
+		)
+	}
+	if c.init.branch != "" {
+		args = append(args,
+			"--branch", c.init.branch,
+		)
+	}
+	if c.init.depth != 0 {
+		args = append(args,
+			"--depth", strconv.Itoa(c.init.depth),
+		)
+	}
+	args = append(args, repoURLStr, workingTreeRawPath.String())
+	return c.run(chezmoi.EmptyAbsPath, c.Git.Command, args)
+}
+
+func (gitVCS) commit(c *Config, message []byte) error {
+	return c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"commit", "--message", string(message)})
+}
+
+func (gitVCS) dirName() string {
+	return gogit.GitDirName
+}
+
+func (gitVCS) init(c *Config, workingTreeRawPath chezmoi.AbsPath) error {
+	if c.UseBuiltinGit.Value(c.useBuiltinGitAutoFunc) {
+		return c.builtinGitInit(workingTreeRawPath)
+	}
+	return c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"init", "--quiet"})
+}
+
+func (gitVCS) pull(c *Config) error {
+	return c.gitPull()
+}
+
+func (gitVCS) push(c *Config) error {
+	return c.run(c.WorkingTreeAbsPath, c.Git.Command, []string{"push"})
+}
+
+func (hgVCS) autoAdd(c *Config) (*git.Status, error) {
+	if err := c.run(c.WorkingTreeAbsPath, c.Hg.Command, []string{"addremove", "--quiet"}); err != nil {
+		return nil, err
+	}
+	output, err := c.cmdOutput(c.WorkingTreeAbsPath, c.Hg.Command, []string{"status"})
+	if err != nil {
+		return nil, err
+	}
+	return parseVCSStatus(output, map[string]byte{
+		"A": 'A',
+		"M": 'M',
+		"R": 'D',
+	})
+}
+
+func (hgVCS) clone(c *Config, repoURLStr string, workingTreeRawPath chezmoi.AbsPath) error {
+	args := []string{"clone"}
+	if c.init.branch != "" {
+		args = append(args, "--branch", c.init.branch)
+	}
+	args = append(args, repoURLStr, workingTreeRawPath.String())
+	return c.run(chezmoi.EmptyAbsPath, c.Hg.Command, args)
+}
+
+func (hgVCS) commit(c *Config, message []byte) error {
+	return c.run(c.WorkingTreeAbsPath, c.Hg.Command, []string{"commit", "--message", string(message)})
+}
+
+func (hgVCS) dirName() string {
+	return ".hg"
+}
+
+func (hgVCS) init(c *Config, workingTreeRawPath chezmoi.AbsPath) error {
+	return c.run(chezmoi.EmptyAbsPath, c.Hg.Command, []string{"init", workingTreeRawPath.String()})
+}
+
+func (hgVCS) pull(c *Config) error {
+	return c.run(c.WorkingTreeAbsPath, c.Hg.Command, []string{"pull", "--update"})
+}
+
+func (hgVCS) push(c *Config) error {
+	return c.run(c.WorkingTreeAbsPath, c.Hg.Command, []string{"push"})
+}
+
+func (fossilVCS) autoAdd(c *Config) (*git.Status, error) {
+	if err := c.run(c.WorkingTreeAbsPath, c.Fossil.Command, []string{"addremove"}); err != nil {
+		return nil, err
+	}
+	output, err := c.cmdOutput(c.WorkingTreeAbsPath, c.Fossil.Command, []string{"changes"})
+	if err != nil {
+		return nil, err
+	}
+	return parseVCSStatus(output, map[string]byte{
+		"ADDED":   'A',
+		"DELETED": 'D',
+		"EDITED":  'M',
+		"RENAMED": 'M',
+	})
+}
+
+func (fossilVCS) clone(c *Config, repoURLStr string, workingTreeRawPath chezmoi.AbsPath) error {
+	return c.run(chezmoi.EmptyAbsPath, c.Fossil.Command, []string{
+		"clone",
+		"--workdir", workingTreeRawPath.String(),
+		repoURLStr,
+		fossilRepoRawPath(workingTreeRawPath).String(),
+	})
+}
+
+func (fossilVCS) commit(c *Config, message []byte) error {
+	return c.run(c.WorkingTreeAbsPath, c.Fossil.Command, []string{"commit", "--comment", string(message)})
+}
+
+func (fossilVCS) dirName() string {
+	return ".fslckout"
+}
+
+func (fossilVCS) init(c *Config, workingTreeRawPath chezmoi.AbsPath) error {
+	repoRawPath := fossilRepoRawPath(workingTreeRawPath)
+	if err := c.run(chezmoi.EmptyAbsPath, c.Fossil.Command, []string{"init", repoRawPath.String()}); err != nil {
+		return err
+	}
+	return c.run(c.WorkingTreeAbsPath, c.Fossil.Command, []string{"open", "--force", repoRawPath.String()})
+}
+
+func (fossilVCS) pull(c *Config) error {
+	return c.run(c.WorkingTreeAbsPath, c.Fossil.Command, []string{"update"})
+}
+
+func (fossilVCS) push(c *Config) error {
+	return c.run(c.WorkingTreeAbsPath, c.Fossil.Command, []string{"push"})
+}
+
+func (jjVCS) autoAdd(c *Config) (*git.Status, error) {
+	// jj automatically snapshots the working copy, so there is nothing to add.
+	output, err := c.cmdOutput(c.WorkingTreeAbsPath, c.JJ.Command, []string{"diff", "--summary"})
+	if err != nil {
+		return nil, err
+	}
+	return parseVCSStatus(output, map[string]byte{
+		"A": 'A',
+		"D": 'D',
+		"M": 'M',
+	})
+}
+
+func (jjVCS) clone(c *Config, repoURLStr string, workingTreeRawPath chezmoi.AbsPath) error {
+	return c.run(chezmoi.EmptyAbsPath, c.JJ.Command, []string{"git", "clone", repoURLStr, workingTreeRawPath.String()})
+}
+
+func (jjVCS) commit(c *Config, message []byte) error {
+	return c.run(c.WorkingTreeAbsPath, c.JJ.Command, []string{"commit", "--message", string(message)})
+}
+
+func (jjVCS) dirName() string {
+	return ".jj"
+}
+
+func (jjVCS) init(c *Config, workingTreeRawPath chezmoi.AbsPath) error {
+	return c.run(chezmoi.EmptyAbsPath, c.JJ.Command, []string{"git", "init", workingTreeRawPath.String()})
+}
+
+func (jjVCS) pull(c *Config) error {
+	if err := c.run(c.WorkingTreeAbsPath, c.JJ.Command, []string{"git", "fetch"}); err != nil {
+		return err
+	}
+	return c.run(c.WorkingTreeAbsPath, c.JJ.Command, []string{"rebase", "--branch", "@", "--destination", "trunk()"})
+}
+
+func (jjVCS) push(c *Config) error {
+	// Move the closest bookmark to the new commit before pushing it.
+	if err := c.run(c.WorkingTreeAbsPath, c.JJ.Command, []string{
+		"bookmark", "move", "--from", "heads(::@- & bookmarks())", "--to", "@-",
+	}); err != nil {
+		return err
+	}
+	return c.run(c.WorkingTreeAbsPath, c.JJ.Command, []string{"git", "push"})
+}
+
+// fossilRepoRawPath returns the path of the fossil repository file for the
+// working tree at workingTreeRawPath.
+func fossilRepoRawPath(workingTreeRawPath chezmoi.AbsPath) chezmoi.AbsPath {
+	return workingTreeRawPath.Dir().JoinString(workingTreeRawPath.Base() + ".fossil")
+}
+
+// parseVCSStatus parses data, which contains lines of status codes followed by
+// whitespace and paths, into a git status. codes maps status codes to git
+// status codes. Lines with unknown status codes are ignored.
+func parseVCSStatus(data []byte, codes map[string]byte) (*git.Status, error) {
+	status := &git.Status{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		code, path, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		x, ok := codes[code]
+		if !ok {
+			continue
+		}
+		status.Ordinary = append(status.Ordinary, git.OrdinaryStatus{
+			X:    x,
+			Y:    '.',
+			Path: strings.TrimSpace(path),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/v2/internal/git"
+)
+
+func TestParseVCSStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		codes    map[string]byte
+		expected *git.Status
+	}{
+		{
+			name:     "empty",
+			codes:    map[string]byte{"M": 'M'},
+			expected: &git.Status{},
+		},
+		{
+			name: "hg",
+			data: "" +
+				"M dot_file\n" +
+				"A dot_dir/file\n" +
+				"R dot_removed\n" +
+				"? untracked\n",
+			codes: map[string]byte{
+				"A": 'A',
+				"M": 'M',
+				"R": 'D',
+			},
+			expected: &git.Status{
+				Ordinary: []git.OrdinaryStatus{
+					{X: 'M', Y: '.', Path: "dot_file"},
+					{X: 'A', Y: '.', Path: "dot_dir/file"},
+					{X: 'D', Y: '.', Path: "dot_removed"},
+				},
+			},
+		},
+		{
+			name: "fossil",
+			data: "" +
+				"EDITED     dot_file\n" +
+				"ADDED      dot_dir/file with spaces\n" +
+				"DELETED    dot_removed\n" +
+				"MISSING    dot_missing\n",
+			codes: map[string]byte{
+				"ADDED":   'A',
+				"DELETED": 'D',
+				"EDITED":  'M',
+			},
+			expected: &git.Status{
+				Ordinary: []git.OrdinaryStatus{
+					{X: 'M', Y: '.', Path: "dot_file"},
+					{X: 'A', Y: '.', Path: "dot_dir/file with spaces"},
+					{X: 'D', Y: '.', Path: "dot_removed"},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseVCSStatus([]byte(tc.data), tc.codes)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
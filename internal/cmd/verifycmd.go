@@ -1,13 +1,29 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 )
 
+// verifyFindingTypeExitCodes maps finding types to the bits that they set in
+// chezmoi verify's exit code. Exit code 1 is reserved for errors.
+var verifyFindingTypeExitCodes = map[chezmoi.VerifyFindingType]int{
+	chezmoi.VerifyFindingTypeContent:    2,
+	chezmoi.VerifyFindingTypeMode:       4,
+	chezmoi.VerifyFindingTypeMissing:    8,
+	chezmoi.VerifyFindingTypeExtraneous: 16,
+	chezmoi.VerifyFindingTypeSymlink:    32,
+	chezmoi.VerifyFindingTypeType:       64,
+	chezmoi.VerifyFindingTypeScript:     128,
+}
+
 type verifyCmdConfig struct {
 	Exclude   *chezmoi.EntryTypeSet `json:"exclude" mapstructure:"exclude" yaml:"exclude"`
+	format    writeDataFormat
 	include   *chezmoi.EntryTypeSet
 	init      bool
 	recursive bool
@@ -29,22 +45,55 @@ func (c *Config) newVerifyCmd() *cobra.Command {
 
 	flags := verifyCmd.Flags()
 	flags.VarP(c.Verify.Exclude, "exclude", "x", "Exclude entry types")
+	flags.VarP(&c.Verify.format, "format", "f", "Output format")
 	flags.VarP(c.Verify.include, "include", "i", "Include entry types")
 	flags.BoolVar(&c.Verify.init, "init", c.Verify.init, "Recreate config file from template")
 	flags.BoolVarP(&c.Verify.recursive, "recursive", "r", c.Verify.recursive, "Recurse into subdirectories")
 
 	registerExcludeIncludeFlagCompletionFuncs(verifyCmd)
+	if err := verifyCmd.RegisterFlagCompletionFunc("format", writeDataFormatFlagCompletionFunc); err != nil {
+		panic(err)
+	}
 
 	return verifyCmd
 }
 
 func (c *Config) runVerifyCmd(cmd *cobra.Command, args []string) error {
-	errorOnWriteSystem := chezmoi.NewErrorOnWriteSystem(c.destSystem, chezmoi.ExitCodeError(1))
-	return c.applyArgs(cmd.Context(), errorOnWriteSystem, c.DestDirAbsPath, args, applyArgsOptions{
+	verifySystem := chezmoi.NewVerifySystem(c.destSystem)
+	if err := c.applyArgs(cmd.Context(), verifySystem, c.DestDirAbsPath, args, applyArgsOptions{
 		cmd:       cmd,
 		filter:    chezmoi.NewEntryTypeFilter(c.Verify.include.Bits(), c.Verify.Exclude.Bits()),
 		init:      c.Verify.init,
 		recursive: c.Verify.recursive,
 		umask:     c.Umask,
-	})
+	}); err != nil {
+		return err
+	}
+
+	findings := verifySystem.Findings()
+	if c.Verify.format != "" {
+		if findings == nil {
+			findings = []*chezmoi.VerifyFinding{}
+		}
+		if err := c.marshal(c.Verify.format, findings); err != nil {
+			return err
+		}
+	} else if len(findings) != 0 {
+		var builder strings.Builder
+		for _, finding := range findings {
+			fmt.Fprintf(&builder, "%s %s\n", finding.Type, finding.Path)
+		}
+		if err := c.writeOutputString(builder.String()); err != nil {
+			return err
+		}
+	}
+
+	exitCode := 0
+	for _, finding := range findings {
+		exitCode |= verifyFindingTypeExitCodes[finding.Type]
+	}
+	if exitCode != 0 {
+		return chezmoi.ExitCodeError(exitCode)
+	}
+	return nil
 }
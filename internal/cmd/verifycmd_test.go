@@ -8,6 +8,7 @@ import (
 	"github.com/twpayne/go-vfs/v4"
 	"github.com/twpayne/go-vfs/v4/vfst"
 
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
 	"github.com/twpayne/chezmoi/v2/internal/chezmoitest"
 )
 
@@ -37,6 +38,35 @@ func TestVerifyCmd(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "content",
+			root: map[string]any{
+				"/home/user": map[string]any{
+					".bashrc": &vfst.File{
+						Contents: []byte("# edited\n"),
+						Perm:     0o666 &^ chezmoitest.Umask,
+					},
+					".local/share/chezmoi/dot_bashrc": "# contents of .bashrc\n",
+				},
+			},
+			expectedErr: chezmoi.ExitCodeError(2),
+		},
+		{
+			name: "content_and_missing",
+			root: map[string]any{
+				"/home/user": map[string]any{
+					".bashrc": &vfst.File{
+						Contents: []byte("# edited\n"),
+						Perm:     0o666 &^ chezmoitest.Umask,
+					},
+					".local/share/chezmoi": map[string]any{
+						"dot_bashrc":  "# contents of .bashrc\n",
+						"dot_profile": "# contents of .profile\n",
+					},
+				},
+			},
+			expectedErr: chezmoi.ExitCodeError(2 | 8),
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
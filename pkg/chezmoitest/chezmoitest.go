@@ -0,0 +1,93 @@
+// Package chezmoitest runs chezmoi template tests from Go tests.
+//
+// A template test asserts that, given some template data, each of a set of
+// targets renders to the expected contents. Tests are usually stored as txtar
+// archives in the .chezmoitests directory of the source directory and can also
+// be run with the chezmoi test command.
+package chezmoitest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twpayne/chezmoi/v2/internal/chezmoi"
+	"github.com/twpayne/chezmoi/v2/internal/cmd"
+)
+
+// A Test is a template test.
+type Test struct {
+	// Data overrides the default template data, including the .chezmoi
+	// variables.
+	Data map[string]any
+	// Targets maps target paths, relative to the home directory, to their
+	// expected contents.
+	Targets map[string]string
+}
+
+// Run runs each test in the .chezmoitests directory of sourceDir as a subtest
+// of t.
+func Run(t *testing.T, sourceDir string) {
+	t.Helper()
+	var testFiles []string
+	for _, pattern := range []string{"*.txtar", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(sourceDir, chezmoi.TestsDirName, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testFiles = append(testFiles, matches...)
+	}
+	if len(testFiles) == 0 {
+		t.Fatalf("%s: no tests", filepath.Join(sourceDir, chezmoi.TestsDirName))
+	}
+	for _, testFile := range testFiles {
+		testFile := testFile
+		name := filepath.Base(testFile)
+		t.Run(name[:len(name)-len(filepath.Ext(name))], func(t *testing.T) {
+			RunFile(t, sourceDir, testFile)
+		})
+	}
+}
+
+// RunFile runs the test in testFile, a txtar archive or YAML file, against
+// sourceDir.
+func RunFile(t *testing.T, sourceDir, testFile string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	outputFile := filepath.Join(tempDir, "output")
+	args := []string{
+		"--cache", filepath.Join(tempDir, "cache"),
+		"--config", filepath.Join(tempDir, "chezmoi.yaml"),
+		"--destination", filepath.Join(tempDir, "home"),
+		"--no-tty",
+		"--output", outputFile,
+		"--source", sourceDir,
+		"test", testFile,
+	}
+	exitCode := cmd.Main(cmd.VersionInfo{}, args)
+	output, _ := os.ReadFile(outputFile)
+	if exitCode != 0 {
+		t.Errorf("chezmoi test %s: exit code %d\n%s", testFile, exitCode, output)
+	}
+}
+
+// RunTest runs test against sourceDir.
+func RunTest(t *testing.T, sourceDir string, test Test) {
+	t.Helper()
+	targets := make(map[string]string, len(test.Targets))
+	for target, contents := range test.Targets {
+		targets[filepath.ToSlash(target)] = contents
+	}
+	data, err := chezmoi.FormatYAML.Marshal(map[string]any{
+		"data":    test.Data,
+		"targets": targets,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFile := filepath.Join(t.TempDir(), "test.yaml")
+	if err := os.WriteFile(testFile, data, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	RunFile(t, sourceDir, testFile)
+}
@@ -0,0 +1,24 @@
+package chezmoitest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twpayne/chezmoi/v2/pkg/chezmoitest"
+)
+
+func TestRunTest(t *testing.T) {
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "dot_file.tmpl"), []byte("# {{ .email }}\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	chezmoitest.RunTest(t, sourceDir, chezmoitest.Test{
+		Data: map[string]any{
+			"email": "me@example.com",
+		},
+		Targets: map[string]string{
+			".file": "# me@example.com\n",
+		},
+	})
+}